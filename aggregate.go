@@ -0,0 +1,19 @@
+package scrt
+
+import (
+	"bytes"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// Aggregate folds one numeric column of data with op, decoding only that
+// column. See codec.Aggregate for the supported kinds, integer handling, and
+// the results for payloads without values; an empty data slice counts as a
+// stream with no rows.
+func Aggregate(data []byte, s *schema.Schema, field string, op codec.AggOp) (float64, error) {
+	if s == nil {
+		return 0, ErrSchemaRequired
+	}
+	return codec.Aggregate(bytes.NewReader(data), s, field, op)
+}
@@ -0,0 +1,168 @@
+// Package arrow converts SCRT payloads to Apache Arrow record batches. It is a
+// separate module so the core module does not depend on arrow-go.
+package arrow
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/temporal"
+)
+
+// ToArrow decodes payload into one Arrow record batch with a column per
+// schema field. Kinds map as follows: uint64 and ref to Uint64, int64 to Int64, float64 to Float64,
+// bool to Boolean, string to a dictionary of Utf8 with int32 indices, bytes
+// to Binary, uuid to FixedSizeBinary(16), date to Date32, datetime to a
+// zone-less nanosecond Timestamp, timestamp and timestamptz to a UTC
+// nanosecond Timestamp (the timestamptz offset is dropped), duration to
+// Duration and time to Time64, both in nanoseconds, and lists to List of
+// Utf8 or Uint64. Unset fields become nulls. The caller releases the
+// returned record.
+func ToArrow(s *schema.Schema, payload []byte) (arrow.RecordBatch, error) {
+	if s == nil {
+		return nil, scrt.ErrSchemaRequired
+	}
+	mem := memory.DefaultAllocator
+	fields := make([]arrow.Field, len(s.Fields))
+	builders := make([]array.Builder, len(s.Fields))
+	defer func() {
+		for _, b := range builders {
+			if b != nil {
+				b.Release()
+			}
+		}
+	}()
+	for idx, field := range s.Fields {
+		dt, err := arrowType(field)
+		if err != nil {
+			return nil, err
+		}
+		fields[idx] = arrow.Field{Name: field.Name, Type: dt, Nullable: true}
+		builders[idx] = array.NewBuilder(mem, dt)
+	}
+
+	reader := codec.NewReader(bytes.NewReader(payload), s)
+	row := codec.NewRow(s)
+	var rows int64
+	for {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		for idx, field := range s.Fields {
+			if err := appendArrowValue(builders[idx], field, row.Values()[idx]); err != nil {
+				return nil, fmt.Errorf("scrt: row %d field %s: %w", rows, field.Name, err)
+			}
+		}
+		rows++
+	}
+
+	cols := make([]arrow.Array, len(builders))
+	defer func() {
+		for _, col := range cols {
+			if col != nil {
+				col.Release()
+			}
+		}
+	}()
+	for idx, b := range builders {
+		cols[idx] = b.NewArray()
+	}
+	return array.NewRecordBatch(arrow.NewSchema(fields, nil), cols, rows), nil
+}
+
+// arrowType returns the Arrow type ToArrow uses for field.
+func arrowType(field schema.Field) (arrow.DataType, error) {
+	switch field.ValueKind() {
+	case schema.KindUint64, schema.KindRef:
+		return arrow.PrimitiveTypes.Uint64, nil
+	case schema.KindInt64:
+		return arrow.PrimitiveTypes.Int64, nil
+	case schema.KindFloat64:
+		return arrow.PrimitiveTypes.Float64, nil
+	case schema.KindBool:
+		return arrow.FixedWidthTypes.Boolean, nil
+	case schema.KindString:
+		return &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}, nil
+	case schema.KindBytes:
+		return arrow.BinaryTypes.Binary, nil
+	case schema.KindUUID:
+		return &arrow.FixedSizeBinaryType{ByteWidth: 16}, nil
+	case schema.KindDate:
+		return arrow.FixedWidthTypes.Date32, nil
+	case schema.KindDateTime:
+		return &arrow.TimestampType{Unit: arrow.Nanosecond}, nil
+	case schema.KindTimestamp, schema.KindTimestampTZ:
+		return arrow.FixedWidthTypes.Timestamp_ns, nil
+	case schema.KindDuration:
+		return arrow.FixedWidthTypes.Duration_ns, nil
+	case schema.KindTime:
+		return arrow.FixedWidthTypes.Time64ns, nil
+	case schema.KindList:
+		if field.ElemKind == schema.KindString {
+			return arrow.ListOf(arrow.BinaryTypes.String), nil
+		}
+		return arrow.ListOf(arrow.PrimitiveTypes.Uint64), nil
+	default:
+		return nil, fmt.Errorf("scrt: field %s: kind %d has no arrow type", field.Name, field.ValueKind())
+	}
+}
+
+// appendArrowValue appends one stored value to the builder arrowType chose.
+func appendArrowValue(b array.Builder, field schema.Field, val codec.Value) error {
+	if !val.Set {
+		b.AppendNull()
+		return nil
+	}
+	switch field.ValueKind() {
+	case schema.KindUint64, schema.KindRef:
+		b.(*array.Uint64Builder).Append(val.Uint)
+	case schema.KindInt64:
+		b.(*array.Int64Builder).Append(val.Int)
+	case schema.KindFloat64:
+		b.(*array.Float64Builder).Append(val.Float)
+	case schema.KindBool:
+		b.(*array.BooleanBuilder).Append(val.Bool)
+	case schema.KindString:
+		return b.(*array.BinaryDictionaryBuilder).AppendString(val.Str)
+	case schema.KindBytes:
+		b.(*array.BinaryBuilder).Append(val.Bytes)
+	case schema.KindUUID:
+		b.(*array.FixedSizeBinaryBuilder).Append(val.Bytes)
+	case schema.KindDate:
+		// Dates are stored at UTC midnight, so the division is exact.
+		b.(*array.Date32Builder).Append(arrow.Date32(val.Int / int64(24*time.Hour)))
+	case schema.KindDateTime, schema.KindTimestamp:
+		b.(*array.TimestampBuilder).Append(arrow.Timestamp(val.Int))
+	case schema.KindTimestampTZ:
+		t, err := temporal.DecodeTimestampTZ(val.Str)
+		if err != nil {
+			return err
+		}
+		b.(*array.TimestampBuilder).Append(arrow.Timestamp(temporal.EncodeInstant(t)))
+	case schema.KindDuration:
+		b.(*array.DurationBuilder).Append(arrow.Duration(val.Int))
+	case schema.KindTime:
+		b.(*array.Time64Builder).Append(arrow.Time64(val.Int))
+	case schema.KindList:
+		lb := b.(*array.ListBuilder)
+		lb.Append(true)
+		if field.ElemKind == schema.KindString {
+			lb.ValueBuilder().(*array.StringBuilder).AppendValues(val.Strs, nil)
+		} else {
+			lb.ValueBuilder().(*array.Uint64Builder).AppendValues(val.Uints, nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package arrow_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+
+	"github.com/oarkflow/scrt"
+	scrtarrow "github.com/oarkflow/scrt/arrow"
+	"github.com/oarkflow/scrt/schema"
+)
+
+func parseSingleSchema(t *testing.T, src, name string) *schema.Schema {
+	t.Helper()
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, ok := doc.Schema(name)
+	if !ok {
+		t.Fatalf("%s schema missing", name)
+	}
+	return sch
+}
+
+func TestToArrowMixedKinds(t *testing.T) {
+	sch := parseSingleSchema(t, `@schema Event
+@field ID uint64
+@field Delta int64
+@field Score float64
+@field Active bool
+@field Lang string
+@field Blob bytes
+@field Day date
+@field At timestamp
+@field Window duration
+@field Opens time
+@field Tags list<string>
+`, "Event")
+	at := time.Date(2025, time.June, 1, 10, 30, 0, 0, time.UTC)
+	type event struct {
+		ID     uint64
+		Delta  *int64
+		Score  float64
+		Active bool
+		Lang   *string
+		Blob   []byte
+		Day    time.Time
+		At     time.Time
+		Window time.Duration
+		Opens  string
+		Tags   []string
+	}
+	delta, en, fr := int64(-3), "en", "fr"
+	rows := []event{
+		{ID: 1, Delta: &delta, Score: 1.5, Active: true, Lang: &en, Blob: []byte{1, 2}, Day: at, At: at, Window: time.Minute, Opens: "08:15:00", Tags: []string{"a", "b"}},
+		{ID: 2, Score: 2.5, Lang: &fr, Blob: []byte{}, Day: at.AddDate(0, 0, 1), At: at.Add(time.Second), Window: time.Hour, Opens: "09:00:00", Tags: []string{}},
+		{ID: 3, Score: 3.5, Active: true, Lang: &en, Blob: []byte{3}, Day: at, At: at, Window: 0, Opens: "10:00:00", Tags: []string{"c"}},
+	}
+	payload, err := scrt.Marshal(sch, rows)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	rec, err := scrtarrow.ToArrow(sch, payload)
+	if err != nil {
+		t.Fatalf("ToArrow: %v", err)
+	}
+	defer rec.Release()
+	if rec.NumRows() != 3 || rec.NumCols() != int64(len(sch.Fields)) {
+		t.Fatalf("record shape %dx%d", rec.NumRows(), rec.NumCols())
+	}
+
+	ids := rec.Column(0).(*array.Uint64)
+	if ids.Value(0) != 1 || ids.Value(2) != 3 {
+		t.Fatalf("ID column %v", ids)
+	}
+	deltas := rec.Column(1).(*array.Int64)
+	if deltas.Value(0) != -3 || !deltas.IsNull(1) || !deltas.IsNull(2) {
+		t.Fatalf("Delta column %v", deltas)
+	}
+	if scores := rec.Column(2).(*array.Float64); scores.Value(1) != 2.5 {
+		t.Fatalf("Score column %v", scores)
+	}
+	if active := rec.Column(3).(*array.Boolean); !active.Value(0) || active.Value(1) {
+		t.Fatalf("Active column %v", active)
+	}
+
+	langs := rec.Column(4).(*array.Dictionary)
+	dict := langs.Dictionary().(*array.String)
+	if dict.Len() != 2 {
+		t.Fatalf("Lang dictionary has %d entries, want 2", dict.Len())
+	}
+	for i, want := range []string{"en", "fr", "en"} {
+		if got := dict.Value(langs.GetValueIndex(i)); got != want {
+			t.Fatalf("Lang[%d] = %q, want %q", i, got, want)
+		}
+	}
+
+	if blobs := rec.Column(5).(*array.Binary); string(blobs.Value(0)) != "\x01\x02" || blobs.IsNull(1) || len(blobs.Value(1)) != 0 {
+		t.Fatalf("Blob column %v", blobs)
+	}
+	days := rec.Column(6).(*array.Date32)
+	if days.Value(0) != arrow.Date32FromTime(at) || days.Value(1) != arrow.Date32FromTime(at.AddDate(0, 0, 1)) {
+		t.Fatalf("Day column %v", days)
+	}
+	stamps := rec.Column(7).(*array.Timestamp)
+	if stamps.Value(1).ToTime(arrow.Nanosecond) != at.Add(time.Second) {
+		t.Fatalf("At column %v", stamps)
+	}
+	if windows := rec.Column(8).(*array.Duration); windows.Value(1) != arrow.Duration(time.Hour) {
+		t.Fatalf("Window column %v", windows)
+	}
+	if opens := rec.Column(9).(*array.Time64); opens.Value(0) != arrow.Time64(8*time.Hour+15*time.Minute) {
+		t.Fatalf("Opens column %v", opens)
+	}
+	tags := rec.Column(10).(*array.List)
+	values := tags.ListValues().(*array.String)
+	start, end := tags.ValueOffsets(0)
+	if end-start != 2 || values.Value(int(start)) != "a" {
+		t.Fatalf("Tags column %v", tags)
+	}
+	if start, end := tags.ValueOffsets(1); tags.IsNull(1) || start != end {
+		t.Fatalf("Tags[1] should be an empty list")
+	}
+}
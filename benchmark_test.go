@@ -6,10 +6,12 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"runtime"
 	"strconv"
 	"testing"
 
 	"github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/codec"
 	"github.com/oarkflow/scrt/schema"
 )
 
@@ -421,6 +423,35 @@ func BenchmarkSCRT_Unmarshal_Struct_10000(b *testing.B) {
 	}
 }
 
+// benchmarkUnmarshalPresized decodes 10000 rows spread over ten pages, so
+// without a total row count the result slice grows once per page.
+func benchmarkUnmarshalPresized(b *testing.B, marshalOpts []scrt.MarshalOption, opts ...scrt.UnmarshalOption) {
+	data, err := scrt.Marshal(benchSchema, generateMessages(10000), append([]scrt.MarshalOption{scrt.WithRowsPerPage(1000)}, marshalOpts...)...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result []BenchMessage
+		if err := scrt.UnmarshalWithOptions(data, benchSchema, &result, opts...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSCRT_Unmarshal_MultiPage_10000(b *testing.B) {
+	benchmarkUnmarshalPresized(b, nil)
+}
+
+func BenchmarkSCRT_Unmarshal_MultiPage_10000_ExpectedRows(b *testing.B) {
+	benchmarkUnmarshalPresized(b, nil, scrt.WithExpectedRows(10000))
+}
+
+func BenchmarkSCRT_Unmarshal_MultiPage_10000_Footer(b *testing.B) {
+	benchmarkUnmarshalPresized(b, []scrt.MarshalOption{scrt.WithFooter()})
+}
+
 func BenchmarkCSV_Unmarshal_10000(b *testing.B) {
 	messages := generateMessages(10000)
 	data := generateCSV(messages)
@@ -610,6 +641,25 @@ func BenchmarkSCRT_Marshal_Map_1000(b *testing.B) {
 	}
 }
 
+func BenchmarkSCRT_MarshalColumns_1000(b *testing.B) {
+	messages := generateMessageMaps(1000)
+	columns := make(map[string][]any, len(benchSchema.Fields))
+	for _, field := range benchSchema.Fields {
+		values := make([]any, len(messages))
+		for i, msg := range messages {
+			values[i] = msg[field.Name]
+		}
+		columns[field.Name] = values
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := scrt.MarshalColumns(benchSchema, columns); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkSCRT_Marshal_TypedMap_1000(b *testing.B) {
 	records := generateCounterMaps(1000)
 	b.ResetTimer()
@@ -1029,3 +1079,165 @@ func skipProtoField(wireType int, data []byte) (int, error) {
 		return 0, fmt.Errorf("bench proto: unsupported wire type %d", wireType)
 	}
 }
+
+func BenchmarkSCRT_Unmarshal_Projection_2of5_1000(b *testing.B) {
+	data, err := scrt.Marshal(benchSchema, generateMessages(1000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result []BenchMessage
+		if err := scrt.UnmarshalColumns(data, benchSchema, &result, "MsgID", "Seen"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSCRT_Unmarshal_Projection_5of5_1000(b *testing.B) {
+	data, err := scrt.Marshal(benchSchema, generateMessages(1000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result []BenchMessage
+		if err := scrt.Unmarshal(data, benchSchema, &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// categoricalPayload encodes 10k messages whose Text and Lang columns each
+// hold a handful of distinct values.
+func categoricalPayload(b *testing.B) []byte {
+	langs := []string{"en", "fr", "de", "es", "ja"}
+	messages := generateMessages(10000)
+	for i := range messages {
+		messages[i].Lang = langs[i%len(langs)]
+		messages[i].Text = fmt.Sprintf("status message %d", i%8)
+	}
+	data, err := scrt.Marshal(benchSchema, messages)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// benchmarkCategoricalUnmarshal decodes the categorical payload and reports
+// the heap one decoded result keeps alive, page buffers it borrows included.
+func benchmarkCategoricalUnmarshal(b *testing.B, opts ...scrt.UnmarshalOption) {
+	data := categoricalPayload(b)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	var kept []BenchMessage
+	if err := scrt.UnmarshalWithOptions(data, benchSchema, &kept, opts...); err != nil {
+		b.Fatal(err)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(kept)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result []BenchMessage
+		if err := scrt.UnmarshalWithOptions(data, benchSchema, &result, opts...); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc)), "retained-B")
+}
+
+func BenchmarkSCRT_Unmarshal_Categorical_10000(b *testing.B) {
+	benchmarkCategoricalUnmarshal(b)
+}
+
+func BenchmarkSCRT_Unmarshal_Categorical_10000_Interned(b *testing.B) {
+	benchmarkCategoricalUnmarshal(b, scrt.WithInternStrings())
+}
+
+func tinyPayloads(b *testing.B) [][]byte {
+	payloads := make([][]byte, 1000)
+	for i := range payloads {
+		data, err := scrt.Marshal(benchSchema, generateMessages(1+i%3))
+		if err != nil {
+			b.Fatal(err)
+		}
+		payloads[i] = data
+	}
+	return payloads
+}
+
+func BenchmarkSCRT_Decode_1000Tiny_NewReader(b *testing.B) {
+	payloads := tinyPayloads(b)
+	row := codec.NewRow(benchSchema)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, data := range payloads {
+			reader := codec.NewReader(bytes.NewReader(data), benchSchema)
+			for {
+				ok, err := reader.ReadRow(row)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !ok {
+					break
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkSCRT_Decode_1000Tiny_Reset(b *testing.B) {
+	payloads := tinyPayloads(b)
+	row := codec.NewRow(benchSchema)
+	src := bytes.NewReader(nil)
+	reader := codec.NewReader(src, benchSchema)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, data := range payloads {
+			src.Reset(data)
+			reader.Reset(src, benchSchema)
+			for {
+				ok, err := reader.ReadRow(row)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !ok {
+					break
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkSCRT_MarshalSlice_Struct_1000(b *testing.B) {
+	messages := generateMessages(1000)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := scrt.MarshalSlice(benchSchema, messages); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSCRT_UnmarshalSlice_Struct_1000(b *testing.B) {
+	messages := generateMessages(1000)
+	data, err := scrt.Marshal(benchSchema, messages)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := scrt.UnmarshalSlice[BenchMessage](data, benchSchema); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package scrt
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// canonicalNaN is the single NaN bit pattern CanonicalMarshal writes.
+var canonicalNaN = math.Float64frombits(0x7ff8000000000001)
+
+// CanonicalMarshal encodes input like Marshal, but so that logically equal
+// data always yields the same bytes, which makes a hash of the result a
+// stable content address. The rules are:
+//
+//   - pages hold codec.DefaultRowsPerPage rows; @pragma rows_per_page is
+//     ignored;
+//   - no optional encoding is used: no global string table (encoding=global
+//     is ignored), plain pages, offset timestamptz, page checksums, or
+//     footer;
+//   - each page's string dictionary is sorted bytewise;
+//   - a value equal to its field's literal default is written absent, as
+//     readers fill it back in;
+//   - every NaN is written with one bit pattern.
+//
+// Rows keep their input order, and list elements theirs. Values reach the
+// row as Marshal converts them, so a time.Time and its RFC3339 text agree.
+// Fields whose default is a function such as now() or uuid() are still
+// evaluated when unset, so callers that want a stable hash must set them.
+// The payload reads back with Unmarshal like any other.
+func CanonicalMarshal(s *schema.Schema, input any) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	defaults := make([]codec.Value, len(s.Fields))
+	hasDefault := make([]bool, len(s.Fields))
+	for i, field := range s.Fields {
+		defaults[i], hasDefault[i] = codec.StaticDefault(field)
+	}
+
+	var buf bytes.Buffer
+	writer := codec.NewWriterWithOptions(&buf, s, codec.DefaultRowsPerPage, codec.WriterOptions{SortedDictionaries: true, LocalDictionaries: true, DefaultFuncs: true})
+	row := codec.AcquireRow(s)
+	defer codec.ReleaseRow(row)
+	err := visitRecords(input, func(v reflect.Value) error {
+		v = indirect(v)
+		if !v.IsValid() {
+			return fmt.Errorf("scrt: nil record")
+		}
+		row.Reset()
+		if err := populateRow(*row, v, s, encodeConfig{}); err != nil {
+			return err
+		}
+		values := row.Values()
+		for i, field := range s.Fields {
+			val := &values[i]
+			if !val.Set {
+				continue
+			}
+			if hasDefault[i] && sameValue(field.ValueKind(), *val, defaults[i]) {
+				*val = codec.Value{}
+				continue
+			}
+			if field.ValueKind() == schema.KindFloat64 && math.IsNaN(val.Float) {
+				val.Float = canonicalNaN
+			}
+		}
+		return writer.WriteRow(*row)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sameValue reports whether a and b encode to the same bytes. Unlike
+// codec.CompareValues it tells -0 from 0 and compares timestamptz text, so
+// dropping a value equal to its default never changes what is read back.
+func sameValue(kind schema.FieldKind, a, b codec.Value) bool {
+	switch kind {
+	case schema.KindUint64, schema.KindRef:
+		return a.Uint == b.Uint
+	case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
+		return a.Int == b.Int
+	case schema.KindFloat64:
+		return math.Float64bits(a.Float) == math.Float64bits(b.Float)
+	case schema.KindBool:
+		return a.Bool == b.Bool
+	case schema.KindString, schema.KindTimestampTZ:
+		return a.Str == b.Str
+	case schema.KindBytes, schema.KindUUID:
+		return bytes.Equal(a.Bytes, b.Bytes)
+	}
+	return false
+}
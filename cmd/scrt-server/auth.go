@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/subtle"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requireToken guards h with the -auth-token bearer token. Mutating methods
+// always need it; GET and HEAD need it only when reads is set, and the health
+// probes never do. An empty token disables the check.
+func requireToken(token string, reads bool, h http.Handler) http.Handler {
+	if token == "" {
+		return h
+	}
+	want := []byte(token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !needsToken(r, reads) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		presented, ok := bearerToken(r.Header.Get("Authorization"))
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scrt"`)
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// needsToken reports whether r must carry the bearer token.
+func needsToken(r *http.Request, reads bool) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	case http.MethodGet, http.MethodHead:
+		return reads && r.URL.Path != "/healthz" && r.URL.Path != "/readyz"
+	}
+	return false
+}
+
+// bearerToken extracts the credentials of an "Authorization: Bearer" header.
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// rateLimiter is a token bucket per client IP: each bucket holds up to burst
+// requests and refills at rate per second.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateSweepInterval is how often idle buckets are dropped.
+const rateSweepInterval = time.Minute
+
+// newRateLimiter returns a limiter for the -rate and -rate-burst flags. A
+// burst below one becomes rate rounded up, and at least one.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = max(1, int(math.Ceil(rate)))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of client. When the bucket is empty
+// it reports how long until the next token.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= rateSweepInterval {
+		l.sweep(now)
+	}
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	l.refill(bucket, now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens = min(l.burst, bucket.tokens+elapsed*l.rate)
+	}
+	bucket.last = now
+}
+
+// sweep forgets the buckets that have refilled completely, which a new
+// bucket would match.
+func (l *rateLimiter) sweep(now time.Time) {
+	for client, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// limit answers 429 with Retry-After, in whole seconds, to clients that have
+// used up their bucket. Clients are told apart by the connection's remote
+// IP; forwarding headers are ignored because any client can set them. A nil
+// limiter returns h.
+func (l *rateLimiter) limit(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.allow(clientIP(r))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the host part of r.RemoteAddr.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequireToken(t *testing.T) {
+	t.Parallel()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	cases := []struct {
+		name   string
+		reads  bool
+		method string
+		path   string
+		auth   string
+		want   int
+	}{
+		{name: "post without token", method: http.MethodPost, path: "/records/User", want: http.StatusUnauthorized},
+		{name: "delete with wrong token", method: http.MethodDelete, path: "/records/User", auth: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "put with other scheme", method: http.MethodPut, path: "/schemas/User", auth: "Basic s3cret", want: http.StatusUnauthorized},
+		{name: "patch with token", method: http.MethodPatch, path: "/records/User", auth: "Bearer s3cret", want: http.StatusOK},
+		{name: "lower-case scheme", method: http.MethodPost, path: "/schemas", auth: "bearer s3cret", want: http.StatusOK},
+		{name: "open get", method: http.MethodGet, path: "/records/User", want: http.StatusOK},
+		{name: "guarded get", reads: true, method: http.MethodGet, path: "/records/User", want: http.StatusUnauthorized},
+		{name: "guarded get with token", reads: true, method: http.MethodGet, path: "/records/User", auth: "Bearer s3cret", want: http.StatusOK},
+		{name: "health probe", reads: true, method: http.MethodGet, path: "/healthz", want: http.StatusOK},
+	}
+	for _, tc := range cases {
+		handler := requireToken("s3cret", tc.reads, next)
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.want, resp.Code)
+		}
+		if tc.want == http.StatusUnauthorized && resp.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("%s: 401 without WWW-Authenticate", tc.name)
+		}
+	}
+
+	// A CORS preflight carries no credentials and still succeeds.
+	handler := allowCORS(parseOrigins("https://app.example"), requireToken("s3cret", true, next))
+	req := httptest.NewRequest(http.MethodOptions, "/records/User", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("preflight: expected 204, got %d", resp.Code)
+	}
+	// The rejection of the real request stays readable cross-origin.
+	req = httptest.NewRequest(http.MethodDelete, "/records/User", nil)
+	req.Header.Set("Origin", "https://app.example")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized || resp.Header().Get("Access-Control-Allow-Origin") != "https://app.example" {
+		t.Fatalf("cross-origin delete: code %d, Allow-Origin %q", resp.Code, resp.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(1_700_000_000, 0)
+	limiter := newRateLimiter(0.5, 3)
+	limiter.now = func() time.Time { return now }
+	handler := limiter.limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	get := func(remote string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/schemas", nil)
+		req.RemoteAddr = remote
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	for i := 0; i < 3; i++ {
+		if resp := get("203.0.113.7:4000"); resp.Code != http.StatusOK {
+			t.Fatalf("burst request %d: expected 200, got %d", i, resp.Code)
+		}
+	}
+	// The port differs but the client is the same.
+	resp := get("203.0.113.7:4001")
+	if resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after the burst, got %d", resp.Code)
+	}
+	if got := resp.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("Retry-After = %q, want 2", got)
+	}
+	if resp := get("198.51.100.9:4000"); resp.Code != http.StatusOK {
+		t.Fatalf("other client: expected 200, got %d", resp.Code)
+	}
+
+	// Half a token per second: one more request after two seconds.
+	now = now.Add(2 * time.Second)
+	if resp := get("203.0.113.7:4000"); resp.Code != http.StatusOK {
+		t.Fatalf("after refill: expected 200, got %d", resp.Code)
+	}
+	if resp := get("203.0.113.7:4000"); resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("after refill: expected 429, got %d", resp.Code)
+	}
+
+	// Idle clients are forgotten once their bucket is full again.
+	now = now.Add(rateSweepInterval)
+	get("192.0.2.1:4000")
+	if n := len(limiter.buckets); n != 1 {
+		t.Fatalf("expected the idle buckets to be swept, %d remain", n)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	scrt "github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/storage"
+)
+
+func TestBundleV2RoundTrip(t *testing.T) {
+	t.Parallel()
+	const dsl = "@schema User\n@field ID uint64\n\n@schema Post\n@field ID uint64\n@field Title string\n"
+	doc, err := schema.Parse(strings.NewReader(dsl))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	user, _ := doc.Schema("User")
+	post, _ := doc.Schema("Post")
+	userPayload, err := scrt.Marshal(user, []map[string]any{{"ID": uint64(1)}})
+	if err != nil {
+		t.Fatalf("marshal users: %v", err)
+	}
+	postPayload, err := scrt.Marshal(post, []map[string]any{{"ID": uint64(9), "Title": "hello"}})
+	if err != nil {
+		t.Fatalf("marshal posts: %v", err)
+	}
+	updated := time.Unix(1700000000, 0).UTC()
+	resp := httptest.NewRecorder()
+	err = writeBundleV2(resp, doc, []byte(dsl), "Blog", updated, []bundleEntry{
+		{schemaName: "Post", fingerprint: post.Fingerprint(), payload: postPayload},
+		{schemaName: "User", fingerprint: user.Fingerprint(), payload: userPayload},
+	})
+	if err != nil {
+		t.Fatalf("write bundle: %v", err)
+	}
+	// Readers must tolerate data appended by later bundle revisions.
+	data := append(resp.Body.Bytes(), 0xde, 0xad, 0xbe, 0xef)
+
+	got, err := decodeBundle(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.version != bundleVersionMulti || got.docName != "Blog" || string(got.dsl) != dsl || !got.updated.Equal(updated) {
+		t.Fatalf("unexpected header %+v", got)
+	}
+	if got.docFingerprint != fingerprintDocument(doc) {
+		t.Fatalf("document fingerprint mismatch")
+	}
+	if len(got.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got.entries))
+	}
+	if e := got.entries[0]; e.schemaName != "Post" || e.fingerprint != post.Fingerprint() || !bytes.Equal(e.payload, postPayload) {
+		t.Fatalf("unexpected Post entry %+v", e)
+	}
+	if e := got.entries[1]; e.schemaName != "User" || e.fingerprint != user.Fingerprint() || !bytes.Equal(e.payload, userPayload) {
+		t.Fatalf("unexpected User entry %+v", e)
+	}
+	var posts []map[string]any
+	if err := scrt.Unmarshal(got.entries[0].payload, post, &posts); err != nil || posts[0]["Title"] != "hello" {
+		t.Fatalf("decoded payload unreadable: %v %+v", err, posts)
+	}
+
+	for _, cut := range []int{3, 20, len(resp.Body.Bytes()) - 1} {
+		if _, err := decodeBundle(resp.Body.Bytes()[:cut]); err == nil {
+			t.Fatalf("expected truncation error at %d bytes", cut)
+		}
+	}
+	future := append([]byte(nil), resp.Body.Bytes()...)
+	future[len(bundleMagic)] = 3
+	if _, err := decodeBundle(future); err == nil || !strings.Contains(err.Error(), "unsupported bundle version 3") {
+		t.Fatalf("expected version error, got %v", err)
+	}
+}
+
+func TestHandleBundleVersions(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	if _, err := reg.Upsert("Widget", []byte("@schema:Widget\n@field ID uint64\n"), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	doc, _, _, _ := reg.Snapshot("Widget")
+	sch, _ := doc.Schema("Widget")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(5)}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := backend.Persist("Widget", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+
+	for target, version := range map[string]byte{"/bundle?schema=Widget": bundleVersion, "/bundle?doc=Widget": bundleVersionMulti} {
+		resp := httptest.NewRecorder()
+		srv.handleBundle(resp, httptest.NewRequest(http.MethodGet, target, nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", target, resp.Code)
+		}
+		got, err := decodeBundle(resp.Body.Bytes())
+		if err != nil {
+			t.Fatalf("%s: decode: %v", target, err)
+		}
+		if got.version != version || len(got.entries) != 1 || got.entries[0].schemaName != "Widget" || !bytes.Equal(got.entries[0].payload, payload) {
+			t.Fatalf("%s: unexpected bundle %+v", target, got)
+		}
+	}
+}
+
+// decodedBundle is the parsed form of a version 1 or 2 bundle. Version 1
+// bundles report their single payload as one entry.
+type decodedBundle struct {
+	version        byte
+	docFingerprint uint64
+	updated        time.Time
+	docName        string
+	dsl            []byte
+	entries        []bundleEntry
+}
+
+// decodeBundle parses a bundle as a client would, checking every length
+// against the input so a truncated or oversized envelope fails instead of
+// reading past the end. Bytes after the last entry are ignored to leave room
+// for later additions.
+func decodeBundle(data []byte) (*decodedBundle, error) {
+	r := bundleReader{data: data}
+	if string(r.next(len(bundleMagic))) != bundleMagic {
+		return nil, fmt.Errorf("invalid bundle magic")
+	}
+	out := &decodedBundle{version: r.byte()}
+	if out.version != bundleVersion && out.version != bundleVersionMulti {
+		return nil, fmt.Errorf("unsupported bundle version %d", out.version)
+	}
+	out.docFingerprint = r.uint64()
+	var v1 bundleEntry
+	if out.version == bundleVersion {
+		v1.fingerprint = r.uint64()
+	}
+	out.updated = time.Unix(0, int64(r.uint64())).UTC()
+	out.docName = r.compactString()
+	if out.version == bundleVersion {
+		v1.schemaName = r.compactString()
+		out.dsl = r.blob()
+		v1.payload = r.blob()
+		out.entries = []bundleEntry{v1}
+	} else {
+		out.dsl = r.blob()
+		count := int(r.uint16())
+		for i := 0; i < count && r.err == nil; i++ {
+			var entry bundleEntry
+			entry.schemaName = r.compactString()
+			entry.fingerprint = r.uint64()
+			entry.payload = r.blob()
+			out.entries = append(out.entries, entry)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return out, nil
+}
+
+// bundleReader reads little-endian bundle fields, latching the first
+// truncation error.
+type bundleReader struct {
+	data []byte
+	err  error
+}
+
+func (r *bundleReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = fmt.Errorf("bundle truncated")
+		return nil
+	}
+	out := r.data[:n:n]
+	r.data = r.data[n:]
+	return out
+}
+
+func (r *bundleReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *bundleReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *bundleReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *bundleReader) compactString() string {
+	return string(r.next(int(r.uint16())))
+}
+
+func (r *bundleReader) blob() []byte {
+	var size [4]byte
+	copy(size[:], r.next(4))
+	length := binary.LittleEndian.Uint32(size[:])
+	if uint64(length) > uint64(len(r.data)) {
+		if r.err == nil {
+			r.err = fmt.Errorf("bundle blob of %d bytes exceeds remaining %d", length, len(r.data))
+		}
+		return nil
+	}
+	return r.next(int(length))
+}
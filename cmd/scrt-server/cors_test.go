@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowCORSOrigins(t *testing.T) {
+	t.Parallel()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	cases := []struct {
+		name       string
+		origins    string
+		origin     string
+		preflight  bool
+		wantCode   int
+		wantOrigin string
+		wantVary   bool
+	}{
+		{name: "unset same-origin only", origins: "", origin: "https://app.example", wantCode: http.StatusOK},
+		{name: "unset preflight falls through", origins: "", origin: "https://app.example", preflight: true, wantCode: http.StatusOK},
+		{name: "wildcard", origins: "*", origin: "https://any.example", wantCode: http.StatusOK, wantOrigin: "*"},
+		{name: "wildcard preflight", origins: "*", origin: "https://any.example", preflight: true, wantCode: http.StatusNoContent, wantOrigin: "*"},
+		{name: "allowlisted", origins: "https://app.example, https://admin.example/", origin: "https://admin.example", wantCode: http.StatusOK, wantOrigin: "https://admin.example", wantVary: true},
+		{name: "allowlisted preflight", origins: "https://app.example", origin: "https://app.example", preflight: true, wantCode: http.StatusNoContent, wantOrigin: "https://app.example", wantVary: true},
+		{name: "denied", origins: "https://app.example", origin: "https://evil.example", wantCode: http.StatusOK, wantVary: true},
+		{name: "denied preflight", origins: "https://app.example", origin: "https://evil.example", preflight: true, wantCode: http.StatusForbidden, wantVary: true},
+		{name: "no origin header", origins: "https://app.example", wantCode: http.StatusOK, wantVary: true},
+	}
+	for _, tc := range cases {
+		handler := allowCORS(parseOrigins(tc.origins), next)
+		method := http.MethodGet
+		if tc.preflight {
+			method = http.MethodOptions
+		}
+		req := httptest.NewRequest(method, "/schemas", nil)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if tc.preflight {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != tc.wantCode {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.wantCode, resp.Code)
+		}
+		if got := resp.Header().Get("Access-Control-Allow-Origin"); got != tc.wantOrigin {
+			t.Fatalf("%s: expected Allow-Origin %q, got %q", tc.name, tc.wantOrigin, got)
+		}
+		if got := resp.Header().Get("Vary") == "Origin"; got != tc.wantVary {
+			t.Fatalf("%s: expected Vary: Origin %v, got %q", tc.name, tc.wantVary, resp.Header().Get("Vary"))
+		}
+		if tc.wantOrigin == "" && resp.Header().Get("Access-Control-Allow-Methods") != "" {
+			t.Fatalf("%s: CORS headers leaked to a disallowed origin", tc.name)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	scrt "github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/storage"
+)
+
+func TestSchemaAndBundleETags(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	if _, err := reg.Upsert("Widget", []byte("@schema:Widget\n@field ID uint64\n"), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+
+	get := func(handler http.HandlerFunc, target, ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp := httptest.NewRecorder()
+		handler(resp, req)
+		return resp
+	}
+
+	first := get(srv.handleSchema, "/schemas/Widget", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with ETag, got %d %q", first.Code, etag)
+	}
+	if resp := get(srv.handleSchema, "/schemas/Widget", etag); resp.Code != http.StatusNotModified || resp.Body.Len() != 0 {
+		t.Fatalf("matching If-None-Match: expected empty 304, got %d", resp.Code)
+	}
+	if resp := get(srv.handleSchema, "/schemas/Widget", `"0000000000000000"`); resp.Code != http.StatusOK {
+		t.Fatalf("stale If-None-Match: expected 200, got %d", resp.Code)
+	}
+
+	bundle := get(srv.handleBundle, "/bundle?schema=Widget", "")
+	bundleTag := bundle.Header().Get("ETag")
+	if bundle.Code != http.StatusOK || bundleTag == "" {
+		t.Fatalf("bundle: expected 200 with ETag, got %d %q", bundle.Code, bundleTag)
+	}
+	if resp := get(srv.handleBundle, "/bundle?schema=Widget", bundleTag); resp.Code != http.StatusNotModified {
+		t.Fatalf("bundle: expected 304, got %d", resp.Code)
+	}
+
+	doc, _, _, _ := reg.Snapshot("Widget")
+	sch, _ := doc.Schema("Widget")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1)}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := backend.Persist("Widget", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	changed := get(srv.handleBundle, "/bundle?schema=Widget", bundleTag)
+	if changed.Code != http.StatusOK || changed.Header().Get("ETag") == bundleTag {
+		t.Fatalf("bundle ETag should change with the payload, got %d %q", changed.Code, changed.Header().Get("ETag"))
+	}
+
+	if _, err := reg.Upsert("Widget", []byte("@schema:Widget\n@field ID uint64\n@field Name string\n"), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert v2: %v", err)
+	}
+	if resp := get(srv.handleSchema, "/schemas/Widget", etag); resp.Code != http.StatusOK {
+		t.Fatalf("schema ETag should change with the schema, got %d", resp.Code)
+	}
+	if resp := get(srv.handleBundle, "/bundle?schema=Widget", changed.Header().Get("ETag")); resp.Code != http.StatusOK {
+		t.Fatalf("bundle ETag should change with the schema, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	scrt "github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// formMemoryBytes is how much of a multipart form ParseMultipartForm keeps
+// in memory; larger file parts spill to temporary files.
+const formMemoryBytes = 8 << 20
+
+// handleRecordForm appends one row built from an HTML form or webhook post
+// to POST /records/{schema}/form. Form keys name schema fields and their text
+// values are coerced as scrt.Marshal coerces strings in map input. A file
+// part fills a bytes field. Empty values leave non-string fields unset, and
+// repeated keys fill list fields. Keys naming computed fields are read-only
+// and ignored; other keys that name no field are refused unless the server
+// runs with -form-ignore-unknown. The row must satisfy the
+// schema's required and enum= constraints; it then gets its auto-increment
+// and generated values and is appended like a binary upload.
+func (s *server) handleRecordForm(w http.ResponseWriter, r *http.Request, schemaName string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	doc, _, _, err := s.registry.Snapshot(schemaName)
+	if err != nil {
+		statusFromError(w, err)
+		return
+	}
+	sch, ok := doc.Schema(schemaName)
+	if !ok {
+		http.Error(w, "unknown schema", http.StatusNotFound)
+		return
+	}
+	values, files, err := s.parseRecordForm(w, r)
+	if err != nil {
+		var unsupported errUnsupportedForm
+		if errors.As(err, &unsupported) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		writeBodyError(w, err)
+		return
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+	record, err := formRecord(sch, values, files, s.formIgnoreUnknown)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	row, err := scrt.Marshal(sch, []map[string]any{record})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("marshal row failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	row, err = s.populateAutoValues(schemaName, sch, row)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("auto-populate failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	report, err := scrt.ValidatePayload(row, sch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(report.Violations) > 0 {
+		problems := make([]string, len(report.Violations))
+		for i, v := range report.Violations {
+			problems[i] = fmt.Sprintf("field %s: %s", v.Field, v.Message)
+		}
+		http.Error(w, strings.Join(problems, "; "), http.StatusBadRequest)
+		return
+	}
+	existing, err := s.store.LoadPayload(schemaName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	payload, err := appendPayload(existing, row, sch)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("append failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	if rejectDuplicates(w, sch, payload) {
+		return
+	}
+	if err := s.persist(schemaName, sch, payload); err != nil {
+		http.Error(w, fmt.Sprintf("persist failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := s.registry.SetPayload(schemaName, payload); err != nil {
+		statusFromError(w, err)
+		return
+	}
+	stored, err := parseSingleRowPayload(row, sch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"schema": schemaName,
+		"row":    redactRow(stored, sch, s.redactionFor(r)),
+	})
+}
+
+// errUnsupportedForm reports a request body that is not a form.
+type errUnsupportedForm struct{ mediaType string }
+
+func (e errUnsupportedForm) Error() string {
+	return fmt.Sprintf("unsupported content type %q; want application/x-www-form-urlencoded or multipart/form-data", e.mediaType)
+}
+
+// parseRecordForm reads the form fields of the request body under the body
+// limit. Query parameters are not form fields.
+func (s *server) parseRecordForm(w http.ResponseWriter, r *http.Request) (url.Values, map[string][]*multipart.FileHeader, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, errUnsupportedForm{mediaType: r.Header.Get("Content-Type")}
+	}
+	if s.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, nil, err
+		}
+		return r.PostForm, nil, nil
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(formMemoryBytes); err != nil {
+			return nil, nil, err
+		}
+		return r.MultipartForm.Value, r.MultipartForm.File, nil
+	default:
+		return nil, nil, errUnsupportedForm{mediaType: mediaType}
+	}
+}
+
+// formRecord maps form values and files onto the fields of sch, ready for
+// scrt.Marshal.
+func formRecord(sch *schema.Schema, values url.Values, files map[string][]*multipart.FileHeader, ignoreUnknown bool) (map[string]any, error) {
+	var unknown []string
+	field := func(key string) (schema.Field, bool) {
+		idx, ok := sch.FieldIndex(key)
+		if !ok {
+			if _, computed := sch.ComputedByName(key); !computed && !ignoreUnknown {
+				unknown = append(unknown, key)
+			}
+			return schema.Field{}, false
+		}
+		return sch.Fields[idx], true
+	}
+	record := make(map[string]any, len(values)+len(files))
+	for key, vals := range values {
+		f, ok := field(key)
+		if !ok || len(vals) == 0 {
+			continue
+		}
+		kind := f.ValueKind()
+		switch {
+		case kind == schema.KindList:
+			record[f.Name] = vals
+		case len(vals) > 1:
+			return nil, fmt.Errorf("form field %s has %d values; only list fields take several", key, len(vals))
+		case vals[0] == "" && kind != schema.KindString:
+			// An empty input means no value.
+		default:
+			record[f.Name] = vals[0]
+		}
+	}
+	for key, headers := range files {
+		f, ok := field(key)
+		if !ok || len(headers) == 0 {
+			continue
+		}
+		if f.ValueKind() != schema.KindBytes {
+			return nil, fmt.Errorf("form file %s maps to %s field %s; only bytes fields take files", key, f.RawType, f.Name)
+		}
+		if len(headers) > 1 || values[key] != nil {
+			return nil, fmt.Errorf("form field %s has several values", key)
+		}
+		data, err := readFormFile(headers[0])
+		if err != nil {
+			return nil, fmt.Errorf("form file %s: %w", key, err)
+		}
+		record[f.Name] = data
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("schema %s has no field %s", sch.Name, strings.Join(unknown, ", "))
+	}
+	return record, nil
+}
+
+func readFormFile(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
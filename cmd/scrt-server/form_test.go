@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	scrt "github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/storage"
+)
+
+func TestHandleRecordForm(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64 auto_increment
+@field Name string required
+@field Email string unique
+@field Age int64
+@field Joined date
+@field Tags list<string>
+@field Avatar bytes
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+	doc, _, _, err := reg.Snapshot("User")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	postForm := func(srv *server, form url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/records/User/form", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		srv.handleRecords(resp, req)
+		return resp
+	}
+
+	resp := postForm(srv, url.Values{
+		"Name":   {"Ada"},
+		"Email":  {"ada@example.com"},
+		"Age":    {"36"},
+		"Joined": {"2024-05-01"},
+		"Tags":   {"admin", "ops"},
+	})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var created struct {
+		Row map[string]any `json:"row"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if created.Row["ID"] != float64(1) || created.Row["Name"] != "Ada" || created.Row["Joined"] != "2024-05-01" {
+		t.Fatalf("unexpected created row %v", created.Row)
+	}
+
+	// A multipart post with a file part for the bytes field; the empty Age
+	// stays unset.
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("Name", "Lin")
+	_ = mw.WriteField("Age", "")
+	part, err := mw.CreateFormFile("Avatar", "lin.png")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	_, _ = part.Write([]byte{0x89, 'P', 'N', 'G'})
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/records/User/form", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, req)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("multipart: expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	payload, err := backend.LoadPayload("User")
+	if err != nil {
+		t.Fatalf("load payload: %v", err)
+	}
+	var rows []struct {
+		ID     uint64
+		Name   string
+		Email  string
+		Age    *int64
+		Joined string
+		Tags   []string
+		Avatar []byte
+	}
+	if err := scrt.Unmarshal(payload, sch, &rows); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].ID != 1 || *rows[0].Age != 36 || !reflect.DeepEqual(rows[0].Tags, []string{"admin", "ops"}) {
+		t.Fatalf("unexpected first row %+v", rows[0])
+	}
+	if rows[1].ID != 2 || rows[1].Name != "Lin" || rows[1].Age != nil || !bytes.Equal(rows[1].Avatar, []byte{0x89, 'P', 'N', 'G'}) {
+		t.Fatalf("unexpected second row %+v", rows[1])
+	}
+
+	for _, tc := range []struct {
+		name string
+		form url.Values
+		want string
+	}{
+		{name: "missing required", form: url.Values{"Email": {"x@example.com"}}, want: "field Name: missing required value"},
+		{name: "unknown key", form: url.Values{"Name": {"Bo"}, "Nickname": {"b"}}, want: "schema User has no field Nickname"},
+		{name: "bad number", form: url.Values{"Name": {"Bo"}, "Age": {"old"}}, want: `cannot parse "old" as int64`},
+		{name: "repeated scalar", form: url.Values{"Name": {"Bo", "Bob"}}, want: "only list fields take several"},
+		{name: "duplicate unique", form: url.Values{"Name": {"Ada"}, "Email": {"ada@example.com"}}, want: `"Email":[{"key":"ada@example.com"`},
+	} {
+		resp := postForm(srv, tc.form)
+		if resp.Code != http.StatusBadRequest && resp.Code != http.StatusConflict {
+			t.Fatalf("%s: expected a client error, got %d", tc.name, resp.Code)
+		}
+		if !strings.Contains(resp.Body.String(), tc.want) {
+			t.Fatalf("%s: expected %q in %q", tc.name, tc.want, resp.Body.String())
+		}
+	}
+
+	lenient := &server{registry: reg, store: backend, formIgnoreUnknown: true}
+	if resp := postForm(lenient, url.Values{"Name": {"Bo"}, "Nickname": {"b"}}); resp.Code != http.StatusCreated {
+		t.Fatalf("ignored unknown key: expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/records/User/form", strings.NewReader(`{"Name":"Bo"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, req)
+	if resp.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("json body: expected 415, got %d", resp.Code)
+	}
+}
+
+func TestFormRecordIgnoresComputedFields(t *testing.T) {
+	t.Parallel()
+	doc, err := schema.Parse(strings.NewReader("@schema Staff\n@field Name string\n@field Salary float64 sensitive\n@computed Greeting expr=\"Hi \" + Name\n@computed Monthly expr=Salary / 12\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("Staff")
+	record, err := formRecord(sch, url.Values{"Name": {"Ada"}, "Salary": {"1200"}, "Greeting": {"Hello"}, "Monthly": {"1"}}, nil, false)
+	if err != nil {
+		t.Fatalf("form record: %v", err)
+	}
+	if !reflect.DeepEqual(record, map[string]any{"Name": "Ada", "Salary": "1200"}) {
+		t.Fatalf("computed keys should be dropped, got %v", record)
+	}
+
+	row := map[string]any{"Name": "Ada", "Salary": 1200.0, "Greeting": "Hi Ada", "Monthly": 100.0}
+	redactRow(row, sch, redactMask)
+	if row["Salary"] != sensitiveMask || row["Monthly"] != sensitiveMask || row["Greeting"] != "Hi Ada" {
+		t.Fatalf("computed fields over sensitive ones should be masked, got %v", row)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/scrt/storage"
+)
+
+// brokenBackend fails metadata listing, as a storage root that has gone away would.
+type brokenBackend struct {
+	storage.Backend
+}
+
+func (brokenBackend) ListMeta() ([]*storage.SnapshotMeta, error) {
+	return nil, errors.New("disk unavailable")
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	t.Parallel()
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	cases := []struct {
+		name   string
+		srv    *server
+		code   int
+		reason string
+	}{
+		{name: "ready", srv: &server{store: backend, schemaDir: t.TempDir()}, code: http.StatusOK},
+		{name: "broken backend", srv: &server{store: brokenBackend{}, schemaDir: t.TempDir()}, code: http.StatusServiceUnavailable, reason: "disk unavailable"},
+		{name: "missing schema dir", srv: &server{store: backend, schemaDir: filepath.Join(t.TempDir(), "gone")}, code: http.StatusServiceUnavailable, reason: "schema directory"},
+		{name: "no backend", srv: &server{}, code: http.StatusServiceUnavailable, reason: "not configured"},
+	}
+	for _, tc := range cases {
+		resp := httptest.NewRecorder()
+		tc.srv.handleHealthz(resp, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: healthz expected 200, got %d", tc.name, resp.Code)
+		}
+
+		resp = httptest.NewRecorder()
+		tc.srv.handleReadyz(resp, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if resp.Code != tc.code {
+			t.Fatalf("%s: readyz expected %d, got %d", tc.name, tc.code, resp.Code)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: decode: %v", tc.name, err)
+		}
+		if !strings.Contains(body["reason"], tc.reason) || (tc.reason == "") != (body["status"] == "ok") {
+			t.Fatalf("%s: unexpected body %v", tc.name, body)
+		}
+	}
+}
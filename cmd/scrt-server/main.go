@@ -8,6 +8,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
 	"math"
@@ -16,6 +17,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -27,28 +29,68 @@ import (
 	"github.com/oarkflow/scrt/schema"
 	"github.com/oarkflow/scrt/storage"
 	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
 )
 
 const (
 	bundleMagic   = "SCB1"
 	bundleVersion = 1
+	// bundleVersionMulti carries every schema payload of a document as a
+	// count-prefixed list; readers ignore anything after the last entry.
+	bundleVersionMulti = 2
 )
 
 type server struct {
 	registry  *schema.DocumentRegistry
 	store     storage.Backend
 	schemaDir string
+	metrics   *metrics
+	// maxBodyBytes caps request bodies read by readBody; 0 means no limit.
+	maxBodyBytes int64
+	// sensitiveMode applies to JSON responses unless the request carries
+	// revealToken in revealHeader.
+	sensitiveMode redactMode
+	revealToken   string
+	// softDelete makes row deletes tombstone rows instead of rewriting the
+	// payload; reads hide tombstoned rows and vacuum purges them.
+	softDelete bool
+	// formIgnoreUnknown makes form posts skip keys that name no field
+	// instead of refusing them.
+	formIgnoreUnknown bool
 }
 
-func allowCORS(h http.Handler) http.Handler {
+// allowCORS adds CORS headers for the configured origins. An empty list
+// leaves responses same-origin only; "*" allows any origin. Otherwise the
+// request Origin is echoed back only when allowlisted, and preflights from
+// other origins are refused.
+func allowCORS(origins []string, h http.Handler) http.Handler {
+	if len(origins) == 0 {
+		return h
+	}
+	anyOrigin := slices.Contains(origins, "*")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		// Allow common headers used by browsers and our client
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Authorization")
-		// Expose specific headers to client-side JS if needed
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Type")
-		if r.Method == http.MethodOptions {
+		origin := r.Header.Get("Origin")
+		if !anyOrigin {
+			w.Header().Add("Vary", "Origin")
+		}
+		allowed := origin != "" && (anyOrigin || slices.Contains(origins, origin))
+		if allowed {
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			// Allow common headers used by browsers and our client
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Authorization, If-None-Match, X-SCRT-Schema-Fingerprint")
+			// Expose specific headers to client-side JS if needed
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Type, ETag, Retry-After, X-SCRT-Schema-Fingerprint")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -56,25 +98,84 @@ func allowCORS(h http.Handler) http.Handler {
 	})
 }
 
+// parseOrigins splits the -cors-origins flag into trimmed, non-empty entries.
+func parseOrigins(flagValue string) []string {
+	var origins []string
+	for _, origin := range strings.Split(flagValue, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
 func main() {
 	addr := flag.String("addr", ":8080", "listen address")
 	storageDir := flag.String("storage", "./data", "directory for SCRT snapshots")
 	schemaDir := flag.String("schemas", "./schemas", "directory for SCRT schema DSL files")
+	corsOrigins := flag.String("cors-origins", "", "comma-separated origins allowed for CORS, or * for any (default same-origin only)")
+	schemaHistory := flag.Int("schema-history", schema.DefaultHistoryDepth, "superseded versions kept per schema for rollback")
+	enableMetrics := flag.Bool("metrics", false, "serve Prometheus metrics on /metrics")
+	maxBodyBytes := flag.Int64("max-body-bytes", 64<<20, "largest accepted request body in bytes, or 0 for no limit")
+	readTimeout := flag.Duration("read-timeout", time.Minute, "maximum time to read a request, body included")
+	writeTimeout := flag.Duration("write-timeout", 2*time.Minute, "maximum time to write a response")
+	sensitive := flag.String("sensitive", "mask", "how JSON responses show sensitive fields: mask, omit, or off")
+	revealToken := flag.String("reveal-token", "", "secret that reveals sensitive fields when sent in the "+revealHeader+" header")
+	softDelete := flag.Bool("soft-delete", false, "tombstone deleted rows until vacuum instead of removing them")
+	formIgnoreUnknown := flag.Bool("form-ignore-unknown", false, "ignore form keys that name no schema field instead of refusing the post")
+	watch := flag.Bool("watch", false, "reload schema files edited in the schema directory")
+	watchInterval := flag.Duration("watch-interval", time.Second, "how often -watch polls the schema directory")
+	authToken := flag.String("auth-token", "", "bearer token required on POST, PUT, PATCH, and DELETE requests (default no auth)")
+	authReads := flag.Bool("auth-reads", false, "also require -auth-token on GET and HEAD requests, except health probes")
+	rate := flag.Float64("rate", 0, "requests per second allowed per client IP, or 0 for no limit")
+	rateBurst := flag.Int("rate-burst", 0, "requests a client IP may make at once under -rate (default -rate rounded up)")
 	flag.Parse()
 
+	sensitiveMode, err := parseRedactMode(*sensitive)
+	if err != nil {
+		log.Fatalf("-sensitive: %v", err)
+	}
+	if *rate < 0 {
+		log.Fatalf("-rate must not be negative")
+	}
+	if *authReads && *authToken == "" {
+		log.Fatalf("-auth-reads needs -auth-token")
+	}
+
 	if err := os.MkdirAll(*schemaDir, 0o755); err != nil {
 		log.Fatalf("schema dir: %v", err)
 	}
 	registry := schema.NewDocumentRegistry()
+	registry.SetHistoryDepth(*schemaHistory)
 	backend, err := storage.NewSnapshotBackend(*storageDir)
 	if err != nil {
 		log.Fatalf("storage backend: %v", err)
 	}
 
-	srv := &server{registry: registry, store: backend, schemaDir: *schemaDir}
+	srv := &server{
+		registry:          registry,
+		store:             backend,
+		schemaDir:         *schemaDir,
+		maxBodyBytes:      *maxBodyBytes,
+		sensitiveMode:     sensitiveMode,
+		revealToken:       *revealToken,
+		softDelete:        *softDelete,
+		formIgnoreUnknown: *formIgnoreUnknown,
+	}
+	if *enableMetrics {
+		srv.metrics = newMetrics()
+	}
 	if err := srv.bootstrapSchemas(); err != nil {
 		log.Fatalf("bootstrap schemas: %v", err)
 	}
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	if *watch {
+		if *watchInterval <= 0 {
+			log.Fatalf("-watch-interval must be positive")
+		}
+		go newSchemaWatcher(srv, *watchInterval).run(watchCtx)
+		log.Printf("Watching %s for schema changes", *schemaDir)
+	}
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/schemas", srv.handleSchemas)
@@ -83,18 +184,39 @@ func main() {
 	mux.HandleFunc("/snapshots", srv.handleSnapshots)
 	mux.HandleFunc("/ids/", srv.handleIDs)
 	mux.HandleFunc("/bundle", srv.handleBundle)
+	mux.HandleFunc("/openapi.json", srv.handleOpenAPI)
+	mux.HandleFunc("/healthz", srv.handleHealthz)
+	mux.HandleFunc("/readyz", srv.handleReadyz)
+	if srv.metrics != nil {
+		mux.Handle("/metrics", srv.metrics)
+	}
 
-	listener := allowCORS(noCache(mux))
+	var limiter *rateLimiter
+	if *rate > 0 {
+		limiter = newRateLimiter(*rate, *rateBurst)
+	}
+	// Preflights are answered by allowCORS before the limiter and the token
+	// check, and their CORS headers reach 401 and 429 responses too.
+	guarded := limiter.limit(requireToken(*authToken, *authReads, noCache(srv.metrics.instrument(mux))))
+	origins := parseOrigins(*corsOrigins)
+	listener := allowCORS(origins, guarded)
 	httpServer := &http.Server{
-		Addr:    *addr,
-		Handler: listener,
+		Addr:              *addr,
+		Handler:           listener,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
 	}
 
 	// Channel to listen for interrupt signals
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
-	log.Printf("SCRT server listening on %s (CORS enabled)", *addr)
+	corsPolicy := "same-origin only"
+	if len(origins) > 0 {
+		corsPolicy = strings.Join(origins, ", ")
+	}
+	log.Printf("SCRT server listening on %s (CORS: %s)", *addr, corsPolicy)
 
 	// Start server in a goroutine
 	go func() {
@@ -107,6 +229,7 @@ func main() {
 	<-stop
 
 	log.Println("Shutting down server...")
+	stopWatch()
 
 	// Create context with timeout for graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -120,6 +243,11 @@ func main() {
 	log.Println("Server stopped")
 }
 
+// handleSchemas lists the schema documents on GET and installs the DSL in the
+// body on POST. An upload migrates the stored records of the schemas it
+// replaces; ?rename=Old:New carries a renamed field over, and an edit that
+// would lose stored data is refused with 409 unless ?drop=true asks for those
+// records to be deleted.
 func (s *server) handleSchemas(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -127,21 +255,31 @@ func (s *server) handleSchemas(w http.ResponseWriter, r *http.Request) {
 		sort.Slice(summaries, func(i, j int) bool {
 			return summaries[i].Name < summaries[j].Name
 		})
+		w.Header().Add("Vary", "Accept")
+		if acceptsJSON(r.Header.Get("Accept")) {
+			writeJSON(w, summaries)
+			return
+		}
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		for _, summary := range summaries {
 			fmt.Fprintln(w, summary.Name)
 		}
 	case http.MethodPost:
-		raw, err := io.ReadAll(r.Body)
+		raw, err := s.readBody(w, r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
-		schemaName, err := s.upsertSchemaBody("", raw)
+		opts, err := schemaUpsertFromRequest(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		schemaName, err := s.upsertSchemaBody("", raw, opts)
+		if err != nil {
+			http.Error(w, err.Error(), schemaUpsertStatus(err))
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Location", fmt.Sprintf("/schemas/%s", url.PathEscape(schemaName)))
 		w.WriteHeader(http.StatusCreated)
@@ -151,14 +289,37 @@ func (s *server) handleSchemas(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleSchema serves one schema document and its sub-resources. POST
+// replaces the document and takes the rename and drop parameters of
+// handleSchemas; stored records are deleted only with ?drop=true.
 func (s *server) handleSchema(w http.ResponseWriter, r *http.Request) {
 	name := strings.TrimPrefix(r.URL.Path, "/schemas/")
 	if name == "" {
 		http.Error(w, "document name required", http.StatusBadRequest)
 		return
 	}
+	if base, ok := strings.CutSuffix(name, "/versions"); ok {
+		s.handleSchemaVersions(w, r, base)
+		return
+	}
+	if base, ok := strings.CutSuffix(name, "/rollback"); ok {
+		s.handleSchemaRollback(w, r, base)
+		return
+	}
+	if base, ok := strings.CutSuffix(name, "/jsonschema"); ok {
+		s.handleSchemaJSONSchema(w, r, base)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
+		doc, _, _, err := s.registry.Snapshot(name)
+		if err != nil {
+			statusFromError(w, err)
+			return
+		}
+		if notModified(w, r, fmt.Sprintf("%016x", fingerprintDocument(doc))) {
+			return
+		}
 		buf := &bytes.Buffer{}
 		if err := s.registry.CopyDSL(name, buf); err != nil {
 			statusFromError(w, err)
@@ -167,16 +328,21 @@ func (s *server) handleSchema(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		_, _ = w.Write(buf.Bytes())
 	case http.MethodPost:
-		raw, err := io.ReadAll(r.Body)
+		raw, err := s.readBody(w, r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
-		schemaName, err := s.upsertSchemaBody(name, raw)
+		opts, err := schemaUpsertFromRequest(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		schemaName, err := s.upsertSchemaBody(name, raw, opts)
+		if err != nil {
+			http.Error(w, err.Error(), schemaUpsertStatus(err))
+			return
+		}
 		w.Header().Set("Location", fmt.Sprintf("/schemas/%s", url.PathEscape(schemaName)))
 		w.WriteHeader(http.StatusCreated)
 	case http.MethodDelete:
@@ -190,6 +356,140 @@ func (s *server) handleSchema(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleSchemaJSONSchema serves the JSON Schema of one record of the named
+// schema, for validating JSON input before it is posted.
+func (s *server) handleSchemaJSONSchema(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	doc, _, _, err := s.registry.Snapshot(name)
+	if err != nil {
+		statusFromError(w, err)
+		return
+	}
+	sch, ok := doc.Schema(name)
+	if !ok {
+		http.Error(w, "unknown schema", http.StatusNotFound)
+		return
+	}
+	if notModified(w, r, fmt.Sprintf("%016x", sch.Fingerprint())) {
+		return
+	}
+	out, err := sch.JSONSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	_, _ = w.Write(out)
+}
+
+func (s *server) handleSchemaVersions(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	versions := s.registry.History(name)
+	if versions == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(versions)
+}
+
+// handleSchemaRollback restores the version named by the fingerprint query
+// parameter and rewrites the schema file to match. Like an upload, it
+// migrates the stored records to the restored version and accepts the drop
+// and rename parameters; only drop=true deletes records it cannot carry over.
+func (s *server) handleSchemaRollback(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	fingerprint := r.URL.Query().Get("fingerprint")
+	if fingerprint == "" {
+		http.Error(w, "fingerprint query parameter required", http.StatusBadRequest)
+		return
+	}
+	opts, err := schemaUpsertFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var target *schema.DocumentVersion
+	for _, version := range s.registry.History(name) {
+		if version.Fingerprint == fingerprint {
+			target = &version
+			break
+		}
+	}
+	if target == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	raw := []byte(target.DSL)
+	_, err = s.switchSchema(name, raw, opts, func() (*schema.Document, error) {
+		if err := s.registry.Rollback(name, fingerprint); err != nil {
+			return nil, err
+		}
+		doc, _, _, err := s.registry.Snapshot(name)
+		return doc, err
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		statusFromError(w, err)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), schemaUpsertStatus(err))
+		return
+	}
+	if err := s.saveSchemaFile(name, raw); err != nil {
+		http.Error(w, fmt.Sprintf("persist schema: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleHealthz reports liveness; it succeeds whenever the process serves HTTP.
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports readiness: the storage backend must list snapshot
+// metadata and the schema directory must be readable. It reads metadata
+// files only, never payloads.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if reason := s.notReadyReason(); reason != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "unavailable", "reason": reason})
+		return
+	}
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+func (s *server) notReadyReason() string {
+	if s.store == nil {
+		return "storage backend not configured"
+	}
+	if _, err := s.store.ListMeta(); err != nil {
+		return fmt.Sprintf("storage backend: %v", err)
+	}
+	if s.schemaDir != "" {
+		dir, err := os.Open(s.schemaDir)
+		if err != nil {
+			return fmt.Sprintf("schema directory: %v", err)
+		}
+		defer dir.Close()
+		if _, err := dir.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Sprintf("schema directory: %v", err)
+		}
+	}
+	return ""
+}
+
 func (s *server) handleSnapshots(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
@@ -204,7 +504,9 @@ func (s *server) handleSnapshots(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) handleIDs(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	switch r.Method {
+	case http.MethodGet, http.MethodPost, http.MethodDelete:
+	default:
 		methodNotAllowed(w)
 		return
 	}
@@ -213,6 +515,19 @@ func (s *server) handleIDs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "ids path must be /ids/{schema}/{field} or /ids/uuid", http.StatusBadRequest)
 		return
 	}
+	if r.Method == http.MethodDelete {
+		schemaName := strings.Trim(path, "/")
+		if strings.Contains(schemaName, "/") {
+			http.Error(w, "counter reset path must be /ids/{schema}", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.ResetAutoCounters(schemaName); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	if strings.EqualFold(path, "uuid") || strings.EqualFold(path, "uuidv7") {
 		id, err := storage.GenerateUUIDv7()
 		if err != nil {
@@ -238,6 +553,28 @@ func (s *server) handleIDs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unknown schema", http.StatusNotFound)
 		return
 	}
+	if r.Method == http.MethodPost {
+		raw := r.URL.Query().Get("set")
+		value, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid ?set= counter value %q", raw), http.StatusBadRequest)
+			return
+		}
+		if err := s.store.SetAutoCounter(schemaName, sch, fieldName, value); err != nil {
+			if errors.Is(err, storage.ErrNotAutoIncrement) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{
+			"schema": schemaName,
+			"field":  fieldName,
+			"next":   value,
+		})
+		return
+	}
 	next, err := s.store.NextAutoValue(schemaName, sch, fieldName)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -283,6 +620,22 @@ func (s *server) handleRecords(w http.ResponseWriter, r *http.Request) {
 		s.handleRecordRow(w, r, schemaName, fieldName, key)
 		return
 	}
+	if len(parts) == 2 && strings.EqualFold(parts[1], "form") {
+		s.handleRecordForm(w, r, schemaName)
+		return
+	}
+	if len(parts) == 2 && strings.EqualFold(parts[1], "validate") {
+		s.handleValidateRecords(w, r, schemaName)
+		return
+	}
+	if len(parts) == 2 && strings.EqualFold(parts[1], "reindex") {
+		s.handleReindexRecords(w, r, schemaName)
+		return
+	}
+	if len(parts) == 2 && strings.EqualFold(parts[1], "vacuum") {
+		s.handleVacuumRecords(w, r, schemaName)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
 		payload, err := s.store.LoadPayload(schemaName)
@@ -294,12 +647,44 @@ func (s *server) handleRecords(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		hidden, ok := s.hiddenRows(w, r, schemaName)
+		if !ok {
+			return
+		}
+		w.Header().Add("Vary", "Accept")
+		if acceptsJSON(r.Header.Get("Accept")) {
+			doc, _, _, err := s.registry.Snapshot(schemaName)
+			if err != nil {
+				statusFromError(w, err)
+				return
+			}
+			sch, ok := doc.Schema(schemaName)
+			if !ok {
+				http.Error(w, "unknown schema", http.StatusNotFound)
+				return
+			}
+			if err := streamRowsJSON(w, payload, sch, s.redactionFor(r), hidden); err != nil {
+				log.Printf("stream %s records as JSON: %v", schemaName, err)
+			}
+			return
+		}
+		if doc, _, _, err := s.registry.Snapshot(schemaName); err == nil {
+			if sch, ok := doc.Schema(schemaName); ok {
+				w.Header().Set(fingerprintHeader, fmt.Sprintf("%016x", sch.Fingerprint()))
+				if len(hidden) > 0 {
+					if payload, err = withoutRows(payload, sch, hidden); err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
+				}
+			}
+		}
 		w.Header().Set("Content-Type", "application/x-scrt")
 		_, _ = w.Write(payload)
 	case http.MethodPost, http.MethodPut:
-		body, err := io.ReadAll(r.Body)
+		body, err := s.readBody(w, r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
 		if len(body) == 0 {
@@ -316,15 +701,42 @@ func (s *server) handleRecords(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "unknown schema", http.StatusNotFound)
 			return
 		}
+		if !checkFingerprintHeader(w, r, sch) {
+			return
+		}
 		if err := validatePayload(body, sch); err != nil {
-			http.Error(w, fmt.Sprintf("invalid SCRT payload: %v", err), http.StatusBadRequest)
+			s.metrics.decodeError()
+			http.Error(w, fmt.Sprintf("invalid SCRT payload: %v", err), payloadErrorStatus(err))
 			return
 		}
 		replace := r.Method == http.MethodPut
-		if mode := strings.ToLower(r.URL.Query().Get("mode")); mode == "replace" {
+		upsert := false
+		mode := strings.ToLower(r.URL.Query().Get("mode"))
+		switch mode {
+		case "replace":
 			replace = true
-		} else if mode == "append" {
+		case "append":
 			replace = false
+		case "upsert":
+			replace, upsert = false, true
+		}
+		keyIdx := -1
+		if upsert {
+			keyName := r.URL.Query().Get("key")
+			if keyName == "" {
+				http.Error(w, "upsert mode requires ?key={field}", http.StatusBadRequest)
+				return
+			}
+			idx, ok := sch.FieldIndex(keyName)
+			if !ok {
+				http.Error(w, fmt.Sprintf("schema %s lacks field %s", schemaName, keyName), http.StatusBadRequest)
+				return
+			}
+			if !schema.IndexableKind(sch.Fields[idx].ValueKind()) {
+				http.Error(w, fmt.Sprintf("field %s (%s) cannot be used as an upsert key", keyName, sch.Fields[idx].RawType), http.StatusBadRequest)
+				return
+			}
+			keyIdx = idx
 		}
 		payloadWithIDs, err := s.populateAutoValues(schemaName, sch, body)
 		if err != nil {
@@ -332,23 +744,47 @@ func (s *server) handleRecords(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		payload := append([]byte(nil), payloadWithIDs...)
+		var replaced []uint64
 		if !replace {
 			existing, err := s.store.LoadPayload(schemaName)
 			if err != nil && !errors.Is(err, os.ErrNotExist) {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			merged, mergeErr := appendPayload(existing, body, sch)
-			if mergeErr != nil {
-				http.Error(w, fmt.Sprintf("append failed: %v", mergeErr), http.StatusBadRequest)
-				return
+			if upsert {
+				merged, rewritten, mergeErr := upsertPayload(existing, payloadWithIDs, sch, keyIdx)
+				if mergeErr != nil {
+					http.Error(w, fmt.Sprintf("upsert failed: %v", mergeErr), http.StatusBadRequest)
+					return
+				}
+				payload, replaced = merged, rewritten
+			} else {
+				merged, mergeErr := appendPayload(existing, body, sch)
+				if mergeErr != nil {
+					http.Error(w, fmt.Sprintf("append failed: %v", mergeErr), http.StatusBadRequest)
+					return
+				}
+				payload = merged
 			}
-			payload = merged
 		}
-		if _, err := s.store.Persist(schemaName, sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		if rejectDuplicates(w, sch, payload) {
+			return
+		}
+		if err := s.persist(schemaName, sch, payload); err != nil {
 			http.Error(w, fmt.Sprintf("persist failed: %v", err), http.StatusInternalServerError)
 			return
 		}
+		if replace {
+			// The old rows, tombstoned or not, are gone.
+			if err := s.store.SetTombstones(schemaName, nil); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else if err := s.store.RemoveTombstones(schemaName, replaced); err != nil {
+			// An upsert that rewrote a soft-deleted row brings it back.
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		if err := s.registry.SetPayload(schemaName, payload); err != nil {
 			statusFromError(w, err)
 			return
@@ -373,7 +809,11 @@ func (s *server) handleBundle(w http.ResponseWriter, r *http.Request) {
 	}
 	schemaName := r.URL.Query().Get("schema")
 	if schemaName == "" {
-		http.Error(w, "schema query param required", http.StatusBadRequest)
+		if docName := r.URL.Query().Get("doc"); docName != "" {
+			s.handleDocumentBundle(w, r, docName)
+			return
+		}
+		http.Error(w, "schema or doc query param required", http.StatusBadRequest)
 		return
 	}
 	doc, raw, updated, err := s.registry.Snapshot(schemaName)
@@ -386,9 +826,13 @@ func (s *server) handleBundle(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unknown schema", http.StatusNotFound)
 		return
 	}
-	payload, err := s.store.LoadPayload(schemaName)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	payload, ok := s.bundlePayload(w, r, schemaName, sch)
+	if !ok {
+		return
+	}
+	payloadHash := fnv.New64a()
+	_, _ = payloadHash.Write(payload)
+	if notModified(w, r, fmt.Sprintf("%016x-%016x", fingerprintDocument(doc), payloadHash.Sum64())) {
 		return
 	}
 	if err := writeBundle(w, doc, sch, raw, payload, schemaName, schemaName, updated); err != nil {
@@ -396,6 +840,63 @@ func (s *server) handleBundle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleDocumentBundle writes a version 2 bundle holding the payload of every
+// schema in the document.
+func (s *server) handleDocumentBundle(w http.ResponseWriter, r *http.Request, docName string) {
+	doc, raw, updated, err := s.registry.Snapshot(docName)
+	if err != nil {
+		statusFromError(w, err)
+		return
+	}
+	names := make([]string, 0, len(doc.Schemas))
+	for name := range doc.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]bundleEntry, 0, len(names))
+	payloadHash := fnv.New64a()
+	for _, name := range names {
+		payload, ok := s.bundlePayload(w, r, name, doc.Schemas[name])
+		if !ok {
+			return
+		}
+		entries = append(entries, bundleEntry{schemaName: name, fingerprint: doc.Schemas[name].Fingerprint(), payload: payload})
+		_, _ = payloadHash.Write([]byte(name))
+		_, _ = payloadHash.Write(payload)
+	}
+	if notModified(w, r, fmt.Sprintf("%016x-%016x", fingerprintDocument(doc), payloadHash.Sum64())) {
+		return
+	}
+	if err := writeBundleV2(w, doc, raw, docName, updated, entries); err != nil {
+		log.Printf("write bundle: %v", err)
+	}
+}
+
+// bundlePayload loads the stored payload of schemaName for a bundle, nil
+// when none is stored, without the rows hiddenRows leaves out. ok is false
+// once an error response has been written.
+func (s *server) bundlePayload(w http.ResponseWriter, r *http.Request, schemaName string, sch *schema.Schema) (payload []byte, ok bool) {
+	payload, err := s.store.LoadPayload(schemaName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, true
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	hidden, ok := s.hiddenRows(w, r, schemaName)
+	if !ok {
+		return nil, false
+	}
+	if len(hidden) > 0 {
+		if payload, err = withoutRows(payload, sch, hidden); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+	return payload, true
+}
+
 func (s *server) handleRecordRow(w http.ResponseWriter, r *http.Request, schemaName, fieldName, rawKey string) {
 	if fieldName == "" {
 		http.Error(w, "field name required", http.StatusBadRequest)
@@ -434,26 +935,55 @@ func (s *server) handleRecordRow(w http.ResponseWriter, r *http.Request, schemaN
 		http.NotFound(w, r)
 		return
 	}
-	switch r.Method {
-	case http.MethodGet:
-		record, found, err := findRecordRow(payload, sch, fieldIdx, key)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if !found {
-			http.NotFound(w, r)
+	tombstones, err := s.store.Tombstones(schemaName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Tombstoned rows answer 404 unless a GET asks for ?includeDeleted=true.
+	var hidden map[uint64]struct{}
+	if r.Method == http.MethodGet {
+		var ok bool
+		if hidden, ok = s.hiddenRows(w, r, schemaName); !ok {
 			return
 		}
-		writeJSON(w, map[string]any{
+	} else {
+		hidden = rowSet(tombstones)
+	}
+	record, rowID, found, err := findRecordRow(payload, sch, fieldIdx, key)
+	if err != nil {
+		s.metrics.decodeError()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, deleted := hidden[rowID]; !found || deleted {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		resp := map[string]any{
 			"schema": schemaName,
 			"field":  fieldName,
 			"key":    rawKey,
-			"row":    record,
-		})
+			"row":    redactRow(record, sch, s.redactionFor(r)),
+		}
+		if slices.Contains(tombstones, rowID) {
+			resp["deleted"] = true
+		}
+		writeJSON(w, resp)
 	case http.MethodDelete:
+		if s.softDelete {
+			if err := s.store.AddTombstone(schemaName, rowID); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 		updated, found, err := rewriteRecord(payload, sch, fieldIdx, key, nil, rowEditDelete)
 		if err != nil {
+			s.metrics.decodeError()
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
@@ -461,19 +991,32 @@ func (s *server) handleRecordRow(w http.ResponseWriter, r *http.Request, schemaN
 			http.NotFound(w, r)
 			return
 		}
-		if _, err := s.store.Persist(schemaName, sch, updated, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		if err := s.persist(schemaName, sch, updated); err != nil {
 			http.Error(w, fmt.Sprintf("persist failed: %v", err), http.StatusInternalServerError)
 			return
 		}
+		if err := s.removeTombstone(schemaName, rowID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		if err := s.registry.SetPayload(schemaName, updated); err != nil {
 			statusFromError(w, err)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 	case http.MethodPatch, http.MethodPut:
-		body, err := io.ReadAll(r.Body)
+		// dryRun previews the edit: the rewrite, key checks, and duplicate
+		// checks all run, but nothing is persisted.
+		dryRun := false
+		if raw := r.URL.Query().Get("dryRun"); raw != "" {
+			if dryRun, err = strconv.ParseBool(raw); err != nil {
+				http.Error(w, fmt.Sprintf("invalid dryRun value %q", raw), http.StatusBadRequest)
+				return
+			}
+		}
+		body, err := s.readBody(w, r)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("read row payload: %v", err), http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
 		if len(body) == 0 {
@@ -482,7 +1025,8 @@ func (s *server) handleRecordRow(w http.ResponseWriter, r *http.Request, schemaN
 		}
 		rowMap, err := parseSingleRowPayload(body, sch)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("decode row: %v", err), http.StatusBadRequest)
+			s.metrics.decodeError()
+			http.Error(w, fmt.Sprintf("decode row: %v", err), payloadErrorStatus(err))
 			return
 		}
 		enforceKeyValue(rowMap, sch.Fields[fieldIdx], key)
@@ -493,6 +1037,7 @@ func (s *server) handleRecordRow(w http.ResponseWriter, r *http.Request, schemaN
 		}
 		updated, found, err := rewriteRecord(payload, sch, fieldIdx, key, replacement, rowEditReplace)
 		if err != nil {
+			s.metrics.decodeError()
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
@@ -500,7 +1045,26 @@ func (s *server) handleRecordRow(w http.ResponseWriter, r *http.Request, schemaN
 			http.NotFound(w, r)
 			return
 		}
-		if _, err := s.store.Persist(schemaName, sch, updated, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		if rejectDuplicates(w, sch, updated) {
+			return
+		}
+		if dryRun {
+			index, err := storage.BuildRowIndex(updated)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("count rows: %v", err), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, map[string]any{
+				"schema": schemaName,
+				"field":  fieldName,
+				"key":    rawKey,
+				"row":    redactRow(rowMap, sch, s.redactionFor(r)),
+				"rows":   index.RowCount(),
+				"dryRun": true,
+			})
+			return
+		}
+		if err := s.persist(schemaName, sch, updated); err != nil {
 			http.Error(w, fmt.Sprintf("persist failed: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -512,7 +1076,7 @@ func (s *server) handleRecordRow(w http.ResponseWriter, r *http.Request, schemaN
 			"schema": schemaName,
 			"field":  fieldName,
 			"key":    rawKey,
-			"row":    rowMap,
+			"row":    redactRow(rowMap, sch, s.redactionFor(r)),
 		})
 	default:
 		methodNotAllowed(w)
@@ -589,7 +1153,7 @@ func parseRecordKey(field *schema.Field, raw string) (recordKey, error) {
 		}
 		key.intVal = temporal.EncodeInstant(t)
 	case schema.KindTimestamp:
-		t, err := temporal.ParseTimestamp(trimmed)
+		t, err := temporal.ParseTimestampUnit(trimmed, field.EpochUnit)
 		if err != nil {
 			return key, fmt.Errorf("invalid timestamp key for %s: %w", field.Name, err)
 		}
@@ -600,6 +1164,18 @@ func parseRecordKey(field *schema.Field, raw string) (recordKey, error) {
 			return key, fmt.Errorf("invalid duration key for %s: %w", field.Name, err)
 		}
 		key.intVal = int64(dur)
+	case schema.KindTime:
+		tod, err := temporal.ParseTimeOfDay(trimmed)
+		if err != nil {
+			return key, fmt.Errorf("invalid time key for %s: %w", field.Name, err)
+		}
+		key.intVal = int64(tod)
+	case schema.KindUUID:
+		id, err := uuid.Parse(trimmed)
+		if err != nil {
+			return key, fmt.Errorf("invalid uuid key for %s: %w", field.Name, err)
+		}
+		key.strVal = id.String()
 	default:
 		return key, fmt.Errorf("field %s (kind %d) is not supported for record lookups", field.Name, field.ValueKind())
 	}
@@ -613,7 +1189,7 @@ func (k recordKey) matches(val codec.Value) bool {
 	switch k.kind {
 	case schema.KindUint64, schema.KindRef:
 		return val.Uint == k.uintVal
-	case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration:
+	case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
 		return val.Int == k.intVal
 	case schema.KindFloat64:
 		return val.Float == k.floatVal
@@ -621,6 +1197,8 @@ func (k recordKey) matches(val codec.Value) bool {
 		return val.Bool == k.boolVal
 	case schema.KindString, schema.KindTimestampTZ:
 		return val.Str == k.strVal
+	case schema.KindUUID:
+		return uuid.FormatBytes(val.Bytes) == k.strVal
 	default:
 		return false
 	}
@@ -660,7 +1238,7 @@ func enforceKeyValue(row map[string]any, field schema.Field, key recordKey) {
 		row[field.Name] = key.floatVal
 	case schema.KindBool:
 		row[field.Name] = key.boolVal
-	case schema.KindString, schema.KindTimestampTZ:
+	case schema.KindString, schema.KindTimestampTZ, schema.KindUUID:
 		row[field.Name] = key.strVal
 	case schema.KindDate:
 		row[field.Name] = temporal.FormatDate(temporal.DecodeDate(key.intVal))
@@ -668,31 +1246,35 @@ func enforceKeyValue(row map[string]any, field schema.Field, key recordKey) {
 		row[field.Name] = temporal.FormatInstant(temporal.DecodeInstant(key.intVal))
 	case schema.KindDuration:
 		row[field.Name] = time.Duration(key.intVal).String()
+	case schema.KindTime:
+		row[field.Name] = temporal.FormatTimeOfDay(time.Duration(key.intVal))
 	}
 }
 
-func findRecordRow(payload []byte, sch *schema.Schema, fieldIdx int, key recordKey) (map[string]any, bool, error) {
+// findRecordRow returns the first row whose field matches key, with its row
+// ID.
+func findRecordRow(payload []byte, sch *schema.Schema, fieldIdx int, key recordKey) (map[string]any, uint64, bool, error) {
 	reader := codec.NewReader(bytes.NewReader(payload), sch)
 	row := codec.NewRow(sch)
 	matchCount := 0
-	for {
+	for rowID := uint64(0); ; rowID++ {
 		ok, err := reader.ReadRow(row)
 		if errors.Is(err, io.EOF) || !ok {
 			break
 		}
 		if err != nil {
-			return nil, false, err
+			return nil, 0, false, err
 		}
 		values := row.Values()
 		if key.matches(values[fieldIdx]) {
 			matchCount++
 			if matchCount > 1 {
-				return nil, false, fmt.Errorf("multiple rows match %s=%q", key.fieldName, key.raw)
+				return nil, 0, false, fmt.Errorf("multiple rows match %s=%q", key.fieldName, key.raw)
 			}
-			return rowToMap(row, sch), true, nil
+			return rowToMap(row, sch), rowID, true, nil
 		}
 	}
-	return nil, false, nil
+	return nil, 0, false, nil
 }
 
 func rewriteRecord(payload []byte, sch *schema.Schema, fieldIdx int, key recordKey, replacement []byte, op rowEditOp) ([]byte, bool, error) {
@@ -701,7 +1283,7 @@ func rewriteRecord(payload []byte, sch *schema.Schema, fieldIdx int, key recordK
 	}
 	reader := codec.NewReader(bytes.NewReader(payload), sch)
 	buf := &bytes.Buffer{}
-	writer := codec.NewWriter(buf, sch, 1024)
+	writer := codec.NewWriter(buf, sch, 0)
 	row := codec.NewRow(sch)
 	matchCount := 0
 	for {
@@ -739,6 +1321,70 @@ func rewriteRecord(payload []byte, sch *schema.Schema, fieldIdx int, key recordK
 	return buf.Bytes(), true, nil
 }
 
+// acceptsJSON reports whether an Accept header asks for JSON over SCRT. JSON
+// wins only when listed explicitly with a quality at least that of
+// application/x-scrt; wildcards keep the SCRT default.
+func acceptsJSON(header string) bool {
+	jsonQ, scrtQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "application/x-scrt":
+			scrtQ = max(scrtQ, q)
+		}
+	}
+	return jsonQ > 0 && jsonQ >= scrtQ
+}
+
+// streamRowsJSON writes payload as a JSON array of rowToMap objects, decoding
+// one row at a time so large payloads are never held as a slice of maps.
+// Sensitive fields are treated according to mode, and rows in hidden are
+// left out.
+func streamRowsJSON(w http.ResponseWriter, payload []byte, sch *schema.Schema, mode redactMode, hidden map[uint64]struct{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	reader := codec.NewReader(bytes.NewReader(payload), sch)
+	row := codec.NewRow(sch)
+	enc := json.NewEncoder(w)
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	first := true
+	for rowID := uint64(0); ; rowID++ {
+		ok, err := reader.ReadRow(row)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if !ok || errors.Is(err, io.EOF) {
+			break
+		}
+		if _, skip := hidden[rowID]; skip {
+			continue
+		}
+		if first {
+			first = false
+		} else {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(redactRow(rowToMap(row, sch), sch, mode)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
 func rowToMap(row codec.Row, sch *schema.Schema) map[string]any {
 	values := row.Values()
 	out := make(map[string]any)
@@ -767,13 +1413,133 @@ func rowToMap(row codec.Row, sch *schema.Schema) map[string]any {
 			out[field.Name] = temporal.FormatInstant(temporal.DecodeInstant(val.Int))
 		case schema.KindDuration:
 			out[field.Name] = time.Duration(val.Int).String()
+		case schema.KindTime:
+			out[field.Name] = temporal.FormatTimeOfDay(time.Duration(val.Int))
+		case schema.KindUUID:
+			out[field.Name] = uuid.FormatBytes(val.Bytes)
+		case schema.KindList:
+			if val.Uints != nil {
+				out[field.Name] = val.Uints
+			} else {
+				out[field.Name] = append([]string(nil), val.Strs...)
+			}
 		default:
 			out[field.Name] = val.Str
 		}
 	}
+	for _, c := range sch.Computed {
+		if v, ok := scrt.EvalComputed(sch, c, row); ok {
+			out[c.Name] = v
+		}
+	}
 	return out
 }
 
+// handleValidateRecords checks an uploaded payload against the schema's
+// constraints and reports every violation without persisting anything.
+func (s *server) handleValidateRecords(w http.ResponseWriter, r *http.Request, schemaName string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := s.readBody(w, r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	doc, _, _, err := s.registry.Snapshot(schemaName)
+	if err != nil {
+		statusFromError(w, err)
+		return
+	}
+	sch, ok := doc.Schema(schemaName)
+	if !ok {
+		http.Error(w, "unknown schema", http.StatusNotFound)
+		return
+	}
+	report, err := scrt.ValidatePayload(body, sch)
+	if err != nil {
+		s.metrics.decodeError()
+		http.Error(w, fmt.Sprintf("invalid SCRT payload: %v", err), payloadErrorStatus(err))
+		return
+	}
+	writeJSON(w, report)
+}
+
+// handleReindexRecords rebuilds the stored indexes and counters of a schema
+// from its payload, leaving the payload itself untouched.
+func (s *server) handleReindexRecords(w http.ResponseWriter, r *http.Request, schemaName string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	doc, _, _, err := s.registry.Snapshot(schemaName)
+	if err != nil {
+		statusFromError(w, err)
+		return
+	}
+	sch, ok := doc.Schema(schemaName)
+	if !ok {
+		http.Error(w, "unknown schema", http.StatusNotFound)
+		return
+	}
+	if err := s.store.Reindex(schemaName, sch, storage.AutoIndexSpecs(sch)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	meta, err := s.store.LoadMeta(schemaName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, meta)
+}
+
+// handleVacuumRecords re-pages the stored payload of a schema, rebuilds its
+// indexes, and responds with the new snapshot metadata.
+func (s *server) handleVacuumRecords(w http.ResponseWriter, r *http.Request, schemaName string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	doc, _, _, err := s.registry.Snapshot(schemaName)
+	if err != nil {
+		statusFromError(w, err)
+		return
+	}
+	sch, ok := doc.Schema(schemaName)
+	if !ok {
+		http.Error(w, "unknown schema", http.StatusNotFound)
+		return
+	}
+	meta, err := s.store.Vacuum(schemaName, sch)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	payload, err := s.store.LoadPayload(schemaName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.registry.SetPayload(schemaName, payload); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, meta)
+}
+
 func validatePayload(data []byte, sch *schema.Schema) error {
 	reader := codec.NewReader(bytes.NewReader(data), sch)
 	row := codec.NewRow(sch)
@@ -796,7 +1562,7 @@ func appendPayload(existing, incoming []byte, sch *schema.Schema) ([]byte, error
 		return append([]byte(nil), incoming...), nil
 	}
 	buf := &bytes.Buffer{}
-	writer := codec.NewWriter(buf, sch, 1024)
+	writer := codec.NewWriter(buf, sch, 0)
 	row := codec.NewRow(sch)
 	var firstErr error
 	if err := copyPayload(writer, row, existing); err != nil {
@@ -817,6 +1583,106 @@ func appendPayload(existing, incoming []byte, sch *schema.Schema) ([]byte, error
 	return buf.Bytes(), nil
 }
 
+// upsertKey is a comparable projection of a key column value.
+type upsertKey struct {
+	uintVal uint64
+	strVal  string
+}
+
+// upsertKeyOf normalizes a key value the way the column index does, so
+// timestamptz keys naming the same instant in different zones match.
+func upsertKeyOf(val codec.Value, kind schema.FieldKind) upsertKey {
+	switch kind {
+	case schema.KindUint64, schema.KindRef:
+		return upsertKey{uintVal: val.Uint}
+	case schema.KindTimestampTZ:
+		if t, err := temporal.DecodeTimestampTZ(val.Str); err == nil {
+			return upsertKey{uintVal: uint64(temporal.EncodeInstant(t))}
+		}
+		return upsertKey{strVal: val.Str}
+	case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
+		return upsertKey{uintVal: uint64(val.Int)}
+	case schema.KindUUID:
+		return upsertKey{strVal: string(val.Bytes)}
+	default:
+		return upsertKey{strVal: val.Str}
+	}
+}
+
+// upsertPayload replaces rows in existing whose key column matches an
+// incoming row and appends the remaining incoming rows. Incoming rows are
+// buffered once so existing is scanned a single time. replaced lists the
+// row IDs of existing that were rewritten in place.
+func upsertPayload(existing, incoming []byte, sch *schema.Schema, keyIdx int) (payload []byte, replaced []uint64, err error) {
+	field := sch.Fields[keyIdx]
+	kind := field.ValueKind()
+	var pending []codec.Row
+	positions := make(map[upsertKey]int)
+	reader := codec.NewReader(bytes.NewReader(incoming), sch)
+	row := codec.NewRow(sch)
+	for {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			break
+		}
+		// The clone owns its strings, which the position keys then share.
+		owned := row.Clone()
+		keyVal := owned.Values()[keyIdx]
+		if !keyVal.Set {
+			return nil, nil, fmt.Errorf("row %d lacks key field %s", len(pending), field.Name)
+		}
+		key := upsertKeyOf(keyVal, kind)
+		if _, dup := positions[key]; dup {
+			return nil, nil, fmt.Errorf("row %d repeats key %s", len(pending), field.Name)
+		}
+		positions[key] = len(pending)
+		pending = append(pending, owned)
+	}
+
+	buf := &bytes.Buffer{}
+	writer := codec.NewWriter(buf, sch, 0)
+	written := make([]bool, len(pending))
+	reader = codec.NewReader(bytes.NewReader(existing), sch)
+	for rowID := uint64(0); ; rowID++ {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			break
+		}
+		out := row
+		if keyVal := row.Values()[keyIdx]; keyVal.Set {
+			if pos, hit := positions[upsertKeyOf(keyVal, kind)]; hit {
+				if written[pos] {
+					return nil, nil, fmt.Errorf("multiple stored rows share key field %s", field.Name)
+				}
+				written[pos] = true
+				out = pending[pos]
+				replaced = append(replaced, rowID)
+			}
+		}
+		if err := writer.WriteRow(out); err != nil {
+			return nil, nil, err
+		}
+	}
+	for pos, pendingRow := range pending {
+		if written[pos] {
+			continue
+		}
+		if err := writer.WriteRow(pendingRow); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), replaced, nil
+}
+
 func copyPayload(writer *codec.Writer, row codec.Row, payload []byte) error {
 	if len(payload) == 0 {
 		return nil
@@ -872,6 +1738,54 @@ func writeBundle(w http.ResponseWriter, doc *schema.Document, sch *schema.Schema
 	return err
 }
 
+// bundleEntry is one schema payload inside a version 2 bundle.
+type bundleEntry struct {
+	schemaName  string
+	fingerprint uint64
+	payload     []byte
+}
+
+// writeBundleV2 writes the version 2 envelope: the document header followed
+// by a u16 entry count and one (schema name, fingerprint, payload) triple per
+// entry.
+func writeBundleV2(w http.ResponseWriter, doc *schema.Document, raw []byte, docName string, updated time.Time, entries []bundleEntry) error {
+	if len(entries) > math.MaxUint16 {
+		return fmt.Errorf("bundle holds %d payloads, limit is %d", len(entries), math.MaxUint16)
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(bundleMagic)
+	buf.WriteByte(bundleVersionMulti)
+	if err := binary.Write(buf, binary.LittleEndian, fingerprintDocument(doc)); err != nil {
+		return err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, updated.UTC().UnixNano()); err != nil {
+		return err
+	}
+	if err := writeCompactString(buf, docName); err != nil {
+		return err
+	}
+	if err := writeBlob(buf, raw); err != nil {
+		return err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(entries))); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := writeCompactString(buf, entry.schemaName); err != nil {
+			return err
+		}
+		if err := binary.Write(buf, binary.LittleEndian, entry.fingerprint); err != nil {
+			return err
+		}
+		if err := writeBlob(buf, entry.payload); err != nil {
+			return err
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-scrt-bundle")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
 func writeCompactString(w io.Writer, value string) error {
 	if len(value) > math.MaxUint16 {
 		return fmt.Errorf("value too large")
@@ -932,6 +1846,24 @@ func fingerprintDocument(doc *schema.Document) uint64 {
 	return hash
 }
 
+// rejectDuplicates answers 409 with every conflicting unique key when payload
+// would fail to index, so nothing is persisted and the client sees all
+// offending rows at once. It reports whether a response was written.
+func rejectDuplicates(w http.ResponseWriter, sch *schema.Schema, payload []byte) bool {
+	report, err := storage.DryRunIndex(sch, payload, storage.AutoIndexSpecs(sch))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("index check failed: %v", err), http.StatusBadRequest)
+		return true
+	}
+	if report.Empty() {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(report)
+	return true
+}
+
 func writeJSON(w http.ResponseWriter, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
@@ -949,27 +1881,151 @@ func canonicalSchemaName(doc *schema.Document) string {
 	return ""
 }
 
-func (s *server) upsertSchemaBody(name string, raw []byte) (string, error) {
+// upsertSchemaBody installs the DSL in raw and saves it to the schema
+// directory.
+func (s *server) upsertSchemaBody(name string, raw []byte, opts schemaUpsert) (string, error) {
 	if len(bytes.TrimSpace(raw)) == 0 {
 		return "", fmt.Errorf("empty schema body")
 	}
 	if s.registry == nil {
 		return "", fmt.Errorf("schema registry unavailable")
 	}
-	doc, err := s.registry.Upsert(name, raw, "api", time.Now().UTC())
+	schemaName, err := s.installSchema(name, raw, "api", time.Now().UTC(), opts)
 	if err != nil {
 		return "", err
 	}
+	if err := s.saveSchemaFile(schemaName, raw); err != nil {
+		return "", fmt.Errorf("persist schema: %w", err)
+	}
+	return schemaName, nil
+}
+
+// installSchema upserts raw into the registry and carries the stored records
+// of the schema over to the new version; see migrateStoredRecords.
+func (s *server) installSchema(name string, raw []byte, source string, updatedAt time.Time, opts schemaUpsert) (string, error) {
+	return s.switchSchema(name, raw, opts, func() (*schema.Document, error) {
+		return s.registry.Upsert(name, raw, source, updatedAt)
+	})
+}
+
+// switchSchema makes raw, the DSL of a schema, current through install,
+// which either upserts it or restores it from the history. Uploads and
+// rollbacks alike migrate the stored records of every schema raw declares,
+// and refuse an edit they cannot carry over unless opts.drop is set.
+// Migrated records are persisted before install runs, so a store failure
+// leaves the registry alone; a failure after that puts the previous records
+// back and, once install has run, the previous registry version too.
+func (s *server) switchSchema(name string, raw []byte, opts schemaUpsert, install func() (*schema.Document, error)) (string, error) {
+	var migrations []*storedMigration
+	current := name
+	for _, next := range parseUpsertSchemas(raw) {
+		if name != "" && !strings.EqualFold(name, next.Name) {
+			continue
+		}
+		mig, err := s.migrateStoredRecords(next.Name, next, opts)
+		if err != nil {
+			return "", err
+		}
+		if mig != nil {
+			migrations = append(migrations, mig)
+		}
+		current = next.Name
+	}
+	prevSchema, prevPayload := s.currentPayload(current)
+	var prevVersion string
+	if history := s.registry.History(current); len(history) > 0 {
+		prevVersion = history[0].Fingerprint
+	}
+	for i, mig := range migrations {
+		if mig.migrated == nil {
+			continue
+		}
+		if err := s.persist(mig.name, mig.next, mig.migrated); err != nil {
+			err = fmt.Errorf("%w: persist migrated records of %s: %v", errStoredRecords, mig.name, err)
+			return "", errors.Join(err, s.restoreStoredRecords(migrations[:i]))
+		}
+	}
+	doc, err := install()
+	if err != nil {
+		return "", errors.Join(err, s.restoreStoredRecords(migrations))
+	}
 	schemaName := canonicalSchemaName(doc)
 	if schemaName == "" {
 		schemaName = name
 	}
-	if err := s.saveSchemaFile(schemaName, raw); err != nil {
-		return "", fmt.Errorf("persist schema: %w", err)
+	if err := s.applyStoredMigrations(schemaName, doc, migrations, prevSchema, prevPayload); err != nil {
+		return "", errors.Join(err, s.rollbackRegistry(current, prevVersion, prevPayload), s.restoreStoredRecords(migrations))
 	}
 	return schemaName, nil
 }
 
+// applyStoredMigrations brings the registry payload of schemaName in line
+// with the new version doc once its migrated records are persisted, and
+// deletes the records a switch with opts.drop could not carry over.
+func (s *server) applyStoredMigrations(schemaName string, doc *schema.Document, migrations []*storedMigration, prevSchema *schema.Schema, prevPayload []byte) error {
+	for _, mig := range migrations {
+		if mig.migrated != nil {
+			if err := s.registry.SetPayload(mig.name, mig.migrated); err != nil {
+				return err
+			}
+			continue
+		}
+		s.registry.ClearPayload(mig.name)
+		if err := s.store.Delete(mig.name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: delete stored records of %s: %v", errStoredRecords, mig.name, err)
+		}
+	}
+	if len(migrations) > 0 || prevPayload == nil {
+		return nil
+	}
+	// The registry drops a payload whose fingerprint changed; keep it when
+	// only defaults or metadata did.
+	sch := doc.Schemas[schemaName]
+	if _, kept := s.registry.Payload(schemaName); kept || sch == nil || !schema.SameLayout(prevSchema, sch) {
+		return nil
+	}
+	rebound, err := codec.Rebind(prevPayload, sch)
+	if err != nil {
+		return err
+	}
+	return s.registry.SetPayload(schemaName, rebound)
+}
+
+// rollbackRegistry makes version, the fingerprint current before a failed
+// schema switch, current again along with its payload. An empty version
+// means the schema did not exist and is removed.
+func (s *server) rollbackRegistry(name, version string, payload []byte) error {
+	if version == "" {
+		s.registry.DeleteSchema(name)
+		return nil
+	}
+	if err := s.registry.Rollback(name, version); err != nil {
+		return fmt.Errorf("restore schema %s: %w", name, err)
+	}
+	if payload == nil {
+		return nil
+	}
+	return s.registry.SetPayload(name, payload)
+}
+
+// currentPayload returns the schema and registry payload stored under name
+// before a schema switch, or nils when there are none.
+func (s *server) currentPayload(name string) (*schema.Schema, []byte) {
+	doc, _, _, err := s.registry.Snapshot(name)
+	if err != nil {
+		return nil, nil
+	}
+	sch, ok := doc.Schemas[canonicalSchemaName(doc)]
+	if !ok {
+		return nil, nil
+	}
+	payload, ok := s.registry.Payload(name)
+	if !ok {
+		return nil, nil
+	}
+	return sch, payload
+}
+
 func (s *server) saveSchemaFile(name string, raw []byte) error {
 	if s.schemaDir == "" {
 		return nil
@@ -986,7 +2042,14 @@ func (s *server) removeSchemaFile(name string) error {
 		return nil
 	}
 	path := filepath.Join(s.schemaDir, fmt.Sprintf("%s.scrt", name))
-	return os.Remove(path)
+	err := os.Remove(path)
+	// A bootstrapped .scrt.gz would bring the schema back on restart.
+	if gzErr := os.Remove(path + ".gz"); gzErr == nil {
+		err = nil
+	} else if !errors.Is(gzErr, os.ErrNotExist) {
+		err = gzErr
+	}
+	return err
 }
 
 func (s *server) bootstrapSchemas() error {
@@ -1007,12 +2070,20 @@ func (s *server) bootstrapSchemas() error {
 		if entry.IsDir() {
 			continue
 		}
-		if !strings.EqualFold(filepath.Ext(entry.Name()), ".scrt") {
+		name, ok := schemaFileName(entry.Name())
+		if !ok {
 			continue
 		}
-		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
 		path := filepath.Join(s.schemaDir, entry.Name())
-		data, err := os.ReadFile(path)
+		if strings.EqualFold(filepath.Ext(entry.Name()), ".gz") {
+			// Schema saves write plain .scrt files, so one beside a
+			// .scrt.gz is the newer copy.
+			if _, err := os.Stat(filepath.Join(s.schemaDir, name+".scrt")); err == nil {
+				log.Printf("schema bootstrap: skip %s in favour of %s.scrt", path, name)
+				continue
+			}
+		}
+		data, err := schema.ReadFile(path)
 		if err != nil {
 			log.Printf("schema bootstrap: read %s: %v", path, err)
 			continue
@@ -1031,26 +2102,72 @@ func (s *server) bootstrapSchemas() error {
 	return nil
 }
 
+// schemaFileName returns the schema name of a .scrt or .scrt.gz file name.
+func schemaFileName(file string) (string, bool) {
+	if strings.EqualFold(filepath.Ext(file), ".gz") {
+		file = file[:len(file)-len(".gz")]
+	}
+	if !strings.EqualFold(filepath.Ext(file), ".scrt") {
+		return "", false
+	}
+	return file[:len(file)-len(".scrt")], true
+}
+
+// readBody reads the whole request body, refusing bodies larger than
+// maxBodyBytes.
+func (s *server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if s.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	}
+	return io.ReadAll(r.Body)
+}
+
+// writeBodyError reports a readBody failure: 413 when the body was over the
+// limit, 400 otherwise.
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("request body exceeds the %d byte limit", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, fmt.Sprintf("read request body: %v", err), http.StatusBadRequest)
+}
+
+// persist stores payload with the automatic indexes and records the persist
+// duration and size.
+func (s *server) persist(schemaName string, sch *schema.Schema, payload []byte) error {
+	start := time.Now()
+	if _, err := s.store.Persist(schemaName, sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		return err
+	}
+	s.metrics.observePersist(time.Since(start), len(payload))
+	return nil
+}
+
 func (s *server) populateAutoValues(schemaName string, sch *schema.Schema, payload []byte) ([]byte, error) {
 	if len(payload) == 0 {
 		return payload, nil
 	}
 	autoFields := make([]int, 0)
 	uuidFields := make([]int, 0)
+	dynamic := false
 	for idx, field := range sch.Fields {
 		if field.AutoIncrement {
 			autoFields = append(autoFields, idx)
 		}
-		if requiresUUID(field) {
+		if field.Default.Dynamic() {
+			// The writer below evaluates now() and uuid() for unset values.
+			dynamic = true
+		} else if requiresUUID(field) {
 			uuidFields = append(uuidFields, idx)
 		}
 	}
-	if len(autoFields) == 0 && len(uuidFields) == 0 {
+	if len(autoFields) == 0 && len(uuidFields) == 0 && !dynamic {
 		return payload, nil
 	}
 	reader := codec.NewReader(bytes.NewReader(payload), sch)
 	var buf bytes.Buffer
-	writer := codec.NewWriter(&buf, sch, 1024)
+	writer := codec.NewWriterWithOptions(&buf, sch, 0, codec.WriterOptions{DefaultFuncs: true})
 	row := codec.NewRow(sch)
 	for {
 		ok, err := reader.ReadRow(row)
@@ -1070,6 +2187,7 @@ func (s *server) populateAutoValues(schemaName string, sch *schema.Schema, paylo
 			if err != nil {
 				return nil, err
 			}
+			s.metrics.autoValue()
 			current.Uint = next
 			current.Set = true
 			current.Str = ""
@@ -1077,14 +2195,28 @@ func (s *server) populateAutoValues(schemaName string, sch *schema.Schema, paylo
 		}
 		for _, idx := range uuidFields {
 			current := values[idx]
+			if sch.Fields[idx].ValueKind() == schema.KindUUID {
+				if current.Set && len(current.Bytes) == uuid.Size {
+					continue
+				}
+				id, err := uuid.NewV7()
+				if err != nil {
+					return nil, err
+				}
+				current.Bytes = id[:]
+				current.Borrowed = false
+				current.Set = true
+				row.SetByIndex(idx, current)
+				continue
+			}
 			if current.Set && current.Str != "" {
 				continue
 			}
-			uuid, err := storage.GenerateUUIDv7()
+			id, err := storage.GenerateUUIDv7()
 			if err != nil {
 				return nil, err
 			}
-			current.Str = uuid
+			current.Str = id
 			current.Set = true
 			row.SetByIndex(idx, current)
 		}
@@ -1099,6 +2231,9 @@ func (s *server) populateAutoValues(schemaName string, sch *schema.Schema, paylo
 }
 
 func requiresUUID(field schema.Field) bool {
+	if field.Kind == schema.KindUUID {
+		return true
+	}
 	if field.Kind != schema.KindString {
 		return false
 	}
@@ -1116,10 +2251,66 @@ func statusFromError(w http.ResponseWriter, err error) {
 	http.Error(w, err.Error(), http.StatusBadRequest)
 }
 
+// payloadErrorStatus maps an error from decoding an uploaded payload to a
+// status: 409 when it was encoded for another version of the schema, 415 for
+// a format version this build cannot read, and 400 for anything malformed.
+func payloadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, codec.ErrSchemaFingerprintMismatch):
+		return http.StatusConflict
+	case errors.Is(err, codec.ErrUnsupportedVersion):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// fingerprintHeader carries the schema fingerprint a payload was encoded
+// against, as 16 hex digits.
+const fingerprintHeader = "X-SCRT-Schema-Fingerprint"
+
+// checkFingerprintHeader rejects an upload whose optional fingerprintHeader
+// does not name the current version of sch, writing 409 with both
+// fingerprints. It reports whether the request may proceed.
+func checkFingerprintHeader(w http.ResponseWriter, r *http.Request, sch *schema.Schema) bool {
+	raw := strings.TrimSpace(r.Header.Get(fingerprintHeader))
+	if raw == "" {
+		return true
+	}
+	hex := strings.TrimPrefix(strings.ToLower(raw), "0x")
+	want, err := strconv.ParseUint(hex, 16, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid %s %q", fingerprintHeader, raw), http.StatusBadRequest)
+		return false
+	}
+	if current := sch.Fingerprint(); want != current {
+		http.Error(w, fmt.Sprintf("schema fingerprint mismatch: request has %016x, schema %s is at %016x", want, sch.Name, current), http.StatusConflict)
+		return false
+	}
+	return true
+}
+
 func methodNotAllowed(w http.ResponseWriter) {
 	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 }
 
+// notModified sets a strong ETag built from tag and reports whether the
+// request's If-None-Match already names it, in which case a 304 has been
+// written. Responses with an ETag may be cached but must be revalidated.
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	etag := `"` + tag + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
 func noCache(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Cache-Control", "no-store")
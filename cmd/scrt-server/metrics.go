@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// persistBuckets are the upper bounds, in seconds, of the persist duration
+// histogram.
+var persistBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// metrics collects server counters and renders them in the Prometheus text
+// format. A nil *metrics records nothing, so handlers call it unconditionally
+// and the -metrics flag only decides whether one is created.
+type metrics struct {
+	mu            sync.Mutex
+	requests      map[requestLabels]uint64
+	persistCounts []uint64 // per bucket, plus +Inf last
+	persistSum    float64
+	persistTotal  uint64
+	bytesWritten  uint64
+	decodeErrors  uint64
+	autoValues    uint64
+}
+
+// requestLabels keeps request counter labels bounded: route is a template
+// from routeTemplate and method is one of the methods the server handles.
+type requestLabels struct {
+	route  string
+	method string
+	status int
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:      make(map[requestLabels]uint64),
+		persistCounts: make([]uint64, len(persistBuckets)+1),
+	}
+}
+
+// instrument counts every request next serves by route template, method,
+// and status. It returns next unchanged when m is nil.
+func (m *metrics) instrument(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		labels := requestLabels{route: routeTemplate(r.URL.Path), method: metricMethod(r.Method), status: rec.status}
+		m.mu.Lock()
+		m.requests[labels]++
+		m.mu.Unlock()
+	})
+}
+
+// observePersist records one successful persist of n payload bytes.
+func (m *metrics) observePersist(elapsed time.Duration, n int) {
+	if m == nil {
+		return
+	}
+	seconds := elapsed.Seconds()
+	bucket := sort.SearchFloat64s(persistBuckets, seconds)
+	m.mu.Lock()
+	m.persistCounts[bucket]++
+	m.persistSum += seconds
+	m.persistTotal++
+	m.bytesWritten += uint64(n)
+	m.mu.Unlock()
+}
+
+// decodeError counts an uploaded or stored payload that failed to decode.
+func (m *metrics) decodeError() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.decodeErrors++
+	m.mu.Unlock()
+}
+
+// autoValue counts one auto-increment value taken from the storage counters.
+func (m *metrics) autoValue() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.autoValues++
+	m.mu.Unlock()
+}
+
+// ServeHTTP writes the current values in the Prometheus text format.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.write(w)
+}
+
+func (m *metrics) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+
+	b.WriteString("# HELP scrt_http_requests_total HTTP requests by route template, method, and status.\n")
+	b.WriteString("# TYPE scrt_http_requests_total counter\n")
+	labels := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		a, c := labels[i], labels[j]
+		if a.route != c.route {
+			return a.route < c.route
+		}
+		if a.method != c.method {
+			return a.method < c.method
+		}
+		return a.status < c.status
+	})
+	for _, l := range labels {
+		fmt.Fprintf(&b, "scrt_http_requests_total{route=%q,method=%q,status=\"%d\"} %d\n", l.route, l.method, l.status, m.requests[l])
+	}
+
+	b.WriteString("# HELP scrt_persist_duration_seconds Time spent persisting snapshots.\n")
+	b.WriteString("# TYPE scrt_persist_duration_seconds histogram\n")
+	var cumulative uint64
+	for i, bound := range persistBuckets {
+		cumulative += m.persistCounts[i]
+		fmt.Fprintf(&b, "scrt_persist_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(&b, "scrt_persist_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.persistTotal)
+	fmt.Fprintf(&b, "scrt_persist_duration_seconds_sum %s\n", strconv.FormatFloat(m.persistSum, 'g', -1, 64))
+	fmt.Fprintf(&b, "scrt_persist_duration_seconds_count %d\n", m.persistTotal)
+
+	writeCounter(&b, "scrt_payload_bytes_written_total", "Payload bytes handed to storage by successful persists.", m.bytesWritten)
+	writeCounter(&b, "scrt_decode_errors_total", "Payloads that failed to decode.", m.decodeErrors)
+	writeCounter(&b, "scrt_auto_values_allocated_total", "Auto-increment values allocated from storage counters.", m.autoValues)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeCounter(b *strings.Builder, name, help string, value uint64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+// routeTemplate maps a request path onto the route it was served by, so raw
+// schema names and record keys never become label values.
+func routeTemplate(path string) string {
+	switch path {
+	case "/schemas", "/snapshots", "/bundle", "/healthz", "/readyz", "/metrics", "/openapi.json":
+		return path
+	}
+	if rest, ok := strings.CutPrefix(path, "/schemas/"); ok {
+		switch {
+		case strings.HasSuffix(rest, "/versions"):
+			return "/schemas/{name}/versions"
+		case strings.HasSuffix(rest, "/rollback"):
+			return "/schemas/{name}/rollback"
+		case strings.HasSuffix(rest, "/jsonschema"):
+			return "/schemas/{name}/jsonschema"
+		}
+		return "/schemas/{name}"
+	}
+	if rest, ok := strings.CutPrefix(path, "/records/"); ok {
+		parts := strings.Split(rest, "/")
+		switch {
+		case len(parts) >= 3 && strings.EqualFold(parts[1], "row"):
+			return "/records/{schema}/row/{field}/{key}"
+		case len(parts) == 2 && strings.EqualFold(parts[1], "validate"):
+			return "/records/{schema}/validate"
+		case len(parts) == 2 && strings.EqualFold(parts[1], "reindex"):
+			return "/records/{schema}/reindex"
+		case len(parts) == 2 && strings.EqualFold(parts[1], "vacuum"):
+			return "/records/{schema}/vacuum"
+		}
+		return "/records/{schema}"
+	}
+	if strings.HasPrefix(path, "/ids/") {
+		return "/ids/{path}"
+	}
+	return "other"
+}
+
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+// statusRecorder remembers the status code a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming responses such as streamRowsJSON flushable.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
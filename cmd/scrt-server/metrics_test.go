@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	scrt "github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/storage"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64 auto_increment
+@field Name string
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: reg, store: backend, metrics: newMetrics()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/records/", srv.handleRecords)
+	mux.Handle("/metrics", srv.metrics)
+	ts := httptest.NewServer(srv.metrics.instrument(mux))
+	defer ts.Close()
+
+	doc, _, _, err := reg.Snapshot("User")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"Name": "Ada"}, {"Name": "Lin"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	do := func(method, path string, body []byte) int {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := do(http.MethodPut, "/records/User", payload); code != http.StatusNoContent {
+		t.Fatalf("put: expected 204, got %d", code)
+	}
+	if code := do(http.MethodPost, "/records/User", []byte("garbage")); code != http.StatusBadRequest {
+		t.Fatalf("garbage post: expected 400, got %d", code)
+	}
+	if code := do(http.MethodGet, "/records/User/row/ID/1", nil); code != http.StatusOK {
+		t.Fatalf("row get: expected 200, got %d", code)
+	}
+	if code := do(http.MethodGet, "/records/User/row/ID/2", nil); code != http.StatusOK {
+		t.Fatalf("row get: expected 200, got %d", code)
+	}
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	text := string(body)
+	for _, want := range []string{
+		`scrt_http_requests_total{route="/records/{schema}",method="PUT",status="204"} 1`,
+		`scrt_http_requests_total{route="/records/{schema}",method="POST",status="400"} 1`,
+		`scrt_http_requests_total{route="/records/{schema}/row/{field}/{key}",method="GET",status="200"} 2`,
+		`scrt_persist_duration_seconds_count 1`,
+		`scrt_decode_errors_total 1`,
+		`scrt_auto_values_allocated_total 2`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("metrics missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "/records/User") {
+		t.Fatalf("raw paths leaked into labels:\n%s", text)
+	}
+	if strings.Contains(text, "scrt_payload_bytes_written_total 0\n") {
+		t.Fatalf("payload bytes counter did not move:\n%s", text)
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	t.Parallel()
+	var m *metrics
+	mux := http.NewServeMux()
+	if got := m.instrument(mux); got != http.Handler(mux) {
+		t.Fatalf("nil metrics should not wrap the handler")
+	}
+	m.observePersist(time.Millisecond, 10)
+	m.decodeError()
+	m.autoValue()
+}
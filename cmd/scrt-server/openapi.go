@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// handleOpenAPI serves an OpenAPI 3.1 description of the record and id
+// routes of every registered schema. It is rebuilt on each request, so it
+// follows schema upserts.
+func (s *server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	spec, err := s.openAPISpec()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, spec)
+}
+
+// openAPISpec builds the OpenAPI document. Component schemas are the JSON
+// Schema of each registered schema, which OpenAPI 3.1 accepts unchanged.
+func (s *server) openAPISpec() (map[string]any, error) {
+	summaries := s.registry.List()
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	paths := map[string]any{
+		"/ids/uuid": map[string]any{
+			"get": map[string]any{
+				"summary":   "Generate a UUIDv7",
+				"responses": jsonResponse("The generated UUID", objectOf(map[string]any{"uuid": map[string]any{"type": "string", "format": "uuid"}})),
+			},
+		},
+	}
+	components := map[string]any{}
+	includeDeleted := queryParam("includeDeleted", "Include rows tombstoned by a soft delete", map[string]any{"type": "boolean"})
+	for _, summary := range summaries {
+		doc, _, _, err := s.registry.Snapshot(summary.Name)
+		if err != nil {
+			continue // deleted since List
+		}
+		sch, ok := doc.Schema(summary.Name)
+		if !ok {
+			continue
+		}
+		jsonSchema, err := sch.JSONSchema()
+		if err != nil {
+			return nil, err
+		}
+		name := sch.Name
+		components[name] = json.RawMessage(jsonSchema)
+		ref := map[string]any{"$ref": "#/components/schemas/" + name}
+
+		fields := make([]string, 0, len(sch.Fields))
+		var autoFields []string
+		for _, field := range sch.Fields {
+			fields = append(fields, field.Name)
+			if field.AutoIncrement {
+				autoFields = append(autoFields, field.Name)
+			}
+		}
+		upload := map[string]any{
+			"summary": fmt.Sprintf("Write %s records", name),
+			"parameters": []any{
+				queryParam("mode", "append, replace, or upsert", map[string]any{"type": "string", "enum": []string{"append", "replace", "upsert"}}),
+				queryParam("key", "Key field for mode=upsert", map[string]any{"type": "string", "enum": fields}),
+				map[string]any{
+					"name":        fingerprintHeader,
+					"in":          "header",
+					"description": "Reject the upload with 409 unless the schema still has this fingerprint",
+					"schema":      map[string]any{"type": "string", "pattern": "^(0x)?[0-9a-fA-F]{1,16}$"},
+				},
+			},
+			"requestBody": scrtBody(fmt.Sprintf("SCRT payload encoded with the %s schema", name)),
+			"responses": map[string]any{
+				"204": map[string]any{"description": "Stored"},
+				"400": map[string]any{"description": "Malformed payload or parameters"},
+				"409": map[string]any{"description": "Payload encoded for another schema version, or duplicate unique keys"},
+				"415": map[string]any{"description": "Unsupported SCRT format version"},
+			},
+		}
+		records := map[string]any{
+			"get": map[string]any{
+				"summary":    fmt.Sprintf("Read all %s records", name),
+				"parameters": []any{includeDeleted},
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "Stored records",
+						"content": map[string]any{
+							"application/x-scrt": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+							"application/json":   map[string]any{"schema": map[string]any{"type": "array", "items": ref}},
+						},
+					},
+					"404": map[string]any{"description": "No records stored"},
+				},
+			},
+			"post": upload,
+			"put":  upload,
+			"delete": map[string]any{
+				"summary":   fmt.Sprintf("Delete all %s records", name),
+				"responses": map[string]any{"204": map[string]any{"description": "Deleted"}},
+			},
+		}
+		if sch.Doc != "" {
+			records["description"] = sch.Doc
+		}
+		paths["/records/"+name] = records
+
+		rowParams := []any{
+			pathParam("field", "Field to match the key against", map[string]any{"type": "string", "enum": fields}),
+			pathParam("key", "Key value, as text", map[string]any{"type": "string"}),
+		}
+		rowResult := objectOf(map[string]any{
+			"schema":  map[string]any{"type": "string"},
+			"field":   map[string]any{"type": "string"},
+			"key":     map[string]any{"type": "string"},
+			"row":     ref,
+			"deleted": map[string]any{"type": "boolean"},
+		})
+		edit := map[string]any{
+			"summary": fmt.Sprintf("Replace one %s record", name),
+			"parameters": []any{
+				queryParam("dryRun", "Preview the edit without persisting it", map[string]any{"type": "boolean"}),
+			},
+			"requestBody": scrtBody("Single-row SCRT payload"),
+			"responses":   jsonResponse("The replacement row", rowResult),
+		}
+		paths["/records/"+name+"/row/{field}/{key}"] = map[string]any{
+			"parameters": rowParams,
+			"get": map[string]any{
+				"summary":    fmt.Sprintf("Read one %s record", name),
+				"parameters": []any{includeDeleted},
+				"responses":  jsonResponse("The matching row", rowResult),
+			},
+			"patch": edit,
+			"put":   edit,
+			"delete": map[string]any{
+				"summary": fmt.Sprintf("Delete one %s record", name),
+				"responses": map[string]any{
+					"204": map[string]any{"description": "Deleted"},
+					"404": map[string]any{"description": "No matching row"},
+				},
+			},
+		}
+
+		if len(autoFields) == 0 {
+			continue
+		}
+		counter := jsonResponse("The next value", objectOf(map[string]any{
+			"schema": map[string]any{"type": "string"},
+			"field":  map[string]any{"type": "string"},
+			"next":   map[string]any{"type": "integer", "minimum": 0},
+		}))
+		paths["/ids/"+name+"/{field}"] = map[string]any{
+			"parameters": []any{
+				pathParam("field", "Auto-increment field", map[string]any{"type": "string", "enum": autoFields}),
+			},
+			"get": map[string]any{
+				"summary":   "Allocate the next auto-increment value",
+				"responses": counter,
+			},
+			"post": map[string]any{
+				"summary": "Set the next auto-increment value",
+				"parameters": []any{
+					queryParam("set", "Next value to hand out", map[string]any{"type": "integer", "minimum": 0}),
+				},
+				"responses": counter,
+			},
+		}
+		paths["/ids/"+name] = map[string]any{
+			"delete": map[string]any{
+				"summary":   fmt.Sprintf("Reset the %s auto-increment counters", name),
+				"responses": map[string]any{"204": map[string]any{"description": "Counters dropped"}},
+			},
+		}
+	}
+	return map[string]any{
+		"openapi":    "3.1.0",
+		"info":       map[string]any{"title": "SCRT server", "version": "1"},
+		"paths":      paths,
+		"components": map[string]any{"schemas": components},
+	}, nil
+}
+
+func objectOf(properties map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func jsonResponse(description string, body map[string]any) map[string]any {
+	return map[string]any{
+		"200": map[string]any{
+			"description": description,
+			"content":     map[string]any{"application/json": map[string]any{"schema": body}},
+		},
+	}
+}
+
+func scrtBody(description string) map[string]any {
+	return map[string]any{
+		"required":    true,
+		"description": description,
+		"content": map[string]any{
+			"application/x-scrt": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+		},
+	}
+}
+
+func pathParam(name, description string, sch map[string]any) map[string]any {
+	return map[string]any{"name": name, "in": "path", "required": true, "description": description, "schema": sch}
+}
+
+func queryParam(name, description string, sch map[string]any) map[string]any {
+	return map[string]any{"name": name, "in": "query", "description": description, "schema": sch}
+}
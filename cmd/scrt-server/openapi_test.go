@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+func TestHandleOpenAPI(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	for name, dsl := range map[string]string{
+		"User": "@schema:User\n@field ID uint64 serial\n@field Name string required\n",
+		"Post": "@schema:Post\n@field Slug string\n@field Author uint64\n@field Published timestamp\n",
+	} {
+		if _, err := reg.Upsert(name, []byte(dsl), "test", time.Now().UTC()); err != nil {
+			t.Fatalf("upsert %s: %v", name, err)
+		}
+	}
+	srv := &server{registry: reg}
+
+	type spec struct {
+		OpenAPI    string                    `json:"openapi"`
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	fetch := func() spec {
+		t.Helper()
+		resp := httptest.NewRecorder()
+		srv.handleOpenAPI(resp, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var out spec
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("decode spec: %v", err)
+		}
+		return out
+	}
+
+	got := fetch()
+	if got.OpenAPI != "3.1.0" {
+		t.Fatalf("unexpected openapi version %q", got.OpenAPI)
+	}
+	for path, methods := range map[string][]string{
+		"/records/User":                   {"get", "post", "put", "delete"},
+		"/records/User/row/{field}/{key}": {"get", "patch", "put", "delete"},
+		"/records/Post":                   {"get", "post", "put", "delete"},
+		"/records/Post/row/{field}/{key}": {"get", "patch", "put", "delete"},
+		"/ids/User/{field}":               {"get", "post"},
+		"/ids/User":                       {"delete"},
+		"/ids/uuid":                       {"get"},
+	} {
+		item, ok := got.Paths[path]
+		if !ok {
+			t.Fatalf("spec lacks path %s", path)
+		}
+		for _, method := range methods {
+			if _, ok := item[method]; !ok {
+				t.Fatalf("path %s lacks %s", path, method)
+			}
+		}
+	}
+	if _, ok := got.Paths["/ids/Post/{field}"]; ok {
+		t.Fatalf("Post has no auto-increment fields, so no counter path")
+	}
+	user, ok := got.Components.Schemas["User"]
+	if !ok || user.Properties["ID"]["type"] != "integer" || user.Properties["Name"]["type"] != "string" {
+		t.Fatalf("unexpected User component: %+v", user)
+	}
+	if len(user.Required) != 1 || user.Required[0] != "Name" {
+		t.Fatalf("expected Name to be required, got %v", user.Required)
+	}
+	post := got.Components.Schemas["Post"]
+	if post.Properties["Author"]["type"] != "integer" || post.Properties["Published"]["format"] != "date-time" {
+		t.Fatalf("unexpected Post component: %+v", post)
+	}
+
+	// The spec follows schema upserts.
+	const next = "@schema:Post\n@field Slug string\n@field Author uint64\n@field Published timestamp\n@field Views uint64\n"
+	if _, err := reg.Upsert("Post", []byte(next), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert Post: %v", err)
+	}
+	if views := fetch().Components.Schemas["Post"].Properties["Views"]; views["type"] != "integer" {
+		t.Fatalf("spec did not pick up the new Views field: %v", views)
+	}
+}
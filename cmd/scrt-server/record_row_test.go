@@ -3,8 +3,13 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -91,3 +96,892 @@ func TestHandleRecordRowPatch(t *testing.T) {
 		t.Fatalf("patch did not persist change, got %v", rows[1]["Name"])
 	}
 }
+
+func TestHandleRecordsUpsert(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64 auto_increment
+@field Name string
+@field Email string
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+	doc, _, _, err := reg.Snapshot("User")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sch, ok := doc.Schema("User")
+	if !ok {
+		t.Fatalf("schema User missing")
+	}
+	post := func(target string, rows []map[string]any) *httptest.ResponseRecorder {
+		t.Helper()
+		payload, err := scrt.Marshal(sch, rows)
+		if err != nil {
+			t.Fatalf("marshal rows: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/x-scrt")
+		resp := httptest.NewRecorder()
+		srv.handleRecords(resp, req)
+		return resp
+	}
+
+	if resp := post("/records/User", []map[string]any{
+		{"ID": uint64(1001), "Name": "John", "Email": "john@example.com"},
+		{"ID": uint64(1002), "Name": "Jane", "Email": "jane@example.com"},
+	}); resp.Code != http.StatusNoContent {
+		t.Fatalf("seed: expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := post("/records/User?mode=upsert&key=ID", []map[string]any{
+		{"ID": uint64(1002), "Name": "Jenny", "Email": "jenny@example.com"},
+	}); resp.Code != http.StatusNoContent {
+		t.Fatalf("upsert existing: expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := post("/records/User?mode=upsert&key=ID", []map[string]any{
+		{"ID": uint64(1003), "Name": "Jack", "Email": "jack@example.com"},
+	}); resp.Code != http.StatusNoContent {
+		t.Fatalf("upsert new: expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	reloaded, err := backend.LoadPayload("User")
+	if err != nil {
+		t.Fatalf("reload payload: %v", err)
+	}
+	var rows []map[string]any
+	if err := scrt.Unmarshal(reloaded, sch, &rows); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d: %v", len(rows), rows)
+	}
+	want := []struct {
+		id   uint64
+		name string
+	}{{1001, "John"}, {1002, "Jenny"}, {1003, "Jack"}}
+	for i, w := range want {
+		if rows[i]["ID"] != w.id || rows[i]["Name"] != w.name {
+			t.Fatalf("row %d: expected %d/%s, got %v", i, w.id, w.name, rows[i])
+		}
+	}
+
+	if resp := post("/records/User?mode=upsert", []map[string]any{{"ID": uint64(1004)}}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("missing key: expected 400, got %d", resp.Code)
+	}
+	if resp := post("/records/User?mode=upsert&key=Nope", []map[string]any{{"ID": uint64(1004)}}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("unknown key: expected 400, got %d", resp.Code)
+	}
+}
+
+func TestHandleRecordsAcceptJSON(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const eventSchema = `@schema:Event
+@field ID uint64
+@field Day date
+@field Blob bytes
+`
+	if _, err := reg.Upsert("Event", []byte(eventSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	doc, _, _, _ := reg.Snapshot("Event")
+	sch, _ := doc.Schema("Event")
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1), "Day": time.Date(2025, time.May, 6, 0, 0, 0, 0, time.UTC), "Blob": []byte("hi")},
+		{"ID": uint64(2)},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := backend.Persist("Event", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+
+	cases := []struct {
+		accept string
+		json   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/x-scrt", false},
+		{"application/json", true},
+		{"text/html, application/json;q=0.9, */*;q=0.8", true},
+		{"application/x-scrt, application/json;q=0.5", false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/records/Event", nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		resp := httptest.NewRecorder()
+		srv.handleRecords(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Accept %q: expected 200, got %d", tc.accept, resp.Code)
+		}
+		contentType := resp.Header().Get("Content-Type")
+		if !tc.json {
+			if contentType != "application/x-scrt" || !bytes.Equal(resp.Body.Bytes(), payload) {
+				t.Fatalf("Accept %q: expected raw SCRT, got %q", tc.accept, contentType)
+			}
+			continue
+		}
+		if contentType != "application/json" {
+			t.Fatalf("Accept %q: expected JSON, got %q", tc.accept, contentType)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(resp.Body.Bytes(), &rows); err != nil {
+			t.Fatalf("Accept %q: decode JSON: %v (%s)", tc.accept, err, resp.Body.String())
+		}
+		if len(rows) != 2 {
+			t.Fatalf("Accept %q: expected 2 rows, got %d", tc.accept, len(rows))
+		}
+		if rows[0]["ID"] != float64(1) || rows[0]["Day"] != "2025-05-06" || rows[0]["Blob"] != "aGk=" {
+			t.Fatalf("Accept %q: unexpected first row %v", tc.accept, rows[0])
+		}
+		if _, ok := rows[1]["Day"]; ok {
+			t.Fatalf("Accept %q: unset field should be omitted, got %v", tc.accept, rows[1])
+		}
+	}
+
+	// Behind an origin allowlist the response varies on both headers.
+	handler := allowCORS([]string{"https://app.example"}, http.HandlerFunc(srv.handleRecords))
+	req := httptest.NewRequest(http.MethodGet, "/records/Event", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Accept", "application/json")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if vary := resp.Header().Values("Vary"); !slices.Contains(vary, "Origin") || !slices.Contains(vary, "Accept") {
+		t.Fatalf("expected Vary to list Origin and Accept, got %q", vary)
+	}
+}
+
+func TestHandleRecordsValidate(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64 unique
+@field Email string required
+@field Role string enum=admin|member
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+	doc, _, _, _ := reg.Snapshot("User")
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1), "Email": "a@example.com", "Role": "admin"},
+		{"ID": uint64(1), "Role": "owner"},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/records/User/validate", bytes.NewReader(payload))
+	resp := httptest.NewRecorder()
+	srv.handleRecords(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var report scrt.ValidationReport
+	if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if report.Rows != 2 || report.TotalViolations != 3 || report.NullCounts["Email"] != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, err := backend.LoadPayload("User"); err == nil {
+		t.Fatalf("validate must not persist the payload")
+	}
+
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodPost, "/records/User/validate", bytes.NewReader([]byte("junk"))))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a corrupt payload, got %d", resp.Code)
+	}
+}
+
+func TestHandleRecordsPayloadErrorStatus(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64
+@field Name string
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+	doc, _, _, _ := reg.Snapshot("User")
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Name": "ada"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	stale := &schema.Schema{Name: "User", Fields: sch.Fields[:1]}
+	stalePayload, err := scrt.Marshal(stale, []map[string]any{{"ID": uint64(1)}})
+	if err != nil {
+		t.Fatalf("marshal stale: %v", err)
+	}
+	future := bytes.Clone(payload)
+	future[4] = 9
+
+	for _, tc := range []struct {
+		name string
+		body []byte
+		want int
+	}{
+		{"junk", []byte("junk payload"), http.StatusBadRequest},
+		{"corrupt page", append(bytes.Clone(payload[:13]), 2, 1, 0xff), http.StatusBadRequest},
+		{"stale schema", stalePayload, http.StatusConflict},
+		{"future version", future, http.StatusUnsupportedMediaType},
+	} {
+		resp := httptest.NewRecorder()
+		srv.handleRecords(resp, httptest.NewRequest(http.MethodPost, "/records/User", bytes.NewReader(tc.body)))
+		if resp.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.want, resp.Code, resp.Body.String())
+		}
+	}
+	if _, err := backend.LoadPayload("User"); err == nil {
+		t.Fatalf("rejected uploads must not persist anything")
+	}
+}
+
+func TestHandleRecordsFingerprintHeader(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64
+@field Name string
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+	doc, _, _, _ := reg.Snapshot("User")
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Name": "ada"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	current := fmt.Sprintf("%016x", sch.Fingerprint())
+	stale := fmt.Sprintf("%016x", sch.Fingerprint()^1)
+
+	post := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/records/User", bytes.NewReader(payload))
+		if header != "" {
+			req.Header.Set(fingerprintHeader, header)
+		}
+		resp := httptest.NewRecorder()
+		srv.handleRecords(resp, req)
+		return resp
+	}
+
+	resp := post(stale)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("mismatched fingerprint: expected 409, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if body := resp.Body.String(); !strings.Contains(body, stale) || !strings.Contains(body, current) {
+		t.Fatalf("conflict should name both fingerprints, got %q", body)
+	}
+	if _, err := backend.LoadPayload("User"); err == nil {
+		t.Fatalf("rejected upload must not persist anything")
+	}
+	if resp := post("not-hex"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("malformed fingerprint: expected 400, got %d", resp.Code)
+	}
+	if resp := post(current); resp.Code != http.StatusNoContent {
+		t.Fatalf("matching fingerprint: expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := post("0x" + strings.ToUpper(current)); resp.Code != http.StatusNoContent {
+		t.Fatalf("prefixed fingerprint: expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := post(""); resp.Code != http.StatusNoContent {
+		t.Fatalf("header is optional: expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodGet, "/records/User", nil))
+	if got := resp.Header().Get(fingerprintHeader); got != current {
+		t.Fatalf("GET should report fingerprint %s, got %q", current, got)
+	}
+}
+
+func TestHandleRecordsBodyLimit(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64
+@field Name string
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	doc, _, _, err := reg.Snapshot("User")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	rows := make([]map[string]any, 5000)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i + 1), "Name": fmt.Sprintf("user-%d", i)}
+	}
+	payload, err := scrt.Marshal(sch, rows)
+	if err != nil {
+		t.Fatalf("marshal rows: %v", err)
+	}
+	put := func(limit int64) *httptest.ResponseRecorder {
+		srv := &server{registry: reg, store: backend, maxBodyBytes: limit}
+		resp := httptest.NewRecorder()
+		srv.handleRecords(resp, httptest.NewRequest(http.MethodPut, "/records/User", bytes.NewReader(payload)))
+		return resp
+	}
+
+	resp := put(int64(len(payload)) - 1)
+	if resp.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("over limit: expected 413, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if !strings.Contains(resp.Body.String(), fmt.Sprintf("exceeds the %d byte limit", len(payload)-1)) {
+		t.Fatalf("over limit: unclear message %q", resp.Body.String())
+	}
+	if _, err := backend.LoadPayload("User"); err == nil {
+		t.Fatalf("over-limit upload should not persist anything")
+	}
+
+	if resp := put(int64(len(payload))); resp.Code != http.StatusNoContent {
+		t.Fatalf("at limit: expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+	stored, err := backend.LoadPayload("User")
+	if err != nil {
+		t.Fatalf("load payload: %v", err)
+	}
+	var decoded []map[string]any
+	if err := scrt.Unmarshal(stored, sch, &decoded); err != nil || len(decoded) != len(rows) {
+		t.Fatalf("stored %d rows (%v), want %d", len(decoded), err, len(rows))
+	}
+}
+
+func TestHandleRecordRowPatchDryRun(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64 auto_increment
+@field Name string
+@field Email string
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+	doc, _, _, err := reg.Snapshot("User")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1001), "Name": "John", "Email": "john@example.com"},
+		{"ID": uint64(1002), "Name": "Jane", "Email": "jane@example.com"},
+		{"ID": uint64(1003), "Name": "John", "Email": "john2@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("marshal seed rows: %v", err)
+	}
+	if _, err := backend.Persist("User", sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		t.Fatalf("persist seed rows: %v", err)
+	}
+	if err := reg.SetPayload("User", payload); err != nil {
+		t.Fatalf("set payload: %v", err)
+	}
+	before, err := backend.LoadPayload("User")
+	if err != nil {
+		t.Fatalf("load payload: %v", err)
+	}
+	patch := func(target string, row map[string]any) *httptest.ResponseRecorder {
+		t.Helper()
+		body, err := scrt.Marshal(sch, []map[string]any{row})
+		if err != nil {
+			t.Fatalf("marshal replacement: %v", err)
+		}
+		resp := httptest.NewRecorder()
+		srv.handleRecords(resp, httptest.NewRequest(http.MethodPatch, target, bytes.NewReader(body)))
+		return resp
+	}
+
+	resp := patch("/records/User/row/ID/1002?dryRun=true", map[string]any{"ID": uint64(9), "Name": "Jenny"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("dry run: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var preview struct {
+		Row    map[string]any `json:"row"`
+		Rows   uint64         `json:"rows"`
+		DryRun bool           `json:"dryRun"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+		t.Fatalf("decode preview: %v", err)
+	}
+	if !preview.DryRun || preview.Rows != 3 || preview.Row["Name"] != "Jenny" || preview.Row["ID"] != float64(1002) {
+		t.Fatalf("unexpected preview %+v", preview)
+	}
+
+	if resp := patch("/records/User/row/Name/John?dryRun=1", map[string]any{"Email": "x@example.com"}); resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "multiple rows match") {
+		t.Fatalf("multi-match dry run: expected 400, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := patch("/records/User/row/ID/1002?dryRun=maybe", map[string]any{"Name": "Jenny"}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("invalid dryRun: expected 400, got %d", resp.Code)
+	}
+
+	after, err := backend.LoadPayload("User")
+	if err != nil {
+		t.Fatalf("reload payload: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("dry run changed the stored payload")
+	}
+	if current, ok := reg.Payload("User"); !ok || !bytes.Equal(current, payload) {
+		t.Fatalf("dry run changed the registry payload")
+	}
+	next, err := backend.NextAutoValue("User", sch, "ID")
+	if err != nil {
+		t.Fatalf("next auto value: %v", err)
+	}
+	if next != 1004 {
+		t.Fatalf("dry run moved the auto counter: next ID %d, want 1004", next)
+	}
+}
+
+func TestHandleRecordsMaskSensitiveFields(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64
+@field Name string
+@field Email string sensitive
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	doc, _, _, err := reg.Snapshot("User")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1), "Name": "Ada", "Email": "ada@example.com"},
+		{"ID": uint64(2), "Name": "Lin"},
+	})
+	if err != nil {
+		t.Fatalf("marshal rows: %v", err)
+	}
+	if _, err := backend.Persist("User", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	get := func(srv *server, target, accept, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", accept)
+		if token != "" {
+			req.Header.Set(revealHeader, token)
+		}
+		resp := httptest.NewRecorder()
+		srv.handleRecords(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", target, resp.Code, resp.Body.String())
+		}
+		return resp
+	}
+	rowsOf := func(resp *httptest.ResponseRecorder) []map[string]any {
+		var rows []map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+			t.Fatalf("decode rows: %v", err)
+		}
+		return rows
+	}
+
+	masked := &server{registry: reg, store: backend, revealToken: "s3cret"}
+	rows := rowsOf(get(masked, "/records/User", "application/json", ""))
+	if rows[0]["Email"] != "***" || rows[0]["Name"] != "Ada" {
+		t.Fatalf("Email should be masked: %v", rows[0])
+	}
+	if _, ok := rows[1]["Email"]; ok {
+		t.Fatalf("an unset sensitive field should stay absent: %v", rows[1])
+	}
+	var envelope struct {
+		Row map[string]any `json:"row"`
+	}
+	if err := json.NewDecoder(get(masked, "/records/User/row/ID/1", "application/json", "").Body).Decode(&envelope); err != nil {
+		t.Fatalf("decode row: %v", err)
+	}
+	if envelope.Row["Email"] != "***" {
+		t.Fatalf("row endpoint should mask Email: %v", envelope.Row)
+	}
+	if rows := rowsOf(get(masked, "/records/User", "application/json", "wrong")); rows[0]["Email"] != "***" {
+		t.Fatalf("a wrong reveal token must not unmask: %v", rows[0])
+	}
+	if rows := rowsOf(get(masked, "/records/User", "application/json", "s3cret")); rows[0]["Email"] != "ada@example.com" {
+		t.Fatalf("the reveal token should unmask Email: %v", rows[0])
+	}
+
+	omitting := &server{registry: reg, store: backend, sensitiveMode: redactOmit}
+	if rows := rowsOf(get(omitting, "/records/User", "application/json", "")); rows[0]["Name"] != "Ada" {
+		t.Fatalf("unexpected rows %v", rows)
+	} else if _, ok := rows[0]["Email"]; ok {
+		t.Fatalf("omit mode should drop Email: %v", rows[0])
+	}
+
+	raw := get(masked, "/records/User", "application/x-scrt", "")
+	var decoded []map[string]any
+	if err := scrt.Unmarshal(raw.Body.Bytes(), sch, &decoded); err != nil {
+		t.Fatalf("unmarshal binary response: %v", err)
+	}
+	if decoded[0]["Email"] != "ada@example.com" {
+		t.Fatalf("the binary response should keep sensitive values: %v", decoded[0])
+	}
+}
+
+func TestHandleRecordsReindex(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64 auto_increment
+@field Name string
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	root := t.TempDir()
+	backend, err := storage.NewSnapshotBackend(root)
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	doc, _, _, err := reg.Snapshot("User")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1), "Name": "Ada"},
+		{"ID": uint64(2), "Name": "Lin"},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := backend.Persist("User", sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	indexPath := filepath.Join(root, "User", "idx_id.bin")
+	if err := os.Remove(indexPath); err != nil {
+		t.Fatalf("remove index: %v", err)
+	}
+	reopened, err := storage.NewSnapshotBackend(root)
+	if err != nil {
+		t.Fatalf("reopen backend: %v", err)
+	}
+	srv := &server{registry: reg, store: reopened}
+
+	resp := httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodGet, "/records/User/reindex", nil))
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET reindex: expected 405, got %d", resp.Code)
+	}
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodPost, "/records/User/reindex", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("reindex: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var meta storage.SnapshotMeta
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		t.Fatalf("decode meta: %v", err)
+	}
+	if meta.RowCount != 2 || len(meta.Indexes) != 1 || meta.Indexes[0].Field != "ID" {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+	if _, err := os.Stat(indexPath); err != nil {
+		t.Fatalf("index file not rebuilt: %v", err)
+	}
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodGet, "/records/User/row/ID/2", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("row get after reindex: expected 200, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodPost, "/records/Missing/reindex", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("unknown schema: expected 404, got %d", resp.Code)
+	}
+}
+
+func TestHandleRecordsVacuum(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const userSchema = `@schema:User
+@field ID uint64 auto_increment
+@field Name string
+`
+	if _, err := reg.Upsert("User", []byte(userSchema), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	doc, _, _, err := reg.Snapshot("User")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	var payload []byte
+	for i := 1; i <= 20; i++ {
+		payload, err = scrt.MarshalAppend(payload, sch, []map[string]any{{"ID": uint64(i), "Name": fmt.Sprintf("user-%d", i)}})
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if _, err := backend.Persist("User", sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	if err := reg.SetPayload("User", payload); err != nil {
+		t.Fatalf("set payload: %v", err)
+	}
+	srv := &server{registry: reg, store: backend}
+
+	resp := httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodGet, "/records/User/vacuum", nil))
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET vacuum: expected 405, got %d", resp.Code)
+	}
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodPost, "/records/User/vacuum", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("vacuum: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var meta storage.SnapshotMeta
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		t.Fatalf("decode meta: %v", err)
+	}
+	if meta.RowCount != 20 {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+	stored, err := backend.LoadPayload("User")
+	if err != nil {
+		t.Fatalf("load payload: %v", err)
+	}
+	if len(stored) >= len(payload) {
+		t.Fatalf("vacuum did not shrink the payload: %d >= %d bytes", len(stored), len(payload))
+	}
+	if current, ok := reg.Payload("User"); !ok || !bytes.Equal(current, stored) {
+		t.Fatalf("registry payload not updated after vacuum")
+	}
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodGet, "/records/User/row/ID/17", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("row get after vacuum: expected 200, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	srv.handleRecords(resp, httptest.NewRequest(http.MethodPost, "/records/Missing/vacuum", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("unknown schema: expected 404, got %d", resp.Code)
+	}
+}
+
+func TestHandleRecordRowSoftDelete(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	if _, err := reg.Upsert("User", []byte("@schema:User\n@field ID uint64\n@field Name string\n"), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: reg, store: backend, softDelete: true}
+	doc, _, _, _ := reg.Snapshot("User")
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1), "Name": "Ada"},
+		{"ID": uint64(2), "Name": "Grace"},
+		{"ID": uint64(3), "Name": "Linus"},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := backend.Persist("User", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Accept", "application/json")
+		resp := httptest.NewRecorder()
+		srv.handleRecords(resp, req)
+		return resp
+	}
+	names := func(target string) []string {
+		t.Helper()
+		resp := do(http.MethodGet, target)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", target, resp.Code)
+		}
+		var rows []map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+			t.Fatalf("decode rows: %v", err)
+		}
+		var out []string
+		for _, row := range rows {
+			if _, ok := row["__deleted"]; ok {
+				t.Fatalf("tombstone leaked into row %v", row)
+			}
+			out = append(out, row["Name"].(string))
+		}
+		return out
+	}
+
+	if resp := do(http.MethodDelete, "/records/User/row/ID/2"); resp.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+	stored, err := backend.LoadPayload("User")
+	if err != nil || !bytes.Equal(stored, payload) {
+		t.Fatalf("soft delete rewrote the payload: %v", err)
+	}
+	if got := names("/records/User"); fmt.Sprint(got) != "[Ada Linus]" {
+		t.Fatalf("expected the deleted row hidden, got %v", got)
+	}
+	if resp := do(http.MethodGet, "/records/User/row/ID/2"); resp.Code != http.StatusNotFound {
+		t.Fatalf("GET deleted row: expected 404, got %d", resp.Code)
+	}
+	if resp := do(http.MethodDelete, "/records/User/row/ID/2"); resp.Code != http.StatusNotFound {
+		t.Fatalf("second DELETE: expected 404, got %d", resp.Code)
+	}
+
+	if got := names("/records/User?includeDeleted=true"); fmt.Sprint(got) != "[Ada Grace Linus]" {
+		t.Fatalf("expected includeDeleted to reveal the row, got %v", got)
+	}
+	resp := do(http.MethodGet, "/records/User/row/ID/2?includeDeleted=true")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("GET deleted row with override: expected 200, got %d", resp.Code)
+	}
+	var envelope struct {
+		Row     map[string]any `json:"row"`
+		Deleted bool           `json:"deleted"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	if !envelope.Deleted || envelope.Row["Name"] != "Grace" {
+		t.Fatalf("unexpected envelope %+v", envelope)
+	}
+
+	// The SCRT form hides the row too.
+	req := httptest.NewRequest(http.MethodGet, "/records/User", nil)
+	scrtResp := httptest.NewRecorder()
+	srv.handleRecords(scrtResp, req)
+	var rows []map[string]any
+	if err := scrt.Unmarshal(scrtResp.Body.Bytes(), sch, &rows); err != nil || len(rows) != 2 {
+		t.Fatalf("SCRT read: %d rows, err %v", len(rows), err)
+	}
+	// So do bundles, of the schema and of its document.
+	for _, target := range []string{"/bundle?schema=User", "/bundle?doc=User"} {
+		resp := httptest.NewRecorder()
+		srv.handleBundle(resp, httptest.NewRequest(http.MethodGet, target, nil))
+		bundle, err := decodeBundle(resp.Body.Bytes())
+		if err != nil {
+			t.Fatalf("%s: decode: %v", target, err)
+		}
+		var rows []map[string]any
+		if err := scrt.Unmarshal(bundle.entries[0].payload, sch, &rows); err != nil || len(rows) != 2 {
+			t.Fatalf("%s: %d rows, err %v", target, len(rows), err)
+		}
+	}
+
+	if resp := do(http.MethodPost, "/records/User/vacuum"); resp.Code != http.StatusOK {
+		t.Fatalf("vacuum: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if got := names("/records/User?includeDeleted=true"); fmt.Sprint(got) != "[Ada Linus]" {
+		t.Fatalf("expected vacuum to purge the row, got %v", got)
+	}
+	if tombstones, err := backend.Tombstones("User"); err != nil || len(tombstones) != 0 {
+		t.Fatalf("expected vacuum to clear tombstones, got %v, %v", tombstones, err)
+	}
+
+	// An upsert that rewrites a deleted row in place brings it back.
+	if resp := do(http.MethodDelete, "/records/User/row/ID/3"); resp.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: expected 204, got %d: %s", resp.Code, resp.Body.String())
+	}
+	update, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(3), "Name": "Linus T"}})
+	if err != nil {
+		t.Fatalf("marshal update: %v", err)
+	}
+	upsertResp := httptest.NewRecorder()
+	srv.handleRecords(upsertResp, httptest.NewRequest(http.MethodPost, "/records/User?mode=upsert&key=ID", bytes.NewReader(update)))
+	if upsertResp.Code != http.StatusNoContent {
+		t.Fatalf("upsert: expected 204, got %d: %s", upsertResp.Code, upsertResp.Body.String())
+	}
+	if got := names("/records/User"); fmt.Sprint(got) != "[Ada Linus T]" {
+		t.Fatalf("expected the upserted row visible, got %v", got)
+	}
+}
+
+func TestUpsertPayloadTimestampTZKey(t *testing.T) {
+	t.Parallel()
+	doc, err := schema.Parse(strings.NewReader("@schema:Reading\n@field At timestamptz\n@field Value int64\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("Reading")
+	at := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	existing, err := scrt.Marshal(sch, []map[string]any{{"At": at, "Value": int64(1)}})
+	if err != nil {
+		t.Fatalf("marshal existing: %v", err)
+	}
+	// The same instant, written with a +02:00 offset.
+	incoming, err := scrt.Marshal(sch, []map[string]any{{"At": at.In(time.FixedZone("", 2*3600)), "Value": int64(2)}})
+	if err != nil {
+		t.Fatalf("marshal incoming: %v", err)
+	}
+	merged, _, err := upsertPayload(existing, incoming, sch, 0)
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	var rows []map[string]any
+	if err := scrt.Unmarshal(merged, sch, &rows); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["Value"] != int64(2) {
+		t.Fatalf("expected the row to be replaced, got %v", rows)
+	}
+}
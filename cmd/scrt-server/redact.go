@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+// revealHeader carries the -reveal-token secret that lets a client read
+// sensitive fields in JSON responses.
+const revealHeader = "X-SCRT-Reveal-Token"
+
+// sensitiveMask replaces the value of a masked sensitive field.
+const sensitiveMask = "***"
+
+// redactMode says how JSON responses treat fields marked sensitive. The
+// SCRT binary responses always carry them unchanged.
+type redactMode int
+
+const (
+	redactMask redactMode = iota // replace the value with sensitiveMask
+	redactOmit                   // leave the field out
+	redactOff                    // return the value
+)
+
+func parseRedactMode(raw string) (redactMode, error) {
+	switch raw {
+	case "mask":
+		return redactMask, nil
+	case "omit":
+		return redactOmit, nil
+	case "off":
+		return redactOff, nil
+	default:
+		return 0, fmt.Errorf("unknown sensitive mode %q (want mask, omit, or off)", raw)
+	}
+}
+
+// redactionFor picks the mode for r. A request presenting the configured
+// reveal token sees sensitive values; everyone else gets the server mode.
+func (s *server) redactionFor(r *http.Request) redactMode {
+	if s.revealToken != "" {
+		token := r.Header.Get(revealHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.revealToken)) == 1 {
+			return redactOff
+		}
+	}
+	return s.sensitiveMode
+}
+
+// redactRow masks or drops the sensitive fields of a rowToMap result in
+// place and returns it. Computed fields that read a sensitive field are
+// treated as sensitive too.
+func redactRow(row map[string]any, sch *schema.Schema, mode redactMode) map[string]any {
+	if mode == redactOff || row == nil {
+		return row
+	}
+	redact := func(name string) {
+		if _, ok := row[name]; !ok {
+			return
+		}
+		if mode == redactOmit {
+			delete(row, name)
+		} else {
+			row[name] = sensitiveMask
+		}
+	}
+	for _, field := range sch.Fields {
+		if field.Sensitive {
+			redact(field.Name)
+		}
+	}
+	for _, c := range sch.Computed {
+		for _, idx := range c.Inputs() {
+			if sch.Fields[idx].Sensitive {
+				redact(c.Name)
+				break
+			}
+		}
+	}
+	return row
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	scrt "github.com/oarkflow/scrt"
 	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/storage"
 )
 
 func TestHandleSchemasPostInferredName(t *testing.T) {
@@ -51,3 +57,408 @@ func TestHandleSchemasPostInferredName(t *testing.T) {
 		t.Fatalf("schema list missing entry, body=%q", listResp.Body.String())
 	}
 }
+
+func TestHandleSchemasIndexMetadata(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const dsl = `@schema:User
+@doc "Registered accounts"
+@meta owner=identity
+@meta pii=email
+@field ID uint64
+@field Email string
+`
+	if _, err := reg.Upsert("User", []byte(dsl), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	if _, err := reg.Upsert("Plain", []byte("@schema:Plain\n@field ID uint64\n"), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	srv := &server{registry: reg}
+
+	req := httptest.NewRequest(http.MethodGet, "/schemas", nil)
+	req.Header.Set("Accept", "application/json")
+	resp := httptest.NewRecorder()
+	srv.handleSchemas(resp, req)
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON index, got %d %q", resp.Code, resp.Header().Get("Content-Type"))
+	}
+	var summaries []schema.DocumentSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summaries); err != nil {
+		t.Fatalf("decode index: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].Name != "Plain" || summaries[1].Name != "User" {
+		t.Fatalf("unexpected index %+v", summaries)
+	}
+	if summaries[0].Metadata != nil {
+		t.Fatalf("schema without @meta should omit metadata, got %v", summaries[0].Metadata)
+	}
+	if got := summaries[1].Metadata["User"]; got["owner"] != "identity" || got["pii"] != "email" {
+		t.Fatalf("metadata not surfaced: %v", summaries[1].Metadata)
+	}
+	if summaries[0].Docs != nil || summaries[1].Docs["User"] != "Registered accounts" {
+		t.Fatalf("docs not surfaced: %v / %v", summaries[0].Docs, summaries[1].Docs)
+	}
+
+	plain := httptest.NewRecorder()
+	srv.handleSchemas(plain, httptest.NewRequest(http.MethodGet, "/schemas", nil))
+	if plain.Body.String() != "Plain\nUser\n" {
+		t.Fatalf("text index changed: %q", plain.Body.String())
+	}
+
+	cors := httptest.NewRecorder()
+	corsReq := httptest.NewRequest(http.MethodGet, "/schemas", nil)
+	corsReq.Header.Set("Origin", "https://app.example")
+	allowCORS([]string{"https://app.example"}, http.HandlerFunc(srv.handleSchemas)).ServeHTTP(cors, corsReq)
+	if vary := cors.Header().Values("Vary"); !slices.Contains(vary, "Origin") || !slices.Contains(vary, "Accept") {
+		t.Fatalf("expected Vary to list Origin and Accept, got %q", vary)
+	}
+}
+
+func TestHandleSchemaJSONSchema(t *testing.T) {
+	t.Parallel()
+	reg := schema.NewDocumentRegistry()
+	const dsl = `@schema:Ticket
+@field ID uint64 serial
+@field Title string required
+@field Status string enum=open|closed
+`
+	if _, err := reg.Upsert("Ticket", []byte(dsl), "test", time.Now().UTC()); err != nil {
+		t.Fatalf("upsert schema: %v", err)
+	}
+	srv := &server{registry: reg}
+	resp := httptest.NewRecorder()
+	srv.handleSchema(resp, httptest.NewRequest(http.MethodGet, "/schemas/Ticket/jsonschema", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if ct := resp.Header().Get("Content-Type"); ct != "application/schema+json" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	var got struct {
+		Title      string                    `json:"title"`
+		Properties map[string]map[string]any `json:"properties"`
+		Required   []string                  `json:"required"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Title != "Ticket" || len(got.Properties) != 3 || len(got.Required) != 1 || got.Required[0] != "Title" {
+		t.Fatalf("unexpected JSON Schema: %+v", got)
+	}
+	if enum, _ := got.Properties["Status"]["enum"].([]any); len(enum) != 2 || enum[0] != "open" {
+		t.Fatalf("unexpected Status enum: %v", got.Properties["Status"])
+	}
+
+	etag := resp.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/schemas/Ticket/jsonschema", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp = httptest.NewRecorder()
+	srv.handleSchema(resp, req)
+	if resp.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for matching ETag %q, got %d", etag, resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	srv.handleSchema(resp, httptest.NewRequest(http.MethodGet, "/schemas/Missing/jsonschema", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown schema, got %d", resp.Code)
+	}
+}
+
+func TestHandleSchemasRejectsInvalidAttributes(t *testing.T) {
+	t.Parallel()
+	srv := &server{registry: schema.NewDocumentRegistry()}
+	const dsl = `@schema:Widget
+@field ID uint64 auto_increment
+@field Label string auto_increment
+`
+	req := httptest.NewRequest(http.MethodPost, "/schemas", strings.NewReader(dsl))
+	resp := httptest.NewRecorder()
+	srv.handleSchemas(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), "field Label") {
+		t.Fatalf("expected error to name field Label, body=%q", resp.Body.String())
+	}
+}
+
+func TestBootstrapSchemasGzip(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writeGzip := func(name, dsl string) {
+		t.Helper()
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := gzip.NewWriter(f)
+		zw.Write([]byte(dsl))
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	writeGzip("Widget.scrt.gz", "@schema:Widget\n@field ID uint64\n@field Label string\n")
+	// A plain .scrt beside a .scrt.gz is what the server last saved.
+	writeGzip("Gadget.scrt.gz", "@schema:Gadget\n@field ID uint64\n")
+	if err := os.WriteFile(filepath.Join(dir, "Gadget.scrt"), []byte("@schema:Gadget\n@field ID uint64\n@field Name string\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv := &server{registry: schema.NewDocumentRegistry(), schemaDir: dir}
+	if err := srv.bootstrapSchemas(); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	doc, _, _, err := srv.registry.Snapshot("Widget")
+	if err != nil {
+		t.Fatalf("Widget not loaded: %v", err)
+	}
+	if sch, _ := doc.Schema("Widget"); len(sch.Fields) != 2 {
+		t.Fatalf("unexpected Widget fields %+v", sch.Fields)
+	}
+	doc, _, _, err = srv.registry.Snapshot("Gadget")
+	if err != nil {
+		t.Fatalf("Gadget not loaded: %v", err)
+	}
+	if sch, _ := doc.Schema("Gadget"); len(sch.Fields) != 2 {
+		t.Fatalf("Gadget should come from the plain file, got %+v", sch.Fields)
+	}
+
+	if err := srv.removeSchemaFile("Widget"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Widget.scrt.gz")); !os.IsNotExist(err) {
+		t.Fatalf("Widget.scrt.gz left behind: %v", err)
+	}
+}
+
+func TestHandleSchemaVersionsAndRollback(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	srv := &server{registry: schema.NewDocumentRegistry(), schemaDir: dir}
+	v1 := "@schema:Widget\n@field ID uint64\n"
+	v2 := "@schema:Widget\n@field ID uint64\n@field Label string\n"
+	for _, dsl := range []string{v1, v2} {
+		resp := httptest.NewRecorder()
+		srv.handleSchema(resp, httptest.NewRequest(http.MethodPost, "/schemas/Widget", strings.NewReader(dsl)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("upsert: expected 201, got %d", resp.Code)
+		}
+	}
+
+	resp := httptest.NewRecorder()
+	srv.handleSchema(resp, httptest.NewRequest(http.MethodGet, "/schemas/Widget/versions", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("versions: expected 200, got %d", resp.Code)
+	}
+	var versions []schema.DocumentVersion
+	if err := json.NewDecoder(resp.Body).Decode(&versions); err != nil {
+		t.Fatalf("decode versions: %v", err)
+	}
+	if len(versions) != 2 || versions[1].DSL != v1 {
+		t.Fatalf("unexpected versions %+v", versions)
+	}
+
+	resp = httptest.NewRecorder()
+	srv.handleSchema(resp, httptest.NewRequest(http.MethodPost, "/schemas/Widget/rollback?fingerprint="+versions[1].Fingerprint, nil))
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("rollback: expected 204, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	onDisk, err := os.ReadFile(filepath.Join(dir, "Widget.scrt"))
+	if err != nil || string(onDisk) != v1 {
+		t.Fatalf("schema file not restored: %q (%v)", onDisk, err)
+	}
+
+	resp = httptest.NewRecorder()
+	srv.handleSchema(resp, httptest.NewRequest(http.MethodPost, "/schemas/Widget/rollback?fingerprint=ffffffffffffffff", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("unknown version: expected 404, got %d", resp.Code)
+	}
+}
+
+func TestHandleSchemaUpsertStoredRecords(t *testing.T) {
+	t.Parallel()
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: schema.NewDocumentRegistry(), store: backend}
+	post := func(target, dsl string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		srv.handleSchema(resp, httptest.NewRequest(http.MethodPost, target, strings.NewReader(dsl)))
+		return resp
+	}
+	if resp := post("/schemas/Widget", "@schema:Widget\n@field ID uint64\n@field Label string\n"); resp.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d", resp.Code)
+	}
+	doc, _, _, _ := srv.registry.Snapshot("Widget")
+	sch, _ := doc.Schema("Widget")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Label": "a"}, {"ID": uint64(2), "Label": "b"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := backend.Persist("Widget", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	stored := func() []map[string]any {
+		t.Helper()
+		doc, _, _, _ := srv.registry.Snapshot("Widget")
+		sch, _ := doc.Schema("Widget")
+		data, err := backend.LoadPayload("Widget")
+		if err != nil {
+			t.Fatalf("load payload: %v", err)
+		}
+		var rows []map[string]any
+		if err := scrt.Unmarshal(data, sch, &rows); err != nil {
+			t.Fatalf("stored records unreadable under the current schema: %v", err)
+		}
+		return rows
+	}
+
+	// A new field with a default is compatible: the records are migrated.
+	if resp := post("/schemas/Widget", "@schema:Widget\n@field ID uint64\n@field Label string\n@field Color string default=\"red\"\n"); resp.Code != http.StatusCreated {
+		t.Fatalf("compatible edit: expected 201, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	if rows := stored(); len(rows) != 2 || rows[1]["Label"] != "b" || rows[1]["Color"] != "red" {
+		t.Fatalf("migrated rows = %v", rows)
+	}
+
+	// Dropping a stored field is refused and leaves schema and records alone.
+	narrowed := "@schema:Widget\n@field ID uint64\n@field Color string default=\"red\"\n"
+	resp := post("/schemas/Widget", narrowed)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("incompatible edit: expected 409, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	if rows := stored(); len(rows) != 2 || rows[0]["Label"] != "a" {
+		t.Fatalf("rows after refused edit = %v", rows)
+	}
+	// So is the same edit inside a document declaring more than one schema.
+	multi := httptest.NewRecorder()
+	srv.handleSchemas(multi, httptest.NewRequest(http.MethodPost, "/schemas", strings.NewReader(narrowed+"@schema:Gadget\n@field ID uint64\n")))
+	if multi.Code != http.StatusConflict {
+		t.Fatalf("incompatible edit in a multi-schema document: expected 409, got %d (%s)", multi.Code, multi.Body.String())
+	}
+
+	// A listed rename makes the same kind of edit compatible.
+	if resp := post("/schemas/Widget?rename=Label:Title", "@schema:Widget\n@field ID uint64\n@field Title string\n@field Color string default=\"red\"\n"); resp.Code != http.StatusCreated {
+		t.Fatalf("rename: expected 201, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	if rows := stored(); len(rows) != 2 || rows[0]["Title"] != "a" {
+		t.Fatalf("renamed rows = %v", rows)
+	}
+
+	// Only drop accepts the edit, by deleting the records it cannot carry.
+	if resp := post("/schemas/Widget?force=true", narrowed); resp.Code != http.StatusConflict {
+		t.Fatalf("force without drop: expected 409, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	if rows := stored(); len(rows) != 2 {
+		t.Fatalf("refused edit lost stored rows: %v", rows)
+	}
+	if resp := post("/schemas/Widget?drop=true", narrowed); resp.Code != http.StatusCreated {
+		t.Fatalf("dropping edit: expected 201, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	if _, err := backend.LoadPayload("Widget"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("dropping edit kept the stored records: %v", err)
+	}
+}
+
+// failingPersistBackend fails every Persist once fail is set, as a full
+// disk would.
+type failingPersistBackend struct {
+	*storage.SnapshotBackend
+	fail bool
+}
+
+func (b *failingPersistBackend) Persist(schemaName string, sch *schema.Schema, payload []byte, opts storage.PersistOptions) (*storage.SnapshotMeta, error) {
+	if b.fail {
+		return nil, errors.New("disk full")
+	}
+	return b.SnapshotBackend.Persist(schemaName, sch, payload, opts)
+}
+
+func TestHandleSchemaUpsertPersistFailure(t *testing.T) {
+	t.Parallel()
+	snapshots, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	backend := &failingPersistBackend{SnapshotBackend: snapshots}
+	srv := &server{registry: schema.NewDocumentRegistry(), store: backend}
+	post := func(dsl string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		srv.handleSchema(resp, httptest.NewRequest(http.MethodPost, "/schemas/Widget", strings.NewReader(dsl)))
+		return resp
+	}
+	if resp := post("@schema:Widget\n@field ID uint64\n"); resp.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d", resp.Code)
+	}
+	doc, _, _, _ := srv.registry.Snapshot("Widget")
+	sch, _ := doc.Schema("Widget")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1)}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := backend.Persist("Widget", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	// The migrated records cannot be written: the server is at fault and
+	// the registry keeps the version the stored records belong to.
+	backend.fail = true
+	if resp := post("@schema:Widget\n@field ID uint64\n@field Label string\n"); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("failed persist: expected 500, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	if current, _, _, _ := srv.registry.Snapshot("Widget"); current != doc {
+		t.Fatalf("failed persist changed the schema")
+	}
+	if meta, err := backend.LoadMeta("Widget"); err != nil || meta.Fingerprint != sch.Fingerprint() {
+		t.Fatalf("stored records moved off the current schema: %v", err)
+	}
+}
+
+func TestHandleSchemaRollbackStoredRecords(t *testing.T) {
+	t.Parallel()
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage backend: %v", err)
+	}
+	srv := &server{registry: schema.NewDocumentRegistry(), store: backend}
+	for _, dsl := range []string{"@schema:Widget\n@field ID uint64\n", "@schema:Widget\n@field ID uint64\n@field Label string\n"} {
+		resp := httptest.NewRecorder()
+		srv.handleSchema(resp, httptest.NewRequest(http.MethodPost, "/schemas/Widget", strings.NewReader(dsl)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("upsert: expected 201, got %d", resp.Code)
+		}
+	}
+	doc, _, _, _ := srv.registry.Snapshot("Widget")
+	sch, _ := doc.Schema("Widget")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Label": "a"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := backend.Persist("Widget", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	first := srv.registry.History("Widget")[1].Fingerprint
+	rollback := func(query string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		srv.handleSchema(resp, httptest.NewRequest(http.MethodPost, "/schemas/Widget/rollback?fingerprint="+first+query, nil))
+		return resp
+	}
+
+	// Rolling back to a version without Label would drop stored values.
+	if resp := rollback(""); resp.Code != http.StatusConflict {
+		t.Fatalf("incompatible rollback: expected 409, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	if current, _, _, _ := srv.registry.Snapshot("Widget"); current != doc {
+		t.Fatalf("refused rollback changed the schema")
+	}
+
+	if resp := rollback("&drop=true"); resp.Code != http.StatusNoContent {
+		t.Fatalf("dropping rollback: expected 204, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	if _, err := backend.LoadPayload("Widget"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("dropping rollback kept the stored records: %v", err)
+	}
+}
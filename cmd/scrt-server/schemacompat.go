@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// errSchemaIncompatible reports a schema edit the stored records of the
+// schema cannot be carried over to.
+var errSchemaIncompatible = errors.New("schema change is incompatible with the stored records")
+
+// errStoredRecords reports a schema switch that failed because the stored
+// records could not be rewritten, a server fault rather than a bad request.
+var errStoredRecords = errors.New("stored records could not be updated")
+
+// schemaUpsert holds the query options of a schema upload.
+type schemaUpsert struct {
+	// drop accepts an incompatible edit by deleting the stored records,
+	// as given by ?drop=true. Nothing else deletes them.
+	drop bool
+	// renames maps old field names to new ones for the migration, as given
+	// by ?rename=Old:New.
+	renames map[string]string
+}
+
+// schemaUpsertFromRequest reads ?drop and the repeatable ?rename.
+func schemaUpsertFromRequest(r *http.Request) (schemaUpsert, error) {
+	var opts schemaUpsert
+	query := r.URL.Query()
+	if raw := query.Get("drop"); raw != "" {
+		drop, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, fmt.Errorf("invalid drop value %q", raw)
+		}
+		opts.drop = drop
+	}
+	for _, pair := range query["rename"] {
+		from, to, ok := strings.Cut(pair, ":")
+		if !ok || from == "" || to == "" {
+			return opts, fmt.Errorf("invalid rename %q; want Old:New", pair)
+		}
+		if opts.renames == nil {
+			opts.renames = make(map[string]string)
+		}
+		opts.renames[from] = to
+	}
+	return opts, nil
+}
+
+// storedMigration is what a schema switch does to the stored records of
+// one schema.
+type storedMigration struct {
+	name string
+	// prev and payload are the schema and records stored before the switch,
+	// kept to restore them when the switch fails.
+	prev    *schema.Schema
+	payload []byte
+	// next and migrated are the records re-encoded for the new version, or
+	// nil migrated when the records are to be deleted.
+	next     *schema.Schema
+	migrated []byte
+}
+
+// migrateStoredRecords re-encodes the stored payload of schemaName under next
+// with scrt.MigrateRename, so an edit that keeps every stored field (added
+// fields, reordered fields, renames listed in opts) leaves the records
+// readable. It returns nil when nothing is stored or the fingerprint is
+// unchanged. An edit that would drop or retype stored data fails with
+// errSchemaIncompatible unless opts.drop is set; the migration then has a
+// nil migrated payload and the stored records must be deleted.
+func (s *server) migrateStoredRecords(schemaName string, next *schema.Schema, opts schemaUpsert) (*storedMigration, error) {
+	if s.store == nil {
+		return nil, nil
+	}
+	meta, err := s.store.LoadMeta(schemaName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if meta.Fingerprint == next.Fingerprint() {
+		return nil, nil
+	}
+	mig := &storedMigration{name: schemaName, next: next}
+	incompatible := func(reason error) (*storedMigration, error) {
+		if opts.drop {
+			return mig, nil
+		}
+		return nil, fmt.Errorf("%w: %v; retry with ?drop=true to delete the stored records", errSchemaIncompatible, reason)
+	}
+	if doc, _, _, snapErr := s.registry.Snapshot(schemaName); snapErr == nil {
+		mig.prev, _ = doc.Schema(schemaName)
+	}
+	if mig.prev == nil || mig.prev.Fingerprint() != meta.Fingerprint {
+		return incompatible(fmt.Errorf("records of %s were stored under schema fingerprint %016x, which is not its current version", schemaName, meta.Fingerprint))
+	}
+	if mig.payload, err = s.store.LoadPayload(schemaName); err != nil {
+		return nil, err
+	}
+	mig.migrated, err = scrt.MigrateRename(mig.prev, next, opts.renames, mig.payload)
+	if err != nil {
+		return incompatible(err)
+	}
+	return mig, nil
+}
+
+// restoreStoredRecords persists the records migrations replaced again under
+// their previous schema, after a schema switch failed past persisting them.
+func (s *server) restoreStoredRecords(migrations []*storedMigration) error {
+	var errs []error
+	for _, mig := range migrations {
+		if mig.migrated == nil {
+			continue
+		}
+		if err := s.persist(mig.name, mig.prev, mig.payload); err != nil {
+			errs = append(errs, fmt.Errorf("restore stored records of %s: %w", mig.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseUpsertSchemas returns the schemas raw declares, or nil when it does
+// not parse; the registry reports those errors.
+func parseUpsertSchemas(raw []byte) []*schema.Schema {
+	doc, err := schema.Parse(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	out := make([]*schema.Schema, 0, len(doc.Schemas))
+	for _, sch := range doc.Schemas {
+		out = append(out, sch)
+	}
+	return out
+}
+
+// schemaUpsertStatus maps an upsertSchemaBody error to a status: 409 for an
+// incompatible edit, 500 when the stored records could not be rewritten,
+// and 400 for anything else.
+func schemaUpsertStatus(err error) int {
+	switch {
+	case errors.Is(err, errSchemaIncompatible):
+		return http.StatusConflict
+	case errors.Is(err, errStoredRecords):
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// hiddenRows returns the soft-deleted row IDs of schemaName that reads of r
+// should leave out: none when r asks for ?includeDeleted=true. ok is false
+// once an error response has been written.
+func (s *server) hiddenRows(w http.ResponseWriter, r *http.Request, schemaName string) (hidden map[uint64]struct{}, ok bool) {
+	if raw := r.URL.Query().Get("includeDeleted"); raw != "" {
+		include, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid includeDeleted value %q", raw), http.StatusBadRequest)
+			return nil, false
+		}
+		if include {
+			return nil, true
+		}
+	}
+	tombstones, err := s.store.Tombstones(schemaName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return rowSet(tombstones), true
+}
+
+// rowSet returns ids as a set, or nil when there are none.
+func rowSet(ids []uint64) map[uint64]struct{} {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := make(map[uint64]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+// removeTombstone renumbers the tombstones of schemaName after rowID was
+// physically removed from the payload, so they keep naming the same rows.
+func (s *server) removeTombstone(schemaName string, rowID uint64) error {
+	tombstones, err := s.store.Tombstones(schemaName)
+	if err != nil || len(tombstones) == 0 {
+		return err
+	}
+	shifted := tombstones[:0]
+	for _, id := range tombstones {
+		switch {
+		case id < rowID:
+			shifted = append(shifted, id)
+		case id > rowID:
+			shifted = append(shifted, id-1)
+		}
+	}
+	return s.store.SetTombstones(schemaName, shifted)
+}
+
+// withoutRows re-encodes payload without the rows in hidden.
+func withoutRows(payload []byte, sch *schema.Schema, hidden map[uint64]struct{}) ([]byte, error) {
+	reader := codec.NewReader(bytes.NewReader(payload), sch)
+	var buf bytes.Buffer
+	writer := codec.NewWriter(&buf, sch, 0)
+	row := codec.NewRow(sch)
+	for rowID := uint64(0); ; rowID++ {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if _, skip := hidden[rowID]; skip {
+			continue
+		}
+		if err := writer.WriteRow(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+// fileStamp identifies one version of a schema file by what stat reports.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// schemaWatcher polls the schema directory and reloads edited schema files
+// into the registry. A file is reloaded once its stamp has held still for a
+// whole poll interval, so an editor's burst of writes causes one reload.
+type schemaWatcher struct {
+	srv      *server
+	interval time.Duration
+	loaded   map[string]fileStamp // stamp of each file as last loaded
+	pending  map[string]fileStamp // changed stamps waiting to settle
+}
+
+// newSchemaWatcher returns a watcher that takes the files already in the
+// schema directory as loaded, as bootstrapSchemas left them.
+func newSchemaWatcher(srv *server, interval time.Duration) *schemaWatcher {
+	w := &schemaWatcher{
+		srv:      srv,
+		interval: interval,
+		loaded:   make(map[string]fileStamp),
+		pending:  make(map[string]fileStamp),
+	}
+	for path, stamp := range w.scan() {
+		w.loaded[path] = stamp
+	}
+	return w
+}
+
+// run polls until ctx is done.
+func (w *schemaWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// poll reloads the files whose stamp changed and then held still since the
+// previous poll.
+func (w *schemaWatcher) poll() {
+	current := w.scan()
+	for path, stamp := range current {
+		switch {
+		case w.loaded[path] == stamp:
+			delete(w.pending, path)
+		case w.pending[path] == stamp:
+			delete(w.pending, path)
+			w.loaded[path] = stamp
+			w.reload(path, stamp)
+		default:
+			w.pending[path] = stamp
+		}
+	}
+	for path := range w.loaded {
+		if _, ok := current[path]; !ok {
+			// A removed file leaves its schema registered.
+			delete(w.loaded, path)
+			delete(w.pending, path)
+		}
+	}
+}
+
+// scan stats the schema files of the directory, skipping a .scrt.gz that
+// has a plain .scrt beside it as bootstrapSchemas does.
+func (w *schemaWatcher) scan() map[string]fileStamp {
+	dir := w.srv.schemaDir
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("schema watch: read %s: %v", dir, err)
+		}
+		return nil
+	}
+	stamps := make(map[string]fileStamp, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name, ok := schemaFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(filepath.Ext(entry.Name()), ".gz") {
+			if _, err := os.Stat(filepath.Join(dir, name+".scrt")); err == nil {
+				continue
+			}
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		stamps[filepath.Join(dir, entry.Name())] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps
+}
+
+// reload installs the schema in path unless its fingerprint matches the
+// registered version. Invalid edits are logged and the registered version
+// stays current.
+func (w *schemaWatcher) reload(path string, stamp fileStamp) {
+	name, _ := schemaFileName(filepath.Base(path))
+	data, err := schema.ReadFile(path)
+	if err != nil {
+		log.Printf("schema watch: read %s: %v", path, err)
+		return
+	}
+	// A file that does not parse to one schema falls through to
+	// installSchema, which reports why.
+	if next := parseUpsertSchemas(data); len(next) == 1 {
+		if doc, _, _, err := w.srv.registry.Snapshot(next[0].Name); err == nil {
+			if current, ok := doc.Schema(next[0].Name); ok && current.Fingerprint() == next[0].Fingerprint() {
+				return
+			}
+		}
+	}
+	if _, err := w.srv.installSchema(name, data, path, stamp.modTime, schemaUpsert{}); err != nil {
+		log.Printf("schema watch: reject %s: %v", path, err)
+		return
+	}
+	log.Printf("Reloaded schema %s from %s", name, path)
+}
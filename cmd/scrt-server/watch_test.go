@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+func TestSchemaWatcherReloadsEditedFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Widget.scrt")
+	stamp := time.Now().Add(-time.Hour)
+	write := func(dsl string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(dsl), 0o644); err != nil {
+			t.Fatalf("write schema: %v", err)
+		}
+		// Distinct mtimes regardless of the filesystem's timestamp resolution.
+		stamp = stamp.Add(time.Second)
+		if err := os.Chtimes(path, stamp, stamp); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+	write("@schema:Widget\n@field ID uint64\n")
+	srv := &server{registry: schema.NewDocumentRegistry(), schemaDir: dir}
+	if err := srv.bootstrapSchemas(); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	watcher := newSchemaWatcher(srv, time.Second)
+	fields := func() int {
+		t.Helper()
+		doc, _, _, err := srv.registry.Snapshot("Widget")
+		if err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		sch, _ := doc.Schema("Widget")
+		return len(sch.Fields)
+	}
+
+	write("@schema:Widget\n@field ID uint64\n@field Label string\n")
+	watcher.poll()
+	if fields() != 1 {
+		t.Fatalf("reloaded before the edit settled")
+	}
+	watcher.poll()
+	if fields() != 2 {
+		t.Fatalf("edited schema not reloaded: %d fields", fields())
+	}
+
+	// A rewrite with the same fingerprint adds no version.
+	versions := len(srv.registry.History("Widget"))
+	write("# relabelled\n@schema:Widget\n@field ID uint64\n@field Label string\n")
+	watcher.poll()
+	watcher.poll()
+	if got := len(srv.registry.History("Widget")); got != versions {
+		t.Fatalf("unchanged fingerprint was reloaded: %d versions, want %d", got, versions)
+	}
+
+	// An invalid edit is rejected and the loaded version stays current.
+	write("@schema:Widget\n@field ID nosuchtype\n")
+	watcher.poll()
+	watcher.poll()
+	if fields() != 2 {
+		t.Fatalf("invalid edit replaced the schema: %d fields", fields())
+	}
+}
@@ -0,0 +1,163 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+// AggOp selects the fold applied by Aggregate.
+type AggOp uint8
+
+const (
+	// AggCount counts rows where the field is set.
+	AggCount AggOp = iota
+	// AggSum adds the set values.
+	AggSum
+	// AggAvg is AggSum divided by AggCount.
+	AggAvg
+	// AggMin is the smallest set value.
+	AggMin
+	// AggMax is the largest set value.
+	AggMax
+)
+
+// String returns the lower-case operation name.
+func (op AggOp) String() string {
+	switch op {
+	case AggCount:
+		return "count"
+	case AggSum:
+		return "sum"
+	case AggAvg:
+		return "avg"
+	case AggMin:
+		return "min"
+	case AggMax:
+		return "max"
+	default:
+		return fmt.Sprintf("AggOp(%d)", uint8(op))
+	}
+}
+
+// Aggregate folds one column of the stream in src without materializing
+// rows: only field is decoded, other columns are stepped over as with
+// Options.Projection. Unset values are skipped; defaults fill omitted values
+// as they do for ReadRow.
+//
+// AggCount accepts any field. The other operations need a uint64, ref,
+// int64, float64, or int64-backed temporal field (date, datetime, timestamp,
+// duration, time), whose stored integer form is folded. Integer sums are computed
+// exactly and fail on overflow; the result is converted to float64 at the
+// end, so totals beyond 2^53 round. With no set values, AggCount and AggSum
+// return 0 while AggAvg, AggMin, and AggMax return NaN.
+func Aggregate(src io.Reader, s *schema.Schema, field string, op AggOp) (float64, error) {
+	idx, ok := s.FieldIndex(field)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownField, field)
+	}
+	kind := s.Fields[idx].ValueKind()
+	if op > AggMax {
+		return 0, fmt.Errorf("codec: unsupported aggregate %s", op)
+	}
+	if op != AggCount && !aggregatableKind(kind) {
+		return 0, fmt.Errorf("codec: cannot %s field %s of type %s", op, field, s.Fields[idx].RawType)
+	}
+
+	var (
+		count    uint64
+		uintSum  uint64
+		intSum   int64
+		floatSum float64
+		min, max float64
+	)
+	reader := NewReaderWithOptions(src, s, Options{Projection: []string{field}})
+	row := NewRow(s)
+	for {
+		ok, err := reader.ReadRow(row)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		val := row.values[idx]
+		if !val.Set {
+			continue
+		}
+		var v float64
+		switch kind {
+		case schema.KindUint64, schema.KindRef:
+			if op == AggSum || op == AggAvg {
+				var carry uint64
+				if uintSum, carry = bits.Add64(uintSum, val.Uint, 0); carry != 0 {
+					return 0, fmt.Errorf("codec: %s of field %s overflows uint64", op, field)
+				}
+			}
+			v = float64(val.Uint)
+		case schema.KindFloat64:
+			floatSum += val.Float
+			v = val.Float
+		default:
+			if op == AggSum || op == AggAvg {
+				next := intSum + val.Int
+				if (val.Int > 0 && next < intSum) || (val.Int < 0 && next > intSum) {
+					return 0, fmt.Errorf("codec: %s of field %s overflows int64", op, field)
+				}
+				intSum = next
+			}
+			v = float64(val.Int)
+		}
+		if count == 0 || v < min {
+			min = v
+		}
+		if count == 0 || v > max {
+			max = v
+		}
+		count++
+	}
+
+	var sum float64
+	switch kind {
+	case schema.KindUint64, schema.KindRef:
+		sum = float64(uintSum)
+	case schema.KindFloat64:
+		sum = floatSum
+	default:
+		sum = float64(intSum)
+	}
+	switch op {
+	case AggCount:
+		return float64(count), nil
+	case AggSum:
+		return sum, nil
+	}
+	if count == 0 {
+		return math.NaN(), nil
+	}
+	switch op {
+	case AggAvg:
+		return sum / float64(count), nil
+	case AggMin:
+		return min, nil
+	default:
+		return max, nil
+	}
+}
+
+func aggregatableKind(kind schema.FieldKind) bool {
+	switch kind {
+	case schema.KindUint64, schema.KindRef, schema.KindInt64, schema.KindFloat64,
+		schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
+		return true
+	default:
+		return false
+	}
+}
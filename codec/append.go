@@ -0,0 +1,103 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+// StreamInfo is what an SCRT stream header declares.
+type StreamInfo struct {
+	Version       int
+	Fingerprint   uint64
+	PageChecksums bool
+	Footer        bool
+}
+
+// ReadStreamInfo validates the header at the start of data and reports it.
+func ReadStreamInfo(data []byte) (StreamInfo, error) {
+	if len(data) < headerSize {
+		return StreamInfo{}, io.ErrUnexpectedEOF
+	}
+	base, flags, fp, err := parseHeader(data[:headerSize])
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	return StreamInfo{
+		Version:       int(base),
+		Fingerprint:   fp,
+		PageChecksums: flags&flagPageChecksums != 0,
+		Footer:        flags&flagFooter != 0,
+	}, nil
+}
+
+// Rebind returns a copy of payload whose header carries the fingerprint of
+// s. It only rewrites the header: callers must know the pages already
+// encode the columns of s, for example because only defaults or metadata
+// changed between the schema that wrote payload and s.
+func Rebind(payload []byte, s *schema.Schema) ([]byte, error) {
+	if _, err := ReadStreamInfo(payload); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), payload...)
+	binary.LittleEndian.PutUint64(out[len(magic)+1:headerSize], s.Fingerprint())
+	return out, nil
+}
+
+// AppendPages returns existing followed by the pages of tail, leaving the
+// pages of existing untouched. Both streams must share version, schema
+// fingerprint, and page checksum setting. Any terminator in existing is
+// dropped so readers reach the new pages, and when existing carries a
+// footer it is verified and rebuilt over the combined pages. tail must be
+// written with WriterOptions.LocalDictionaries when the schema declares
+// encoding=global fields: its dictionaries would otherwise be read as
+// additions to the tables existing built.
+func AppendPages(existing, tail []byte) ([]byte, error) {
+	head, err := ReadStreamInfo(existing)
+	if err != nil {
+		return nil, err
+	}
+	next, err := ReadStreamInfo(tail)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case head.Fingerprint != next.Fingerprint:
+		return nil, ErrSchemaFingerprintMismatch
+	case head.Version != next.Version:
+		return nil, fmt.Errorf("codec: cannot append version %d pages to a version %d stream", next.Version, head.Version)
+	case head.PageChecksums != next.PageChecksums:
+		return nil, fmt.Errorf("codec: cannot append pages with mismatched checksum settings")
+	}
+	if head.Footer {
+		if existing, err = StripFooter(existing); err != nil {
+			return nil, err
+		}
+	}
+	if next.Footer {
+		if tail, err = StripFooter(tail); err != nil {
+			return nil, err
+		}
+	}
+	_, rows, end, err := scanPageRegion(existing, head.PageChecksums)
+	if err != nil {
+		return nil, err
+	}
+	_, tailRows, tailEnd, err := scanPageRegion(tail, next.PageChecksums)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, end+tailEnd-headerSize+1+footerSize)
+	out = append(out, existing[:end]...)
+	out = append(out, tail[headerSize:tailEnd]...)
+	if head.Footer {
+		return AppendFooter(out)
+	}
+	if rows+tailRows == 0 {
+		// Like Writer, keep the terminator only on streams without pages.
+		out = binary.AppendUvarint(out, 0)
+	}
+	return out, nil
+}
@@ -2,10 +2,22 @@ package codec_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+	"unsafe"
 
 	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/page"
 	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/temporal"
 )
 
 func buildTestSchema() *schema.Schema {
@@ -20,6 +32,19 @@ func buildTestSchema() *schema.Schema {
 	}
 }
 
+// buildGlobalStringSchema is buildTestSchema with the named string fields
+// declaring encoding=global.
+func buildGlobalStringSchema(fields ...string) *schema.Schema {
+	sch := buildTestSchema()
+	for i := range sch.Fields {
+		if slices.Contains(fields, sch.Fields[i].Name) {
+			sch.Fields[i].Encoding = schema.StringEncodingGlobal
+			sch.Fields[i].Attributes = append(sch.Fields[i].Attributes, "encoding=global")
+		}
+	}
+	return sch
+}
+
 func TestRoundTrip(t *testing.T) {
 	sch := buildTestSchema()
 	var buf bytes.Buffer
@@ -135,3 +160,927 @@ func TestDefaultValueOmitted(t *testing.T) {
 		t.Fatalf("expected default lang 'en', got %+v", vals[3])
 	}
 }
+
+func TestGlobalStringTableShrinksLowCardinality(t *testing.T) {
+	sch := buildGlobalStringSchema("Lang")
+	langs := []string{"en", "de", "fr", "es", "pt-BR", "zh-Hant"}
+	encode := func(opts codec.WriterOptions) []byte {
+		var buf bytes.Buffer
+		writer := codec.NewWriterWithOptions(&buf, sch, 16, opts)
+		row := codec.NewRow(sch)
+		for i := 0; i < 512; i++ {
+			row.Reset()
+			if err := row.SetUint("MsgID", uint64(i)); err != nil {
+				t.Fatal(err)
+			}
+			if err := row.SetUint("User", uint64(i%7)); err != nil {
+				t.Fatal(err)
+			}
+			if err := row.SetString("Lang", langs[i%len(langs)]); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.WriteRow(row); err != nil {
+				t.Fatalf("write row: %v", err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("close writer: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	perPage := encode(codec.WriterOptions{LocalDictionaries: true})
+	global := encode(codec.WriterOptions{})
+	if len(global) >= len(perPage) {
+		t.Fatalf("global dictionary payload %d bytes not smaller than per-page %d bytes", len(global), len(perPage))
+	}
+	t.Logf("per-page dictionary %d bytes, global dictionary %d bytes", len(perPage), len(global))
+
+	reader := codec.NewReader(bytes.NewReader(global), sch)
+	decoded := codec.NewRow(sch)
+	seen := make([]string, 0, 512)
+	for {
+		ok, err := reader.ReadRow(decoded)
+		if err != nil {
+			t.Fatalf("read row: %v", err)
+		}
+		if !ok {
+			break
+		}
+		vals := decoded.Values()
+		if vals[2].Set {
+			t.Fatalf("row %d: unexpected Text %+v", len(seen), vals[2])
+		}
+		seen = append(seen, vals[3].Str)
+	}
+	if len(seen) != 512 {
+		t.Fatalf("expected 512 rows, got %d", len(seen))
+	}
+	for i, lang := range seen {
+		if lang != langs[i%len(langs)] {
+			t.Fatalf("row %d: expected lang %q, got %q", i, langs[i%len(langs)], lang)
+		}
+	}
+}
+
+func TestRowTypedGetters(t *testing.T) {
+	sch := &schema.Schema{
+		Name: "Event",
+		Fields: []schema.Field{
+			{Name: "ID", Kind: schema.KindUint64, RawType: "uint64"},
+			{Name: "Title", Kind: schema.KindString, RawType: "string"},
+			{Name: "Delta", Kind: schema.KindInt64, RawType: "int64"},
+			{Name: "Score", Kind: schema.KindFloat64, RawType: "float64"},
+			{Name: "Active", Kind: schema.KindBool, RawType: "bool"},
+			{Name: "Day", Kind: schema.KindDate, RawType: "date"},
+			{Name: "At", Kind: schema.KindTimestamp, RawType: "timestamp"},
+			{Name: "Zoned", Kind: schema.KindTimestampTZ, RawType: "timestamptz"},
+			{Name: "Note", Kind: schema.KindString, RawType: "string"},
+		},
+	}
+	at := time.Date(2024, 3, 9, 14, 30, 0, 0, time.UTC)
+	day := time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)
+	zoned := time.Date(2024, 3, 9, 9, 30, 0, 0, time.FixedZone("EST", -5*3600))
+
+	row := codec.NewRow(sch)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(row.SetUint("ID", 7))
+	must(row.SetString("Title", "launch"))
+	must(row.SetInt("Delta", -3))
+	must(row.SetFloat("Score", 9.5))
+	must(row.SetBool("Active", true))
+	must(row.SetInt("Day", temporal.EncodeDate(day)))
+	must(row.SetInt("At", temporal.EncodeInstant(at)))
+	must(row.SetString("Zoned", temporal.FormatTimestampTZ(zoned)))
+
+	if v, ok := row.GetUint("ID"); !ok || v != 7 {
+		t.Fatalf("GetUint: %d %v", v, ok)
+	}
+	if v, ok := row.GetString("Title"); !ok || v != "launch" {
+		t.Fatalf("GetString: %q %v", v, ok)
+	}
+	if v, ok := row.GetInt("Delta"); !ok || v != -3 {
+		t.Fatalf("GetInt: %d %v", v, ok)
+	}
+	if v, ok := row.GetFloat("Score"); !ok || v != 9.5 {
+		t.Fatalf("GetFloat: %v %v", v, ok)
+	}
+	if v, ok := row.GetBool("Active"); !ok || !v {
+		t.Fatalf("GetBool: %v %v", v, ok)
+	}
+	if v, ok := row.GetTime("Day"); !ok || !v.Equal(day) {
+		t.Fatalf("GetTime date: %v %v", v, ok)
+	}
+	if v, ok := row.GetTime("At"); !ok || !v.Equal(at) {
+		t.Fatalf("GetTime timestamp: %v %v", v, ok)
+	}
+	if v, ok := row.GetTime("Zoned"); !ok || !v.Equal(zoned) {
+		t.Fatalf("GetTime timestamptz: %v %v", v, ok)
+	}
+
+	if v, ok := row.GetString("Note"); ok || v != "" {
+		t.Fatalf("unset field: %q %v", v, ok)
+	}
+	if v, ok := row.GetUint("Title"); ok || v != 0 {
+		t.Fatalf("kind mismatch GetUint(Title): %d %v", v, ok)
+	}
+	if v, ok := row.GetTime("ID"); ok || !v.IsZero() {
+		t.Fatalf("kind mismatch GetTime(ID): %v %v", v, ok)
+	}
+	if _, ok := row.GetString("Missing"); ok {
+		t.Fatalf("unknown field reported present")
+	}
+}
+
+func TestStreamFooterVerify(t *testing.T) {
+	sch := buildTestSchema()
+	encode := func(opts codec.WriterOptions) []byte {
+		var buf bytes.Buffer
+		writer := codec.NewWriterWithOptions(&buf, sch, 4, opts)
+		row := codec.NewRow(sch)
+		for i := 0; i < 10; i++ {
+			row.Reset()
+			if err := row.SetUint("MsgID", uint64(i)); err != nil {
+				t.Fatal(err)
+			}
+			if err := row.SetString("Text", "message body"); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.WriteRow(row); err != nil {
+				t.Fatalf("write row: %v", err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("close writer: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	footed := encode(codec.WriterOptions{Footer: true})
+	if err := codec.NewReader(bytes.NewReader(footed), sch).Verify(); err != nil {
+		t.Fatalf("Verify intact payload: %v", err)
+	}
+	reader := codec.NewReader(bytes.NewReader(footed), sch)
+	decoded := codec.NewRow(sch)
+	count := 0
+	for {
+		ok, err := reader.ReadRow(decoded)
+		if err != nil {
+			t.Fatalf("read row: %v", err)
+		}
+		if !ok {
+			break
+		}
+		count++
+	}
+	if count != 10 {
+		t.Fatalf("expected 10 rows, got %d", count)
+	}
+
+	flipped := append([]byte(nil), footed...)
+	at := bytes.Index(flipped, []byte("message body"))
+	flipped[at] ^= 0x01
+	if err := codec.NewReader(bytes.NewReader(flipped), sch).Verify(); !errors.Is(err, codec.ErrFooterMismatch) {
+		t.Fatalf("expected ErrFooterMismatch for flipped byte, got %v", err)
+	}
+	if _, err := codec.StripFooter(flipped); !errors.Is(err, codec.ErrFooterMismatch) {
+		t.Fatalf("expected StripFooter to reject flipped byte, got %v", err)
+	}
+
+	truncated := footed[:len(footed)-20]
+	if err := codec.NewReader(bytes.NewReader(truncated), sch).Verify(); err == nil {
+		t.Fatalf("expected error for truncated payload")
+	}
+
+	plain := encode(codec.WriterOptions{})
+	if err := codec.NewReader(bytes.NewReader(plain), sch).Verify(); !errors.Is(err, codec.ErrMissingFooter) {
+		t.Fatalf("expected ErrMissingFooter, got %v", err)
+	}
+	added, err := codec.AppendFooter(plain)
+	if err != nil {
+		t.Fatalf("AppendFooter: %v", err)
+	}
+	if !bytes.Equal(added, footed) {
+		t.Fatalf("AppendFooter output differs from writer footer")
+	}
+	stripped, err := codec.StripFooter(added)
+	if err != nil {
+		t.Fatalf("StripFooter: %v", err)
+	}
+	if !bytes.Equal(stripped, plain) {
+		t.Fatalf("StripFooter did not restore the footerless payload")
+	}
+}
+
+func TestWriterStats(t *testing.T) {
+	sch := buildTestSchema()
+	for _, opts := range []codec.WriterOptions{{}, {Footer: true, PageChecksums: true}} {
+		var buf bytes.Buffer
+		writer := codec.NewWriterWithOptions(&buf, sch, 1024, opts)
+		if stats := writer.Stats(); stats != (codec.WriterStats{}) {
+			t.Fatalf("fresh writer has stats %+v", stats)
+		}
+		row := codec.NewRow(sch)
+		for i := 0; i < 2500; i++ {
+			row.Reset()
+			if err := row.SetUint("MsgID", uint64(i)); err != nil {
+				t.Fatal(err)
+			}
+			if err := row.SetString("Text", "message body"); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.WriteRow(row); err != nil {
+				t.Fatalf("write row: %v", err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("close writer: %v", err)
+		}
+		stats := writer.Stats()
+		if stats.PagesWritten != 3 || stats.RowsWritten != 2500 || stats.BytesWritten != uint64(buf.Len()) {
+			t.Fatalf("opts %+v: unexpected stats %+v for %d bytes", opts, stats, buf.Len())
+		}
+	}
+}
+
+func TestReaderResetReusesDecoder(t *testing.T) {
+	sch := buildTestSchema()
+	encode := func(sch *schema.Schema, texts []string, opts codec.WriterOptions) []byte {
+		var buf bytes.Buffer
+		writer := codec.NewWriterWithOptions(&buf, sch, 2, opts)
+		row := codec.NewRow(sch)
+		for i, text := range texts {
+			row.Reset()
+			if err := row.SetUint(sch.Fields[0].Name, uint64(i)); err != nil {
+				t.Fatal(err)
+			}
+			if err := row.SetString("Text", text); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.WriteRow(row); err != nil {
+				t.Fatalf("write row: %v", err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("close writer: %v", err)
+		}
+		return buf.Bytes()
+	}
+	readTexts := func(reader *codec.Reader, sch *schema.Schema) []string {
+		var texts []string
+		row := codec.NewRow(sch)
+		for {
+			ok, err := reader.ReadRow(row)
+			if err != nil {
+				t.Fatalf("read row: %v", err)
+			}
+			if !ok {
+				return texts
+			}
+			// Decoded strings borrow a page buffer the next page reuses.
+			text, _ := row.GetString("Text")
+			texts = append(texts, strings.Clone(text))
+		}
+	}
+
+	gsch := buildGlobalStringSchema("Text")
+	global := encode(gsch, []string{"a", "b", "a", "c"}, codec.WriterOptions{Footer: true})
+	plain := encode(sch, []string{"x", "y", "z"}, codec.WriterOptions{})
+	reader := codec.NewReader(bytes.NewReader(global), gsch)
+	if got := readTexts(reader, gsch); !slices.Equal(got, []string{"a", "b", "a", "c"}) {
+		t.Fatalf("first payload read %v", got)
+	}
+	// A second global-string stream must not see the first one's dictionary.
+	reader.Reset(bytes.NewReader(encode(gsch, []string{"d", "d", "e"}, codec.WriterOptions{})), gsch)
+	if got := readTexts(reader, gsch); !slices.Equal(got, []string{"d", "d", "e"}) {
+		t.Fatalf("second global payload read %v", got)
+	}
+	reader.Reset(bytes.NewReader(plain), sch)
+	if got := readTexts(reader, sch); !slices.Equal(got, []string{"x", "y", "z"}) {
+		t.Fatalf("plain payload read %v", got)
+	}
+
+	// Switching to a schema with fewer fields reallocates the columns.
+	narrow := &schema.Schema{Name: "Note", Fields: []schema.Field{
+		{Name: "ID", Kind: schema.KindUint64, RawType: "uint64"},
+		{Name: "Text", Kind: schema.KindString, RawType: "string"},
+	}}
+	reader.Reset(bytes.NewReader(encode(narrow, []string{"n1", "n2", "n3"}, codec.WriterOptions{})), narrow)
+	if got := readTexts(reader, narrow); !slices.Equal(got, []string{"n1", "n2", "n3"}) {
+		t.Fatalf("narrow payload read %v", got)
+	}
+	reader.Reset(bytes.NewReader(plain), sch)
+	if got := readTexts(reader, sch); !slices.Equal(got, []string{"x", "y", "z"}) {
+		t.Fatalf("payload after switching back read %v", got)
+	}
+}
+
+func TestWriterWriteRowMap(t *testing.T) {
+	sch := buildTestSchema()
+	var buf bytes.Buffer
+	writer := codec.NewWriter(&buf, sch, 2)
+	inputs := []map[string]any{
+		{"MsgID": uint64(1), "User": uint64(7), "Text": "hi", "Unknown": 42},
+		{"MsgID": uint64(2), "Text": "there", "Lang": nil},
+		{"MsgID": uint64(3), "Lang": "fr"},
+	}
+	for _, m := range inputs {
+		if err := writer.WriteRowMap(m); err != nil {
+			t.Fatalf("write map: %v", err)
+		}
+	}
+	if err := writer.WriteRowMap(map[string]any{"MsgID": "4"}); err == nil || !strings.Contains(err.Error(), "MsgID") {
+		t.Fatalf("expected a type error naming MsgID, got %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reader := codec.NewReader(bytes.NewReader(buf.Bytes()), sch)
+	row := codec.NewRow(sch)
+	var ids []uint64
+	for {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !ok {
+			break
+		}
+		id, _ := row.GetUint("MsgID")
+		ids = append(ids, id)
+		if id == 1 {
+			if user, _ := row.GetUint("User"); user != 7 {
+				t.Fatalf("row 1 User = %d", user)
+			}
+		}
+		if id == 3 {
+			if lang, _ := row.GetString("Lang"); lang != "fr" {
+				t.Fatalf("row 3 Lang = %q", lang)
+			}
+			if _, set := row.GetString("Text"); set {
+				t.Fatalf("row 3 Text should be unset")
+			}
+		}
+	}
+	if !slices.Equal(ids, []uint64{1, 2, 3}) {
+		t.Fatalf("decoded IDs %v", ids)
+	}
+}
+
+// v1Column frames one version 1 column: field index, kind byte, and the
+// length-prefixed payload.
+func v1Column(idx int, kind schema.FieldKind, payload []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(idx))
+	out = append(out, byte(kind))
+	out = binary.AppendUvarint(out, uint64(len(payload)))
+	return append(out, payload...)
+}
+
+// v1Stream wraps pages in a version 1 header for s, ending with the
+// zero-length terminator.
+func v1Stream(s *schema.Schema, pages ...[]byte) []byte {
+	out := append([]byte("SCRT"), 1)
+	out = binary.LittleEndian.AppendUint64(out, s.Fingerprint())
+	for _, p := range pages {
+		out = binary.AppendUvarint(out, uint64(len(p)))
+		out = append(out, p...)
+	}
+	return append(out, 0)
+}
+
+func TestReaderDecodesVersion1(t *testing.T) {
+	sch := &schema.Schema{
+		Name: "Legacy",
+		Fields: []schema.Field{
+			{Name: "ID", Kind: schema.KindUint64, RawType: "uint64"},
+			{Name: "Delta", Kind: schema.KindInt64, RawType: "int64"},
+			{Name: "Name", Kind: schema.KindString, RawType: "string"},
+			{Name: "Active", Kind: schema.KindBool, RawType: "bool"},
+			{Name: "Score", Kind: schema.KindFloat64, RawType: "float64"},
+			{Name: "Blob", Kind: schema.KindBytes, RawType: "bytes"},
+		},
+	}
+	uints := binary.AppendUvarint(nil, 2)
+	uints = binary.AppendUvarint(uints, 7)
+	uints = binary.AppendUvarint(uints, 300)
+	ints := binary.AppendUvarint(nil, 2)
+	ints = binary.AppendVarint(ints, -5)
+	ints = binary.AppendVarint(ints, 1<<40)
+	strs := binary.AppendUvarint(nil, 1) // one dictionary entry
+	strs = binary.AppendUvarint(strs, 3)
+	strs = append(strs, "ada"...)
+	strs = binary.AppendUvarint(strs, 2) // two indexes
+	strs = append(strs, 0, 0)
+	bools := []byte{2, 1, 0}
+	floats := binary.AppendUvarint(nil, 2)
+	floats = binary.LittleEndian.AppendUint64(floats, math.Float64bits(1.5))
+	floats = binary.LittleEndian.AppendUint64(floats, math.Float64bits(-2))
+	blobs := []byte{2, 2, 0xAB, 0xCD, 0}
+	page := append(binary.AppendUvarint(nil, 2), 6)
+	for _, col := range [][]byte{
+		v1Column(0, schema.KindUint64, uints),
+		v1Column(1, schema.KindInt64, ints),
+		v1Column(2, schema.KindString, strs),
+		v1Column(3, schema.KindBool, bools),
+		v1Column(4, schema.KindFloat64, floats),
+		v1Column(5, schema.KindBytes, blobs),
+	} {
+		page = append(page, col...)
+	}
+	stream := v1Stream(sch, page)
+
+	if v, err := codec.PayloadVersion(stream); err != nil || v != 1 {
+		t.Fatalf("PayloadVersion = %d, %v", v, err)
+	}
+	reader := codec.NewReader(bytes.NewReader(stream), sch)
+	row := codec.NewRow(sch)
+	type rec struct {
+		id     uint64
+		delta  int64
+		name   string
+		active bool
+		score  float64
+		blob   string
+	}
+	var got []rec
+	for {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !ok {
+			break
+		}
+		v := row.Values()
+		got = append(got, rec{v[0].Uint, v[1].Int, v[2].Str, v[3].Bool, v[4].Float, string(v[5].Bytes)})
+	}
+	want := []rec{{7, -5, "ada", true, 1.5, "\xab\xcd"}, {300, 1 << 40, "ada", false, -2, ""}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestReaderRejectsUnknownVersion(t *testing.T) {
+	sch := buildTestSchema()
+	var buf bytes.Buffer
+	writer := codec.NewWriter(&buf, sch, 4)
+	row := codec.NewRow(sch)
+	row.SetUint("MsgID", 1)
+	if err := writer.WriteRow(row); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for _, versionByte := range []byte{3, 0, 0x11} {
+		data := bytes.Clone(buf.Bytes())
+		data[4] = versionByte
+		_, err := codec.NewReader(bytes.NewReader(data), sch).ReadRow(codec.NewRow(sch))
+		if !errors.Is(err, codec.ErrUnsupportedVersion) {
+			t.Fatalf("version byte %#x: expected ErrUnsupportedVersion, got %v", versionByte, err)
+		}
+	}
+}
+
+func TestDecodeErrorsMatchSentinels(t *testing.T) {
+	sch := buildTestSchema()
+	var buf bytes.Buffer
+	writer := codec.NewWriter(&buf, sch, 4)
+	row := codec.NewRow(sch)
+	row.SetUint("MsgID", 1)
+	row.SetString("Text", "hello")
+	if err := writer.WriteRow(row); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	valid := buf.Bytes()
+	const headerLen = 13
+
+	narrow := &schema.Schema{Name: "Message", Fields: sch.Fields[:2]}
+	retagged := bytes.Clone(valid)
+	binary.LittleEndian.PutUint64(retagged[5:headerLen], narrow.Fingerprint())
+
+	badMagic := bytes.Clone(valid)
+	copy(badMagic, "SCRX")
+
+	// A page whose row count varint never terminates.
+	corrupt := append(bytes.Clone(valid[:headerLen]), 1, 0x80)
+
+	cases := []struct {
+		name   string
+		data   []byte
+		schema *schema.Schema
+		want   error
+		detail string
+	}{
+		{"bad magic", badMagic, sch, codec.ErrInvalidMagic, "invalid magic"},
+		{"column count", retagged, narrow, codec.ErrColumnCountMismatch, "page has 4 columns, schema Message has 2 fields"},
+		{"corrupt page", corrupt, sch, codec.ErrCorruptPage, "malformed row count"},
+		{"fingerprint", valid, narrow, codec.ErrSchemaFingerprintMismatch, "fingerprint"},
+	}
+	for _, tc := range cases {
+		_, err := codec.NewReader(bytes.NewReader(tc.data), tc.schema).ReadRow(codec.NewRow(tc.schema))
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+		if !strings.Contains(err.Error(), tc.detail) {
+			t.Fatalf("%s: message %q lacks %q", tc.name, err.Error(), tc.detail)
+		}
+	}
+	if _, err := codec.PayloadVersion(badMagic); !errors.Is(err, codec.ErrInvalidMagic) {
+		t.Fatalf("PayloadVersion: expected ErrInvalidMagic, got %v", err)
+	}
+}
+
+func TestReaderInternStrings(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Post\n@field ID uint64\n@field Lang string\n@field Tags list<string>\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("Post")
+	var buf bytes.Buffer
+	// Two rows per page puts every value on several pages.
+	writer := codec.NewWriter(&buf, sch, 2)
+	row := codec.NewRow(sch)
+	langs := []string{"en", "fr"}
+	for i := range 8 {
+		row.Reset()
+		row.SetUint("ID", uint64(i))
+		row.SetString("Lang", langs[i%2])
+		row.SetStrings("Tags", []string{"go", langs[i%2]})
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// backings counts the distinct allocations behind each string value.
+	backings := func(opts codec.Options) map[string]int {
+		reader := codec.NewReaderWithOptions(bytes.NewReader(buf.Bytes()), sch, opts)
+		seen := map[string]map[*byte]bool{}
+		note := func(s string) {
+			if seen[s] == nil {
+				seen[s] = map[*byte]bool{}
+			}
+			seen[s][unsafe.StringData(s)] = true
+		}
+		row := codec.NewRow(sch)
+		for {
+			ok, err := reader.ReadRow(row)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !ok {
+				break
+			}
+			values := row.Values()
+			note(values[1].Str)
+			for _, tag := range values[2].Strs {
+				note(tag)
+			}
+		}
+		counts := map[string]int{}
+		for s, ptrs := range seen {
+			counts[s] = len(ptrs)
+		}
+		return counts
+	}
+
+	if got := backings(codec.Options{KeepPages: true}); got["go"] < 4 {
+		t.Fatalf("expected borrowed strings to come from each kept page, got %v", got)
+	}
+	for _, opts := range []codec.Options{{InternStrings: true}, {InternStrings: true, ZeroCopyBytes: true}} {
+		got := backings(opts)
+		want := map[string]int{"en": 1, "fr": 1, "go": 1}
+		if !maps.Equal(got, want) {
+			t.Fatalf("options %+v: backings %v, want %v", opts, got, want)
+		}
+	}
+}
+
+func TestMultiReaderConcatenatedStreams(t *testing.T) {
+	sch := buildGlobalStringSchema("Lang")
+	langs := []string{"en", "de", "fr"}
+	encode := func(first, count int, opts codec.WriterOptions) []byte {
+		var buf bytes.Buffer
+		writer := codec.NewWriterWithOptions(&buf, sch, 4, opts)
+		row := codec.NewRow(sch)
+		for i := first; i < first+count; i++ {
+			row.Reset()
+			row.SetUint("MsgID", uint64(i))
+			row.SetString("Lang", langs[i%len(langs)])
+			if err := writer.WriteRow(row); err != nil {
+				t.Fatalf("write row: %v", err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("close writer: %v", err)
+		}
+		return buf.Bytes()
+	}
+	readAll := func(data []byte) ([]uint64, error) {
+		reader := codec.NewMultiReader(bytes.NewReader(data), sch)
+		row := codec.NewRow(sch)
+		var ids []uint64
+		for {
+			ok, err := reader.ReadRow(row)
+			if err != nil || !ok {
+				return ids, err
+			}
+			if want := langs[row.Values()[0].Uint%uint64(len(langs))]; row.Values()[3].Str != want {
+				return ids, fmt.Errorf("row %d: lang %q, want %q", len(ids), row.Values()[3].Str, want)
+			}
+			ids = append(ids, row.Values()[0].Uint)
+		}
+	}
+
+	// A plain stream ends after its last page, a footed one with its
+	// terminator, and an empty one carries no pages at all.
+	plain := encode(0, 10, codec.WriterOptions{LocalDictionaries: true})
+	footed := encode(10, 7, codec.WriterOptions{Footer: true, PageChecksums: true})
+	empty := encode(0, 0, codec.WriterOptions{})
+	concatenated := slices.Concat(plain, empty, footed, plain[:0], encode(17, 5, codec.WriterOptions{}))
+	ids, err := readAll(concatenated)
+	if err != nil {
+		t.Fatalf("read concatenated: %v", err)
+	}
+	if len(ids) != 22 {
+		t.Fatalf("expected 22 rows, got %d", len(ids))
+	}
+	for i, id := range ids {
+		if id != uint64(i) {
+			t.Fatalf("row %d: id %d", i, id)
+		}
+	}
+
+	// A plain Reader does not look past the first stream.
+	single := codec.NewReader(bytes.NewReader(slices.Concat(footed, plain)), sch)
+	rows := 0
+	for {
+		ok, err := single.ReadRow(codec.NewRow(sch))
+		if err != nil {
+			t.Fatalf("single reader: %v", err)
+		}
+		if !ok {
+			break
+		}
+		rows++
+	}
+	if rows != 7 {
+		t.Fatalf("single reader: expected 7 rows, got %d", rows)
+	}
+
+	if _, err := readAll(slices.Concat(footed, []byte{'x'})); !errors.Is(err, codec.ErrTrailingData) {
+		t.Fatalf("trailing byte: expected ErrTrailingData, got %v", err)
+	}
+	if _, err := readAll(slices.Concat(footed, []byte("SC"))); !errors.Is(err, codec.ErrTrailingData) {
+		t.Fatalf("partial header: expected ErrTrailingData, got %v", err)
+	}
+	if _, err := readAll(slices.Concat(footed, footed[:5])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated header: expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	narrow := &schema.Schema{Name: "Message", Fields: sch.Fields[:2]}
+	var other bytes.Buffer
+	writer := codec.NewWriter(&other, narrow, 4)
+	row := codec.NewRow(narrow)
+	row.SetUint("MsgID", 99)
+	if err := writer.WriteRow(row); err != nil {
+		t.Fatalf("write row: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+	ids, err = readAll(slices.Concat(plain, other.Bytes()))
+	if !errors.Is(err, codec.ErrSchemaFingerprintMismatch) || !strings.Contains(err.Error(), "stream 2") {
+		t.Fatalf("foreign stream: expected a stream 2 fingerprint mismatch, got %v", err)
+	}
+	if len(ids) != 10 {
+		t.Fatalf("foreign stream: expected the 10 rows before it, got %d", len(ids))
+	}
+}
+
+func TestWriterFlushRowsMakesEachRowReadable(t *testing.T) {
+	sch := buildGlobalStringSchema("Lang")
+	var buf bytes.Buffer
+	writer := codec.NewWriterWithOptions(&buf, sch, 1024, codec.WriterOptions{FlushRows: 1})
+	row := codec.NewRow(sch)
+	langs := []string{"en", "de", "en", "fr", "de"}
+	for i, lang := range langs {
+		row.Reset()
+		row.SetUint("MsgID", uint64(i))
+		row.SetString("Lang", lang)
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatalf("write row %d: %v", i, err)
+		}
+		if pages := writer.Stats().PagesWritten; pages != uint64(i+1) {
+			t.Fatalf("after row %d: expected %d pages, got %d", i, i+1, pages)
+		}
+		// What has reached the destination so far decodes to every row.
+		reader := codec.NewReader(bytes.NewReader(buf.Bytes()), sch)
+		decoded := codec.NewRow(sch)
+		for j := 0; j <= i; j++ {
+			ok, err := reader.ReadRow(decoded)
+			if err != nil || !ok {
+				t.Fatalf("after row %d: read row %d: ok=%v err=%v", i, j, ok, err)
+			}
+			if vals := decoded.Values(); vals[0].Uint != uint64(j) || vals[3].Str != langs[j] {
+				t.Fatalf("after row %d: row %d decoded as %+v", i, j, vals)
+			}
+		}
+		if ok, err := reader.ReadRow(decoded); ok || err != nil {
+			t.Fatalf("after row %d: expected the end of the stream, got ok=%v err=%v", i, ok, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// FlushInterval ends a page once its oldest row is old enough.
+	buf.Reset()
+	writer = codec.NewWriterWithOptions(&buf, sch, 1024, codec.WriterOptions{FlushInterval: 50 * time.Millisecond})
+	for i := range 3 {
+		if i == 2 {
+			time.Sleep(60 * time.Millisecond)
+		}
+		row.Reset()
+		row.SetUint("MsgID", uint64(i))
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatalf("write row %d: %v", i, err)
+		}
+	}
+	if stats := writer.Stats(); stats.PagesWritten != 1 || stats.RowsWritten != 3 {
+		t.Fatalf("expected one page of 3 rows after the interval, got %+v", stats)
+	}
+}
+
+func TestWriterFlushRowsReachesLiveReader(t *testing.T) {
+	sch := buildTestSchema()
+	pr, pw := io.Pipe()
+	acks := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		writer := codec.NewWriterWithOptions(pw, sch, 1024, codec.WriterOptions{FlushRows: 1})
+		row := codec.NewRow(sch)
+		for i := range 3 {
+			row.Reset()
+			row.SetUint("MsgID", uint64(i))
+			if err := writer.WriteRow(row); err != nil {
+				errs <- err
+				return
+			}
+			// The next row waits until the reader has seen this one.
+			<-acks
+		}
+		errs <- writer.Close()
+		pw.Close()
+	}()
+
+	reader := codec.NewReader(pr, sch)
+	row := codec.NewRow(sch)
+	for i := range 3 {
+		got := make(chan error, 1)
+		go func() {
+			ok, err := reader.ReadRow(row)
+			if err == nil && !ok {
+				err = io.ErrUnexpectedEOF
+			}
+			got <- err
+		}()
+		select {
+		case err := <-got:
+			if err != nil {
+				t.Fatalf("row %d: %v", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("row %d did not reach the reader before the next write", i)
+		}
+		if id := row.Values()[0].Uint; id != uint64(i) {
+			t.Fatalf("row %d: got id %d", i, id)
+		}
+		acks <- struct{}{}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	if ok, err := reader.ReadRow(row); ok || err != nil {
+		t.Fatalf("expected the end of the stream, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestNarrowIntegersRoundTripPerWidth(t *testing.T) {
+	uintSchema := &schema.Schema{Name: "U", Fields: []schema.Field{{Name: "V", Kind: schema.KindUint64, RawType: "uint64"}}}
+	intSchema := &schema.Schema{Name: "I", Fields: []schema.Field{{Name: "V", Kind: schema.KindInt64, RawType: "int64"}}}
+	encode := func(sch *schema.Schema, n int, set func(codec.Row, int), opts codec.WriterOptions) []byte {
+		var buf bytes.Buffer
+		writer := codec.NewWriterWithOptions(&buf, sch, 1024, opts)
+		row := codec.NewRow(sch)
+		for i := range n {
+			row.Reset()
+			set(row, i)
+			if err := writer.WriteRow(row); err != nil {
+				t.Fatalf("write row %d: %v", i, err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		return buf.Bytes()
+	}
+	decode := func(sch *schema.Schema, data []byte) []codec.Value {
+		reader := codec.NewReader(bytes.NewReader(data), sch)
+		row := codec.NewRow(sch)
+		var out []codec.Value
+		for {
+			ok, err := reader.ReadRow(row)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !ok {
+				return out
+			}
+			out = append(out, row.Values()[0])
+		}
+	}
+	// kindByte returns the kind byte of the only column on the first page.
+	kindByte := func(data []byte) byte {
+		rest := data[13:]
+		for range 4 { // page length, rows, columns, field index
+			_, n := binary.Uvarint(rest)
+			rest = rest[n:]
+		}
+		return rest[0]
+	}
+	narrow := codec.WriterOptions{NarrowIntegers: true}
+
+	uintCases := []struct {
+		name   string
+		values []uint64
+		saves  bool // fixed width beats varints
+	}{
+		{"width 1", []uint64{255, 128, 200, 254, 129, 255}, true},
+		{"width 2", []uint64{65535, 16384, 60000, 16385, 65534}, true},
+		{"width 4", []uint64{math.MaxUint32, 1 << 28, 1<<32 - 2, 1 << 30}, true},
+		{"width 8", []uint64{math.MaxUint64, 1 << 63, 1 << 56, math.MaxUint64 - 1}, true},
+		{"User ids", []uint64{1042, 1007, 1100, 1000, 1063, 1099}, false},
+		{"delta", []uint64{1 << 40, 1<<40 + 200, 1<<40 + 450, 1<<40 + 660}, true},
+		{"boundary 255 to 256", []uint64{256, 255, 256, 255}, false},
+		{"boundary 65535 to 65536", []uint64{1 << 28, 65536, 1 << 31, 65535}, false},
+	}
+	for _, tc := range uintCases {
+		set := func(row codec.Row, i int) { row.SetUint("V", tc.values[i]) }
+		plainBytes := encode(uintSchema, len(tc.values), set, codec.WriterOptions{})
+		narrowBytes := encode(uintSchema, len(tc.values), set, narrow)
+		if kindByte(narrowBytes)&page.NarrowIntFlag == 0 {
+			t.Fatalf("%s: narrow layout not chosen", tc.name)
+		}
+		if tc.saves && len(narrowBytes) >= len(plainBytes) {
+			t.Fatalf("%s: narrow payload %d bytes, varints %d", tc.name, len(narrowBytes), len(plainBytes))
+		}
+		for i, v := range decode(uintSchema, narrowBytes) {
+			if !v.Set || v.Uint != tc.values[i] {
+				t.Fatalf("%s: row %d decoded as %+v, want %d", tc.name, i, v, tc.values[i])
+			}
+		}
+	}
+
+	// Small values cost one varint byte each, so the page keeps varints.
+	small := encode(uintSchema, 5, func(row codec.Row, i int) { row.SetUint("V", uint64(5-i)) }, narrow)
+	if kindByte(small)&page.NarrowIntFlag != 0 {
+		t.Fatalf("one-byte varints should not be narrowed")
+	}
+
+	intCases := []struct {
+		name   string
+		values []int64
+	}{
+		{"single negative", []int64{-300}},
+		{"zigzag 255", []int64{0, 127, -1}},
+		{"zigzag 256", []int64{0, 128, 0}},
+		{"alternating", []int64{-100, 100, -100, 100}},
+		{"width 4", []int64{0, 1 << 29, -(1 << 29), 1 << 29}},
+		{"extremes", []int64{math.MinInt64, -1, math.MaxInt64, -2}},
+	}
+	for _, tc := range intCases {
+		set := func(row codec.Row, i int) { row.SetInt("V", tc.values[i]) }
+		data := encode(intSchema, len(tc.values), set, narrow)
+		if kindByte(data)&page.NarrowIntFlag == 0 {
+			t.Fatalf("%s: narrow layout not chosen", tc.name)
+		}
+		for i, v := range decode(intSchema, data) {
+			if !v.Set || v.Int != tc.values[i] {
+				t.Fatalf("%s: row %d decoded as %+v, want %d", tc.name, i, v, tc.values[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+// compatReader decodes a stream written with an older schema and maps its
+// rows onto the reader's schema.
+type compatReader struct {
+	inner *Reader
+	src   Row
+	// sources holds the written field index of each reader field, or -1
+	// for fields the written schema lacks.
+	sources []int
+	// backfill holds the value of each field the written schema lacks: its
+	// literal default, or an unset Value.
+	backfill []Value
+	err      error
+}
+
+// newCompatReader binds a reader of written payloads to s. Fields are
+// matched by name and must keep their kind; written fields that s dropped
+// are decoded and discarded.
+func newCompatReader(src io.Reader, written, s *schema.Schema, opts Options) *compatReader {
+	inner := opts
+	inner.WrittenWith = nil
+	c := &compatReader{
+		inner:    NewReaderWithOptions(src, written, inner),
+		src:      NewRow(written),
+		backfill: make([]Value, len(s.Fields)),
+	}
+	c.sources, _, c.err = FieldSources(written, s, nil)
+	if c.err != nil {
+		return c
+	}
+	var skip []bool
+	if len(opts.Projection) > 0 {
+		skip = projectionMask(s, opts.Projection)
+	}
+	for i, field := range s.Fields {
+		if c.sources[i] < 0 && (skip == nil || !skip[i]) {
+			c.backfill[i], _ = StaticDefault(field)
+		}
+	}
+	return c
+}
+
+// FieldSources maps the fields of to onto those of from, the schema rows
+// were written with. sources holds, for each field of to, the index of the
+// field of from that carries its values, or -1 when none does. renames maps
+// field names of from to names in to; every other field matches the field
+// of the same name. A matched pair must store the same kind, and no two
+// fields of from may land on one field of to. dropped lists the fields of
+// from that nothing in to takes, in schema order.
+func FieldSources(from, to *schema.Schema, renames map[string]string) (sources []int, dropped []string, err error) {
+	for name := range renames {
+		if _, ok := from.FieldIndex(name); !ok {
+			return nil, nil, fmt.Errorf("codec: rename source %s is not a field of %s", name, from.Name)
+		}
+	}
+	sources = make([]int, len(to.Fields))
+	for i := range sources {
+		sources[i] = -1
+	}
+	for fromIdx, field := range from.Fields {
+		target, renamed := renames[field.Name]
+		if !renamed {
+			target = field.Name
+		}
+		toIdx, ok := to.FieldIndex(target)
+		if !ok {
+			if renamed {
+				return nil, nil, fmt.Errorf("codec: rename target %s is not a field of %s", target, to.Name)
+			}
+			dropped = append(dropped, field.Name)
+			continue
+		}
+		if prev := sources[toIdx]; prev >= 0 {
+			return nil, nil, fmt.Errorf("codec: fields %s and %s both map to %s", from.Fields[prev].Name, field.Name, target)
+		}
+		next := to.Fields[toIdx]
+		if field.ValueKind() != next.ValueKind() || field.ElemKind != next.ElemKind {
+			return nil, nil, fmt.Errorf("codec: field %s (%s) cannot become %s (%s)", field.Name, field.RawType, next.Name, next.RawType)
+		}
+		sources[toIdx] = fromIdx
+	}
+	return sources, dropped, nil
+}
+
+// readRow fills row with the next written row, backfilling missing fields.
+func (c *compatReader) readRow(row Row) (bool, error) {
+	if c.err != nil {
+		return false, c.err
+	}
+	ok, err := c.inner.ReadRow(c.src)
+	if !ok || err != nil {
+		return ok, err
+	}
+	in := c.src.values
+	for i, from := range c.sources {
+		if from < 0 {
+			row.values[i] = c.backfill[i]
+			if def := c.backfill[i].Bytes; def != nil {
+				// Rows may be kept; each gets its own copy of a bytes default.
+				row.values[i].Bytes = cloneBytes(def)
+			}
+			continue
+		}
+		row.values[i] = in[from]
+	}
+	return true, nil
+}
@@ -0,0 +1,40 @@
+package codec
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
+)
+
+// evalDefaultFunc evaluates the default function of field for one row:
+// now() is the current UTC instant and uuid() a fresh UUIDv7.
+func evalDefaultFunc(field schema.Field) (Value, error) {
+	def := field.Default
+	switch def.Func {
+	case "now":
+		now := time.Now().UTC()
+		switch def.Kind {
+		case schema.KindDate:
+			return Value{Int: temporal.EncodeDate(now), Set: true}, nil
+		case schema.KindDateTime, schema.KindTimestamp:
+			return Value{Int: temporal.EncodeInstant(now), Set: true}, nil
+		case schema.KindTimestampTZ:
+			return Value{Str: temporal.FormatTimestampTZ(now), Set: true}, nil
+		}
+	case "uuid":
+		id, err := uuid.NewV7()
+		if err != nil {
+			return Value{}, err
+		}
+		switch def.Kind {
+		case schema.KindString:
+			return Value{Str: id.String(), Set: true}, nil
+		case schema.KindUUID:
+			return Value{Bytes: id[:], Set: true}, nil
+		}
+	}
+	return Value{}, fmt.Errorf("codec: field %s: default %s() does not apply to kind %d", field.Name, def.Func, def.Kind)
+}
@@ -9,4 +9,31 @@ var (
 	ErrMismatchedFieldCount = errors.New("codec: mismatched field count")
 	// ErrSchemaFingerprintMismatch indicates that the binary stream targets a different schema.
 	ErrSchemaFingerprintMismatch = errors.New("codec: schema fingerprint mismatch")
+	// ErrInvalidUUID indicates that a uuid field value is not exactly 16 bytes.
+	ErrInvalidUUID = errors.New("codec: uuid values must be 16 bytes")
+	// ErrPageChecksum indicates that a page's stored CRC does not match its contents.
+	ErrPageChecksum = errors.New("codec: page checksum mismatch")
+	// ErrFooterMismatch indicates that a stream's footer does not match its pages.
+	ErrFooterMismatch = errors.New("codec: stream footer mismatch")
+	// ErrUnsupportedVersion indicates a stream format version this reader does
+	// not know, typically one written by a newer release.
+	ErrUnsupportedVersion = errors.New("codec: unsupported format version")
+	// ErrUnsortableKind indicates a sort key whose kind has no ordering, such
+	// as bytes or list fields.
+	ErrUnsortableKind = errors.New("codec: field kind cannot be sorted")
+	// ErrInvalidMagic indicates input that does not start with the SCRT magic
+	// bytes, so it is not an SCRT stream at all.
+	ErrInvalidMagic = errors.New("codec: invalid magic header")
+	// ErrColumnCountMismatch indicates a page whose column count differs from
+	// the schema's field count.
+	ErrColumnCountMismatch = errors.New("codec: column count mismatch")
+	// ErrCorruptPage indicates a page whose contents cannot be decoded:
+	// malformed lengths, counts that disagree, or indexes out of range.
+	// Truncated input is reported as io.ErrUnexpectedEOF instead.
+	ErrCorruptPage = errors.New("codec: corrupt page")
+	// ErrTrailingData indicates bytes after the end of a stream that do not
+	// start another stream, as a Concatenated reader finds them.
+	ErrTrailingData = errors.New("codec: trailing data after stream")
+	// ErrMissingFooter indicates that Verify was called on a stream written without a footer.
+	ErrMissingFooter = errors.New("codec: stream has no footer")
 )
@@ -0,0 +1,77 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+// FilterUint returns the IDs of the rows in src whose uint64 or ref field
+// satisfies pred. See filterRows for what is decoded and how rows are
+// numbered.
+func FilterUint(src io.Reader, s *schema.Schema, field string, pred func(uint64) bool) ([]uint64, error) {
+	return filterRows(src, s, field, "uint64", func(kind schema.FieldKind) bool {
+		return kind == schema.KindUint64 || kind == schema.KindRef
+	}, func(v Value) bool { return pred(v.Uint) })
+}
+
+// FilterInt returns the IDs of the rows in src whose int64 field satisfies
+// pred.
+func FilterInt(src io.Reader, s *schema.Schema, field string, pred func(int64) bool) ([]uint64, error) {
+	return filterRows(src, s, field, "int64", func(kind schema.FieldKind) bool {
+		return kind == schema.KindInt64
+	}, func(v Value) bool { return pred(v.Int) })
+}
+
+// FilterString returns the IDs of the rows in src whose string field
+// satisfies pred. The string passed to pred may share the page buffer, so
+// pred must copy it to keep it.
+func FilterString(src io.Reader, s *schema.Schema, field string, pred func(string) bool) ([]uint64, error) {
+	return filterRows(src, s, field, "string", func(kind schema.FieldKind) bool {
+		return kind == schema.KindString
+	}, func(v Value) bool { return pred(v.Str) })
+}
+
+// FilterBool returns the IDs of the rows in src whose bool field satisfies
+// pred.
+func FilterBool(src io.Reader, s *schema.Schema, field string, pred func(bool) bool) ([]uint64, error) {
+	return filterRows(src, s, field, "bool", func(kind schema.FieldKind) bool {
+		return kind == schema.KindBool
+	}, func(v Value) bool { return pred(v.Bool) })
+}
+
+// filterRows streams src one page at a time, decoding only field as
+// Aggregate does, and collects the IDs of rows where match holds. Row IDs
+// count rows from the start of the stream across pages, the numbering
+// storage.BuildRowIndex uses. Unset values never match; defaults fill
+// omitted values as they do for ReadRow.
+func filterRows(src io.Reader, s *schema.Schema, field, typ string, accepts func(schema.FieldKind) bool, match func(Value) bool) ([]uint64, error) {
+	idx, ok := s.FieldIndex(field)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownField, field)
+	}
+	if !accepts(s.Fields[idx].ValueKind()) {
+		return nil, fmt.Errorf("codec: cannot filter field %s of type %s as %s", field, s.Fields[idx].RawType, typ)
+	}
+	var ids []uint64
+	reader := NewReaderWithOptions(src, s, Options{Projection: []string{field}})
+	row := NewRow(s)
+	for rowID := uint64(0); ; rowID++ {
+		ok, err := reader.ReadRow(row)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if val := row.values[idx]; val.Set && match(val) {
+			ids = append(ids, rowID)
+		}
+	}
+	return ids, nil
+}
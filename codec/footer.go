@@ -0,0 +1,111 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// flagFooter marks streams that end with a zero-length terminator followed
+	// by a footer: CRC32C of the page region and the total row count.
+	flagFooter = byte(0x20)
+	footerSize = 4 + 8
+
+	headerSize      = len(magic) + 1 + 8
+	knownHeaderFlag = flagPageChecksums | flagFooter
+)
+
+// AppendFooter returns payload with a footer covering its pages. Payloads that
+// already carry a footer, or that are too short to hold a header, are returned
+// unchanged.
+func AppendFooter(payload []byte) ([]byte, error) {
+	if len(payload) < headerSize || payload[len(magic)]&flagFooter != 0 {
+		return payload, nil
+	}
+	sum, rows, end, err := scanPageRegion(payload, payload[len(magic)]&flagPageChecksums != 0)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, end+1+footerSize)
+	out = append(out, payload[:end]...)
+	out[len(magic)] |= flagFooter
+	out = append(out, 0)
+	out = binary.LittleEndian.AppendUint32(out, sum)
+	out = binary.LittleEndian.AppendUint64(out, rows)
+	return out, nil
+}
+
+// StripFooter verifies payload's footer and returns the payload without it,
+// with the header flag cleared. Footerless payloads are returned unchanged.
+func StripFooter(payload []byte) ([]byte, error) {
+	if len(payload) < headerSize || payload[len(magic)]&flagFooter == 0 {
+		return payload, nil
+	}
+	sum, rows, end, err := scanPageRegion(payload, payload[len(magic)]&flagPageChecksums != 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != end+1+footerSize || payload[end] != 0 {
+		return nil, ErrFooterMismatch
+	}
+	if err := checkFooter(payload[end+1:], sum, rows); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), payload[:end]...)
+	out[len(magic)] &^= flagFooter
+	return out, nil
+}
+
+// FooterRowCount returns the total row count recorded in payload's footer
+// without verifying the footer, for sizing buffers ahead of a decode. ok is
+// false when payload has no footer.
+func FooterRowCount(payload []byte) (rows uint64, ok bool) {
+	if len(payload) < headerSize+1+footerSize || payload[len(magic)]&flagFooter == 0 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(payload[len(payload)-8:]), true
+}
+
+// scanPageRegion walks the length-prefixed pages after the header and stops at
+// the terminator or end of input. It returns the CRC32C of the bytes walked,
+// the rows they hold, and the offset where the page region ends.
+func scanPageRegion(payload []byte, pageChecksums bool) (uint32, uint64, int, error) {
+	offset := headerSize
+	var rows uint64
+	for offset < len(payload) {
+		length, n := binary.Uvarint(payload[offset:])
+		if n <= 0 {
+			return 0, 0, 0, fmt.Errorf("%w: malformed page length at offset %d", ErrCorruptPage, offset)
+		}
+		if length == 0 {
+			break
+		}
+		end := offset + n + int(length)
+		if end > len(payload) {
+			return 0, 0, 0, io.ErrUnexpectedEOF
+		}
+		body := payload[offset+n : end]
+		if pageChecksums && len(body) < pageChecksumSize {
+			return 0, 0, 0, io.ErrUnexpectedEOF
+		}
+		count, used := binary.Uvarint(body)
+		if used <= 0 {
+			return 0, 0, 0, fmt.Errorf("%w: malformed row count at offset %d", ErrCorruptPage, offset)
+		}
+		rows += count
+		offset = end
+	}
+	return crc32.Checksum(payload[headerSize:offset], castagnoli), rows, offset, nil
+}
+
+func checkFooter(footer []byte, sum uint32, rows uint64) error {
+	if len(footer) != footerSize {
+		return ErrFooterMismatch
+	}
+	if binary.LittleEndian.Uint32(footer[:4]) != sum || binary.LittleEndian.Uint64(footer[4:]) != rows {
+		return ErrFooterMismatch
+	}
+	return nil
+}
@@ -5,10 +5,15 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
+	"slices"
+	"strings"
 	"unsafe"
 
+	"github.com/oarkflow/scrt/column"
+	"github.com/oarkflow/scrt/page"
 	"github.com/oarkflow/scrt/schema"
 )
 
@@ -18,8 +23,26 @@ type Reader struct {
 	schema *schema.Schema
 
 	headerRead    bool
+	version       byte
+	pageChecksums bool
+	footer        bool
+	finished      bool
+	regionCRC     uint32
+	rowsRead      uint64
+	concatenated  bool
+	streams       int // headers consumed so far
 	pageState     decodedPage
 	zeroCopyBytes bool
+	// skip marks fields excluded by Options.Projection; nil reads every field.
+	skip       []bool
+	projection []string
+	// interned holds the owned copy of each distinct string value when
+	// Options.InternStrings is set; nil otherwise.
+	interned map[string]string
+	// opts and compat serve Options.WrittenWith: compat decodes the stream
+	// when it was written with another schema.
+	opts   Options
+	compat *compatReader
 }
 
 type decodedPage struct {
@@ -31,6 +54,7 @@ type decodedPage struct {
 
 type decodedColumn struct {
 	kind          schema.FieldKind
+	globalStrings bool
 	rowIndexes    []int32
 	uints         []uint64
 	stringOffsets []uint32
@@ -43,6 +67,11 @@ type decodedColumn struct {
 	bools         []bool
 	ints          []int64
 	floats        []float64
+	uuidArena     []byte
+	listCounts    []uint64
+	listStarts    []uint32
+	tzOffsets     []int64 // scratch for offset-encoded timestamptz columns
+	tzArena       []byte  // rebuilt timestamptz strings, reused across pages
 }
 
 // NewReader constructs a streaming decoder bound to schema.
@@ -52,6 +81,42 @@ type Options struct {
 	// Callers must treat returned byte slices as read-only and they remain valid
 	// only until the next page is loaded or the reader is reused.
 	ZeroCopyBytes bool
+	// Projection limits decoding to the named fields. Other columns are
+	// stepped over using their stored payload lengths and ReadRow leaves
+	// them unset, without applying defaults. Names not in the schema are
+	// ignored; empty means every field.
+	Projection []string
+	// InternStrings makes string values, list elements included, share one
+	// heap copy per distinct value for the life of the reader, instead of
+	// borrowing the page that held them. Repeated values in low-cardinality
+	// columns then cost one allocation in total, and decoded rows stop
+	// pinning page buffers. Interned strings are owned copies, so they stay
+	// valid under ZeroCopyBytes. Each value costs a map lookup, and the table
+	// is cleared by Reset.
+	InternStrings bool
+	// KeepPages gives every page a buffer of its own instead of reusing
+	// one, so strings and borrowed bytes decoded from a page stay valid
+	// after the reader moves past it, at the cost of an allocation per
+	// page. Decoders that hold on to every row, such as scrt.Unmarshal,
+	// need it; by default values borrowed from a page are only valid until
+	// the next page is loaded.
+	KeepPages bool
+	// Concatenated reads back-to-back streams, such as appended Marshal
+	// outputs, as one: where a stream ends, by its terminator or footer or
+	// by another header following its last page, the reader consumes the
+	// next header and keeps going. Every stream must carry the schema's
+	// fingerprint, and each is checked against its own footer. Bytes after
+	// a stream's terminator that do not start a header fail with
+	// ErrTrailingData.
+	Concatenated bool
+	// WrittenWith names the schema the stream was written with when it is
+	// an older version of the reader's schema. Rows come back shaped by the
+	// reader's schema: fields are matched by name and must keep their kind,
+	// written fields the reader's schema dropped are discarded, and a field
+	// it added is backfilled with its literal default in every row, or left
+	// unset when it has none or defaults to a function. Nil, or a schema
+	// with the reader's fingerprint, reads the stream directly.
+	WrittenWith *schema.Schema
 }
 
 // NewReader constructs a streaming decoder bound to schema.
@@ -61,14 +126,92 @@ func NewReader(src io.Reader, s *schema.Schema) *Reader {
 
 // NewReaderWithOptions constructs a decoder with custom options.
 func NewReaderWithOptions(src io.Reader, s *schema.Schema, opts Options) *Reader {
-	return &Reader{
+	r := &Reader{
 		src:           bufio.NewReader(src),
 		schema:        s,
 		zeroCopyBytes: opts.ZeroCopyBytes,
+		concatenated:  opts.Concatenated,
 		pageState: decodedPage{
 			columns: make([]decodedColumn, len(s.Fields)),
 		},
 	}
+	if len(opts.Projection) > 0 {
+		r.projection = opts.Projection
+		r.skip = projectionMask(s, opts.Projection)
+	}
+	if opts.InternStrings {
+		r.interned = make(map[string]string)
+	}
+	r.opts = opts
+	if opts.WrittenWith != nil && opts.WrittenWith.Fingerprint() != s.Fingerprint() {
+		r.compat = newCompatReader(src, opts.WrittenWith, s, opts)
+	}
+	return r
+}
+
+// NewMultiReader constructs a decoder over concatenated streams; see
+// Options.Concatenated.
+func NewMultiReader(src io.Reader, s *schema.Schema) *Reader {
+	return NewReaderWithOptions(src, s, Options{Concatenated: true})
+}
+
+// Reset rebinds the reader to src and s so one decoder can serve many
+// payloads. The buffered reader and the per-column slices are kept when s
+// has as many fields as the previous schema, and reallocated otherwise.
+// Page buffers are never reused because decoded strings may still borrow
+// them. Options given at construction stay in effect, with Projection and
+// WrittenWith resolved against s.
+func (r *Reader) Reset(src io.Reader, s *schema.Schema) {
+	if r.src == nil {
+		r.src = bufio.NewReader(src)
+	} else {
+		r.src.Reset(src)
+	}
+	r.schema = s
+	r.headerRead = false
+	r.version = 0
+	r.pageChecksums = false
+	r.footer = false
+	r.finished = false
+	r.regionCRC = 0
+	r.rowsRead = 0
+	r.streams = 0
+	clear(r.interned)
+	columns := r.pageState.columns
+	if len(columns) != len(s.Fields) {
+		columns = make([]decodedColumn, len(s.Fields))
+	} else {
+		clearGlobalStrings(columns)
+	}
+	r.pageState = decodedPage{columns: columns}
+	if r.projection != nil {
+		r.skip = projectionMask(s, r.projection)
+	}
+	r.compat = nil
+	if written := r.opts.WrittenWith; written != nil && written.Fingerprint() != s.Fingerprint() {
+		r.compat = newCompatReader(src, written, s, r.opts)
+	}
+}
+
+// clearGlobalStrings drops the global string tables of columns, which belong
+// to the stream that built them.
+func clearGlobalStrings(columns []decodedColumn) {
+	for i := range columns {
+		col := &columns[i]
+		col.globalStrings = false
+		col.stringOffsets = col.stringOffsets[:0]
+		col.stringLens = col.stringLens[:0]
+		col.stringArena = nil
+	}
+}
+
+// projectionMask marks the fields of s that projection leaves out.
+func projectionMask(s *schema.Schema, projection []string) []bool {
+	skip := make([]bool, len(s.Fields))
+	for i, field := range s.Fields {
+		skip[i] = !slices.Contains(projection, field.Name)
+	}
+	return skip
 }
 
 // ReadRow populates row with the next record. It returns false when the stream ends.
@@ -76,6 +219,9 @@ func (r *Reader) ReadRow(row Row) (bool, error) {
 	if row.schema != r.schema {
 		return false, ErrSchemaFingerprintMismatch
 	}
+	if r.compat != nil {
+		return r.compat.readRow(row)
+	}
 	if !r.headerRead {
 		if err := r.consumeHeader(); err != nil {
 			if errors.Is(err, io.EOF) {
@@ -95,6 +241,10 @@ func (r *Reader) ReadRow(row Row) (bool, error) {
 
 	idx := r.pageState.cursor
 	for fieldIdx, field := range r.schema.Fields {
+		if r.skip != nil && r.skip[fieldIdx] {
+			row.values[fieldIdx] = Value{}
+			continue
+		}
 		col := &r.pageState.columns[fieldIdx]
 		valueIdx := -1
 		if idx < len(col.rowIndexes) {
@@ -113,11 +263,11 @@ func (r *Reader) ReadRow(row Row) (bool, error) {
 			row.values[fieldIdx].Set = true
 		case schema.KindString, schema.KindTimestampTZ:
 			if valueIdx >= len(col.stringIndexes) {
-				return false, fmt.Errorf("codec: string index missing")
+				return false, fmt.Errorf("%w: string index missing", ErrCorruptPage)
 			}
 			dictIdx := col.stringIndexes[valueIdx]
 			if int(dictIdx) >= len(col.stringOffsets) {
-				return false, fmt.Errorf("codec: string index out of range")
+				return false, fmt.Errorf("%w: string index out of range", ErrCorruptPage)
 			}
 			offset := col.stringOffsets[dictIdx]
 			length := col.stringLens[dictIdx]
@@ -127,11 +277,11 @@ func (r *Reader) ReadRow(row Row) (bool, error) {
 				start := int(offset)
 				end := start + int(length)
 				if end > len(col.stringArena) {
-					return false, fmt.Errorf("codec: string slice out of bounds")
+					return false, fmt.Errorf("%w: string slice out of bounds", ErrCorruptPage)
 				}
 				// Use unsafe.String to avoid allocation - this is safe because
 				// the arena is kept alive for the duration of page processing
-				row.values[fieldIdx].Str = unsafe.String(&col.stringArena[start], int(length))
+				row.values[fieldIdx].Str = r.intern(unsafe.String(&col.stringArena[start], int(length)))
 			}
 			row.values[fieldIdx].Set = true
 		case schema.KindBool:
@@ -140,7 +290,7 @@ func (r *Reader) ReadRow(row Row) (bool, error) {
 		case schema.KindInt64:
 			row.values[fieldIdx].Int = col.ints[valueIdx]
 			row.values[fieldIdx].Set = true
-		case schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration:
+		case schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
 			row.values[fieldIdx].Int = col.ints[valueIdx]
 			row.values[fieldIdx].Set = true
 		case schema.KindFloat64:
@@ -169,6 +319,20 @@ func (r *Reader) ReadRow(row Row) (bool, error) {
 				row.values[fieldIdx].Borrowed = false
 			}
 			row.values[fieldIdx].Set = true
+		case schema.KindUUID:
+			start := valueIdx * column.UUIDSize
+			end := start + column.UUIDSize
+			if end > len(col.uuidArena) {
+				return false, fmt.Errorf("%w: uuid slice out of bounds", ErrCorruptPage)
+			}
+			// UUIDs are small and fixed width, so they always borrow the page buffer.
+			row.values[fieldIdx].Bytes = col.uuidArena[start:end:end]
+			row.values[fieldIdx].Borrowed = true
+			row.values[fieldIdx].Set = true
+		case schema.KindList:
+			if err := r.readListValue(&row.values[fieldIdx], col, field.ElemKind, valueIdx); err != nil {
+				return false, err
+			}
 		default:
 			return false, ErrUnknownField
 		}
@@ -177,8 +341,56 @@ func (r *Reader) ReadRow(row Row) (bool, error) {
 	return true, nil
 }
 
+// intern returns the reader's owned copy of s when InternStrings is set, and
+// s itself otherwise.
+func (r *Reader) intern(s string) string {
+	if r.interned == nil {
+		return s
+	}
+	if owned, ok := r.interned[s]; ok {
+		return owned
+	}
+	owned := strings.Clone(s)
+	r.interned[owned] = owned
+	return owned
+}
+
+// readListValue copies one row's elements into dst. Slices are allocated per
+// row because callers keep them; string elements borrow the page buffer
+// unless they are interned.
+func (r *Reader) readListValue(dst *Value, col *decodedColumn, elem schema.FieldKind, valueIdx int) error {
+	if valueIdx >= len(col.listCounts) {
+		return fmt.Errorf("%w: list count missing", ErrCorruptPage)
+	}
+	start := int(col.listStarts[valueIdx])
+	end := start + int(col.listCounts[valueIdx])
+	*dst = Value{Set: true}
+	switch elem {
+	case schema.KindString:
+		if end > len(col.stringIndexes) {
+			return fmt.Errorf("%w: list slice out of bounds", ErrCorruptPage)
+		}
+		dst.Strs = make([]string, 0, end-start)
+		for _, dictIdx := range col.stringIndexes[start:end] {
+			offset := int(col.stringOffsets[dictIdx])
+			dst.Strs = append(dst.Strs, r.intern(unsafe.String(unsafe.SliceData(col.stringArena[offset:]), int(col.stringLens[dictIdx]))))
+		}
+	case schema.KindUint64:
+		if end > len(col.uints) {
+			return fmt.Errorf("%w: list slice out of bounds", ErrCorruptPage)
+		}
+		dst.Uints = append(make([]uint64, 0, end-start), col.uints[start:end]...)
+	default:
+		return ErrUnknownField
+	}
+	return nil
+}
+
 // RowsRemainingHint returns the number of buffered rows left in the current page.
 func (r *Reader) RowsRemainingHint() int {
+	if r.compat != nil {
+		return r.compat.inner.RowsRemainingHint()
+	}
 	remaining := r.pageState.rows - r.pageState.cursor
 	if remaining < 0 {
 		return 0
@@ -186,58 +398,221 @@ func (r *Reader) RowsRemainingHint() int {
 	return remaining
 }
 
+// PayloadVersion reports the format version in the header of an SCRT
+// stream, without its feature flags.
+func PayloadVersion(data []byte) (int, error) {
+	if len(data) < headerSize {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if string(data[:len(magic)]) != magic {
+		return 0, ErrInvalidMagic
+	}
+	return int(data[len(magic)] &^ headerFlagMask), nil
+}
+
+// parseHeader validates a stream header and splits its version byte into the
+// base version and feature flags.
+func parseHeader(header []byte) (byte, byte, uint64, error) {
+	if string(header[:len(magic)]) != magic {
+		return 0, 0, 0, ErrInvalidMagic
+	}
+	versionByte := header[len(magic)]
+	base, flags := versionByte&^headerFlagMask, versionByte&headerFlagMask
+	switch {
+	case base == version && flags&^knownHeaderFlag == 0:
+	case base == version1 && flags == 0:
+		// Version 1 had no header flags.
+	case base == version || base == version1:
+		return 0, 0, 0, fmt.Errorf("%w: unknown flags %#x on version %d", ErrUnsupportedVersion, flags, base)
+	default:
+		return 0, 0, 0, fmt.Errorf("%w: version %d (this reader handles %d through %d)", ErrUnsupportedVersion, base, version1, version)
+	}
+	return base, flags, binary.LittleEndian.Uint64(header[len(magic)+1:]), nil
+}
+
 func (r *Reader) consumeHeader() error {
-	header := make([]byte, len(magic)+1+8)
+	header := make([]byte, headerSize)
 	if _, err := io.ReadFull(r.src, header); err != nil {
 		return err
 	}
-	if string(header[:len(magic)]) != magic {
-		return fmt.Errorf("codec: invalid magic header")
-	}
-	if header[len(magic)] != version {
-		return fmt.Errorf("codec: unsupported version %d", header[len(magic)])
+	base, flags, fp, err := parseHeader(header)
+	if err != nil {
+		return err
 	}
-	fp := binary.LittleEndian.Uint64(header[len(magic)+1:])
+	r.version = base
+	r.pageChecksums = flags&flagPageChecksums != 0
+	r.footer = flags&flagFooter != 0
+	r.streams++
 	if fp != r.schema.Fingerprint() {
+		if r.streams > 1 {
+			return fmt.Errorf("codec: stream %d: %w", r.streams, ErrSchemaFingerprintMismatch)
+		}
 		return ErrSchemaFingerprintMismatch
 	}
 	r.headerRead = true
 	return nil
 }
 
+// startStream consumes the header of the next concatenated stream and
+// drops the state of the one before it.
+func (r *Reader) startStream() error {
+	r.finished = false
+	r.regionCRC = 0
+	r.rowsRead = 0
+	clearGlobalStrings(r.pageState.columns)
+	if err := r.consumeHeader(); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// atHeader reports whether the unread input starts with the magic bytes.
+// A page never does: read as one, magic declares 82 columns and starts with
+// column 84, while pages list column 0 first.
+func (r *Reader) atHeader() bool {
+	next, _ := r.src.Peek(len(magic))
+	return string(next) == magic
+}
+
+// nextStream is called after a stream's terminator. It starts the stream
+// that follows, or reports io.EOF at the end of the input.
+func (r *Reader) nextStream() error {
+	if _, err := r.src.Peek(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			r.finished = true
+		}
+		return err
+	}
+	if !r.atHeader() {
+		return fmt.Errorf("%w %d", ErrTrailingData, r.streams)
+	}
+	return r.startStream()
+}
+
+// Verify reads the rest of the stream and checks its footer. It returns
+// ErrMissingFooter for streams written without one.
+func (r *Reader) Verify() error {
+	if r.compat != nil {
+		return r.compat.inner.Verify()
+	}
+	if !r.headerRead {
+		if err := r.consumeHeader(); err != nil {
+			return err
+		}
+	}
+	if !r.footer {
+		return ErrMissingFooter
+	}
+	for {
+		if err := r.loadPage(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
 func (r *Reader) loadPage() error {
+	if r.finished {
+		return io.EOF
+	}
+	for r.concatenated && r.atHeader() {
+		// The stream ended after its last page without a terminator.
+		if r.footer {
+			return fmt.Errorf("codec: stream %d ends without its footer: %w", r.streams, io.ErrUnexpectedEOF)
+		}
+		if err := r.startStream(); err != nil {
+			return err
+		}
+	}
 	length, err := binary.ReadUvarint(r.src)
 	if err != nil {
+		if r.footer && errors.Is(err, io.EOF) {
+			// A footed stream must end with its terminator.
+			return io.ErrUnexpectedEOF
+		}
 		return err
 	}
 	if length == 0 {
+		if r.footer {
+			if err := r.readFooter(); err != nil {
+				return err
+			}
+		}
+		if r.concatenated {
+			if err := r.nextStream(); err != nil {
+				return err
+			}
+			return r.loadPage()
+		}
+		r.finished = true
 		return io.EOF
 	}
-	if cap(r.pageState.rawBytes) < int(length) {
+	if r.opts.KeepPages || cap(r.pageState.rawBytes) < int(length) {
 		r.pageState.rawBytes = make([]byte, int(length))
 	}
 	buf := r.pageState.rawBytes[:int(length)]
 	if _, err := io.ReadFull(r.src, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
 		return err
 	}
-	return r.decodePage(buf)
+	if r.footer {
+		r.regionCRC = crc32.Update(r.regionCRC, castagnoli, binary.AppendUvarint(nil, length))
+		r.regionCRC = crc32.Update(r.regionCRC, castagnoli, buf)
+	}
+	if r.pageChecksums {
+		if len(buf) < pageChecksumSize {
+			return io.ErrUnexpectedEOF
+		}
+		body := buf[:len(buf)-pageChecksumSize]
+		if crc32.Checksum(body, castagnoli) != binary.LittleEndian.Uint32(buf[len(body):]) {
+			return ErrPageChecksum
+		}
+		buf = body
+	}
+	decode := r.decodePage
+	if r.version == version1 {
+		decode = r.decodePageV1
+	}
+	if err := decode(buf); err != nil {
+		return err
+	}
+	r.rowsRead += uint64(r.pageState.rows)
+	return nil
+}
+
+func (r *Reader) readFooter() error {
+	var footer [footerSize]byte
+	if _, err := io.ReadFull(r.src, footer[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return checkFooter(footer[:], r.regionCRC, r.rowsRead)
 }
 
 func (r *Reader) decodePage(raw []byte) error {
 	r.pageState.cursor = 0
 	rows, n := binary.Uvarint(raw)
 	if n <= 0 {
-		return fmt.Errorf("codec: malformed row count")
+		return fmt.Errorf("%w: malformed row count", ErrCorruptPage)
 	}
 	raw = raw[n:]
 
 	columnCount, n := binary.Uvarint(raw)
 	if n <= 0 {
-		return fmt.Errorf("codec: malformed column count")
+		return fmt.Errorf("%w: malformed column count", ErrCorruptPage)
 	}
 	raw = raw[n:]
 	if int(columnCount) != len(r.schema.Fields) {
-		return fmt.Errorf("codec: column count mismatch")
+		return fmt.Errorf("%w: page has %d columns, schema %s has %d fields", ErrColumnCountMismatch, columnCount, r.schema.Name, len(r.schema.Fields))
 	}
 
 	if len(r.pageState.columns) != len(r.schema.Fields) {
@@ -247,17 +622,31 @@ func (r *Reader) decodePage(raw []byte) error {
 	for i := 0; i < int(columnCount); i++ {
 		fieldIdx, consumed := binary.Uvarint(raw)
 		if consumed <= 0 {
-			return fmt.Errorf("codec: malformed field index")
+			return fmt.Errorf("%w: malformed field index", ErrCorruptPage)
 		}
 		raw = raw[consumed:]
 		if len(raw) == 0 {
 			return io.ErrUnexpectedEOF
 		}
-		kind := schema.FieldKind(raw[0])
+		kindByte := raw[0]
+		kind := schema.FieldKind(kindByte &^ (page.GlobalDictFlag | page.OffsetTZFlag | page.PlainStringFlag | page.NarrowIntFlag))
+		global := kindByte&page.GlobalDictFlag != 0
+		offsetTZ := kindByte&page.OffsetTZFlag != 0
+		plain := kindByte&page.PlainStringFlag != 0
+		narrow := kindByte&page.NarrowIntFlag != 0
+		if offsetTZ && kind != schema.KindTimestampTZ {
+			return fmt.Errorf("%w: offset encoding on field kind %d", ErrCorruptPage, kind)
+		}
+		if plain && (kind != schema.KindString || global) {
+			return fmt.Errorf("%w: plain encoding on field kind %d", ErrCorruptPage, kind)
+		}
+		if narrow && !narrowKind(kind) {
+			return fmt.Errorf("%w: narrow encoding on field kind %d", ErrCorruptPage, kind)
+		}
 		raw = raw[1:]
 		payloadLen, consumed := binary.Uvarint(raw)
 		if consumed <= 0 {
-			return fmt.Errorf("codec: malformed payload length")
+			return fmt.Errorf("%w: malformed payload length", ErrCorruptPage)
 		}
 		raw = raw[consumed:]
 		if len(raw) < int(payloadLen) {
@@ -265,6 +654,14 @@ func (r *Reader) decodePage(raw []byte) error {
 		}
 		payload := raw[:payloadLen]
 		raw = raw[payloadLen:]
+		if int(fieldIdx) >= len(r.pageState.columns) {
+			return fmt.Errorf("%w: field index %d out of range", ErrCorruptPage, fieldIdx)
+		}
+		// Global string tables accumulate across pages, so those columns are
+		// decoded even when projected out.
+		if r.skip != nil && r.skip[fieldIdx] && !global {
+			continue
+		}
 		col := &r.pageState.columns[int(fieldIdx)]
 		col.kind = kind
 		indexes, setCount, consumed, err := decodePresence(payload, int(rows), col.rowIndexes)
@@ -278,13 +675,50 @@ func (r *Reader) decodePage(raw []byte) error {
 		payload = payload[consumed:]
 		switch kind {
 		case schema.KindUint64, schema.KindRef:
-			values, err := decodeUintColumn(payload, col.uints, setCount)
+			decode := decodeUintColumn
+			if narrow {
+				decode = decodeNarrowUintColumn
+			}
+			values, err := decode(payload, col.uints, setCount)
 			if err != nil {
 				return err
 			}
 			col.uints = values
 		case schema.KindString, schema.KindTimestampTZ:
-			offsets, lens, indexes, arena, err := decodeStringColumn(payload, col.stringOffsets, col.stringLens, col.stringIndexes, setCount)
+			if offsetTZ {
+				col.globalStrings = false
+				if r.opts.KeepPages {
+					// Strings must outlive the page, like the page buffer.
+					col.tzArena = nil
+				}
+				if err := decodeOffsetTZColumn(col, payload, setCount); err != nil {
+					return err
+				}
+				break
+			}
+			if global {
+				if !col.globalStrings {
+					col.stringOffsets = col.stringOffsets[:0]
+					col.stringLens = col.stringLens[:0]
+					col.stringArena = nil
+					col.globalStrings = true
+				}
+				offsets, lens, indexes, arena, err := decodeGlobalStringColumn(payload, col.stringOffsets, col.stringLens, col.stringIndexes, col.stringArena, setCount)
+				if err != nil {
+					return err
+				}
+				col.stringOffsets = offsets
+				col.stringLens = lens
+				col.stringIndexes = indexes
+				col.stringArena = arena
+				break
+			}
+			col.globalStrings = false
+			decode := decodeStringColumn
+			if plain {
+				decode = decodePlainStringColumn
+			}
+			offsets, lens, indexes, arena, err := decode(payload, col.stringOffsets, col.stringLens, col.stringIndexes, setCount)
 			if err != nil {
 				return err
 			}
@@ -298,14 +732,12 @@ func (r *Reader) decodePage(raw []byte) error {
 				return err
 			}
 			col.bools = values
-		case schema.KindInt64:
-			values, err := decodeIntColumn(payload, col.ints, setCount)
-			if err != nil {
-				return err
+		case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
+			decode := decodeIntColumn
+			if narrow {
+				decode = decodeNarrowIntColumn
 			}
-			col.ints = values
-		case schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration:
-			values, err := decodeIntColumn(payload, col.ints, setCount)
+			values, err := decode(payload, col.ints, setCount)
 			if err != nil {
 				return err
 			}
@@ -324,8 +756,18 @@ func (r *Reader) decodePage(raw []byte) error {
 			col.byteOffsets = offsets
 			col.byteLens = lengths
 			col.byteArena = arena
+		case schema.KindUUID:
+			arena, err := decodeUUIDColumn(payload, setCount)
+			if err != nil {
+				return err
+			}
+			col.uuidArena = arena
+		case schema.KindList:
+			if err := r.decodeListColumn(col, r.schema.Fields[fieldIdx].ElemKind, payload, setCount); err != nil {
+				return err
+			}
 		default:
-			return fmt.Errorf("codec: unsupported field kind %d", kind)
+			return fmt.Errorf("%w: unsupported field kind %d", ErrCorruptPage, kind)
 		}
 	}
 
@@ -333,10 +775,102 @@ func (r *Reader) decodePage(raw []byte) error {
 	return nil
 }
 
+// decodeOffsetTZColumn reads the length-prefixed instant column followed by
+// the offset column of a timestamptz field, and rebuilds the stored strings
+// once per page into col.tzArena, which then serves as the column's string
+// arena with one entry per value.
+func decodeOffsetTZColumn(col *decodedColumn, data []byte, expected int) error {
+	instantLen, n := binary.Uvarint(data)
+	if n <= 0 {
+		return fmt.Errorf("%w: malformed timestamptz instant length", ErrCorruptPage)
+	}
+	data = data[n:]
+	if uint64(len(data)) < instantLen {
+		return io.ErrUnexpectedEOF
+	}
+	instants, err := decodeIntColumn(data[:instantLen], col.ints, expected)
+	if err != nil {
+		return err
+	}
+	offsets, err := decodeIntColumn(data[instantLen:], col.tzOffsets, expected)
+	if err != nil {
+		return err
+	}
+	col.ints, col.tzOffsets = instants, offsets
+	if len(offsets) != len(instants) {
+		return fmt.Errorf("%w: timestamptz offset missing", ErrCorruptPage)
+	}
+	arena := col.tzArena[:0]
+	stringOffsets := ensureUint32Slice(col.stringOffsets, len(instants))[:len(instants)]
+	stringLens := ensureUint32Slice(col.stringLens, len(instants))[:len(instants)]
+	indexes := ensureUint32Slice(col.stringIndexes, len(instants))[:len(instants)]
+	var format tzFormatter
+	for i, instant := range instants {
+		start := len(arena)
+		arena = format.append(arena, instant, offsets[i])
+		stringOffsets[i] = uint32(start)
+		stringLens[i] = uint32(len(arena) - start)
+		indexes[i] = uint32(i)
+	}
+	col.tzArena, col.stringArena = arena, arena
+	col.stringOffsets = stringOffsets
+	col.stringLens = stringLens
+	col.stringIndexes = indexes
+	return nil
+}
+
+// decodeListColumn reads the per-row element counts followed by the element
+// column, and records where each row's elements start.
+func (r *Reader) decodeListColumn(col *decodedColumn, elem schema.FieldKind, data []byte, expected int) error {
+	countLen, n := binary.Uvarint(data)
+	if n <= 0 {
+		return fmt.Errorf("%w: malformed list count length", ErrCorruptPage)
+	}
+	data = data[n:]
+	if uint64(len(data)) < countLen {
+		return io.ErrUnexpectedEOF
+	}
+	counts, err := decodeUintColumn(data[:countLen], col.listCounts, expected)
+	if err != nil {
+		return err
+	}
+	col.listCounts = counts
+	data = data[countLen:]
+	col.listStarts = ensureUint32Slice(col.listStarts, len(counts))
+	total := uint64(0)
+	for i, count := range counts {
+		col.listStarts[i] = uint32(total)
+		total += count
+		if total > math.MaxUint32 {
+			return fmt.Errorf("%w: list column too large", ErrCorruptPage)
+		}
+	}
+	switch elem {
+	case schema.KindString:
+		offsets, lens, indexes, arena, err := decodeStringColumn(data, col.stringOffsets, col.stringLens, col.stringIndexes, int(total))
+		if err != nil {
+			return err
+		}
+		col.stringOffsets = offsets
+		col.stringLens = lens
+		col.stringIndexes = indexes
+		col.stringArena = arena
+	case schema.KindUint64:
+		values, err := decodeUintColumn(data, col.uints, int(total))
+		if err != nil {
+			return err
+		}
+		col.uints = values
+	default:
+		return fmt.Errorf("%w: unsupported list element kind %d", ErrCorruptPage, elem)
+	}
+	return nil
+}
+
 func decodePresence(data []byte, rows int, dst []int32) ([]int32, int, int, error) {
 	byteLen, n := binary.Uvarint(data)
 	if n <= 0 {
-		return nil, 0, 0, fmt.Errorf("codec: malformed presence length")
+		return nil, 0, 0, fmt.Errorf("%w: malformed presence length", ErrCorruptPage)
 	}
 	data = data[n:]
 	if len(data) < int(byteLen) {
@@ -367,7 +901,7 @@ func decodePresence(data []byte, rows int, dst []int32) ([]int32, int, int, erro
 func decodeStringColumn(data []byte, offsets, lengths, indexes []uint32, expected int) ([]uint32, []uint32, []uint32, []byte, error) {
 	dictLen, n := binary.Uvarint(data)
 	if n <= 0 {
-		return nil, nil, nil, nil, fmt.Errorf("codec: malformed dictionary length")
+		return nil, nil, nil, nil, fmt.Errorf("%w: malformed dictionary length", ErrCorruptPage)
 	}
 	data = data[n:]
 	dictBytes := data
@@ -377,7 +911,7 @@ func decodeStringColumn(data []byte, offsets, lengths, indexes []uint32, expecte
 	for i := 0; i < int(dictLen); i++ {
 		length, consumed := binary.Uvarint(dictBytes[cursor:])
 		if consumed <= 0 {
-			return nil, nil, nil, nil, fmt.Errorf("codec: malformed string length")
+			return nil, nil, nil, nil, fmt.Errorf("%w: malformed string length", ErrCorruptPage)
 		}
 		cursor += consumed
 		if len(dictBytes) < cursor+int(length) {
@@ -391,23 +925,110 @@ func decodeStringColumn(data []byte, offsets, lengths, indexes []uint32, expecte
 	data = dictBytes[cursor:]
 	indexLen, consumed := binary.Uvarint(data)
 	if consumed <= 0 {
-		return nil, nil, nil, nil, fmt.Errorf("codec: malformed index length")
+		return nil, nil, nil, nil, fmt.Errorf("%w: malformed index length", ErrCorruptPage)
 	}
 	data = data[consumed:]
 	indexes = ensureUint32Slice(indexes, int(indexLen))
 	for i := 0; i < int(indexLen); i++ {
 		idx, used := binary.Uvarint(data)
 		if used <= 0 {
-			return nil, nil, nil, nil, fmt.Errorf("codec: malformed string index")
+			return nil, nil, nil, nil, fmt.Errorf("%w: malformed string index", ErrCorruptPage)
 		}
 		data = data[used:]
 		if idx >= dictLen {
-			return nil, nil, nil, nil, fmt.Errorf("codec: string index out of range")
+			return nil, nil, nil, nil, fmt.Errorf("%w: string index out of range", ErrCorruptPage)
 		}
 		indexes[i] = uint32(idx)
 	}
 	if int(indexLen) != expected {
-		return nil, nil, nil, nil, fmt.Errorf("codec: string index length %d != expected %d", indexLen, expected)
+		return nil, nil, nil, nil, fmt.Errorf("%w: string index length %d != expected %d", ErrCorruptPage, indexLen, expected)
+	}
+	return offsets, lengths, indexes, arena, nil
+}
+
+// decodePlainStringColumn reads a plain string column: the value count and
+// each value length-prefixed in row order. It fills the same tables as
+// decodeStringColumn, with every row indexing its own entry.
+func decodePlainStringColumn(data []byte, offsets, lengths, indexes []uint32, expected int) ([]uint32, []uint32, []uint32, []byte, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, nil, nil, nil, fmt.Errorf("%w: malformed value count", ErrCorruptPage)
+	}
+	if count != uint64(expected) {
+		return nil, nil, nil, nil, fmt.Errorf("%w: string value count %d != expected %d", ErrCorruptPage, count, expected)
+	}
+	data = data[n:]
+	offsets = ensureUint32Slice(offsets, expected)
+	lengths = ensureUint32Slice(lengths, expected)
+	indexes = ensureUint32Slice(indexes, expected)
+	cursor := 0
+	for i := 0; i < expected; i++ {
+		length, consumed := binary.Uvarint(data[cursor:])
+		if consumed <= 0 {
+			return nil, nil, nil, nil, fmt.Errorf("%w: malformed string length", ErrCorruptPage)
+		}
+		cursor += consumed
+		if uint64(len(data)-cursor) < length {
+			return nil, nil, nil, nil, io.ErrUnexpectedEOF
+		}
+		offsets[i] = uint32(cursor)
+		lengths[i] = uint32(length)
+		indexes[i] = uint32(i)
+		cursor += int(length)
+	}
+	return offsets, lengths, indexes, data[:cursor], nil
+}
+
+// decodeGlobalStringColumn appends the page's new dictionary entries to the
+// stream-wide table held in offsets/lengths/arena. Entries are copied out of
+// the page buffer because later pages keep referencing them.
+func decodeGlobalStringColumn(data []byte, offsets, lengths, indexes []uint32, arena []byte, expected int) ([]uint32, []uint32, []uint32, []byte, error) {
+	base, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, nil, nil, nil, fmt.Errorf("%w: malformed dictionary base", ErrCorruptPage)
+	}
+	if base != uint64(len(offsets)) {
+		return nil, nil, nil, nil, fmt.Errorf("%w: dictionary base %d != table size %d", ErrCorruptPage, base, len(offsets))
+	}
+	data = data[n:]
+	added, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, nil, nil, nil, fmt.Errorf("%w: malformed dictionary length", ErrCorruptPage)
+	}
+	data = data[n:]
+	for i := 0; i < int(added); i++ {
+		length, consumed := binary.Uvarint(data)
+		if consumed <= 0 {
+			return nil, nil, nil, nil, fmt.Errorf("%w: malformed string length", ErrCorruptPage)
+		}
+		data = data[consumed:]
+		if uint64(len(data)) < length {
+			return nil, nil, nil, nil, io.ErrUnexpectedEOF
+		}
+		offsets = append(offsets, uint32(len(arena)))
+		lengths = append(lengths, uint32(length))
+		arena = append(arena, data[:length]...)
+		data = data[length:]
+	}
+	indexLen, consumed := binary.Uvarint(data)
+	if consumed <= 0 {
+		return nil, nil, nil, nil, fmt.Errorf("%w: malformed index length", ErrCorruptPage)
+	}
+	if int(indexLen) != expected {
+		return nil, nil, nil, nil, fmt.Errorf("%w: string index length %d != expected %d", ErrCorruptPage, indexLen, expected)
+	}
+	data = data[consumed:]
+	indexes = ensureUint32Slice(indexes, int(indexLen))
+	for i := 0; i < int(indexLen); i++ {
+		idx, used := binary.Uvarint(data)
+		if used <= 0 {
+			return nil, nil, nil, nil, fmt.Errorf("%w: malformed string index", ErrCorruptPage)
+		}
+		data = data[used:]
+		if idx >= uint64(len(offsets)) {
+			return nil, nil, nil, nil, fmt.Errorf("%w: string index out of range", ErrCorruptPage)
+		}
+		indexes[i] = uint32(idx)
 	}
 	return offsets, lengths, indexes, arena, nil
 }
@@ -415,14 +1036,14 @@ func decodeStringColumn(data []byte, offsets, lengths, indexes []uint32, expecte
 func decodeBoolColumn(data []byte, dst []bool, expected int) ([]bool, error) {
 	count, n := binary.Uvarint(data)
 	if n <= 0 {
-		return nil, fmt.Errorf("codec: malformed bool column length")
+		return nil, fmt.Errorf("%w: malformed bool column length", ErrCorruptPage)
 	}
 	data = data[n:]
 	if len(data) < int(count) {
 		return nil, io.ErrUnexpectedEOF
 	}
 	if int(count) != expected {
-		return nil, fmt.Errorf("codec: bool column count %d != expected %d", count, expected)
+		return nil, fmt.Errorf("%w: bool column count %d != expected %d", ErrCorruptPage, count, expected)
 	}
 	dst = ensureBoolSlice(dst, int(count))
 	for i := 0; i < int(count); i++ {
@@ -434,12 +1055,12 @@ func decodeBoolColumn(data []byte, dst []bool, expected int) ([]bool, error) {
 func decodeUintColumn(data []byte, dst []uint64, expected int) ([]uint64, error) {
 	header, n := binary.Uvarint(data)
 	if n <= 0 {
-		return nil, fmt.Errorf("codec: malformed uint column length")
+		return nil, fmt.Errorf("%w: malformed uint column length", ErrCorruptPage)
 	}
 	mode := header & 1
 	count := int(header >> 1)
 	if count != expected {
-		return nil, fmt.Errorf("codec: uint column count %d != expected %d", count, expected)
+		return nil, fmt.Errorf("%w: uint column count %d != expected %d", ErrCorruptPage, count, expected)
 	}
 	data = data[n:]
 	dst = ensureUint64Slice(dst, count)
@@ -451,7 +1072,7 @@ func decodeUintColumn(data []byte, dst []uint64, expected int) ([]uint64, error)
 		for i := 0; i < count; i++ {
 			v, consumed := binary.Uvarint(data)
 			if consumed <= 0 {
-				return nil, fmt.Errorf("codec: malformed uint value")
+				return nil, fmt.Errorf("%w: malformed uint value", ErrCorruptPage)
 			}
 			dst[i] = v
 			data = data[consumed:]
@@ -459,7 +1080,7 @@ func decodeUintColumn(data []byte, dst []uint64, expected int) ([]uint64, error)
 	case 1:
 		first, consumed := binary.Uvarint(data)
 		if consumed <= 0 {
-			return nil, fmt.Errorf("codec: malformed delta base")
+			return nil, fmt.Errorf("%w: malformed delta base", ErrCorruptPage)
 		}
 		dst[0] = first
 		data = data[consumed:]
@@ -467,14 +1088,14 @@ func decodeUintColumn(data []byte, dst []uint64, expected int) ([]uint64, error)
 		for i := 1; i < count; i++ {
 			delta, used := binary.Uvarint(data)
 			if used <= 0 {
-				return nil, fmt.Errorf("codec: malformed delta value")
+				return nil, fmt.Errorf("%w: malformed delta value", ErrCorruptPage)
 			}
 			prev += delta
 			dst[i] = prev
 			data = data[used:]
 		}
 	default:
-		return nil, fmt.Errorf("codec: unknown uint column mode %d", mode)
+		return nil, fmt.Errorf("%w: unknown uint column mode %d", ErrCorruptPage, mode)
 	}
 	return dst[:count], nil
 }
@@ -482,12 +1103,12 @@ func decodeUintColumn(data []byte, dst []uint64, expected int) ([]uint64, error)
 func decodeIntColumn(data []byte, dst []int64, expected int) ([]int64, error) {
 	header, n := binary.Uvarint(data)
 	if n <= 0 {
-		return nil, fmt.Errorf("codec: malformed int column length")
+		return nil, fmt.Errorf("%w: malformed int column length", ErrCorruptPage)
 	}
 	mode := header & 1
 	count := int(header >> 1)
 	if count != expected {
-		return nil, fmt.Errorf("codec: int column count %d != expected %d", count, expected)
+		return nil, fmt.Errorf("%w: int column count %d != expected %d", ErrCorruptPage, count, expected)
 	}
 	data = data[n:]
 	dst = ensureInt64Slice(dst, count)
@@ -499,7 +1120,7 @@ func decodeIntColumn(data []byte, dst []int64, expected int) ([]int64, error) {
 		for i := 0; i < count; i++ {
 			v, consumed := binary.Varint(data)
 			if consumed <= 0 {
-				return nil, fmt.Errorf("codec: malformed int value")
+				return nil, fmt.Errorf("%w: malformed int value", ErrCorruptPage)
 			}
 			dst[i] = v
 			data = data[consumed:]
@@ -507,7 +1128,7 @@ func decodeIntColumn(data []byte, dst []int64, expected int) ([]int64, error) {
 	case 1:
 		first, consumed := binary.Varint(data)
 		if consumed <= 0 {
-			return nil, fmt.Errorf("codec: malformed delta base")
+			return nil, fmt.Errorf("%w: malformed delta base", ErrCorruptPage)
 		}
 		dst[0] = first
 		data = data[consumed:]
@@ -515,14 +1136,118 @@ func decodeIntColumn(data []byte, dst []int64, expected int) ([]int64, error) {
 		for i := 1; i < count; i++ {
 			delta, used := binary.Varint(data)
 			if used <= 0 {
-				return nil, fmt.Errorf("codec: malformed delta value")
+				return nil, fmt.Errorf("%w: malformed delta value", ErrCorruptPage)
 			}
 			acc += delta
 			dst[i] = acc
 			data = data[used:]
 		}
 	default:
-		return nil, fmt.Errorf("codec: unknown int column mode %d", mode)
+		return nil, fmt.Errorf("%w: unknown int column mode %d", ErrCorruptPage, mode)
+	}
+	return dst[:count], nil
+}
+
+// narrowKind reports whether columns of kind may carry page.NarrowIntFlag.
+func narrowKind(kind schema.FieldKind) bool {
+	switch kind {
+	case schema.KindUint64, schema.KindRef, schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
+		return true
+	}
+	return false
+}
+
+// decodeNarrowHeader reads the count and mode header of a narrow integer
+// column and, for a non-empty column, its width byte.
+func decodeNarrowHeader(data []byte, expected int) (count int, mode uint64, width int, rest []byte, err error) {
+	header, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, 0, nil, fmt.Errorf("%w: malformed narrow column length", ErrCorruptPage)
+	}
+	mode = header & 1
+	count = int(header >> 1)
+	if count != expected {
+		return 0, 0, 0, nil, fmt.Errorf("%w: narrow column count %d != expected %d", ErrCorruptPage, count, expected)
+	}
+	data = data[n:]
+	if count == 0 {
+		return 0, mode, 0, data, nil
+	}
+	if len(data) == 0 {
+		return 0, 0, 0, nil, io.ErrUnexpectedEOF
+	}
+	width = int(data[0])
+	switch width {
+	case 1, 2, 4, 8:
+	default:
+		return 0, 0, 0, nil, fmt.Errorf("%w: narrow column width %d", ErrCorruptPage, width)
+	}
+	return count, mode, width, data[1:], nil
+}
+
+// readFixed decodes count little-endian values of width bytes from data.
+func readFixed(data []byte, width, count int, put func(i int, v uint64)) error {
+	if len(data) < width*count {
+		return io.ErrUnexpectedEOF
+	}
+	var tmp [8]byte
+	for i := 0; i < count; i++ {
+		copy(tmp[:], data[i*width:(i+1)*width])
+		put(i, binary.LittleEndian.Uint64(tmp[:]))
+	}
+	return nil
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func decodeNarrowUintColumn(data []byte, dst []uint64, expected int) ([]uint64, error) {
+	count, mode, width, data, err := decodeNarrowHeader(data, expected)
+	if err != nil {
+		return nil, err
+	}
+	dst = ensureUint64Slice(dst, count)
+	if count == 0 {
+		return dst[:0], nil
+	}
+	if mode == 0 {
+		err = readFixed(data, width, count, func(i int, v uint64) { dst[i] = v })
+	} else {
+		base, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("%w: malformed delta base", ErrCorruptPage)
+		}
+		dst[0] = base
+		err = readFixed(data[n:], width, count-1, func(i int, delta uint64) { dst[i+1] = dst[i] + delta })
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dst[:count], nil
+}
+
+func decodeNarrowIntColumn(data []byte, dst []int64, expected int) ([]int64, error) {
+	count, mode, width, data, err := decodeNarrowHeader(data, expected)
+	if err != nil {
+		return nil, err
+	}
+	dst = ensureInt64Slice(dst, count)
+	if count == 0 {
+		return dst[:0], nil
+	}
+	if mode == 0 {
+		err = readFixed(data, width, count, func(i int, v uint64) { dst[i] = unzigzag(v) })
+	} else {
+		base, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("%w: malformed delta base", ErrCorruptPage)
+		}
+		dst[0] = base
+		err = readFixed(data[n:], width, count-1, func(i int, delta uint64) { dst[i+1] = dst[i] + unzigzag(delta) })
+	}
+	if err != nil {
+		return nil, err
 	}
 	return dst[:count], nil
 }
@@ -530,11 +1255,11 @@ func decodeIntColumn(data []byte, dst []int64, expected int) ([]int64, error) {
 func decodeFloatColumn(data []byte, dst []float64, expected int) ([]float64, error) {
 	count, n := binary.Uvarint(data)
 	if n <= 0 {
-		return nil, fmt.Errorf("codec: malformed float column length")
+		return nil, fmt.Errorf("%w: malformed float column length", ErrCorruptPage)
 	}
 	data = data[n:]
 	if int(count) != expected {
-		return nil, fmt.Errorf("codec: float column count %d != expected %d", count, expected)
+		return nil, fmt.Errorf("%w: float column count %d != expected %d", ErrCorruptPage, count, expected)
 	}
 	dst = ensureFloat64Slice(dst, int(count))
 	for i := 0; i < int(count); i++ {
@@ -551,19 +1276,19 @@ func decodeFloatColumn(data []byte, dst []float64, expected int) ([]float64, err
 func decodeBytesColumn(data []byte, offsets, lengths []uint32, expected int) ([]uint32, []uint32, []byte, error) {
 	count, n := binary.Uvarint(data)
 	if n <= 0 {
-		return nil, nil, nil, fmt.Errorf("codec: malformed bytes column length")
+		return nil, nil, nil, fmt.Errorf("%w: malformed bytes column length", ErrCorruptPage)
 	}
 	idx := n
 	payloadStart := idx
 	if int(count) != expected {
-		return nil, nil, nil, fmt.Errorf("codec: bytes column count %d != expected %d", count, expected)
+		return nil, nil, nil, fmt.Errorf("%w: bytes column count %d != expected %d", ErrCorruptPage, count, expected)
 	}
 	offsets = ensureUint32Slice(offsets, int(count))
 	lengths = ensureUint32Slice(lengths, int(count))
 	for i := 0; i < int(count); i++ {
 		length, consumed := binary.Uvarint(data[idx:])
 		if consumed <= 0 {
-			return nil, nil, nil, fmt.Errorf("codec: malformed bytes length")
+			return nil, nil, nil, fmt.Errorf("%w: malformed bytes length", ErrCorruptPage)
 		}
 		idx += consumed
 		if len(data) < idx+int(length) {
@@ -577,6 +1302,22 @@ func decodeBytesColumn(data []byte, offsets, lengths []uint32, expected int) ([]
 	return offsets, lengths, arena, nil
 }
 
+func decodeUUIDColumn(data []byte, expected int) ([]byte, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: malformed uuid column length", ErrCorruptPage)
+	}
+	data = data[n:]
+	if int(count) != expected {
+		return nil, fmt.Errorf("%w: uuid column count %d != expected %d", ErrCorruptPage, count, expected)
+	}
+	size := int(count) * column.UUIDSize
+	if len(data) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data[:size], nil
+}
+
 func cloneBytes(src []byte) []byte {
 	if src == nil {
 		return nil
@@ -683,13 +1424,24 @@ func growCapacity(current, needed int) int {
 	return current
 }
 
+// StaticDefault returns the value a reader fills in when field is absent
+// from a row: its literal default. Fields without one, or with a default
+// function, report false.
+func StaticDefault(field schema.Field) (Value, bool) {
+	var v Value
+	assignDefaultValue(&v, field)
+	return v, v.Set
+}
+
 func assignDefaultValue(dst *Value, field schema.Field) {
 	if dst == nil {
 		return
 	}
 	*dst = Value{}
 	def := field.Default
-	if def == nil {
+	if def == nil || def.Dynamic() {
+		// A default function was evaluated when the row was written, so an
+		// absent value means the row predates it and stays unset.
 		return
 	}
 	dst.Set = true
@@ -710,10 +1462,18 @@ func assignDefaultValue(dst *Value, field schema.Field) {
 			copy(buf, def.Bytes)
 			dst.Bytes = buf
 		}
-	case schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration:
+	case schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
 		dst.Int = def.Int
 	case schema.KindTimestampTZ:
 		dst.Str = def.String
+	case schema.KindUUID:
+		if len(def.Bytes) == column.UUIDSize {
+			buf := make([]byte, column.UUIDSize)
+			copy(buf, def.Bytes)
+			dst.Bytes = buf
+		} else {
+			dst.Set = false
+		}
 	default:
 		dst.Set = false
 	}
@@ -0,0 +1,162 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+// decodePageV1 decodes a version 1 page. Version 1 shares the version 2 page
+// and column framing but predates presence bitmaps, so every column holds a
+// value for every row, and integer columns are a uvarint count followed by
+// plain (zigzag for signed) varints with no delta mode. It knows the scalar
+// and temporal kinds only; uuid and list fields came with version 2, as did
+// the global dictionary and offset-encoded timestamptz column flags.
+func (r *Reader) decodePageV1(raw []byte) error {
+	r.pageState.cursor = 0
+	rows, n := binary.Uvarint(raw)
+	if n <= 0 {
+		return fmt.Errorf("%w: malformed row count", ErrCorruptPage)
+	}
+	raw = raw[n:]
+	columnCount, n := binary.Uvarint(raw)
+	if n <= 0 {
+		return fmt.Errorf("%w: malformed column count", ErrCorruptPage)
+	}
+	raw = raw[n:]
+	if int(columnCount) != len(r.schema.Fields) {
+		return fmt.Errorf("%w: page has %d columns, schema %s has %d fields", ErrColumnCountMismatch, columnCount, r.schema.Name, len(r.schema.Fields))
+	}
+	if len(r.pageState.columns) != len(r.schema.Fields) {
+		r.pageState.columns = make([]decodedColumn, len(r.schema.Fields))
+	}
+
+	for i := 0; i < int(columnCount); i++ {
+		fieldIdx, consumed := binary.Uvarint(raw)
+		if consumed <= 0 {
+			return fmt.Errorf("%w: malformed field index", ErrCorruptPage)
+		}
+		raw = raw[consumed:]
+		if len(raw) == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		kind := schema.FieldKind(raw[0])
+		raw = raw[1:]
+		payloadLen, consumed := binary.Uvarint(raw)
+		if consumed <= 0 {
+			return fmt.Errorf("%w: malformed payload length", ErrCorruptPage)
+		}
+		raw = raw[consumed:]
+		if len(raw) < int(payloadLen) {
+			return io.ErrUnexpectedEOF
+		}
+		payload := raw[:payloadLen]
+		raw = raw[payloadLen:]
+		if int(fieldIdx) >= len(r.pageState.columns) {
+			return fmt.Errorf("%w: field index %d out of range", ErrCorruptPage, fieldIdx)
+		}
+		if r.skip != nil && r.skip[fieldIdx] {
+			continue
+		}
+		col := &r.pageState.columns[int(fieldIdx)]
+		col.kind = kind
+		col.globalStrings = false
+		col.rowIndexes = ensureInt32Slice(col.rowIndexes, int(rows))[:rows]
+		for row := range col.rowIndexes {
+			col.rowIndexes[row] = int32(row)
+		}
+		expected := int(rows)
+		switch kind {
+		case schema.KindUint64, schema.KindRef:
+			values, err := decodeUintColumnV1(payload, col.uints, expected)
+			if err != nil {
+				return err
+			}
+			col.uints = values
+		case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
+			values, err := decodeIntColumnV1(payload, col.ints, expected)
+			if err != nil {
+				return err
+			}
+			col.ints = values
+		case schema.KindString, schema.KindTimestampTZ:
+			offsets, lens, indexes, arena, err := decodeStringColumn(payload, col.stringOffsets, col.stringLens, col.stringIndexes, expected)
+			if err != nil {
+				return err
+			}
+			col.stringOffsets = offsets
+			col.stringLens = lens
+			col.stringIndexes = indexes
+			col.stringArena = arena
+		case schema.KindBool:
+			values, err := decodeBoolColumn(payload, col.bools, expected)
+			if err != nil {
+				return err
+			}
+			col.bools = values
+		case schema.KindFloat64:
+			values, err := decodeFloatColumn(payload, col.floats, expected)
+			if err != nil {
+				return err
+			}
+			col.floats = values
+		case schema.KindBytes:
+			offsets, lengths, arena, err := decodeBytesColumn(payload, col.byteOffsets, col.byteLens, expected)
+			if err != nil {
+				return err
+			}
+			col.byteOffsets = offsets
+			col.byteLens = lengths
+			col.byteArena = arena
+		default:
+			return fmt.Errorf("%w: field kind %d is not supported in version 1 streams", ErrCorruptPage, kind)
+		}
+	}
+
+	r.pageState.rows = int(rows)
+	return nil
+}
+
+func decodeUintColumnV1(data []byte, dst []uint64, expected int) ([]uint64, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: malformed uint column length", ErrCorruptPage)
+	}
+	if int(count) != expected {
+		return nil, fmt.Errorf("%w: uint column count %d != expected %d", ErrCorruptPage, count, expected)
+	}
+	data = data[n:]
+	dst = ensureUint64Slice(dst, expected)
+	for i := 0; i < expected; i++ {
+		v, consumed := binary.Uvarint(data)
+		if consumed <= 0 {
+			return nil, fmt.Errorf("%w: malformed uint value", ErrCorruptPage)
+		}
+		dst[i] = v
+		data = data[consumed:]
+	}
+	return dst[:expected], nil
+}
+
+func decodeIntColumnV1(data []byte, dst []int64, expected int) ([]int64, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: malformed int column length", ErrCorruptPage)
+	}
+	if int(count) != expected {
+		return nil, fmt.Errorf("%w: int column count %d != expected %d", ErrCorruptPage, count, expected)
+	}
+	data = data[n:]
+	dst = ensureInt64Slice(dst, expected)
+	for i := 0; i < expected; i++ {
+		v, consumed := binary.Varint(data)
+		if consumed <= 0 {
+			return nil, fmt.Errorf("%w: malformed int value", ErrCorruptPage)
+		}
+		dst[i] = v
+		data = data[consumed:]
+	}
+	return dst[:expected], nil
+}
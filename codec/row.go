@@ -1,9 +1,12 @@
 package codec
 
 import (
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/temporal"
 )
 
 // Value holds the typed payload for a schema field.
@@ -13,6 +16,8 @@ type Value struct {
 	Float    float64
 	Str      string
 	Bytes    []byte
+	Strs     []string // list<string> elements; nil when unset
+	Uints    []uint64 // list<uint64> elements; nil when unset
 	Bool     bool
 	Set      bool
 	Borrowed bool
@@ -133,6 +138,56 @@ func (r Row) SetBytes(field string, v []byte) error {
 	return nil
 }
 
+// SetStrings sets a list<string> field value by name. A nil slice leaves the
+// field unset, while an empty one stores an empty list.
+func (r Row) SetStrings(field string, v []string) error {
+	idx, ok := r.schema.FieldIndex(field)
+	if !ok {
+		return ErrUnknownField
+	}
+	r.values[idx].Strs = v
+	r.values[idx].Set = v != nil
+	return nil
+}
+
+// SetUints sets a list<uint64> field value by name. A nil slice leaves the
+// field unset, while an empty one stores an empty list.
+func (r Row) SetUints(field string, v []uint64) error {
+	idx, ok := r.schema.FieldIndex(field)
+	if !ok {
+		return ErrUnknownField
+	}
+	r.values[idx].Uints = v
+	r.values[idx].Set = v != nil
+	return nil
+}
+
+// Clone returns a copy of r that owns its strings, bytes, and list elements,
+// so it stays valid after the reader that filled r moves to another page.
+func (r Row) Clone() Row {
+	clone := NewRow(r.schema)
+	copy(clone.values, r.values)
+	for i := range clone.values {
+		v := &clone.values[i]
+		v.Str = strings.Clone(v.Str)
+		if v.Bytes != nil {
+			v.Bytes = append([]byte(nil), v.Bytes...)
+			v.Borrowed = false
+		}
+		if v.Strs != nil {
+			strs := make([]string, len(v.Strs))
+			for j, s := range v.Strs {
+				strs[j] = strings.Clone(s)
+			}
+			v.Strs = strs
+		}
+		if v.Uints != nil {
+			v.Uints = append([]uint64(nil), v.Uints...)
+		}
+	}
+	return clone
+}
+
 // Values exposes the ordered slice consumed by the writer.
 func (r Row) Values() []Value {
 	return r.values
@@ -148,3 +203,88 @@ func (r Row) SetByIndex(idx int, v Value) {
 	r.values[idx] = v
 	r.values[idx].Set = true
 }
+
+// lookup returns the value stored for field when its kind is one of kinds.
+func (r Row) lookup(field string, kinds ...schema.FieldKind) (Value, schema.FieldKind, bool) {
+	idx, ok := r.schema.FieldIndex(field)
+	if !ok {
+		return Value{}, schema.KindInvalid, false
+	}
+	kind := r.schema.Fields[idx].ValueKind()
+	for _, k := range kinds {
+		if k == kind {
+			val := r.values[idx]
+			return val, kind, val.Set
+		}
+	}
+	return Value{}, kind, false
+}
+
+// GetUint returns a uint64 or ref field value by name.
+func (r Row) GetUint(field string) (uint64, bool) {
+	val, _, ok := r.lookup(field, schema.KindUint64, schema.KindRef)
+	return val.Uint, ok
+}
+
+// GetInt returns an int64, duration, or time field value by name.
+func (r Row) GetInt(field string) (int64, bool) {
+	val, _, ok := r.lookup(field, schema.KindInt64, schema.KindDuration, schema.KindTime)
+	return val.Int, ok
+}
+
+// GetFloat returns a float64 field value by name.
+func (r Row) GetFloat(field string) (float64, bool) {
+	val, _, ok := r.lookup(field, schema.KindFloat64)
+	return val.Float, ok
+}
+
+// GetBool returns a bool field value by name.
+func (r Row) GetBool(field string) (bool, bool) {
+	val, _, ok := r.lookup(field, schema.KindBool)
+	return val.Bool, ok
+}
+
+// GetString returns a string or timestamptz field value by name.
+func (r Row) GetString(field string) (string, bool) {
+	val, _, ok := r.lookup(field, schema.KindString, schema.KindTimestampTZ)
+	return val.Str, ok
+}
+
+// GetBytes returns a bytes field value by name. The slice may borrow the
+// reader's page buffer; see Value.Borrowed.
+func (r Row) GetBytes(field string) ([]byte, bool) {
+	val, _, ok := r.lookup(field, schema.KindBytes)
+	return val.Bytes, ok
+}
+
+// GetStrings returns a list<string> field value by name.
+func (r Row) GetStrings(field string) ([]string, bool) {
+	val, _, ok := r.lookup(field, schema.KindList)
+	return val.Strs, ok
+}
+
+// GetUints returns a list<uint64> field value by name.
+func (r Row) GetUints(field string) ([]uint64, bool) {
+	val, _, ok := r.lookup(field, schema.KindList)
+	return val.Uints, ok
+}
+
+// GetTime decodes a date, datetime, timestamp, or timestamptz field by name.
+func (r Row) GetTime(field string) (time.Time, bool) {
+	val, kind, ok := r.lookup(field, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindTimestampTZ)
+	if !ok {
+		return time.Time{}, false
+	}
+	switch kind {
+	case schema.KindDate:
+		return temporal.DecodeDate(val.Int), true
+	case schema.KindTimestampTZ:
+		t, err := temporal.DecodeTimestampTZ(val.Str)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t, true
+	default:
+		return temporal.DecodeInstant(val.Int), true
+	}
+}
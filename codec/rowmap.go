@@ -0,0 +1,66 @@
+package codec
+
+import (
+	"fmt"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+// MapFiller sets the fields of row from m, keyed by schema field name. Keys
+// the schema lacks are ignored, as are nil values.
+type MapFiller func(row Row, m map[string]any) error
+
+// WriteRowMap writes m as one row, converting values with
+// WriterOptions.MapFiller. Keys that name no schema field are ignored.
+func (w *Writer) WriteRowMap(m map[string]any) error {
+	row := AcquireRow(w.schema)
+	defer ReleaseRow(row)
+	fill := w.mapFiller
+	if fill == nil {
+		fill = fillRowExact
+	}
+	if err := fill(*row, m); err != nil {
+		return err
+	}
+	return w.WriteRow(*row)
+}
+
+// fillRowExact is the MapFiller used when WriterOptions sets none. It only
+// accepts each kind's storage type: uint64, int64 (dates and durations in
+// their stored form), float64, bool, string, []byte, []string, and []uint64.
+func fillRowExact(row Row, m map[string]any) error {
+	for idx, field := range row.schema.Fields {
+		src, ok := m[field.Name]
+		if !ok || src == nil {
+			continue
+		}
+		var val Value
+		switch kind := field.ValueKind(); kind {
+		case schema.KindUint64, schema.KindRef:
+			val.Uint, ok = src.(uint64)
+		case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
+			val.Int, ok = src.(int64)
+		case schema.KindFloat64:
+			val.Float, ok = src.(float64)
+		case schema.KindBool:
+			val.Bool, ok = src.(bool)
+		case schema.KindString, schema.KindTimestampTZ:
+			val.Str, ok = src.(string)
+		case schema.KindBytes, schema.KindUUID:
+			val.Bytes, ok = src.([]byte)
+		case schema.KindList:
+			if field.ElemKind == schema.KindString {
+				val.Strs, ok = src.([]string)
+			} else {
+				val.Uints, ok = src.([]uint64)
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			return fmt.Errorf("codec: field %s: cannot store %T in %s", field.Name, src, field.RawType)
+		}
+		row.SetByIndex(idx, val)
+	}
+	return nil
+}
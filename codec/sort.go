@@ -0,0 +1,96 @@
+package codec
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/temporal"
+)
+
+// SortableKind reports whether values of kind have an order CompareValues
+// can apply. Bytes and list fields do not.
+func SortableKind(kind schema.FieldKind) bool {
+	switch kind {
+	case schema.KindBytes, schema.KindList:
+		return false
+	}
+	return true
+}
+
+// CompareValues orders two values of a field of the given kind by what they
+// store: unsigned, signed, and float numbers numerically, bools false first,
+// strings bytewise, UUIDs by their 16 bytes, and timestamptz values by the
+// instant. Unset values sort before set ones.
+func CompareValues(kind schema.FieldKind, a, b Value) int {
+	if !a.Set || !b.Set {
+		switch {
+		case a.Set:
+			return 1
+		case b.Set:
+			return -1
+		}
+		return 0
+	}
+	switch kind {
+	case schema.KindUint64, schema.KindRef:
+		return cmp.Compare(a.Uint, b.Uint)
+	case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
+		return cmp.Compare(a.Int, b.Int)
+	case schema.KindFloat64:
+		return cmp.Compare(a.Float, b.Float)
+	case schema.KindBool:
+		switch {
+		case a.Bool == b.Bool:
+			return 0
+		case a.Bool:
+			return 1
+		}
+		return -1
+	case schema.KindUUID:
+		return bytes.Compare(a.Bytes, b.Bytes)
+	case schema.KindTimestampTZ:
+		at, aErr := temporal.DecodeTimestampTZ(a.Str)
+		bt, bErr := temporal.DecodeTimestampTZ(b.Str)
+		if aErr == nil && bErr == nil {
+			return at.Compare(bt)
+		}
+	}
+	return strings.Compare(a.Str, b.Str)
+}
+
+// SortRows stably sorts rows by field, so rows with equal keys keep their
+// relative order. Every row must share the schema of rows[0]. It fails with
+// ErrUnknownField for a missing field and ErrUnsortableKind for a bytes or
+// list field.
+func SortRows(rows []Row, field string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	idx, kind, err := SortField(rows[0].schema, field)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return CompareValues(kind, rows[i].values[idx], rows[j].values[idx]) < 0
+	})
+	return nil
+}
+
+// SortField resolves field to its index and kind, failing unless it exists
+// in s and has a sortable kind.
+func SortField(s *schema.Schema, field string) (int, schema.FieldKind, error) {
+	idx, ok := s.FieldIndex(field)
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %s", ErrUnknownField, field)
+	}
+	f := s.Fields[idx]
+	kind := f.ValueKind()
+	if !SortableKind(kind) {
+		return 0, 0, fmt.Errorf("%w: %s is %s", ErrUnsortableKind, f.Name, f.RawType)
+	}
+	return idx, kind, nil
+}
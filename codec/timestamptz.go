@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/oarkflow/scrt/temporal"
+)
+
+// emptyTZOffset is the offset stored for an empty timestamptz value, which
+// has no instant. Real offsets stay within a day, far from it.
+const emptyTZOffset int64 = math.MinInt16
+
+var (
+	minTZInstant = time.Unix(0, math.MinInt64)
+	maxTZInstant = time.Unix(0, math.MaxInt64)
+)
+
+// splitTimestampTZ turns a stored timestamptz string into the instant and
+// offset-minutes pair written by WriterOptions.OffsetTimestampTZ.
+func splitTimestampTZ(stored string) (int64, int64, error) {
+	t, err := temporal.DecodeTimestampTZ(stored)
+	if err != nil {
+		return 0, 0, err
+	}
+	if t.IsZero() {
+		return 0, emptyTZOffset, nil
+	}
+	if t.Before(minTZInstant) || t.After(maxTZInstant) {
+		return 0, 0, fmt.Errorf("timestamptz %q is outside the offset encoding range", stored)
+	}
+	_, offset := t.Zone()
+	return t.UnixNano(), int64(offset / 60), nil
+}
+
+// tzFormatter rebuilds stored timestamptz strings from instant and offset
+// pairs, reusing the zone of the previous offset since a column rarely
+// mixes many.
+type tzFormatter struct {
+	zone   *time.Location
+	offset int64
+}
+
+// append appends the stored string for instant at offset to dst.
+func (f *tzFormatter) append(dst []byte, instant, offset int64) []byte {
+	if offset == emptyTZOffset {
+		return dst
+	}
+	if f.zone == nil || f.offset != offset {
+		f.zone, f.offset = time.FixedZone("", int(offset)*60), offset
+	}
+	return time.Unix(0, instant).In(f.zone).AppendFormat(dst, time.RFC3339Nano)
+}
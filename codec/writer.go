@@ -3,8 +3,12 @@ package codec
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"time"
 
+	"github.com/oarkflow/scrt/column"
 	"github.com/oarkflow/scrt/page"
 	"github.com/oarkflow/scrt/schema"
 )
@@ -12,8 +16,22 @@ import (
 const (
 	magic   = "SCRT"
 	version = byte(2)
+	// version1 streams predate presence bitmaps and delta-coded integers; see
+	// decodePageV1. Readers still accept them but writers never emit them.
+	version1 = byte(1)
+
+	// The high nibble of the version byte carries stream feature flags.
+	headerFlagMask = byte(0xF0)
+	// flagPageChecksums marks streams whose pages end in a CRC32C of the page body.
+	flagPageChecksums = byte(0x10)
+	pageChecksumSize  = 4
 )
 
+// FormatVersion is the stream format version Writer produces.
+const FormatVersion = int(version)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
 // Writer streams rows into the SCRT binary format.
 type Writer struct {
 	dst           io.Writer
@@ -21,17 +39,156 @@ type Writer struct {
 	builder       *page.Builder
 	headerWritten bool
 	scratch       bytes.Buffer
+	pageChecksums bool
+	footer        bool
+	regionCRC     uint32
+	offsetTZ      bool
+	stats         WriterStats
+	// flushRows and flushInterval end pages early; see WriterOptions.
+	flushRows     int
+	flushInterval time.Duration
+	pageStarted   time.Time
+	now           func() time.Time
+	mapFiller     MapFiller
+	defaultFuncs  bool
+}
+
+// WriterStats counts what a Writer has emitted so far. BytesWritten covers
+// everything handed to the destination, header and footer included.
+type WriterStats struct {
+	PagesWritten uint64
+	RowsWritten  uint64
+	BytesWritten uint64
+}
+
+// WriterOptions controls optional encodings.
+type WriterOptions struct {
+	// LocalDictionaries gives fields declaring encoding=global a dictionary
+	// per page instead, so every page decodes on its own as storage random
+	// access and page appends require.
+	LocalDictionaries bool
+	// PageChecksums appends a CRC32C to every page and flags the header, so
+	// a single page can be verified on random access.
+	PageChecksums bool
+	// Footer terminates the stream with a zero-length page followed by a
+	// CRC32C of the page region and the total row count, so truncation and
+	// corruption are detected when the reader reaches the end.
+	Footer bool
+	// OffsetTimestampTZ stores timestamptz fields as a UTC instant in
+	// nanoseconds plus the zone offset in minutes instead of as RFC3339
+	// strings. Reads rebuild the same RFC3339Nano text. Only the offset
+	// survives, so a value from a named zone such as America/New_York comes
+	// back in a fixed zone with the offset it had at that instant, and
+	// second-level offsets of historical zones are truncated to the minute.
+	// Values must lie between 1677 and 2262, the range of int64 nanoseconds.
+	OffsetTimestampTZ bool
+	// AutoPlainStrings writes a string column's page as length-prefixed
+	// values without a dictionary when that is smaller, as it is when
+	// nearly every value is distinct (UUIDs, free text). The page's column
+	// kind byte carries page.PlainStringFlag; the TypeScript decoder and
+	// older Go readers cannot read such pages. Fields declaring encoding=
+	// keep their choice, so encoding=plain fields get plain pages even
+	// without this option.
+	AutoPlainStrings bool
+	// SortedDictionaries writes each page's string dictionary in bytewise
+	// order instead of the order values first appear, so a page's bytes do
+	// not depend on row order within it. Global dictionaries are unaffected.
+	SortedDictionaries bool
+	// NarrowIntegers stores a page of a uint64, ref, or int64-backed column
+	// as fixed-width values of 1, 2, 4, or 8 bytes, the narrowest that fits
+	// the page's largest value, whenever that takes no more room than
+	// varints; signed values are zigzagged first. A page of values from
+	// 1000 to 1100 thus uses two bytes per value and decodes without varint
+	// loops. Delta-encoded pages keep a varint base and narrow the deltas.
+	// The column kind byte carries page.NarrowIntFlag; the TypeScript
+	// decoder and older Go readers cannot read such pages.
+	NarrowIntegers bool
+	// FlushRows ends a page after this many rows, before rowsPerPage is
+	// reached, and FlushInterval ends it at the first WriteRow that finds its
+	// oldest row at least that old. Either trades size for latency: each
+	// page repeats its dictionaries, bitmaps, and delta bases, so small pages
+	// compress far worse, but a live consumer sees rows as soon as they are
+	// written. FlushRows of 1 flushes every row. The interval is only checked
+	// by WriteRow, so a feed that goes quiet should call Flush itself. After
+	// an early page the destination's Flush method, if it has one as
+	// bufio.Writer and http.ResponseWriter do, is called too. Zero disables
+	// either.
+	FlushRows     int
+	FlushInterval time.Duration
+	// MapFiller converts the values WriteRowMap receives. scrt.FillRowMap
+	// converts them the way Marshal converts map input; nil accepts only
+	// each kind's storage type.
+	MapFiller MapFiller
+	// DefaultFuncs evaluates default=now() and default=uuid() for rows that
+	// leave such a field unset, as Marshal does for new records. Leave it
+	// off when re-encoding stored rows: a row written before the default
+	// existed must stay unset rather than take the time of the rewrite.
+	DefaultFuncs bool
+}
+
+// DefaultRowsPerPage is the page size used when neither the caller nor the
+// schema picks one.
+const DefaultRowsPerPage = 1024
+
+// PageSize resolves the page size for writing s: rowsPerPage when positive,
+// else the schema's @pragma rows_per_page clamped to schema.MaxRowsPerPage,
+// else DefaultRowsPerPage.
+func PageSize(s *schema.Schema, rowsPerPage int) int {
+	switch {
+	case rowsPerPage > 0:
+		return rowsPerPage
+	case s != nil && s.RowsPerPage > 0:
+		return min(s.RowsPerPage, schema.MaxRowsPerPage)
+	default:
+		return DefaultRowsPerPage
+	}
 }
 
-// NewWriter constructs a streaming writer for a schema.
+// NewWriter constructs a streaming writer for a schema. A rowsPerPage of
+// zero or less uses the schema's @pragma rows_per_page, or 1024 rows.
 func NewWriter(dst io.Writer, s *schema.Schema, rowsPerPage int) *Writer {
+	if s.GlobalStrings() {
+		return NewWriterWithOptions(dst, s, rowsPerPage, WriterOptions{})
+	}
 	return &Writer{
 		dst:     dst,
 		schema:  s,
-		builder: page.AcquireBuilder(s, rowsPerPage),
+		builder: page.AcquireBuilder(s, PageSize(s, rowsPerPage)),
 	}
 }
 
+// NewWriterWithOptions constructs a writer with custom options. rowsPerPage
+// is resolved as in NewWriter.
+func NewWriterWithOptions(dst io.Writer, s *schema.Schema, rowsPerPage int, opts WriterOptions) *Writer {
+	rowsPerPage = PageSize(s, rowsPerPage)
+	w := &Writer{
+		dst:           dst,
+		schema:        s,
+		pageChecksums: opts.PageChecksums,
+		footer:        opts.Footer,
+		offsetTZ:      opts.OffsetTimestampTZ,
+		flushRows:     opts.FlushRows,
+		flushInterval: opts.FlushInterval,
+		now:           time.Now,
+		mapFiller:     opts.MapFiller,
+		defaultFuncs:  opts.DefaultFuncs,
+	}
+	global := s.GlobalStrings() && !opts.LocalDictionaries
+	if !global && !opts.OffsetTimestampTZ && !opts.AutoPlainStrings && !opts.SortedDictionaries && !opts.NarrowIntegers {
+		w.builder = page.AcquireBuilder(s, rowsPerPage)
+		return w
+	}
+	builderOpts := page.BuilderOptions{OffsetTimestampTZ: opts.OffsetTimestampTZ, AutoPlainStrings: opts.AutoPlainStrings, SortedDictionaries: opts.SortedDictionaries, NarrowIntegers: opts.NarrowIntegers}
+	if global {
+		builderOpts.GlobalStrings = make([]bool, len(s.Fields))
+		for i, field := range s.Fields {
+			builderOpts.GlobalStrings[i] = field.Encoding == schema.StringEncodingGlobal
+		}
+	}
+	w.builder = page.NewBuilderWithOptions(s, rowsPerPage, builderOpts)
+	return w
+}
+
 // WriteRow writes a single row to the underlying stream.
 func (w *Writer) WriteRow(row Row) error {
 	if len(row.values) != len(w.schema.Fields) {
@@ -44,6 +201,14 @@ func (w *Writer) WriteRow(row Row) error {
 
 	for idx, field := range w.schema.Fields {
 		val := &row.values[idx]
+		if !val.Set && w.defaultFuncs && field.Default.Dynamic() {
+			// Evaluated into a copy so the caller's row stays unset.
+			dynamic, err := evalDefaultFunc(field)
+			if err != nil {
+				return err
+			}
+			val = &dynamic
+		}
 		if !val.Set {
 			w.builder.RecordPresence(idx, false)
 			continue
@@ -63,36 +228,109 @@ func (w *Writer) WriteRow(row Row) error {
 			w.builder.AppendFloat(idx, val.Float)
 		case schema.KindBytes:
 			w.builder.AppendBytes(idx, val.Bytes)
-		case schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration:
+		case schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
 			w.builder.AppendInt(idx, val.Int)
 		case schema.KindTimestampTZ:
-			w.builder.AppendString(idx, val.Str)
+			if !w.offsetTZ {
+				w.builder.AppendString(idx, val.Str)
+				break
+			}
+			instant, offset, err := splitTimestampTZ(val.Str)
+			if err != nil {
+				return fmt.Errorf("codec: field %s: %w", field.Name, err)
+			}
+			w.builder.AppendTimestampTZ(idx, instant, offset)
+		case schema.KindUUID:
+			if len(val.Bytes) != column.UUIDSize {
+				return ErrInvalidUUID
+			}
+			w.builder.AppendUUID(idx, val.Bytes)
+		case schema.KindList:
+			if field.ElemKind == schema.KindString {
+				w.builder.AppendStrings(idx, val.Strs)
+			} else {
+				w.builder.AppendUints(idx, val.Uints)
+			}
 		default:
 			return ErrUnknownField
 		}
 	}
 	w.builder.SealRow()
+	if w.flushInterval > 0 && w.builder.Rows() == 1 {
+		w.pageStarted = w.now()
+	}
 
-	if w.builder.Full() {
+	switch {
+	case w.builder.Full():
 		if err := w.flushPage(); err != nil {
 			return err
 		}
 		w.builder.Reset()
+	case w.flushDue():
+		return w.Flush()
 	}
 	return nil
 }
 
-// Flush forces the current page to be written.
+// flushDue reports whether FlushRows or FlushInterval ends the current page.
+func (w *Writer) flushDue() bool {
+	switch {
+	case w.flushRows > 0 && w.builder.Rows() >= w.flushRows:
+		return true
+	case w.flushInterval > 0 && w.now().Sub(w.pageStarted) >= w.flushInterval:
+		return true
+	}
+	return false
+}
+
+// Flush writes the rows buffered so far as a page, even a short one, so a
+// reader of the destination can decode them. When FlushRows or
+// FlushInterval is set, the destination is flushed as well.
 func (w *Writer) Flush() error {
 	if err := w.ensureHeader(); err != nil {
 		return err
 	}
-	return w.flushPage()
+	if err := w.flushPage(); err != nil {
+		return err
+	}
+	w.builder.Reset()
+	if w.flushRows > 0 || w.flushInterval > 0 {
+		return flushDestination(w.dst)
+	}
+	return nil
+}
+
+// flushDestination pushes dst's own buffer onward when it has one.
+func flushDestination(dst io.Writer) error {
+	switch f := dst.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
+
+// Stats reports the pages, rows, and bytes written. It stays valid after Close.
+func (w *Writer) Stats() WriterStats {
+	return w.stats
 }
 
-// Close flushes remaining data.
+// Close flushes remaining data and, when enabled, writes the footer. A
+// stream without rows still gets its header and a zero-length terminator.
 func (w *Writer) Close() error {
 	err := w.Flush()
+	if err == nil {
+		switch {
+		case w.footer:
+			err = w.writeFooter()
+		case w.stats.PagesWritten == 0:
+			err = w.writeTerminator()
+		}
+	}
+	if err == nil && (w.flushRows > 0 || w.flushInterval > 0) {
+		err = flushDestination(w.dst)
+	}
 	page.ReleaseBuilder(w.builder)
 	w.builder = nil
 	w.headerWritten = false
@@ -106,13 +344,21 @@ func (w *Writer) ensureHeader() error {
 	}
 	var header bytes.Buffer
 	header.WriteString(magic)
-	header.WriteByte(version)
+	flags := byte(0)
+	if w.pageChecksums {
+		flags |= flagPageChecksums
+	}
+	if w.footer {
+		flags |= flagFooter
+	}
+	header.WriteByte(version | flags)
 	var fp [8]byte
 	binary.LittleEndian.PutUint64(fp[:], w.schema.Fingerprint())
 	header.Write(fp[:])
 	if _, err := w.dst.Write(header.Bytes()); err != nil {
 		return err
 	}
+	w.stats.BytesWritten += uint64(header.Len())
 	w.headerWritten = true
 	return nil
 }
@@ -123,6 +369,12 @@ func (w *Writer) flushPage() error {
 	}
 	w.scratch.Reset()
 	w.builder.Encode(&w.scratch)
+	if w.pageChecksums {
+		// The CRC sits inside the length prefix so page offsets stay self-describing.
+		var sum [pageChecksumSize]byte
+		binary.LittleEndian.PutUint32(sum[:], crc32.Checksum(w.scratch.Bytes(), castagnoli))
+		w.scratch.Write(sum[:])
+	}
 	pageBytes := w.scratch.Bytes()
 
 	// Write length and page data directly without intermediate allocation
@@ -136,5 +388,27 @@ func (w *Writer) flushPage() error {
 	if _, err := w.dst.Write(pageBytes); err != nil {
 		return err
 	}
+	if w.footer {
+		w.regionCRC = crc32.Update(w.regionCRC, castagnoli, lenBuf[:n])
+		w.regionCRC = crc32.Update(w.regionCRC, castagnoli, pageBytes)
+	}
+	w.stats.PagesWritten++
+	w.stats.RowsWritten += uint64(w.builder.Rows())
+	w.stats.BytesWritten += uint64(n + len(pageBytes))
 	return nil
 }
+
+func (w *Writer) writeTerminator() error {
+	n, err := w.dst.Write([]byte{0})
+	w.stats.BytesWritten += uint64(n)
+	return err
+}
+
+func (w *Writer) writeFooter() error {
+	var tail [1 + footerSize]byte
+	binary.LittleEndian.PutUint32(tail[1:5], w.regionCRC)
+	binary.LittleEndian.PutUint64(tail[5:], w.stats.RowsWritten)
+	n, err := w.dst.Write(tail[:])
+	w.stats.BytesWritten += uint64(n)
+	return err
+}
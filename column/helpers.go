@@ -17,6 +17,16 @@ func writeVarint(buf *bytes.Buffer, v int64) {
 	buf.Write(tmp[:n])
 }
 
+// uvarintLen returns the number of bytes writeUvarint uses for v.
+func uvarintLen(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
 func normalizeCapacityHint(hint int) int {
 	if hint <= 0 {
 		return 256
@@ -18,10 +18,7 @@ func (c *Int64Column) Append(v int64) {
 
 func (c *Int64Column) Encode(dst *bytes.Buffer) {
 	count := len(c.values)
-	mode := uint64(0)
-	if count > 1 {
-		mode = 1
-	}
+	mode := c.mode()
 	header := (uint64(count) << 1) | mode
 	writeUvarint(dst, header)
 	if count == 0 {
@@ -42,6 +39,15 @@ func (c *Int64Column) Encode(dst *bytes.Buffer) {
 	}
 }
 
+// mode is 1 when the page is delta-encoded, as every page of two or more
+// values is.
+func (c *Int64Column) mode() uint64 {
+	if len(c.values) > 1 {
+		return 1
+	}
+	return 0
+}
+
 func (c *Int64Column) Reset() {
 	c.values = c.values[:0]
 }
@@ -0,0 +1,139 @@
+package column
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Narrow layouts replace the varints of an integer column with fixed-width
+// little-endian values of 1, 2, 4, or 8 bytes, the narrowest that holds the
+// page's largest value. The column keeps its count and mode header and its
+// varint delta base; a width byte follows the header and then the values,
+// or the deltas in delta mode. Signed values and deltas are zigzagged first,
+// so small negative numbers stay narrow. The page flags such columns so
+// readers expect this layout.
+
+// narrowWidth returns the fewest of 1, 2, 4, and 8 bytes that hold v.
+func narrowWidth(v uint64) int {
+	switch {
+	case v <= 0xff:
+		return 1
+	case v <= 0xffff:
+		return 2
+	case v <= 0xffffffff:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// narrowLayout picks the width for values, which exclude the delta base,
+// and reports whether they take no more bytes at that width than as
+// varints. The width byte is not counted: on a tie, such as values that all
+// need two varint bytes, fixed widths win for their cheaper decoding. Values
+// that all fit one varint byte keep varints, which already cost one byte.
+func narrowLayout(values []uint64) (int, bool) {
+	if len(values) == 0 {
+		return 0, false
+	}
+	var largest uint64
+	varints := 0
+	for _, v := range values {
+		largest = max(largest, v)
+		varints += uvarintLen(v)
+	}
+	width := narrowWidth(largest)
+	return width, varints > len(values) && width*len(values) <= varints
+}
+
+func writeFixed(dst *bytes.Buffer, v uint64, width int) {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	dst.Write(tmp[:width])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// narrowUints returns what the narrow layout of c stores at fixed width:
+// the values, or the deltas after the base in delta mode.
+func (c *Uint64Column) narrowUints(mode uint64) []uint64 {
+	if mode == 0 {
+		return c.values
+	}
+	deltas := make([]uint64, len(c.values)-1)
+	for i := range deltas {
+		deltas[i] = c.values[i+1] - c.values[i]
+	}
+	return deltas
+}
+
+// PreferNarrow reports whether the values, or deltas, of the page fit their
+// narrowest fixed width in no more bytes than their varints.
+func (c *Uint64Column) PreferNarrow() bool {
+	_, ok := narrowLayout(c.narrowUints(c.mode()))
+	return ok
+}
+
+// EncodeNarrow writes the column in the narrow layout.
+func (c *Uint64Column) EncodeNarrow(dst *bytes.Buffer) {
+	mode := c.mode()
+	writeUvarint(dst, (uint64(len(c.values))<<1)|mode)
+	if len(c.values) == 0 {
+		return
+	}
+	values := c.narrowUints(mode)
+	width, _ := narrowLayout(values)
+	width = max(width, 1)
+	dst.WriteByte(byte(width))
+	if mode == 1 {
+		writeUvarint(dst, c.values[0])
+	}
+	for _, v := range values {
+		writeFixed(dst, v, width)
+	}
+}
+
+// narrowInts returns the zigzagged values, or the zigzagged deltas after
+// the base in delta mode.
+func (c *Int64Column) narrowInts(mode uint64) []uint64 {
+	if mode == 0 {
+		out := make([]uint64, len(c.values))
+		for i, v := range c.values {
+			out[i] = zigzag(v)
+		}
+		return out
+	}
+	deltas := make([]uint64, len(c.values)-1)
+	for i := range deltas {
+		deltas[i] = zigzag(c.values[i+1] - c.values[i])
+	}
+	return deltas
+}
+
+// PreferNarrow reports whether the zigzagged values, or deltas, of the page
+// fit their narrowest fixed width in no more bytes than their varints.
+func (c *Int64Column) PreferNarrow() bool {
+	_, ok := narrowLayout(c.narrowInts(c.mode()))
+	return ok
+}
+
+// EncodeNarrow writes the column in the narrow layout.
+func (c *Int64Column) EncodeNarrow(dst *bytes.Buffer) {
+	mode := c.mode()
+	writeUvarint(dst, (uint64(len(c.values))<<1)|mode)
+	if len(c.values) == 0 {
+		return
+	}
+	values := c.narrowInts(mode)
+	width, _ := narrowLayout(values)
+	width = max(width, 1)
+	dst.WriteByte(byte(width))
+	if mode == 1 {
+		writeVarint(dst, c.values[0])
+	}
+	for _, v := range values {
+		writeFixed(dst, v, width)
+	}
+}
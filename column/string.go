@@ -3,10 +3,20 @@ package column
 import (
 	"bytes"
 	"math"
+	"slices"
+	"strings"
+	"unsafe"
 )
 
 // StringColumn encodes strings through a page-local dictionary backed by arenas.
+// When bound to a StringTable the dictionary spans pages instead: each page
+// only carries the strings first seen on it and indexes refer to table ids.
+// A page-local column can also be encoded plain, as length-prefixed values
+// in row order; see EncodePlain.
 type StringColumn struct {
+	plain      bool // values are kept in row order without a dictionary
+	table      *StringTable
+	base       uint32
 	dict       map[string]uint32
 	indexes    []uint32
 	arena      []byte
@@ -29,23 +39,133 @@ func NewStringColumn(capacity int) *StringColumn {
 	}
 }
 
+// NewPlainStringColumn creates a column that skips the dictionary, for
+// values that rarely repeat. It must be written with EncodePlain.
+func NewPlainStringColumn(capacity int) *StringColumn {
+	c := NewStringColumn(capacity)
+	c.plain = true
+	c.dict = nil
+	return c
+}
+
+// NewStringColumnWithTable creates a column whose dictionary is shared with
+// every page encoded through table.
+func NewStringColumnWithTable(capacity int, table *StringTable) *StringColumn {
+	c := NewStringColumn(capacity)
+	c.table = table
+	c.base = table.Len()
+	return c
+}
+
+// StringTable is a stream-level dictionary shared by string columns across pages.
+type StringTable struct {
+	ids map[string]uint32
+}
+
+// NewStringTable returns an empty table.
+func NewStringTable() *StringTable {
+	return &StringTable{ids: make(map[string]uint32)}
+}
+
+// Len reports the number of distinct strings assigned an id so far.
+func (t *StringTable) Len() uint32 { return uint32(len(t.ids)) }
+
 func (c *StringColumn) Append(v string) {
-	if id, ok := c.dict[v]; ok {
+	if c.plain {
+		c.appendEntry(v)
+		return
+	}
+	dict := c.dict
+	if c.table != nil {
+		dict = c.table.ids
+	}
+	if id, ok := dict[v]; ok {
 		c.indexes = append(c.indexes, id)
 		return
 	}
-	id := uint32(len(c.strOffsets))
-	c.dict[v] = id
+	id := c.base + uint32(len(c.strOffsets))
+	c.appendEntry(v)
+	if c.table != nil {
+		// The table outlives the caller's buffers, so keep a private key.
+		dict[strings.Clone(v)] = id
+	} else {
+		// v may borrow a buffer the caller reuses before the page is
+		// flushed, such as a reader's page, so key the entry by its copy in
+		// the arena. Growing the arena leaves earlier bytes where they were.
+		dict[c.arenaString(len(c.strOffsets)-1)] = id
+	}
+	c.indexes = append(c.indexes, id)
+}
+
+// appendEntry copies v into the arena as the next dictionary entry, or the
+// next value of a plain column.
+func (c *StringColumn) appendEntry(v string) {
 	if len(v) > math.MaxUint32 || len(c.arena)+len(v) > math.MaxUint32 {
 		panic("string column value exceeds 4GB")
 	}
 	c.strOffsets = append(c.strOffsets, uint32(len(c.arena)))
 	c.strLens = append(c.strLens, uint32(len(v)))
 	c.arena = append(c.arena, v...)
-	c.indexes = append(c.indexes, id)
 }
 
+// arenaString returns dictionary entry i as a string sharing the arena's
+// bytes, valid until Reset.
+func (c *StringColumn) arenaString(i int) string {
+	if c.strLens[i] == 0 {
+		return ""
+	}
+	return unsafe.String(&c.arena[c.strOffsets[i]], int(c.strLens[i]))
+}
+
+// Plain reports whether the column was created plain.
+func (c *StringColumn) Plain() bool { return c.plain }
+
+// PlainSmaller reports whether EncodePlain would write no more bytes than
+// Encode, as happens when nearly every value is distinct. Table-bound
+// columns always keep their dictionary.
+func (c *StringColumn) PlainSmaller() bool {
+	if c.table != nil {
+		return false
+	}
+	dictSize := uvarintLen(uint64(len(c.strOffsets))) + len(c.arena) + uvarintLen(uint64(len(c.indexes)))
+	for _, length := range c.strLens {
+		dictSize += uvarintLen(uint64(length))
+	}
+	plainSize := uvarintLen(uint64(len(c.indexes)))
+	for _, idx := range c.indexes {
+		dictSize += uvarintLen(uint64(idx))
+		length := c.strLens[idx]
+		plainSize += uvarintLen(uint64(length)) + int(length)
+	}
+	return plainSize < dictSize
+}
+
+// EncodePlain writes the value count followed by each value, length-prefixed,
+// in row order. The page must flag the column so readers expect this layout.
+func (c *StringColumn) EncodePlain(dst *bytes.Buffer) {
+	if c.plain {
+		writeUvarint(dst, uint64(len(c.strOffsets)))
+		for i, start := range c.strOffsets {
+			writeUvarint(dst, uint64(c.strLens[i]))
+			dst.Write(c.arena[start : start+c.strLens[i]])
+		}
+		return
+	}
+	writeUvarint(dst, uint64(len(c.indexes)))
+	for _, idx := range c.indexes {
+		start, length := c.strOffsets[idx], c.strLens[idx]
+		writeUvarint(dst, uint64(length))
+		dst.Write(c.arena[start : start+length])
+	}
+}
+
+// Encode writes the dictionary followed by the row indexes. Table-bound
+// columns prefix the dictionary with the id of its first entry so readers can
+// detect pages decoded out of order.
 func (c *StringColumn) Encode(dst *bytes.Buffer) {
+	if c.table != nil {
+		writeUvarint(dst, uint64(c.base))
+	}
 	writeUvarint(dst, uint64(len(c.strOffsets)))
 	for i := range c.strOffsets {
 		length := c.strLens[i]
@@ -59,6 +179,42 @@ func (c *StringColumn) Encode(dst *bytes.Buffer) {
 	}
 }
 
+// EncodeSorted writes the same layout as Encode with the dictionary in
+// bytewise order and the indexes remapped to it, so a page's bytes depend
+// only on its values and not on the order they first appeared in.
+// Table-bound columns keep first-use order and are written by Encode.
+func (c *StringColumn) EncodeSorted(dst *bytes.Buffer) {
+	if c.table != nil {
+		c.Encode(dst)
+		return
+	}
+	order := make([]uint32, len(c.strOffsets))
+	for i := range order {
+		order[i] = uint32(i)
+	}
+	slices.SortFunc(order, func(a, b uint32) int {
+		return bytes.Compare(c.entry(a), c.entry(b))
+	})
+	rank := make([]uint32, len(order))
+	writeUvarint(dst, uint64(len(order)))
+	for pos, id := range order {
+		rank[id] = uint32(pos)
+		entry := c.entry(id)
+		writeUvarint(dst, uint64(len(entry)))
+		dst.Write(entry)
+	}
+	writeUvarint(dst, uint64(len(c.indexes)))
+	for _, idx := range c.indexes {
+		writeUvarint(dst, uint64(rank[idx]))
+	}
+}
+
+// entry returns the arena bytes of dictionary entry id.
+func (c *StringColumn) entry(id uint32) []byte {
+	start := c.strOffsets[id]
+	return c.arena[start : start+c.strLens[id]]
+}
+
 func (c *StringColumn) Reset() {
 	for k := range c.dict {
 		delete(c.dict, k)
@@ -67,4 +223,7 @@ func (c *StringColumn) Reset() {
 	c.arena = c.arena[:0]
 	c.strOffsets = c.strOffsets[:0]
 	c.strLens = c.strLens[:0]
+	if c.table != nil {
+		c.base = c.table.Len()
+	}
 }
@@ -18,10 +18,7 @@ func (c *Uint64Column) Append(v uint64) {
 
 func (c *Uint64Column) Encode(dst *bytes.Buffer) {
 	count := len(c.values)
-	mode := uint64(0)
-	if count >= 2 && isMonotonicUint64(c.values) {
-		mode = 1
-	}
+	mode := c.mode()
 	header := (uint64(count) << 1) | mode
 	writeUvarint(dst, header)
 	if count == 0 {
@@ -42,6 +39,14 @@ func (c *Uint64Column) Encode(dst *bytes.Buffer) {
 	}
 }
 
+// mode is 1 when the page is delta-encoded, as non-decreasing pages are.
+func (c *Uint64Column) mode() uint64 {
+	if len(c.values) >= 2 && isMonotonicUint64(c.values) {
+		return 1
+	}
+	return 0
+}
+
 func (c *Uint64Column) Reset() {
 	c.values = c.values[:0]
 }
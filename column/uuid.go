@@ -0,0 +1,35 @@
+package column
+
+import "bytes"
+
+// UUIDSize is the fixed width of a single encoded UUID value.
+const UUIDSize = 16
+
+// UUIDColumn encodes 16-byte identifiers back to back without length prefixes.
+type UUIDColumn struct {
+	count int
+	arena []byte
+}
+
+func NewUUIDColumn(capacity int) *UUIDColumn {
+	c := normalizeCapacityHint(capacity)
+	return &UUIDColumn{arena: make([]byte, 0, c*UUIDSize)}
+}
+
+func (c *UUIDColumn) Append(v []byte) {
+	if len(v) != UUIDSize {
+		panic("uuid column value must be 16 bytes")
+	}
+	c.arena = append(c.arena, v...)
+	c.count++
+}
+
+func (c *UUIDColumn) Encode(dst *bytes.Buffer) {
+	writeUvarint(dst, uint64(c.count))
+	dst.Write(c.arena)
+}
+
+func (c *UUIDColumn) Reset() {
+	c.count = 0
+	c.arena = c.arena[:0]
+}
@@ -0,0 +1,95 @@
+package scrt
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// MarshalColumns encodes records supplied column by column: columns maps
+// field names to one value per row, and every slice must have the same
+// length. Values are converted the way Marshal converts map input, but
+// without walking a map or struct per row. Fields without a column, and nil
+// values, are left unset. A column naming no field of s is an error.
+func MarshalColumns(s *schema.Schema, columns map[string][]any, opts ...MarshalOption) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	config := newMarshalOptions(s, opts)
+	sources := make([][]any, len(s.Fields))
+	rows, first := 0, ""
+	for _, name := range slices.Sorted(maps.Keys(columns)) {
+		idx, ok := s.FieldIndex(name)
+		if !ok {
+			return nil, fmt.Errorf("scrt: column %s: %w", name, codec.ErrUnknownField)
+		}
+		values := columns[name]
+		if first == "" {
+			rows, first = len(values), name
+		} else if len(values) != rows {
+			return nil, fmt.Errorf("scrt: column %s has %d values but column %s has %d", name, len(values), first, rows)
+		}
+		sources[idx] = values
+	}
+	if config.SortBy != "" {
+		if _, _, err := codec.SortField(s, config.SortBy); err != nil {
+			return nil, fmt.Errorf("scrt: sort by: %w", err)
+		}
+	}
+	kinds := make([]schema.FieldKind, len(s.Fields))
+	for i, field := range s.Fields {
+		kinds[i] = field.ValueKind()
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+	writerOpts := config.Writer
+	writerOpts.DefaultFuncs = true
+	writer := codec.NewWriterWithOptions(buf, s, config.RowsPerPage, writerOpts)
+	encCfg := encodeConfig{strictTemporal: config.StrictTemporal}
+	shared := codec.AcquireRow(s)
+	defer codec.ReleaseRow(shared)
+	var buffered []codec.Row
+	for i := 0; i < rows; i++ {
+		row := *shared
+		if config.SortBy != "" {
+			row = codec.NewRow(s)
+		} else {
+			row.Reset()
+		}
+		for idx, values := range sources {
+			if values == nil {
+				continue
+			}
+			if err := assignAnyToRow(row, idx, kinds[idx], values[i], encCfg); err != nil {
+				return nil, fmt.Errorf("scrt: row %d: field %s: %w", i, s.Fields[idx].Name, err)
+			}
+		}
+		if config.SortBy != "" {
+			buffered = append(buffered, row)
+			continue
+		}
+		if err := writer.WriteRow(row); err != nil {
+			return nil, err
+		}
+	}
+	if config.SortBy != "" {
+		if err := codec.SortRows(buffered, config.SortBy); err != nil {
+			return nil, err
+		}
+		for _, row := range buffered {
+			if err := writer.WriteRow(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
@@ -0,0 +1,62 @@
+package scrt
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// EvalComputed evaluates the computed field c of s over the stored values of
+// row. It reports false when the expression has no value for the row, such
+// as when a field it reads is unset.
+func EvalComputed(s *schema.Schema, c schema.ComputedField, row codec.Row) (any, bool) {
+	vals := row.Values()
+	return c.Eval(func(idx int) (any, bool) {
+		v := vals[idx]
+		if !v.Set {
+			return nil, false
+		}
+		switch s.Fields[idx].ValueKind() {
+		case schema.KindUint64, schema.KindRef:
+			return v.Uint, true
+		case schema.KindFloat64:
+			return v.Float, true
+		case schema.KindString, schema.KindTimestampTZ:
+			return v.Str, true
+		case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
+			return v.Int, true
+		}
+		return nil, false
+	})
+}
+
+// assignComputed stores the result of a computed field in a struct field.
+// Strings go to string fields, numbers to any numeric field by conversion or
+// to a string field as decimal text, and either to an interface.
+func assignComputed(fv reflect.Value, v any) error {
+	switch fv.Kind() {
+	case reflect.Interface:
+		fv.Set(reflect.ValueOf(v))
+		return nil
+	case reflect.Pointer:
+		elem := reflect.New(fv.Type().Elem())
+		if err := assignComputed(elem.Elem(), v); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	case reflect.String:
+		fv.SetString(fmt.Sprint(v))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, isText := v.(string); !isText {
+			fv.Set(reflect.ValueOf(v).Convert(fv.Type()))
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot store %T in %s", v, fv.Type())
+}
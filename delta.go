@@ -0,0 +1,337 @@
+package scrt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// Delta ops, stored in the op column of a patch.
+const (
+	DeltaInsert uint64 = iota + 1
+	DeltaUpdate
+	DeltaDelete
+)
+
+// ErrDeltaMismatch marks a patch that does not fit the base it is applied
+// to, such as one deleting a key the base lacks.
+var ErrDeltaMismatch = errors.New("scrt: delta does not apply to base")
+
+const (
+	deltaOpField  = "$op"
+	deltaPosField = "$pos"
+	deltaKeyField = "$key"
+	// deltaColumns is how many patch columns precede the fields of s.
+	deltaColumns = 3
+)
+
+// DeltaSchema returns the schema a patch from Delta is written with: an op
+// column holding DeltaInsert, DeltaUpdate, or DeltaDelete, a position
+// column, a column naming the key field, and then the fields of s without
+// their defaults, so a patch reads back exactly as it was written. A patch
+// is a plain SCRT stream of it and can be decoded like any other payload.
+func DeltaSchema(s *schema.Schema) *schema.Schema {
+	fields := make([]schema.Field, 0, deltaColumns+len(s.Fields))
+	fields = append(fields,
+		schema.Field{Name: deltaOpField, Kind: schema.KindUint64, RawType: "uint64"},
+		schema.Field{Name: deltaPosField, Kind: schema.KindUint64, RawType: "uint64"},
+		schema.Field{Name: deltaKeyField, Kind: schema.KindString, RawType: "string"},
+	)
+	fields = append(fields, withoutDefaults(s).Fields...)
+	return &schema.Schema{Name: s.Name + "Delta", Fields: fields}
+}
+
+// withoutDefaults returns a copy of s whose fields declare no defaults.
+// Reading with it returns what rows store: an absent field stays unset
+// rather than taking its default, so writing the rows back with s
+// reproduces them.
+func withoutDefaults(s *schema.Schema) *schema.Schema {
+	fields := make([]schema.Field, len(s.Fields))
+	for i, field := range s.Fields {
+		field.Default = nil
+		fields[i] = field
+	}
+	return &schema.Schema{Name: s.Name, Fields: fields}
+}
+
+// Delta describes how to turn base into target, both encoded with s, as a
+// patch keyed by keyField. Deleted base rows come first, carrying only their
+// key. Inserted and updated rows follow in target order, each with the whole
+// row and its position in target. Base rows that target keeps unchanged and
+// in their relative order are left out; a row that moved is sent as an
+// update. Every row of both payloads must set keyField, once per payload,
+// and it must be a kind that can back a unique key (see
+// schema.IndexableKind). Both payloads are held in memory while diffing.
+func Delta(base, target []byte, s *schema.Schema, keyField string) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	keyIdx, ok := s.FieldIndex(keyField)
+	if !ok {
+		return nil, fmt.Errorf("scrt: schema %s lacks key field %s", s.Name, keyField)
+	}
+	kind := s.Fields[keyIdx].ValueKind()
+	if !schema.IndexableKind(kind) {
+		return nil, fmt.Errorf("scrt: field %s (%s) cannot be used as a delta key", keyField, s.Fields[keyIdx].RawType)
+	}
+	baseRows, baseKeys, err := readKeyedRows(base, s, keyIdx, kind, "base")
+	if err != nil {
+		return nil, err
+	}
+	targetRows, targetKeys, err := readKeyedRows(target, s, keyIdx, kind, "target")
+	if err != nil {
+		return nil, err
+	}
+
+	ds := DeltaSchema(s)
+	var buf bytes.Buffer
+	writer := codec.NewWriter(&buf, ds, 0)
+	patch := codec.NewRow(ds)
+	vals := patch.Values()
+	emit := func(op, pos uint64, row codec.Row) error {
+		patch.Reset()
+		vals[0] = codec.Value{Uint: op, Set: true}
+		vals[1] = codec.Value{Uint: pos, Set: true}
+		vals[2] = codec.Value{Str: keyField, Set: true}
+		if op == DeltaDelete {
+			vals[deltaColumns+keyIdx] = row.Values()[keyIdx]
+		} else {
+			copy(vals[deltaColumns:], row.Values())
+		}
+		return writer.WriteRow(patch)
+	}
+	for _, row := range baseRows {
+		if _, kept := targetKeys[mergeKeyOf(row.Values()[keyIdx], kind)]; !kept {
+			if err := emit(DeltaDelete, 0, row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	last := -1
+	for pos, row := range targetRows {
+		from, ok := baseKeys[mergeKeyOf(row.Values()[keyIdx], kind)]
+		op := DeltaInsert
+		if ok {
+			if from > last && sameRow(s, baseRows[from], row) {
+				last = from
+				continue
+			}
+			op = DeltaUpdate
+		}
+		if err := emit(op, uint64(pos), row); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ApplyDelta rebuilds the target of a patch from Delta. Updated and deleted
+// base rows are dropped, placed rows land at their positions, and the other
+// base rows fill the remaining slots in base order, so the result holds
+// target's rows in target's order. It is encoded like Marshal without
+// options, which reproduces a target written that way byte for byte. A
+// patch that does not fit base, such as one deleting a key base lacks,
+// fails with ErrDeltaMismatch.
+func ApplyDelta(base, patch []byte, s *schema.Schema) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	ops, keyField, err := readDeltaRows(patch, DeltaSchema(s))
+	if err != nil {
+		return nil, err
+	}
+	keyIdx, kind := -1, schema.KindInvalid
+	if keyField != "" {
+		var ok bool
+		if keyIdx, ok = s.FieldIndex(keyField); !ok {
+			return nil, fmt.Errorf("%w: schema %s lacks key field %s", ErrDeltaMismatch, s.Name, keyField)
+		}
+		kind = s.Fields[keyIdx].ValueKind()
+		if !schema.IndexableKind(kind) {
+			return nil, fmt.Errorf("%w: field %s (%s) cannot be used as a delta key", ErrDeltaMismatch, keyField, s.Fields[keyIdx].RawType)
+		}
+	}
+	baseRows, baseKeys, err := readKeyedRows(base, s, keyIdx, kind, "base")
+	if err != nil {
+		return nil, err
+	}
+
+	dropped := make([]bool, len(baseRows))
+	var placed []codec.Row
+	var positions []uint64
+	for i, op := range ops {
+		vals := op.Values()
+		key := vals[deltaColumns+keyIdx]
+		if !key.Set {
+			return nil, fmt.Errorf("%w: patch row %d lacks key field %s", ErrDeltaMismatch, i, keyField)
+		}
+		from, inBase := baseKeys[mergeKeyOf(key, kind)]
+		switch vals[0].Uint {
+		case DeltaInsert:
+			if inBase {
+				return nil, fmt.Errorf("%w: patch row %d inserts a key base already holds", ErrDeltaMismatch, i)
+			}
+		default:
+			if !inBase || dropped[from] {
+				return nil, fmt.Errorf("%w: patch row %d changes a key base lacks", ErrDeltaMismatch, i)
+			}
+			dropped[from] = true
+		}
+		if vals[0].Uint != DeltaDelete {
+			row := codec.NewRow(s)
+			copy(row.Values(), vals[deltaColumns:])
+			placed = append(placed, row)
+			positions = append(positions, vals[1].Uint)
+		}
+	}
+
+	kept := make([]codec.Row, 0, len(baseRows))
+	for i, row := range baseRows {
+		if !dropped[i] {
+			kept = append(kept, row)
+		}
+	}
+	total := uint64(len(kept) + len(placed))
+	if len(positions) > 0 && positions[len(positions)-1] >= total {
+		return nil, fmt.Errorf("%w: position %d is past the %d rows of the target", ErrDeltaMismatch, positions[len(positions)-1], total)
+	}
+	var buf bytes.Buffer
+	writer := codec.NewWriter(&buf, s, 0)
+	for pos := uint64(0); pos < total; pos++ {
+		var row codec.Row
+		if len(positions) > 0 && positions[0] == pos {
+			row, placed, positions = placed[0], placed[1:], positions[1:]
+		} else {
+			row, kept = kept[0], kept[1:]
+		}
+		if err := writer.WriteRow(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readKeyedRows decodes every row of payload, which must set the field at
+// keyIdx once per key, and indexes the rows by key. A negative keyIdx reads
+// the rows without indexing them. Rows are read as stored, without the
+// defaults of s filled in, so they compare and re-encode exactly.
+func readKeyedRows(payload []byte, s *schema.Schema, keyIdx int, kind schema.FieldKind, what string) ([]codec.Row, map[mergeKey]int, error) {
+	var rows []codec.Row
+	keys := make(map[mergeKey]int)
+	if len(payload) == 0 {
+		return rows, keys, nil
+	}
+	info, err := codec.ReadStreamInfo(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("scrt: %s: %w", what, err)
+	}
+	if info.Fingerprint != s.Fingerprint() {
+		return nil, nil, fmt.Errorf("scrt: %s: %w", what, codec.ErrSchemaFingerprintMismatch)
+	}
+	// Only defaults differ, so the pages read as they are under bare.
+	bare := withoutDefaults(s)
+	if payload, err = codec.Rebind(payload, bare); err != nil {
+		return nil, nil, fmt.Errorf("scrt: %s: %w", what, err)
+	}
+	reader := codec.NewReader(bytes.NewReader(payload), bare)
+	row := codec.NewRow(bare)
+	for {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scrt: %s: %w", what, err)
+		}
+		if !ok {
+			return rows, keys, nil
+		}
+		// The clone owns its strings, which the map keys then share.
+		owned := row.Clone()
+		if keyIdx >= 0 {
+			val := owned.Values()[keyIdx]
+			if !val.Set {
+				return nil, nil, fmt.Errorf("scrt: %s row %d lacks key field %s", what, len(rows), s.Fields[keyIdx].Name)
+			}
+			key := mergeKeyOf(val, kind)
+			if prev, dup := keys[key]; dup {
+				return nil, nil, fmt.Errorf("scrt: %s rows %d and %d share a %s key", what, prev, len(rows), s.Fields[keyIdx].Name)
+			}
+			keys[key] = len(rows)
+		}
+		rows = append(rows, owned)
+	}
+}
+
+// readDeltaRows decodes every row of patch and returns them with the key
+// field the patch names, or "" for an empty patch. Ops must be known, every
+// row must name the same key, deletes must precede placed rows, and placed
+// rows must come in increasing position order.
+func readDeltaRows(patch []byte, ds *schema.Schema) ([]codec.Row, string, error) {
+	var rows []codec.Row
+	var keyField string
+	reader := codec.NewReader(bytes.NewReader(patch), ds)
+	row := codec.NewRow(ds)
+	placing := false
+	var next uint64
+	for {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, "", fmt.Errorf("scrt: delta: %w", err)
+		}
+		if !ok {
+			return rows, keyField, nil
+		}
+		vals := row.Values()
+		if !vals[2].Set || vals[2].Str == "" || (keyField != "" && vals[2].Str != keyField) {
+			return nil, "", fmt.Errorf("%w: patch row %d names key %q", ErrDeltaMismatch, len(rows), vals[2].Str)
+		}
+		keyField = vals[2].Str
+		switch op := vals[0].Uint; {
+		case !vals[0].Set || op < DeltaInsert || op > DeltaDelete:
+			return nil, "", fmt.Errorf("%w: patch row %d has unknown op %d", ErrDeltaMismatch, len(rows), op)
+		case op == DeltaDelete:
+			if placing {
+				return nil, "", fmt.Errorf("%w: patch row %d deletes after placed rows", ErrDeltaMismatch, len(rows))
+			}
+		default:
+			if !vals[1].Set || (placing && vals[1].Uint < next) {
+				return nil, "", fmt.Errorf("%w: patch row %d is out of position order", ErrDeltaMismatch, len(rows))
+			}
+			placing = true
+			next = vals[1].Uint + 1
+		}
+		rows = append(rows, row.Clone())
+	}
+}
+
+// sameRow reports whether a and b, rows of s, encode to the same values.
+func sameRow(s *schema.Schema, a, b codec.Row) bool {
+	av, bv := a.Values(), b.Values()
+	for i, field := range s.Fields {
+		x, y := av[i], bv[i]
+		if x.Set != y.Set {
+			return false
+		}
+		if !x.Set {
+			continue
+		}
+		if field.ValueKind() == schema.KindList {
+			if !slices.Equal(x.Strs, y.Strs) || !slices.Equal(x.Uints, y.Uints) {
+				return false
+			}
+			continue
+		}
+		if !sameValue(field.ValueKind(), x, y) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package scrt
+
+import (
+	"errors"
+
+	"github.com/oarkflow/scrt/codec"
+)
+
+// ErrSchemaRequired is returned when a nil schema is passed in.
+var ErrSchemaRequired = errors.New("scrt: schema is required")
+
+// Decoding errors, re-exported from codec so callers of this package can
+// match them with errors.Is without importing codec. Returned errors wrap
+// them with the detail of what was wrong.
+var (
+	// ErrInvalidMagic marks input that is not an SCRT stream.
+	ErrInvalidMagic = codec.ErrInvalidMagic
+	// ErrUnsupportedVersion marks a stream format version this release cannot read.
+	ErrUnsupportedVersion = codec.ErrUnsupportedVersion
+	// ErrSchemaMismatch marks a payload written for a schema with a different fingerprint.
+	ErrSchemaMismatch = codec.ErrSchemaFingerprintMismatch
+	// ErrColumnCountMismatch marks a page whose column count differs from the schema.
+	ErrColumnCountMismatch = codec.ErrColumnCountMismatch
+	// ErrCorruptPage marks a page that cannot be decoded.
+	ErrCorruptPage = codec.ErrCorruptPage
+	// ErrPageChecksum marks a page whose CRC does not match its contents.
+	ErrPageChecksum = codec.ErrPageChecksum
+	// ErrFooterMismatch marks a footer that does not match the stream's pages.
+	ErrFooterMismatch = codec.ErrFooterMismatch
+)
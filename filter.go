@@ -0,0 +1,45 @@
+package scrt
+
+import (
+	"bytes"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// FilterUint returns the IDs of the rows of data whose uint64 or ref field
+// satisfies pred, decoding only that column one page at a time. Row IDs
+// count from the start of the payload across pages, as
+// storage.BuildRowIndex numbers them, so they can be passed to
+// SnapshotStore.LookupRow. Unset values never match.
+func FilterUint(data []byte, s *schema.Schema, field string, pred func(uint64) bool) ([]uint64, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	return codec.FilterUint(bytes.NewReader(data), s, field, pred)
+}
+
+// FilterInt is FilterUint for int64 fields.
+func FilterInt(data []byte, s *schema.Schema, field string, pred func(int64) bool) ([]uint64, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	return codec.FilterInt(bytes.NewReader(data), s, field, pred)
+}
+
+// FilterString is FilterUint for string fields. pred must copy a string it
+// keeps, since it may share the page buffer.
+func FilterString(data []byte, s *schema.Schema, field string, pred func(string) bool) ([]uint64, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	return codec.FilterString(bytes.NewReader(data), s, field, pred)
+}
+
+// FilterBool is FilterUint for bool fields.
+func FilterBool(data []byte, s *schema.Schema, field string, pred func(bool) bool) ([]uint64, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	return codec.FilterBool(bytes.NewReader(data), s, field, pred)
+}
@@ -0,0 +1,49 @@
+package scrt
+
+import (
+	"reflect"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+// MarshalSlice is Marshal for a typed slice. T is usually a struct, a pointer
+// to one, or a map; struct bindings are resolved once for T and shared with
+// Marshal and Unmarshal through the same cache.
+func MarshalSlice[T any](s *schema.Schema, rows []T, opts ...MarshalOption) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	if err := bindElem[T](s); err != nil {
+		return nil, err
+	}
+	return Marshal(s, rows, opts...)
+}
+
+// UnmarshalSlice decodes every row of data into a new []T. An empty stream
+// yields an empty, non-nil slice. Rows decoded before an error are returned
+// with it, as Unmarshal leaves them in its output.
+func UnmarshalSlice[T any](data []byte, s *schema.Schema, opts ...UnmarshalOption) ([]T, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	if err := bindElem[T](s); err != nil {
+		return nil, err
+	}
+	var out []T
+	err := UnmarshalWithOptions(data, s, &out, opts...)
+	return out, err
+}
+
+// bindElem resolves the struct bindings of T, or of the struct T points to,
+// so a binding error surfaces before any row is touched.
+func bindElem[T any](s *schema.Schema) error {
+	t := reflect.TypeFor[T]()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	_, err := structBindingsForSchema(t, s)
+	return err
+}
@@ -0,0 +1,196 @@
+package scrt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
+)
+
+// FromJSON marshals a JSON array of objects into an SCRT payload. Values are
+// converted as Marshal converts map input, so numbers and strings coerce to
+// the field's kind and temporal fields accept their canonical strings or
+// epoch numbers. A null or missing key leaves the field unset, keys that
+// name no field are ignored, and bytes fields take standard base64. Fields
+// with a codec= attribute receive the decoded JSON value, with numbers as
+// json.Number.
+func FromJSON(s *schema.Schema, jsonArray []byte, opts ...MarshalOption) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	dec := json.NewDecoder(bytes.NewReader(jsonArray))
+	dec.UseNumber()
+	var records []map[string]any
+	if err := dec.Decode(&records); err != nil {
+		return nil, fmt.Errorf("scrt: decode json: %w", err)
+	}
+	for i, record := range records {
+		for _, field := range s.Fields {
+			src, ok := record[field.Name]
+			if !ok || src == nil || field.Codec != "" {
+				continue
+			}
+			val, err := jsonFieldValue(field, src)
+			if err != nil {
+				return nil, fmt.Errorf("scrt: record %d field %s: %w", i, field.Name, err)
+			}
+			record[field.Name] = val
+		}
+	}
+	if records == nil {
+		records = []map[string]any{}
+	}
+	return Marshal(s, records, opts...)
+}
+
+// jsonFieldValue prepares a decoded JSON value for assignAnyToRow. Numbers
+// become int64 when they fit, then uint64, then float64.
+func jsonFieldValue(field schema.Field, src any) (any, error) {
+	switch val := src.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(val.String(), 10, 64); err == nil {
+			return u, nil
+		}
+		f, err := val.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("scrt: cannot parse number %s", val)
+		}
+		return f, nil
+	case string:
+		if field.ValueKind() == schema.KindBytes {
+			b, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return nil, fmt.Errorf("scrt: bytes value is not base64: %w", err)
+			}
+			return b, nil
+		}
+	}
+	return src, nil
+}
+
+// jsonDateTimeLayout renders datetime fields, which carry no zone, in a form
+// temporal.ParseDateTime accepts.
+const jsonDateTimeLayout = "2006-01-02T15:04:05.999999999"
+
+// ToJSON renders payload as a JSON array with one object per row. Keys follow
+// schema field order and unset fields are omitted. Temporal fields use their
+// canonical strings: dates as 2006-01-02, datetimes as 2006-01-02T15:04:05
+// without a zone, timestamps as RFC 3339 in UTC, timestamptz with its
+// offset, durations as Go durations, and times of day as 15:04:05. Bytes are
+// standard base64 and uuids use their hyphenated form. Fields with a codec= attribute emit their decoded value.
+// Computed fields follow the stored ones.
+func ToJSON(s *schema.Schema, payload []byte) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	reader := codec.NewReader(bytes.NewReader(payload), s)
+	row := codec.NewRow(s)
+	out := []byte{'['}
+	for rowID := 0; ; rowID++ {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if rowID > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, '{')
+		first := true
+		for idx, field := range s.Fields {
+			val := row.Values()[idx]
+			if !val.Set {
+				continue
+			}
+			jv, err := jsonValueFromRow(field, val)
+			if err != nil {
+				return nil, fmt.Errorf("scrt: row %d field %s: %w", rowID, field.Name, err)
+			}
+			data, err := json.Marshal(jv)
+			if err != nil {
+				return nil, fmt.Errorf("scrt: row %d field %s: %w", rowID, field.Name, err)
+			}
+			if !first {
+				out = append(out, ',')
+			}
+			first = false
+			name, _ := json.Marshal(field.Name)
+			out = append(out, name...)
+			out = append(out, ':')
+			out = append(out, data...)
+		}
+		for _, c := range s.Computed {
+			val, ok := EvalComputed(s, c, row)
+			if !ok {
+				continue
+			}
+			data, err := json.Marshal(val)
+			if err != nil {
+				return nil, fmt.Errorf("scrt: row %d computed field %s: %w", rowID, c.Name, err)
+			}
+			if !first {
+				out = append(out, ',')
+			}
+			first = false
+			name, _ := json.Marshal(c.Name)
+			out = append(out, name...)
+			out = append(out, ':')
+			out = append(out, data...)
+		}
+		out = append(out, '}')
+	}
+	return append(out, ']'), nil
+}
+
+// jsonValueFromRow converts a stored value into what ToJSON encodes.
+func jsonValueFromRow(field schema.Field, val codec.Value) (any, error) {
+	if field.Codec != "" {
+		return decodeWithCodec(field, val)
+	}
+	switch field.ValueKind() {
+	case schema.KindDate:
+		return temporal.FormatDate(temporal.DecodeDate(val.Int)), nil
+	case schema.KindDateTime:
+		return temporal.DecodeInstant(val.Int).UTC().Format(jsonDateTimeLayout), nil
+	case schema.KindTimestamp:
+		return temporal.FormatInstant(temporal.DecodeInstant(val.Int)), nil
+	case schema.KindTimestampTZ:
+		return val.Str, nil
+	case schema.KindDuration:
+		return time.Duration(val.Int).String(), nil
+	case schema.KindTime:
+		return temporal.FormatTimeOfDay(time.Duration(val.Int)), nil
+	case schema.KindUUID:
+		return uuid.FormatBytes(val.Bytes), nil
+	case schema.KindBytes:
+		if val.Bytes == nil {
+			return []byte{}, nil
+		}
+		return val.Bytes, nil
+	case schema.KindList:
+		if field.ElemKind == schema.KindString {
+			if val.Strs == nil {
+				return []string{}, nil
+			}
+			return val.Strs, nil
+		}
+		if val.Uints == nil {
+			return []uint64{}, nil
+		}
+		return val.Uints, nil
+	default:
+		return valueFromRow(field.ValueKind(), val), nil
+	}
+}
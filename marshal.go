@@ -2,7 +2,9 @@ package scrt
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"sync"
@@ -50,12 +52,38 @@ var mapStringAnyType = reflect.TypeOf(map[string]any{})
 // MarshalOptions controls high-level marshal behavior.
 type MarshalOptions struct {
 	RowsPerPage int
+	// Writer carries optional stream encodings such as page checksums.
+	Writer codec.WriterOptions
+	// StrictTemporal rejects temporal values that would lose information
+	// when stored; see WithStrictTemporal.
+	StrictTemporal bool
+	// SortBy names a field to order rows by before they are encoded; see
+	// WithSortBy.
+	SortBy string
+}
+
+// encodeConfig carries the MarshalOptions that affect how values are
+// converted into row fields.
+type encodeConfig struct {
+	strictTemporal bool
 }
 
 // MarshalOption mutates MarshalOptions.
 type MarshalOption func(*MarshalOptions)
 
-// WithRowsPerPage overrides the default page size used during marshaling.
+// newMarshalOptions applies opts over the defaults for s. The page size
+// starts at the schema's @pragma rows_per_page, if any, so WithRowsPerPage
+// overrides it.
+func newMarshalOptions(s *schema.Schema, opts []MarshalOption) MarshalOptions {
+	config := MarshalOptions{RowsPerPage: codec.PageSize(s, 0)}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// WithRowsPerPage overrides the page size used during marshaling, including
+// one declared with @pragma rows_per_page.
 func WithRowsPerPage(n int) MarshalOption {
 	return func(opts *MarshalOptions) {
 		if n > 0 {
@@ -64,27 +92,160 @@ func WithRowsPerPage(n int) MarshalOption {
 	}
 }
 
+// WithPageChecksums appends a CRC32C to every page so storage lookups can
+// verify the single page they read.
+func WithPageChecksums() MarshalOption {
+	return func(opts *MarshalOptions) {
+		opts.Writer.PageChecksums = true
+	}
+}
+
+// WithOffsetTimestampTZ stores timestamptz fields as a UTC instant plus a
+// zone offset in minutes rather than as RFC3339 strings. Named zones collapse
+// to the fixed offset in effect at each instant; see
+// codec.WriterOptions.OffsetTimestampTZ.
+func WithOffsetTimestampTZ() MarshalOption {
+	return func(opts *MarshalOptions) {
+		opts.Writer.OffsetTimestampTZ = true
+	}
+}
+
+// WithPlainStrings writes a string column's page without a dictionary when
+// the plain layout is smaller, as for UUIDs and free text where nearly every
+// value is distinct. See codec.WriterOptions.AutoPlainStrings.
+func WithPlainStrings() MarshalOption {
+	return func(opts *MarshalOptions) {
+		opts.Writer.AutoPlainStrings = true
+	}
+}
+
+// WithNarrowIntegers stores integer and time columns at the narrowest fixed
+// width that holds each page's values when that is no larger than varints.
+// See codec.WriterOptions.NarrowIntegers.
+func WithNarrowIntegers() MarshalOption {
+	return func(opts *MarshalOptions) {
+		opts.Writer.NarrowIntegers = true
+	}
+}
+
+// WithStrictTemporal makes Marshal fail instead of silently dropping
+// precision: a date field must receive midnight UTC, a timestamp(s|ms|us)
+// field a value with no digits below its declared unit, and datetime and
+// timestamp fields an instant within the int64 nanosecond range (1677-2262).
+// Without it dates are truncated to their UTC day as before.
+func WithStrictTemporal() MarshalOption {
+	return func(opts *MarshalOptions) {
+		opts.StrictTemporal = true
+	}
+}
+
+// WithFooter terminates the payload with a CRC32C of its pages and the row
+// count so truncated or corrupted payloads fail to decode.
+func WithFooter() MarshalOption {
+	return func(opts *MarshalOptions) {
+		opts.Writer.Footer = true
+	}
+}
+
+// WithSortBy buffers every row and writes them ordered by field, so page
+// zones over that field stay narrow and range scans skip more pages. The sort
+// is stable: rows with equal keys keep their input order, and rows without a
+// value come first. Marshal fails for bytes and list fields, which have no
+// order. Memory grows with the whole input rather than one page.
+func WithSortBy(field string) MarshalOption {
+	return func(opts *MarshalOptions) {
+		opts.SortBy = field
+	}
+}
+
 // Marshal serializes the provided record(s) into SCRT binary form.
 func Marshal(s *schema.Schema, input any, opts ...MarshalOption) ([]byte, error) {
+	return MarshalContext(context.Background(), s, input, opts...)
+}
+
+// MarshalContext is Marshal with cancellation. ctx is checked once per page of
+// rows, and its error is returned as soon as it is observed.
+func MarshalContext(ctx context.Context, s *schema.Schema, input any, opts ...MarshalOption) ([]byte, error) {
 	if s == nil {
-		return nil, fmt.Errorf("scrt: schema is required")
-	}
-	config := MarshalOptions{RowsPerPage: 1024}
-	for _, opt := range opts {
-		opt(&config)
+		return nil, ErrSchemaRequired
 	}
+	config := newMarshalOptions(s, opts)
 
 	// Use a pooled buffer to reduce allocations
 	buf := bufferPool.Get().(*bytes.Buffer)
 	buf.Reset()
 	defer bufferPool.Put(buf)
 
-	if err := encodeInto(buf, s, input, config); err != nil {
+	if _, err := encodeInto(ctx, buf, s, input, config); err != nil {
 		return nil, err
 	}
 	return append([]byte(nil), buf.Bytes()...), nil
 }
 
+// MarshalResult is a payload together with the writer's counters.
+type MarshalResult struct {
+	Payload []byte
+	Stats   codec.WriterStats
+}
+
+// MarshalWithStats is Marshal that also reports how many pages, rows, and
+// bytes were written, which helps when tuning WithRowsPerPage.
+func MarshalWithStats(s *schema.Schema, input any, opts ...MarshalOption) (MarshalResult, error) {
+	if s == nil {
+		return MarshalResult{}, ErrSchemaRequired
+	}
+	config := newMarshalOptions(s, opts)
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+
+	stats, err := encodeInto(context.Background(), buf, s, input, config)
+	if err != nil {
+		return MarshalResult{}, err
+	}
+	return MarshalResult{Payload: append([]byte(nil), buf.Bytes()...), Stats: stats}, nil
+}
+
+// MarshalAppend encodes input into new pages appended to existing, an SCRT
+// payload written with s, without decoding or rewriting the pages already
+// there, so the cost follows the new rows rather than the whole payload. The
+// header of existing must carry s's fingerprint. The new pages follow its page
+// checksum setting, and a footer is verified and rebuilt over the combined
+// pages; WithPageChecksums and WithFooter are ignored, and encoding=global
+// fields get a dictionary per new page, as the new pages cannot extend the
+// stream-wide tables of existing.
+// WithSortBy orders only the new rows. An empty existing is a plain Marshal.
+func MarshalAppend(existing []byte, s *schema.Schema, input any, opts ...MarshalOption) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	if len(existing) == 0 {
+		return Marshal(s, input, opts...)
+	}
+	info, err := codec.ReadStreamInfo(existing)
+	if err != nil {
+		return nil, fmt.Errorf("scrt: append: %w", err)
+	}
+	if info.Fingerprint != s.Fingerprint() {
+		return nil, fmt.Errorf("scrt: append to %s: %w", s.Name, codec.ErrSchemaFingerprintMismatch)
+	}
+	if info.Version != codec.FormatVersion {
+		return nil, fmt.Errorf("scrt: cannot append to a version %d payload; re-encode it first", info.Version)
+	}
+	config := newMarshalOptions(s, opts)
+	config.Writer.PageChecksums = info.PageChecksums
+	config.Writer.Footer = false
+	config.Writer.LocalDictionaries = true
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+	if _, err := encodeInto(context.Background(), buf, s, input, config); err != nil {
+		return nil, err
+	}
+	return codec.AppendPages(existing, buf.Bytes())
+}
+
 // MarshalToFile writes SCRT data directly to the provided file path.
 func MarshalToFile(path string, s *schema.Schema, input any, opts ...MarshalOption) error {
 	data, err := Marshal(s, input, opts...)
@@ -107,25 +268,84 @@ func MarshalFiles(schemaPath, schemaName, dataPath string, input any, opts ...Ma
 	return MarshalToFile(dataPath, sch, input, opts...)
 }
 
-func encodeInto(dst *bytes.Buffer, s *schema.Schema, input any, cfg MarshalOptions) error {
-	writer := codec.NewWriter(dst, s, cfg.RowsPerPage)
+func encodeInto(ctx context.Context, dst *bytes.Buffer, s *schema.Schema, input any, cfg MarshalOptions) (codec.WriterStats, error) {
+	writerOpts := cfg.Writer
+	writerOpts.DefaultFuncs = true
+	writer := codec.NewWriterWithOptions(dst, s, cfg.RowsPerPage, writerOpts)
+	encCfg := encodeConfig{strictTemporal: cfg.StrictTemporal}
+	if cfg.SortBy != "" {
+		return encodeSorted(ctx, writer, s, input, cfg, encCfg)
+	}
 	row := codec.AcquireRow(s)
 	defer codec.ReleaseRow(row)
+	rows := 0
 	err := visitRecords(input, func(v reflect.Value) error {
+		// Checking once per page keeps ctx off the per-row hot path.
+		if rows%cfg.RowsPerPage == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		rows++
 		v = indirect(v)
 		if !v.IsValid() {
 			return fmt.Errorf("scrt: nil record")
 		}
 		row.Reset()
-		if err := populateRow(*row, v, s); err != nil {
+		if err := populateRow(*row, v, s, encCfg); err != nil {
 			return err
 		}
 		return writer.WriteRow(*row)
 	})
 	if err != nil {
-		return err
+		return codec.WriterStats{}, err
+	}
+	err = writer.Close()
+	return writer.Stats(), err
+}
+
+// encodeSorted populates a row per record, stably sorts them by cfg.SortBy,
+// and only then hands them to writer.
+func encodeSorted(ctx context.Context, writer *codec.Writer, s *schema.Schema, input any, cfg MarshalOptions, encCfg encodeConfig) (codec.WriterStats, error) {
+	if _, _, err := codec.SortField(s, cfg.SortBy); err != nil {
+		return codec.WriterStats{}, fmt.Errorf("scrt: sort by: %w", err)
 	}
-	return writer.Close()
+	var buffered []codec.Row
+	err := visitRecords(input, func(v reflect.Value) error {
+		if len(buffered)%cfg.RowsPerPage == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		v = indirect(v)
+		if !v.IsValid() {
+			return fmt.Errorf("scrt: nil record")
+		}
+		row := codec.NewRow(s)
+		if err := populateRow(row, v, s, encCfg); err != nil {
+			return err
+		}
+		buffered = append(buffered, row)
+		return nil
+	})
+	if err != nil {
+		return codec.WriterStats{}, err
+	}
+	if err := codec.SortRows(buffered, cfg.SortBy); err != nil {
+		return codec.WriterStats{}, err
+	}
+	for i, row := range buffered {
+		if i%cfg.RowsPerPage == 0 {
+			if err := ctx.Err(); err != nil {
+				return codec.WriterStats{}, err
+			}
+		}
+		if err := writer.WriteRow(row); err != nil {
+			return codec.WriterStats{}, err
+		}
+	}
+	err = writer.Close()
+	return writer.Stats(), err
 }
 
 func visitRecords(input any, fn func(reflect.Value) error) error {
@@ -158,114 +378,151 @@ func visitRecords(input any, fn func(reflect.Value) error) error {
 	return nil
 }
 
-func populateRow(row codec.Row, value reflect.Value, s *schema.Schema) error {
+func populateRow(row codec.Row, value reflect.Value, s *schema.Schema, cfg encodeConfig) error {
 	switch value.Kind() {
 	case reflect.Struct:
-		return populateRowFromStruct(row, value, s)
+		return populateRowFromStruct(row, value, s, cfg)
 	case reflect.Map:
-		return populateRowFromMap(row, value, s)
+		return populateRowFromMap(row, value, s, cfg)
 	default:
 		return fmt.Errorf("scrt: unsupported record kind %s", value.Kind())
 	}
 }
 
-func populateRowFromStruct(row codec.Row, value reflect.Value, s *schema.Schema) error {
+func populateRowFromStruct(row codec.Row, value reflect.Value, s *schema.Schema, cfg encodeConfig) error {
 	if fast := fastEncoderForStruct(value.Type(), s); fast != nil && value.CanAddr() {
 		fast.encode(row, value)
 		return nil
 	}
-	bindings := structBindingsForSchema(value.Type(), s)
+	bindings, err := structBindingsForSchema(value.Type(), s)
+	if err != nil {
+		return err
+	}
 	for idx, binding := range bindings {
 		if len(binding.index) == 0 {
 			continue
 		}
-		fv := value.FieldByIndex(binding.index)
-		if !fv.IsValid() {
+		fv, err := value.FieldByIndexErr(binding.index)
+		if err != nil || !fv.IsValid() {
+			// A nil embedded pointer leaves its promoted fields unset.
+			continue
+		}
+		if binding.omitEmpty && isEmptyValue(fv) {
 			continue
 		}
-		if err := assignValueToRow(row, idx, s.Fields[idx].ValueKind(), fv); err != nil {
+		if err := assignValueToRow(row, idx, s.Fields[idx].ValueKind(), fv, cfg); err != nil {
 			return fmt.Errorf("scrt: field %s: %w", s.Fields[idx].Name, err)
 		}
 	}
 	return nil
 }
 
-func populateRowFromMap(row codec.Row, value reflect.Value, s *schema.Schema) error {
-	if value.Type().Key().Kind() != reflect.String {
-		return fmt.Errorf("scrt: map key must be string, got %s", value.Type().Key())
+func populateRowFromMap(row codec.Row, value reflect.Value, s *schema.Schema, cfg encodeConfig) error {
+	if keyType := value.Type().Key(); keyType.Kind() != reflect.String {
+		if !keyType.Implements(stringerType) {
+			return fmt.Errorf("scrt: map key must be string or fmt.Stringer, got %s", keyType)
+		}
+		return populateRowFromMapAny(row, stringerKeyedMap(value), s, cfg)
 	}
 	if flattened, ok := flattenNestedMap(value); ok {
-		return populateRowFromMapAny(row, flattened, s)
+		return populateRowFromMapAny(row, flattened, s, cfg)
 	}
 	switch data := value.Interface().(type) {
 	case map[string]any:
-		return populateRowFromMapAny(row, data, s)
+		return populateRowFromMapAny(row, data, s, cfg)
 	case map[string]bool:
-		return populateRowFromMapBool(row, data, s)
+		return populateRowFromMapBool(row, data, s, cfg)
 	case map[string]int:
-		return populateRowFromMapInt(row, data, s)
+		return populateRowFromMapInt(row, data, s, cfg)
 	case map[string]int8:
-		return populateRowFromMapInt8(row, data, s)
+		return populateRowFromMapInt8(row, data, s, cfg)
 	case map[string]int16:
-		return populateRowFromMapInt16(row, data, s)
+		return populateRowFromMapInt16(row, data, s, cfg)
 	case map[string]int32:
-		return populateRowFromMapInt32(row, data, s)
+		return populateRowFromMapInt32(row, data, s, cfg)
 	case map[string]int64:
-		return populateRowFromMapInt64(row, data, s)
+		return populateRowFromMapInt64(row, data, s, cfg)
 	case map[string]uint:
-		return populateRowFromMapUint(row, data, s)
+		return populateRowFromMapUint(row, data, s, cfg)
 	case map[string]uint8:
-		return populateRowFromMapUint8(row, data, s)
+		return populateRowFromMapUint8(row, data, s, cfg)
 	case map[string]uint16:
-		return populateRowFromMapUint16(row, data, s)
+		return populateRowFromMapUint16(row, data, s, cfg)
 	case map[string]uint32:
-		return populateRowFromMapUint32(row, data, s)
+		return populateRowFromMapUint32(row, data, s, cfg)
 	case map[string]uint64:
-		return populateRowFromMapUint64(row, data, s)
+		return populateRowFromMapUint64(row, data, s, cfg)
 	case map[string]float64:
-		return populateRowFromMapFloat64(row, data, s)
+		return populateRowFromMapFloat64(row, data, s, cfg)
 	case map[string]float32:
-		return populateRowFromMapFloat32(row, data, s)
+		return populateRowFromMapFloat32(row, data, s, cfg)
 	case map[string]string:
-		return populateRowFromMapString(row, data, s)
+		return populateRowFromMapString(row, data, s, cfg)
 	case map[string][]byte:
-		return populateRowFromMapBytes(row, data, s)
+		return populateRowFromMapBytes(row, data, s, cfg)
 	case map[string]time.Time:
-		return populateRowFromMapTime(row, data, s)
+		return populateRowFromMapTime(row, data, s, cfg)
 	case map[string]time.Duration:
-		return populateRowFromMapDuration(row, data, s)
+		return populateRowFromMapDuration(row, data, s, cfg)
 	default:
-		return populateRowFromMapReflect(row, value, s)
+		return populateRowFromMapReflect(row, value, s, cfg)
 	}
 }
 
-func populateRowFromMapAny(row codec.Row, data map[string]any, s *schema.Schema) error {
+// FillRowMap sets the fields of row from m the way Marshal converts
+// map[string]any input. Pass it as codec.WriterOptions.MapFiller so
+// codec.Writer.WriteRowMap accepts the same values Marshal does.
+func FillRowMap(row codec.Row, m map[string]any) error {
+	return populateRowFromMapAny(row, m, row.Schema(), encodeConfig{})
+}
+
+func populateRowFromMapAny(row codec.Row, data map[string]any, s *schema.Schema, cfg encodeConfig) error {
 	for idx, field := range s.Fields {
 		mv, ok := data[field.Name]
 		if !ok || mv == nil {
 			continue
 		}
-		if err := assignAnyToRow(row, idx, field.ValueKind(), mv); err != nil {
+		if err := assignAnyToRow(row, idx, field.ValueKind(), mv, cfg); err != nil {
 			return fmt.Errorf("scrt: field %s: %w", field.Name, err)
 		}
 	}
 	return nil
 }
 
-func populateRowFromMapReflect(row codec.Row, value reflect.Value, s *schema.Schema) error {
+// stringerKeyedMap re-keys a map whose keys implement fmt.Stringer by their
+// String() form. Nil keys are skipped.
+func stringerKeyedMap(value reflect.Value) map[string]any {
+	out := make(map[string]any, value.Len())
+	iter := value.MapRange()
+	for iter.Next() {
+		key := iter.Key()
+		switch key.Kind() {
+		case reflect.Pointer, reflect.Interface:
+			if key.IsNil() {
+				continue
+			}
+		}
+		out[key.Interface().(fmt.Stringer).String()] = iter.Value().Interface()
+	}
+	return out
+}
+
+func populateRowFromMapReflect(row codec.Row, value reflect.Value, s *schema.Schema, cfg encodeConfig) error {
+	// Convert handles named string key types such as `type Column string`.
+	keyType := value.Type().Key()
 	for idx, field := range s.Fields {
-		mv := value.MapIndex(reflect.ValueOf(field.Name))
+		mv := value.MapIndex(reflect.ValueOf(field.Name).Convert(keyType))
 		if !mv.IsValid() {
 			continue
 		}
-		if err := assignValueToRow(row, idx, field.ValueKind(), mv); err != nil {
+		if err := assignValueToRow(row, idx, field.ValueKind(), mv, cfg); err != nil {
 			return fmt.Errorf("scrt: field %s: %w", field.Name, err)
 		}
 	}
 	return nil
 }
 
-func populateRowFromMapBool(row codec.Row, data map[string]bool, s *schema.Schema) error {
+func populateRowFromMapBool(row codec.Row, data map[string]bool, s *schema.Schema, cfg encodeConfig) error {
 	for idx, field := range s.Fields {
 		v, ok := data[field.Name]
 		if !ok {
@@ -282,27 +539,27 @@ func populateRowFromMapBool(row codec.Row, data map[string]bool, s *schema.Schem
 	return nil
 }
 
-func populateRowFromMapInt(row codec.Row, data map[string]int, s *schema.Schema) error {
-	return populateRowFromMapSigned(row, data, s)
+func populateRowFromMapInt(row codec.Row, data map[string]int, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapSigned(row, data, s, cfg)
 }
 
-func populateRowFromMapInt8(row codec.Row, data map[string]int8, s *schema.Schema) error {
-	return populateRowFromMapSigned(row, data, s)
+func populateRowFromMapInt8(row codec.Row, data map[string]int8, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapSigned(row, data, s, cfg)
 }
 
-func populateRowFromMapInt16(row codec.Row, data map[string]int16, s *schema.Schema) error {
-	return populateRowFromMapSigned(row, data, s)
+func populateRowFromMapInt16(row codec.Row, data map[string]int16, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapSigned(row, data, s, cfg)
 }
 
-func populateRowFromMapInt32(row codec.Row, data map[string]int32, s *schema.Schema) error {
-	return populateRowFromMapSigned(row, data, s)
+func populateRowFromMapInt32(row codec.Row, data map[string]int32, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapSigned(row, data, s, cfg)
 }
 
-func populateRowFromMapInt64(row codec.Row, data map[string]int64, s *schema.Schema) error {
-	return populateRowFromMapSigned(row, data, s)
+func populateRowFromMapInt64(row codec.Row, data map[string]int64, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapSigned(row, data, s, cfg)
 }
 
-func populateRowFromMapSigned[T signedInt](row codec.Row, data map[string]T, s *schema.Schema) error {
+func populateRowFromMapSigned[T signedInt](row codec.Row, data map[string]T, s *schema.Schema, cfg encodeConfig) error {
 	for idx, field := range s.Fields {
 		v, ok := data[field.Name]
 		if !ok {
@@ -317,7 +574,7 @@ func populateRowFromMapSigned[T signedInt](row codec.Row, data map[string]T, s *
 			continue
 		}
 		if intStoredKind(kind) {
-			if err := assignValueToRow(row, idx, kind, reflect.ValueOf(int64(v))); err != nil {
+			if err := assignValueToRow(row, idx, kind, reflect.ValueOf(int64(v)), cfg); err != nil {
 				return fmt.Errorf("scrt: field %s: %w", field.Name, err)
 			}
 			continue
@@ -327,27 +584,27 @@ func populateRowFromMapSigned[T signedInt](row codec.Row, data map[string]T, s *
 	return nil
 }
 
-func populateRowFromMapUint(row codec.Row, data map[string]uint, s *schema.Schema) error {
-	return populateRowFromMapUnsigned(row, data, s)
+func populateRowFromMapUint(row codec.Row, data map[string]uint, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapUnsigned(row, data, s, cfg)
 }
 
-func populateRowFromMapUint8(row codec.Row, data map[string]uint8, s *schema.Schema) error {
-	return populateRowFromMapUnsigned(row, data, s)
+func populateRowFromMapUint8(row codec.Row, data map[string]uint8, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapUnsigned(row, data, s, cfg)
 }
 
-func populateRowFromMapUint16(row codec.Row, data map[string]uint16, s *schema.Schema) error {
-	return populateRowFromMapUnsigned(row, data, s)
+func populateRowFromMapUint16(row codec.Row, data map[string]uint16, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapUnsigned(row, data, s, cfg)
 }
 
-func populateRowFromMapUint32(row codec.Row, data map[string]uint32, s *schema.Schema) error {
-	return populateRowFromMapUnsigned(row, data, s)
+func populateRowFromMapUint32(row codec.Row, data map[string]uint32, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapUnsigned(row, data, s, cfg)
 }
 
-func populateRowFromMapUint64(row codec.Row, data map[string]uint64, s *schema.Schema) error {
-	return populateRowFromMapUnsigned(row, data, s)
+func populateRowFromMapUint64(row codec.Row, data map[string]uint64, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapUnsigned(row, data, s, cfg)
 }
 
-func populateRowFromMapUnsigned[T unsignedInt](row codec.Row, data map[string]T, s *schema.Schema) error {
+func populateRowFromMapUnsigned[T unsignedInt](row codec.Row, data map[string]T, s *schema.Schema, cfg encodeConfig) error {
 	for idx, field := range s.Fields {
 		v, ok := data[field.Name]
 		if !ok {
@@ -364,15 +621,15 @@ func populateRowFromMapUnsigned[T unsignedInt](row codec.Row, data map[string]T,
 	return nil
 }
 
-func populateRowFromMapFloat32(row codec.Row, data map[string]float32, s *schema.Schema) error {
-	return populateRowFromMapFloat(row, data, s)
+func populateRowFromMapFloat32(row codec.Row, data map[string]float32, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapFloat(row, data, s, cfg)
 }
 
-func populateRowFromMapFloat64(row codec.Row, data map[string]float64, s *schema.Schema) error {
-	return populateRowFromMapFloat(row, data, s)
+func populateRowFromMapFloat64(row codec.Row, data map[string]float64, s *schema.Schema, cfg encodeConfig) error {
+	return populateRowFromMapFloat(row, data, s, cfg)
 }
 
-func populateRowFromMapFloat[T floatNumber](row codec.Row, data map[string]T, s *schema.Schema) error {
+func populateRowFromMapFloat[T floatNumber](row codec.Row, data map[string]T, s *schema.Schema, cfg encodeConfig) error {
 	for idx, field := range s.Fields {
 		v, ok := data[field.Name]
 		if !ok {
@@ -389,7 +646,7 @@ func populateRowFromMapFloat[T floatNumber](row codec.Row, data map[string]T, s
 	return nil
 }
 
-func populateRowFromMapString(row codec.Row, data map[string]string, s *schema.Schema) error {
+func populateRowFromMapString(row codec.Row, data map[string]string, s *schema.Schema, cfg encodeConfig) error {
 	for idx, field := range s.Fields {
 		v, ok := data[field.Name]
 		if !ok {
@@ -404,14 +661,14 @@ func populateRowFromMapString(row codec.Row, data map[string]string, s *schema.S
 			row.SetByIndex(idx, val)
 			continue
 		}
-		if err := assignValueToRow(row, idx, kind, reflect.ValueOf(v)); err != nil {
+		if err := assignValueToRow(row, idx, kind, reflect.ValueOf(v), cfg); err != nil {
 			return fmt.Errorf("scrt: field %s: %w", field.Name, err)
 		}
 	}
 	return nil
 }
 
-func populateRowFromMapBytes(row codec.Row, data map[string][]byte, s *schema.Schema) error {
+func populateRowFromMapBytes(row codec.Row, data map[string][]byte, s *schema.Schema, cfg encodeConfig) error {
 	for idx, field := range s.Fields {
 		v, ok := data[field.Name]
 		if !ok {
@@ -429,7 +686,7 @@ func populateRowFromMapBytes(row codec.Row, data map[string][]byte, s *schema.Sc
 	return nil
 }
 
-func populateRowFromMapTime(row codec.Row, data map[string]time.Time, s *schema.Schema) error {
+func populateRowFromMapTime(row codec.Row, data map[string]time.Time, s *schema.Schema, cfg encodeConfig) error {
 	for idx, field := range s.Fields {
 		v, ok := data[field.Name]
 		if !ok {
@@ -439,14 +696,14 @@ func populateRowFromMapTime(row codec.Row, data map[string]time.Time, s *schema.
 		if !isTemporalField(kind) {
 			return fmt.Errorf("scrt: field %s expects temporal kind, got %d", field.Name, kind)
 		}
-		if err := assignValueToRow(row, idx, kind, reflect.ValueOf(v)); err != nil {
+		if err := assignValueToRow(row, idx, kind, reflect.ValueOf(v), cfg); err != nil {
 			return fmt.Errorf("scrt: field %s: %w", field.Name, err)
 		}
 	}
 	return nil
 }
 
-func populateRowFromMapDuration(row codec.Row, data map[string]time.Duration, s *schema.Schema) error {
+func populateRowFromMapDuration(row codec.Row, data map[string]time.Duration, s *schema.Schema, cfg encodeConfig) error {
 	for idx, field := range s.Fields {
 		v, ok := data[field.Name]
 		if !ok {
@@ -455,7 +712,7 @@ func populateRowFromMapDuration(row codec.Row, data map[string]time.Duration, s
 		if field.ValueKind() != schema.KindDuration {
 			return fmt.Errorf("scrt: field %s expects duration kind, got %d", field.Name, field.ValueKind())
 		}
-		if err := assignValueToRow(row, idx, field.ValueKind(), reflect.ValueOf(v)); err != nil {
+		if err := assignValueToRow(row, idx, field.ValueKind(), reflect.ValueOf(v), cfg); err != nil {
 			return fmt.Errorf("scrt: field %s: %w", field.Name, err)
 		}
 	}
@@ -473,6 +730,42 @@ func encodeTemporalInt(kind schema.FieldKind, t time.Time) int64 {
 	}
 }
 
+var (
+	minStoredInstant = time.Unix(0, math.MinInt64)
+	maxStoredInstant = time.Unix(0, math.MaxInt64)
+)
+
+// checkTemporalPrecision reports an error when storing t in field would
+// lose information.
+func checkTemporalPrecision(field schema.Field, t time.Time) error {
+	if t.IsZero() {
+		return nil
+	}
+	if t.Before(minStoredInstant) || t.After(maxStoredInstant) {
+		return fmt.Errorf("scrt: %s is outside the storable range", t.Format(time.RFC3339Nano))
+	}
+	switch field.ValueKind() {
+	case schema.KindDate:
+		if utc := t.UTC(); !utc.Equal(temporal.DecodeDate(temporal.EncodeDate(utc))) {
+			return fmt.Errorf("scrt: %s is not midnight UTC; date fields drop the time of day", t.Format(time.RFC3339Nano))
+		}
+	case schema.KindTimestamp:
+		var precision time.Duration
+		switch field.EpochUnit {
+		case temporal.EpochSeconds:
+			precision = time.Second
+		case temporal.EpochMillis:
+			precision = time.Millisecond
+		case temporal.EpochMicros:
+			precision = time.Microsecond
+		}
+		if precision > 0 && time.Duration(t.Nanosecond())%precision != 0 {
+			return fmt.Errorf("scrt: %s is finer than %s precision", t.Format(time.RFC3339Nano), field.RawType)
+		}
+	}
+	return nil
+}
+
 func isTemporalField(kind schema.FieldKind) bool {
 	switch kind {
 	case schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindTimestampTZ:
@@ -549,7 +842,7 @@ func nestedMapValue(inner reflect.Value, fieldName string) (reflect.Value, bool)
 	return reflect.Value{}, false
 }
 
-func assignValueToRow(row codec.Row, idx int, kind schema.FieldKind, v reflect.Value) error {
+func assignValueToRow(row codec.Row, idx int, kind schema.FieldKind, v reflect.Value, cfg encodeConfig) error {
 	v = indirect(v)
 	if !v.IsValid() {
 		return nil
@@ -588,19 +881,30 @@ func assignValueToRow(row codec.Row, idx int, kind schema.FieldKind, v reflect.V
 		}
 		val.Str = s
 	case schema.KindBytes:
-		b, err := valueAsBytes(v)
+		var b []byte
+		var err error
+		if field := row.Schema().Fields[idx]; field.Codec != "" {
+			b, err = encodeWithCodec(field, v.Interface())
+		} else {
+			b, err = valueAsBytes(v)
+		}
 		if err != nil {
 			return err
 		}
 		val.Bytes = b
 	case schema.KindDate, schema.KindDateTime, schema.KindTimestamp:
-		t, err := valueAsTime(v, kind)
+		t, err := valueAsTime(v, kind, row.Schema().Fields[idx].EpochUnit)
 		if err != nil {
 			return err
 		}
+		if cfg.strictTemporal {
+			if err := checkTemporalPrecision(row.Schema().Fields[idx], t); err != nil {
+				return err
+			}
+		}
 		val.Int = encodeTemporalInt(kind, t)
 	case schema.KindTimestampTZ:
-		t, err := valueAsTime(v, kind)
+		t, err := valueAsTime(v, kind, row.Schema().Fields[idx].EpochUnit)
 		if err != nil {
 			return err
 		}
@@ -611,6 +915,25 @@ func assignValueToRow(row codec.Row, idx int, kind schema.FieldKind, v reflect.V
 			return err
 		}
 		val.Int = int64(d)
+	case schema.KindTime:
+		d, err := valueAsTimeOfDay(v)
+		if err != nil {
+			return err
+		}
+		val.Int = int64(d)
+	case schema.KindUUID:
+		id, err := valueAsUUID(v)
+		if err != nil {
+			return err
+		}
+		val.Bytes = id
+	case schema.KindList:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if err := valueAsList(v, row.Schema().Fields[idx].ElemKind, &val); err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("scrt: unsupported field kind %d", kind)
 	}
@@ -618,7 +941,7 @@ func assignValueToRow(row codec.Row, idx int, kind schema.FieldKind, v reflect.V
 	return nil
 }
 
-func assignAnyToRow(row codec.Row, idx int, kind schema.FieldKind, src any) error {
+func assignAnyToRow(row codec.Row, idx int, kind schema.FieldKind, src any, cfg encodeConfig) error {
 	if src == nil {
 		return nil
 	}
@@ -656,19 +979,30 @@ func assignAnyToRow(row codec.Row, idx int, kind schema.FieldKind, src any) erro
 		}
 		val.Str = s
 	case schema.KindBytes:
-		b, err := anyAsBytes(src)
+		var b []byte
+		var err error
+		if field := row.Schema().Fields[idx]; field.Codec != "" {
+			b, err = encodeWithCodec(field, src)
+		} else {
+			b, err = anyAsBytes(src)
+		}
 		if err != nil {
 			return err
 		}
 		val.Bytes = b
 	case schema.KindDate, schema.KindDateTime, schema.KindTimestamp:
-		t, err := anyAsTime(kind, src)
+		t, err := anyAsTime(kind, row.Schema().Fields[idx].EpochUnit, src)
 		if err != nil {
 			return err
 		}
+		if cfg.strictTemporal {
+			if err := checkTemporalPrecision(row.Schema().Fields[idx], t); err != nil {
+				return err
+			}
+		}
 		val.Int = encodeTemporalInt(kind, t)
 	case schema.KindTimestampTZ:
-		t, err := anyAsTime(kind, src)
+		t, err := anyAsTime(kind, row.Schema().Fields[idx].EpochUnit, src)
 		if err != nil {
 			return err
 		}
@@ -679,6 +1013,25 @@ func assignAnyToRow(row codec.Row, idx int, kind schema.FieldKind, src any) erro
 			return err
 		}
 		val.Int = int64(d)
+	case schema.KindTime:
+		d, err := anyAsTimeOfDay(src)
+		if err != nil {
+			return err
+		}
+		val.Int = int64(d)
+	case schema.KindUUID:
+		id, err := anyAsUUID(src)
+		if err != nil {
+			return err
+		}
+		val.Bytes = id
+	case schema.KindList:
+		if rv := reflect.ValueOf(src); rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		if err := anyAsList(src, row.Schema().Fields[idx].ElemKind, &val); err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("scrt: unsupported field kind %d", kind)
 	}
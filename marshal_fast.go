@@ -31,13 +31,20 @@ func fastEncoderForStruct(t reflect.Type, s *schema.Schema) *fastStructEncoder {
 }
 
 func buildFastStructEncoder(t reflect.Type, s *schema.Schema) *fastStructEncoder {
-	bindings := structBindingsForSchema(t, s)
+	bindings, err := structBindingsForSchema(t, s)
+	if err != nil {
+		// The reflective path reports the binding error.
+		return nil
+	}
 	setters := make([]fieldSetter, len(s.Fields))
 	for idx, binding := range bindings {
-		if len(binding.index) == 0 {
+		if len(binding.index) == 0 || binding.viaPointer || binding.omitEmpty {
 			return nil
 		}
 		field := t.FieldByIndex(binding.index)
+		// Promoted fields report offsets relative to their embedding struct,
+		// so accumulate the offsets of every struct along the path.
+		field.Offset = fieldOffset(t, binding.index)
 		setter, ok := makeFieldSetter(idx, field, s.Fields[idx])
 		if !ok {
 			return nil
@@ -47,7 +54,20 @@ func buildFastStructEncoder(t reflect.Type, s *schema.Schema) *fastStructEncoder
 	return &fastStructEncoder{setters: setters}
 }
 
+func fieldOffset(t reflect.Type, index []int) uintptr {
+	var offset uintptr
+	for _, i := range index {
+		field := t.Field(i)
+		offset += field.Offset
+		t = field.Type
+	}
+	return offset
+}
+
 func makeFieldSetter(idx int, field reflect.StructField, schemaField schema.Field) (fieldSetter, bool) {
+	if schemaField.Codec != "" {
+		return nil, false
+	}
 	offset := field.Offset
 	kind := schemaField.ValueKind()
 	switch kind {
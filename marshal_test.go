@@ -1,15 +1,27 @@
 package scrt_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/codec"
 	"github.com/oarkflow/scrt/schema"
 	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
 )
 
 func TestMarshalFilesRoundTrip(t *testing.T) {
@@ -165,3 +177,2451 @@ func TestTemporalStringMapRoundTrip(t *testing.T) {
 		t.Fatalf("stamp mismatch: got %s want %s", gotStamp, expectedStamp)
 	}
 }
+
+func TestTimestampTZEdgeValues(t *testing.T) {
+	src := `@schema Archive
+@field Stamp timestamptz
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, ok := doc.Schema("Archive")
+	if !ok {
+		t.Fatalf("Archive schema missing")
+	}
+	type Archive struct {
+		Stamp time.Time
+	}
+	landing := time.Date(1969, time.July, 20, 20, 17, 40, 500, time.FixedZone("-0500", -5*3600))
+	input := []Archive{
+		{Stamp: landing},
+		{},
+	}
+	payload, err := scrt.Marshal(sch, input)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded []Archive
+	if err := scrt.Unmarshal(payload, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(decoded) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(decoded))
+	}
+	if decoded[0].Stamp.Format(time.RFC3339Nano) != landing.Format(time.RFC3339Nano) {
+		t.Fatalf("pre-1970 mismatch: got %s want %s", decoded[0].Stamp.Format(time.RFC3339Nano), landing.Format(time.RFC3339Nano))
+	}
+	if !decoded[1].Stamp.IsZero() {
+		t.Fatalf("expected zero time, got %s", decoded[1].Stamp)
+	}
+
+	var anyOut []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &anyOut); err != nil {
+		t.Fatalf("unmarshal map:any: %v", err)
+	}
+	if ts, ok := anyOut[1]["Stamp"].(time.Time); !ok || !ts.IsZero() {
+		t.Fatalf("expected zero time.Time in map, got %#v", anyOut[1]["Stamp"])
+	}
+
+	var strOut []map[string]string
+	if err := scrt.Unmarshal(payload, sch, &strOut); err != nil {
+		t.Fatalf("unmarshal string map: %v", err)
+	}
+	again, err := scrt.Marshal(sch, strOut)
+	if err != nil {
+		t.Fatalf("re-marshal string map: %v", err)
+	}
+	var roundTrip []Archive
+	if err := scrt.Unmarshal(again, sch, &roundTrip); err != nil {
+		t.Fatalf("unmarshal re-marshaled: %v", err)
+	}
+	if !roundTrip[0].Stamp.Equal(landing) || !roundTrip[1].Stamp.IsZero() {
+		t.Fatalf("string map roundtrip mismatch: %+v", roundTrip)
+	}
+}
+
+func TestTimestampTZNegativeEpoch(t *testing.T) {
+	src := `@schema Archive
+@field Stamp timestamptz
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Archive")
+	input := []map[string]any{{"Stamp": "-14182940.25"}}
+	payload, err := scrt.Marshal(sch, input)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := time.Unix(-14182940, -250000000)
+	if got, ok := out[0]["Stamp"].(time.Time); !ok || !got.Equal(want) {
+		t.Fatalf("negative epoch mismatch: got %v want %s", out[0]["Stamp"], want)
+	}
+}
+
+func TestRowToStruct(t *testing.T) {
+	src := `@schema Account
+@field ID uint64
+@field Name string
+@field Active bool
+@field Opened date
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, ok := doc.Schema("Account")
+	if !ok {
+		t.Fatalf("Account schema missing")
+	}
+	row := codec.NewRow(sch)
+	if err := row.SetUint("ID", 7); err != nil {
+		t.Fatalf("SetUint: %v", err)
+	}
+	if err := row.SetString("Name", "ada"); err != nil {
+		t.Fatalf("SetString: %v", err)
+	}
+	if err := row.SetBool("Active", true); err != nil {
+		t.Fatalf("SetBool: %v", err)
+	}
+	opened := time.Date(2024, time.March, 9, 0, 0, 0, 0, time.UTC)
+	if err := row.SetInt("Opened", temporal.EncodeDate(opened)); err != nil {
+		t.Fatalf("SetInt: %v", err)
+	}
+
+	type Account struct {
+		ID     uint64
+		Name   string `scrt:"Name"`
+		Active bool
+		Opened time.Time
+		Extra  string
+	}
+	var out Account
+	if err := scrt.RowToStruct(row, sch, &out); err != nil {
+		t.Fatalf("RowToStruct: %v", err)
+	}
+	if out.ID != 7 || out.Name != "ada" || !out.Active || !out.Opened.Equal(opened) || out.Extra != "" {
+		t.Fatalf("unexpected struct: %+v", out)
+	}
+
+	if err := scrt.RowToStruct(row, sch, out); err == nil {
+		t.Fatalf("expected error for non-pointer output")
+	}
+	var m map[string]any
+	if err := scrt.RowToStruct(row, sch, &m); err == nil {
+		t.Fatalf("expected error for map output")
+	}
+	again, _ := schema.Parse(strings.NewReader(src))
+	reparsed, _ := again.Schema("Account")
+	out = Account{}
+	if err := scrt.RowToStruct(row, reparsed, &out); err != nil || out.ID != 7 {
+		t.Fatalf("an equal schema parsed again should bind: %v %+v", err, out)
+	}
+	other, _ := schema.Parse(strings.NewReader(strings.Replace(src, "@field Active bool", "@field Active string", 1)))
+	otherSchema, _ := other.Schema("Account")
+	if err := scrt.RowToStruct(row, otherSchema, &out); !errors.Is(err, scrt.ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch for a different schema, got %v", err)
+	}
+}
+
+type Timestamps struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time `scrt:"Modified"`
+}
+
+type auditTrail struct {
+	Actor string
+}
+
+type Revision struct {
+	Number uint64
+}
+
+func TestMarshalEmbeddedStructs(t *testing.T) {
+	src := `@schema Post
+@field ID uint64
+@field Title string
+@field CreatedAt timestamp
+@field Modified timestamp
+@field Actor string
+@field Number uint64
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, ok := doc.Schema("Post")
+	if !ok {
+		t.Fatalf("Post schema missing")
+	}
+	type Post struct {
+		ID uint64
+		Timestamps
+		auditTrail
+		*Revision
+		Title string
+	}
+	created := time.Date(2025, time.March, 1, 9, 0, 0, 0, time.UTC)
+	modified := created.Add(90 * time.Minute)
+	input := []Post{
+		{
+			ID:         1,
+			Timestamps: Timestamps{CreatedAt: created, UpdatedAt: modified},
+			auditTrail: auditTrail{Actor: "ops"},
+			Revision:   &Revision{Number: 3},
+			Title:      "first",
+		},
+		{ID: 2, Title: "no revision"},
+	}
+	payload, err := scrt.Marshal(sch, input)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var maps []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &maps); err != nil {
+		t.Fatalf("unmarshal maps: %v", err)
+	}
+	if got, ok := maps[0]["Modified"].(time.Time); !ok || !got.Equal(modified) {
+		t.Fatalf("tag override on embedded field not applied: %+v", maps[0])
+	}
+	if maps[0]["Actor"] != "ops" || maps[0]["Number"] != uint64(3) {
+		t.Fatalf("promoted fields missing: %+v", maps[0])
+	}
+	if _, ok := maps[1]["Number"]; ok {
+		t.Fatalf("nil embedded pointer should leave Number unset: %+v", maps[1])
+	}
+
+	var decoded []Post
+	if err := scrt.Unmarshal(payload, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal structs: %v", err)
+	}
+	if len(decoded) != 2 {
+		t.Fatalf("expected 2 posts, got %d", len(decoded))
+	}
+	first := decoded[0]
+	if !first.CreatedAt.Equal(created) || !first.UpdatedAt.Equal(modified) || first.Actor != "ops" || first.Title != "first" {
+		t.Fatalf("unexpected first post: %+v", first)
+	}
+	if first.Revision == nil || first.Revision.Number != 3 {
+		t.Fatalf("embedded pointer not populated: %+v", first.Revision)
+	}
+	if decoded[1].Revision != nil {
+		t.Fatalf("expected nil Revision for row without Number, got %+v", decoded[1].Revision)
+	}
+}
+
+func TestMarshalEmbeddedShallowFieldWins(t *testing.T) {
+	src := `@schema Named
+@field Name string
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Named")
+	type Inner struct {
+		Name string
+	}
+	type Outer struct {
+		Inner
+		Name string
+	}
+	payload, err := scrt.Marshal(sch, []Outer{{Inner: Inner{Name: "deep"}, Name: "shallow"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if out[0]["Name"] != "shallow" {
+		t.Fatalf("expected shallow field to win, got %v", out[0]["Name"])
+	}
+}
+
+func TestMarshalEmbeddedFastPathOffsets(t *testing.T) {
+	src := `@schema Counter
+@field ID uint64
+@field Count uint64
+@field Label string
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Counter")
+	type Base struct {
+		Pad   bool
+		Count uint64
+		Label string
+	}
+	type Counter struct {
+		ID uint64
+		Base
+	}
+	input := []Counter{{ID: 1, Base: Base{Count: 10, Label: "a"}}, {ID: 2, Base: Base{Count: 20, Label: "b"}}}
+	payload, err := scrt.Marshal(sch, input)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out []Counter
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for i := range input {
+		if out[i].ID != input[i].ID || out[i].Count != input[i].Count || out[i].Label != input[i].Label {
+			t.Fatalf("row %d mismatch: got %+v want %+v", i, out[i], input[i])
+		}
+	}
+}
+
+func TestMarshalOmitEmptyTag(t *testing.T) {
+	src := `@schema Contact
+@field ID uint64
+@field Nickname string default="anon"
+@field Phone string
+@field Score int64
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Contact")
+	type Contact struct {
+		ID       uint64
+		Nickname string `scrt:",omitempty"`
+		Phone    string `scrt:"Phone,omitempty"`
+		Score    int64  `scrt:"Score"`
+	}
+	input := []Contact{
+		{ID: 1, Nickname: "", Phone: "", Score: 0},
+		{ID: 2, Nickname: "zed", Phone: "555-0100", Score: 9},
+	}
+	payload, err := scrt.Marshal(sch, input)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if out[0]["Nickname"] != "anon" {
+		t.Fatalf("empty omitempty field should fall back to default, got %v", out[0]["Nickname"])
+	}
+	if _, ok := out[0]["Phone"]; ok {
+		t.Fatalf("empty omitempty field should be absent, got %v", out[0]["Phone"])
+	}
+	if out[0]["Score"] != int64(0) {
+		t.Fatalf("rename-only tag must still write zero values, got %v", out[0]["Score"])
+	}
+	if out[1]["Nickname"] != "zed" || out[1]["Phone"] != "555-0100" || out[1]["Score"] != int64(9) {
+		t.Fatalf("set fields not written: %+v", out[1])
+	}
+}
+
+type columnName string
+
+type columnRef struct{ name string }
+
+func (c columnRef) String() string { return c.name }
+
+func TestMarshalNamedStringMapKeys(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema User\n@field ID uint64\n@field Name string\n", "User")
+
+	payload, err := scrt.Marshal(sch, []map[columnName]any{{"ID": uint64(7), "Name": "Ada"}})
+	if err != nil {
+		t.Fatalf("Marshal named keys: %v", err)
+	}
+	var out []map[columnName]any
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil {
+		t.Fatalf("Unmarshal named keys: %v", err)
+	}
+	if len(out) != 1 || out[0]["ID"] != uint64(7) || out[0]["Name"] != "Ada" {
+		t.Fatalf("unexpected named-key roundtrip: %v", out)
+	}
+
+	payload, err = scrt.Marshal(sch, map[columnRef]any{{"ID"}: uint64(8), {"Name"}: "Grace"})
+	if err != nil {
+		t.Fatalf("Marshal stringer keys: %v", err)
+	}
+	var users []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &users); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(users) != 1 || users[0]["ID"] != uint64(8) || users[0]["Name"] != "Grace" {
+		t.Fatalf("unexpected stringer-key roundtrip: %v", users)
+	}
+
+	if _, err := scrt.Marshal(sch, map[int]any{1: "x"}); err == nil {
+		t.Fatalf("expected error for int map keys")
+	}
+}
+
+func TestUnmarshalColumnsProjection(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Msg\n@field ID uint64\n@field Lang string default=\"en\" encoding=global\n@field Text string encoding=global\n@field Seen bool\n", "Msg")
+	rows := make([]map[string]any, 5)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i + 1), "Lang": "de", "Text": fmt.Sprintf("msg-%d", i), "Seen": i%2 == 0}
+	}
+	payload, err := scrt.Marshal(sch, rows, scrt.WithRowsPerPage(2))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var maps []map[string]any
+	if err := scrt.UnmarshalColumns(payload, sch, &maps, "ID", "Text"); err != nil {
+		t.Fatalf("UnmarshalColumns: %v", err)
+	}
+	if len(maps) != len(rows) {
+		t.Fatalf("expected %d rows, got %d", len(rows), len(maps))
+	}
+	for i, m := range maps {
+		if len(m) != 2 || m["ID"] != uint64(i+1) || m["Text"] != fmt.Sprintf("msg-%d", i) {
+			t.Fatalf("row %d: unexpected projection %v", i, m)
+		}
+	}
+
+	var named []map[columnName]any
+	if err := scrt.UnmarshalColumns(payload, sch, &named, "ID"); err != nil {
+		t.Fatalf("UnmarshalColumns named keys: %v", err)
+	}
+	if len(named) != len(rows) || len(named[0]) != 1 || named[0]["ID"] != uint64(1) {
+		t.Fatalf("unexpected named-key projection %v", named)
+	}
+
+	type msg struct {
+		ID   uint64
+		Lang string
+		Seen bool
+	}
+	out := []msg{}
+	if err := scrt.UnmarshalColumns(payload, sch, &out, "Seen"); err != nil {
+		t.Fatalf("UnmarshalColumns struct: %v", err)
+	}
+	for i, m := range out {
+		if m.ID != 0 || m.Lang != "" || m.Seen != (i%2 == 0) {
+			t.Fatalf("row %d: unexpected struct projection %+v", i, m)
+		}
+	}
+}
+
+// countdownCtx reports cancellation once Err has been called more than limit times.
+type countdownCtx struct {
+	context.Context
+	limit int
+	calls int
+}
+
+func (c *countdownCtx) Err() error {
+	c.calls++
+	if c.calls > c.limit {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestMarshalUnmarshalContextCancel(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Msg\n@field ID uint64\n@field Text string\n", "Msg")
+	rows := make([]map[string]any, 20)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i + 1), "Text": "hello"}
+	}
+
+	ctx := &countdownCtx{Context: context.Background(), limit: 3}
+	if _, err := scrt.MarshalContext(ctx, sch, rows, scrt.WithRowsPerPage(4)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("MarshalContext: expected context.Canceled, got %v", err)
+	}
+	if ctx.calls != 4 {
+		t.Fatalf("MarshalContext: expected one check per page (4), got %d", ctx.calls)
+	}
+
+	payload, err := scrt.Marshal(sch, rows, scrt.WithRowsPerPage(4))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var out []map[string]any
+	ctx = &countdownCtx{Context: context.Background(), limit: 3}
+	if err := scrt.UnmarshalContext(ctx, payload, sch, &out); !errors.Is(err, context.Canceled) {
+		t.Fatalf("UnmarshalContext: expected context.Canceled, got %v", err)
+	}
+	// One check on entry, then one per page: the third check admits page two.
+	if len(out) != 8 {
+		t.Fatalf("UnmarshalContext: expected decoding to stop after 2 pages (8 rows), got %d", len(out))
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := scrt.UnmarshalContext(cancelled, payload, sch, &out); !errors.Is(err, context.Canceled) {
+		t.Fatalf("UnmarshalContext: expected context.Canceled, got %v", err)
+	}
+	out = nil
+	if err := scrt.UnmarshalContext(context.Background(), payload, sch, &out); err != nil {
+		t.Fatalf("UnmarshalContext: %v", err)
+	}
+	if len(out) != len(rows) {
+		t.Fatalf("UnmarshalContext: expected %d rows, got %d", len(rows), len(out))
+	}
+}
+
+func TestUnmarshalTemporalIntoMapAny(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field Day date\n@field At datetime\n@field Seen timestamp\n@field Logged timestamptz\n@field Window duration\n", "Event")
+	day := time.Date(2025, time.March, 4, 0, 0, 0, 0, time.UTC)
+	at := time.Date(2025, time.March, 4, 8, 15, 0, 0, time.UTC)
+	seen := time.Date(2025, time.March, 4, 9, 30, 0, 123000000, time.UTC)
+	logged := time.Date(2025, time.March, 4, 12, 0, 0, 0, time.FixedZone("+0200", 7200))
+	window := 90 * time.Minute
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"Day": day, "At": at, "Seen": seen, "Logged": logged, "Window": window},
+		{"Day": day.AddDate(0, 0, 1), "At": at.Add(time.Hour), "Seen": seen.Add(time.Second), "Logged": logged.Add(time.Minute), "Window": 2 * window},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var out []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(out))
+	}
+	for i, row := range out {
+		if len(row) != len(sch.Fields) {
+			t.Fatalf("row %d: expected %d fields, got %v", i, len(sch.Fields), row)
+		}
+		for _, name := range []string{"Day", "At", "Seen", "Logged"} {
+			if _, ok := row[name].(time.Time); !ok {
+				t.Fatalf("row %d: %s decoded as %T, want time.Time", i, name, row[name])
+			}
+		}
+		if _, ok := row["Window"].(time.Duration); !ok {
+			t.Fatalf("row %d: Window decoded as %T, want time.Duration", i, row["Window"])
+		}
+	}
+	first := out[0]
+	if !first["Day"].(time.Time).Equal(day) || !first["At"].(time.Time).Equal(at) || !first["Seen"].(time.Time).Equal(seen) {
+		t.Fatalf("unexpected instants: %v", first)
+	}
+	if !first["Logged"].(time.Time).Equal(logged) || first["Window"] != window {
+		t.Fatalf("unexpected Logged/Window: %v", first)
+	}
+}
+
+func TestUnmarshalStrictTypes(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Item\n@field Name string\n@field Count uint64\n", "Item")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"Name": "widget", "Count": uint64(300)}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	type drifted struct {
+		Name  int
+		Count uint64
+	}
+	var strictOut []drifted
+	err = scrt.UnmarshalWithOptions(payload, sch, &strictOut, scrt.WithStrictTypes())
+	if err == nil || !strings.Contains(err.Error(), "field Name") || !strings.Contains(err.Error(), "string") || !strings.Contains(err.Error(), "int") {
+		t.Fatalf("strict: expected error naming field and types, got %v", err)
+	}
+
+	// Without the option, values that Go can convert are stored lossily.
+	type narrow struct {
+		Name  string
+		Count int8
+	}
+	var loose []narrow
+	if err := scrt.Unmarshal(payload, sch, &loose); err != nil {
+		t.Fatalf("non-strict: %v", err)
+	}
+	if len(loose) != 1 || loose[0].Name != "widget" || loose[0].Count != int8(300-256) {
+		t.Fatalf("non-strict: unexpected result %+v", loose)
+	}
+	var strictNarrow []narrow
+	err = scrt.UnmarshalWithOptions(payload, sch, &strictNarrow, scrt.WithStrictTypes())
+	if err == nil || !strings.Contains(err.Error(), "field Count") || !strings.Contains(err.Error(), "uint64") || !strings.Contains(err.Error(), "int8") {
+		t.Fatalf("strict: expected overflow error for Count, got %v", err)
+	}
+
+	// Narrowing is judged by type: a uint32 cannot hold every uint64, so
+	// it is refused even though 300 fits.
+	type unsigned struct {
+		Name  string
+		Count uint32
+	}
+	var strictUnsigned []unsigned
+	err = scrt.UnmarshalWithOptions(payload, sch, &strictUnsigned, scrt.WithStrictTypes())
+	if err == nil || !strings.Contains(err.Error(), "field Count") || !strings.Contains(err.Error(), "uint32") {
+		t.Fatalf("strict: expected narrowing error for uint32 Count, got %v", err)
+	}
+	type signed struct {
+		Name  string
+		Count int
+	}
+	var strictSigned []signed
+	if err := scrt.UnmarshalWithOptions(payload, sch, &strictSigned, scrt.WithStrictTypes()); err == nil {
+		t.Fatalf("strict: expected a uint64 Count to be refused by an int field")
+	}
+
+	type exact struct {
+		Name  string
+		Count *uint
+	}
+	var ok []exact
+	if err := scrt.UnmarshalWithOptions(payload, sch, &ok, scrt.WithStrictTypes()); err != nil {
+		t.Fatalf("strict exact: %v", err)
+	}
+	if len(ok) != 1 || ok[0].Count == nil || *ok[0].Count != 300 {
+		t.Fatalf("strict exact: unexpected result %+v", ok)
+	}
+}
+
+func TestMarshalListFieldsRoundTrip(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Post\n@field ID uint64\n@field Tags list<string>\n@field Refs list<uint64>\n", "Post")
+	type post struct {
+		ID   uint64
+		Tags []string
+		Refs []uint64
+	}
+	in := []post{
+		{ID: 1, Tags: []string{"go", "db"}, Refs: []uint64{7, 8, 9}},
+		{ID: 2, Tags: []string{}, Refs: nil},
+		{ID: 3, Tags: nil, Refs: []uint64{}},
+		{ID: 4, Tags: []string{"go", "x"}, Refs: []uint64{1}},
+		{ID: 5, Tags: []string{"last"}, Refs: []uint64{2, 3}},
+	}
+	// Two rows per page so decoded strings must survive later pages.
+	payload, err := scrt.Marshal(sch, in, scrt.WithRowsPerPage(2))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out []post
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("struct round-trip mismatch:\n got %#v\nwant %#v", out, in)
+	}
+	if out[1].Tags == nil || out[1].Refs != nil || out[2].Tags != nil || out[2].Refs == nil {
+		t.Fatalf("nil and empty lists were not kept distinct: %#v", out[1:3])
+	}
+
+	var maps []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &maps); err != nil {
+		t.Fatalf("unmarshal maps: %v", err)
+	}
+	if got := maps[0]["Tags"]; !reflect.DeepEqual(got, []string{"go", "db"}) {
+		t.Fatalf("map Tags: got %#v", got)
+	}
+	if _, ok := maps[1]["Refs"]; ok {
+		t.Fatalf("nil list should be absent from map, got %#v", maps[1])
+	}
+	if got := maps[2]["Refs"]; !reflect.DeepEqual(got, []uint64{}) {
+		t.Fatalf("map Refs: got %#v", got)
+	}
+
+	again, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(9), "Tags": []any{"a", "b"}, "Refs": []int{4}}})
+	if err != nil {
+		t.Fatalf("marshal maps: %v", err)
+	}
+	var back []post
+	if err := scrt.Unmarshal(again, sch, &back); err != nil {
+		t.Fatalf("unmarshal maps payload: %v", err)
+	}
+	if len(back) != 1 || !reflect.DeepEqual(back[0].Tags, []string{"a", "b"}) || !reflect.DeepEqual(back[0].Refs, []uint64{4}) {
+		t.Fatalf("map source round-trip: %#v", back)
+	}
+}
+
+func TestStructBindingAliasesAndCaseFolding(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Message\n@field msg_id uint64\n@field user_name string\n@field body string alias=Text\n", "Message")
+	type message struct {
+		MsgID    uint64
+		UserName string
+		Text     string
+	}
+	in := []message{{MsgID: 7, UserName: "ann", Text: "hi"}}
+	payload, err := scrt.Marshal(sch, in)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out []message
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("snake_case schema did not bind: got %+v", out)
+	}
+
+	// Exact names beat aliases, and aliases beat case-insensitive matches.
+	type precedence struct {
+		MsgID    uint64
+		Msg_id   uint64 `scrt:"msg_id"`
+		UserName string
+		Body     string
+		Text     string
+	}
+	var prec []precedence
+	if err := scrt.Unmarshal(payload, sch, &prec); err != nil {
+		t.Fatalf("unmarshal precedence: %v", err)
+	}
+	if got := prec[0]; got.Msg_id != 7 || got.MsgID != 0 || got.Text != "hi" || got.Body != "" {
+		t.Fatalf("unexpected precedence result %+v", got)
+	}
+
+	type ambiguous struct {
+		MsgID    uint64
+		MsgId    uint64
+		UserName string
+	}
+	var amb []ambiguous
+	if err := scrt.Unmarshal(payload, sch, &amb); err == nil || !strings.Contains(err.Error(), "msg_id") {
+		t.Fatalf("expected ambiguity error, got %v", err)
+	}
+	if _, err := scrt.Marshal(sch, []ambiguous{{MsgID: 1}}); err == nil {
+		t.Fatalf("expected ambiguity error from marshal")
+	}
+}
+
+func TestMergeKeepsLastRowPerKey(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Item\n@field ID uint64\n@field Label string\n", "Item")
+	type item struct {
+		ID    uint64
+		Label string
+	}
+	older, err := scrt.Marshal(sch, []item{{1, "a"}, {2, "b"}, {3, "c"}}, scrt.WithRowsPerPage(2))
+	if err != nil {
+		t.Fatalf("marshal older: %v", err)
+	}
+	newer, err := scrt.Marshal(sch, []item{{4, "d"}, {2, "b2"}, {5, "e"}, {4, "d2"}})
+	if err != nil {
+		t.Fatalf("marshal newer: %v", err)
+	}
+	merged, err := scrt.Merge(sch, "ID", older, nil, newer)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	var out []item
+	if err := scrt.Unmarshal(merged, sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := []item{{1, "a"}, {3, "c"}, {2, "b2"}, {5, "e"}, {4, "d2"}}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("unexpected merge result:\n got %+v\nwant %+v", out, want)
+	}
+
+	disjoint, err := scrt.Merge(sch, "ID", older, mustMarshal(t, sch, []item{{7, "g"}}))
+	if err != nil {
+		t.Fatalf("merge disjoint: %v", err)
+	}
+	out = nil
+	if err := scrt.Unmarshal(disjoint, sch, &out); err != nil {
+		t.Fatalf("unmarshal disjoint: %v", err)
+	}
+	if want := []item{{1, "a"}, {2, "b"}, {3, "c"}, {7, "g"}}; !reflect.DeepEqual(out, want) {
+		t.Fatalf("unexpected disjoint merge:\n got %+v\nwant %+v", out, want)
+	}
+
+	// String keys must survive the reader moving on to later pages.
+	labelled, err := scrt.Marshal(sch, []item{{1, "a"}, {2, "b"}, {3, "a"}, {4, "c"}}, scrt.WithRowsPerPage(1))
+	if err != nil {
+		t.Fatalf("marshal labelled: %v", err)
+	}
+	byLabel, err := scrt.Merge(sch, "Label", labelled)
+	if err != nil {
+		t.Fatalf("merge by label: %v", err)
+	}
+	out = nil
+	if err := scrt.Unmarshal(byLabel, sch, &out); err != nil {
+		t.Fatalf("unmarshal by label: %v", err)
+	}
+	if want := []item{{2, "b"}, {3, "a"}, {4, "c"}}; !reflect.DeepEqual(out, want) {
+		t.Fatalf("unexpected merge by label:\n got %+v\nwant %+v", out, want)
+	}
+
+	if _, err := scrt.Merge(sch, "Missing", older); err == nil {
+		t.Fatalf("expected error for unknown key field")
+	}
+	listSch := parseSingleSchema(t, "@schema Tagged\n@field ID uint64\n@field Tags list<string>\n", "Tagged")
+	if _, err := scrt.Merge(listSch, "Tags"); err == nil {
+		t.Fatalf("expected error for ineligible key field")
+	}
+	unkeyed, err := scrt.Marshal(sch, []map[string]any{{"Label": "x"}})
+	if err != nil {
+		t.Fatalf("marshal unkeyed: %v", err)
+	}
+	if _, err := scrt.Merge(sch, "ID", unkeyed); err == nil {
+		t.Fatalf("expected error for row without key")
+	}
+}
+
+func TestMarshalDefaultFunctions(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field ID uint64\n@field Stamp timestamp default=now()\n@field Ref string default=uuid()\n", "Event")
+	before := time.Now().UTC()
+	payload := mustMarshal(t, sch, []map[string]any{{"ID": uint64(1)}, {"ID": uint64(2)}, {"ID": uint64(3), "Ref": "kept"}})
+	after := time.Now().UTC()
+
+	var rows []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &rows); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	for _, row := range rows {
+		stamp, ok := row["Stamp"].(time.Time)
+		if !ok {
+			t.Fatalf("row %v: Stamp = %#v, want a time", row["ID"], row["Stamp"])
+		}
+		if stamp.Location() != time.UTC || stamp.Before(before.Truncate(time.Microsecond)) || stamp.After(after) {
+			t.Fatalf("row %v: Stamp %v outside [%v, %v] or not UTC", row["ID"], stamp, before, after)
+		}
+	}
+	first, second := rows[0]["Ref"].(string), rows[1]["Ref"].(string)
+	if _, err := uuid.Parse(first); err != nil {
+		t.Fatalf("Ref %q is not a UUID: %v", first, err)
+	}
+	if first == second {
+		t.Fatalf("uuid() repeated %q across rows", first)
+	}
+	if rows[2]["Ref"] != "kept" {
+		t.Fatalf("explicit Ref overwritten: %v", rows[2]["Ref"])
+	}
+
+	// Values are stored, so decoding again returns the same ones.
+	var again []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &again); err != nil {
+		t.Fatalf("unmarshal again: %v", err)
+	}
+	if again[0]["Ref"] != first || !again[0]["Stamp"].(time.Time).Equal(rows[0]["Stamp"].(time.Time)) {
+		t.Fatalf("default functions re-evaluated on decode")
+	}
+}
+
+func TestMigrateKeepsDefaultFunctionsUnset(t *testing.T) {
+	old := parseSingleSchema(t, "@schema Event\n@field ID uint64\n", "Event")
+	next := parseSingleSchema(t, "@schema Event\n@field ID uint64\n@field Stamp timestamp default=now()\n", "Event")
+	payload := mustMarshal(t, old, []map[string]any{{"ID": uint64(1)}})
+
+	// Re-encoding stored rows must not stamp them with the time of the rewrite.
+	migrated, err := scrt.MigrateRename(old, next, nil, payload)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var rows []map[string]any
+	if err := scrt.Unmarshal(migrated, next, &rows); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	if stamp, ok := rows[0]["Stamp"]; ok {
+		t.Fatalf("migrated row took Stamp %v", stamp)
+	}
+}
+
+func TestUnmarshalFromFileGzip(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Hit\n@field ID uint64\n@field Path string\n", "Hit")
+	input := []map[string]any{{"ID": uint64(1), "Path": "/"}, {"ID": uint64(2), "Path": "/about"}}
+	payload := mustMarshal(t, sch, input)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(payload)
+	zw.Close()
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"hits.scrt.gz": buf.Bytes(), "plain.scrt.gz": payload, "packed.bin": buf.Bytes()} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		var rows []map[string]any
+		if err := scrt.UnmarshalFromFile(path, sch, &rows); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(rows) != 2 || rows[1]["Path"] != "/about" {
+			t.Fatalf("%s: unexpected rows %v", name, rows)
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, sch *schema.Schema, input any) []byte {
+	t.Helper()
+	payload, err := scrt.Marshal(sch, input)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return payload
+}
+
+func TestFilterColumns(t *testing.T) {
+	messages := generateMessages(3000)
+	for i := range messages {
+		messages[i].Lang = []string{"en", "de", "fr"}[i%3]
+	}
+	payload, err := scrt.Marshal(benchSchema, messages, scrt.WithRowsPerPage(256))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded []BenchMessage
+	if err := scrt.Unmarshal(payload, benchSchema, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	expect := func(pred func(BenchMessage) bool) []uint64 {
+		var ids []uint64
+		for i, msg := range decoded {
+			if pred(msg) {
+				ids = append(ids, uint64(i))
+			}
+		}
+		return ids
+	}
+
+	// Row IDs run across all twelve pages.
+	ids, err := scrt.FilterUint(payload, benchSchema, "User", func(v uint64) bool { return v > 1050 })
+	if err != nil {
+		t.Fatalf("filter uint: %v", err)
+	}
+	want := expect(func(m BenchMessage) bool { return m.User > 1050 })
+	if len(want) == 0 || want[len(want)-1] < 2900 || !reflect.DeepEqual(ids, want) {
+		t.Fatalf("FilterUint returned %d ids, want %d", len(ids), len(want))
+	}
+	ids, err = scrt.FilterString(payload, benchSchema, "Lang", func(v string) bool { return v == "de" })
+	if err != nil || !reflect.DeepEqual(ids, expect(func(m BenchMessage) bool { return m.Lang == "de" })) {
+		t.Fatalf("FilterString mismatch: %d ids, err %v", len(ids), err)
+	}
+	ids, err = scrt.FilterBool(payload, benchSchema, "Seen", func(v bool) bool { return !v })
+	if err != nil || !reflect.DeepEqual(ids, expect(func(m BenchMessage) bool { return !m.Seen })) {
+		t.Fatalf("FilterBool mismatch: %d ids, err %v", len(ids), err)
+	}
+
+	sch := parseSingleSchema(t, "@schema Reading\n@field Delta int64\n", "Reading")
+	payload = mustMarshal(t, sch, []map[string]any{{"Delta": int64(-3)}, {}, {"Delta": int64(4)}, {"Delta": int64(-1)}})
+	ids, err = scrt.FilterInt(payload, sch, "Delta", func(v int64) bool { return v < 0 })
+	if err != nil || !reflect.DeepEqual(ids, []uint64{0, 3}) {
+		t.Fatalf("FilterInt = %v, %v; want [0 3]", ids, err)
+	}
+	if _, err := scrt.FilterUint(payload, sch, "Delta", func(uint64) bool { return true }); err == nil {
+		t.Fatalf("expected a kind mismatch error")
+	}
+	if _, err := scrt.FilterInt(payload, sch, "Missing", func(int64) bool { return true }); !errors.Is(err, codec.ErrUnknownField) {
+		t.Fatalf("expected ErrUnknownField, got %v", err)
+	}
+}
+
+func TestAggregateUintColumn(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Hit\n@field ID uint64\n@field Path string\n@field Bytes uint64\n", "Hit")
+	rows := make([]map[string]any, 1000)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i + 1), "Path": "/", "Bytes": uint64(i + 1)}
+	}
+	payload, err := scrt.Marshal(sch, rows, scrt.WithRowsPerPage(128))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	cases := map[codec.AggOp]float64{
+		codec.AggCount: 1000,
+		codec.AggSum:   500500,
+		codec.AggAvg:   500.5,
+		codec.AggMin:   1,
+		codec.AggMax:   1000,
+	}
+	for op, want := range cases {
+		got, err := scrt.Aggregate(payload, sch, "Bytes", op)
+		if err != nil || got != want {
+			t.Fatalf("%s: expected %v, got %v (%v)", op, want, got, err)
+		}
+	}
+
+	for _, op := range []codec.AggOp{codec.AggCount, codec.AggSum} {
+		if got, err := scrt.Aggregate(nil, sch, "Bytes", op); err != nil || got != 0 {
+			t.Fatalf("empty %s: expected 0, got %v (%v)", op, got, err)
+		}
+	}
+	if got, err := scrt.Aggregate(nil, sch, "Bytes", codec.AggAvg); err != nil || !math.IsNaN(got) {
+		t.Fatalf("empty avg: expected NaN, got %v (%v)", got, err)
+	}
+	if _, err := scrt.Aggregate(payload, sch, "Path", codec.AggSum); err == nil {
+		t.Fatalf("expected sum over a string field to fail")
+	}
+	if got, err := scrt.Aggregate(payload, sch, "Path", codec.AggCount); err != nil || got != 1000 {
+		t.Fatalf("count over string: expected 1000, got %v (%v)", got, err)
+	}
+}
+
+func TestOffsetTimestampTZEncoding(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field ID uint64\n@field Logged timestamptz\n", "Event")
+	type Event struct {
+		ID     uint64
+		Logged time.Time
+	}
+	zones := []*time.Location{
+		time.UTC,
+		time.FixedZone("+0530", 19800),
+		time.FixedZone("-0345", -(3*3600 + 45*60)),
+		time.FixedZone("EST", -5*3600),
+	}
+	base := time.Date(2025, time.January, 3, 12, 0, 0, 0, time.UTC)
+	input := make([]Event, 2000)
+	for i := range input {
+		input[i] = Event{ID: uint64(i), Logged: base.Add(time.Duration(i) * 1234567891 * time.Nanosecond).In(zones[i%len(zones)])}
+	}
+	input[7].Logged = time.Time{}
+
+	plain := mustMarshal(t, sch, input)
+	packed, err := scrt.Marshal(sch, input, scrt.WithOffsetTimestampTZ())
+	if err != nil {
+		t.Fatalf("marshal offset encoding: %v", err)
+	}
+	if len(packed) >= len(plain)/2 {
+		t.Fatalf("offset encoding not smaller: %d bytes vs %d", len(packed), len(plain))
+	}
+
+	var decoded []Event
+	if err := scrt.Unmarshal(packed, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(decoded) != len(input) {
+		t.Fatalf("decoded %d rows, want %d", len(decoded), len(input))
+	}
+	for i, got := range decoded {
+		want := input[i].Logged.Format(time.RFC3339Nano)
+		if input[i].Logged.IsZero() {
+			if !got.Logged.IsZero() {
+				t.Fatalf("row %d: expected zero time, got %s", i, got.Logged)
+			}
+			continue
+		}
+		if got.Logged.Format(time.RFC3339Nano) != want {
+			t.Fatalf("row %d: got %s want %s", i, got.Logged.Format(time.RFC3339Nano), want)
+		}
+	}
+
+	// Both encodings decode to the same stored strings.
+	var plainRows, packedRows []map[string]any
+	if err := scrt.Unmarshal(plain, sch, &plainRows); err != nil {
+		t.Fatalf("unmarshal plain: %v", err)
+	}
+	if err := scrt.Unmarshal(packed, sch, &packedRows); err != nil {
+		t.Fatalf("unmarshal packed: %v", err)
+	}
+	if !reflect.DeepEqual(plainRows, packedRows) {
+		t.Fatalf("encodings decode differently")
+	}
+
+	// A streaming reader rebuilds the strings once per page and reuses the
+	// buffer across pages.
+	reader := codec.NewReader(bytes.NewReader(packed), sch)
+	row := codec.NewRow(sch)
+	for i := 0; ; i++ {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			t.Fatalf("read row %d: %v", i, err)
+		}
+		if !ok {
+			if i != len(input) {
+				t.Fatalf("read %d rows, want %d", i, len(input))
+			}
+			break
+		}
+		want := ""
+		if !input[i].Logged.IsZero() {
+			want = input[i].Logged.Format(time.RFC3339Nano)
+		}
+		if got := row.Values()[1].Str; got != want {
+			t.Fatalf("streamed row %d: got %q want %q", i, got, want)
+		}
+	}
+}
+
+func TestOffsetTimestampTZNamedZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("zone database unavailable: %v", err)
+	}
+	sch := parseSingleSchema(t, "@schema Event\n@field Logged timestamptz\n", "Event")
+	type Event struct{ Logged time.Time }
+	winter := time.Date(2025, time.January, 3, 9, 0, 0, 0, loc)
+	summer := time.Date(2025, time.July, 3, 9, 0, 0, 0, loc)
+	payload, err := scrt.Marshal(sch, []Event{{winter}, {summer}}, scrt.WithOffsetTimestampTZ())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded []Event
+	if err := scrt.Unmarshal(payload, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for i, want := range []time.Time{winter, summer} {
+		got := decoded[i].Logged
+		if !got.Equal(want) {
+			t.Fatalf("row %d: instant %s want %s", i, got, want)
+		}
+		_, gotOff := got.Zone()
+		_, wantOff := want.Zone()
+		if gotOff != wantOff {
+			t.Fatalf("row %d: offset %d want %d", i, gotOff, wantOff)
+		}
+	}
+}
+
+func TestMarshalTimeOfDayRoundTrip(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Hours\n@field Day string\n@field Opens time\n@field Closes time\n@field Break time\n", "Hours")
+	type Hours struct {
+		Day    string
+		Opens  time.Duration
+		Closes time.Time
+		Break  string
+	}
+	input := []Hours{
+		{Day: "mon", Opens: 9 * time.Hour, Closes: time.Date(2025, time.March, 3, 17, 30, 0, 0, time.UTC), Break: "12:15 PM"},
+		{Day: "sat", Opens: 10*time.Hour + 30*time.Minute + 250*time.Millisecond, Closes: time.Date(2025, time.March, 8, 23, 59, 59, 0, time.FixedZone("+0200", 7200)), Break: "13:00:05"},
+	}
+	payload := mustMarshal(t, sch, input)
+	var decoded []Hours
+	if err := scrt.Unmarshal(payload, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := []Hours{
+		{Day: "mon", Opens: 9 * time.Hour, Closes: temporal.ClockTime(17*time.Hour + 30*time.Minute), Break: "12:15:00"},
+		{Day: "sat", Opens: input[1].Opens, Closes: temporal.ClockTime(23*time.Hour + 59*time.Minute + 59*time.Second), Break: "13:00:05"},
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", decoded, want)
+	}
+
+	var strRows []map[string]string
+	if err := scrt.Unmarshal(payload, sch, &strRows); err != nil {
+		t.Fatalf("unmarshal string map: %v", err)
+	}
+	if strRows[1]["Opens"] != "10:30:00.25" {
+		t.Fatalf("formatted time %q", strRows[1]["Opens"])
+	}
+
+	for _, bad := range []any{
+		[]map[string]any{{"Opens": 24 * time.Hour}},
+		[]map[string]any{{"Opens": "24:00"}},
+		[]map[string]any{{"Opens": int64(-1)}},
+	} {
+		if _, err := scrt.Marshal(sch, bad); err == nil {
+			t.Fatalf("expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestMarshalStrictTemporal(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field Day date\n@field At timestamp(ms)\n", "Event")
+	type Event struct {
+		Day time.Time
+		At  time.Time
+	}
+	pureDay := time.Date(2025, time.January, 2, 0, 0, 0, 0, time.UTC)
+	withClock := time.Date(2025, time.January, 2, 15, 4, 0, 0, time.FixedZone("-0500", -5*3600))
+	at := time.Date(2025, time.January, 2, 15, 4, 5, 123_000_000, time.UTC)
+
+	// Truncation stays the default.
+	payload, err := scrt.Marshal(sch, []Event{{Day: withClock, At: at.Add(456)}})
+	if err != nil {
+		t.Fatalf("lenient marshal: %v", err)
+	}
+	var decoded []Event
+	if err := scrt.Unmarshal(payload, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if want := time.Date(2025, time.January, 2, 0, 0, 0, 0, time.UTC); !decoded[0].Day.Equal(want) {
+		t.Fatalf("lenient day %s want %s", decoded[0].Day, want)
+	}
+
+	if _, err := scrt.Marshal(sch, []Event{{Day: pureDay, At: at}}, scrt.WithStrictTemporal()); err != nil {
+		t.Fatalf("strict marshal of a pure date: %v", err)
+	}
+	for name, input := range map[string]any{
+		"date with clock":     []Event{{Day: withClock}},
+		"local midnight":      []Event{{Day: time.Date(2025, time.January, 2, 0, 0, 0, 0, time.FixedZone("+0530", 19800))}},
+		"time map with clock": []map[string]time.Time{{"Day": withClock}},
+		"sub-millisecond":     []Event{{Day: pureDay, At: at.Add(456)}},
+		"beyond 2262":         []Event{{Day: pureDay, At: time.Date(2300, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+	} {
+		if _, err := scrt.Marshal(sch, input, scrt.WithStrictTemporal()); err == nil {
+			t.Fatalf("%s: expected strict marshal to fail", name)
+		}
+	}
+}
+
+type codecLocation struct {
+	Lat, Lng float64
+	Tags     []string
+}
+
+func TestRegisteredCodecRoundTrip(t *testing.T) {
+	scrt.RegisterCodec("gzipjson", func(v any) ([]byte, error) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if err := json.NewEncoder(zw).Encode(v); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}, func(data []byte) (any, error) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		var loc codecLocation
+		if err := json.NewDecoder(zr).Decode(&loc); err != nil {
+			return nil, err
+		}
+		return loc, nil
+	})
+
+	sch := parseSingleSchema(t, "@schema Place\n@field ID uint64\n@field Where bytes codec=gzipjson\n", "Place")
+	plain := parseSingleSchema(t, "@schema Place\n@field ID uint64\n@field Where bytes\n", "Place")
+	if sch.Fingerprint() == plain.Fingerprint() {
+		t.Fatalf("codec attribute should change the fingerprint")
+	}
+
+	type place struct {
+		ID    uint64
+		Where codecLocation
+	}
+	in := []place{
+		{ID: 1, Where: codecLocation{Lat: 27.7, Lng: 85.3, Tags: []string{"ktm"}}},
+		{ID: 2, Where: codecLocation{Lat: -33.9, Lng: 151.2}},
+	}
+	payload := mustMarshal(t, sch, in)
+	var out []place
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("round trip mismatch: %+v", out)
+	}
+
+	// Maps go through the codec in both directions as well.
+	fromMap := mustMarshal(t, sch, []map[string]any{{"ID": uint64(3), "Where": codecLocation{Lat: 1, Lng: 2}}})
+	var rows []map[string]any
+	if err := scrt.Unmarshal(fromMap, sch, &rows); err != nil {
+		t.Fatalf("unmarshal map: %v", err)
+	}
+	if got, ok := rows[0]["Where"].(codecLocation); !ok || got.Lat != 1 || got.Lng != 2 {
+		t.Fatalf("unexpected map value %#v", rows[0]["Where"])
+	}
+}
+
+func TestMarshalWithStats(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Hit\n@field ID uint64\n@field Path string\n", "Hit")
+	rows := make([]map[string]any, 2500)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i), "Path": "/"}
+	}
+	result, err := scrt.MarshalWithStats(sch, rows, scrt.WithRowsPerPage(1024))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := codec.WriterStats{PagesWritten: 3, RowsWritten: 2500, BytesWritten: uint64(len(result.Payload))}
+	if result.Stats != want {
+		t.Fatalf("expected %+v, got %+v", want, result.Stats)
+	}
+	if plain := mustMarshal(t, sch, rows); !bytes.Equal(plain, result.Payload) {
+		t.Fatalf("MarshalWithStats payload differs from Marshal")
+	}
+}
+
+func TestEmptyInputRoundTrip(t *testing.T) {
+	type record struct{ ID uint64 }
+	for _, src := range []string{"@schema Log\n@field ID uint64\n", "@schema Log\n"} {
+		sch := parseSingleSchema(t, src, "Log")
+		for _, input := range []any{[]record{}, []map[string]any(nil)} {
+			payload := mustMarshal(t, sch, input)
+			if len(payload) != 14 || payload[13] != 0 {
+				t.Fatalf("expected header plus terminator, got %x", payload)
+			}
+			var structs []record
+			if err := scrt.Unmarshal(payload, sch, &structs); err != nil {
+				t.Fatalf("unmarshal structs: %v", err)
+			}
+			if structs == nil || len(structs) != 0 {
+				t.Fatalf("expected an empty non-nil slice, got %#v", structs)
+			}
+			var maps []map[string]any
+			if err := scrt.Unmarshal(payload, sch, &maps); err != nil || maps == nil || len(maps) != 0 {
+				t.Fatalf("expected an empty map slice, got %#v (%v)", maps, err)
+			}
+			var single record
+			if err := scrt.Unmarshal(payload, sch, &single); !errors.Is(err, io.EOF) {
+				t.Fatalf("expected io.EOF decoding one record from an empty stream, got %v", err)
+			}
+		}
+	}
+
+	// Rows of a zero-field schema still count.
+	sch := parseSingleSchema(t, "@schema Tick\n", "Tick")
+	payload := mustMarshal(t, sch, []map[string]any{{}, {}, {}})
+	var out []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &out); err != nil || len(out) != 3 {
+		t.Fatalf("expected 3 empty rows, got %d (%v)", len(out), err)
+	}
+}
+
+func TestValidatePayloadCollectsViolations(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema User\n@field ID uint64 unique\n@field Email string required\n@field Plan string enum=Free|Pro default=Free\n@field Note string\n", "User")
+	payload := mustMarshal(t, sch, []map[string]any{
+		{"ID": uint64(1), "Email": "a@example.com", "Plan": "Pro"},
+		{"ID": uint64(2), "Plan": "pro"},
+		{"ID": uint64(1), "Email": "c@example.com"},
+		{"ID": uint64(1), "Email": "d@example.com", "Note": "n"},
+	})
+	report, err := scrt.ValidatePayload(payload, sch)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	want := []scrt.Violation{
+		{Row: 1, Field: "Email", Rule: scrt.RuleRequired, Message: "missing required value"},
+		{Row: 1, Field: "Plan", Rule: scrt.RuleEnum, Message: `"pro" is not one of Free, Pro`},
+		{Row: 2, Field: "ID", Rule: scrt.RuleUnique, Message: "duplicate value 1, first seen in row 0"},
+		{Row: 3, Field: "ID", Rule: scrt.RuleUnique, Message: "duplicate value 1, first seen in row 0"},
+	}
+	if report.Rows != 4 || report.Valid() || !reflect.DeepEqual(report.Violations, want) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if !reflect.DeepEqual(report.NullCounts, map[string]uint64{"Email": 1, "Note": 3}) {
+		t.Fatalf("unexpected null counts %v", report.NullCounts)
+	}
+
+	// Only the first MaxValidationViolations are listed.
+	rows := make([]map[string]any, scrt.MaxValidationViolations+50)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i)}
+	}
+	report, err = scrt.ValidatePayload(mustMarshal(t, sch, rows), sch)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if report.TotalViolations != len(rows) || len(report.Violations) != scrt.MaxValidationViolations {
+		t.Fatalf("expected %d listed of %d, got %d of %d", scrt.MaxValidationViolations, len(rows), len(report.Violations), report.TotalViolations)
+	}
+
+	if _, err := schema.Parse(strings.NewReader("@schema X\n@field N uint64 enum=1|2\n")); err == nil {
+		t.Fatalf("expected enum= on a uint64 field to be rejected")
+	}
+}
+
+func TestWriterWriteRowMapUsesMarshalConversions(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field ID uint64\n@field Day date\n@field Score float64\n", "Event")
+	var buf bytes.Buffer
+	writer := codec.NewWriterWithOptions(&buf, sch, 1024, codec.WriterOptions{MapFiller: scrt.FillRowMap})
+	day := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	if err := writer.WriteRowMap(map[string]any{"ID": 1, "Day": day, "Score": float32(1.5), "Extra": "ignored"}); err != nil {
+		t.Fatalf("write map: %v", err)
+	}
+	if err := writer.WriteRowMap(map[string]any{"ID": 2, "Day": "2025-06-02"}); err != nil {
+		t.Fatalf("write map: %v", err)
+	}
+	err := writer.WriteRowMap(map[string]any{"ID": 3, "Score": "high"})
+	if err == nil || !strings.Contains(err.Error(), "field Score") {
+		t.Fatalf("expected an error naming Score, got %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	var out []struct {
+		ID    uint64
+		Day   time.Time
+		Score float64
+	}
+	if err := scrt.Unmarshal(buf.Bytes(), sch, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(out) != 2 || !out[0].Day.Equal(day) || out[0].Score != 1.5 || !out[1].Day.Equal(day.AddDate(0, 0, 1)) {
+		t.Fatalf("unexpected rows %+v", out)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	sch := parseSingleSchema(t, `@schema Event
+@field ID uint64
+@field Delta int64
+@field Score float64
+@field Active bool
+@field Name string
+@field Blob bytes
+@field Day date
+@field At datetime
+@field Logged timestamptz
+@field Window duration
+@field Opens time
+@field Key uuid
+@field Tags list<string>
+@field Refs list<uint64>
+`, "Event")
+	input := `[
+{"ID":18446744073709551615,"Delta":-42,"Score":2.5,"Active":true,"Name":"café \"one\"","Blob":"AAEC/w==","Day":"2025-06-01","At":"2025-06-01T10:30:00.123","Logged":"2025-06-01T10:30:00+02:00","Window":"1h30m0s","Opens":"08:15:00","Key":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","Tags":["a","b"],"Refs":[1,2]},
+{"ID":2,"Delta":null,"Name":"","Blob":"","Tags":[],"Refs":[]},
+{"ID":"3","Score":7,"Unknown":{"nested":true}}
+]`
+	payload, err := scrt.FromJSON(sch, []byte(input))
+	if err != nil {
+		t.Fatalf("FromJSON: %v", err)
+	}
+	got, err := scrt.ToJSON(sch, payload)
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	want := `[{"ID":18446744073709551615,"Delta":-42,"Score":2.5,"Active":true,"Name":"café \"one\"","Blob":"AAEC/w==","Day":"2025-06-01","At":"2025-06-01T10:30:00.123","Logged":"2025-06-01T10:30:00+02:00","Window":"1h30m0s","Opens":"08:15:00","Key":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","Tags":["a","b"],"Refs":[1,2]},` +
+		`{"ID":2,"Name":"","Blob":"","Tags":[],"Refs":[]},` +
+		`{"ID":3,"Score":7}]`
+	if string(got) != want {
+		t.Fatalf("ToJSON mismatch\n got: %s\nwant: %s", got, want)
+	}
+
+	again, err := scrt.FromJSON(sch, got)
+	if err != nil {
+		t.Fatalf("FromJSON of ToJSON output: %v", err)
+	}
+	if !bytes.Equal(again, payload) {
+		t.Fatalf("second round trip changed the payload")
+	}
+
+	var rows []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &rows); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := rows[1]["Delta"]; ok {
+		t.Fatalf("null Delta should leave the field unset, got %#v", rows[1])
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field ID uint64\n@field Blob bytes\n", "Event")
+	if _, err := scrt.FromJSON(sch, []byte(`{"ID":1}`)); err == nil {
+		t.Fatalf("expected an error for a non-array document")
+	}
+	if _, err := scrt.FromJSON(sch, []byte(`[{"ID":-1}]`)); err == nil || !strings.Contains(err.Error(), "field ID") {
+		t.Fatalf("expected an error naming ID, got %v", err)
+	}
+	if _, err := scrt.FromJSON(sch, []byte(`[{"Blob":"not base64!"}]`)); err == nil || !strings.Contains(err.Error(), "field Blob") {
+		t.Fatalf("expected an error naming Blob, got %v", err)
+	}
+	payload, err := scrt.FromJSON(sch, []byte(`[]`))
+	if err != nil {
+		t.Fatalf("FromJSON empty: %v", err)
+	}
+	if got, err := scrt.ToJSON(sch, payload); err != nil || string(got) != "[]" {
+		t.Fatalf("ToJSON empty = %s, %v", got, err)
+	}
+}
+
+func TestUpgradeVersion1Payload(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Legacy\n@field ID uint64\n@field Name string\n", "Legacy")
+	ids := []byte{2, 1, 2} // count, then plain uvarints
+	names := []byte{2, 3, 'a', 'd', 'a', 3, 'l', 'i', 'n', 2, 0, 1}
+	page := []byte{2, 2} // rows, columns
+	page = append(page, 0, byte(schema.KindUint64), byte(len(ids)))
+	page = append(page, ids...)
+	page = append(page, 1, byte(schema.KindString), byte(len(names)))
+	page = append(page, names...)
+	old := append([]byte("SCRT"), 1)
+	old = binary.LittleEndian.AppendUint64(old, sch.Fingerprint())
+	old = append(old, byte(len(page)))
+	old = append(old, page...)
+	old = append(old, 0)
+
+	upgraded, err := scrt.Upgrade(old, sch)
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if v, err := codec.PayloadVersion(upgraded); err != nil || v != codec.FormatVersion {
+		t.Fatalf("upgraded version = %d, %v", v, err)
+	}
+	var rows []struct {
+		ID   uint64
+		Name string
+	}
+	if err := scrt.Unmarshal(upgraded, sch, &rows); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(rows) != 2 || rows[0].ID != 1 || rows[0].Name != "ada" || rows[1].ID != 2 || rows[1].Name != "lin" {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+
+	current, err := scrt.Marshal(sch, rows, scrt.WithFooter())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	same, err := scrt.Upgrade(current, sch)
+	if err != nil || !bytes.Equal(same, current) {
+		t.Fatalf("a current payload should pass through unchanged (err %v)", err)
+	}
+	future := bytes.Clone(current)
+	future[4] = 9
+	if _, err := scrt.Upgrade(future, sch); !errors.Is(err, codec.ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestMarshalWithSortBy(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Reading\n@field Seq uint64\n@field Sensor int64\n@field Blob bytes\n", "Reading")
+	type reading struct {
+		Seq    uint64
+		Sensor int64
+	}
+	input := []map[string]any{
+		{"Seq": uint64(1), "Sensor": int64(30)},
+		{"Seq": uint64(2), "Sensor": int64(-5)},
+		{"Seq": uint64(3), "Sensor": int64(30)},
+		{"Seq": uint64(4)},
+		{"Seq": uint64(5), "Sensor": int64(10)},
+		{"Seq": uint64(6), "Sensor": int64(-5)},
+	}
+	payload, err := scrt.Marshal(sch, input, scrt.WithSortBy("Sensor"), scrt.WithRowsPerPage(2))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded []reading
+	if err := scrt.Unmarshal(payload, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	// The row without a Sensor comes first; equal keys keep input order.
+	want := []reading{{4, 0}, {2, -5}, {6, -5}, {5, 10}, {1, 30}, {3, 30}}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("sorted rows = %v, want %v", decoded, want)
+	}
+
+	if _, err := scrt.Marshal(sch, input, scrt.WithSortBy("Blob")); !errors.Is(err, codec.ErrUnsortableKind) {
+		t.Fatalf("expected ErrUnsortableKind for a bytes field, got %v", err)
+	}
+	if _, err := scrt.Marshal(sch, input, scrt.WithSortBy("Missing")); !errors.Is(err, codec.ErrUnknownField) {
+		t.Fatalf("expected ErrUnknownField, got %v", err)
+	}
+}
+
+func TestMarshalAppend(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field ID uint64\n@field Kind string\n", "Event")
+	type event struct {
+		ID   uint64
+		Kind string
+	}
+	records := func(from, n int) []event {
+		out := make([]event, n)
+		for i := range out {
+			out[i] = event{ID: uint64(from + i), Kind: fmt.Sprintf("kind-%d", (from+i)%7)}
+		}
+		return out
+	}
+	base, added := records(0, 1000), records(1000, 10)
+	want := append(append([]event(nil), base...), added...)
+	global := parseSingleSchema(t, "@schema Event\n@field ID uint64\n@field Kind string encoding=global\n", "Event")
+
+	cases := []struct {
+		name string
+		sch  *schema.Schema
+		opts []scrt.MarshalOption
+	}{
+		{"plain", sch, nil},
+		{"checksums and footer", sch, []scrt.MarshalOption{scrt.WithPageChecksums(), scrt.WithFooter()}},
+		{"global strings", global, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 1000 rows at 300 per page leave a partly filled last page.
+			existing, err := scrt.Marshal(tc.sch, base, append([]scrt.MarshalOption{scrt.WithRowsPerPage(300)}, tc.opts...)...)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			payload, err := scrt.MarshalAppend(existing, tc.sch, added)
+			if err != nil {
+				t.Fatalf("append: %v", err)
+			}
+			if len(tc.opts) == 0 && !bytes.HasPrefix(payload, existing) {
+				t.Fatalf("existing pages were rewritten")
+			}
+			var decoded []event
+			if err := scrt.Unmarshal(payload, tc.sch, &decoded); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, want) {
+				t.Fatalf("decoded %d rows, want the %d-row union", len(decoded), len(want))
+			}
+		})
+	}
+
+	// An empty payload ends in a terminator that must not hide the new rows.
+	empty := mustMarshal(t, sch, []event{})
+	payload, err := scrt.MarshalAppend(empty, sch, added)
+	if err != nil {
+		t.Fatalf("append to empty: %v", err)
+	}
+	var decoded []event
+	if err := scrt.Unmarshal(payload, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, added) {
+		t.Fatalf("decoded %v, want %v", decoded, added)
+	}
+
+	other := parseSingleSchema(t, "@schema Event\n@field ID uint64\n", "Event")
+	if _, err := scrt.MarshalAppend(empty, other, added); !errors.Is(err, codec.ErrSchemaFingerprintMismatch) {
+		t.Fatalf("expected ErrSchemaFingerprintMismatch, got %v", err)
+	}
+	if _, err := scrt.MarshalAppend([]byte("SCRX\x02\x00\x00\x00\x00\x00\x00\x00\x00"), sch, added); err == nil {
+		t.Fatalf("expected an invalid header to be rejected")
+	}
+}
+
+func TestDecodeErrorsMatchScrtSentinels(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field ID uint64\n@field Kind string\n", "Event")
+	other := parseSingleSchema(t, "@schema Event\n@field ID uint64\n", "Event")
+	payload := mustMarshal(t, sch, []map[string]any{{"ID": uint64(1), "Kind": "open"}})
+	var out []map[string]any
+
+	if err := scrt.Unmarshal([]byte("not an scrt stream"), sch, &out); !errors.Is(err, scrt.ErrInvalidMagic) {
+		t.Fatalf("expected ErrInvalidMagic, got %v", err)
+	}
+	if err := scrt.Unmarshal(payload, other, &out); !errors.Is(err, scrt.ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch, got %v", err)
+	}
+	future := bytes.Clone(payload)
+	future[4] = 9
+	if err := scrt.Unmarshal(future, sch, &out); !errors.Is(err, scrt.ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion, got %v", err)
+	}
+	truncatedPage := append(bytes.Clone(payload[:13]), 2, 1, 0xff)
+	if err := scrt.Unmarshal(truncatedPage, sch, &out); !errors.Is(err, scrt.ErrCorruptPage) {
+		t.Fatalf("expected ErrCorruptPage, got %v", err)
+	}
+	if _, err := scrt.Marshal(nil, out); !errors.Is(err, scrt.ErrSchemaRequired) {
+		t.Fatalf("expected ErrSchemaRequired, got %v", err)
+	}
+}
+
+func TestMarshalColumnsRoundTrip(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field ID uint64\n@field Kind string\n@field Score float64\n@field Seen bool\n@field At date\n@field Tags list<string>\n@field Note string\n", "Event")
+	columns := map[string][]any{
+		"ID":    {uint64(1), 2, int64(3)},
+		"Kind":  {"open", "close", nil},
+		"Score": {1.5, float32(2), 3},
+		"Seen":  {true, false, true},
+		"At":    {"2025-06-01", time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), nil},
+		"Tags":  {[]string{"a", "b"}, nil, []string{}},
+	}
+	payload, err := scrt.MarshalColumns(sch, columns, scrt.WithRowsPerPage(2))
+	if err != nil {
+		t.Fatalf("marshal columns: %v", err)
+	}
+	records := make([]map[string]any, 3)
+	for i := range records {
+		records[i] = map[string]any{}
+		for name, values := range columns {
+			records[i][name] = values[i]
+		}
+	}
+	want, err := scrt.Marshal(sch, records, scrt.WithRowsPerPage(2))
+	if err != nil {
+		t.Fatalf("marshal rows: %v", err)
+	}
+	if !bytes.Equal(payload, want) {
+		t.Fatalf("columnar payload differs from the row-based one")
+	}
+	var decoded []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(decoded) != 3 || decoded[1]["Kind"] != "close" || decoded[2]["ID"] != uint64(3) {
+		t.Fatalf("unexpected rows %v", decoded)
+	}
+	for i, rec := range decoded {
+		if _, ok := rec["Note"]; ok {
+			t.Fatalf("row %d: missing column should stay unset, got %v", i, rec["Note"])
+		}
+	}
+	if _, ok := decoded[2]["Kind"]; ok {
+		t.Fatalf("nil value should stay unset, got %v", decoded[2]["Kind"])
+	}
+
+	if _, err := scrt.MarshalColumns(sch, map[string][]any{"ID": {1, 2}, "Kind": {"x"}}); err == nil || !strings.Contains(err.Error(), "column Kind has 1 values but column ID has 2") {
+		t.Fatalf("expected a column length error, got %v", err)
+	}
+	if _, err := scrt.MarshalColumns(sch, map[string][]any{"Missing": {1}}); !errors.Is(err, codec.ErrUnknownField) {
+		t.Fatalf("expected ErrUnknownField, got %v", err)
+	}
+	if _, err := scrt.MarshalColumns(sch, map[string][]any{"ID": {"nope"}}); err == nil || !strings.Contains(err.Error(), "row 0: field ID") {
+		t.Fatalf("expected a conversion error naming the row, got %v", err)
+	}
+	sorted, err := scrt.MarshalColumns(sch, map[string][]any{"ID": {3, 1, 2}}, scrt.WithSortBy("ID"))
+	if err != nil {
+		t.Fatalf("sorted marshal: %v", err)
+	}
+	var ids []struct{ ID uint64 }
+	if err := scrt.Unmarshal(sorted, sch, &ids); err != nil || len(ids) != 3 || ids[0].ID != 1 || ids[2].ID != 3 {
+		t.Fatalf("sorted rows = %v (%v)", ids, err)
+	}
+}
+
+func TestMigrateRename(t *testing.T) {
+	old := parseSingleSchema(t, "@schema Post\n@field ID uint64\n@field Text string\n@field Tags list<string>\n", "Post")
+	next := parseSingleSchema(t, "@schema Post\n@field Body string\n@field ID uint64\n@field Tags list<string>\n@field Views uint64\n", "Post")
+	payload := mustMarshal(t, old, []map[string]any{
+		{"ID": uint64(1), "Text": "hello", "Tags": []string{"a", "b"}},
+		{"ID": uint64(2), "Text": "world"},
+	})
+	if err := scrt.Unmarshal(payload, next, &[]map[string]any{}); !errors.Is(err, codec.ErrSchemaFingerprintMismatch) {
+		t.Fatalf("expected the old payload to be unreadable under the new schema, got %v", err)
+	}
+
+	migrated, err := scrt.MigrateRename(old, next, map[string]string{"Text": "Body"}, payload)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	type post struct {
+		Body  string
+		ID    uint64
+		Tags  []string
+		Views uint64
+	}
+	var decoded []post
+	if err := scrt.Unmarshal(migrated, next, &decoded); err != nil {
+		t.Fatalf("unmarshal migrated: %v", err)
+	}
+	want := []post{{Body: "hello", ID: 1, Tags: []string{"a", "b"}}, {Body: "world", ID: 2}}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("migrated rows = %+v, want %+v", decoded, want)
+	}
+
+	for _, tc := range []struct {
+		renames map[string]string
+		want    string
+	}{
+		{nil, "field Text has no counterpart"},
+		{map[string]string{"Text": "Missing"}, "rename target Missing"},
+		{map[string]string{"Nope": "Body"}, "rename source Nope"},
+		{map[string]string{"Text": "Views"}, "cannot become Views"},
+		{map[string]string{"Text": "ID"}, "fields ID and Text both map to ID"},
+	} {
+		if _, err := scrt.MigrateRename(old, next, tc.renames, payload); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("renames %v: expected error containing %q, got %v", tc.renames, tc.want, err)
+		}
+	}
+}
+
+func TestUnmarshalExpectedRows(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Event\n@field ID uint64\n", "Event")
+	type event struct{ ID uint64 }
+	records := make([]event, 2500)
+	for i := range records {
+		records[i].ID = uint64(i)
+	}
+	plain, err := scrt.Marshal(sch, records, scrt.WithRowsPerPage(300))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	footed, err := scrt.Marshal(sch, records, scrt.WithRowsPerPage(300), scrt.WithFooter())
+	if err != nil {
+		t.Fatalf("marshal footed: %v", err)
+	}
+	cases := []struct {
+		name    string
+		data    []byte
+		opts    []scrt.UnmarshalOption
+		wantCap int // 0 skips the capacity check
+	}{
+		{"exact hint", plain, []scrt.UnmarshalOption{scrt.WithExpectedRows(2500)}, 2500},
+		{"low hint", plain, []scrt.UnmarshalOption{scrt.WithExpectedRows(10)}, 0},
+		{"high hint", plain, []scrt.UnmarshalOption{scrt.WithExpectedRows(5000)}, 5000},
+		{"footer", footed, nil, 2500},
+		{"no hint", plain, nil, 0},
+	}
+	for _, tc := range cases {
+		var got []event
+		if err := scrt.UnmarshalWithOptions(tc.data, sch, &got, tc.opts...); err != nil {
+			t.Fatalf("%s: unmarshal: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, records) {
+			t.Fatalf("%s: decoded %d rows, want %d", tc.name, len(got), len(records))
+		}
+		if tc.wantCap != 0 && cap(got) != tc.wantCap {
+			t.Fatalf("%s: expected capacity %d, got %d", tc.name, tc.wantCap, cap(got))
+		}
+	}
+
+	// The hint counts rows beyond those already in the slice.
+	got := []event{{ID: 99}}
+	if err := scrt.UnmarshalWithOptions(plain, sch, &got, scrt.WithExpectedRows(2500)); err != nil {
+		t.Fatalf("unmarshal into non-empty slice: %v", err)
+	}
+	if len(got) != 2501 || cap(got) != 2501 || got[0].ID != 99 || got[2500].ID != 2499 {
+		t.Fatalf("unexpected append result: len %d cap %d", len(got), cap(got))
+	}
+}
+
+func TestMarshalPragmaRowsPerPage(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Hit\n@pragma rows_per_page=256\n@field ID uint64\n@field Path string\n", "Hit")
+	rows := make([]map[string]any, 1000)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i), "Path": "/"}
+	}
+	cases := []struct {
+		name  string
+		opts  []scrt.MarshalOption
+		pages uint64
+	}{
+		{"pragma", nil, 4},
+		{"explicit override", []scrt.MarshalOption{scrt.WithRowsPerPage(100)}, 10},
+	}
+	for _, tc := range cases {
+		result, err := scrt.MarshalWithStats(sch, rows, tc.opts...)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", tc.name, err)
+		}
+		if result.Stats.PagesWritten != tc.pages {
+			t.Fatalf("%s: expected %d pages, got %d", tc.name, tc.pages, result.Stats.PagesWritten)
+		}
+	}
+
+	// codec.Writer applies the pragma when given no page size.
+	var buf bytes.Buffer
+	writer := codec.NewWriter(&buf, sch, 0)
+	row := codec.NewRow(sch)
+	for i := range rows {
+		row.Reset()
+		if err := row.SetUint("ID", uint64(i)); err != nil {
+			t.Fatalf("set ID: %v", err)
+		}
+		if err := row.SetString("Path", "/"); err != nil {
+			t.Fatalf("set Path: %v", err)
+		}
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatalf("write row: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if pages := writer.Stats().PagesWritten; pages != 4 {
+		t.Fatalf("writer: expected 4 pages, got %d", pages)
+	}
+}
+
+func TestUnmarshalMapAllocations(t *testing.T) {
+	cases := []struct {
+		name    string
+		sch     *schema.Schema
+		records []map[string]any
+		// perRow bounds allocations per decoded row. Before the map[string]any
+		// fast path these decodes took about 5.8 and 6.8 per row.
+		perRow float64
+	}{
+		{name: "messages", sch: benchSchema, records: generateMessageMaps(1000), perRow: 4},
+		{name: "bytes copy", sch: bytesSchema, records: generateBinaryMapRecords(1000, 512), perRow: 5},
+	}
+	for _, tc := range cases {
+		data := mustMarshal(t, tc.sch, tc.records)
+		var result []map[string]any
+		allocs := testing.AllocsPerRun(20, func() {
+			result = nil
+			if err := scrt.Unmarshal(data, tc.sch, &result); err != nil {
+				t.Fatalf("%s: unmarshal: %v", tc.name, err)
+			}
+		})
+		if !reflect.DeepEqual(result, tc.records) {
+			t.Fatalf("%s: decoded rows differ from the input", tc.name)
+		}
+		if perRow := allocs / float64(len(tc.records)); perRow > tc.perRow {
+			t.Fatalf("%s: %.2f allocs per row, want at most %.1f", tc.name, perRow, tc.perRow)
+		}
+	}
+
+	// Typed maps keep their own path and must not regress.
+	counters := generateCounterMaps(1000)
+	data := mustMarshal(t, counterSchema, counters)
+	var typed []map[string]uint64
+	allocs := testing.AllocsPerRun(20, func() {
+		typed = nil
+		if err := scrt.Unmarshal(data, counterSchema, &typed); err != nil {
+			t.Fatalf("typed: unmarshal: %v", err)
+		}
+	})
+	if !reflect.DeepEqual(typed, counters) {
+		t.Fatal("typed: decoded rows differ from the input")
+	}
+	if perRow := allocs / float64(len(counters)); perRow > 2.1 {
+		t.Fatalf("typed: %.2f allocs per row, want at most 2.1", perRow)
+	}
+}
+
+func TestMarshalPlainStringColumn(t *testing.T) {
+	const base = `@schema:Token
+@field ID uint64
+@field Value string%s
+@field Kind string
+`
+	auto := parseSingleSchema(t, fmt.Sprintf(base, ""), "Token")
+	dict := parseSingleSchema(t, fmt.Sprintf(base, " encoding=dict"), "Token")
+	plain := parseSingleSchema(t, fmt.Sprintf(base, " encoding=plain"), "Token")
+
+	// The first two pages hold distinct values; the last repeats one, so
+	// each page picks its own layout.
+	rows := make([]map[string]any, 0, 300)
+	for i := 0; i < 300; i++ {
+		value := fmt.Sprintf("tok-%08x-%04d", uint32(i)*2654435761, i)
+		if i >= 200 {
+			value = "repeated"
+		}
+		rows = append(rows, map[string]any{"ID": uint64(i), "Value": value, "Kind": []string{"a", "b"}[i%2]})
+	}
+	// Without WithPlainStrings the output is unchanged.
+	legacy, err := scrt.Marshal(auto, rows, scrt.WithRowsPerPage(100))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	sizes := make(map[string]int)
+	for name, sch := range map[string]*schema.Schema{"auto": auto, "dict": dict, "plain": plain} {
+		data, err := scrt.Marshal(sch, rows, scrt.WithRowsPerPage(100), scrt.WithPlainStrings())
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", name, err)
+		}
+		sizes[name] = len(data)
+		var decoded []map[string]any
+		if err := scrt.Unmarshal(data, sch, &decoded); err != nil {
+			t.Fatalf("%s: unmarshal: %v", name, err)
+		}
+		if !reflect.DeepEqual(decoded, rows) {
+			t.Fatalf("%s: round trip changed the rows", name)
+		}
+	}
+	if len(legacy) != sizes["dict"] {
+		t.Fatalf("default encoding is %d bytes, want the dictionary's %d", len(legacy), sizes["dict"])
+	}
+	if sizes["auto"] >= sizes["dict"] {
+		t.Fatalf("auto encoding is %d bytes, dictionary %d; expected plain pages to shrink it", sizes["auto"], sizes["dict"])
+	}
+	if sizes["auto"] >= sizes["plain"] {
+		t.Fatalf("auto encoding is %d bytes, forced plain %d; expected the repeated page to stay on its dictionary", sizes["auto"], sizes["plain"])
+	}
+
+	if _, err := schema.Parse(strings.NewReader("@schema:Bad\n@field N uint64 encoding=plain\n")); err == nil {
+		t.Fatalf("encoding= on a uint64 field should fail")
+	}
+}
+
+func TestUnmarshalPointerFieldsTrackPresence(t *testing.T) {
+	sch := parseSingleSchema(t, `@schema Sparse
+@field ID uint64
+@field Count int64
+@field Ratio float64
+@field Active bool
+@field Name string
+@field Blob bytes
+@field Day date
+@field Seen timestamp
+@field Logged timestamptz
+@field Window duration
+@field Alarm time
+@field Key uuid
+`, "Sparse")
+	type Sparse struct {
+		ID     *uint64
+		Count  *int64
+		Ratio  *float64
+		Active *bool
+		Name   *string
+		Blob   *[]byte
+		Day    *time.Time
+		Seen   *time.Time
+		Logged *time.Time
+		Window *time.Duration
+		Alarm  *time.Duration
+		Key    *[16]byte
+	}
+	seen := time.Date(2025, time.March, 4, 5, 6, 7, 0, time.UTC)
+	payload := mustMarshal(t, sch, []map[string]any{
+		// Every field present with its zero value.
+		{"ID": uint64(0), "Count": int64(0), "Ratio": 0.0, "Active": false, "Name": "", "Blob": []byte{},
+			"Day": time.Time{}, "Seen": time.Time{}, "Logged": "1970-01-01T00:00:00Z",
+			"Window": time.Duration(0), "Alarm": time.Duration(0), "Key": "00000000-0000-0000-0000-000000000000"},
+		// Only the key.
+		{"ID": uint64(2)},
+		// A scattering of kinds.
+		{"ID": uint64(3), "Name": "gale", "Day": seen, "Seen": seen, "Window": time.Minute},
+	})
+
+	var rows []Sparse
+	if err := scrt.Unmarshal(payload, sch, &rows); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	nilFields := func(row Sparse) []string {
+		var names []string
+		v := reflect.ValueOf(row)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).IsNil() {
+				names = append(names, v.Type().Field(i).Name)
+			}
+		}
+		return names
+	}
+	if absent := nilFields(rows[0]); absent != nil {
+		t.Fatalf("zero values decoded as absent: %v", absent)
+	}
+	if *rows[0].ID != 0 || *rows[0].Count != 0 || *rows[0].Active || *rows[0].Name != "" || !rows[0].Seen.IsZero() || *rows[0].Key != [16]byte{} {
+		t.Fatalf("zero values decoded wrong: %+v", rows[0])
+	}
+	want := []string{"Count", "Ratio", "Active", "Name", "Blob", "Day", "Seen", "Logged", "Window", "Alarm", "Key"}
+	if absent := nilFields(rows[1]); !reflect.DeepEqual(absent, want) {
+		t.Fatalf("row 1 absent fields = %v, want %v", absent, want)
+	}
+	want = []string{"Count", "Ratio", "Active", "Blob", "Logged", "Alarm", "Key"}
+	if absent := nilFields(rows[2]); !reflect.DeepEqual(absent, want) {
+		t.Fatalf("row 2 absent fields = %v, want %v", absent, want)
+	}
+	if *rows[2].ID != 3 || *rows[2].Name != "gale" || !rows[2].Seen.Equal(seen) || *rows[2].Window != time.Minute {
+		t.Fatalf("row 2 decoded wrong: %+v", rows[2])
+	}
+
+	// Decoding into the spare capacity of a reused slice must not leave the
+	// previous decode's pointers behind for absent fields.
+	reused := rows[:0]
+	if err := scrt.Unmarshal(mustMarshal(t, sch, []map[string]any{{"ID": uint64(9)}}), sch, &reused); err != nil {
+		t.Fatalf("unmarshal into reused slice: %v", err)
+	}
+	want = []string{"Count", "Ratio", "Active", "Name", "Blob", "Day", "Seen", "Logged", "Window", "Alarm", "Key"}
+	if absent := nilFields(reused[0]); !reflect.DeepEqual(absent, want) || *reused[0].ID != 9 {
+		t.Fatalf("reused row absent fields = %v, want %v", absent, want)
+	}
+
+	// The same holds for maps: a reused element gets a fresh map.
+	var decoded []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal into maps: %v", err)
+	}
+	earlier, before := decoded[0], fmt.Sprint(decoded[0])
+	reusedMaps := decoded[:0]
+	if err := scrt.Unmarshal(mustMarshal(t, sch, []map[string]any{{"ID": uint64(9)}}), sch, &reusedMaps); err != nil {
+		t.Fatalf("unmarshal into reused maps: %v", err)
+	}
+	if len(reusedMaps[0]) != 1 || reusedMaps[0]["ID"] != uint64(9) {
+		t.Fatalf("reused map = %v, want only ID", reusedMaps[0])
+	}
+	if fmt.Sprint(earlier) != before {
+		t.Fatalf("reuse overwrote a map from the earlier decode: %v", earlier)
+	}
+
+	// A date reaches *string through its text form, after the time.Time
+	// probe has failed.
+	var texts []struct{ Day *string }
+	if err := scrt.Unmarshal(payload, sch, &texts); err != nil {
+		t.Fatalf("unmarshal into *string: %v", err)
+	}
+	if texts[1].Day != nil || texts[2].Day == nil || *texts[2].Day != "2025-03-04" {
+		t.Fatalf("date into *string = %v, %v", texts[1].Day, texts[2].Day)
+	}
+}
+
+func TestCanonicalMarshalIsByteStable(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Hit\n@pragma rows_per_page=2\n@field ID uint64\n@field Lang string default=\"en\"\n@field Path string\n@field Score float64\n@field Seen timestamp\n", "Hit")
+	type hit struct {
+		ID    uint64
+		Lang  string
+		Path  string
+		Score float64
+		Seen  time.Time
+	}
+	seen := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	structs := []hit{
+		{ID: 1, Lang: "en", Path: "/b", Score: math.NaN(), Seen: seen},
+		{ID: 2, Lang: "de", Path: "/a", Score: 1.5, Seen: seen},
+		{ID: 3, Lang: "en", Path: "/b", Score: 2, Seen: seen.Add(time.Hour)},
+	}
+	// The same rows with defaults omitted, another NaN, and text times.
+	maps := []map[string]any{
+		{"ID": uint64(1), "Path": "/b", "Score": math.Float64frombits(0x7ff8000000000abc), "Seen": "2024-05-01T12:30:00Z"},
+		{"ID": uint64(2), "Lang": "de", "Path": "/a", "Score": 1.5, "Seen": "2024-05-01T12:30:00Z"},
+		{"ID": uint64(3), "Path": "/b", "Score": 2.0, "Seen": "2024-05-01T13:30:00Z"},
+	}
+	fromStructs, err := scrt.CanonicalMarshal(sch, structs)
+	if err != nil {
+		t.Fatalf("canonical structs: %v", err)
+	}
+	fromMaps, err := scrt.CanonicalMarshal(sch, maps)
+	if err != nil {
+		t.Fatalf("canonical maps: %v", err)
+	}
+	if !bytes.Equal(fromStructs, fromMaps) {
+		t.Fatalf("equivalent inputs encoded differently:\n%x\n%x", fromStructs, fromMaps)
+	}
+	plain := mustMarshal(t, sch, structs)
+	if bytes.Equal(plain, fromStructs) {
+		t.Fatalf("canonical output should ignore the rows_per_page pragma")
+	}
+
+	var decoded []hit
+	if err := scrt.Unmarshal(fromMaps, sch, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(decoded) != len(structs) {
+		t.Fatalf("expected %d rows, got %d", len(structs), len(decoded))
+	}
+	for i, want := range structs {
+		got := decoded[i]
+		if got.ID != want.ID || got.Lang != want.Lang || got.Path != want.Path || !got.Seen.Equal(want.Seen) {
+			t.Fatalf("row %d: got %+v, want %+v", i, got, want)
+		}
+		if math.IsNaN(want.Score) != math.IsNaN(got.Score) || (!math.IsNaN(want.Score) && got.Score != want.Score) {
+			t.Fatalf("row %d: score %v, want %v", i, got.Score, want.Score)
+		}
+	}
+}
+
+func TestUnmarshalWrittenSchemaBackfillsAddedFields(t *testing.T) {
+	v1 := parseSingleSchema(t, "@schema Member\n@field ID uint64\n@field Name string\n@field Legacy string\n", "Member")
+	v2 := parseSingleSchema(t, "@schema Member\n@field ID uint64\n@field Name string\n@field Joined date default=\"2024-02-29\"\n@field Seen timestamp default=\"2024-03-01T08:00:00Z\"\n@field Tier string default=\"free\"\n@field Note string\n@field Stamp timestamp default=now()\n", "Member")
+	payload := mustMarshal(t, v1, []map[string]any{
+		{"ID": uint64(1), "Name": "ada", "Legacy": "x"},
+		{"ID": uint64(2), "Name": "bob"},
+	})
+	joined := time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)
+	seen := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	type member struct {
+		ID     uint64
+		Name   string
+		Joined time.Time
+		Seen   time.Time
+		Tier   string
+		Note   *string
+		Stamp  *time.Time
+	}
+	var structs []member
+	if err := scrt.UnmarshalWithOptions(payload, v2, &structs, scrt.WithWrittenSchema(v1)); err != nil {
+		t.Fatalf("unmarshal structs: %v", err)
+	}
+	if len(structs) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(structs))
+	}
+	for i, got := range structs {
+		if got.ID != uint64(i+1) || !got.Joined.Equal(joined) || !got.Seen.Equal(seen) || got.Tier != "free" {
+			t.Fatalf("row %d: defaults not backfilled: %+v", i, got)
+		}
+		if got.Note != nil || got.Stamp != nil {
+			t.Fatalf("row %d: fields without a literal default should stay nil: %+v", i, got)
+		}
+	}
+
+	var maps []map[string]any
+	if err := scrt.UnmarshalWithOptions(payload, v2, &maps, scrt.WithWrittenSchema(v1)); err != nil {
+		t.Fatalf("unmarshal maps: %v", err)
+	}
+	for i, got := range maps {
+		if j, ok := got["Joined"].(time.Time); !ok || !j.Equal(joined) {
+			t.Fatalf("row %d: Joined = %#v, want %v", i, got["Joined"], joined)
+		}
+		if s, ok := got["Seen"].(time.Time); !ok || !s.Equal(seen) {
+			t.Fatalf("row %d: Seen = %#v, want %v", i, got["Seen"], seen)
+		}
+		if got["Tier"] != "free" {
+			t.Fatalf("row %d: Tier = %#v", i, got["Tier"])
+		}
+		for _, absent := range []string{"Note", "Stamp", "Legacy"} {
+			if v, ok := got[absent]; ok {
+				t.Fatalf("row %d: %s should be absent, got %#v", i, absent, v)
+			}
+		}
+	}
+
+	// Without the written schema the fingerprints disagree.
+	if err := scrt.Unmarshal(payload, v2, &maps); !errors.Is(err, scrt.ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch, got %v", err)
+	}
+	retyped := parseSingleSchema(t, "@schema Member\n@field ID uint64\n@field Name int64\n", "Member")
+	if err := scrt.UnmarshalWithOptions(payload, retyped, &maps, scrt.WithWrittenSchema(v1)); err == nil || !strings.Contains(err.Error(), "Name") {
+		t.Fatalf("expected a retyped field error, got %v", err)
+	}
+}
+
+func TestMarshalSliceGenericRoundTrip(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Msg\n@field msg_id uint64\n@field Text string\n@field Count uint64\n", "Msg")
+	type msg struct {
+		MsgID uint64
+		Text  string
+		Count uint64
+	}
+	rows := []msg{{MsgID: 1, Text: "hi", Count: 3}, {MsgID: 2, Text: "yo"}}
+	payload, err := scrt.MarshalSlice(sch, rows)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !bytes.Equal(payload, mustMarshal(t, sch, rows)) {
+		t.Fatalf("MarshalSlice and Marshal disagree")
+	}
+	got, err := scrt.UnmarshalSlice[msg](payload, sch)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Fatalf("got %+v, want %+v", got, rows)
+	}
+
+	ptrs, err := scrt.UnmarshalSlice[*msg](payload, sch)
+	if err != nil || len(ptrs) != 2 || *ptrs[1] != rows[1] {
+		t.Fatalf("pointer rows: %+v, %v", ptrs, err)
+	}
+	if again, err := scrt.MarshalSlice(sch, ptrs); err != nil || !bytes.Equal(again, payload) {
+		t.Fatalf("pointer marshal: %v", err)
+	}
+	maps, err := scrt.UnmarshalSlice[map[string]any](payload, sch)
+	if err != nil || len(maps) != 2 || maps[0]["Text"] != "hi" {
+		t.Fatalf("map rows: %+v, %v", maps, err)
+	}
+
+	empty, err := scrt.UnmarshalSlice[msg](mustMarshal(t, sch, []msg{}), sch)
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Fatalf("empty stream: %#v, %v", empty, err)
+	}
+
+	// Errors still name the schema field.
+	type ambiguous struct {
+		MsgID uint64
+		MsgId uint64
+	}
+	if _, err := scrt.MarshalSlice(sch, []ambiguous{{1, 2}}); err == nil || !strings.Contains(err.Error(), "msg_id") {
+		t.Fatalf("ambiguous binding: %v", err)
+	}
+	if _, err := scrt.UnmarshalSlice[ambiguous](payload, sch); err == nil || !strings.Contains(err.Error(), "msg_id") {
+		t.Fatalf("ambiguous binding on decode: %v", err)
+	}
+	type wrong struct {
+		MsgID uint64
+		Count string
+	}
+	if _, err := scrt.MarshalSlice(sch, []wrong{{1, "x"}}); err == nil || !strings.Contains(err.Error(), "field Count") {
+		t.Fatalf("bad value: %v", err)
+	}
+	type narrow struct {
+		MsgID uint64
+		Count bool
+	}
+	if _, err := scrt.UnmarshalSlice[narrow](payload, sch, scrt.WithStrictTypes()); err == nil || !strings.Contains(err.Error(), "field Count") {
+		t.Fatalf("strict decode: %v", err)
+	}
+}
+
+func TestComputedFieldConcatenation(t *testing.T) {
+	stored := parseSingleSchema(t, "@schema Person\n@field ID uint64\n@field First string\n@field Last string\n", "Person")
+	sch := parseSingleSchema(t, "@schema Person\n@field ID uint64\n@field First string\n@field Last string\n@computed FullName expr=First + \" \" + Last\n@computed Label expr=\"#\" + ID + \": \" + Last\n", "Person")
+	if sch.Fingerprint() != stored.Fingerprint() {
+		t.Fatalf("computed fields changed the fingerprint")
+	}
+	payload := mustMarshal(t, sch, []map[string]any{
+		{"ID": uint64(1), "First": "Ada", "Last": "Lovelace", "FullName": "ignored"},
+		{"ID": uint64(2), "Last": "Hopper"},
+	})
+	if plain := mustMarshal(t, stored, []map[string]any{
+		{"ID": uint64(1), "First": "Ada", "Last": "Lovelace"},
+		{"ID": uint64(2), "Last": "Hopper"},
+	}); !bytes.Equal(payload, plain) {
+		t.Fatalf("computed fields reached the payload")
+	}
+
+	type person struct {
+		ID       uint64
+		First    string
+		Last     string
+		FullName string
+		Label    *string
+	}
+	var people []person
+	if err := scrt.Unmarshal(payload, sch, &people); err != nil {
+		t.Fatalf("unmarshal structs: %v", err)
+	}
+	if people[0].FullName != "Ada Lovelace" || people[0].Label == nil || *people[0].Label != "#1: Lovelace" {
+		t.Fatalf("row 0: %+v", people[0])
+	}
+	if people[1].FullName != "" || people[1].Label == nil || *people[1].Label != "#2: Hopper" {
+		t.Fatalf("row 1: computed field over an unset field should stay unset: %+v", people[1])
+	}
+
+	var maps []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &maps); err != nil {
+		t.Fatalf("unmarshal maps: %v", err)
+	}
+	if maps[0]["FullName"] != "Ada Lovelace" || maps[0]["Label"] != "#1: Lovelace" {
+		t.Fatalf("row 0: %#v", maps[0])
+	}
+	if _, ok := maps[1]["FullName"]; ok {
+		t.Fatalf("row 1: FullName should be absent: %#v", maps[1])
+	}
+}
+
+func TestComputedFieldArithmetic(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Line\n@field Qty int64\n@field Price float64\n@field Seen timestamp\n@field Units uint64\n@computed Total expr=Qty * Price\n@computed Hour expr=Seen / 3600000000000\n@computed Packs expr=(Units + 5) / 6\n@computed Spare expr=-(Units % 6)\n", "Line")
+	seen := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+	payload := mustMarshal(t, sch, []map[string]any{
+		{"Qty": int64(3), "Price": 2.5, "Seen": seen, "Units": uint64(13)},
+	})
+
+	type line struct {
+		Qty   int64
+		Price float64
+		Total float64
+		Hour  int64
+		Packs int
+		Spare any
+	}
+	var lines []line
+	if err := scrt.Unmarshal(payload, sch, &lines); err != nil {
+		t.Fatalf("unmarshal structs: %v", err)
+	}
+	wantHour := seen.UnixNano() / int64(time.Hour)
+	if got := lines[0]; got.Total != 7.5 || got.Hour != wantHour || got.Packs != 3 || got.Spare != int64(-1) {
+		t.Fatalf("struct: %+v, want Total 7.5 Hour %d Packs 3 Spare -1", got, wantHour)
+	}
+
+	var maps []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &maps); err != nil {
+		t.Fatalf("unmarshal maps: %v", err)
+	}
+	if got := maps[0]; got["Total"] != 7.5 || got["Hour"] != wantHour || got["Packs"] != int64(3) {
+		t.Fatalf("map: %#v", got)
+	}
+
+	zero := mustMarshal(t, sch, []map[string]any{{"Qty": int64(1), "Price": 1.0, "Seen": seen, "Units": uint64(0)}})
+	var zmaps []map[string]any
+	if err := scrt.Unmarshal(zero, sch, &zmaps); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if zmaps[0]["Packs"] != int64(0) || zmaps[0]["Spare"] != int64(0) {
+		t.Fatalf("zero units: %#v", zmaps[0])
+	}
+}
+
+func TestComputedFieldTypedMaps(t *testing.T) {
+	stock := parseSingleSchema(t, "@schema Stock\n@field Units uint64\n@computed Packs expr=(Units + 5) / 6\n", "Stock")
+	payload := mustMarshal(t, stock, []map[string]any{{"Units": uint64(13)}, {"Units": uint64(math.MaxUint64)}})
+	var counts []map[string]uint64
+	if err := scrt.Unmarshal(payload, stock, &counts); err != nil {
+		t.Fatalf("unmarshal map[string]uint64: %v", err)
+	}
+	if counts[0]["Packs"] != 3 {
+		t.Fatalf("row 0: %v", counts[0])
+	}
+	// A uint64 beyond int64 leaves the expression unset rather than wrapping.
+	if packs, ok := counts[1]["Packs"]; ok {
+		t.Fatalf("row 1: Packs = %d, want unset", packs)
+	}
+
+	person := parseSingleSchema(t, "@schema Person\n@field First string\n@field Last string\n@computed FullName expr=First + \" \" + Last\n", "Person")
+	payload = mustMarshal(t, person, []map[string]any{{"First": "Ada", "Last": "Lovelace"}})
+	var names []map[string]string
+	if err := scrt.Unmarshal(payload, person, &names); err != nil {
+		t.Fatalf("unmarshal map[string]string: %v", err)
+	}
+	if names[0]["FullName"] != "Ada Lovelace" {
+		t.Fatalf("map[string]string: %v", names[0])
+	}
+}
+
+func TestDeltaApplyReproducesTarget(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Item\n@field ID uint64\n@field Label string\n@field Tags list<string>\n@field Tier string default=\"free\"\n", "Item")
+	type item struct {
+		ID    uint64
+		Label string
+		Tags  []string
+		Tier  string
+	}
+	base := mustMarshal(t, sch, []item{{1, "a", []string{"x"}, "free"}, {2, "b", nil, "pro"}, {3, "c", nil, "free"}, {4, "d", []string{"y"}, "free"}})
+	// Row 2 is deleted, row 3 updated, and row 5 inserted between 3 and 4.
+	target := mustMarshal(t, sch, []item{{1, "a", []string{"x"}, "free"}, {3, "c2", nil, "free"}, {5, "e", []string{"z"}, "free"}, {4, "d", []string{"y"}, "free"}})
+
+	patch, err := scrt.Delta(base, target, sch, "ID")
+	if err != nil {
+		t.Fatalf("delta: %v", err)
+	}
+	type op struct {
+		Op    uint64 `scrt:"$op"`
+		Pos   uint64 `scrt:"$pos"`
+		Key   string `scrt:"$key"`
+		ID    uint64
+		Label string
+	}
+	var ops []op
+	if err := scrt.Unmarshal(patch, scrt.DeltaSchema(sch), &ops); err != nil {
+		t.Fatalf("decode patch: %v", err)
+	}
+	want := []op{
+		{Op: scrt.DeltaDelete, Key: "ID", ID: 2},
+		{Op: scrt.DeltaUpdate, Pos: 1, Key: "ID", ID: 3, Label: "c2"},
+		{Op: scrt.DeltaInsert, Pos: 2, Key: "ID", ID: 5, Label: "e"},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("patch ops:\n got %+v\nwant %+v", ops, want)
+	}
+
+	rebuilt, err := scrt.ApplyDelta(base, patch, sch)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if !bytes.Equal(rebuilt, target) {
+		t.Fatalf("apply did not reproduce target:\n got %x\nwant %x", rebuilt, target)
+	}
+	again, err := scrt.ApplyDelta(base, patch, sch)
+	if err != nil || !bytes.Equal(again, rebuilt) {
+		t.Fatalf("apply is not deterministic: %v", err)
+	}
+
+	// A moved row travels as an update; an unchanged payload needs no ops.
+	moved := mustMarshal(t, sch, []item{{4, "d", []string{"y"}, "free"}, {1, "a", []string{"x"}, "free"}, {2, "b", nil, "pro"}, {3, "c", nil, "free"}})
+	patch, err = scrt.Delta(base, moved, sch, "ID")
+	if err != nil {
+		t.Fatalf("delta moved: %v", err)
+	}
+	if rebuilt, err := scrt.ApplyDelta(base, patch, sch); err != nil || !bytes.Equal(rebuilt, moved) {
+		t.Fatalf("apply moved: %v", err)
+	}
+	same, err := scrt.Delta(base, base, sch, "ID")
+	if err != nil {
+		t.Fatalf("delta same: %v", err)
+	}
+	ops = nil
+	if err := scrt.Unmarshal(same, scrt.DeltaSchema(sch), &ops); err != nil || len(ops) != 0 {
+		t.Fatalf("expected an empty patch, got %+v (%v)", ops, err)
+	}
+	if rebuilt, err := scrt.ApplyDelta(base, same, sch); err != nil || !bytes.Equal(rebuilt, base) {
+		t.Fatalf("apply empty patch: %v", err)
+	}
+
+	shrunk := mustMarshal(t, sch, []item{{1, "a", nil, "free"}})
+	if _, err := scrt.ApplyDelta(shrunk, patch, sch); !errors.Is(err, scrt.ErrDeltaMismatch) {
+		t.Fatalf("expected ErrDeltaMismatch against a different base, got %v", err)
+	}
+	if _, err := scrt.Delta(base, target, sch, "Missing"); err == nil {
+		t.Fatalf("expected error for unknown key field")
+	}
+}
+
+func TestDeltaKeepsAbsentDefaultedFields(t *testing.T) {
+	sch := parseSingleSchema(t, "@schema Item\n@field ID uint64\n@field Tier string default=\"free\"\n", "Item")
+	// Rows that leave Tier out store nothing for it; only decoding fills in
+	// the default, so a rebuild must not write it back.
+	base := mustMarshal(t, sch, []map[string]any{{"ID": uint64(1)}, {"ID": uint64(2), "Tier": "pro"}, {"ID": uint64(3)}})
+	target := mustMarshal(t, sch, []map[string]any{{"ID": uint64(1)}, {"ID": uint64(3), "Tier": "free"}, {"ID": uint64(4)}})
+
+	patch, err := scrt.Delta(base, target, sch, "ID")
+	if err != nil {
+		t.Fatalf("delta: %v", err)
+	}
+	rebuilt, err := scrt.ApplyDelta(base, patch, sch)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if !bytes.Equal(rebuilt, target) {
+		t.Fatalf("apply did not reproduce target:\n got %x\nwant %x", rebuilt, target)
+	}
+}
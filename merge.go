@@ -0,0 +1,114 @@
+package scrt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// mergeKey is a comparable projection of a key column value.
+type mergeKey struct {
+	num uint64
+	str string
+}
+
+func mergeKeyOf(val codec.Value, kind schema.FieldKind) mergeKey {
+	switch kind {
+	case schema.KindUint64, schema.KindRef:
+		return mergeKey{num: val.Uint}
+	case schema.KindUUID:
+		return mergeKey{str: string(val.Bytes)}
+	case schema.KindString, schema.KindTimestampTZ:
+		return mergeKey{str: val.Str}
+	default:
+		return mergeKey{num: uint64(val.Int)}
+	}
+}
+
+// Merge combines payloads encoded with s into a single stream holding one row
+// per distinct value of keyField; when a key repeats, the row from the later
+// payload (or later in the same payload) wins. Each surviving row is emitted
+// where its winning copy appeared, so rows whose keys never collide keep their
+// input order. Inputs are read twice: the first pass records only the winning
+// position of every key, so memory grows with the number of distinct keys
+// rather than the number of rows. Every row must set keyField, which must be
+// a kind that can back a unique key (see schema.IndexableKind).
+func Merge(s *schema.Schema, keyField string, payloads ...[]byte) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	keyIdx, ok := s.FieldIndex(keyField)
+	if !ok {
+		return nil, fmt.Errorf("scrt: schema %s lacks key field %s", s.Name, keyField)
+	}
+	kind := s.Fields[keyIdx].ValueKind()
+	if !schema.IndexableKind(kind) {
+		return nil, fmt.Errorf("scrt: field %s (%s) cannot be used as a merge key", keyField, s.Fields[keyIdx].RawType)
+	}
+
+	row := codec.NewRow(s)
+	winners := make(map[mergeKey]uint64)
+	var ordinal uint64
+	err := readMergeInputs(s, row, payloads, func(pos int) error {
+		keyVal := row.Values()[keyIdx]
+		if !keyVal.Set {
+			return fmt.Errorf("scrt: payload %d row %d lacks key field %s", pos, ordinal, keyField)
+		}
+		key := mergeKeyOf(keyVal, kind)
+		// String keys borrow the reader's page buffer, which the next page
+		// reuses, so the map keeps its own copy.
+		key.str = strings.Clone(key.str)
+		winners[key] = ordinal
+		ordinal++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	writer := codec.NewWriter(buf, s, 0)
+	ordinal = 0
+	err = readMergeInputs(s, row, payloads, func(int) error {
+		current := ordinal
+		ordinal++
+		if winners[mergeKeyOf(row.Values()[keyIdx], kind)] != current {
+			return nil
+		}
+		return writer.WriteRow(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readMergeInputs decodes every row of payloads into row in order, calling fn
+// with the index of the payload the row came from. Empty payloads are skipped.
+func readMergeInputs(s *schema.Schema, row codec.Row, payloads [][]byte, fn func(pos int) error) error {
+	for pos, payload := range payloads {
+		if len(payload) == 0 {
+			continue
+		}
+		reader := codec.NewReader(bytes.NewReader(payload), s)
+		for {
+			ok, err := reader.ReadRow(row)
+			if err != nil {
+				return fmt.Errorf("scrt: payload %d: %w", pos, err)
+			}
+			if !ok {
+				break
+			}
+			if err := fn(pos); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package scrt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// MigrateRename re-encodes payload, written with old, under next so renamed
+// fields keep their data. renames maps old field names to new ones; every
+// other old field carries over to the next field of the same name, and the
+// fields may appear in any order in next. A mapped pair must store the same
+// kind. Fields only next declares stay unset. MigrateRename fails rather than
+// drop data when an old field has no counterpart in next, and when two old
+// fields land on the same new one.
+func MigrateRename(old, next *schema.Schema, renames map[string]string, payload []byte) ([]byte, error) {
+	if old == nil || next == nil {
+		return nil, ErrSchemaRequired
+	}
+	sources, dropped, err := codec.FieldSources(old, next, renames)
+	if err != nil {
+		return nil, err
+	}
+	if len(dropped) > 0 {
+		return nil, fmt.Errorf("scrt: field %s has no counterpart in %s; add it to renames", dropped[0], next.Name)
+	}
+
+	reader := codec.NewReader(bytes.NewReader(payload), old)
+	src := codec.NewRow(old)
+	dst := codec.NewRow(next)
+	var buf bytes.Buffer
+	writer := codec.NewWriter(&buf, next, 0)
+	for {
+		ok, err := reader.ReadRow(src)
+		if err != nil {
+			return nil, fmt.Errorf("scrt: migrate %s: %w", old.Name, err)
+		}
+		if !ok {
+			break
+		}
+		in, out := src.Values(), dst.Values()
+		for i, from := range sources {
+			if from < 0 {
+				out[i] = codec.Value{}
+				continue
+			}
+			out[i] = in[from]
+		}
+		if err := writer.WriteRow(dst); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -16,6 +16,50 @@ type Builder struct {
 
 	columns   []columnHandle
 	columnBuf bytes.Buffer
+	countBuf  bytes.Buffer
+	unpooled  bool
+	// sortedDicts writes page-local string dictionaries in bytewise order.
+	sortedDicts bool
+}
+
+// GlobalDictFlag is OR-ed into a column's kind byte when its string
+// dictionary is shared by every page of the stream rather than page-local.
+const GlobalDictFlag byte = 0x80
+
+// OffsetTZFlag is OR-ed into a timestamptz column's kind byte when values are
+// stored as a UTC instant column followed by a zone-offset column in minutes
+// instead of as strings.
+const OffsetTZFlag byte = 0x40
+
+// PlainStringFlag is OR-ed into a string column's kind byte when the page
+// stores its values length-prefixed in row order instead of through a
+// dictionary.
+const PlainStringFlag byte = 0x20
+
+// NarrowIntFlag is OR-ed into an integer column's kind byte when the page
+// stores its values at a fixed width chosen for the page rather than as
+// varints; see column.Uint64Column.EncodeNarrow.
+const NarrowIntFlag byte = 0x10
+
+// BuilderOptions selects optional column encodings.
+type BuilderOptions struct {
+	// GlobalStrings marks string fields (indexed like s.Fields) whose
+	// dictionary is shared by every page of the stream. Fields declared
+	// encoding=plain stay plain.
+	GlobalStrings []bool
+	// OffsetTimestampTZ stores timestamptz fields as instant and offset
+	// columns; values are appended with AppendTimestampTZ.
+	OffsetTimestampTZ bool
+	// AutoPlainStrings writes page-local string fields without an
+	// encoding= attribute plain on pages where that is smaller.
+	AutoPlainStrings bool
+	// SortedDictionaries writes page-local string dictionaries in bytewise
+	// order rather than first-use order. Readers need no flag: indexes are
+	// remapped to the sorted entries.
+	SortedDictionaries bool
+	// NarrowIntegers writes uint64, ref, and int64-backed columns at a
+	// fixed width on pages where that is no larger than varints.
+	NarrowIntegers bool
 }
 
 type columnHandle struct {
@@ -26,7 +70,17 @@ type columnHandle struct {
 	ints    *column.Int64Column
 	floats  *column.Float64Column
 	bytes   *column.BytesColumn
+	uuids   *column.UUIDColumn
+	counts  *column.Uint64Column // per-row element counts of list columns
+	offsets *column.Int64Column  // zone offsets of offset-encoded timestamptz columns
 	present []bool
+	global  bool
+	// autoPlain writes a string column plain on pages where that is
+	// smaller than its dictionary.
+	autoPlain bool
+	// narrow writes an integer column at a fixed width on pages where
+	// that is no larger than varints.
+	narrow bool
 }
 
 // NewBuilder creates a builder with the provided row capacity.
@@ -34,6 +88,39 @@ func NewBuilder(s *schema.Schema, rowLimit int) *Builder {
 	return newBuilderWithLimit(s, normalizeRowLimit(rowLimit))
 }
 
+// NewBuilderWithGlobalStrings creates a builder whose string fields marked in
+// global (indexed like s.Fields) keep one dictionary across all pages. Such
+// builders carry stream state and are never returned to the pool.
+func NewBuilderWithGlobalStrings(s *schema.Schema, rowLimit int, global []bool) *Builder {
+	return NewBuilderWithOptions(s, rowLimit, BuilderOptions{GlobalStrings: global})
+}
+
+// NewBuilderWithOptions creates a builder using the encodings selected by
+// opts. Like NewBuilderWithGlobalStrings, it is never returned to the pool.
+func NewBuilderWithOptions(s *schema.Schema, rowLimit int, opts BuilderOptions) *Builder {
+	limit := normalizeRowLimit(rowLimit)
+	b := newBuilderWithLimit(s, limit)
+	for i := range b.columns {
+		handle := &b.columns[i]
+		switch {
+		case handle.kind == schema.KindString && i < len(opts.GlobalStrings) && opts.GlobalStrings[i] && s.Fields[i].Encoding != schema.StringEncodingPlain:
+			handle.strings = column.NewStringColumnWithTable(limit, column.NewStringTable())
+			handle.global = true
+		case handle.kind == schema.KindTimestampTZ && opts.OffsetTimestampTZ:
+			handle.strings = nil
+			handle.ints = column.NewInt64Column(limit)
+			handle.offsets = column.NewInt64Column(limit)
+		case handle.kind == schema.KindString && opts.AutoPlainStrings && s.Fields[i].Encoding == schema.StringEncodingAuto:
+			handle.autoPlain = true
+		case opts.NarrowIntegers && (handle.uints != nil || handle.ints != nil) && handle.kind != schema.KindList:
+			handle.narrow = true
+		}
+	}
+	b.sortedDicts = opts.SortedDictionaries
+	b.unpooled = true
+	return b
+}
+
 // AcquireBuilder returns a reusable builder for the schema and rowLimit.
 func AcquireBuilder(s *schema.Schema, rowLimit int) *Builder {
 	limit := normalizeRowLimit(rowLimit)
@@ -50,7 +137,7 @@ func AcquireBuilder(s *schema.Schema, rowLimit int) *Builder {
 
 // ReleaseBuilder returns a builder back to the pool after resetting it.
 func ReleaseBuilder(b *Builder) {
-	if b == nil || b.schema == nil {
+	if b == nil || b.schema == nil || b.unpooled {
 		return
 	}
 	key := builderPoolKey{schema: b.schema, rowsPerPage: b.rowLimit}
@@ -83,14 +170,19 @@ func newBuilderWithLimit(s *schema.Schema, rowLimit int) *Builder {
 		case schema.KindUint64:
 			handle.uints = column.NewUint64Column(rowLimit)
 		case schema.KindString:
-			handle.strings = column.NewStringColumn(rowLimit)
+			if f.Encoding == schema.StringEncodingPlain {
+				handle.strings = column.NewPlainStringColumn(rowLimit)
+			} else {
+				handle.strings = column.NewStringColumn(rowLimit)
+			}
 		case schema.KindBool:
 			handle.bools = column.NewBoolColumn(rowLimit)
 		case schema.KindInt64,
 			schema.KindDate,
 			schema.KindDateTime,
 			schema.KindTimestamp,
-			schema.KindDuration:
+			schema.KindDuration,
+			schema.KindTime:
 			handle.ints = column.NewInt64Column(rowLimit)
 		case schema.KindFloat64:
 			handle.floats = column.NewFloat64Column(rowLimit)
@@ -98,6 +190,19 @@ func newBuilderWithLimit(s *schema.Schema, rowLimit int) *Builder {
 			handle.bytes = column.NewBytesColumn(rowLimit)
 		case schema.KindTimestampTZ:
 			handle.strings = column.NewStringColumn(rowLimit)
+		case schema.KindUUID:
+			handle.uuids = column.NewUUIDColumn(rowLimit)
+		case schema.KindList:
+			// Elements share the scalar column of their kind.
+			handle.counts = column.NewUint64Column(rowLimit)
+			switch f.ElemKind {
+			case schema.KindString:
+				handle.strings = column.NewStringColumn(rowLimit)
+			case schema.KindUint64:
+				handle.uints = column.NewUint64Column(rowLimit)
+			default:
+				panic("unsupported list element kind")
+			}
 		default:
 			panic("unsupported field kind")
 		}
@@ -166,6 +271,51 @@ func (b *Builder) AppendBytes(idx int, v []byte) {
 	handle.bytes.Append(v)
 }
 
+// AppendUUID records a 16-byte UUID value for the specified field index.
+func (b *Builder) AppendUUID(idx int, v []byte) {
+	handle := &b.columns[idx]
+	if handle.uuids == nil {
+		panic("field is not uuid")
+	}
+	handle.uuids.Append(v)
+}
+
+// AppendTimestampTZ records a timestamptz value as its UTC instant in
+// nanoseconds and its zone offset in minutes.
+// The builder must have been created with BuilderOptions.OffsetTimestampTZ.
+func (b *Builder) AppendTimestampTZ(idx int, instant, offsetMinutes int64) {
+	handle := &b.columns[idx]
+	if handle.offsets == nil {
+		panic("field is not offset-encoded timestamptz")
+	}
+	handle.ints.Append(instant)
+	handle.offsets.Append(offsetMinutes)
+}
+
+// AppendStrings records a list<string> value for the specified field index.
+func (b *Builder) AppendStrings(idx int, v []string) {
+	handle := &b.columns[idx]
+	if handle.counts == nil || handle.strings == nil {
+		panic("field is not list<string>")
+	}
+	handle.counts.Append(uint64(len(v)))
+	for _, s := range v {
+		handle.strings.Append(s)
+	}
+}
+
+// AppendUints records a list<uint64> value for the specified field index.
+func (b *Builder) AppendUints(idx int, v []uint64) {
+	handle := &b.columns[idx]
+	if handle.counts == nil || handle.uints == nil {
+		panic("field is not list<uint64>")
+	}
+	handle.counts.Append(uint64(len(v)))
+	for _, u := range v {
+		handle.uints.Append(u)
+	}
+}
+
 // RecordPresence tracks whether the current row provided a value for idx.
 func (b *Builder) RecordPresence(idx int, present bool) {
 	handle := &b.columns[idx]
@@ -202,12 +352,30 @@ func (b *Builder) Reset() {
 		if b.columns[i].bytes != nil {
 			b.columns[i].bytes.Reset()
 		}
+		if b.columns[i].uuids != nil {
+			b.columns[i].uuids.Reset()
+		}
+		if b.columns[i].counts != nil {
+			b.columns[i].counts.Reset()
+		}
+		if b.columns[i].offsets != nil {
+			b.columns[i].offsets.Reset()
+		}
 		if b.columns[i].present != nil {
 			b.columns[i].present = b.columns[i].present[:0]
 		}
 	}
 }
 
+// encodeStrings writes a dictionary-encoded string column into columnBuf.
+func (b *Builder) encodeStrings(col *column.StringColumn) {
+	if b.sortedDicts {
+		col.EncodeSorted(&b.columnBuf)
+		return
+	}
+	col.Encode(&b.columnBuf)
+}
+
 // Encode writes the current page into dst.
 func (b *Builder) Encode(dst *bytes.Buffer) {
 	if b.rows == 0 {
@@ -219,27 +387,81 @@ func (b *Builder) Encode(dst *bytes.Buffer) {
 	for idx, col := range b.columns {
 		b.columnBuf.Reset()
 		writePresence(&b.columnBuf, col.present, b.rows)
+		plain, narrow := false, false
 		switch col.kind {
 		case schema.KindUint64, schema.KindRef:
-			col.uints.Encode(&b.columnBuf)
-		case schema.KindString, schema.KindTimestampTZ:
-			col.strings.Encode(&b.columnBuf)
+			narrow = col.narrow && col.uints.PreferNarrow()
+			if narrow {
+				col.uints.EncodeNarrow(&b.columnBuf)
+			} else {
+				col.uints.Encode(&b.columnBuf)
+			}
+		case schema.KindString:
+			plain = col.strings.Plain() || (col.autoPlain && col.strings.PlainSmaller())
+			if plain {
+				col.strings.EncodePlain(&b.columnBuf)
+			} else {
+				b.encodeStrings(col.strings)
+			}
+		case schema.KindTimestampTZ:
+			if col.offsets == nil {
+				b.encodeStrings(col.strings)
+				break
+			}
+			// Instants are length-prefixed so the offset column can follow.
+			b.countBuf.Reset()
+			col.ints.Encode(&b.countBuf)
+			writeUvarint(&b.columnBuf, uint64(b.countBuf.Len()))
+			b.columnBuf.Write(b.countBuf.Bytes())
+			col.offsets.Encode(&b.columnBuf)
 		case schema.KindBool:
 			col.bools.Encode(&b.columnBuf)
 		case schema.KindInt64,
 			schema.KindDate,
 			schema.KindDateTime,
 			schema.KindTimestamp,
-			schema.KindDuration:
-			col.ints.Encode(&b.columnBuf)
+			schema.KindDuration,
+			schema.KindTime:
+			narrow = col.narrow && col.ints.PreferNarrow()
+			if narrow {
+				col.ints.EncodeNarrow(&b.columnBuf)
+			} else {
+				col.ints.Encode(&b.columnBuf)
+			}
 		case schema.KindFloat64:
 			col.floats.Encode(&b.columnBuf)
 		case schema.KindBytes:
 			col.bytes.Encode(&b.columnBuf)
+		case schema.KindUUID:
+			col.uuids.Encode(&b.columnBuf)
+		case schema.KindList:
+			// Counts are length-prefixed so the element column can follow.
+			b.countBuf.Reset()
+			col.counts.Encode(&b.countBuf)
+			writeUvarint(&b.columnBuf, uint64(b.countBuf.Len()))
+			b.columnBuf.Write(b.countBuf.Bytes())
+			if col.strings != nil {
+				b.encodeStrings(col.strings)
+			} else {
+				col.uints.Encode(&b.columnBuf)
+			}
 		}
 		segment := b.columnBuf.Bytes()
 		writeUvarint(dst, uint64(idx))
-		dst.WriteByte(byte(col.kind))
+		kindByte := byte(col.kind)
+		if col.global {
+			kindByte |= GlobalDictFlag
+		}
+		if col.offsets != nil {
+			kindByte |= OffsetTZFlag
+		}
+		if plain {
+			kindByte |= PlainStringFlag
+		}
+		if narrow {
+			kindByte |= NarrowIntFlag
+		}
+		dst.WriteByte(kindByte)
 		writeUvarint(dst, uint64(len(segment)))
 		dst.Write(segment)
 	}
@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/oarkflow/scrt/codec"
 	"github.com/oarkflow/scrt/schema"
 	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
 )
 
 var (
@@ -27,67 +31,268 @@ type structBindingKey struct {
 
 type structDescriptor struct {
 	fields map[string]structField
+	// folded maps foldName(binding name) to the binding names sharing it.
+	folded map[string][]string
+}
+
+// structBindings caches the result of structBindingsForSchema, including a
+// binding error, per struct type and schema.
+type structBindings struct {
+	fields []structField
+	// computed binds the schema's computed fields, by position.
+	computed []structField
+	err      error
 }
 
 type structField struct {
 	index []int
+	// viaPointer reports whether index passes through an embedded pointer.
+	viaPointer bool
+	// omitEmpty leaves the column unset when the field holds its zero value.
+	omitEmpty bool
+}
+
+type structCandidate struct {
+	field structField
+	depth int
 }
 
+// describeStruct maps binding names to field index paths. Anonymous embedded
+// structs (and pointers to them) are flattened; when the same name appears at
+// several depths the shallowest wins, and names that collide at the same depth
+// are dropped, matching Go's promotion rules.
 func describeStruct(t reflect.Type) *structDescriptor {
 	if v, ok := structCache.Load(t); ok {
 		return v.(*structDescriptor)
 	}
-	desc := &structDescriptor{fields: make(map[string]structField)}
+	candidates := make(map[string][]structCandidate)
+	collectStructFields(t, nil, false, 0, map[reflect.Type]bool{t: true}, candidates)
+	desc := &structDescriptor{fields: make(map[string]structField, len(candidates))}
+	for name, list := range candidates {
+		best := list[0]
+		ambiguous := false
+		for _, c := range list[1:] {
+			switch {
+			case c.depth < best.depth:
+				best = c
+				ambiguous = false
+			case c.depth == best.depth:
+				ambiguous = true
+			}
+		}
+		if !ambiguous {
+			desc.fields[name] = best.field
+		}
+	}
+	desc.folded = make(map[string][]string, len(desc.fields))
+	for name := range desc.fields {
+		key := foldName(name)
+		desc.folded[key] = append(desc.folded[key], name)
+	}
+	for _, names := range desc.folded {
+		sort.Strings(names)
+	}
+	structCache.Store(t, desc)
+	return desc
+}
+
+func collectStructFields(t reflect.Type, prefix []int, viaPointer bool, depth int, visiting map[reflect.Type]bool, out map[string][]structCandidate) {
 	num := t.NumField()
 	for i := 0; i < num; i++ {
 		field := t.Field(i)
-		if field.PkgPath != "" {
+		tag, omitEmpty := parseStructTag(field.Tag.Get("scrt"))
+		if tag == "-" {
 			continue
 		}
-		tag := field.Tag.Get("scrt")
-		if tag == "-" {
+		index := make([]int, len(prefix)+1)
+		copy(index, prefix)
+		index[len(prefix)] = i
+		if field.Anonymous && tag == "" {
+			embedded := field.Type
+			isPointer := false
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+				isPointer = true
+			}
+			if embedded.Kind() == reflect.Struct && embedded != timeType {
+				// Unexported embedded pointers cannot be allocated on decode.
+				if isPointer && field.PkgPath != "" {
+					continue
+				}
+				if !visiting[embedded] {
+					visiting[embedded] = true
+					collectStructFields(embedded, index, viaPointer || isPointer, depth+1, visiting, out)
+					delete(visiting, embedded)
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
 			continue
 		}
 		name := field.Name
 		if tag != "" {
 			name = tag
 		}
-		desc.fields[name] = structField{index: field.Index}
+		out[name] = append(out[name], structCandidate{
+			field: structField{index: index, viaPointer: viaPointer, omitEmpty: omitEmpty},
+			depth: depth,
+		})
 	}
-	structCache.Store(t, desc)
-	return desc
+}
+
+// parseStructTag splits an `scrt` tag into its name and the omitempty option.
+// A bare "-" skips the field; options follow the name comma-separated, as with
+// encoding/json.
+func parseStructTag(tag string) (string, bool) {
+	if tag == "-" {
+		return tag, false
+	}
+	name, opts, found := strings.Cut(tag, ",")
+	if !found {
+		return tag, false
+	}
+	omitEmpty := false
+	for _, opt := range strings.Split(opts, ",") {
+		if strings.TrimSpace(opt) == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return strings.TrimSpace(name), omitEmpty
+}
+
+// isEmptyValue reports whether v is empty under encoding/json's omitempty rules.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// foldName normalizes a name for the case-insensitive fallback: case and
+// underscores are ignored, so msg_id, MsgID and msgId all fold together.
+func foldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// match resolves a schema field name to a struct field. An exact name wins,
+// then each alias in order, then a case-insensitive match on the name and
+// aliases. A fallback that matches several struct fields is an error.
+func (d *structDescriptor) match(name string, aliases []string) (structField, bool, error) {
+	if def, ok := d.fields[name]; ok {
+		return def, true, nil
+	}
+	for _, alias := range aliases {
+		if def, ok := d.fields[alias]; ok {
+			return def, true, nil
+		}
+	}
+	for _, candidate := range append([]string{name}, aliases...) {
+		names := d.folded[foldName(candidate)]
+		switch len(names) {
+		case 0:
+			continue
+		case 1:
+			return d.fields[names[0]], true, nil
+		default:
+			return structField{}, false, fmt.Errorf("scrt: field %s matches several struct fields case-insensitively: %s", name, strings.Join(names, ", "))
+		}
+	}
+	return structField{}, false, nil
 }
 
 func (d *structDescriptor) lookup(v reflect.Value, field string) (reflect.Value, bool) {
 	if d == nil {
 		return reflect.Value{}, false
 	}
-	def, ok := d.fields[field]
-	if !ok {
+	def, ok, err := d.match(field, nil)
+	if err != nil || !ok {
+		return reflect.Value{}, false
+	}
+	fv, err := v.FieldByIndexErr(def.index)
+	if err != nil {
 		return reflect.Value{}, false
 	}
-	return v.FieldByIndex(def.index), true
+	return fv, true
 }
 
-func structBindingsForSchema(t reflect.Type, s *schema.Schema) []structField {
+// fieldByIndexAlloc walks index like FieldByIndex, allocating nil embedded
+// pointers along the way so decoded values have somewhere to land.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func structBindingsForSchema(t reflect.Type, s *schema.Schema) ([]structField, error) {
+	entry := loadStructBindings(t, s)
+	return entry.fields, entry.err
+}
+
+// computedBindingsForSchema returns the struct fields that receive the
+// computed fields of s, by position; unbound ones have an empty index.
+func computedBindingsForSchema(t reflect.Type, s *schema.Schema) []structField {
+	return loadStructBindings(t, s).computed
+}
+
+func loadStructBindings(t reflect.Type, s *schema.Schema) structBindings {
 	if t == nil || s == nil {
-		return nil
+		return structBindings{}
 	}
 	key := structBindingKey{typeKey: t, schemaKey: s}
 	if cached, ok := structBindingCache.Load(key); ok {
-		return cached.([]structField)
+		return cached.(structBindings)
 	}
 	desc := describeStruct(t)
-	bindings := make([]structField, len(s.Fields))
+	entry := structBindings{fields: make([]structField, len(s.Fields))}
 	if desc != nil {
 		for idx, field := range s.Fields {
-			if sf, ok := desc.fields[field.Name]; ok {
-				bindings[idx] = sf
+			sf, ok, err := desc.match(field.Name, field.Aliases)
+			if err != nil {
+				entry = structBindings{err: err}
+				break
+			}
+			if ok {
+				entry.fields[idx] = sf
+			}
+		}
+		if entry.err == nil && len(s.Computed) > 0 {
+			entry.computed = make([]structField, len(s.Computed))
+			for idx, c := range s.Computed {
+				sf, ok, err := desc.match(c.Name, nil)
+				if err != nil {
+					entry = structBindings{err: err}
+					break
+				}
+				if ok {
+					entry.computed[idx] = sf
+				}
 			}
 		}
 	}
-	structBindingCache.Store(key, bindings)
-	return bindings
+	structBindingCache.Store(key, entry)
+	return entry
 }
 
 func indirect(v reflect.Value) reflect.Value {
@@ -411,7 +616,55 @@ func anyAsBytes(v any) ([]byte, error) {
 	}
 }
 
-func valueAsTime(v reflect.Value, kind schema.FieldKind) (time.Time, error) {
+// valueAsList converts a slice into the element column of a list field. An
+// empty slice stays non-nil so it round-trips distinctly from an unset field.
+func valueAsList(v reflect.Value, elem schema.FieldKind, dst *codec.Value) error {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("scrt: unsupported list source %s", v.Kind())
+	}
+	n := v.Len()
+	switch elem {
+	case schema.KindString:
+		dst.Strs = make([]string, n)
+		for i := 0; i < n; i++ {
+			s, err := valueAsString(indirect(v.Index(i)))
+			if err != nil {
+				return err
+			}
+			dst.Strs[i] = s
+		}
+	case schema.KindUint64:
+		dst.Uints = make([]uint64, n)
+		for i := 0; i < n; i++ {
+			u, err := valueAsUint(indirect(v.Index(i)))
+			if err != nil {
+				return err
+			}
+			dst.Uints[i] = u
+		}
+	default:
+		return fmt.Errorf("scrt: unsupported list element kind %d", elem)
+	}
+	return nil
+}
+
+func anyAsList(src any, elem schema.FieldKind, dst *codec.Value) error {
+	switch val := src.(type) {
+	case []string:
+		if elem == schema.KindString {
+			dst.Strs = append(make([]string, 0, len(val)), val...)
+			return nil
+		}
+	case []uint64:
+		if elem == schema.KindUint64 {
+			dst.Uints = append(make([]uint64, 0, len(val)), val...)
+			return nil
+		}
+	}
+	return valueAsList(reflect.ValueOf(src), elem, dst)
+}
+
+func valueAsTime(v reflect.Value, kind schema.FieldKind, unit temporal.EpochUnit) (time.Time, error) {
 	v = indirect(v)
 	if !v.IsValid() {
 		return time.Time{}, fmt.Errorf("scrt: invalid time value")
@@ -421,7 +674,7 @@ func valueAsTime(v reflect.Value, kind schema.FieldKind) (time.Time, error) {
 	}
 	switch v.Kind() {
 	case reflect.String:
-		return parseTemporalString(kind, v.String())
+		return parseTemporalString(kind, unit, v.String())
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return decodeTemporalFromInt(kind, v.Int()), nil
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
@@ -442,7 +695,7 @@ func valueAsTime(v reflect.Value, kind schema.FieldKind) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("scrt: unsupported time source %s", v.Kind())
 }
 
-func anyAsTime(kind schema.FieldKind, value any) (time.Time, error) {
+func anyAsTime(kind schema.FieldKind, unit temporal.EpochUnit, value any) (time.Time, error) {
 	switch val := value.(type) {
 	case time.Time:
 		return val, nil
@@ -452,9 +705,9 @@ func anyAsTime(kind schema.FieldKind, value any) (time.Time, error) {
 		}
 		return *val, nil
 	case string:
-		return parseTemporalString(kind, val)
+		return parseTemporalString(kind, unit, val)
 	case fmt.Stringer:
-		return parseTemporalString(kind, val.String())
+		return parseTemporalString(kind, unit, val.String())
 	case int:
 		return decodeTemporalFromInt(kind, int64(val)), nil
 	case int8:
@@ -515,6 +768,55 @@ func valueAsDuration(v reflect.Value) (time.Duration, error) {
 	return 0, fmt.Errorf("scrt: unsupported duration source %s", v.Kind())
 }
 
+// valueAsTimeOfDay reads a time of day from a time.Time (its wall clock), a
+// string such as "15:04" or "3:04 PM", or any duration source.
+func valueAsTimeOfDay(v reflect.Value) (time.Duration, error) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return 0, fmt.Errorf("scrt: invalid time of day value")
+	}
+	var (
+		d   time.Duration
+		err error
+	)
+	switch {
+	case v.Type() == timeType:
+		d = temporal.TimeOfDay(v.Interface().(time.Time))
+	case v.Kind() == reflect.String:
+		d, err = temporal.ParseTimeOfDay(v.String())
+	default:
+		d, err = valueAsDuration(v)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return d, temporal.CheckTimeOfDay(d)
+}
+
+func anyAsTimeOfDay(value any) (time.Duration, error) {
+	var (
+		d   time.Duration
+		err error
+	)
+	switch val := value.(type) {
+	case time.Time:
+		d = temporal.TimeOfDay(val)
+	case *time.Time:
+		if val == nil {
+			return 0, fmt.Errorf("scrt: nil *time.Time")
+		}
+		d = temporal.TimeOfDay(*val)
+	case string:
+		d, err = temporal.ParseTimeOfDay(val)
+	default:
+		d, err = anyAsDuration(value)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return d, temporal.CheckTimeOfDay(d)
+}
+
 func anyAsDuration(value any) (time.Duration, error) {
 	switch val := value.(type) {
 	case time.Duration:
@@ -558,16 +860,80 @@ func anyAsDuration(value any) (time.Duration, error) {
 	}
 }
 
-func parseTemporalString(kind schema.FieldKind, input string) (time.Time, error) {
+func valueAsUUID(v reflect.Value) ([]byte, error) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("scrt: invalid uuid value")
+	}
+	switch v.Kind() {
+	case reflect.String:
+		id, err := uuid.Parse(v.String())
+		if err != nil {
+			return nil, err
+		}
+		return id[:], nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			id, err := uuid.FromBytes(v.Bytes())
+			if err != nil {
+				return nil, err
+			}
+			return id[:], nil
+		}
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Len() == uuid.Size {
+			buf := make([]byte, uuid.Size)
+			reflect.Copy(reflect.ValueOf(buf), v)
+			return buf, nil
+		}
+	}
+	if v.Type().Implements(stringerType) {
+		return anyAsUUID(v.Interface().(fmt.Stringer).String())
+	}
+	return nil, fmt.Errorf("scrt: unsupported uuid source %s", v.Kind())
+}
+
+func anyAsUUID(value any) ([]byte, error) {
+	switch val := value.(type) {
+	case uuid.UUID:
+		buf := make([]byte, uuid.Size)
+		copy(buf, val[:])
+		return buf, nil
+	case [uuid.Size]byte:
+		buf := make([]byte, uuid.Size)
+		copy(buf, val[:])
+		return buf, nil
+	case []byte:
+		id, err := uuid.FromBytes(val)
+		if err != nil {
+			return nil, err
+		}
+		return id[:], nil
+	case string:
+		id, err := uuid.Parse(val)
+		if err != nil {
+			return nil, err
+		}
+		return id[:], nil
+	case fmt.Stringer:
+		return anyAsUUID(val.String())
+	default:
+		return valueAsUUID(reflect.ValueOf(value))
+	}
+}
+
+// parseTemporalString parses text for a temporal field; unit applies to
+// integer epochs in timestamp fields.
+func parseTemporalString(kind schema.FieldKind, unit temporal.EpochUnit, input string) (time.Time, error) {
 	switch kind {
 	case schema.KindDate:
 		return temporal.ParseDate(input)
 	case schema.KindDateTime:
 		return temporal.ParseDateTime(input)
 	case schema.KindTimestamp:
-		return temporal.ParseTimestamp(input)
+		return temporal.ParseTimestampUnit(input, unit)
 	case schema.KindTimestampTZ:
-		return temporal.ParseTimestampTZ(input)
+		return temporal.DecodeTimestampTZ(input)
 	default:
 		return temporal.ParseTimestamp(input)
 	}
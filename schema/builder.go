@@ -0,0 +1,313 @@
+package schema
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
+)
+
+// Builder assembles a Schema in code. Each field goes through the same
+// construction as a DSL @field line, so a built schema has the fingerprint of
+// the DSL that declares the same fields, types, and attributes in the same
+// order:
+//
+//	sch, err := schema.New("Message").
+//		Uint64("MsgID", schema.AutoIncrement()).
+//		Ref("User", "User", "ID").
+//		String("Text").
+//		String("Lang", schema.Default("en")).
+//		Build()
+type Builder struct {
+	schema *Schema
+	err    error
+}
+
+// FieldOption adds an attribute to a field declared through a Builder.
+type FieldOption func(*fieldSpec) error
+
+type fieldSpec struct {
+	kind  FieldKind
+	attrs []string
+}
+
+// New starts a Builder for a schema called name.
+func New(name string) *Builder {
+	return &Builder{schema: &Schema{Name: name}}
+}
+
+// AutoIncrement marks a uint64 field auto_increment.
+func AutoIncrement() FieldOption {
+	return Attribute("auto_increment")
+}
+
+// Unique marks the field unique.
+func Unique() FieldOption {
+	return Attribute("unique")
+}
+
+// Required marks the field required, so ValidatePayload reports rows without it.
+func Required() FieldOption {
+	return Attribute("required")
+}
+
+// Sensitive marks the field sensitive, so scrt-server masks it in JSON
+// responses to untrusted clients.
+func Sensitive() FieldOption {
+	return Attribute("sensitive")
+}
+
+// Enum limits a string field to values, as enum=a|b does in the DSL.
+func Enum(values ...string) FieldOption {
+	return Attribute("enum=" + strings.Join(values, "|"))
+}
+
+// Alias adds alternate struct field names, as alias=a;b does in the DSL.
+func Alias(names ...string) FieldOption {
+	return Attribute("alias=" + strings.Join(names, ";"))
+}
+
+// Attribute adds a raw DSL attribute such as "uuidv7".
+func Attribute(attr string) FieldOption {
+	return func(spec *fieldSpec) error {
+		spec.attrs = append(spec.attrs, attr)
+		return nil
+	}
+}
+
+// Default sets the field default. v is written as the DSL literal for the
+// field's type: strings, numbers, and bools as usual, time.Time for dates and
+// timestamps, time.Duration for durations and times of day, []byte for bytes
+// (hex), and uuid.UUID or its text for uuids.
+func Default(v any) FieldOption {
+	return func(spec *fieldSpec) error {
+		literal, err := defaultLiteral(spec.kind, v)
+		if err != nil {
+			return err
+		}
+		spec.attrs = append(spec.attrs, "default="+literal)
+		return nil
+	}
+}
+
+// DefaultFunc sets a default function, "now" or "uuid", evaluated whenever a
+// row is encoded without the field: now() for temporal fields and uuid() for
+// string and uuid fields.
+func DefaultFunc(name string) FieldOption {
+	return func(spec *fieldSpec) error {
+		spec.attrs = append(spec.attrs, "default="+name+"()")
+		return nil
+	}
+}
+
+// Uint64 adds a uint64 field.
+func (b *Builder) Uint64(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "uint64", opts...)
+}
+
+// Int64 adds an int64 field.
+func (b *Builder) Int64(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "int64", opts...)
+}
+
+// Float64 adds a float64 field.
+func (b *Builder) Float64(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "float64", opts...)
+}
+
+// Bool adds a bool field.
+func (b *Builder) Bool(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "bool", opts...)
+}
+
+// String adds a string field.
+func (b *Builder) String(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "string", opts...)
+}
+
+// Bytes adds a bytes field.
+func (b *Builder) Bytes(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "bytes", opts...)
+}
+
+// Date adds a date field.
+func (b *Builder) Date(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "date", opts...)
+}
+
+// DateTime adds a datetime field.
+func (b *Builder) DateTime(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "datetime", opts...)
+}
+
+// Timestamp adds a timestamp field.
+func (b *Builder) Timestamp(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "timestamp", opts...)
+}
+
+// TimestampTZ adds a timestamptz field.
+func (b *Builder) TimestampTZ(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "timestamptz", opts...)
+}
+
+// Duration adds a duration field.
+func (b *Builder) Duration(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "duration", opts...)
+}
+
+// Time adds a time-of-day field.
+func (b *Builder) Time(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "time", opts...)
+}
+
+// UUID adds a uuid field.
+func (b *Builder) UUID(name string, opts ...FieldOption) *Builder {
+	return b.Field(name, "uuid", opts...)
+}
+
+// List adds a list<elem> field; elem is "string" or "uint64".
+func (b *Builder) List(name, elem string, opts ...FieldOption) *Builder {
+	return b.Field(name, "list<"+elem+">", opts...)
+}
+
+// Ref adds a field referencing targetSchema.targetField.
+func (b *Builder) Ref(name, targetSchema, targetField string, opts ...FieldOption) *Builder {
+	return b.Field(name, "ref:"+targetSchema+":"+targetField, opts...)
+}
+
+// Field adds a field with a DSL type name such as "uint64" or "ref:User:ID".
+func (b *Builder) Field(name, typ string, opts ...FieldOption) *Builder {
+	if b.err != nil {
+		return b
+	}
+	spec := fieldSpec{}
+	// Parse the type alone first so options such as Default know the kind.
+	probe, err := newField(name, typ, nil)
+	if err != nil {
+		b.err = fmt.Errorf("scrt: schema %s field %s: %w", b.schema.Name, name, err)
+		return b
+	}
+	spec.kind = probe.ValueKind()
+	for _, opt := range opts {
+		if err := opt(&spec); err != nil {
+			b.err = fmt.Errorf("scrt: schema %s field %s: %w", b.schema.Name, name, err)
+			return b
+		}
+	}
+	field, err := newField(name, typ, spec.attrs)
+	if err != nil {
+		b.err = fmt.Errorf("scrt: schema %s field %s: %w", b.schema.Name, name, err)
+		return b
+	}
+	b.schema.Fields = append(b.schema.Fields, field)
+	return b
+}
+
+// Computed declares a read-only field derived by expr, as a @computed line
+// does in the DSL. The expression is checked against the fields by Build.
+func (b *Builder) Computed(name, expr string) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if err := addComputed(b.schema, name+" expr="+expr); err != nil {
+		b.err = fmt.Errorf("scrt: %w", err)
+	}
+	return b
+}
+
+// Build validates and returns the schema. It reports the first error from
+// any field, duplicate field names included. References are not checked
+// against their target; ref fields are treated as uint64 until a Document
+// resolves them.
+func (b *Builder) Build() (*Schema, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if strings.TrimSpace(b.schema.Name) == "" {
+		return nil, fmt.Errorf("scrt: schema name is required")
+	}
+	sch := b.schema
+	for i := range sch.Fields {
+		field := &sch.Fields[i]
+		if field.pendingDefault != "" && field.Default == nil {
+			def, err := parseDefaultLiteral(field.ValueKind(), field.EpochUnit, field.pendingDefault)
+			if err != nil {
+				return nil, fmt.Errorf("scrt: schema %s field %s default: %w", sch.Name, field.Name, err)
+			}
+			field.Default = def
+			field.pendingDefault = ""
+		}
+	}
+	if err := sch.Validate(); err != nil {
+		return nil, err
+	}
+	if err := bindComputed(sch); err != nil {
+		return nil, fmt.Errorf("scrt: %w", err)
+	}
+	b.schema = &Schema{
+		Name:     sch.Name,
+		Fields:   append([]Field(nil), sch.Fields...),
+		Computed: append([]ComputedField(nil), sch.Computed...),
+	}
+	return sch, nil
+}
+
+const dateTimeLiteralLayout = "2006-01-02 15:04:05"
+
+// defaultLiteral renders v as the DSL default literal for kind.
+func defaultLiteral(kind FieldKind, v any) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return strconv.Quote(val), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int:
+		return strconv.FormatInt(int64(val), 10), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case int32:
+		return strconv.FormatInt(int64(val), 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(val), 10), nil
+	case uint64:
+		return strconv.FormatUint(val, 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(val), 10), nil
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(val), 'g', -1, 32), nil
+	case []byte:
+		return "0x" + hex.EncodeToString(val), nil
+	case uuid.UUID:
+		return strconv.Quote(val.String()), nil
+	case time.Duration:
+		if kind == KindTime {
+			if err := temporal.CheckTimeOfDay(val); err != nil {
+				return "", err
+			}
+			return strconv.Quote(temporal.FormatTimeOfDay(val)), nil
+		}
+		return strconv.Quote(val.String()), nil
+	case time.Time:
+		switch kind {
+		case KindTime:
+			return strconv.Quote(temporal.FormatTimeOfDay(temporal.TimeOfDay(val))), nil
+		case KindDate:
+			return strconv.Quote(temporal.FormatDate(val)), nil
+		case KindDateTime:
+			// datetime literals carry no zone and no fractional seconds.
+			return strconv.Quote(val.UTC().Format(dateTimeLiteralLayout)), nil
+		case KindTimestampTZ:
+			return strconv.Quote(temporal.FormatTimestampTZ(val)), nil
+		default:
+			return strconv.Quote(temporal.FormatInstant(val)), nil
+		}
+	default:
+		return "", fmt.Errorf("unsupported default value %T", v)
+	}
+}
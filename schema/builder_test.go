@@ -0,0 +1,68 @@
+package schema_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+func TestBuilderMatchesDSLFingerprint(t *testing.T) {
+	const src = `@schema User
+@field ID uint64 auto_increment
+
+@schema Message
+@field MsgID uint64 auto_increment
+@field User ref:User:ID
+@field Text string unique
+@field Lang string default="en"
+@field "Sent On" date default="2025-01-02"
+@field Seen bool default=false
+@field TTL duration default="1h30m0s"
+@field Tags list<string> alias=Labels
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	parsed, _ := doc.Schema("Message")
+
+	built, err := schema.New("Message").
+		Uint64("MsgID", schema.AutoIncrement()).
+		Ref("User", "User", "ID").
+		String("Text", schema.Unique()).
+		String("Lang", schema.Default("en")).
+		Date("Sent On", schema.Default(time.Date(2025, time.January, 2, 0, 0, 0, 0, time.UTC))).
+		Bool("Seen", schema.Default(false)).
+		Duration("TTL", schema.Default(90*time.Minute)).
+		List("Tags", "string", schema.Alias("Labels")).
+		Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if built.Fingerprint() != parsed.Fingerprint() {
+		t.Fatalf("fingerprint mismatch: built %x, parsed %x", built.Fingerprint(), parsed.Fingerprint())
+	}
+	if !built.Fields[0].AutoIncrement || built.Fields[3].Default == nil || built.Fields[3].Default.String != "en" {
+		t.Fatalf("unexpected built fields %+v", built.Fields)
+	}
+	if built.Fields[1].TargetSchema != "User" || built.Fields[1].TargetField != "ID" {
+		t.Fatalf("unexpected ref field %+v", built.Fields[1])
+	}
+}
+
+func TestBuilderRejectsInvalidFields(t *testing.T) {
+	cases := map[string]*schema.Builder{
+		"duplicate name": schema.New("Dup").Uint64("ID").String("ID"),
+		"bad type":       schema.New("Bad").Field("ID", "uint128"),
+		"bad default":    schema.New("Bad").Int64("N", schema.Default("many")),
+		"auto on string": schema.New("Bad").String("ID", schema.AutoIncrement()),
+		"missing name":   schema.New("").Uint64("ID"),
+	}
+	for name, b := range cases {
+		if _, err := b.Build(); err == nil {
+			t.Fatalf("%s: expected Build to fail", name)
+		}
+	}
+}
@@ -29,7 +29,9 @@ func NewCache() *Cache {
 }
 
 // LoadFile parses schemas from path and caches them. Subsequent calls reuse the
-// cached version when the file has not changed.
+// cached version when the file has not changed; files pulled in by @include
+// are not watched. A gzipped file is decompressed, and Snapshot returns the
+// decompressed DSL.
 func (c *Cache) LoadFile(path string) (*Document, error) {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -44,12 +46,12 @@ func (c *Cache) LoadFile(path string) (*Document, error) {
 	}
 	c.mu.RUnlock()
 
-	data, err := os.ReadFile(path)
+	data, err := ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	parsed, err := Parse(bytes.NewReader(data))
+	parsed, err := parseSource(bytes.NewReader(data), path)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ValueCodec converts between rich Go values and the opaque bytes stored in
+// a bytes field declared with a codec=<name> attribute.
+type ValueCodec struct {
+	Encode func(any) ([]byte, error)
+	Decode func([]byte) (any, error)
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = make(map[string]ValueCodec)
+)
+
+// RegisterCodec makes c available to codec=<name> attributes. Names are case
+// insensitive; registering a name again replaces the earlier codec. Schemas
+// naming a codec must be parsed after it is registered.
+func RegisterCodec(name string, c ValueCodec) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return fmt.Errorf("schema: codec name required")
+	}
+	if c.Encode == nil || c.Decode == nil {
+		return fmt.Errorf("schema: codec %s needs both Encode and Decode", name)
+	}
+	codecMu.Lock()
+	codecs[name] = c
+	codecMu.Unlock()
+	return nil
+}
+
+// LookupCodec returns the codec registered under name.
+func LookupCodec(name string) (ValueCodec, bool) {
+	codecMu.RLock()
+	c, ok := codecs[strings.ToLower(name)]
+	codecMu.RUnlock()
+	return c, ok
+}
@@ -0,0 +1,451 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ComputedField is a read-only field derived from the stored fields of a row
+// by a small expression, declared with "@computed Name expr=...". It is never
+// written to pages and is left out of the fingerprint; decoders fill it in
+// when rows are read into maps or structs.
+//
+// Expressions are built from field names, integer, float, and double-quoted
+// string literals, parentheses, unary minus, and the operators + - * / %.
+// A + with a string on either side concatenates, formatting numbers as
+// decimal text; the other operators are arithmetic. Integer fields, refs,
+// and the temporal kinds, which store integers, take part as int64; floats
+// make the whole operation float64. A field name that is not a plain
+// identifier is written in backquotes.
+type ComputedField struct {
+	Name string
+	Expr string
+
+	expr exprNode
+}
+
+// Eval evaluates the expression. value returns the stored field at index
+// idx of the schema as an int64, uint64, float64, or string, or false when
+// the row leaves it unset. The result is a string, int64, or float64; it is
+// unset when any referenced field is, when a uint64 field holds a value
+// above math.MaxInt64, when a division or remainder is by zero, or when the
+// field was not bound by the parser or a Builder.
+func (c ComputedField) Eval(value func(idx int) (any, bool)) (any, bool) {
+	if c.expr == nil {
+		return nil, false
+	}
+	return c.expr.eval(value)
+}
+
+// Inputs returns the indexes of the stored fields the expression reads, in
+// order of first use.
+func (c ComputedField) Inputs() []int {
+	var out []int
+	var walk func(exprNode)
+	walk = func(n exprNode) {
+		switch n := n.(type) {
+		case *exprField:
+			if !slices.Contains(out, n.index) {
+				out = append(out, n.index)
+			}
+		case *exprNeg:
+			walk(n.x)
+		case *exprBinary:
+			walk(n.left)
+			walk(n.right)
+		}
+	}
+	if c.expr != nil {
+		walk(c.expr)
+	}
+	return out
+}
+
+// ComputedByName returns the computed field called name, if s declares one.
+func (s *Schema) ComputedByName(name string) (*ComputedField, bool) {
+	for i := range s.Computed {
+		if s.Computed[i].Name == name {
+			return &s.Computed[i], true
+		}
+	}
+	return nil, false
+}
+
+// addComputed records the "Name expr=..." argument of a @computed line on s.
+// The expression is bound to the fields once the schema is complete.
+func addComputed(s *Schema, arg string) error {
+	name, rest := arg, ""
+	if i := strings.IndexAny(arg, " \t"); i >= 0 {
+		name, rest = arg[:i], strings.TrimSpace(arg[i:])
+	}
+	expr, ok := strings.CutPrefix(rest, "expr=")
+	if name == "" || !ok || strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("@computed in schema %s must be Name expr=<expression>, got %q", s.Name, arg)
+	}
+	s.Computed = append(s.Computed, ComputedField{Name: name, Expr: strings.TrimSpace(expr)})
+	return nil
+}
+
+// bindComputed parses the expression of every computed field of s against
+// its stored fields. Names must be unique across stored and computed fields,
+// and expressions may read stored fields only.
+func bindComputed(s *Schema) error {
+	if len(s.Computed) == 0 {
+		return nil
+	}
+	fields := make(map[string]int, len(s.Fields))
+	for i, field := range s.Fields {
+		fields[field.Name] = i
+	}
+	seen := make(map[string]bool, len(s.Computed))
+	for i := range s.Computed {
+		c := &s.Computed[i]
+		if _, clash := fields[c.Name]; clash || seen[c.Name] {
+			return fmt.Errorf("schema %s: computed field %s duplicates another field", s.Name, c.Name)
+		}
+		seen[c.Name] = true
+		p := &exprParser{src: c.Expr, schema: s, fields: fields}
+		node, err := p.parse()
+		if err != nil {
+			return fmt.Errorf("schema %s: computed field %s: %w", s.Name, c.Name, err)
+		}
+		c.expr = node
+	}
+	return nil
+}
+
+type exprNode interface {
+	eval(value func(idx int) (any, bool)) (any, bool)
+}
+
+type exprLiteral struct{ value any }
+
+type exprField struct{ index int }
+
+type exprNeg struct{ x exprNode }
+
+type exprBinary struct {
+	op          byte
+	left, right exprNode
+}
+
+func (n *exprLiteral) eval(func(int) (any, bool)) (any, bool) {
+	return n.value, true
+}
+
+func (n *exprField) eval(value func(int) (any, bool)) (any, bool) {
+	v, ok := value(n.index)
+	if !ok {
+		return nil, false
+	}
+	if u, isUint := v.(uint64); isUint {
+		if u > math.MaxInt64 {
+			// No int64 holds it, and float64 would round it silently.
+			return nil, false
+		}
+		return int64(u), true
+	}
+	return v, true
+}
+
+func (n *exprNeg) eval(value func(int) (any, bool)) (any, bool) {
+	v, ok := n.x.eval(value)
+	if !ok {
+		return nil, false
+	}
+	switch v := v.(type) {
+	case int64:
+		return -v, true
+	case float64:
+		return -v, true
+	}
+	return nil, false
+}
+
+func (n *exprBinary) eval(value func(int) (any, bool)) (any, bool) {
+	l, ok := n.left.eval(value)
+	if !ok {
+		return nil, false
+	}
+	r, ok := n.right.eval(value)
+	if !ok {
+		return nil, false
+	}
+	_, ls := l.(string)
+	_, rs := r.(string)
+	if ls || rs {
+		if n.op != '+' {
+			return nil, false
+		}
+		return exprText(l) + exprText(r), true
+	}
+	li, lint := l.(int64)
+	ri, rint := r.(int64)
+	if lint && rint {
+		switch n.op {
+		case '+':
+			return li + ri, true
+		case '-':
+			return li - ri, true
+		case '*':
+			return li * ri, true
+		case '/':
+			if ri == 0 {
+				return nil, false
+			}
+			return li / ri, true
+		default:
+			if ri == 0 {
+				return nil, false
+			}
+			return li % ri, true
+		}
+	}
+	lf, rf := exprFloat(l), exprFloat(r)
+	switch n.op {
+	case '+':
+		return lf + rf, true
+	case '-':
+		return lf - rf, true
+	case '*':
+		return lf * rf, true
+	case '/':
+		if rf == 0 {
+			return nil, false
+		}
+		return lf / rf, true
+	default:
+		if rf == 0 {
+			return nil, false
+		}
+		return math.Mod(lf, rf), true
+	}
+}
+
+func exprText(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return ""
+}
+
+func exprFloat(v any) float64 {
+	if i, ok := v.(int64); ok {
+		return float64(i)
+	}
+	f, _ := v.(float64)
+	return f
+}
+
+// exprType is what an expression is known to yield before any row is read.
+// References yield exprAny, since their kind is settled only when the
+// document resolves them.
+type exprType uint8
+
+const (
+	exprAny exprType = iota
+	exprNumber
+	exprString
+)
+
+// exprParser is a recursive-descent parser over
+//
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/" | "%") unary }
+//	unary   = "-" unary | operand
+//	operand = number | string | name | "(" sum ")"
+type exprParser struct {
+	src    string
+	pos    int
+	schema *Schema
+	fields map[string]int
+}
+
+func (p *exprParser) parse() (exprNode, error) {
+	node, _, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.src[p.pos:], p.pos)
+	}
+	return node, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// next returns the operator at the cursor if it is one of ops.
+func (p *exprParser) next(ops string) (byte, bool) {
+	p.skipSpace()
+	if p.pos < len(p.src) && strings.IndexByte(ops, p.src[p.pos]) >= 0 {
+		op := p.src[p.pos]
+		p.pos++
+		return op, true
+	}
+	return 0, false
+}
+
+func (p *exprParser) sum() (exprNode, exprType, error) {
+	left, lt, err := p.product()
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		op, ok := p.next("+-")
+		if !ok {
+			return left, lt, nil
+		}
+		right, rt, err := p.product()
+		if err != nil {
+			return nil, 0, err
+		}
+		switch {
+		case op == '-' && (lt == exprString || rt == exprString):
+			return nil, 0, fmt.Errorf("operator - needs numbers, not strings")
+		case lt == exprString || rt == exprString:
+			lt = exprString
+		case lt == exprNumber && rt == exprNumber:
+		default:
+			lt = exprAny
+		}
+		left = &exprBinary{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) product() (exprNode, exprType, error) {
+	left, lt, err := p.unary()
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		op, ok := p.next("*/%")
+		if !ok {
+			return left, lt, nil
+		}
+		right, rt, err := p.unary()
+		if err != nil {
+			return nil, 0, err
+		}
+		if lt == exprString || rt == exprString {
+			return nil, 0, fmt.Errorf("operator %c needs numbers, not strings", op)
+		}
+		if lt != exprNumber || rt != exprNumber {
+			lt = exprAny
+		}
+		left = &exprBinary{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) unary() (exprNode, exprType, error) {
+	if _, ok := p.next("-"); ok {
+		x, t, err := p.unary()
+		if err != nil {
+			return nil, 0, err
+		}
+		if t == exprString {
+			return nil, 0, fmt.Errorf("unary - needs a number, not a string")
+		}
+		return &exprNeg{x: x}, t, nil
+	}
+	return p.operand()
+}
+
+func (p *exprParser) operand() (exprNode, exprType, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, 0, fmt.Errorf("expression ends early")
+	}
+	rest := p.src[p.pos:]
+	switch c := rest[0]; {
+	case c == '(':
+		p.pos++
+		node, t, err := p.sum()
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, ok := p.next(")"); !ok {
+			return nil, 0, fmt.Errorf("missing ) at offset %d", p.pos)
+		}
+		return node, t, nil
+	case c == '"':
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid string literal at offset %d", p.pos)
+		}
+		text, _ := strconv.Unquote(quoted)
+		p.pos += len(quoted)
+		return &exprLiteral{value: text}, exprString, nil
+	case c >= '0' && c <= '9' || c == '.':
+		n := 0
+		for n < len(rest) && (isExprDigit(rest[n]) || rest[n] == '.' ||
+			(rest[n] == 'e' || rest[n] == 'E') ||
+			((rest[n] == '+' || rest[n] == '-') && n > 0 && (rest[n-1] == 'e' || rest[n-1] == 'E'))) {
+			n++
+		}
+		lit := rest[:n]
+		p.pos += n
+		if i, err := strconv.ParseInt(lit, 10, 64); err == nil {
+			return &exprLiteral{value: i}, exprNumber, nil
+		}
+		f, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid number %q", lit)
+		}
+		return &exprLiteral{value: f}, exprNumber, nil
+	case c == '`':
+		end := strings.IndexByte(rest[1:], '`')
+		if end < 0 {
+			return nil, 0, fmt.Errorf("unterminated field name at offset %d", p.pos)
+		}
+		p.pos += end + 2
+		return p.field(rest[1 : end+1])
+	case isExprNameStart(c):
+		n := 1
+		for n < len(rest) && (isExprNameStart(rest[n]) || isExprDigit(rest[n])) {
+			n++
+		}
+		p.pos += n
+		return p.field(rest[:n])
+	default:
+		return nil, 0, fmt.Errorf("unexpected %q at offset %d", c, p.pos)
+	}
+}
+
+func (p *exprParser) field(name string) (exprNode, exprType, error) {
+	idx, ok := p.fields[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown field %q (expressions read stored fields only)", name)
+	}
+	field := p.schema.Fields[idx]
+	switch field.Kind {
+	case KindString, KindTimestampTZ:
+		return &exprField{index: idx}, exprString, nil
+	case KindUint64, KindInt64, KindFloat64, KindDate, KindDateTime, KindTimestamp, KindDuration, KindTime:
+		return &exprField{index: idx}, exprNumber, nil
+	case KindRef:
+		return &exprField{index: idx}, exprAny, nil
+	default:
+		return nil, 0, fmt.Errorf("field %s of type %s cannot be used in an expression", name, field.RawType)
+	}
+}
+
+func isExprDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isExprNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
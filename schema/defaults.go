@@ -8,11 +8,15 @@ import (
 	"strings"
 
 	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
 )
 
-// DefaultValue keeps the typed literal configured for a field.
+// DefaultValue keeps the typed literal configured for a field. When Func is
+// set the default is a function, "now" or "uuid", evaluated each time a row
+// is encoded with the field unset, and the literal fields are unused.
 type DefaultValue struct {
 	Kind   FieldKind
+	Func   string
 	Bool   bool
 	Int    int64
 	Uint   uint64
@@ -25,6 +29,10 @@ func (d *DefaultValue) hashKey() string {
 	if d == nil {
 		return ""
 	}
+	if d.Func != "" {
+		// The expression is part of the schema; its results are not.
+		return "func:" + d.Func + "()"
+	}
 	switch d.Kind {
 	case KindBool:
 		if d.Bool {
@@ -49,18 +57,30 @@ func (d *DefaultValue) hashKey() string {
 		return fmt.Sprintf("timestamp:%d", d.Int)
 	case KindDuration:
 		return fmt.Sprintf("duration:%d", d.Int)
+	case KindTime:
+		return fmt.Sprintf("time:%d", d.Int)
 	case KindTimestampTZ:
 		return fmt.Sprintf("timestamptz:%s", d.String)
+	case KindUUID:
+		return fmt.Sprintf("uuid:%s", uuid.FormatBytes(d.Bytes))
 	default:
 		return ""
 	}
 }
 
-func parseDefaultLiteral(kind FieldKind, raw string) (*DefaultValue, error) {
+// Dynamic reports whether d is a default function rather than a literal.
+func (d *DefaultValue) Dynamic() bool {
+	return d != nil && d.Func != ""
+}
+
+func parseDefaultLiteral(kind FieldKind, unit temporal.EpochUnit, raw string) (*DefaultValue, error) {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
 		return nil, fmt.Errorf("default value missing literal")
 	}
+	if name, ok := defaultFuncName(raw); ok {
+		return parseDefaultFunc(kind, name)
+	}
 	val := &DefaultValue{Kind: kind}
 	switch kind {
 	case KindBool:
@@ -124,7 +144,7 @@ func parseDefaultLiteral(kind FieldKind, raw string) (*DefaultValue, error) {
 		if err != nil {
 			return nil, err
 		}
-		t, err := temporal.ParseTimestamp(unquoted)
+		t, err := temporal.ParseTimestampUnit(unquoted, unit)
 		if err != nil {
 			return nil, err
 		}
@@ -149,12 +169,65 @@ func parseDefaultLiteral(kind FieldKind, raw string) (*DefaultValue, error) {
 			return nil, err
 		}
 		val.Int = int64(dur)
+	case KindTime:
+		unquoted, err := parseStringLiteral(raw)
+		if err != nil {
+			return nil, err
+		}
+		tod, err := temporal.ParseTimeOfDay(unquoted)
+		if err != nil {
+			return nil, err
+		}
+		val.Int = int64(tod)
+	case KindUUID:
+		unquoted, err := parseStringLiteral(raw)
+		if err != nil {
+			return nil, err
+		}
+		id, err := uuid.Parse(unquoted)
+		if err != nil {
+			return nil, err
+		}
+		val.Bytes = id[:]
 	default:
 		return nil, fmt.Errorf("defaults not supported for kind %d", kind)
 	}
 	return val, nil
 }
 
+// defaultFuncName reports whether raw is a bare call such as now(). Quoted
+// literals are never calls, so default="now()" stays a string.
+func defaultFuncName(raw string) (string, bool) {
+	name, ok := strings.CutSuffix(raw, "()")
+	if !ok || name == "" {
+		return "", false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "", false
+		}
+	}
+	return strings.ToLower(name), true
+}
+
+func parseDefaultFunc(kind FieldKind, name string) (*DefaultValue, error) {
+	switch name {
+	case "now":
+		switch kind {
+		case KindDate, KindDateTime, KindTimestamp, KindTimestampTZ:
+		default:
+			return nil, fmt.Errorf("default now() requires a date, datetime, timestamp, or timestamptz field")
+		}
+	case "uuid":
+		if kind != KindString && kind != KindUUID {
+			return nil, fmt.Errorf("default uuid() requires a string or uuid field")
+		}
+	default:
+		return nil, fmt.Errorf("unknown default function %s()", name)
+	}
+	return &DefaultValue{Kind: kind, Func: name}, nil
+}
+
 func parseStringLiteral(raw string) (string, error) {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
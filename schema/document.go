@@ -1,10 +1,21 @@
 package schema
 
+import (
+	"fmt"
+	"iter"
+	"maps"
+)
+
 // Document is the top-level container for schemas parsed from a .scrt file.
 type Document struct {
 	Schemas map[string]*Schema
 	Data    map[string][]map[string]interface{} // schema name -> rows
 	Source  string
+
+	raw []byte // DSL source retained by Parse
+	// rows holds the inline data rows parsed at load for DataRows. It is
+	// kept apart from Data so ClearData leaves it in place.
+	rows map[string][]map[string]interface{}
 }
 
 // Schema returns a schema by name.
@@ -24,3 +35,32 @@ func (d *Document) Records(name string) ([]map[string]interface{}, bool) {
 	records, ok := d.Data[name]
 	return records, ok
 }
+
+// ClearData drops any parsed inline data rows while keeping the schemas.
+func (d *Document) ClearData() {
+	if d == nil {
+		return
+	}
+	d.Data = make(map[string][]map[string]interface{})
+}
+
+// DataRows returns an iterator over the inline data rows for schemaName, as
+// parsed once when the document was loaded. Each row is yielded as a copy,
+// and the rows stay available after ClearData. Documents produced by
+// ParseSchemaOnly parse no rows and report an error.
+func (d *Document) DataRows(schemaName string) (iter.Seq2[map[string]interface{}, error], error) {
+	if d == nil || d.rows == nil {
+		return nil, fmt.Errorf("scrt: document has no parsed data rows")
+	}
+	if _, ok := d.Schemas[schemaName]; !ok {
+		return nil, fmt.Errorf("scrt: schema %s not found", schemaName)
+	}
+	rows := d.rows[schemaName]
+	return func(yield func(map[string]interface{}, error) bool) {
+		for _, row := range rows {
+			if !yield(maps.Clone(row), nil) {
+				return
+			}
+		}
+	}, nil
+}
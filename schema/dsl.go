@@ -0,0 +1,223 @@
+package schema
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
+)
+
+// WriteDSL writes the schema as a @schema block with one @field line per
+// field. Attributes keep their declared order, and defaults are rendered from
+// the typed DefaultValue in a literal whose lowercase form matches the
+// declared one, so parsing the output yields the same fingerprint. Schemas
+// assembled as struct literals without Attributes gain auto_increment and
+// default attributes for their AutoIncrement and Default settings.
+func (s *Schema) WriteDSL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	writeSchemaDSL(bw, s)
+	return bw.Flush()
+}
+
+// WriteDSL writes every schema of the document, ordered by name and separated
+// by blank lines. Data sections are not written.
+func (d *Document) WriteDSL(w io.Writer) error {
+	if d == nil {
+		return nil
+	}
+	names := make([]string, 0, len(d.Schemas))
+	for name := range d.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for i, name := range names {
+		if i > 0 {
+			bw.WriteByte('\n')
+		}
+		writeSchemaDSL(bw, d.Schemas[name])
+	}
+	return bw.Flush()
+}
+
+func writeSchemaDSL(w *bufio.Writer, s *Schema) {
+	w.WriteString("@schema ")
+	w.WriteString(s.Name)
+	w.WriteByte('\n')
+	writeDocDSL(w, s.Doc)
+	keys := make([]string, 0, len(s.Metadata))
+	for key := range s.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.WriteString("@meta ")
+		w.WriteString(key)
+		w.WriteByte('=')
+		w.WriteString(dslMetaValue(s.Metadata[key]))
+		w.WriteByte('\n')
+	}
+	if s.RowsPerPage > 0 {
+		w.WriteString("@pragma rows_per_page=")
+		w.WriteString(strconv.Itoa(s.RowsPerPage))
+		w.WriteByte('\n')
+	}
+	for i := range s.Fields {
+		field := &s.Fields[i]
+		w.WriteString("@field ")
+		w.WriteString(dslFieldName(field.Name))
+		w.WriteByte(' ')
+		w.WriteString(field.RawType)
+		for _, attr := range dslAttributes(field) {
+			w.WriteByte(' ')
+			w.WriteString(attr)
+		}
+		w.WriteByte('\n')
+		writeDocDSL(w, field.Doc)
+	}
+	for _, c := range s.Computed {
+		w.WriteString("@computed ")
+		w.WriteString(c.Name)
+		w.WriteString(" expr=")
+		w.WriteString(c.Expr)
+		w.WriteByte('\n')
+	}
+}
+
+// writeDocDSL writes doc as a quoted @doc line, if there is one.
+func writeDocDSL(w *bufio.Writer, doc string) {
+	if doc == "" {
+		return
+	}
+	w.WriteString("@doc ")
+	w.WriteString(strconv.Quote(doc))
+	w.WriteByte('\n')
+}
+
+// dslMetaValue quotes @meta values that would not read back unchanged.
+func dslMetaValue(value string) string {
+	if value == "" || value != strings.TrimSpace(value) || strings.ContainsAny(value, "#\"\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// dslFieldName quotes names that would not survive splitFieldParts as a
+// bare token, picking a quote character the name does not contain.
+func dslFieldName(name string) string {
+	if name != "" && !strings.ContainsAny(name, " \t\"'`") {
+		return name
+	}
+	for _, q := range []string{`"`, "'", "`"} {
+		if !strings.Contains(name, q) {
+			return q + name + q
+		}
+	}
+	return name
+}
+
+// dslAttributes restores field's attributes with their original case where
+// the parser lowercased them: default literals come from the typed default
+// and alias names from Aliases.
+func dslAttributes(field *Field) []string {
+	var (
+		out      []string
+		aliases  = field.Aliases
+		sawAuto  bool
+		sawValue bool
+	)
+	for _, attr := range field.Attributes {
+		switch {
+		case attr == "auto_increment" || attr == "autoincrement" || attr == "serial":
+			sawAuto = true
+			out = append(out, attr)
+		case strings.HasPrefix(attr, "default=") || strings.HasPrefix(attr, "default:"):
+			sawValue = true
+			prefix, stored := attr[:len("default=")], attr[len("default="):]
+			out = append(out, restoreCase(prefix, stored, defaultLiterals(field.Default)...))
+		case strings.HasPrefix(attr, "alias="):
+			n := strings.Count(attr, ";") + 1
+			if n > len(aliases) {
+				out = append(out, attr)
+				continue
+			}
+			out = append(out, restoreCase("alias=", attr[len("alias="):], strings.Join(aliases[:n], ";")))
+			aliases = aliases[n:]
+		default:
+			out = append(out, attr)
+		}
+	}
+	if field.AutoIncrement && !sawAuto {
+		out = append(out, "auto_increment")
+	}
+	if field.Default != nil && !sawValue {
+		if literals := defaultLiterals(field.Default); len(literals) > 0 {
+			out = append(out, "default="+literals[0])
+		}
+	}
+	return out
+}
+
+// restoreCase returns prefix followed by the first candidate that lowercases
+// to stored and reads back as a single attribute, or by stored itself.
+func restoreCase(prefix, stored string, candidates ...string) string {
+	for _, candidate := range candidates {
+		if strings.ToLower(candidate) != stored {
+			continue
+		}
+		attr := prefix + candidate
+		if parts, err := splitFieldAttributes(attr); err == nil && len(parts) == 1 && parts[0] == attr {
+			return attr
+		}
+	}
+	return prefix + stored
+}
+
+// defaultLiterals renders def as DSL literals: the double-quoted form first,
+// then raw-string and bare forms for kinds that accept text.
+func defaultLiterals(def *DefaultValue) []string {
+	if def == nil {
+		return nil
+	}
+	if def.Func != "" {
+		return []string{def.Func + "()"}
+	}
+	var text string
+	switch def.Kind {
+	case KindBool:
+		return []string{strconv.FormatBool(def.Bool)}
+	case KindInt64:
+		return []string{strconv.FormatInt(def.Int, 10)}
+	case KindUint64, KindRef:
+		return []string{strconv.FormatUint(def.Uint, 10)}
+	case KindFloat64:
+		return []string{strconv.FormatFloat(def.Float, 'g', -1, 64)}
+	case KindBytes:
+		return []string{"0x" + hex.EncodeToString(def.Bytes), strconv.Quote(string(def.Bytes)), string(def.Bytes)}
+	case KindString:
+		text = def.String
+	case KindDate:
+		text = temporal.FormatDate(temporal.DecodeDate(def.Int))
+	case KindDateTime:
+		text = temporal.DecodeInstant(def.Int).Format(dateTimeLiteralLayout)
+	case KindTimestamp:
+		text = temporal.FormatInstant(temporal.DecodeInstant(def.Int))
+	case KindTimestampTZ:
+		text = def.String
+	case KindDuration:
+		text = time.Duration(def.Int).String()
+	case KindTime:
+		text = temporal.FormatTimeOfDay(time.Duration(def.Int))
+	case KindUUID:
+		text = uuid.FormatBytes(def.Bytes)
+	default:
+		return nil
+	}
+	return []string{strconv.Quote(text), "`" + text + "`", text}
+}
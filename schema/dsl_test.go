@@ -0,0 +1,89 @@
+package schema_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+func TestWriteDSLRoundTripsFingerprints(t *testing.T) {
+	sources := map[string]string{
+		"defaults": `@schema Event
+@field ID uint64 auto_increment
+@field "Full Name" string default="Jane Q Public" alias=FullName;Owner
+@field Code string default=AbC unique
+@field Raw string default=` + "`Mixed Case`" + `
+@field Day date default="2025-03-04"
+@field At datetime default="2025-03-04 05:06:07"
+@field Seen timestamp default="2025-03-04T05:06:07.123Z"
+@field Zoned timestamptz default="2025-03-04T05:06:07+02:00"
+@field TTL duration default=1h30m
+@field Key uuid default="0190b2c4-8a9e-7c1d-9f00-1a2b3c4d5e6f"
+@field Blob bytes default=0xCAFE
+@field Ratio float64 default=1e3
+@field Live bool default=TRUE
+@field Tags list<string>
+@field Owner ref:User:ID default=7
+
+@schema User
+@field ID uint64 serial
+`,
+	}
+	for _, path := range []string{"../schemas/User.scrt", "../data.scrt", "../examples/unmarshal_file/data.scrt"} {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		sources[filepath.Base(filepath.Dir(path))+"/"+filepath.Base(path)] = string(src)
+	}
+
+	for name, src := range sources {
+		doc, err := schema.Parse(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", name, err)
+		}
+		var out bytes.Buffer
+		if err := doc.WriteDSL(&out); err != nil {
+			t.Fatalf("%s: WriteDSL: %v", name, err)
+		}
+		again, err := schema.Parse(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: reparse: %v\n%s", name, err, out.String())
+		}
+		if len(again.Schemas) != len(doc.Schemas) {
+			t.Fatalf("%s: expected %d schemas, got %d", name, len(doc.Schemas), len(again.Schemas))
+		}
+		for schemaName, sch := range doc.Schemas {
+			other, ok := again.Schema(schemaName)
+			if !ok || other.Fingerprint() != sch.Fingerprint() {
+				t.Fatalf("%s: schema %s fingerprint changed\n%s", name, schemaName, out.String())
+			}
+			for i, field := range sch.Fields {
+				if !reflect.DeepEqual(field.Default, other.Fields[i].Default) {
+					t.Fatalf("%s: %s.%s default changed: %+v vs %+v", name, schemaName, field.Name, field.Default, other.Fields[i].Default)
+				}
+			}
+		}
+	}
+
+	doc, _ := schema.Parse(strings.NewReader(sources["defaults"]))
+	event, _ := doc.Schema("Event")
+	var out bytes.Buffer
+	if err := event.WriteDSL(&out); err != nil {
+		t.Fatalf("WriteDSL: %v", err)
+	}
+	for _, want := range []string{
+		`@field "Full Name" string default="Jane Q Public" alias=FullName;Owner`,
+		`@field Day date default="2025-03-04"`,
+		`@field Code string default=AbC unique`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Fatalf("missing line %q in\n%s", want, out.String())
+		}
+	}
+}
@@ -1,20 +1,79 @@
 package schema
 
 import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 )
 
-// ParseFile loads and parses a schema document from disk.
+// gzipMagic opens every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ParseFile loads and parses a schema document from disk. @include paths are
+// resolved relative to the file and must stay inside its directory. Gzipped
+// files are decompressed first.
 func ParseFile(path string) (*Document, error) {
-	f, err := os.Open(path)
+	data, err := ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	doc, err := Parse(f)
+	doc, err := parseSource(bytes.NewReader(data), path)
 	if err != nil {
 		return nil, err
 	}
 	doc.Source = path
 	return doc, nil
 }
+
+// ReadFile returns the contents of path, decompressed when the file starts
+// with the gzip magic bytes. Detection looks at the content only, so a
+// plain file named .gz is returned as stored, and a gzipped file is
+// decompressed once whatever its name.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decompressFile(path, data)
+}
+
+// readLocalFile is ReadFile for name inside dir, refusing paths that leave
+// dir, whether by .. elements or by symlinks.
+func readLocalFile(dir, name string) ([]byte, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	file, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return decompressFile(filepath.Join(dir, name), data)
+}
+
+// decompressFile returns data, read from path, gunzipped when it starts
+// with the gzip magic bytes.
+func decompressFile(path string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("scrt: %s: %w", path, err)
+	}
+	defer zr.Close()
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("scrt: %s: %w", path, err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,151 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// jsonSchemaDialect is the $schema URI JSONSchema declares.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// jsonSchemaType is the JSON Schema of one field value.
+type jsonSchemaType struct {
+	Description     string          `json:"description,omitempty"`
+	Type            string          `json:"type,omitempty"`
+	Format          string          `json:"format,omitempty"`
+	ContentEncoding string          `json:"contentEncoding,omitempty"`
+	Minimum         json.Number     `json:"minimum,omitempty"`
+	Maximum         json.Number     `json:"maximum,omitempty"`
+	Enum            []string        `json:"enum,omitempty"`
+	Items           *jsonSchemaType `json:"items,omitempty"`
+	ReadOnly        bool            `json:"readOnly,omitempty"`
+}
+
+type jsonSchemaProperty struct {
+	name string
+	typ  jsonSchemaType
+}
+
+// jsonSchemaProperties encodes as an object whose keys keep field order.
+type jsonSchemaProperties []jsonSchemaProperty
+
+func (p jsonSchemaProperties) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(prop.name)
+		if err != nil {
+			return nil, err
+		}
+		typ, err := json.Marshal(prop.typ)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(typ)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type jsonSchemaDocument struct {
+	Schema      string               `json:"$schema"`
+	Title       string               `json:"title"`
+	Description string               `json:"description,omitempty"`
+	Type        string               `json:"type"`
+	Properties  jsonSchemaProperties `json:"properties"`
+	Required    []string             `json:"required,omitempty"`
+}
+
+// JSONSchema describes one record of s, in the JSON form scrt.FromJSON
+// accepts and scrt.ToJSON produces, as a draft 2020-12 JSON Schema.
+// Properties keep field order and fields with the required attribute are
+// listed as required. Integers carry their range, enum fields list their
+// values, reference fields take the kind of the field they resolve to,
+// bytes are base64 strings, and temporal fields are strings, with format
+// date or date-time where one applies. Fields with a codec= attribute
+// carry whatever their codec decodes to, so they are left unconstrained.
+// @doc text becomes the description of the record or property. Computed
+// fields follow the stored ones as readOnly properties of any type.
+func (s *Schema) JSONSchema() ([]byte, error) {
+	doc := jsonSchemaDocument{
+		Schema:      jsonSchemaDialect,
+		Title:       s.Name,
+		Description: s.Doc,
+		Type:        "object",
+		Properties:  make(jsonSchemaProperties, 0, len(s.Fields)),
+	}
+	for _, field := range s.Fields {
+		typ, err := fieldJSONSchema(field)
+		if err != nil {
+			return nil, fmt.Errorf("scrt: schema %s field %s: %w", s.Name, field.Name, err)
+		}
+		typ.Description = field.Doc
+		doc.Properties = append(doc.Properties, jsonSchemaProperty{name: field.Name, typ: typ})
+		if field.HasAttribute("required") {
+			doc.Required = append(doc.Required, field.Name)
+		}
+	}
+	for _, c := range s.Computed {
+		doc.Properties = append(doc.Properties, jsonSchemaProperty{name: c.Name, typ: jsonSchemaType{ReadOnly: true}})
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func fieldJSONSchema(field Field) (jsonSchemaType, error) {
+	if field.Codec != "" {
+		return jsonSchemaType{}, nil
+	}
+	kind := field.ValueKind()
+	if kind == KindList {
+		elem, err := kindJSONSchema(field.ElemKind)
+		if err != nil {
+			return jsonSchemaType{}, err
+		}
+		return jsonSchemaType{Type: "array", Items: &elem}, nil
+	}
+	typ, err := kindJSONSchema(kind)
+	if err != nil {
+		return jsonSchemaType{}, err
+	}
+	if len(field.Enum) > 0 {
+		typ.Enum = field.Enum
+	}
+	return typ, nil
+}
+
+func kindJSONSchema(kind FieldKind) (jsonSchemaType, error) {
+	switch kind {
+	case KindUint64:
+		return jsonSchemaType{Type: "integer", Minimum: "0", Maximum: json.Number(strconv.FormatUint(math.MaxUint64, 10))}, nil
+	case KindInt64:
+		return jsonSchemaType{Type: "integer", Minimum: json.Number(strconv.FormatInt(math.MinInt64, 10)), Maximum: json.Number(strconv.FormatInt(math.MaxInt64, 10))}, nil
+	case KindFloat64:
+		return jsonSchemaType{Type: "number"}, nil
+	case KindBool:
+		return jsonSchemaType{Type: "boolean"}, nil
+	case KindString, KindDuration, KindTime:
+		return jsonSchemaType{Type: "string"}, nil
+	case KindBytes:
+		return jsonSchemaType{Type: "string", ContentEncoding: "base64"}, nil
+	case KindDate:
+		return jsonSchemaType{Type: "string", Format: "date"}, nil
+	case KindDateTime:
+		// Datetimes travel without a zone (2025-06-01T10:30:00), which
+		// format: date-time, RFC 3339's date-time, would reject.
+		return jsonSchemaType{Type: "string"}, nil
+	case KindTimestamp, KindTimestampTZ:
+		return jsonSchemaType{Type: "string", Format: "date-time"}, nil
+	case KindUUID:
+		return jsonSchemaType{Type: "string", Format: "uuid"}, nil
+	default:
+		return jsonSchemaType{}, fmt.Errorf("no JSON Schema type for kind %d", kind)
+	}
+}
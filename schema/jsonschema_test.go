@@ -0,0 +1,113 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+func TestJSONSchemaIncident(t *testing.T) {
+	const dsl = `@schema:Incident
+@field IncidentID uint64 serial
+@field Title string required
+@field Severity string enum=low|high required
+@field Started datetime
+@field Alerted timestamptz
+@field Resolved timestamp
+@field ReportDate date
+@field SLA duration
+@field Owner ref:User:ID
+@field Attachment bytes
+
+@schema:User
+@field ID uint64 serial
+`
+	doc, err := schema.Parse(strings.NewReader(dsl))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, ok := doc.Schema("Incident")
+	if !ok {
+		t.Fatal("Incident schema missing")
+	}
+	got, err := sch.JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema: %v", err)
+	}
+	const want = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "Incident",
+  "type": "object",
+  "properties": {
+    "IncidentID": {"type": "integer", "minimum": 0, "maximum": 18446744073709551615},
+    "Title": {"type": "string"},
+    "Severity": {"type": "string", "enum": ["low", "high"]},
+    "Started": {"type": "string"},
+    "Alerted": {"type": "string", "format": "date-time"},
+    "Resolved": {"type": "string", "format": "date-time"},
+    "ReportDate": {"type": "string", "format": "date"},
+    "SLA": {"type": "string"},
+    "Owner": {"type": "integer", "minimum": 0, "maximum": 18446744073709551615},
+    "Attachment": {"type": "string", "contentEncoding": "base64"}
+  },
+  "required": ["Title", "Severity"]
+}`
+	if compactJSON(t, got) != compactJSON(t, []byte(want)) {
+		t.Fatalf("unexpected JSON Schema:\n%s", got)
+	}
+}
+
+func TestJSONSchemaKinds(t *testing.T) {
+	sch := &schema.Schema{Name: "Kinds", Fields: []schema.Field{
+		{Name: "Delta", Kind: schema.KindInt64, RawType: "int64"},
+		{Name: "Score", Kind: schema.KindFloat64, RawType: "float64"},
+		{Name: "Active", Kind: schema.KindBool, RawType: "bool"},
+		{Name: "Token", Kind: schema.KindUUID, RawType: "uuid"},
+		{Name: "Tags", Kind: schema.KindList, ElemKind: schema.KindString, RawType: "list<string>"},
+		{Name: "Opens", Kind: schema.KindTime, RawType: "time"},
+	}}
+	got, err := sch.JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema: %v", err)
+	}
+	var decoded struct {
+		Properties map[string]map[string]any `json:"properties"`
+		Required   []string                  `json:"required"`
+	}
+	if err := json.Unmarshal(got, &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.Required != nil {
+		t.Fatalf("expected no required fields, got %v", decoded.Required)
+	}
+	for name, want := range map[string]string{
+		"Delta": "integer", "Score": "number", "Active": "boolean", "Token": "string", "Tags": "array", "Opens": "string",
+	} {
+		if got := decoded.Properties[name]["type"]; got != want {
+			t.Fatalf("%s: expected type %s, got %v", name, want, got)
+		}
+	}
+	if min := decoded.Properties["Delta"]["minimum"]; min != float64(-9223372036854775808) {
+		t.Fatalf("Delta: unexpected minimum %v", min)
+	}
+	if items := decoded.Properties["Tags"]["items"]; items.(map[string]any)["type"] != "string" {
+		t.Fatalf("Tags: unexpected items %v", items)
+	}
+	if format := decoded.Properties["Token"]["format"]; format != "uuid" {
+		t.Fatalf("Token: unexpected format %v", format)
+	}
+}
+
+// compactJSON strips insignificant whitespace, keeping key order and
+// number literals as written.
+func compactJSON(t *testing.T, data []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, data)
+	}
+	return buf.String()
+}
@@ -2,26 +2,291 @@ package schema
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
 )
 
-// Parse reads schema definitions from the SCRT DSL.
+// Parse reads schema definitions from the SCRT DSL. The source has no
+// directory to resolve @include against, so it fails with
+// ErrIncludeNotAllowed; use ParseFile for documents that include others.
 func Parse(r io.Reader) (*Document, error) {
-	scanner := bufio.NewScanner(r)
+	return parseSource(r, "")
+}
+
+// parseSource parses r, resolving @include directives inside the directory of
+// path when it names the file r was read from, and rejecting them otherwise.
+func parseSource(r io.Reader, path string) (*Document, error) {
+	var raw bytes.Buffer
+	doc, err := parseDocument(io.TeeReader(r, &raw), collectDataRow, path)
+	if err != nil {
+		return nil, err
+	}
+	doc.raw = raw.Bytes()
+	doc.rows = maps.Clone(doc.Data)
+	return doc, nil
+}
+
+// ParseSchemaOnly reads schema definitions and skips inline data sections
+// without parsing their rows. The returned document has an empty Data map.
+func ParseSchemaOnly(r io.Reader) (*Document, error) {
+	return parseDocument(r, nil, "")
+}
+
+// dataRowHandler receives each inline data line together with the schema it
+// belongs to. A nil handler skips data sections entirely.
+type dataRowHandler func(doc *Document, sch *Schema, line string) error
+
+func collectDataRow(doc *Document, sch *Schema, line string) error {
+	row, err := parseDataRow(line, sch)
+	if err != nil {
+		return err
+	}
+	doc.Data[sch.Name] = append(doc.Data[sch.Name], row)
+	return nil
+}
+
+// ErrIncludeNotAllowed reports an @include in DSL that was not read from a
+// file, such as a schema uploaded to the registry, or one naming a path
+// outside the including file's directory.
+var ErrIncludeNotAllowed = errors.New("schema: @include not allowed")
+
+// includeState tracks @include files across nested scans. active holds the
+// chain currently being parsed so cycles are reported; done lets a file that
+// is reached twice (e.g. a shared base) contribute its schemas once.
+type includeState struct {
+	active []string
+	done   map[string]bool
+}
+
+func parseDocument(r io.Reader, onData dataRowHandler, path string) (*Document, error) {
 	doc := &Document{
 		Schemas: make(map[string]*Schema),
 		Data:    make(map[string][]map[string]interface{}),
 	}
+	inc := &includeState{done: make(map[string]bool)}
+	dir := ""
+	if path != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		inc.active = append(inc.active, abs)
+		dir = filepath.Dir(abs)
+	}
+	if err := scanDocument(r, doc, onData, dir, inc); err != nil {
+		return nil, err
+	}
+	if err := doc.finalize(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// includeFile scans the file named by an @include directive into doc. The
+// path must be relative and stay inside dir, the including file's directory,
+// which also holds for symlinks along it.
+func includeFile(doc *Document, onData dataRowHandler, dir string, inc *includeState, target string) error {
+	target = strings.Trim(strings.TrimSpace(target), `"`)
+	if target == "" {
+		return errors.New("@include requires a path")
+	}
+	if dir == "" {
+		return fmt.Errorf("@include %s: %w outside files read with ParseFile or Cache.LoadFile", target, ErrIncludeNotAllowed)
+	}
+	if !filepath.IsLocal(target) {
+		return fmt.Errorf("@include %s: %w: path leaves %s", target, ErrIncludeNotAllowed, dir)
+	}
+	abs := filepath.Join(dir, target)
+	if slices.Contains(inc.active, abs) {
+		chain := append(append([]string(nil), inc.active...), abs)
+		return fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+	}
+	if inc.done[abs] {
+		return nil
+	}
+	data, err := readLocalFile(dir, target)
+	if err != nil {
+		return fmt.Errorf("@include: %w", err)
+	}
+	inc.active = append(inc.active, abs)
+	if err := scanDocument(bytes.NewReader(data), doc, onData, filepath.Dir(abs), inc); err != nil {
+		return err
+	}
+	inc.active = inc.active[:len(inc.active)-1]
+	inc.done[abs] = true
+	return nil
+}
+
+// directiveArg returns the argument of a "@name arg" line.
+func directiveArg(line, name string) (string, bool) {
+	if !strings.HasPrefix(line, name) {
+		return "", false
+	}
+	rest := line[len(name):]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// applyPragma applies the key=value argument of a @pragma line to s. The
+// only pragma is rows_per_page, the page size writers use for s unless the
+// caller picks one.
+func applyPragma(s *Schema, arg string) error {
+	key, value, ok := strings.Cut(arg, "=")
+	key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+	if !ok || key == "" || value == "" {
+		return fmt.Errorf("@pragma in schema %s must be key=value, got %q", s.Name, arg)
+	}
+	switch key {
+	case "rows_per_page":
+		if s.RowsPerPage != 0 {
+			return fmt.Errorf("duplicate @pragma %s in schema %s", key, s.Name)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("@pragma rows_per_page in schema %s must be a positive integer, got %q", s.Name, value)
+		}
+		if n > MaxRowsPerPage {
+			return fmt.Errorf("@pragma rows_per_page in schema %s must be at most %d, got %d", s.Name, MaxRowsPerPage, n)
+		}
+		s.RowsPerPage = n
+		return nil
+	default:
+		return fmt.Errorf("unknown @pragma %q in schema %s", key, s.Name)
+	}
+}
+
+// addMetadata records the key=value argument of an @meta line on s. The
+// value runs to the end of the line and may be double-quoted to keep
+// surrounding spaces or a '#'.
+func addMetadata(s *Schema, arg string) error {
+	key, value, ok := strings.Cut(arg, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" || strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("@meta in schema %s must be key=value, got %q", s.Name, arg)
+	}
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return fmt.Errorf("@meta %s in schema %s: invalid quoted value %s", key, s.Name, value)
+		}
+		value = unquoted
+	}
+	if _, exists := s.Metadata[key]; exists {
+		return fmt.Errorf("duplicate @meta key %q in schema %s", key, s.Name)
+	}
+	if s.Metadata == nil {
+		s.Metadata = make(map[string]string)
+	}
+	s.Metadata[key] = value
+	return nil
+}
+
+// addDoc attaches the text of a @doc line to the field declared last in s,
+// or to s itself before its first field. The text may be quoted; repeated
+// @doc lines for one target are joined with newlines.
+func addDoc(s *Schema, arg string) error {
+	text := arg
+	if strings.HasPrefix(text, `"`) {
+		unquoted, err := strconv.Unquote(text)
+		if err != nil {
+			return fmt.Errorf("@doc in schema %s: invalid quoted text %s", s.Name, text)
+		}
+		text = unquoted
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("@doc in schema %s requires text", s.Name)
+	}
+	target := &s.Doc
+	if len(s.Fields) > 0 {
+		target = &s.Fields[len(s.Fields)-1].Doc
+	}
+	if *target != "" {
+		text = *target + "\n" + text
+	}
+	*target = text
+	return nil
+}
+
+// mergeBaseFields places the fields of each base schema ahead of the
+// schema's own fields. An own field whose name matches a base field replaces
+// it in place, so base order is kept. Computed fields are merged the same way.
+func mergeBaseFields(doc *Document, current *Schema, bases []string) error {
+	var merged []Field
+	positions := make(map[string]int)
+	add := func(field Field) {
+		if idx, ok := positions[field.Name]; ok {
+			merged[idx] = field
+			return
+		}
+		positions[field.Name] = len(merged)
+		merged = append(merged, field)
+	}
+	for _, name := range bases {
+		if name == current.Name {
+			return fmt.Errorf("schema %s cannot extend itself", name)
+		}
+		base, ok := doc.Schemas[name]
+		if !ok {
+			return fmt.Errorf("schema %s extends unknown schema %q (bases must be declared or included first)", current.Name, name)
+		}
+		for _, field := range base.Fields {
+			add(field)
+		}
+	}
+	for _, field := range current.Fields {
+		add(field)
+	}
+	current.Fields = merged
+
+	var computed []ComputedField
+	at := make(map[string]int)
+	for _, name := range bases {
+		for _, c := range doc.Schemas[name].Computed {
+			if idx, ok := at[c.Name]; ok {
+				computed[idx] = c
+				continue
+			}
+			at[c.Name] = len(computed)
+			computed = append(computed, c)
+		}
+	}
+	for _, c := range current.Computed {
+		if idx, ok := at[c.Name]; ok {
+			computed[idx] = c
+			continue
+		}
+		at[c.Name] = len(computed)
+		computed = append(computed, c)
+	}
+	current.Computed = computed
+	return nil
+}
+
+// fieldContinuation starts a line in a fields: block that carries more
+// attributes for the field declared above it.
+const fieldContinuation = "|"
+
+func scanDocument(r io.Reader, doc *Document, onData dataRowHandler, dir string, inc *includeState) error {
+	scanner := bufio.NewScanner(r)
 
 	var current *Schema
+	var bases []string
 	var awaitingName bool
 	var currentDataSchema string
 	var fieldBlock bool
+	var blockDecl string // last declaration in the fields block
 
 	finishCurrent := func() error {
 		if current == nil {
@@ -30,8 +295,17 @@ func Parse(r io.Reader) (*Document, error) {
 		if _, exists := doc.Schemas[current.Name]; exists {
 			return fmt.Errorf("duplicate schema %q", current.Name)
 		}
+		if len(bases) > 0 {
+			if err := mergeBaseFields(doc, current, bases); err != nil {
+				return err
+			}
+		}
+		if err := bindComputed(current); err != nil {
+			return err
+		}
 		doc.Schemas[current.Name] = current
 		current = nil
+		bases = nil
 		fieldBlock = false
 		return nil
 	}
@@ -55,29 +329,110 @@ func Parse(r io.Reader) (*Document, error) {
 		if strings.HasPrefix(line, "#") {
 			continue
 		}
+		// decl is line without a trailing comment. Declarations use it; data
+		// rows keep the full line since their values may contain '#'.
+		decl := stripTrailingComment(line)
 		if fieldBlock && current != nil && currentDataSchema == "" && !strings.HasPrefix(line, "@") {
-			field, err := parseField(line)
+			// A line starting with '|' continues the attributes of the field
+			// above it, which is parsed again with them appended.
+			if rest, ok := strings.CutPrefix(decl, fieldContinuation); ok {
+				rest = strings.TrimSpace(rest)
+				if blockDecl == "" {
+					return fmt.Errorf("continuation line %q has no field to continue", line)
+				}
+				if rest == "" {
+					return fmt.Errorf("empty continuation line after field %q", blockDecl)
+				}
+				blockDecl += " " + rest
+				field, err := parseField(blockDecl)
+				if err != nil {
+					return err
+				}
+				current.Fields[len(current.Fields)-1] = field
+				continue
+			}
+			field, err := parseField(decl)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			current.Fields = append(current.Fields, field)
+			blockDecl = decl
 			continue
 		}
+		blockDecl = ""
 
 		if awaitingName {
-			if err := startSchema(line); err != nil {
-				return nil, err
+			if err := startSchema(decl); err != nil {
+				return err
 			}
 			awaitingName = false
 			fieldBlock = false
 			continue
 		}
 
+		if target, ok := directiveArg(decl, "@include"); ok {
+			awaitingName = false
+			currentDataSchema = ""
+			if err := finishCurrent(); err != nil {
+				return err
+			}
+			if err := includeFile(doc, onData, dir, inc, target); err != nil {
+				return err
+			}
+			continue
+		}
+		if arg, ok := directiveArg(decl, "@doc"); ok {
+			if current == nil || currentDataSchema != "" {
+				return errors.New("@doc must follow a @schema or field declaration")
+			}
+			if err := addDoc(current, arg); err != nil {
+				return err
+			}
+			continue
+		}
+		if arg, ok := directiveArg(decl, "@meta"); ok {
+			if current == nil || currentDataSchema != "" {
+				return errors.New("@meta outside of schema")
+			}
+			if err := addMetadata(current, arg); err != nil {
+				return err
+			}
+			continue
+		}
+		if arg, ok := directiveArg(decl, "@computed"); ok {
+			if current == nil || currentDataSchema != "" {
+				return errors.New("@computed outside of schema")
+			}
+			if err := addComputed(current, arg); err != nil {
+				return err
+			}
+			continue
+		}
+		if arg, ok := directiveArg(decl, "@pragma"); ok {
+			if current == nil || currentDataSchema != "" {
+				return errors.New("@pragma outside of schema")
+			}
+			if err := applyPragma(current, arg); err != nil {
+				return err
+			}
+			continue
+		}
+		if base, ok := directiveArg(decl, "@extends"); ok {
+			if current == nil || currentDataSchema != "" {
+				return errors.New("@extends outside of schema")
+			}
+			if base == "" {
+				return errors.New("@extends requires a schema name")
+			}
+			bases = append(bases, base)
+			continue
+		}
+
 		switch {
 		case strings.HasPrefix(line, "@schema"):
 			fieldBlock = false
 			currentDataSchema = ""
-			rest := strings.TrimSpace(strings.TrimPrefix(line, "@schema"))
+			rest := strings.TrimSpace(strings.TrimPrefix(decl, "@schema"))
 			if strings.HasPrefix(rest, ":") {
 				rest = strings.TrimSpace(rest[1:])
 			}
@@ -86,24 +441,24 @@ func Parse(r io.Reader) (*Document, error) {
 				continue
 			}
 			if err := startSchema(rest); err != nil {
-				return nil, err
+				return err
 			}
 
 		case strings.HasPrefix(line, "@field"):
 			fieldBlock = false
 			currentDataSchema = ""
 			if current == nil {
-				return nil, errors.New("@field outside of schema")
+				return errors.New("@field outside of schema")
 			}
-			field, err := parseField(strings.TrimSpace(strings.TrimPrefix(line, "@field")))
+			field, err := parseField(strings.TrimSpace(strings.TrimPrefix(decl, "@field")))
 			if err != nil {
-				return nil, err
+				return err
 			}
 			current.Fields = append(current.Fields, field)
 
 		case strings.HasPrefix(strings.ToLower(line), "fields"):
 			if current == nil {
-				return nil, errors.New("fields block outside of schema")
+				return errors.New("fields block outside of schema")
 			}
 			fieldBlock = true
 			continue
@@ -111,19 +466,20 @@ func Parse(r io.Reader) (*Document, error) {
 			fieldBlock = false
 			awaitingName = false
 			if err := finishCurrent(); err != nil {
-				return nil, err
+				return err
 			}
 
 			// Check if it's a data row (contains =) or section marker
 			if strings.Contains(line, "=") && currentDataSchema != "" {
 				// This is a data row like @MsgID=1002, not a section marker
+				if onData == nil {
+					continue
+				}
 				sch, exists := doc.Schemas[currentDataSchema]
 				if exists {
-					row, err := parseDataRow(line, sch)
-					if err != nil {
-						return nil, fmt.Errorf("parsing data row for %s: %w", currentDataSchema, err)
+					if err := onData(doc, sch, line); err != nil {
+						return wrapDataRowError(currentDataSchema, err)
 					}
-					doc.Data[currentDataSchema] = append(doc.Data[currentDataSchema], row)
 				}
 				continue
 			}
@@ -134,36 +490,55 @@ func Parse(r io.Reader) (*Document, error) {
 			continue
 
 		default:
+			if current != nil && currentDataSchema == "" && strings.HasPrefix(line, fieldContinuation) {
+				return fmt.Errorf("continuation line %q outside a fields: block", line)
+			}
 			// If we're in a data section, parse the row
-			if currentDataSchema != "" {
+			if currentDataSchema != "" && onData != nil {
 				sch, exists := doc.Schemas[currentDataSchema]
 				if !exists {
 					// Schema not yet defined, skip
 					continue
 				}
-				row, err := parseDataRow(line, sch)
-				if err != nil {
-					return nil, fmt.Errorf("parsing data row for %s: %w", currentDataSchema, err)
+				if err := onData(doc, sch, line); err != nil {
+					return wrapDataRowError(currentDataSchema, err)
 				}
-				doc.Data[currentDataSchema] = append(doc.Data[currentDataSchema], row)
 			}
 			continue
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return err
 	}
 	if awaitingName {
-		return nil, errors.New("schema name expected after @schema")
+		return errors.New("schema name expected after @schema")
 	}
-	if err := finishCurrent(); err != nil {
-		return nil, err
-	}
-	if err := doc.finalize(); err != nil {
-		return nil, err
+	return finishCurrent()
+}
+
+// stripTrailingComment cuts line at the first '#' that sits outside quotes
+// and follows whitespace, so `@field ID uint64  # primary key` loses its
+// comment while `default="#fff"` and `default=#fff` keep their value.
+func stripTrailingComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '#' && i > 0 && (line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimSpace(line[:i])
+		}
 	}
-	return doc, nil
+	return line
+}
+
+func wrapDataRowError(schemaName string, err error) error {
+	return fmt.Errorf("parsing data row for %s: %w", schemaName, err)
 }
 
 func parseField(body string) (Field, error) {
@@ -175,6 +550,22 @@ func parseField(body string) (Field, error) {
 	if err != nil {
 		return Field{}, err
 	}
+	var attrs []string
+	if attrChunk != "" {
+		if attrs, err = splitFieldAttributes(attrChunk); err != nil {
+			return Field{}, fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return newField(name, typ, attrs)
+}
+
+// newField builds a field from its name, type token, and split attributes.
+// It backs both @field lines and the Builder so the two agree on RawType,
+// Attributes, and defaults, and therefore on fingerprints.
+func newField(name, typ string, attrs []string) (Field, error) {
+	if err := ValidateFieldName(name); err != nil {
+		return Field{}, err
+	}
 	field := Field{Name: name, RawType: typ}
 	lower := strings.ToLower(typ)
 	switch {
@@ -196,10 +587,28 @@ func parseField(body string) (Field, error) {
 		field.Kind = KindDateTime
 	case lower == "timestamp":
 		field.Kind = KindTimestamp
+	case strings.HasPrefix(lower, "timestamp(") && strings.HasSuffix(lower, ")"):
+		unit, err := temporal.ParseEpochUnit(lower[len("timestamp(") : len(lower)-1])
+		if err != nil {
+			return Field{}, err
+		}
+		field.Kind = KindTimestamp
+		field.EpochUnit = unit
 	case lower == "timestamptz":
 		field.Kind = KindTimestampTZ
 	case lower == "duration":
 		field.Kind = KindDuration
+	case lower == "time":
+		field.Kind = KindTime
+	case lower == "uuid":
+		field.Kind = KindUUID
+	case strings.HasPrefix(lower, "list<") && strings.HasSuffix(lower, ">"):
+		elem, err := parseListElemKind(lower[len("list<") : len(lower)-1])
+		if err != nil {
+			return Field{}, err
+		}
+		field.Kind = KindList
+		field.ElemKind = elem
 	case strings.HasPrefix(lower, "ref:"):
 		field.Kind = KindRef
 		parts := strings.Split(typ, ":")
@@ -212,58 +621,146 @@ func parseField(body string) (Field, error) {
 		return Field{}, fmt.Errorf("unsupported field type %q", typ)
 	}
 
-	if attrChunk != "" {
-		attrs := splitFieldAttributes(attrChunk)
-		for _, attr := range attrs {
-			attr = strings.TrimSpace(attr)
-			if attr == "" {
-				continue
+	for _, attr := range attrs {
+		attr = strings.TrimSpace(attr)
+		if attr == "" {
+			continue
+		}
+		lower := strings.ToLower(attr)
+		switch {
+		case lower == "auto_increment" || lower == "autoincrement" || lower == "serial":
+			field.AutoIncrement = true
+		case lower == "sensitive":
+			field.Sensitive = true
+		case strings.HasPrefix(lower, "default="):
+			val := strings.TrimSpace(attr[len("default="):])
+			if err := assignFieldDefault(&field, val); err != nil {
+				return Field{}, err
+			}
+		case strings.HasPrefix(lower, "default:"):
+			val := strings.TrimSpace(attr[len("default:"):])
+			if err := assignFieldDefault(&field, val); err != nil {
+				return Field{}, err
 			}
-			lower := strings.ToLower(attr)
-			switch {
-			case lower == "auto_increment" || lower == "autoincrement" || lower == "serial":
-				field.AutoIncrement = true
-			case strings.HasPrefix(lower, "default="):
-				val := strings.TrimSpace(attr[len("default="):])
-				if err := assignFieldDefault(&field, val); err != nil {
-					return Field{}, err
+		case strings.HasPrefix(lower, "alias="):
+			for _, alias := range strings.Split(attr[len("alias="):], ";") {
+				alias = strings.TrimSpace(alias)
+				if alias == "" {
+					return Field{}, fmt.Errorf("field %s: empty alias", name)
 				}
-			case strings.HasPrefix(lower, "default:"):
-				val := strings.TrimSpace(attr[len("default:"):])
-				if err := assignFieldDefault(&field, val); err != nil {
-					return Field{}, err
+				if isAttributeKeyword(alias) {
+					return Field{}, fmt.Errorf("field %s: alias %q is an attribute; end the alias list with a space or ','", name, alias)
 				}
+				field.Aliases = append(field.Aliases, alias)
+			}
+		case strings.HasPrefix(lower, "enum="):
+			if field.Kind != KindString {
+				return Field{}, fmt.Errorf("field %s: enum= requires a string field", name)
+			}
+			for _, value := range strings.Split(attr[len("enum="):], "|") {
+				value = strings.TrimSpace(value)
+				if value == "" {
+					return Field{}, fmt.Errorf("field %s: empty enum value", name)
+				}
+				field.Enum = append(field.Enum, value)
+			}
+		case strings.HasPrefix(lower, "encoding="):
+			if field.Kind != KindString {
+				return Field{}, fmt.Errorf("field %s: encoding= requires a string field", name)
+			}
+			switch strings.TrimSpace(lower[len("encoding="):]) {
+			case "dict":
+				field.Encoding = StringEncodingDict
+			case "plain":
+				field.Encoding = StringEncodingPlain
+			case "global":
+				field.Encoding = StringEncodingGlobal
 			default:
-				// keep normalized attribute for hashing/reference
+				return Field{}, fmt.Errorf("field %s: unknown encoding %q (want dict, plain, or global)", name, attr[len("encoding="):])
+			}
+		case strings.HasPrefix(lower, "codec="):
+			codecName := strings.TrimSpace(lower[len("codec="):])
+			if field.Kind != KindBytes {
+				return Field{}, fmt.Errorf("field %s: codec= requires a bytes field", name)
+			}
+			if _, ok := LookupCodec(codecName); !ok {
+				return Field{}, fmt.Errorf("field %s: unknown codec %q", name, codecName)
 			}
-			field.Attributes = append(field.Attributes, lower)
+			field.Codec = codecName
+		default:
+			// keep normalized attribute for hashing/reference
 		}
+		field.Attributes = append(field.Attributes, lower)
 	}
 
 	return field, nil
 }
 
+// parseListElemKind maps the element type of a list<...> declaration. Only
+// string and uint64 elements are supported.
+func parseListElemKind(elem string) (FieldKind, error) {
+	switch strings.TrimSpace(elem) {
+	case "string", "str", "text":
+		return KindString, nil
+	case "uint64", "uint":
+		return KindUint64, nil
+	default:
+		return KindInvalid, fmt.Errorf("unsupported list element type %q", elem)
+	}
+}
+
+// splitFieldParts separates a @field body into name, type, and the raw
+// attribute chunk. The name may be quoted ("Full Name") so it can contain
+// whitespace; quotes in the attribute chunk are left for splitFieldAttributes.
 func splitFieldParts(body string) (string, string, string, error) {
 	body = strings.TrimSpace(body)
-	firstSep := strings.IndexAny(body, " \t")
-	if firstSep == -1 {
-		return "", "", "", fmt.Errorf("invalid @field declaration: %q", body)
+	name, remaining, err := nextFieldToken(body)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid @field declaration %q: %w", body, err)
 	}
-	name := strings.TrimSpace(body[:firstSep])
-	remaining := strings.TrimSpace(body[firstSep+1:])
 	if name == "" || remaining == "" {
 		return "", "", "", fmt.Errorf("invalid @field declaration: %q", body)
 	}
-	secondSep := strings.IndexAny(remaining, " \t")
-	if secondSep == -1 {
-		return name, remaining, "", nil
+	if q := name[0]; q == '"' || q == '\'' || q == '`' {
+		name = name[1 : len(name)-1]
+		if strings.TrimSpace(name) == "" {
+			return "", "", "", fmt.Errorf("invalid @field declaration: %q", body)
+		}
+	}
+	typ, attrs, err := nextFieldToken(remaining)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid @field declaration %q: %w", body, err)
 	}
-	typ := strings.TrimSpace(remaining[:secondSep])
-	attrs := strings.TrimSpace(remaining[secondSep+1:])
 	return name, typ, attrs, nil
 }
 
-func splitFieldAttributes(input string) []string {
+// nextFieldToken returns the first whitespace-delimited token of input and
+// the trimmed remainder. A token that opens with a quote runs to the matching
+// quote, whitespace included.
+func nextFieldToken(input string) (string, string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", "", nil
+	}
+	if q := rune(input[0]); q == '"' || q == '\'' || q == '`' {
+		closing := strings.IndexRune(input[1:], q)
+		if closing == -1 {
+			return "", "", fmt.Errorf("unterminated %c quote", q)
+		}
+		end := closing + 2
+		if end < len(input) && input[end] != ' ' && input[end] != '\t' {
+			return "", "", fmt.Errorf("unexpected %q after closing %c quote", input[end:end+1], q)
+		}
+		return input[:end], strings.TrimSpace(input[end:]), nil
+	}
+	sep := strings.IndexAny(input, " \t")
+	if sep == -1 {
+		return input, "", nil
+	}
+	return input[:sep], strings.TrimSpace(input[sep+1:]), nil
+}
+
+func splitFieldAttributes(input string) ([]string, error) {
 	var (
 		attrs []string
 		buf   strings.Builder
@@ -286,8 +783,12 @@ func splitFieldAttributes(input string) []string {
 			}
 			buf.WriteRune(r)
 		case '|', ',', ' ', '\t':
-			if quote != 0 {
+			// '|' separates attributes except inside enum=a|b. Alias lists
+			// use ';' so a name can never swallow the attribute after it.
+			if quote != 0 || (r == '|' && listAttribute(buf.String())) {
 				buf.WriteRune(r)
+			} else if r == '|' && strings.HasPrefix(strings.ToLower(buf.String()), "alias=") {
+				return nil, fmt.Errorf("'|' after %s is ambiguous: separate aliases with ';' and attributes with a space or ','", strings.TrimSpace(buf.String()))
 			} else {
 				flush()
 			}
@@ -295,8 +796,38 @@ func splitFieldAttributes(input string) []string {
 			buf.WriteRune(r)
 		}
 	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in attributes %q", quote, input)
+	}
 	flush()
-	return attrs
+	return attrs, nil
+}
+
+// listAttribute reports whether attr takes a '|'-separated list.
+func listAttribute(attr string) bool {
+	return strings.HasPrefix(strings.ToLower(attr), "enum=")
+}
+
+// attributeKeywords are the bare attributes the parser and codecs act on.
+var attributeKeywords = map[string]struct{}{
+	"auto_increment": {},
+	"autoincrement":  {},
+	"serial":         {},
+	"sensitive":      {},
+	"unique":         {},
+	"required":       {},
+	"uuid":           {},
+	"uuidv7":         {},
+}
+
+// isAttributeKeyword reports whether name reads as an attribute rather than
+// an alias: a bare keyword or a key=value pair.
+func isAttributeKeyword(name string) bool {
+	lower := strings.ToLower(name)
+	if _, ok := attributeKeywords[lower]; ok {
+		return true
+	}
+	return strings.ContainsAny(lower, "=:")
 }
 
 func assignFieldDefault(field *Field, literal string) error {
@@ -307,7 +838,7 @@ func assignFieldDefault(field *Field, literal string) error {
 		field.pendingDefault = literal
 		return nil
 	}
-	parsed, err := parseDefaultLiteral(field.Kind, literal)
+	parsed, err := parseDefaultLiteral(field.Kind, field.EpochUnit, literal)
 	if err != nil {
 		return err
 	}
@@ -463,6 +994,15 @@ func parseCSVLine(line string) []string {
 	return fields
 }
 
+// numberError reports a strconv failure for a numeric literal, telling an
+// out-of-range value apart from a malformed one.
+func numberError(typ, raw string, err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("%s value %s is out of range", typ, raw)
+	}
+	return fmt.Errorf("invalid %s: %q", typ, raw)
+}
+
 func parseValue(raw string, field *Field) (interface{}, error) {
 	raw = strings.TrimSpace(raw)
 	if field == nil {
@@ -473,26 +1013,29 @@ func parseValue(raw string, field *Field) (interface{}, error) {
 
 	switch kind {
 	case KindUint64:
-		var v uint64
-		_, err := fmt.Sscanf(raw, "%d", &v)
-		if err != nil {
+		if strings.HasPrefix(raw, "-") {
+			if _, err := strconv.ParseInt(raw, 10, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+				return nil, fmt.Errorf("negative value %s cannot be stored in uint64", raw)
+			}
 			return nil, fmt.Errorf("invalid uint64: %q", raw)
 		}
+		v, err := strconv.ParseUint(strings.TrimPrefix(raw, "+"), 10, 64)
+		if err != nil {
+			return nil, numberError("uint64", raw, err)
+		}
 		return v, nil
 
 	case KindInt64:
-		var v int64
-		_, err := fmt.Sscanf(raw, "%d", &v)
+		v, err := strconv.ParseInt(raw, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid int64: %q", raw)
+			return nil, numberError("int64", raw, err)
 		}
 		return v, nil
 
 	case KindFloat64:
-		var v float64
-		_, err := fmt.Sscanf(raw, "%f", &v)
+		v, err := strconv.ParseFloat(raw, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid float64: %q", raw)
+			return nil, numberError("float64", raw, err)
 		}
 		return v, nil
 
@@ -535,7 +1078,7 @@ func parseValue(raw string, field *Field) (interface{}, error) {
 		return val, nil
 
 	case KindTimestamp:
-		val, err := temporal.ParseTimestamp(raw)
+		val, err := temporal.ParseTimestampUnit(raw, field.EpochUnit)
 		if err != nil {
 			return nil, err
 		}
@@ -555,9 +1098,70 @@ func parseValue(raw string, field *Field) (interface{}, error) {
 		}
 		return val, nil
 
+	case KindTime:
+		unquoted := raw
+		if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') {
+			unquoted = raw[1 : len(raw)-1]
+		}
+		val, err := temporal.ParseTimeOfDay(unquoted)
+		if err != nil {
+			return nil, err
+		}
+		return val, nil
+
+	case KindUUID:
+		unquoted := raw
+		if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') {
+			unquoted = raw[1 : len(raw)-1]
+		}
+		id, err := uuid.Parse(unquoted)
+		if err != nil {
+			return nil, err
+		}
+		return id.String(), nil
+
+	case KindList:
+		return parseListValue(raw, field.ElemKind)
+
 	case KindRef:
 		return raw, fmt.Errorf("unresolved ref kind for value %q", raw)
 	default:
 		return raw, nil
 	}
 }
+
+// parseListValue reads a data-row list literal such as [a|b|c]. [] is an
+// empty list.
+func parseListValue(raw string, elem FieldKind) (interface{}, error) {
+	if len(raw) < 2 || raw[0] != '[' || raw[len(raw)-1] != ']' {
+		return nil, fmt.Errorf("invalid list: %q", raw)
+	}
+	inner := strings.TrimSpace(raw[1 : len(raw)-1])
+	var parts []string
+	if inner != "" {
+		parts = strings.Split(inner, "|")
+	}
+	elemField := &Field{Kind: elem}
+	switch elem {
+	case KindUint64:
+		out := make([]uint64, 0, len(parts))
+		for _, part := range parts {
+			v, err := parseValue(part, elemField)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v.(uint64))
+		}
+		return out, nil
+	default:
+		out := make([]string, 0, len(parts))
+		for _, part := range parts {
+			v, err := parseValue(part, elemField)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v.(string))
+		}
+		return out, nil
+	}
+}
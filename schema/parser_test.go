@@ -1,7 +1,15 @@
 package schema_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -140,6 +148,60 @@ func TestParseAutoIncrementDataFlexibility(t *testing.T) {
 	}
 }
 
+func TestParseDefaultFunctions(t *testing.T) {
+	src := `@schema Event
+@field Stamp timestamp default=now()
+@field Ref string default=uuid()
+@field Note string default="now()"
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("Event")
+	if def := sch.Fields[0].Default; !def.Dynamic() || def.Func != "now" {
+		t.Fatalf("Stamp default = %+v, want now()", def)
+	}
+	if def := sch.Fields[1].Default; !def.Dynamic() || def.Func != "uuid" {
+		t.Fatalf("Ref default = %+v, want uuid()", def)
+	}
+	if def := sch.Fields[2].Default; def.Dynamic() || def.String != "now()" {
+		t.Fatalf("quoted default = %+v, want the literal now()", def)
+	}
+	var dsl strings.Builder
+	if err := sch.WriteDSL(&dsl); err != nil {
+		t.Fatalf("write DSL: %v", err)
+	}
+	if !strings.Contains(dsl.String(), "default=now()") || !strings.Contains(dsl.String(), "default=uuid()") {
+		t.Fatalf("DSL lost default functions:\n%s", dsl.String())
+	}
+
+	// The expression is fingerprinted, so the same schema parsed again keeps
+	// its fingerprint while another function changes it.
+	again, _ := schema.Parse(strings.NewReader(src))
+	sameSch, _ := again.Schema("Event")
+	if sameSch.Fingerprint() != sch.Fingerprint() {
+		t.Fatalf("fingerprint changed between parses")
+	}
+	literal, _ := schema.Parse(strings.NewReader(strings.Replace(src, "default=now()", "default=1704210000", 1)))
+	literalSch, _ := literal.Schema("Event")
+	if literalSch.Fingerprint() == sch.Fingerprint() {
+		t.Fatalf("now() and a static literal share a fingerprint")
+	}
+
+	for _, tc := range []struct{ field, want string }{
+		{"@field N uint64 default=now()", "default now() requires a date, datetime, timestamp, or timestamptz field"},
+		{"@field S string default=now()", "default now() requires a date, datetime, timestamp, or timestamptz field"},
+		{"@field T timestamp default=uuid()", "default uuid() requires a string or uuid field"},
+		{"@field S string default=random()", "unknown default function random()"},
+	} {
+		_, err := schema.Parse(strings.NewReader("@schema Bad\n" + tc.field + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: err = %v, want %q", tc.field, err, tc.want)
+		}
+	}
+}
+
 func TestParseTemporalDefaults(t *testing.T) {
 	src := `@schema Temporal
 @field Day date default=2025-01-02
@@ -194,3 +256,888 @@ func TestParseTemporalDefaults(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSchemaOnlySkipsData(t *testing.T) {
+	src := `@schema Message
+@field MsgID uint64 auto_increment
+@field Text string
+
+@Message
+1001, "Hello World!"
+@MsgID=77, "Hi again"
+this row would not even parse, "as", "a", "message"
+
+@schema User
+@field ID uint64
+@field Name string
+
+@User
+1001, "John Doe"
+`
+	doc, err := schema.ParseSchemaOnly(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema only: %v", err)
+	}
+	if len(doc.Schemas) != 2 {
+		t.Fatalf("expected 2 schemas, got %d", len(doc.Schemas))
+	}
+	msg, ok := doc.Schema("Message")
+	if !ok || len(msg.Fields) != 2 || !msg.Fields[0].AutoIncrement {
+		t.Fatalf("unexpected Message schema: %+v", msg)
+	}
+	if len(doc.Data) != 0 {
+		t.Fatalf("expected no data rows, got %+v", doc.Data)
+	}
+	if _, err := schema.Parse(strings.NewReader(src)); err == nil {
+		t.Fatalf("expected full parse to reject the malformed data row")
+	}
+
+	full, err := schema.ParseFile("../data.scrt")
+	if err != nil {
+		t.Fatalf("parse sample: %v", err)
+	}
+	fullMsg, _ := full.Schema("Message")
+	f, err := os.Open("../data.scrt")
+	if err != nil {
+		t.Fatalf("open sample: %v", err)
+	}
+	defer f.Close()
+	schemaOnly, err := schema.ParseSchemaOnly(f)
+	if err != nil {
+		t.Fatalf("parse sample schema only: %v", err)
+	}
+	onlyMsg, _ := schemaOnly.Schema("Message")
+	if fullMsg.Fingerprint() != onlyMsg.Fingerprint() {
+		t.Fatalf("fingerprint differs between parse modes")
+	}
+
+	full.ClearData()
+	if len(full.Data) != 0 || len(full.Schemas) != 2 {
+		t.Fatalf("ClearData should drop rows only, got %d data sets and %d schemas", len(full.Data), len(full.Schemas))
+	}
+}
+
+func TestDocumentDataRowsMatchesRecords(t *testing.T) {
+	src := `@schema Message
+@field MsgID uint64 auto_increment
+@field User ref:User:ID
+@field Text string
+@field Lang string default="en"
+
+@schema User
+@field ID uint64 auto_increment
+@field Name string
+
+@Message
+1001, "Hello World!", "en"
+@MsgID=77, 1002, "Hi again"
+1003, "Third", "fr"
+
+@User
+1001, "John Doe"
+
+@Message
+1004, "Back again", "de"
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	eager, ok := doc.Records("Message")
+	if !ok || len(eager) != 4 {
+		t.Fatalf("expected 4 eager rows, got %d", len(eager))
+	}
+	doc.ClearData()
+
+	rows, err := doc.DataRows("Message")
+	if err != nil {
+		t.Fatalf("DataRows: %v", err)
+	}
+	var streamed []map[string]interface{}
+	for row, err := range rows {
+		if err != nil {
+			t.Fatalf("iterate: %v", err)
+		}
+		streamed = append(streamed, row)
+	}
+	if len(streamed) != len(eager) {
+		t.Fatalf("expected %d streamed rows, got %d", len(eager), len(streamed))
+	}
+	for i := range eager {
+		if len(streamed[i]) != len(eager[i]) {
+			t.Fatalf("row %d: streamed %+v eager %+v", i, streamed[i], eager[i])
+		}
+		for key, want := range eager[i] {
+			if streamed[i][key] != want {
+				t.Fatalf("row %d field %s: streamed %v eager %v", i, key, streamed[i][key], want)
+			}
+		}
+	}
+
+	count := 0
+	for range rows {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Fatalf("expected early break after 2 rows, got %d", count)
+	}
+
+	if _, err := doc.DataRows("Missing"); err == nil {
+		t.Fatalf("expected error for unknown schema")
+	}
+	schemaOnly, err := schema.ParseSchemaOnly(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema only: %v", err)
+	}
+	if _, err := schemaOnly.DataRows("Message"); err == nil {
+		t.Fatalf("expected error without retained source")
+	}
+}
+
+func TestParseListFields(t *testing.T) {
+	parse := func(src string) (*schema.Document, *schema.Schema) {
+		t.Helper()
+		doc, err := schema.Parse(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		sch, _ := doc.Schema("Post")
+		return doc, sch
+	}
+	doc, strs := parse("@schema Post\n@field ID uint64\n@field Tags list<string>\n\n@Post\n1, [go|db]\n2, []\n")
+	field := strs.Fields[1]
+	if field.Kind != schema.KindList || field.ElemKind != schema.KindString {
+		t.Fatalf("unexpected field %+v", field)
+	}
+	records, _ := doc.Records("Post")
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %+v", records)
+	}
+	if tags, ok := records[0]["Tags"].([]string); !ok || len(tags) != 2 || tags[0] != "go" || tags[1] != "db" {
+		t.Fatalf("unexpected first Tags %#v", records[0]["Tags"])
+	}
+	if tags, ok := records[1]["Tags"].([]string); !ok || tags == nil || len(tags) != 0 {
+		t.Fatalf("expected empty Tags, got %#v", records[1]["Tags"])
+	}
+	_, uints := parse("@schema Post\n@field ID uint64\n@field Tags list<uint64>\n")
+	if uints.Fields[1].ElemKind != schema.KindUint64 {
+		t.Fatalf("expected uint64 elements, got %d", uints.Fields[1].ElemKind)
+	}
+	if strs.Fingerprint() == uints.Fingerprint() {
+		t.Fatalf("element kind should change the fingerprint")
+	}
+	if _, err := schema.Parse(strings.NewReader("@schema Post\n@field ID uint64\n@field Tags list<float64>\n")); err == nil {
+		t.Fatalf("expected unsupported element type error")
+	}
+}
+
+func TestParseAliasList(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Message\n@field ID uint64\n@field Body string alias=Text;Content unique\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("Message")
+	if body := sch.Fields[1]; !reflect.DeepEqual(body.Aliases, []string{"Text", "Content"}) || !body.HasAttribute("unique") {
+		t.Fatalf("unexpected aliases %+v", body)
+	}
+
+	for _, bad := range []string{
+		"alias=Text|unique",
+		"alias=Text|Content",
+		"alias=Text;unique",
+		"alias=Text;default=x",
+	} {
+		_, err := schema.Parse(strings.NewReader("@schema Message\n@field ID uint64\n@field Body string " + bad + "\n"))
+		if err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestParseQuotedFieldNames(t *testing.T) {
+	src := "@schema Contact\n@field ID uint64\n@field \"Full Name\" string default=\"Jane Q Public\"\n@field Note string default=\"two words\" alias=Memo\n"
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("Contact")
+	if len(sch.Fields) != 3 {
+		t.Fatalf("expected 3 fields, got %+v", sch.Fields)
+	}
+	full := sch.Fields[1]
+	if full.Name != "Full Name" || full.Kind != schema.KindString {
+		t.Fatalf("unexpected quoted field %+v", full)
+	}
+	if full.Default == nil || full.Default.String != "Jane Q Public" {
+		t.Fatalf("unexpected default %+v", full.Default)
+	}
+	note := sch.Fields[2]
+	if note.Default == nil || note.Default.String != "two words" || len(note.Aliases) != 1 || note.Aliases[0] != "Memo" {
+		t.Fatalf("unexpected note field %+v", note)
+	}
+
+	unquoted, err := schema.Parse(strings.NewReader("@schema Contact\n@field ID uint64\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse unquoted: %v", err)
+	}
+	quoted, err := schema.Parse(strings.NewReader("@schema Contact\n@field ID uint64\n@field \"Name\" string\n"))
+	if err != nil {
+		t.Fatalf("parse quoted: %v", err)
+	}
+	a, _ := unquoted.Schema("Contact")
+	b, _ := quoted.Schema("Contact")
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Fatalf("quoting a plain name should not change the fingerprint")
+	}
+
+	for _, bad := range []string{
+		"@field \"Full Name string\n",
+		"@field \"Full\"Name string\n",
+		"@field Label string default=\"open\n",
+	} {
+		_, err := schema.Parse(strings.NewReader("@schema Contact\n" + bad))
+		if err == nil || !strings.Contains(err.Error(), "quote") {
+			t.Fatalf("expected quote error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestParseExtendsWithOverride(t *testing.T) {
+	src := `@schema Base
+@field ID uint64 auto_increment
+@field Name string
+@field CreatedAt timestamp
+
+@schema User
+@field Email string
+@extends Base
+@field Name string default="anon"
+
+@User
+"Ann", 2025-01-02T03:04:05Z, "a@x"
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	user, _ := doc.Schema("User")
+	var names []string
+	for _, f := range user.Fields {
+		names = append(names, f.Name)
+	}
+	if got := strings.Join(names, ","); got != "ID,Name,CreatedAt,Email" {
+		t.Fatalf("unexpected field order %s", got)
+	}
+	if def := user.Fields[1].Default; def == nil || def.String != "anon" {
+		t.Fatalf("override did not replace Name: %+v", user.Fields[1])
+	}
+	if !user.Fields[0].AutoIncrement {
+		t.Fatalf("base attributes lost: %+v", user.Fields[0])
+	}
+	records, _ := doc.Records("User")
+	if len(records) != 1 || records[0]["Name"] != "Ann" || records[0]["Email"] != "a@x" {
+		t.Fatalf("data rows should use merged fields, got %+v", records)
+	}
+
+	if _, err := schema.Parse(strings.NewReader("@schema User\n@extends Missing\n@field ID uint64\n")); err == nil {
+		t.Fatalf("expected unknown base error")
+	}
+}
+
+func TestParseFileGzip(t *testing.T) {
+	dir := t.TempDir()
+	gz := func(body string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(body))
+		zw.Close()
+		return buf.Bytes()
+	}
+	files := map[string][]byte{
+		"base.scrt.gz": gz("@schema Base\n@field ID uint64\n"),
+		"app.scrt.gz":  gz("@include base.scrt.gz\n@schema Post\n@extends Base\n@field Title string\n"),
+		// Detection is by content: a plain file named .gz is read as is,
+		// and a gzipped file without the extension is still decompressed.
+		"plain.scrt.gz": []byte("@schema Plain\n@field ID uint64\n"),
+		"packed.scrt":   gz("@schema Packed\n@field ID uint64\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	for file, want := range map[string]string{"app.scrt.gz": "Post", "plain.scrt.gz": "Plain", "packed.scrt": "Packed"} {
+		doc, err := schema.ParseFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("parse %s: %v", file, err)
+		}
+		if _, ok := doc.Schema(want); !ok {
+			t.Fatalf("%s: schema %s missing", file, want)
+		}
+	}
+
+	doc, raw, _, err := schema.NewCache().Snapshot(filepath.Join(dir, "app.scrt.gz"))
+	if err != nil {
+		t.Fatalf("cache load: %v", err)
+	}
+	if _, ok := doc.Schema("Base"); !ok {
+		t.Fatalf("cached document lost its include")
+	}
+	if !strings.HasPrefix(string(raw), "@include") {
+		t.Fatalf("cache kept compressed bytes: %q", raw[:8])
+	}
+
+	reg := schema.NewDocumentRegistry()
+	if _, err := reg.LoadFile("", filepath.Join(dir, "packed.scrt")); err != nil {
+		t.Fatalf("registry load: %v", err)
+	}
+	// The name taken from the file drops .scrt.gz, so it matches the DSL.
+	if _, err := reg.LoadFile("", filepath.Join(dir, "plain.scrt.gz")); err != nil {
+		t.Fatalf("registry load: %v", err)
+	}
+}
+
+func TestParseFileIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	write("common/base.scrt", "@schema Base\n@field ID uint64\n@field CreatedAt timestamp\n")
+	write("common/tag.scrt", "@include base.scrt\n@schema Tag\n@extends Base\n@field Label string\n")
+	main := write("app.scrt", "@include common/base.scrt\n@include common/tag.scrt\n@schema Post\n@extends Base\n@field Title string\n")
+
+	doc, err := schema.ParseFile(main)
+	if err != nil {
+		t.Fatalf("parse file: %v", err)
+	}
+	for _, name := range []string{"Base", "Tag", "Post"} {
+		if _, ok := doc.Schema(name); !ok {
+			t.Fatalf("schema %s missing", name)
+		}
+	}
+	post, _ := doc.Schema("Post")
+	if len(post.Fields) != 3 || post.Fields[0].Name != "ID" || post.Fields[2].Name != "Title" {
+		t.Fatalf("unexpected Post fields %+v", post.Fields)
+	}
+	cached, err := schema.NewCache().LoadFile(main)
+	if err != nil {
+		t.Fatalf("cache load: %v", err)
+	}
+	if _, ok := cached.Schema("Tag"); !ok {
+		t.Fatalf("cache should resolve includes relative to the file")
+	}
+
+	write("a.scrt", "@include b.scrt\n@schema A\n@field ID uint64\n")
+	cyclic := write("b.scrt", "@include a.scrt\n@schema B\n@field ID uint64\n")
+	if _, err := schema.ParseFile(cyclic); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected include cycle error, got %v", err)
+	}
+
+	// Includes only resolve inside the including file's directory, and DSL
+	// that was not read from a file cannot include at all.
+	secret := filepath.Join(t.TempDir(), "secret.scrt")
+	if err := os.WriteFile(secret, []byte("@schema Secret\n@field ID uint64\n"), 0o644); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	if err := os.Symlink(secret, filepath.Join(dir, "common", "link.scrt")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	for _, target := range []string{"../app.scrt", secret} {
+		escaping := write("common/escape.scrt", "@include "+target+"\n@schema E\n@field ID uint64\n")
+		if _, err := schema.ParseFile(escaping); !errors.Is(err, schema.ErrIncludeNotAllowed) {
+			t.Fatalf("include %s: expected ErrIncludeNotAllowed, got %v", target, err)
+		}
+	}
+	escaping := write("common/escape.scrt", "@include link.scrt\n@schema E\n@field ID uint64\n")
+	if _, err := schema.ParseFile(escaping); err == nil {
+		t.Fatalf("expected a symlink out of the directory to be refused")
+	}
+	if _, err := schema.Parse(strings.NewReader("@include " + secret + "\n")); !errors.Is(err, schema.ErrIncludeNotAllowed) {
+		t.Fatalf("Parse: expected ErrIncludeNotAllowed, got %v", err)
+	}
+	registry := schema.NewDocumentRegistry()
+	if _, err := registry.Upsert("Post", []byte("@include "+secret+"\n@schema Post\n@field ID uint64\n"), "upload", time.Time{}); !errors.Is(err, schema.ErrIncludeNotAllowed) {
+		t.Fatalf("Upsert: expected ErrIncludeNotAllowed, got %v", err)
+	}
+}
+
+func TestParseTimestampEpochUnitHint(t *testing.T) {
+	src := "@schema Tick\n@field At timestamp(ms) default=1700000000\n@field Legacy timestamp\n\n@Tick\n1700000000, 1700000000\n"
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	tick, _ := doc.Schema("Tick")
+	if tick.Fields[0].Kind != schema.KindTimestamp || tick.Fields[0].EpochUnit != temporal.EpochMillis {
+		t.Fatalf("unexpected field %+v", tick.Fields[0])
+	}
+	if tick.Fields[0].Default == nil || tick.Fields[0].Default.Int != int64(1_700_000_000*time.Millisecond) {
+		t.Fatalf("default not read as milliseconds: %+v", tick.Fields[0].Default)
+	}
+	records, _ := doc.Records("Tick")
+	if at := records[0]["At"].(time.Time); !at.Equal(time.UnixMilli(1_700_000_000)) {
+		t.Fatalf("At read as %s", at)
+	}
+	if legacy := records[0]["Legacy"].(time.Time); !legacy.Equal(time.Unix(1_700_000_000, 0)) {
+		t.Fatalf("Legacy read as %s", legacy)
+	}
+	if _, err := schema.Parse(strings.NewReader("@schema Tick\n@field At timestamp(days)\n")); err == nil {
+		t.Fatalf("expected unknown unit error")
+	}
+}
+
+func TestParseTimeOfDayField(t *testing.T) {
+	src := "@schema Shop\n@field Name string\n@field Opens time default=\"9:00 AM\"\n@field Closes time\n\n@Shop\n\"Corner\", 08:30, \"5:45:30 PM\"\n"
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	shop, _ := doc.Schema("Shop")
+	opens := shop.Fields[1]
+	if opens.Kind != schema.KindTime || opens.RawType != "time" {
+		t.Fatalf("unexpected field %+v", opens)
+	}
+	if opens.Default == nil || opens.Default.Int != int64(9*time.Hour) {
+		t.Fatalf("default not read as a time of day: %+v", opens.Default)
+	}
+	records, _ := doc.Records("Shop")
+	if got := records[0]["Closes"].(time.Duration); got != 17*time.Hour+45*time.Minute+30*time.Second {
+		t.Fatalf("Closes read as %s", got)
+	}
+	if _, err := schema.Parse(strings.NewReader("@schema Shop\n@field Opens time default=\"24:00\"\n")); err == nil {
+		t.Fatalf("expected 24:00 default to be rejected")
+	}
+
+	asTime, _ := schema.New("Slot").Time("At").Build()
+	asDuration, _ := schema.New("Slot").Duration("At").Build()
+	if asTime.Fingerprint() == asDuration.Fingerprint() {
+		t.Fatalf("time and duration fields share a fingerprint")
+	}
+}
+
+func TestParseCodecAttribute(t *testing.T) {
+	if err := schema.RegisterCodec("Geohash", schema.ValueCodec{
+		Encode: func(v any) ([]byte, error) { return []byte(fmt.Sprint(v)), nil },
+		Decode: func(b []byte) (any, error) { return string(b), nil },
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	doc, err := schema.Parse(strings.NewReader("@schema Spot\n@field Cell bytes codec=geohash\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	spot, _ := doc.Schema("Spot")
+	if spot.Fields[0].Codec != "geohash" {
+		t.Fatalf("codec not recorded: %+v", spot.Fields[0])
+	}
+	if _, err := schema.Parse(strings.NewReader("@schema Spot\n@field Cell bytes codec=nope\n")); err == nil || !strings.Contains(err.Error(), "unknown codec") {
+		t.Fatalf("expected unknown codec error, got %v", err)
+	}
+	if _, err := schema.Parse(strings.NewReader("@schema Spot\n@field Cell string codec=geohash\n")); err == nil {
+		t.Fatalf("expected codec= on a string field to be rejected")
+	}
+}
+
+func TestParseSensitiveAttribute(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64\n@field Email string sensitive\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	user, _ := doc.Schema("User")
+	if user.Fields[0].Sensitive || !user.Fields[1].Sensitive {
+		t.Fatalf("sensitive not recorded: %+v", user.Fields)
+	}
+	plainDoc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64\n@field Email string\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	plain, _ := plainDoc.Schema("User")
+	if plain.Fingerprint() == user.Fingerprint() {
+		t.Fatalf("sensitive should change the fingerprint")
+	}
+	built, err := schema.New("User").Uint64("ID").String("Email", schema.Sensitive()).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if built.Fingerprint() != user.Fingerprint() || !built.Fields[1].Sensitive {
+		t.Fatalf("builder Sensitive() does not match the DSL attribute")
+	}
+}
+
+func TestParseNumericLiterals(t *testing.T) {
+	const header = "@schema Reading\n@field Count uint64\n@field Delta int64\n@field Ratio float64\n\n@Reading\n"
+	doc, err := schema.Parse(strings.NewReader(header + "+7, -42, 1e3\n18446744073709551615, +9, -2.5E-2\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rows, ok := doc.Records("Reading")
+	if !ok || len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	want := []map[string]any{
+		{"Count": uint64(7), "Delta": int64(-42), "Ratio": 1000.0},
+		{"Count": uint64(math.MaxUint64), "Delta": int64(9), "Ratio": -0.025},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %v, want %v", rows, want)
+	}
+
+	for _, tc := range []struct {
+		row  string
+		want string
+	}{
+		{"-5, 1, 1", "negative value -5 cannot be stored in uint64"},
+		{"18446744073709551616, 1, 1", "uint64 value 18446744073709551616 is out of range"},
+		{"1, 9223372036854775808, 1", "int64 value 9223372036854775808 is out of range"},
+		{"1, 1, 1e400", "float64 value 1e400 is out of range"},
+		{"12abc, 1, 1", `invalid uint64: "12abc"`},
+		{"1, 1_000, 1", `invalid int64: "1_000"`},
+	} {
+		_, err := schema.Parse(strings.NewReader(header + tc.row + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("row %q: expected error containing %q, got %v", tc.row, tc.want, err)
+		}
+	}
+}
+
+func TestParseTrailingComments(t *testing.T) {
+	src := `@schema Widget   # catalog entries
+@field ID uint64 auto_increment  # primary key
+@field Color string default="#ff0000" # quoted hash is kept
+@field Tag string default=#plain
+@field Note string
+
+@Widget
+"red", "#1", "a # b"
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, ok := doc.Schema("Widget")
+	if !ok {
+		t.Fatalf("schema Widget missing")
+	}
+	id := sch.Fields[0]
+	if !id.AutoIncrement || len(id.Attributes) != 1 {
+		t.Fatalf("ID attributes = %v", id.Attributes)
+	}
+	if got := sch.Fields[1].Default; got == nil || got.String != "#ff0000" {
+		t.Fatalf("Color default = %+v, want %q", got, "#ff0000")
+	}
+	if got := sch.Fields[2].Default; got == nil || got.String != "#plain" {
+		t.Fatalf("Tag default = %+v, want %q", got, "#plain")
+	}
+	plainDoc, err := schema.Parse(strings.NewReader("@schema Widget\n@field ID uint64 auto_increment\n@field Color string default=\"#ff0000\"\n@field Tag string default=#plain\n@field Note string\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	plain, _ := plainDoc.Schema("Widget")
+	if sch.Fingerprint() != plain.Fingerprint() {
+		t.Fatalf("comments changed the fingerprint")
+	}
+	rows, _ := doc.Records("Widget")
+	if len(rows) != 1 || rows[0]["Color"] != "red" || rows[0]["Tag"] != "#1" || rows[0]["Note"] != "a # b" {
+		t.Fatalf("data row = %v", rows)
+	}
+}
+
+func TestParseFieldContinuation(t *testing.T) {
+	src := `@schema Account
+fields:
+  ID uint64 auto_increment
+  Email string
+    |unique
+    |default="nobody@example.com"  # fallback address
+    |sensitive
+  Name string
+@Account
+@ID=1, "a@example.com", "Ann"
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("Account")
+	if len(sch.Fields) != 3 || sch.Fields[2].Name != "Name" {
+		t.Fatalf("fields = %+v", sch.Fields)
+	}
+	email := sch.Fields[1]
+	if len(email.Attributes) != 3 || email.Default == nil || email.Default.String != "nobody@example.com" || !email.Sensitive {
+		t.Fatalf("Email = %+v", email)
+	}
+	single, err := schema.Parse(strings.NewReader(`@schema Account
+@field ID uint64 auto_increment
+@field Email string unique default="nobody@example.com" sensitive
+@field Name string
+`))
+	if err != nil {
+		t.Fatalf("parse single-line: %v", err)
+	}
+	want, _ := single.Schema("Account")
+	if sch.Fingerprint() != want.Fingerprint() {
+		t.Fatalf("continued field differs from its single-line form")
+	}
+	rows, _ := doc.Records("Account")
+	if len(rows) != 1 || rows[0]["Name"] != "Ann" {
+		t.Fatalf("data rows = %v", rows)
+	}
+
+	malformed := []struct {
+		name, src, want string
+	}{
+		{"no field", "@schema A\nfields:\n  |unique\n", "has no field to continue"},
+		{"empty", "@schema A\nfields:\n  ID uint64\n  |\n", "empty continuation line"},
+		{"bad attribute", "@schema A\nfields:\n  ID uint64\n  |default=\"open\n", "unterminated"},
+		{"outside block", "@schema A\n@field ID uint64\n|unique\n", "outside a fields: block"},
+	}
+	for _, tc := range malformed {
+		_, err := schema.Parse(strings.NewReader(tc.src))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: err = %v, want it to mention %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestParseDocDirective(t *testing.T) {
+	src := `@schema User
+@doc "A registered account."
+@field ID uint64 auto_increment
+@doc "Primary key, assigned on insert." # trailing comment
+@field Email string
+fields:
+  Name string
+  @doc Display name
+  @doc shown in the UI
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	if sch.Doc != "A registered account." {
+		t.Fatalf("schema doc = %q", sch.Doc)
+	}
+	if got := sch.Fields[0].Doc; got != "Primary key, assigned on insert." {
+		t.Fatalf("ID doc = %q", got)
+	}
+	if got := sch.Fields[1].Doc; got != "" {
+		t.Fatalf("Email doc = %q, want none", got)
+	}
+	if got := sch.Fields[2].Doc; got != "Display name\nshown in the UI" {
+		t.Fatalf("Name doc = %q", got)
+	}
+
+	plainDoc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Email string\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	plain, _ := plainDoc.Schema("User")
+	if sch.Fingerprint() != plain.Fingerprint() {
+		t.Fatalf("@doc changed the fingerprint")
+	}
+
+	var buf bytes.Buffer
+	if err := sch.WriteDSL(&buf); err != nil {
+		t.Fatalf("write DSL: %v", err)
+	}
+	again, err := schema.Parse(&buf)
+	if err != nil {
+		t.Fatalf("reparse: %v", err)
+	}
+	round, _ := again.Schema("User")
+	if round.Doc != sch.Doc || round.Fields[2].Doc != sch.Fields[2].Doc {
+		t.Fatalf("docs lost in WriteDSL round trip: %q / %q", round.Doc, round.Fields[2].Doc)
+	}
+
+	jsonSchema, err := sch.JSONSchema()
+	if err != nil {
+		t.Fatalf("json schema: %v", err)
+	}
+	if !strings.Contains(string(jsonSchema), `"description": "A registered account."`) || !strings.Contains(string(jsonSchema), `"description": "Primary key, assigned on insert."`) {
+		t.Fatalf("json schema lacks descriptions: %s", jsonSchema)
+	}
+
+	for _, bad := range []string{
+		"@doc \"orphan\"\n@schema A\n@field ID uint64\n",
+		"@schema A\n@field ID uint64\n@A\n@doc \"in data\"\n",
+		"@schema A\n@field ID uint64\n@doc\n",
+		"@schema A\n@field ID uint64\n@doc \"unterminated\n",
+	} {
+		if _, err := schema.Parse(strings.NewReader(bad)); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestParseMetaDirective(t *testing.T) {
+	const src = `@schema User
+@meta owner=identity-team
+@meta description = "Accounts, # included"
+@meta pii=true # email is personal
+@field ID uint64
+@field Email string
+`
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	want := map[string]string{"owner": "identity-team", "description": "Accounts, # included", "pii": "true"}
+	if !maps.Equal(sch.Metadata, want) {
+		t.Fatalf("metadata = %v, want %v", sch.Metadata, want)
+	}
+
+	plain, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64\n@field Email string\n"))
+	if err != nil {
+		t.Fatalf("parse plain: %v", err)
+	}
+	plainSchema, _ := plain.Schema("User")
+	if plainSchema.Metadata != nil {
+		t.Fatalf("expected nil metadata, got %v", plainSchema.Metadata)
+	}
+	if plainSchema.Fingerprint() != sch.Fingerprint() {
+		t.Fatalf("metadata must not change the fingerprint")
+	}
+
+	var out strings.Builder
+	if err := sch.WriteDSL(&out); err != nil {
+		t.Fatalf("write dsl: %v", err)
+	}
+	again, err := schema.Parse(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("reparse %q: %v", out.String(), err)
+	}
+	reparsed, _ := again.Schema("User")
+	if !maps.Equal(reparsed.Metadata, want) {
+		t.Fatalf("round trip metadata = %v, want %v\n%s", reparsed.Metadata, want, out.String())
+	}
+
+	for src, msg := range map[string]string{
+		"@schema User\n@meta owner=a\n@meta owner=b\n@field ID uint64\n": `duplicate @meta key "owner"`,
+		"@schema User\n@meta owner\n@field ID uint64\n":                  "must be key=value",
+		"@meta owner=a\n@schema User\n@field ID uint64\n":                "@meta outside of schema",
+	} {
+		if _, err := schema.Parse(strings.NewReader(src)); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Fatalf("parse %q: expected %q, got %v", src, msg, err)
+		}
+	}
+}
+
+func TestParsePragmaRowsPerPage(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Wide\n@pragma rows_per_page=256\n@field ID uint64\n@field Body string\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sch, _ := doc.Schema("Wide")
+	if sch.RowsPerPage != 256 {
+		t.Fatalf("RowsPerPage = %d, want 256", sch.RowsPerPage)
+	}
+	plain, err := schema.Parse(strings.NewReader("@schema Wide\n@field ID uint64\n@field Body string\n"))
+	if err != nil {
+		t.Fatalf("parse plain: %v", err)
+	}
+	plainSchema, _ := plain.Schema("Wide")
+	if plainSchema.RowsPerPage != 0 {
+		t.Fatalf("expected no page size without a pragma, got %d", plainSchema.RowsPerPage)
+	}
+	if plainSchema.Fingerprint() != sch.Fingerprint() {
+		t.Fatalf("the pragma must not change the fingerprint")
+	}
+
+	var out strings.Builder
+	if err := sch.WriteDSL(&out); err != nil {
+		t.Fatalf("write dsl: %v", err)
+	}
+	again, err := schema.Parse(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("reparse %q: %v", out.String(), err)
+	}
+	if reparsed, _ := again.Schema("Wide"); reparsed.RowsPerPage != 256 {
+		t.Fatalf("round trip RowsPerPage = %d, want 256\n%s", reparsed.RowsPerPage, out.String())
+	}
+
+	for src, msg := range map[string]string{
+		"@schema W\n@pragma rows_per_page=0\n@field ID uint64\n":                          "must be a positive integer",
+		"@schema W\n@pragma rows_per_page=many\n@field ID uint64\n":                       "must be a positive integer",
+		"@schema W\n@pragma rows_per_page=1048577\n@field ID uint64\n":                    "must be at most 1048576",
+		"@schema W\n@pragma rows_per_page=8\n@pragma rows_per_page=9\n@field ID uint64\n": "duplicate @pragma rows_per_page",
+		"@schema W\n@pragma compress=zstd\n@field ID uint64\n":                            `unknown @pragma "compress"`,
+		"@schema W\n@pragma rows_per_page\n@field ID uint64\n":                            "must be key=value",
+		"@pragma rows_per_page=8\n@schema W\n@field ID uint64\n":                          "@pragma outside of schema",
+	} {
+		if _, err := schema.Parse(strings.NewReader(src)); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Fatalf("parse %q: expected %q, got %v", src, msg, err)
+		}
+	}
+}
+
+func TestParseComputedDirective(t *testing.T) {
+	src := "@schema Base\n@field First string\n@field Last string\n@computed FullName expr=First + \" \" + Last\n\n" +
+		"@schema Staff\n@extends Base\n@field Salary float64 sensitive\n@computed Monthly expr=Salary / 12\n"
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	staff, _ := doc.Schema("Staff")
+	if len(staff.Computed) != 2 || staff.Computed[0].Name != "FullName" || staff.Computed[1].Name != "Monthly" {
+		t.Fatalf("computed fields = %+v", staff.Computed)
+	}
+	if got := staff.Computed[1].Inputs(); !reflect.DeepEqual(got, []int{2}) {
+		t.Fatalf("Monthly inputs = %v, want [2]", got)
+	}
+	values := []any{"Ada", "Lovelace", 1200.0}
+	lookup := func(idx int) (any, bool) { return values[idx], true }
+	if v, ok := staff.Computed[0].Eval(lookup); !ok || v != "Ada Lovelace" {
+		t.Fatalf("FullName = %#v, %v", v, ok)
+	}
+	if v, ok := staff.Computed[1].Eval(lookup); !ok || v != 100.0 {
+		t.Fatalf("Monthly = %#v, %v", v, ok)
+	}
+
+	var out strings.Builder
+	if err := staff.WriteDSL(&out); err != nil {
+		t.Fatalf("write dsl: %v", err)
+	}
+	again, err := schema.Parse(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("reparse %q: %v", out.String(), err)
+	}
+	if reparsed, _ := again.Schema("Staff"); len(reparsed.Computed) != 2 || reparsed.Computed[1].Expr != "Salary / 12" {
+		t.Fatalf("round trip computed = %+v\n%s", reparsed.Computed, out.String())
+	}
+
+	js, err := staff.JSONSchema()
+	if err != nil {
+		t.Fatalf("json schema: %v", err)
+	}
+	if !strings.Contains(string(js), "\"Monthly\": {\n      \"readOnly\": true\n    }") {
+		t.Fatalf("computed property should be readOnly:\n%s", js)
+	}
+
+	for src, msg := range map[string]string{
+		"@schema C\n@field A string\n@computed B expr=Missing + A\n": `unknown field "Missing"`,
+		"@schema C\n@field A string\n@computed A expr=A + A\n":       "duplicates another field",
+		"@schema C\n@field A string\n@computed B expr=A * 2\n":       "operator * needs numbers",
+		"@schema C\n@field A bool\n@computed B expr=A + 1\n":         "cannot be used in an expression",
+		"@schema C\n@field A int64\n@computed B expr=(A + 1\n":       "missing )",
+		"@schema C\n@field A int64\n@computed B A + 1\n":             "must be Name expr=<expression>",
+		"@schema C\n@field A int64\n@computed B expr=A +\n":          "expression ends early",
+		"@computed B expr=1\n@schema C\n@field A int64\n":            "@computed outside of schema",
+	} {
+		if _, err := schema.Parse(strings.NewReader(src)); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Fatalf("parse %q: expected %q, got %v", src, msg, err)
+		}
+	}
+}
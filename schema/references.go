@@ -0,0 +1,135 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// DanglingReference is a ref field value in a document's inline data with no
+// matching key among the target schema's rows.
+type DanglingReference struct {
+	Schema       string
+	Row          int // index into Document.Data[Schema]
+	Field        string
+	TargetSchema string
+	TargetField  string
+	Value        interface{}
+}
+
+func (r DanglingReference) String() string {
+	return fmt.Sprintf("%s row %d field %s: %v has no match in %s.%s", r.Schema, r.Row, r.Field, r.Value, r.TargetSchema, r.TargetField)
+}
+
+// ValidateReferences checks the inline data rows of d: every value of a ref
+// field must equal the target field of some row of the target schema. It
+// returns the dangling references ordered by schema name, row, and field,
+// or nil when every reference resolves. Rows that leave a ref field out are
+// not checked.
+//
+// An auto_increment target that a row leaves implicit takes the value the
+// row would be assigned: one more than the largest value the field has
+// seen in earlier rows, starting at 1.
+func (d *Document) ValidateReferences() []DanglingReference {
+	if d == nil {
+		return nil
+	}
+	names := make([]string, 0, len(d.Schemas))
+	for name := range d.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Each target key set is built once and shared by every field using it.
+	targets := make(map[string]map[interface{}]struct{})
+	var dangling []DanglingReference
+	for _, name := range names {
+		sch := d.Schemas[name]
+		rows := d.Data[name]
+		if len(rows) == 0 {
+			continue
+		}
+		for _, field := range sch.Fields {
+			if !field.IsReference() {
+				continue
+			}
+			target := field.TargetSchema + "." + field.TargetField
+			keys, ok := targets[target]
+			if !ok {
+				keys = d.referenceKeys(field.TargetSchema, field.TargetField)
+				targets[target] = keys
+			}
+			for i, row := range rows {
+				value, ok := row[field.Name]
+				if !ok || value == nil {
+					continue
+				}
+				if _, found := keys[referenceKey(value)]; found {
+					continue
+				}
+				dangling = append(dangling, DanglingReference{
+					Schema:       name,
+					Row:          i,
+					Field:        field.Name,
+					TargetSchema: field.TargetSchema,
+					TargetField:  field.TargetField,
+					Value:        value,
+				})
+			}
+		}
+	}
+	sort.SliceStable(dangling, func(i, j int) bool {
+		a, b := dangling[i], dangling[j]
+		if a.Schema != b.Schema {
+			return a.Schema < b.Schema
+		}
+		return a.Row < b.Row
+	})
+	return dangling
+}
+
+// referenceKeys collects the values of field across the rows of schemaName.
+func (d *Document) referenceKeys(schemaName, fieldName string) map[interface{}]struct{} {
+	rows := d.Data[schemaName]
+	keys := make(map[interface{}]struct{}, len(rows))
+	sch, ok := d.Schemas[schemaName]
+	if !ok {
+		return keys
+	}
+	idx, ok := sch.FieldIndex(fieldName)
+	if !ok {
+		return keys
+	}
+	auto := sch.Fields[idx].AutoIncrement
+	var next uint64 = 1
+	for _, row := range rows {
+		value, ok := row[fieldName]
+		if !ok || value == nil {
+			if !auto {
+				continue
+			}
+			value = next
+		}
+		if n, isUint := value.(uint64); auto && isUint && n >= next {
+			next = n + 1
+		}
+		keys[referenceKey(value)] = struct{}{}
+	}
+	return keys
+}
+
+// referenceKey turns a parsed data value into a comparable map key: bytes
+// compare by content and times by instant.
+func referenceKey(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC()
+	}
+	if !reflect.TypeOf(value).Comparable() {
+		return fmt.Sprint(value)
+	}
+	return value
+}
@@ -0,0 +1,77 @@
+package schema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+func TestValidateReferences(t *testing.T) {
+	const schemas = `@schema User
+@field ID uint64 auto_increment
+@field Name string
+
+@schema Tag
+@field Code uint64
+@field Label string
+
+@schema Message
+@field MsgID uint64 auto_increment
+@field User ref:User:ID
+@field Tag ref:Tag:Code
+@field Text string
+`
+	// Users 1 and 2 are implicit, 10 is explicit, and the row after it
+	// continues at 11.
+	const users = `
+@User
+"Ada"
+"Grace"
+@ID=10, "Linus"
+"Ken"
+
+@Tag
+100, "news"
+200, "chat"
+`
+	valid := schemas + users + `
+@Message
+1, 100, "first"
+2, 200, "second"
+11, 100, "third"
+@Text="no refs"
+`
+	doc, err := schema.Parse(strings.NewReader(valid))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if dangling := doc.ValidateReferences(); len(dangling) != 0 {
+		t.Fatalf("expected no dangling references, got %v", dangling)
+	}
+
+	invalid := schemas + users + `
+@Message
+1, 100, "ok"
+3, 200, "no user 3"
+10, 300, "no tag 300"
+`
+	doc, err = schema.Parse(strings.NewReader(invalid))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	dangling := doc.ValidateReferences()
+	if len(dangling) != 2 {
+		t.Fatalf("expected 2 dangling references, got %v", dangling)
+	}
+	first, second := dangling[0], dangling[1]
+	if first.Schema != "Message" || first.Row != 1 || first.Field != "User" || first.TargetSchema != "User" || first.Value != uint64(3) {
+		t.Fatalf("unexpected first dangling reference %+v", first)
+	}
+	if second.Row != 2 || second.Field != "Tag" || second.TargetField != "Code" || second.Value != uint64(300) {
+		t.Fatalf("unexpected second dangling reference %+v", second)
+	}
+	if got := first.String(); got != "Message row 1 field User: 3 has no match in User.ID" {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"sort"
@@ -13,10 +14,15 @@ import (
 	"time"
 )
 
+// DefaultHistoryDepth is the number of superseded versions a registry keeps
+// per document unless SetHistoryDepth changes it.
+const DefaultHistoryDepth = 10
+
 // DocumentRegistry keeps multiple SCRT documents in memory along with their raw DSL and payloads.
 type DocumentRegistry struct {
-	mu   sync.RWMutex
-	docs map[string]*registryDocument
+	mu           sync.RWMutex
+	docs         map[string]*registryDocument
+	historyDepth int
 }
 
 type registryDocument struct {
@@ -26,6 +32,15 @@ type registryDocument struct {
 	source  string
 	updated time.Time
 	payload []byte
+	history []DocumentVersion // superseded versions, newest first
+}
+
+// DocumentVersion is one stored revision of a document's DSL.
+type DocumentVersion struct {
+	Fingerprint string    `json:"fingerprint"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Source      string    `json:"source"`
+	DSL         string    `json:"dsl"`
 }
 
 // DocumentSummary describes a stored SCRT document.
@@ -35,16 +50,37 @@ type DocumentSummary struct {
 	SchemaCount int       `json:"schemaCount"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 	Source      string    `json:"source"`
+	// Metadata maps each schema that declares @meta lines to them.
+	Metadata map[string]map[string]string `json:"metadata,omitempty"`
+	// Docs maps each schema that has a @doc description to it.
+	Docs map[string]string `json:"docs,omitempty"`
 }
 
 // NewDocumentRegistry creates an empty registry.
 func NewDocumentRegistry() *DocumentRegistry {
-	return &DocumentRegistry{docs: make(map[string]*registryDocument)}
+	return &DocumentRegistry{docs: make(map[string]*registryDocument), historyDepth: DefaultHistoryDepth}
 }
 
-// LoadFile reads a .scrt file from disk and stores it under the provided name.
+// SetHistoryDepth sets how many superseded versions are kept per document.
+// Zero disables history; existing histories are trimmed to the new depth.
+func (r *DocumentRegistry) SetHistoryDepth(depth int) {
+	if depth < 0 {
+		depth = 0
+	}
+	r.mu.Lock()
+	r.historyDepth = depth
+	for _, entry := range r.docs {
+		if len(entry.history) > depth {
+			entry.history = entry.history[:depth]
+		}
+	}
+	r.mu.Unlock()
+}
+
+// LoadFile reads a .scrt or gzipped .scrt.gz file from disk and stores it
+// under the provided name.
 func (r *DocumentRegistry) LoadFile(name, path string) (*Document, error) {
-	data, err := os.ReadFile(path)
+	data, err := ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -53,13 +89,14 @@ func (r *DocumentRegistry) LoadFile(name, path string) (*Document, error) {
 		return nil, err
 	}
 	if name == "" {
-		base := filepath.Base(path)
+		base := strings.TrimSuffix(filepath.Base(path), ".gz")
 		name = strings.TrimSuffix(base, filepath.Ext(base))
 	}
 	return r.Upsert(name, data, path, info.ModTime())
 }
 
-// Upsert parses raw SCRT DSL bytes and stores/overwrites the document.
+// Upsert parses raw SCRT DSL bytes and stores/overwrites the document. Like
+// Parse, it refuses @include with ErrIncludeNotAllowed.
 func (r *DocumentRegistry) Upsert(name string, raw []byte, source string, updatedAt time.Time) (*Document, error) {
 	if len(bytes.TrimSpace(raw)) == 0 {
 		return nil, fmt.Errorf("schema body cannot be empty")
@@ -84,19 +121,121 @@ func (r *DocumentRegistry) Upsert(name string, raw []byte, source string, update
 	if updatedAt.IsZero() {
 		updatedAt = time.Now().UTC()
 	}
-	entry := &registryDocument{
+	r.mu.Lock()
+	r.install(&registryDocument{
 		name:    schemaName,
 		doc:     normalized,
 		raw:     append([]byte(nil), raw...),
 		source:  source,
 		updated: updatedAt,
-	}
-	r.mu.Lock()
-	r.docs[schemaName] = entry
+	})
 	r.mu.Unlock()
 	return normalized, nil
 }
 
+// install makes entry the current version of its document, pushing the
+// previous version onto the history. The stored payload carries over when
+// the schema fingerprint is unchanged; otherwise it is dropped and callers
+// that know the columns still match (see SameLayout) rebind and restore it
+// with codec.Rebind and SetPayload. Callers hold r.mu.
+func (r *DocumentRegistry) install(entry *registryDocument) {
+	prev, ok := r.docs[entry.name]
+	if ok {
+		entry.history = append([]DocumentVersion{prev.version()}, prev.history...)
+		if len(entry.history) > r.historyDepth {
+			entry.history = entry.history[:r.historyDepth]
+		}
+		if prev.payload != nil && sameFingerprint(prev.doc.Schemas[prev.name], entry.doc.Schemas[entry.name]) {
+			entry.payload = prev.payload
+		}
+	}
+	r.docs[entry.name] = entry
+}
+
+func (e *registryDocument) version() DocumentVersion {
+	return DocumentVersion{
+		Fingerprint: fmt.Sprintf("%016x", documentFingerprint(e.doc)),
+		UpdatedAt:   e.updated,
+		Source:      e.source,
+		DSL:         string(e.raw),
+	}
+}
+
+// History returns the stored versions of a document, newest first. The first
+// entry is the current version.
+func (r *DocumentRegistry) History(name string) []DocumentVersion {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.docs[name]
+	if !ok {
+		return nil
+	}
+	out := make([]DocumentVersion, 0, len(entry.history)+1)
+	out = append(out, entry.version())
+	return append(out, entry.history...)
+}
+
+// Rollback makes the stored version with the given fingerprint current again.
+// The version it replaces joins the history, and the payload is kept when
+// the restored schema has the same field layout.
+func (r *DocumentRegistry) Rollback(name string, fingerprint string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.docs[name]
+	if !ok {
+		return os.ErrNotExist
+	}
+	if entry.version().Fingerprint == fingerprint {
+		return nil
+	}
+	pos := -1
+	for i, v := range entry.history {
+		if v.Fingerprint == fingerprint {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return fmt.Errorf("schema %s has no version %s: %w", name, fingerprint, os.ErrNotExist)
+	}
+	target := entry.history[pos]
+	doc, err := Parse(strings.NewReader(target.DSL))
+	if err != nil {
+		return err
+	}
+	restored := &registryDocument{
+		name:    name,
+		doc:     ensureSingleEntryDocument(doc, name),
+		raw:     []byte(target.DSL),
+		source:  target.Source,
+		updated: time.Now().UTC(),
+	}
+	restored.doc.Source = target.Source
+	entry.history = append(entry.history[:pos:pos], entry.history[pos+1:]...)
+	r.install(restored)
+	return nil
+}
+
+func sameFingerprint(a, b *Schema) bool {
+	return a != nil && b != nil && a.Fingerprint() == b.Fingerprint()
+}
+
+// SameLayout reports whether two schemas encode identical columns: the same
+// field names, storage kinds, and list element kinds in the same order. A
+// payload written for a can be read with b after codec.Rebind.
+func SameLayout(a, b *Schema) bool {
+	if len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	for i := range a.Fields {
+		fa, fb := a.Fields[i], b.Fields[i]
+		if fa.Name != fb.Name || fa.ValueKind() != fb.ValueKind() || fa.ElemKind != fb.ElemKind {
+			return false
+		}
+	}
+	return true
+}
+
 // Snapshot returns the parsed document, raw DSL, and timestamp for a document name.
 func (r *DocumentRegistry) Snapshot(name string) (*Document, []byte, time.Time, error) {
 	r.mu.RLock()
@@ -121,6 +260,8 @@ func (r *DocumentRegistry) List() []DocumentSummary {
 			SchemaCount: len(entry.doc.Schemas),
 			UpdatedAt:   entry.updated,
 			Source:      entry.source,
+			Metadata:    documentMetadata(entry.doc),
+			Docs:        documentDocs(entry.doc),
 		})
 	}
 	return out
@@ -139,6 +280,13 @@ func (r *DocumentRegistry) Payload(schemaName string) ([]byte, bool) {
 
 // SetPayload saves/overwrites the payload bytes for a schema.
 func (r *DocumentRegistry) SetPayload(schemaName string, data []byte) error {
+	return r.setPayload(schemaName, data, true)
+}
+
+// setPayload stores data as the payload of schemaName. Without replace a
+// payload the registry already holds is kept and the update time is left
+// alone, as LoadFrom needs.
+func (r *DocumentRegistry) setPayload(schemaName string, data []byte, replace bool) error {
 	if schemaName == "" {
 		return fmt.Errorf("schema name cannot be empty")
 	}
@@ -148,6 +296,12 @@ func (r *DocumentRegistry) SetPayload(schemaName string, data []byte) error {
 	if !ok {
 		return os.ErrNotExist
 	}
+	if !replace {
+		if entry.payload == nil {
+			entry.payload = append([]byte(nil), data...)
+		}
+		return nil
+	}
 	entry.payload = append([]byte(nil), data...)
 	entry.updated = time.Now().UTC()
 	return nil
@@ -247,5 +401,38 @@ func ensureSingleEntryDocument(doc *Document, schemaName string) *Document {
 		Schemas: map[string]*Schema{schemaName: schema},
 		Data:    data,
 		Source:  doc.Source,
+		raw:     doc.raw,
+	}
+}
+
+// documentDocs collects the @doc descriptions of doc's schemas, or nil when
+// none has one.
+func documentDocs(doc *Document) map[string]string {
+	var out map[string]string
+	for name, sch := range doc.Schemas {
+		if sch.Doc == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[name] = sch.Doc
 	}
+	return out
+}
+
+// documentMetadata collects the @meta annotations of doc's schemas, or nil
+// when none has any.
+func documentMetadata(doc *Document) map[string]map[string]string {
+	var out map[string]map[string]string
+	for name, sch := range doc.Schemas {
+		if len(sch.Metadata) == 0 {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]map[string]string)
+		}
+		out[name] = maps.Clone(sch.Metadata)
+	}
+	return out
 }
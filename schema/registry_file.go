@@ -0,0 +1,134 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/scrt/internal/atomicfile"
+)
+
+// Registry directory layout written by SaveTo: per document, the DSL in
+// <name>.scrt (the layout the server's schema directory uses), the payload in
+// <name>.payload when one is set, and the source and update time in
+// <name>.json. The .payload suffix is never used by storage snapshots, so a
+// registry directory can sit beside a store without touching its files.
+const (
+	registryDSLExt     = ".scrt"
+	registryPayloadExt = ".payload"
+	registryMetaExt    = ".json"
+)
+
+// registryFileMeta is the <name>.json sidecar.
+type registryFileMeta struct {
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SaveTo writes every document's DSL and payload under dir, creating it when
+// needed. Each file is replaced atomically, and the payload file of a
+// document without a payload is removed so LoadFrom sees the same state.
+// History is not saved.
+func (r *DocumentRegistry) SaveTo(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	type saved struct {
+		meta    registryFileMeta
+		raw     []byte
+		payload []byte
+	}
+	r.mu.RLock()
+	docs := make([]saved, 0, len(r.docs))
+	for name, entry := range r.docs {
+		docs = append(docs, saved{
+			meta:    registryFileMeta{Name: name, Source: entry.source, UpdatedAt: entry.updated},
+			raw:     entry.raw,
+			payload: entry.payload,
+		})
+	}
+	r.mu.RUnlock()
+	// DSL and payload slices are swapped out, never written in place, so
+	// they are safe to read after the lock is released.
+	for _, doc := range docs {
+		base := filepath.Join(dir, doc.meta.Name)
+		if err := atomicfile.Write(base+registryDSLExt, doc.raw); err != nil {
+			return err
+		}
+		if doc.payload != nil {
+			if err := atomicfile.Write(base+registryPayloadExt, doc.payload); err != nil {
+				return err
+			}
+		} else if err := os.Remove(base + registryPayloadExt); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		meta, err := json.MarshalIndent(doc.meta, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := atomicfile.Write(base+registryMetaExt, meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFrom restores the documents SaveTo wrote to dir. A document whose DSL
+// matches the registered one is left as is; others are upserted, so the
+// registered version moves to the history. A saved payload is only applied
+// when the registry holds none for that document, which keeps payloads that
+// were already loaded from a storage backend. Loading stops at the first
+// document that fails to parse.
+func (r *DocumentRegistry) LoadFrom(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), registryDSLExt) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		base := filepath.Join(dir, name)
+		raw, err := os.ReadFile(base + registryDSLExt)
+		if err != nil {
+			return err
+		}
+		meta := registryFileMeta{Source: base + registryDSLExt}
+		if data, err := os.ReadFile(base + registryMetaExt); err == nil {
+			if err := json.Unmarshal(data, &meta); err != nil {
+				return fmt.Errorf("registry %s: %w", name, err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		_, current, _, err := r.Snapshot(name)
+		if err != nil || !bytes.Equal(current, raw) {
+			if _, err := r.Upsert(name, raw, meta.Source, meta.UpdatedAt); err != nil {
+				return fmt.Errorf("registry %s: %w", name, err)
+			}
+		}
+		payload, err := os.ReadFile(base + registryPayloadExt)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.setPayload(name, payload, false); err != nil {
+			return fmt.Errorf("registry %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package schema_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+func TestRegistryHistoryAndRollback(t *testing.T) {
+	reg := schema.NewDocumentRegistry()
+	versions := []string{
+		"@schema Widget\n@field ID uint64\n@field Label string\n",
+		"@schema Widget\n@field ID uint64\n@field Label string default=\"x\"\n",
+		"@schema Widget\n@field ID uint64\n@field Label string\n@field Price float64\n",
+	}
+	var first *schema.Document
+	var payload []byte
+	for i, dsl := range versions {
+		doc, err := reg.Upsert("Widget", []byte(dsl), "test", time.Unix(int64(i+1), 0))
+		if err != nil {
+			t.Fatalf("upsert %d: %v", i, err)
+		}
+		if i == 0 {
+			first = doc
+			sch, _ := doc.Schema("Widget")
+			payload, err = scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Label": "a"}})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if err := reg.SetPayload("Widget", payload); err != nil {
+				t.Fatalf("set payload: %v", err)
+			}
+		}
+		if i == 1 {
+			// Only a default changed: the registry drops the payload, and
+			// the caller can rebind it because the columns still match.
+			if _, ok := reg.Payload("Widget"); ok {
+				t.Fatalf("payload kept across a fingerprint change")
+			}
+			prev, _ := first.Schema("Widget")
+			next, _ := doc.Schema("Widget")
+			if !schema.SameLayout(prev, next) {
+				t.Fatalf("default change should keep the layout")
+			}
+			rebound, err := codec.Rebind(payload, next)
+			if err != nil {
+				t.Fatalf("rebind: %v", err)
+			}
+			if err := reg.SetPayload("Widget", rebound); err != nil {
+				t.Fatalf("set rebound payload: %v", err)
+			}
+			assertPayloadDecodes(t, reg, doc)
+		}
+	}
+
+	history := reg.History("Widget")
+	if len(history) != 3 {
+		t.Fatalf("expected 3 versions, got %d", len(history))
+	}
+	if history[0].DSL != versions[2] || history[2].DSL != versions[0] {
+		t.Fatalf("history not newest first: %+v", history)
+	}
+	if _, ok := reg.Payload("Widget"); ok {
+		t.Fatalf("payload should be dropped when columns change")
+	}
+
+	if err := reg.Rollback("Widget", history[2].Fingerprint); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	doc, raw, _, err := reg.Snapshot("Widget")
+	if err != nil || string(raw) != versions[0] {
+		t.Fatalf("rollback did not restore first version: %q (%v)", raw, err)
+	}
+	sch, _ := doc.Schema("Widget")
+	want, _ := first.Schema("Widget")
+	if sch.Fingerprint() != want.Fingerprint() {
+		t.Fatalf("restored schema fingerprint differs")
+	}
+	after := reg.History("Widget")
+	if len(after) != 3 || after[0].DSL != versions[0] || after[1].DSL != versions[2] || after[2].DSL != versions[1] {
+		t.Fatalf("unexpected history after rollback: %+v", after)
+	}
+	if err := reg.Rollback("Widget", "0000000000000000"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for unknown version, got %v", err)
+	}
+
+	reg.SetHistoryDepth(1)
+	if got := reg.History("Widget"); len(got) != 2 {
+		t.Fatalf("expected current plus 1 version after trimming, got %d", len(got))
+	}
+}
+
+func assertPayloadDecodes(t *testing.T, reg *schema.DocumentRegistry, doc *schema.Document) {
+	t.Helper()
+	payload, ok := reg.Payload("Widget")
+	if !ok {
+		t.Fatalf("payload missing for compatible schema")
+	}
+	sch, _ := doc.Schema("Widget")
+	var rows []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &rows); err != nil || len(rows) != 1 {
+		t.Fatalf("carried payload unreadable: %v (%d rows)", err, len(rows))
+	}
+}
+
+func TestRegistrySaveToLoadFrom(t *testing.T) {
+	const widgetDSL = "@schema Widget\n@field ID uint64\n@field Label string\n"
+	const gadgetDSL = "@schema Gadget\n@field ID uint64\n"
+	reg := schema.NewDocumentRegistry()
+	updated := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+	doc, err := reg.Upsert("Widget", []byte(widgetDSL), "widget.scrt", updated)
+	if err != nil {
+		t.Fatalf("upsert widget: %v", err)
+	}
+	if _, err := reg.Upsert("Gadget", []byte(gadgetDSL), "gadget.scrt", updated); err != nil {
+		t.Fatalf("upsert gadget: %v", err)
+	}
+	sch, _ := doc.Schema("Widget")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Label": "a"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := reg.SetPayload("Widget", payload); err != nil {
+		t.Fatalf("set payload: %v", err)
+	}
+	_, _, savedAt, err := reg.Snapshot("Widget")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	dir := t.TempDir()
+	if err := reg.SaveTo(dir); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	restored := schema.NewDocumentRegistry()
+	if err := restored.LoadFrom(dir); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	restoredDoc, raw, at, err := restored.Snapshot("Widget")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if string(raw) != widgetDSL || !at.Equal(savedAt) || restoredDoc.Source != "widget.scrt" {
+		t.Fatalf("restored widget: dsl=%q updated=%v source=%q", raw, at, restoredDoc.Source)
+	}
+	assertPayloadDecodes(t, restored, restoredDoc)
+	if !restored.HasSchema("Gadget") {
+		t.Fatalf("gadget not restored")
+	}
+	if _, ok := restored.Payload("Gadget"); ok {
+		t.Fatalf("gadget had no payload but one was restored")
+	}
+
+	// A payload the registry already holds, e.g. from the store, is kept.
+	storePayload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(2), "Label": "from store"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	booted := schema.NewDocumentRegistry()
+	if _, err := booted.Upsert("Widget", []byte(widgetDSL), "widget.scrt", updated); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if err := booted.SetPayload("Widget", storePayload); err != nil {
+		t.Fatalf("set payload: %v", err)
+	}
+	if err := booted.LoadFrom(dir); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got, _ := booted.Payload("Widget"); string(got) != string(storePayload) {
+		t.Fatalf("LoadFrom clobbered the existing payload")
+	}
+	if n := len(booted.History("Widget")); n != 1 {
+		t.Fatalf("unchanged DSL should not add history, got %d versions", n)
+	}
+
+	// Clearing a payload and saving again removes the payload file.
+	reg.ClearPayload("Widget")
+	if err := reg.SaveTo(dir); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Widget.payload")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected Widget.payload to be removed, got %v", err)
+	}
+}
@@ -2,7 +2,8 @@ package schema
 
 import "fmt"
 
-// finalize resolves reference kinds and pending defaults after parsing.
+// finalize resolves reference kinds and pending defaults after parsing, then
+// validates each schema.
 func (d *Document) finalize() error {
 	if d == nil {
 		return nil
@@ -12,6 +13,11 @@ func (d *Document) finalize() error {
 			return err
 		}
 	}
+	for _, sch := range d.Schemas {
+		if err := sch.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -35,7 +41,7 @@ func (d *Document) resolveFieldKind(s *Schema, idx int, stack map[string]bool) (
 	if field.Kind != KindRef {
 		field.ResolvedKind = field.Kind
 		if field.pendingDefault != "" && field.Default == nil {
-			def, err := parseDefaultLiteral(field.ResolvedKind, field.pendingDefault)
+			def, err := parseDefaultLiteral(field.ResolvedKind, field.EpochUnit, field.pendingDefault)
 			if err != nil {
 				return KindInvalid, fmt.Errorf("scrt: schema %s field %s default: %w", s.Name, field.Name, err)
 			}
@@ -66,7 +72,7 @@ func (d *Document) resolveFieldKind(s *Schema, idx int, stack map[string]bool) (
 	delete(stack, key)
 
 	if field.pendingDefault != "" && field.Default == nil {
-		def, err := parseDefaultLiteral(field.ResolvedKind, field.pendingDefault)
+		def, err := parseDefaultLiteral(field.ResolvedKind, field.EpochUnit, field.pendingDefault)
 		if err != nil {
 			return KindInvalid, fmt.Errorf("scrt: schema %s field %s default: %w", s.Name, field.Name, err)
 		}
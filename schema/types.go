@@ -3,8 +3,11 @@ package schema
 import (
 	"hash/fnv"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/oarkflow/scrt/temporal"
 )
 
 // FieldKind identifies the primitive storage category for a field.
@@ -24,6 +27,36 @@ const (
 	KindTimestamp
 	KindTimestampTZ
 	KindDuration
+	KindUUID
+	// KindList holds a variable number of ElemKind values per row.
+	KindList
+	// KindTime is a time of day stored as nanoseconds since midnight.
+	KindTime
+)
+
+// MaxRowsPerPage is the largest page size @pragma rows_per_page accepts.
+// Writers buffer a whole page, so larger pages mostly cost memory.
+const MaxRowsPerPage = 1 << 20
+
+// StringEncoding selects how the pages of a string field store its values.
+type StringEncoding uint8
+
+const (
+	// StringEncodingAuto uses a dictionary, or with the writer's
+	// AutoPlainStrings option, whichever layout is smaller for the page.
+	StringEncodingAuto StringEncoding = iota
+	// StringEncodingDict always uses a dictionary, even with
+	// AutoPlainStrings.
+	StringEncodingDict
+	// StringEncodingPlain always stores length-prefixed values in row order
+	// and skips building the dictionary. Every writer then flags the column
+	// with page.PlainStringFlag, whatever its options; the TypeScript
+	// decoder and older Go readers cannot read such pages.
+	StringEncodingPlain
+	// StringEncodingGlobal keeps one dictionary for the whole stream: a page
+	// only carries values earlier pages did not. Pages then depend on the
+	// pages before them and must be decoded in order.
+	StringEncodingGlobal
 )
 
 // Field models a single field declaration inside a schema.
@@ -34,6 +67,14 @@ type Field struct {
 	TargetField   string
 	AutoIncrement bool
 	RawType       string
+	ElemKind      FieldKind          // element kind of KindList fields
+	EpochUnit     temporal.EpochUnit // epoch precision of timestamp(s|ms|us|ns) fields
+	Aliases       []string           // alternate struct field names, from alias= attributes
+	Codec         string             // registered ValueCodec of a bytes field, from codec= attributes
+	Enum          []string           // allowed values of a string field, from enum=a|b attributes
+	Sensitive     bool               // withheld from untrusted JSON responses, from the sensitive attribute
+	Encoding      StringEncoding     // page layout of a string field, from encoding=dict|plain|global attributes
+	Doc           string             // human description from @doc lines; not part of the fingerprint
 	Attributes    []string
 	Default       *DefaultValue
 
@@ -45,6 +86,20 @@ type Field struct {
 type Schema struct {
 	Name   string
 	Fields []Field
+	// Metadata holds the schema's @meta key=value annotations, such as an
+	// owner or a PII flag, or nil when it has none. It does not describe
+	// the data, so it is left out of the fingerprint.
+	Metadata map[string]string
+	// Doc is the description given by @doc lines ahead of the first field.
+	// Like Metadata, it is left out of the fingerprint.
+	Doc string
+	// RowsPerPage is the page size declared by @pragma rows_per_page, or 0
+	// for the writer default. The parser accepts at most MaxRowsPerPage.
+	// Callers may override it, so it is left out of the fingerprint.
+	RowsPerPage int
+	// Computed holds the @computed fields derived from Fields on decode.
+	// They are never stored, so they are left out of the fingerprint.
+	Computed []ComputedField
 
 	once        sync.Once
 	fingerprint uint64
@@ -66,6 +121,10 @@ func (s *Schema) Fingerprint() uint64 {
 			write(f.Name)
 			write(":")
 			write(f.RawType)
+			if f.Kind == KindList {
+				write("[]")
+				write(strconv.Itoa(int(f.ElemKind)))
+			}
 			if f.TargetSchema != "" {
 				write("->")
 				write(f.TargetSchema)
@@ -83,6 +142,11 @@ func (s *Schema) Fingerprint() uint64 {
 					write(attr)
 				}
 			}
+			if len(f.Enum) > 0 {
+				// Attributes are lowercased, so keep the values' case here.
+				write("=enum:")
+				write(strings.Join(f.Enum, "|"))
+			}
 			if f.Default != nil {
 				write("=def:")
 				write(f.Default.hashKey())
@@ -114,6 +178,17 @@ func (s *Schema) FieldByName(name string) (*Field, bool) {
 	return &s.Fields[idx], true
 }
 
+// GlobalStrings reports whether any string field declares encoding=global,
+// so that streams written with s must be decoded page by page in order.
+func (s *Schema) GlobalStrings() bool {
+	for _, f := range s.Fields {
+		if f.Kind == KindString && f.Encoding == StringEncodingGlobal {
+			return true
+		}
+	}
+	return false
+}
+
 // ValueKind reports the effective storage kind for the field.
 // Reference fields resolve to the target field's kind when available.
 func (f Field) ValueKind() FieldKind {
@@ -0,0 +1,71 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reservedFieldNames collide with DSL keywords and would be misclassified by
+// the line parser.
+var reservedFieldNames = map[string]struct{}{
+	"fields": {},
+	"field":  {},
+	"schema": {},
+}
+
+// ValidateFieldName rejects names that collide with DSL keywords or contain
+// characters the parser treats as separators.
+func ValidateFieldName(name string) error {
+	if _, reserved := reservedFieldNames[strings.ToLower(name)]; reserved {
+		return fmt.Errorf("field name %q is reserved", name)
+	}
+	if strings.ContainsAny(name, "@,") {
+		return fmt.Errorf("field name %q must not contain '@' or ','", name)
+	}
+	return nil
+}
+
+// Validate reports attribute combinations that would otherwise only fail at
+// encode or persist time: reserved or duplicate field names, auto_increment on
+// non-uint64 fields, and unique/uuid attributes on kinds that cannot be indexed.
+func (s *Schema) Validate() error {
+	if s == nil {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(s.Fields))
+	for _, field := range s.Fields {
+		if err := ValidateFieldName(field.Name); err != nil {
+			return fmt.Errorf("scrt: schema %s field %s: %w", s.Name, field.Name, err)
+		}
+		if _, dup := seen[field.Name]; dup {
+			return fmt.Errorf("scrt: schema %s field %s declared more than once", s.Name, field.Name)
+		}
+		seen[field.Name] = struct{}{}
+
+		if field.AutoIncrement && field.Kind != KindUint64 {
+			return fmt.Errorf("scrt: schema %s field %s: auto_increment requires uint64, got %s", s.Name, field.Name, field.RawType)
+		}
+		if field.HasAttribute("uuid") || field.HasAttribute("uuidv7") {
+			if kind := field.ValueKind(); kind != KindString && kind != KindUUID {
+				return fmt.Errorf("scrt: schema %s field %s: uuid attribute requires string or uuid, got %s", s.Name, field.Name, field.RawType)
+			}
+		}
+		if field.HasAttribute("unique") && !IndexableKind(field.ValueKind()) {
+			return fmt.Errorf("scrt: schema %s field %s: unique is not supported on %s fields", s.Name, field.Name, field.RawType)
+		}
+	}
+	return nil
+}
+
+// IndexableKind reports whether kind can back a unique key. Storage column
+// indexes also accept float64 and bool fields, but those make poor unique keys
+// and are left to explicit index specs.
+func IndexableKind(kind FieldKind) bool {
+	switch kind {
+	case KindUint64, KindRef, KindString, KindUUID, KindInt64,
+		KindDate, KindDateTime, KindTimestamp, KindTimestampTZ, KindDuration, KindTime:
+		return true
+	default:
+		return false
+	}
+}
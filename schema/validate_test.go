@@ -0,0 +1,99 @@
+package schema_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+func TestValidateRejectsInvalidCombinations(t *testing.T) {
+	cases := []struct {
+		name  string
+		src   string
+		field string
+	}{
+		{
+			name:  "auto increment string",
+			src:   "@schema Bad\n@field Code string auto_increment\n",
+			field: "Code",
+		},
+		{
+			name:  "auto increment int64",
+			src:   "@schema Bad\n@field Seq int64 serial\n",
+			field: "Seq",
+		},
+		{
+			name:  "unique bytes",
+			src:   "@schema Bad\n@field Blob bytes unique\n",
+			field: "Blob",
+		},
+		{
+			name:  "unique float",
+			src:   "@schema Bad\n@field Score float64 unique\n",
+			field: "Score",
+		},
+		{
+			name:  "uuid attribute on uint64",
+			src:   "@schema Bad\n@field ID uint64 uuid\n",
+			field: "ID",
+		},
+		{
+			name:  "duplicate field",
+			src:   "@schema Bad\n@field Name string\n@field Name string\n",
+			field: "Name",
+		},
+	}
+	for _, tc := range cases {
+		_, err := schema.Parse(strings.NewReader(tc.src))
+		if err == nil {
+			t.Fatalf("%s: expected validation error", tc.name)
+		}
+		if !strings.Contains(err.Error(), "field "+tc.field) {
+			t.Fatalf("%s: error %q does not name field %s", tc.name, err, tc.field)
+		}
+	}
+}
+
+func TestParseRejectsReservedFieldNames(t *testing.T) {
+	for _, src := range []string{
+		"@schema Bad\n@field fields string\n",
+		"@schema Bad\n@field @id uint64\n",
+		"@schema Bad\nfields\nSchema string\n",
+		"@schema Bad\n@field first,last string\n",
+	} {
+		if _, err := schema.Parse(strings.NewReader(src)); err == nil {
+			t.Fatalf("expected error for %q", src)
+		}
+	}
+
+	built := &schema.Schema{Name: "Bad", Fields: []schema.Field{{Name: "@id", Kind: schema.KindUint64, RawType: "uint64"}}}
+	if err := built.Validate(); err == nil || !strings.Contains(err.Error(), "field @id") {
+		t.Fatalf("expected Validate to reject @id, got %v", err)
+	}
+}
+
+func TestValidateAcceptsSampleSchemas(t *testing.T) {
+	for _, path := range []string{"../data.scrt", "../schemas/User.scrt"} {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("open %s: %v", path, err)
+		}
+		doc, err := schema.Parse(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("parse %s: %v", path, err)
+		}
+		for name, sch := range doc.Schemas {
+			if err := sch.Validate(); err != nil {
+				t.Fatalf("%s schema %s: %v", path, name, err)
+			}
+		}
+	}
+
+	valid := "@schema Good\n@field ID uint64 auto_increment\n@field Email string unique\n@field Key uuid unique\n@field Token string uuidv7\n"
+	if _, err := schema.Parse(strings.NewReader(valid)); err != nil {
+		t.Fatalf("expected valid schema, got %v", err)
+	}
+}
@@ -12,8 +12,16 @@ type Backend interface {
 	LoadPayload(schemaName string) ([]byte, error)
 	Delete(schemaName string) error
 	NextAutoValue(schemaName string, sch *schema.Schema, field string) (uint64, error)
+	SetAutoCounter(schemaName string, sch *schema.Schema, field string, value uint64) error
+	ResetAutoCounters(schemaName string) error
 	LoadMeta(schemaName string) (*SnapshotMeta, error)
 	ListMeta() ([]*SnapshotMeta, error)
+	Reindex(schemaName string, sch *schema.Schema, specs []IndexSpec) error
+	Vacuum(schemaName string, sch *schema.Schema) (*SnapshotMeta, error)
+	Tombstones(schemaName string) ([]uint64, error)
+	SetTombstones(schemaName string, rowIDs []uint64) error
+	AddTombstone(schemaName string, rowID uint64) error
+	RemoveTombstones(schemaName string, rowIDs []uint64) error
 }
 
 // SnapshotBackend wraps SnapshotStore to satisfy the Backend interface for
@@ -63,6 +71,22 @@ func (b *SnapshotBackend) NextAutoValue(schemaName string, sch *schema.Schema, f
 	return b.store.NextAutoValue(schemaName, sch, field)
 }
 
+// SetAutoCounter overrides the next auto-increment value for field.
+func (b *SnapshotBackend) SetAutoCounter(schemaName string, sch *schema.Schema, field string, value uint64) error {
+	if b == nil {
+		return ErrBackendUnavailable
+	}
+	return b.store.SetAutoCounter(schemaName, sch, field, value)
+}
+
+// ResetAutoCounters forgets persisted counters for schemaName.
+func (b *SnapshotBackend) ResetAutoCounters(schemaName string) error {
+	if b == nil {
+		return ErrBackendUnavailable
+	}
+	return b.store.ResetAutoCounters(schemaName)
+}
+
 func (b *SnapshotBackend) LoadMeta(schemaName string) (*SnapshotMeta, error) {
 	if b == nil {
 		return nil, ErrBackendUnavailable
@@ -77,7 +101,58 @@ func (b *SnapshotBackend) ListMeta() ([]*SnapshotMeta, error) {
 	return b.store.ListMeta()
 }
 
+// Reindex rebuilds the indexes and counters of a stored snapshot from its payload.
+func (b *SnapshotBackend) Reindex(schemaName string, sch *schema.Schema, specs []IndexSpec) error {
+	if b == nil {
+		return ErrBackendUnavailable
+	}
+	return b.store.Reindex(schemaName, sch, specs)
+}
+
+// Vacuum re-pages a stored payload into full pages and rebuilds its indexes.
+func (b *SnapshotBackend) Vacuum(schemaName string, sch *schema.Schema) (*SnapshotMeta, error) {
+	if b == nil {
+		return nil, ErrBackendUnavailable
+	}
+	return b.store.Vacuum(schemaName, sch)
+}
+
+// Tombstones returns the soft-deleted row IDs of a stored snapshot.
+func (b *SnapshotBackend) Tombstones(schemaName string) ([]uint64, error) {
+	if b == nil {
+		return nil, ErrBackendUnavailable
+	}
+	return b.store.Tombstones(schemaName)
+}
+
+// SetTombstones replaces the soft-deleted row IDs of a stored snapshot.
+func (b *SnapshotBackend) SetTombstones(schemaName string, rowIDs []uint64) error {
+	if b == nil {
+		return ErrBackendUnavailable
+	}
+	return b.store.SetTombstones(schemaName, rowIDs)
+}
+
+// AddTombstone soft-deletes one row of a stored snapshot.
+func (b *SnapshotBackend) AddTombstone(schemaName string, rowID uint64) error {
+	if b == nil {
+		return ErrBackendUnavailable
+	}
+	return b.store.AddTombstone(schemaName, rowID)
+}
+
+// RemoveTombstones restores soft-deleted rows of a stored snapshot.
+func (b *SnapshotBackend) RemoveTombstones(schemaName string, rowIDs []uint64) error {
+	if b == nil {
+		return ErrBackendUnavailable
+	}
+	return b.store.RemoveTombstones(schemaName, rowIDs)
+}
+
 var nullBackend *SnapshotBackend
 
 // ErrBackendUnavailable signals that no storage backend was configured.
 var ErrBackendUnavailable = fmt.Errorf("storage: backend unavailable")
+
+// ErrNotAutoIncrement signals a counter operation on a field that is not auto_increment.
+var ErrNotAutoIncrement = fmt.Errorf("storage: field is not auto_increment")
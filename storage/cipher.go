@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// encryptedMagic replaces the SCRT magic at the start of an encrypted
+// payload file, so page reads can tell the two apart without meta.json.
+const encryptedMagic = "SCRE"
+
+// ErrCipherRequired reports an encrypted payload read through a store
+// without StoreOptions.Cipher.
+var ErrCipherRequired = errors.New("storage: payload is encrypted and the store has no cipher")
+
+// ErrPayloadAuthentication reports an encrypted payload that failed AEAD
+// verification: the file was altered, or the key or nonce is wrong.
+var ErrPayloadAuthentication = errors.New("storage: payload failed authentication")
+
+// NewCipher returns an AES-256-GCM AEAD for PersistOptions.Cipher and
+// StoreOptions.Cipher. key must be 32 bytes; keeping it is up to the caller.
+func NewCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("storage: cipher key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealPayload encrypts data for the payload file of schemaName under a fresh
+// random nonce, binding the schema name as additional data so a file moved
+// to another schema fails to open. The file holds the magic, the nonce, and
+// the ciphertext, so a single read yields a matching nonce and ciphertext.
+func sealPayload(aead cipher.AEAD, schemaName string, data []byte) ([]byte, error) {
+	out := make([]byte, len(encryptedMagic)+aead.NonceSize(), len(encryptedMagic)+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(out, encryptedMagic)
+	nonce := out[len(encryptedMagic):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, data, []byte(schemaName)), nil
+}
+
+// openSealed decrypts an encrypted payload file of schemaName.
+func (s *SnapshotStore) openSealed(schemaName string, data []byte) ([]byte, error) {
+	if s.cipher == nil {
+		return nil, ErrCipherRequired
+	}
+	sealed := data[len(encryptedMagic):]
+	if len(sealed) < s.cipher.NonceSize() {
+		return nil, fmt.Errorf("%w: %s", ErrPayloadAuthentication, schemaName)
+	}
+	nonce, sealed := sealed[:s.cipher.NonceSize()], sealed[s.cipher.NonceSize():]
+	plain, err := s.cipher.Open(nil, nonce, sealed, []byte(schemaName))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPayloadAuthentication, schemaName)
+	}
+	return plain, nil
+}
+
+// readPayloadFile returns the stored payload file of schemaName, footer
+// included, decrypting it when it is encrypted.
+func (s *SnapshotStore) readPayloadFile(schemaName string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.root, schemaName, "payload.scrt"))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) {
+		return data, nil
+	}
+	return s.openSealed(schemaName, data)
+}
+
+// cachedPlaintext is the decrypted payload file of a schema as of epoch.
+type cachedPlaintext struct {
+	epoch uint64
+	data  []byte
+}
+
+// openPayload opens the payload file of schemaName for page reads. An
+// encrypted payload is decrypted whole and served from memory, and the
+// plaintext is kept until the payload file changes, so repeated lookups
+// decrypt it once.
+func (s *SnapshotStore) openPayload(schemaName string) (io.ReadSeekCloser, error) {
+	s.plainMu.Lock()
+	epoch := s.payloadEpochs[schemaName]
+	cached, ok := s.plaintexts[schemaName]
+	s.plainMu.Unlock()
+	if ok && cached.epoch == epoch {
+		return nopSeekCloser{bytes.NewReader(cached.data)}, nil
+	}
+	file, err := os.Open(filepath.Join(s.root, schemaName, "payload.scrt"))
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(encryptedMagic))
+	if _, err := io.ReadFull(file, magic); err != nil || string(magic) != encryptedMagic {
+		return file, nil
+	}
+	data, err := io.ReadAll(io.MultiReader(bytes.NewReader(magic), file))
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := s.openSealed(schemaName, data)
+	if err != nil {
+		return nil, err
+	}
+	s.plainMu.Lock()
+	// A rewrite after the epoch was read bumped it, so the old plaintext is
+	// not cached.
+	if s.payloadEpochs[schemaName] == epoch {
+		s.plaintexts[schemaName] = cachedPlaintext{epoch: epoch, data: plain}
+	}
+	s.plainMu.Unlock()
+	return nopSeekCloser{bytes.NewReader(plain)}, nil
+}
+
+// forgetPlaintext drops the cached plaintext of schemaName and bumps its
+// payload epoch. invalidatePages runs it after every payload change.
+func (s *SnapshotStore) forgetPlaintext(schemaName string) {
+	s.plainMu.Lock()
+	s.payloadEpochs[schemaName]++
+	delete(s.plaintexts, schemaName)
+	s.plainMu.Unlock()
+}
+
+type nopSeekCloser struct{ io.ReadSeeker }
+
+func (nopSeekCloser) Close() error { return nil }
@@ -6,28 +6,46 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/oarkflow/scrt/codec"
 	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
 )
 
 const (
 	columnIndexMagic   = "KIDX"
-	columnIndexVersion = uint16(1)
+	columnIndexVersion = uint16(2)
+	// columnIndexVersionV1 files only hold uint64/ref/string/uuid keys and
+	// share the version 2 layout, so they still load.
+	columnIndexVersionV1 = uint16(1)
 )
 
 // IndexSpec declares which schema fields should be indexed when persisting a payload.
 type IndexSpec struct {
 	Field  string
 	Unique bool
+	// PageIndex also records each page's min and max for the field so
+	// ScanRange can skip pages. String and UUID fields are not supported.
+	PageIndex bool
 }
 
-// ColumnIndex materializes a numeric key -> rowID lookup table.
+// ColumnIndex materializes a key -> rowID lookup table. String and UUID keys
+// live in a string table; every other kind is normalized to a uint64 key:
+// int64 and the int64-backed temporal kinds keep their two's-complement bits,
+// timestamptz keys are the UTC instant in nanoseconds, bools are 0 or 1, and
+// float64 keys are their IEEE 754 bits. Float equality is therefore exact:
+// 0 and -0 are different keys, and a NaN only matches a NaN with the same bits.
 type ColumnIndex struct {
 	Field         string
 	Unique        bool
 	Kind          schema.FieldKind
+	Pages         *PageIndex // nil unless the spec asked for a page index
 	uintEntries   map[uint64]uint64
 	stringEntries map[string]uint64
 }
@@ -41,6 +59,22 @@ func (ci *ColumnIndex) LookupUint(key uint64) (uint64, bool) {
 	return rowID, ok
 }
 
+// LookupInt returns the rowID for an int64, date, datetime, timestamp,
+// timestamptz, or duration key in its stored int64 form.
+func (ci *ColumnIndex) LookupInt(key int64) (uint64, bool) {
+	return ci.LookupUint(uint64(key))
+}
+
+// LookupFloat returns the rowID for a float64 key, compared bit for bit.
+func (ci *ColumnIndex) LookupFloat(key float64) (uint64, bool) {
+	return ci.LookupUint(math.Float64bits(key))
+}
+
+// LookupBool returns the rowID for a bool key.
+func (ci *ColumnIndex) LookupBool(key bool) (uint64, bool) {
+	return ci.LookupUint(boolKey(key))
+}
+
 // LookupString returns the rowID for a string key.
 func (ci *ColumnIndex) LookupString(key string) (uint64, bool) {
 	if ci == nil {
@@ -58,9 +92,9 @@ func (ci *ColumnIndex) EntryCount() int {
 	return len(ci.uintEntries) + len(ci.stringEntries)
 }
 
-// MaxKey returns the highest key present in the index.
+// MaxKey returns the highest key present in a uint64 or ref index.
 func (ci *ColumnIndex) MaxKey() (uint64, bool) {
-	if ci == nil || len(ci.uintEntries) == 0 {
+	if ci == nil || len(ci.uintEntries) == 0 || (ci.Kind != schema.KindUint64 && ci.Kind != schema.KindRef) {
 		return 0, false
 	}
 	var max uint64
@@ -74,11 +108,88 @@ func (ci *ColumnIndex) MaxKey() (uint64, bool) {
 	return max, set
 }
 
-// buildColumnIndexes constructs indexes for the provided specs.
-func buildColumnIndexes(sch *schema.Schema, payload []byte, specs []IndexSpec) (map[string]*ColumnIndex, error) {
+// DuplicateKey lists every row that holds Key in a unique field, in row order.
+type DuplicateKey struct {
+	Key  string   `json:"key"`
+	Rows []uint64 `json:"rows"`
+}
+
+// DuplicateReport collects the conflicting keys of each unique index.
+type DuplicateReport struct {
+	Fields map[string][]DuplicateKey `json:"fields"`
+}
+
+// Empty reports whether no duplicates were found.
+func (r *DuplicateReport) Empty() bool {
+	return r == nil || len(r.Fields) == 0
+}
+
+// DryRunIndex scans payload as buildColumnIndexes would but, instead of
+// stopping at the first duplicate unique key, reports every conflicting key
+// per field. Nothing is written. Keys are ordered by the row that first
+// holds them; uint keys use their decimal form and UUIDs their canonical text.
+func DryRunIndex(sch *schema.Schema, payload []byte, specs []IndexSpec) (*DuplicateReport, error) {
+	report := &DuplicateReport{Fields: make(map[string][]DuplicateKey)}
+	if len(specs) == 0 {
+		return report, nil
+	}
+	builders, err := newColumnIndexBuilders(sch, specs)
+	if err != nil {
+		return nil, err
+	}
+	for _, builder := range builders {
+		builder.pages = nil
+	}
+	seen := make(map[string]map[string]int)
+	err = scanColumnIndexes(sch, payload, nil, builders, func(b *columnIndexBuilder, key string, first, rowID uint64) error {
+		byKey := seen[b.Field]
+		if byKey == nil {
+			byKey = make(map[string]int)
+			seen[b.Field] = byKey
+		}
+		if pos, ok := byKey[key]; ok {
+			dup := &report.Fields[b.Field][pos]
+			dup.Rows = append(dup.Rows, rowID)
+			return nil
+		}
+		byKey[key] = len(report.Fields[b.Field])
+		report.Fields[b.Field] = append(report.Fields[b.Field], DuplicateKey{Key: key, Rows: []uint64{first, rowID}})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, keys := range report.Fields {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Rows[0] < keys[j].Rows[0] })
+	}
+	return report, nil
+}
+
+// buildColumnIndexes constructs indexes for the provided specs. rowIndex
+// locates page boundaries for specs that ask for a page index.
+func buildColumnIndexes(sch *schema.Schema, payload []byte, rowIndex *RowIndex, specs []IndexSpec) (map[string]*ColumnIndex, error) {
 	if len(specs) == 0 {
 		return nil, nil
 	}
+	builders, err := newColumnIndexBuilders(sch, specs)
+	if err != nil {
+		return nil, err
+	}
+	err = scanColumnIndexes(sch, payload, rowIndex, builders, func(b *columnIndexBuilder, key string, _, _ uint64) error {
+		return fmt.Errorf("storage: duplicate key %s for field %s", key, b.Field)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]*ColumnIndex, len(builders))
+	for field, builder := range builders {
+		out[field] = builder.ColumnIndex
+	}
+	return out, nil
+}
+
+func newColumnIndexBuilders(sch *schema.Schema, specs []IndexSpec) (map[string]*columnIndexBuilder, error) {
 	builders := make(map[string]*columnIndexBuilder, len(specs))
 	for _, spec := range specs {
 		fieldIdx, ok := sch.FieldIndex(spec.Field)
@@ -87,8 +198,11 @@ func buildColumnIndexes(sch *schema.Schema, payload []byte, specs []IndexSpec) (
 		}
 		field := sch.Fields[fieldIdx]
 		kind := field.ValueKind()
-		if kind != schema.KindUint64 && kind != schema.KindRef && kind != schema.KindString {
-			return nil, fmt.Errorf("storage: field %s must be uint64/ref/string for indexing", spec.Field)
+		if !indexableKind(kind) {
+			return nil, fmt.Errorf("storage: field %s of kind %s cannot be indexed", spec.Field, field.RawType)
+		}
+		if spec.PageIndex && !pageIndexableKind(kind) {
+			return nil, fmt.Errorf("storage: field %s of kind %s cannot have a page index", spec.Field, field.RawType)
 		}
 		if _, exists := builders[spec.Field]; exists {
 			return nil, fmt.Errorf("storage: duplicate index spec for field %s", spec.Field)
@@ -98,17 +212,34 @@ func buildColumnIndexes(sch *schema.Schema, payload []byte, specs []IndexSpec) (
 			Unique: spec.Unique,
 			Kind:   kind,
 		}
-		if kind == schema.KindString {
+		if stringKeyed(kind) {
 			ci.stringEntries = make(map[string]uint64)
 		} else {
 			ci.uintEntries = make(map[uint64]uint64)
 		}
-		builders[spec.Field] = &columnIndexBuilder{
+		builder := &columnIndexBuilder{
 			ColumnIndex: ci,
 			fieldIdx:    fieldIdx,
 		}
+		if spec.PageIndex {
+			ci.Pages = &PageIndex{Field: spec.Field, Kind: kind}
+			builder.pages = &pageIndexBuilder{index: ci.Pages}
+		}
+		builders[spec.Field] = builder
 	}
+	return builders, nil
+}
 
+// scanColumnIndexes fills builders from payload. A repeated key in a unique
+// index is passed to onDuplicate along with the row that first held it; the
+// first row keeps the entry. A non-nil error from onDuplicate stops the scan.
+// Page indexes are filled in the same pass and need rowIndex.
+func scanColumnIndexes(sch *schema.Schema, payload []byte, rowIndex *RowIndex, builders map[string]*columnIndexBuilder, onDuplicate func(b *columnIndexBuilder, key string, first, rowID uint64) error) error {
+	for _, builder := range builders {
+		if builder.pages != nil && rowIndex == nil {
+			return fmt.Errorf("storage: page index for field %s needs a row index", builder.Field)
+		}
+	}
 	reader := codec.NewReader(bytesReader(payload), sch)
 	row := codec.NewRow(sch)
 	var rowID uint64
@@ -118,41 +249,59 @@ func buildColumnIndexes(sch *schema.Schema, payload []byte, specs []IndexSpec) (
 			break
 		}
 		if err != nil {
-			return nil, err
+			return err
 		}
 		values := row.Values()
 		for _, builder := range builders {
 			val := values[builder.fieldIdx]
+			if builder.pages != nil {
+				loc, ok := rowIndex.Lookup(rowID)
+				if !ok {
+					return fmt.Errorf("storage: row %d missing from row index", rowID)
+				}
+				builder.pages.addRow(loc, rowID)
+			}
 			if !val.Set {
 				continue
 			}
 			switch builder.Kind {
-			case schema.KindUint64, schema.KindRef:
-				key := val.Uint
+			case schema.KindString, schema.KindUUID:
+				// Decoded strings borrow the page buffer, which the next page reuses.
+				key := strings.Clone(val.Str)
+				if builder.Kind == schema.KindUUID {
+					key = uuid.FormatBytes(val.Bytes)
+				}
 				if builder.Unique {
-					if _, exists := builder.uintEntries[key]; exists {
-						return nil, fmt.Errorf("storage: duplicate key %d for field %s", key, builder.Field)
+					if first, exists := builder.stringEntries[key]; exists {
+						if err := onDuplicate(builder, key, first, rowID); err != nil {
+							return err
+						}
+						continue
 					}
 				}
-				builder.uintEntries[key] = rowID
-			case schema.KindString:
-				key := val.Str
+				builder.stringEntries[key] = rowID
+			default:
+				key, err := numericIndexKey(builder.Kind, val)
+				if err != nil {
+					return fmt.Errorf("storage: field %s row %d: %w", builder.Field, rowID, err)
+				}
+				if builder.pages != nil {
+					builder.pages.addKey(orderedKey(builder.Kind, key))
+				}
 				if builder.Unique {
-					if _, exists := builder.stringEntries[key]; exists {
-						return nil, fmt.Errorf("storage: duplicate key %s for field %s", key, builder.Field)
+					if first, exists := builder.uintEntries[key]; exists {
+						if err := onDuplicate(builder, formatIndexKey(builder.Kind, key), first, rowID); err != nil {
+							return err
+						}
+						continue
 					}
 				}
-				builder.stringEntries[key] = rowID
+				builder.uintEntries[key] = rowID
 			}
 		}
 		rowID++
 	}
-
-	out := make(map[string]*ColumnIndex, len(builders))
-	for field, builder := range builders {
-		out[field] = builder.ColumnIndex
-	}
-	return out, nil
+	return nil
 }
 
 // Persist writes the index to disk.
@@ -173,7 +322,7 @@ func (ci *ColumnIndex) Persist(w io.Writer) error {
 	}
 	header[9] = byte(ci.Kind)
 	var count uint64
-	if ci.Kind == schema.KindString {
+	if stringKeyed(ci.Kind) {
 		count = uint64(len(ci.stringEntries))
 	} else {
 		count = uint64(len(ci.uintEntries))
@@ -187,7 +336,7 @@ func (ci *ColumnIndex) Persist(w io.Writer) error {
 			return err
 		}
 	}
-	if ci.Kind == schema.KindString {
+	if stringKeyed(ci.Kind) {
 		keys := make([]string, 0, len(ci.stringEntries))
 		for key := range ci.stringEntries {
 			keys = append(keys, key)
@@ -241,12 +390,15 @@ func LoadColumnIndex(r io.Reader) (*ColumnIndex, error) {
 		return nil, fmt.Errorf("storage: invalid column index magic")
 	}
 	version := binary.LittleEndian.Uint16(head[4:6])
-	if version != columnIndexVersion {
+	if version != columnIndexVersion && version != columnIndexVersionV1 {
 		return nil, fmt.Errorf("storage: unsupported column index version %d", version)
 	}
 	nameLen := binary.LittleEndian.Uint16(head[6:8])
 	unique := head[8] == 1
 	kind := schema.FieldKind(head[9])
+	if !indexableKind(kind) {
+		return nil, fmt.Errorf("storage: column index has unsupported key kind %d", kind)
+	}
 	count := binary.LittleEndian.Uint64(head[10:])
 	name := make([]byte, nameLen)
 	if _, err := io.ReadFull(r, name); err != nil {
@@ -259,7 +411,7 @@ func LoadColumnIndex(r io.Reader) (*ColumnIndex, error) {
 		uintEntries:   make(map[uint64]uint64),
 		stringEntries: make(map[string]uint64),
 	}
-	if kind == schema.KindString {
+	if stringKeyed(kind) {
 		for i := uint64(0); i < count; i++ {
 			var prefix [2]byte
 			if _, err := io.ReadFull(r, prefix[:]); err != nil {
@@ -290,9 +442,71 @@ func LoadColumnIndex(r io.Reader) (*ColumnIndex, error) {
 	return ci, nil
 }
 
+// stringKeyed reports whether kind is indexed through the string entry table.
+// UUID keys are stored in their canonical textual form.
+func stringKeyed(kind schema.FieldKind) bool {
+	return kind == schema.KindString || kind == schema.KindUUID
+}
+
+// indexableKind reports whether buildColumnIndexes accepts fields of kind:
+// every unique-capable kind plus float64 and bool.
+func indexableKind(kind schema.FieldKind) bool {
+	return schema.IndexableKind(kind) || kind == schema.KindFloat64 || kind == schema.KindBool
+}
+
+// numericIndexKey normalizes a non-string value to its uint64 index key.
+func numericIndexKey(kind schema.FieldKind, val codec.Value) (uint64, error) {
+	switch kind {
+	case schema.KindUint64, schema.KindRef:
+		return val.Uint, nil
+	case schema.KindFloat64:
+		return math.Float64bits(val.Float), nil
+	case schema.KindBool:
+		return boolKey(val.Bool), nil
+	case schema.KindTimestampTZ:
+		t, err := temporal.DecodeTimestampTZ(val.Str)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(temporal.EncodeInstant(t)), nil
+	default:
+		return uint64(val.Int), nil
+	}
+}
+
+// formatIndexKey renders a normalized key for duplicate reports.
+func formatIndexKey(kind schema.FieldKind, key uint64) string {
+	switch kind {
+	case schema.KindUint64, schema.KindRef:
+		return strconv.FormatUint(key, 10)
+	case schema.KindFloat64:
+		return strconv.FormatFloat(math.Float64frombits(key), 'g', -1, 64)
+	case schema.KindBool:
+		return strconv.FormatBool(key == 1)
+	case schema.KindDate:
+		return temporal.FormatDate(temporal.DecodeDate(int64(key)))
+	case schema.KindDateTime, schema.KindTimestamp, schema.KindTimestampTZ:
+		return temporal.FormatInstant(temporal.DecodeInstant(int64(key)))
+	case schema.KindDuration:
+		return time.Duration(int64(key)).String()
+	case schema.KindTime:
+		return temporal.FormatTimeOfDay(time.Duration(int64(key)))
+	default:
+		return strconv.FormatInt(int64(key), 10)
+	}
+}
+
+func boolKey(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 type columnIndexBuilder struct {
 	*ColumnIndex
 	fieldIdx int
+	pages    *pageIndexBuilder
 }
 
 // bytesReader avoids importing bytes in multiple files.
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/internal/atomicfile"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// DuplicatePolicy decides which rows CompactSnapshots keeps when several rows
+// share a key.
+type DuplicatePolicy uint8
+
+const (
+	// KeepLast keeps the row from the latest input, or the latest row of one
+	// input, so newer snapshots override older ones.
+	KeepLast DuplicatePolicy = iota
+	// KeepFirst keeps the row from the earliest input.
+	KeepFirst
+	// KeepAll keeps every row, earlier inputs first.
+	KeepAll
+	// RejectDuplicates fails the compaction with ErrDuplicateKey.
+	RejectDuplicates
+)
+
+// ErrDuplicateKey reports a repeated key under RejectDuplicates.
+var ErrDuplicateKey = errors.New("storage: duplicate key")
+
+// CompactOptions tunes CompactSnapshotsWithOptions.
+type CompactOptions struct {
+	// Duplicates resolves rows that share a key; the zero value is KeepLast.
+	Duplicates DuplicatePolicy
+	// Indexes lists the column indexes to build over the output. Nil builds
+	// AutoIndexSpecs of the schema.
+	Indexes []IndexSpec
+	// RowsPerPage sizes the pages of the output; zero uses the writer default.
+	RowsPerPage int
+}
+
+// CompactSnapshots merges payload files, each sorted by keyField, into one
+// snapshot sorted by keyField, keeping the last row of every key. See
+// CompactSnapshotsWithOptions.
+func CompactSnapshots(out string, sch *schema.Schema, keyField string, inputs ...string) error {
+	return CompactSnapshotsWithOptions(out, sch, keyField, CompactOptions{}, inputs...)
+}
+
+// CompactSnapshotsWithOptions performs a streaming k-way merge of payload
+// files encoded with sch and writes the result to the snapshot directory out,
+// laid out as Persist lays out root/<schema>: payload.scrt, row.idx, the
+// column indexes, counters.json and meta.json. A store rooted at the parent
+// of out serves it when out is named after the schema.
+//
+// Inputs must each be sorted by keyField, which every row must set; an input
+// found out of order fails the merge. The merge holds one decoded row per
+// input plus the row waiting to be written, so its memory does not grow with
+// the inputs. Rebuilding the indexes reads the merged payload back once.
+// Every output file replaces an existing one by rename, meta.json last.
+func CompactSnapshotsWithOptions(out string, sch *schema.Schema, keyField string, opts CompactOptions, inputs ...string) error {
+	if sch == nil {
+		return fmt.Errorf("storage: schema handle is nil")
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("storage: compact needs at least one input")
+	}
+	keyIdx, kind, err := codec.SortField(sch, keyField)
+	if err != nil {
+		return fmt.Errorf("storage: compact key: %w", err)
+	}
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return err
+	}
+	merge := &compactHeap{keyIdx: keyIdx, kind: kind}
+	defer merge.close()
+	for i, path := range inputs {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		cursor := &compactCursor{path: path, input: i, file: file, reader: codec.NewReader(file, sch), row: codec.NewRow(sch)}
+		merge.open = append(merge.open, cursor)
+		ok, err := cursor.next(keyIdx, keyField)
+		if err != nil {
+			return err
+		}
+		if ok {
+			merge.cursors = append(merge.cursors, cursor)
+		}
+	}
+	heap.Init(merge)
+
+	tmp, err := os.CreateTemp(out, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	defer tmp.Close()
+	writer := codec.NewWriterWithOptions(tmp, sch, opts.RowsPerPage, codec.WriterOptions{Footer: true})
+	// pending is the row awaiting a write, held until a greater key shows
+	// that no later row replaces it. pendingPath and pendingRow name where it
+	// came from.
+	var pending codec.Row
+	var pendingPath string
+	var pendingRow uint64
+	for merge.Len() > 0 {
+		cursor := merge.cursors[0]
+		if pending.Schema() != nil {
+			order := codec.CompareValues(kind, cursor.row.Values()[keyIdx], pending.Values()[keyIdx])
+			switch {
+			case order < 0:
+				return fmt.Errorf("storage: compact input %s is not sorted by %s at row %d", cursor.path, keyField, cursor.rowNum)
+			case order == 0 && opts.Duplicates == RejectDuplicates:
+				return fmt.Errorf("%w: %s %s in %s row %d and %s row %d", ErrDuplicateKey, keyField, formatCompactKey(kind, pending.Values()[keyIdx]), pendingPath, pendingRow, cursor.path, cursor.rowNum)
+			case order == 0 && opts.Duplicates == KeepFirst:
+			case order == 0 && opts.Duplicates == KeepLast:
+				pending, pendingPath, pendingRow = cursor.row.Clone(), cursor.path, cursor.rowNum
+			default:
+				if err := writer.WriteRow(pending); err != nil {
+					tmp.Close()
+					return err
+				}
+				pending, pendingPath, pendingRow = cursor.row.Clone(), cursor.path, cursor.rowNum
+			}
+		} else {
+			pending, pendingPath, pendingRow = cursor.row.Clone(), cursor.path, cursor.rowNum
+		}
+		ok, err := cursor.next(keyIdx, keyField)
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(merge, 0)
+		} else {
+			heap.Pop(merge)
+		}
+	}
+	if pending.Schema() != nil {
+		if err := writer.WriteRow(pending); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return writeCompactedSnapshot(out, sch, tmpName, opts.Indexes)
+}
+
+// writeCompactedSnapshot builds the indexes of the merged payload in tmpName,
+// then moves it into out beside them and writes meta.json.
+func writeCompactedSnapshot(out string, sch *schema.Schema, tmpName string, specs []IndexSpec) error {
+	footed, err := os.ReadFile(tmpName)
+	if err != nil {
+		return err
+	}
+	payload, err := codec.StripFooter(footed)
+	if err != nil {
+		return err
+	}
+	rowIndex, err := BuildRowIndex(payload)
+	if err != nil {
+		return err
+	}
+	if specs == nil {
+		specs = AutoIndexSpecs(sch)
+	}
+	var columnIndexes map[string]*ColumnIndex
+	if len(specs) > 0 {
+		columnIndexes, err = buildColumnIndexes(sch, payload, rowIndex, specs)
+		if err != nil {
+			return err
+		}
+	}
+	if err := writeRowIndexFile(filepath.Join(out, "row.idx"), rowIndex); err != nil {
+		return err
+	}
+	idxMeta, err := writeColumnIndexes(out, columnIndexes)
+	if err != nil {
+		return err
+	}
+	autoCounters := computeAutoCounters(sch, columnIndexes, rowIndex)
+	countersPath := filepath.Join(out, "counters.json")
+	if len(autoCounters) > 0 {
+		data, err := json.MarshalIndent(autoCounters, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := atomicfile.Write(countersPath, data); err != nil {
+			return err
+		}
+	} else if err := os.Remove(countersPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(tmpName, filepath.Join(out, "payload.scrt")); err != nil {
+		return err
+	}
+	meta := &SnapshotMeta{
+		SchemaName:   sch.Name,
+		Fingerprint:  sch.Fingerprint(),
+		UpdatedAt:    time.Now().UTC(),
+		RowCount:     rowIndex.RowCount(),
+		PayloadPath:  "payload.scrt",
+		RowIndex:     "row.idx",
+		Indexes:      idxMeta,
+		AutoCounters: autoCounters,
+	}
+	return writeMetaFile(filepath.Join(out, "meta.json"), meta)
+}
+
+// compactCursor is one input of the merge, positioned on its current row.
+type compactCursor struct {
+	path   string
+	input  int
+	file   *os.File
+	reader *codec.Reader
+	row    codec.Row
+	rowNum uint64 // position of row within the input
+	read   uint64 // rows decoded so far
+}
+
+// next decodes the following row of the input, reporting false at its end.
+func (c *compactCursor) next(keyIdx int, keyField string) (bool, error) {
+	ok, err := c.reader.ReadRow(c.row)
+	if err != nil {
+		return false, fmt.Errorf("storage: compact input %s: %w", c.path, err)
+	}
+	if !ok {
+		return false, nil
+	}
+	c.rowNum = c.read
+	c.read++
+	if !c.row.Values()[keyIdx].Set {
+		return false, fmt.Errorf("storage: compact input %s row %d lacks key field %s", c.path, c.rowNum, keyField)
+	}
+	return true, nil
+}
+
+// compactHeap orders the cursors by key, then by input position so that
+// equal keys surface in input order.
+type compactHeap struct {
+	keyIdx  int
+	kind    schema.FieldKind
+	cursors []*compactCursor
+	open    []*compactCursor // every cursor, for closing its file
+}
+
+func (h *compactHeap) Len() int { return len(h.cursors) }
+
+func (h *compactHeap) Less(i, j int) bool {
+	a, b := h.cursors[i], h.cursors[j]
+	if order := codec.CompareValues(h.kind, a.row.Values()[h.keyIdx], b.row.Values()[h.keyIdx]); order != 0 {
+		return order < 0
+	}
+	return a.input < b.input
+}
+
+func (h *compactHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *compactHeap) Push(x any) { h.cursors = append(h.cursors, x.(*compactCursor)) }
+
+func (h *compactHeap) Pop() any {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
+}
+
+func (h *compactHeap) close() {
+	for _, cursor := range h.open {
+		cursor.file.Close()
+	}
+}
+
+// formatCompactKey renders a key value for an error message.
+func formatCompactKey(kind schema.FieldKind, val codec.Value) string {
+	switch kind {
+	case schema.KindUint64, schema.KindRef:
+		return fmt.Sprint(val.Uint)
+	case schema.KindFloat64:
+		return fmt.Sprint(val.Float)
+	case schema.KindBool:
+		return fmt.Sprint(val.Bool)
+	case schema.KindString, schema.KindTimestampTZ:
+		return fmt.Sprintf("%q", val.Str)
+	case schema.KindUUID, schema.KindBytes:
+		return fmt.Sprintf("%x", val.Bytes)
+	default:
+		return fmt.Sprint(val.Int)
+	}
+}
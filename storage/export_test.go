@@ -0,0 +1,19 @@
+package storage
+
+// WithBeforeIndexBuild returns opts with a hook that runs at the start of
+// every background index build of the store.
+func WithBeforeIndexBuild(opts StoreOptions, hook func(schemaName string)) StoreOptions {
+	opts.beforeIndexBuild = hook
+	return opts
+}
+
+// PageCacheUsage reports how many decoded pages s caches and their estimated
+// size in bytes.
+func PageCacheUsage(s *SnapshotStore) (pages int, bytes int64) {
+	if s.pages == nil {
+		return 0, 0
+	}
+	s.pages.mu.Lock()
+	defer s.pages.mu.Unlock()
+	return len(s.pages.entries), s.pages.used
+}
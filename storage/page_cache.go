@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"unsafe"
+
+	"github.com/oarkflow/scrt/codec"
+)
+
+// pageKey identifies one page of a stored payload.
+type pageKey struct {
+	schema string
+	offset uint64
+}
+
+// cachedPage holds every row of a decoded page, detached from the page
+// buffer, together with the epoch of the payload it was read from.
+type cachedPage struct {
+	key         pageKey
+	fingerprint uint64
+	epoch       uint64
+	rows        []codec.Row
+	size        int64
+}
+
+// pageCache is a byte-bounded LRU of decoded pages. It has its own lock so
+// lookups never hold SnapshotStore.mu while decoding. Each schema carries an
+// epoch that invalidate bumps; a page decoded under an older epoch is never
+// stored, so a lookup that raced a payload rewrite cannot cache stale rows.
+type pageCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	used     int64
+	order    *list.List // front is most recently used
+	entries  map[pageKey]*list.Element
+	epochs   map[string]uint64
+}
+
+func newPageCache(maxBytes int64) *pageCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &pageCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[pageKey]*list.Element),
+		epochs:   make(map[string]uint64),
+	}
+}
+
+// epoch returns the current epoch of schemaName. Read it before the page so
+// put can tell whether the payload changed in between.
+func (c *pageCache) epoch(schemaName string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epochs[schemaName]
+}
+
+// get returns the cached rows of a page decoded with the given schema
+// fingerprint, marking the page as recently used.
+func (c *pageCache) get(key pageKey, fingerprint uint64) ([]codec.Row, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	page := elem.Value.(*cachedPage)
+	if page.fingerprint != fingerprint || page.epoch != c.epochs[key.schema] {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return page.rows, true
+}
+
+// put stores rows for key unless the schema was invalidated after epoch was
+// read, then evicts least recently used pages until the cache fits. A page
+// larger than the whole cache is not stored.
+func (c *pageCache) put(key pageKey, fingerprint, epoch uint64, rows []codec.Row) {
+	size := pageFootprint(rows)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch != c.epochs[key.schema] || size > c.maxBytes {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	page := &cachedPage{key: key, fingerprint: fingerprint, epoch: epoch, rows: rows, size: size}
+	c.entries[key] = c.order.PushFront(page)
+	c.used += size
+	for c.used > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// invalidate drops every page of schemaName and bumps its epoch.
+func (c *pageCache) invalidate(schemaName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epochs[schemaName]++
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*cachedPage).key.schema == schemaName {
+			c.remove(elem)
+		}
+		elem = next
+	}
+}
+
+func (c *pageCache) remove(elem *list.Element) {
+	page := c.order.Remove(elem).(*cachedPage)
+	delete(c.entries, page.key)
+	c.used -= page.size
+}
+
+// pageFootprint estimates the memory held by rows: the value slots plus the
+// strings, bytes, and list elements they own.
+func pageFootprint(rows []codec.Row) int64 {
+	const valueSize = int64(unsafe.Sizeof(codec.Value{}))
+	var size int64
+	for _, row := range rows {
+		values := row.Values()
+		size += int64(len(values)) * valueSize
+		for _, v := range values {
+			size += int64(len(v.Str) + len(v.Bytes) + 8*len(v.Uints))
+			for _, s := range v.Strs {
+				size += int64(len(s)) + int64(unsafe.Sizeof(s))
+			}
+		}
+	}
+	return size
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/oarkflow/scrt/schema"
+)
+
+const (
+	pageIndexMagic   = "PIDX"
+	pageIndexVersion = uint16(1)
+	pageIndexHeader  = 4 + 2 + 1 + 1 + 2 + 8 // magic + version + kind + reserved + name length + page count
+	pageZoneSize     = 5*8 + 1
+)
+
+// PageZone summarizes one page of a payload for a single column.
+type PageZone struct {
+	Offset   uint64 // byte offset where the page length varint begins
+	FirstRow uint64 // row ID of the page's first row
+	RowCount uint64
+	// HasValues is false when no row of the page sets the field; min and max
+	// are then meaningless.
+	HasValues bool
+	min, max  uint64 // order-preserving keys, see orderedKey
+}
+
+// PageIndex is a zone map: the smallest and largest value of one column in
+// every page, so range scans can skip pages that cannot match. It is written
+// next to row.idx for IndexSpecs with PageIndex set.
+type PageIndex struct {
+	Field string
+	Kind  schema.FieldKind
+	Pages []PageZone
+}
+
+// pageIndexableKind reports whether values of kind have an order that a zone
+// map can summarize. String-keyed kinds do not.
+func pageIndexableKind(kind schema.FieldKind) bool {
+	return indexableKind(kind) && !stringKeyed(kind)
+}
+
+// orderedKey maps a numericIndexKey to a uint64 whose unsigned order matches
+// the order of the values: signed kinds flip the sign bit, and floats flip
+// every bit when negative and only the sign bit otherwise.
+func orderedKey(kind schema.FieldKind, key uint64) uint64 {
+	switch kind {
+	case schema.KindUint64, schema.KindRef, schema.KindBool:
+		return key
+	case schema.KindFloat64:
+		if key&(1<<63) != 0 {
+			return ^key
+		}
+		return key | 1<<63
+	default:
+		return key ^ 1<<63
+	}
+}
+
+// overlaps reports whether the zone may hold a key within [lo, hi].
+func (z PageZone) overlaps(lo, hi uint64) bool {
+	return z.HasValues && z.max >= lo && z.min <= hi
+}
+
+// pageIndexBuilder accumulates zones during the persist-time scan.
+type pageIndexBuilder struct {
+	index *PageIndex
+}
+
+// addRow records rowID, starting a new zone at the first row of each page.
+func (b *pageIndexBuilder) addRow(loc RowLocator, rowID uint64) {
+	if loc.RowInPage == 0 || len(b.index.Pages) == 0 {
+		b.index.Pages = append(b.index.Pages, PageZone{Offset: loc.PageOffset, FirstRow: rowID})
+	}
+	b.index.Pages[len(b.index.Pages)-1].RowCount++
+}
+
+// addKey widens the current zone to include an ordered key.
+func (b *pageIndexBuilder) addKey(key uint64) {
+	zone := &b.index.Pages[len(b.index.Pages)-1]
+	if !zone.HasValues {
+		zone.min, zone.max, zone.HasValues = key, key, true
+		return
+	}
+	zone.min = min(zone.min, key)
+	zone.max = max(zone.max, key)
+}
+
+// WriteTo serializes the page index to w and reports the bytes written.
+func (pi *PageIndex) WriteTo(w io.Writer) (int64, error) {
+	if pi == nil {
+		return 0, fmt.Errorf("storage: page index is nil")
+	}
+	if len(pi.Field) > math.MaxUint16 {
+		return 0, fmt.Errorf("storage: field name too long")
+	}
+	var header [pageIndexHeader]byte
+	copy(header[:4], pageIndexMagic)
+	binary.LittleEndian.PutUint16(header[4:6], pageIndexVersion)
+	header[6] = byte(pi.Kind)
+	// byte 7 reserved
+	binary.LittleEndian.PutUint16(header[8:10], uint16(len(pi.Field)))
+	binary.LittleEndian.PutUint64(header[10:18], uint64(len(pi.Pages)))
+	n, err := w.Write(header[:])
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+	n, err = io.WriteString(w, pi.Field)
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+	var entry [pageZoneSize]byte
+	for _, zone := range pi.Pages {
+		binary.LittleEndian.PutUint64(entry[0:8], zone.Offset)
+		binary.LittleEndian.PutUint64(entry[8:16], zone.FirstRow)
+		binary.LittleEndian.PutUint64(entry[16:24], zone.RowCount)
+		binary.LittleEndian.PutUint64(entry[24:32], zone.min)
+		binary.LittleEndian.PutUint64(entry[32:40], zone.max)
+		entry[40] = 0
+		if zone.HasValues {
+			entry[40] = 1
+		}
+		n, err := w.Write(entry[:])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadPageIndex restores a page index previously written via WriteTo.
+func ReadPageIndex(r io.Reader) (*PageIndex, error) {
+	var header [pageIndexHeader]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != pageIndexMagic {
+		return nil, fmt.Errorf("storage: invalid page index magic")
+	}
+	if version := binary.LittleEndian.Uint16(header[4:6]); version != pageIndexVersion {
+		return nil, fmt.Errorf("storage: unsupported page index version %d", version)
+	}
+	kind := schema.FieldKind(header[6])
+	if !pageIndexableKind(kind) {
+		return nil, fmt.Errorf("storage: page index has unsupported kind %d", kind)
+	}
+	name := make([]byte, binary.LittleEndian.Uint16(header[8:10]))
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+	count := binary.LittleEndian.Uint64(header[10:18])
+	pi := &PageIndex{Field: string(name), Kind: kind}
+	var entry [pageZoneSize]byte
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, entry[:]); err != nil {
+			return nil, err
+		}
+		pi.Pages = append(pi.Pages, PageZone{
+			Offset:    binary.LittleEndian.Uint64(entry[0:8]),
+			FirstRow:  binary.LittleEndian.Uint64(entry[8:16]),
+			RowCount:  binary.LittleEndian.Uint64(entry[16:24]),
+			min:       binary.LittleEndian.Uint64(entry[24:32]),
+			max:       binary.LittleEndian.Uint64(entry[32:40]),
+			HasValues: entry[40] == 1,
+		})
+	}
+	return pi, nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
 const (
@@ -41,7 +42,6 @@ func (ri *RowIndex) Lookup(rowID uint64) (RowLocator, bool) {
 
 // BuildRowIndex parses a SCRT payload into per-row locators.
 func BuildRowIndex(payload []byte) (*RowIndex, error) {
-	const streamHeaderLen = 4 + 1 + 8 // magic + version + fingerprint
 	if len(payload) < streamHeaderLen {
 		return nil, fmt.Errorf("storage: payload too small for header")
 	}
@@ -75,6 +75,29 @@ func BuildRowIndex(payload []byte) (*RowIndex, error) {
 	return &RowIndex{locations: locs}, nil
 }
 
+// pageRowCount returns how many rows share the page holding rowID.
+func (ri *RowIndex) pageRowCount(rowID uint64) int {
+	loc := ri.locations[rowID]
+	count := 0
+	for i := rowID - uint64(loc.RowInPage); i < uint64(len(ri.locations)) && ri.locations[i].PageOffset == loc.PageOffset; i++ {
+		count++
+	}
+	return count
+}
+
+// pageZones groups the locators into one unbounded zone per page, for range
+// scans over fields without a page index.
+func (ri *RowIndex) pageZones() []PageZone {
+	var zones []PageZone
+	for rowID, loc := range ri.locations {
+		if loc.RowInPage == 0 || len(zones) == 0 {
+			zones = append(zones, PageZone{Offset: loc.PageOffset, FirstRow: uint64(rowID), HasValues: true, max: math.MaxUint64})
+		}
+		zones[len(zones)-1].RowCount++
+	}
+	return zones
+}
+
 // WriteTo serializes the row index to w.
 func (ri *RowIndex) WriteTo(w io.Writer) error {
 	if ri == nil {
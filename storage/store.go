@@ -3,7 +3,7 @@ package storage
 import (
 	"bufio"
 	"bytes"
-	"crypto/rand"
+	"crypto/cipher"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -11,29 +11,95 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/internal/atomicfile"
 	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
 )
 
 // SnapshotStore writes SCRT payloads + indexes to disk and serves random access lookups.
 type SnapshotStore struct {
 	root         string
 	mu           sync.RWMutex
+	counterMu    sync.Mutex // serializes counter updates with their saves
 	rowIndexes   map[string]*RowIndex
 	colIndexes   map[string]map[string]*ColumnIndex
 	autoCounters map[string]map[string]uint64
+	generations  map[string]uint64
+	pending      map[string]chan struct{}
+	pages        *pageCache  // nil unless StoreOptions.PageCacheBytes is set
+	cipher       cipher.AEAD // opens encrypted payloads; see StoreOptions.Cipher
+	// plaintexts caches decrypted payload files for lookups, valid while
+	// their payloadEpochs entry is unchanged.
+	plainMu       sync.Mutex
+	plaintexts    map[string]cachedPlaintext
+	payloadEpochs map[string]uint64
+	// beforeIndexBuild, when set, runs at the start of every background
+	// index build; see StoreOptions.beforeIndexBuild.
+	beforeIndexBuild func(schemaName string)
+}
+
+// StoreOptions configures optional SnapshotStore behavior.
+type StoreOptions struct {
+	// PageCacheBytes bounds an LRU of decoded pages shared by LookupRow and
+	// the LookupBy methods, so repeated lookups within a page skip the disk
+	// read and decode. The size is an estimate of the decoded values held.
+	// Zero disables the cache.
+	PageCacheBytes int64
+	// Cipher opens payloads persisted with PersistOptions.Cipher and
+	// re-encrypts them when Vacuum rewrites them. It must be built from the
+	// same key they were sealed with. Reading an encrypted payload without
+	// it fails with ErrCipherRequired. Lookups keep the plaintext of each
+	// encrypted payload in memory until it is rewritten.
+	Cipher cipher.AEAD
+	// beforeIndexBuild lets tests hold a background index build at its start.
+	beforeIndexBuild func(schemaName string)
 }
 
 // PersistOptions configures how a snapshot should be stored.
 type PersistOptions struct {
 	Indexes []IndexSpec
+	// AsyncIndexes returns once the payload and row index are durable and
+	// builds column indexes in the background. Until they are ready, meta.json
+	// marks them IndexStatusBuilding and key lookups fall back to a scan.
+	AsyncIndexes bool
+	// SortBy keeps the stored payload ordered by the named field. A payload
+	// whose rows are already in order is stored as given. Otherwise the
+	// longest sorted prefix is kept, the remaining rows (typically an
+	// appended batch) are stably sorted and merged into it, and the result is
+	// re-encoded with default writer options. Rows with equal keys keep their
+	// order, prefix rows first.
+	SortBy string
+	// Cipher, when set, encrypts the payload file with this AEAD, such as
+	// the AES-256-GCM one NewCipher returns. The file is sealed whole under
+	// a fresh random nonce stored ahead of the ciphertext, with the schema
+	// name as additional data. Indexes are built from the plaintext and stored
+	// unencrypted, so indexed key values stay readable on disk. Reads need
+	// the same AEAD in StoreOptions.Cipher.
+	Cipher cipher.AEAD
 }
 
+// Column index states recorded in IndexDescriptor.Status. Ready indexes leave
+// the status empty.
+const (
+	IndexStatusBuilding = "building"
+	IndexStatusFailed   = "failed"
+)
+
+// ErrIndexNotReady reports an index that is still building or failed to
+// build. Lookups fall back to scanning the payload instead.
+var ErrIndexNotReady = errors.New("storage: index not ready")
+
+// ErrIndexNotFound reports a field that has no column index in the snapshot.
+var ErrIndexNotFound = errors.New("storage: index not found")
+
 // SnapshotMeta captures the metadata persisted alongside each snapshot.
 type SnapshotMeta struct {
 	SchemaName   string            `json:"schemaName"`
@@ -44,6 +110,8 @@ type SnapshotMeta struct {
 	RowIndex     string            `json:"rowIndex"`
 	Indexes      []IndexDescriptor `json:"indexes"`
 	AutoCounters map[string]uint64 `json:"autoCounters,omitempty"`
+	// Encrypted marks a payload file sealed with PersistOptions.Cipher.
+	Encrypted bool `json:"encrypted,omitempty"`
 }
 
 // IndexDescriptor describes a single column index on disk.
@@ -52,6 +120,10 @@ type IndexDescriptor struct {
 	Path   string `json:"path"`
 	Unique bool   `json:"unique"`
 	Kind   string `json:"kind"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// PagePath names the page index file when the spec asked for one.
+	PagePath string `json:"pagePath,omitempty"`
 }
 
 // AutoIndexSpecs derives index specifications (auto-increment fields, etc.).
@@ -78,18 +150,34 @@ func AutoIndexSpecs(sch *schema.Schema) []IndexSpec {
 
 // NewSnapshotStore ensures root exists and returns a store handle.
 func NewSnapshotStore(root string) (*SnapshotStore, error) {
+	return NewSnapshotStoreWithOptions(root, StoreOptions{})
+}
+
+// NewSnapshotStoreWithOptions is NewSnapshotStore with optional features such
+// as the decoded page cache.
+func NewSnapshotStoreWithOptions(root string, opts StoreOptions) (*SnapshotStore, error) {
 	if err := os.MkdirAll(root, 0o755); err != nil {
 		return nil, err
 	}
 	return &SnapshotStore{
-		root:         root,
-		rowIndexes:   make(map[string]*RowIndex),
-		colIndexes:   make(map[string]map[string]*ColumnIndex),
-		autoCounters: make(map[string]map[string]uint64),
+		root:          root,
+		rowIndexes:    make(map[string]*RowIndex),
+		colIndexes:    make(map[string]map[string]*ColumnIndex),
+		autoCounters:  make(map[string]map[string]uint64),
+		generations:   make(map[string]uint64),
+		pending:       make(map[string]chan struct{}),
+		pages:         newPageCache(opts.PageCacheBytes),
+		cipher:        opts.Cipher,
+		plaintexts:    make(map[string]cachedPlaintext),
+		payloadEpochs: make(map[string]uint64),
+
+		beforeIndexBuild: opts.beforeIndexBuild,
 	}, nil
 }
 
 // Persist writes payload + row indexes + configured column indexes atomically.
+// A payload of a schema with encoding=global fields is first re-encoded with
+// a dictionary per page, since row lookups decode pages on their own.
 func (s *SnapshotStore) Persist(schemaName string, sch *schema.Schema, payload []byte, opts PersistOptions) (*SnapshotMeta, error) {
 	if schemaName == "" {
 		return nil, fmt.Errorf("storage: schema name required")
@@ -100,14 +188,45 @@ func (s *SnapshotStore) Persist(schemaName string, sch *schema.Schema, payload [
 	if sch.Name != schemaName {
 		return nil, fmt.Errorf("storage: schema mismatch: %s vs %s", sch.Name, schemaName)
 	}
+	s.mu.Lock()
+	s.generations[schemaName]++
+	generation := s.generations[schemaName]
+	s.mu.Unlock()
 	schemaDir := filepath.Join(s.root, schemaName)
 	if err := os.MkdirAll(schemaDir, 0o755); err != nil {
 		return nil, err
 	}
+	if opts.SortBy != "" {
+		sorted, err := sortPayload(sch, payload, opts.SortBy)
+		if err != nil {
+			return nil, err
+		}
+		payload = sorted
+	}
+	if sch.GlobalStrings() {
+		// Row lookups decode single pages, which a stream-wide dictionary
+		// would leave without the values earlier pages introduced.
+		local, err := repagePayload(sch, payload, nil)
+		if err != nil {
+			return nil, err
+		}
+		payload = local
+	}
 	payloadPath := filepath.Join(schemaDir, "payload.scrt")
-	if err := atomicWrite(payloadPath, payload); err != nil {
+	footed, err := codec.AppendFooter(payload)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := opts.Cipher != nil
+	if encrypted {
+		if footed, err = sealPayload(opts.Cipher, schemaName, footed); err != nil {
+			return nil, err
+		}
+	}
+	if err := atomicfile.Write(payloadPath, footed); err != nil {
 		return nil, err
 	}
+	s.invalidatePages(schemaName)
 	rowIndex, err := BuildRowIndex(payload)
 	if err != nil {
 		return nil, err
@@ -116,32 +235,22 @@ func (s *SnapshotStore) Persist(schemaName string, sch *schema.Schema, payload [
 	if err := writeRowIndexFile(rowIndexPath, rowIndex); err != nil {
 		return nil, err
 	}
-	idxMeta := make([]IndexDescriptor, 0, len(opts.Indexes))
+	if opts.AsyncIndexes && len(opts.Indexes) > 0 {
+		return s.persistIndexesAsync(schemaName, sch, payload, opts.Indexes, rowIndex, generation, encrypted)
+	}
 	var columnIndexes map[string]*ColumnIndex
 	if len(opts.Indexes) > 0 {
-		columnIndexes, err = buildColumnIndexes(sch, payload, opts.Indexes)
+		columnIndexes, err = buildColumnIndexes(sch, payload, rowIndex, opts.Indexes)
 		if err != nil {
 			return nil, err
 		}
-		for field, index := range columnIndexes {
-			fileName := fmt.Sprintf("idx_%s.bin", sanitize(field))
-			idxPath := filepath.Join(schemaDir, fileName)
-			if err := writeColumnIndexFile(idxPath, index); err != nil {
-				return nil, err
-			}
-			idxMeta = append(idxMeta, IndexDescriptor{
-				Field:  field,
-				Path:   fileName,
-				Unique: index.Unique,
-				Kind:   fieldKindLabel(index.Kind),
-			})
-			s.cacheColumnIndex(schemaName, field, index)
-		}
 	}
-	if len(idxMeta) > 1 {
-		sort.Slice(idxMeta, func(i, j int) bool {
-			return idxMeta[i].Field < idxMeta[j].Field
-		})
+	idxMeta, err := writeColumnIndexes(schemaDir, columnIndexes)
+	if err != nil {
+		return nil, err
+	}
+	for field, index := range columnIndexes {
+		s.cacheColumnIndex(schemaName, field, index)
 	}
 	autoCounters := computeAutoCounters(sch, columnIndexes, rowIndex)
 	meta := &SnapshotMeta{
@@ -153,6 +262,7 @@ func (s *SnapshotStore) Persist(schemaName string, sch *schema.Schema, payload [
 		RowIndex:     "row.idx",
 		Indexes:      idxMeta,
 		AutoCounters: autoCounters,
+		Encrypted:    encrypted,
 	}
 	if err := writeMetaFile(filepath.Join(schemaDir, "meta.json"), meta); err != nil {
 		return nil, err
@@ -165,6 +275,407 @@ func (s *SnapshotStore) Persist(schemaName string, sch *schema.Schema, payload [
 	return meta, nil
 }
 
+// Reindex rebuilds the row index, the column indexes named by specs, and the
+// auto-increment counters of a stored snapshot from its payload, which is
+// read but never rewritten. Everything is built in memory first, so a failed
+// rebuild leaves the old files in place. The new files then replace the old
+// ones by rename while the store lock is held, so lookups through this store
+// see either the old indexes or the new ones. Index files that specs no
+// longer name are removed.
+func (s *SnapshotStore) Reindex(schemaName string, sch *schema.Schema, specs []IndexSpec) error {
+	if sch == nil {
+		return fmt.Errorf("storage: schema handle is nil")
+	}
+	if sch.Name != schemaName {
+		return fmt.Errorf("storage: schema mismatch: %s vs %s", sch.Name, schemaName)
+	}
+	s.WaitForIndexes(schemaName)
+	s.mu.RLock()
+	generation := s.generations[schemaName]
+	s.mu.RUnlock()
+	old, err := s.LoadMeta(schemaName)
+	if err != nil {
+		return err
+	}
+	payload, err := s.LoadPayload(schemaName)
+	if err != nil {
+		return err
+	}
+	rowIndex, err := BuildRowIndex(payload)
+	if err != nil {
+		return err
+	}
+	var columnIndexes map[string]*ColumnIndex
+	if len(specs) > 0 {
+		columnIndexes, err = buildColumnIndexes(sch, payload, rowIndex, specs)
+		if err != nil {
+			return err
+		}
+	}
+	autoCounters := computeAutoCounters(sch, columnIndexes, rowIndex)
+	previous, err := s.loadCounters(schemaName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	raiseCounters(autoCounters, previous)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generations[schemaName] != generation {
+		return fmt.Errorf("storage: snapshot %s changed during reindex", schemaName)
+	}
+	raiseCounters(autoCounters, s.autoCounters[schemaName])
+	schemaDir := filepath.Join(s.root, schemaName)
+	if err := writeRowIndexFile(filepath.Join(schemaDir, "row.idx"), rowIndex); err != nil {
+		return err
+	}
+	idxMeta, err := writeColumnIndexes(schemaDir, columnIndexes)
+	if err != nil {
+		return err
+	}
+	meta := &SnapshotMeta{
+		SchemaName:   schemaName,
+		Fingerprint:  sch.Fingerprint(),
+		UpdatedAt:    time.Now().UTC(),
+		RowCount:     rowIndex.RowCount(),
+		PayloadPath:  old.PayloadPath,
+		RowIndex:     "row.idx",
+		Indexes:      idxMeta,
+		AutoCounters: autoCounters,
+		Encrypted:    old.Encrypted,
+	}
+	if meta.PayloadPath == "" {
+		meta.PayloadPath = "payload.scrt"
+	}
+	if err := writeMetaFile(filepath.Join(schemaDir, "meta.json"), meta); err != nil {
+		return err
+	}
+	if err := s.saveCounters(schemaName, autoCounters); err != nil {
+		return err
+	}
+	live := make(map[string]struct{}, 2*len(idxMeta))
+	for _, desc := range idxMeta {
+		live[desc.Path] = struct{}{}
+		if desc.PagePath != "" {
+			live[desc.PagePath] = struct{}{}
+		}
+	}
+	for _, desc := range old.Indexes {
+		for _, path := range []string{desc.Path, desc.PagePath} {
+			if _, ok := live[path]; ok || path == "" {
+				continue
+			}
+			if err := os.Remove(filepath.Join(schemaDir, path)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	s.rowIndexes[schemaName] = rowIndex
+	if columnIndexes == nil {
+		columnIndexes = make(map[string]*ColumnIndex)
+	}
+	s.colIndexes[schemaName] = columnIndexes
+	s.autoCounters[schemaName] = copyCounterMap(autoCounters)
+	return nil
+}
+
+// Vacuum re-encodes a stored payload into full pages, of the schema's
+// @pragma rows_per_page or else 1024 rows, which coalesces the small pages
+// incremental appends leave behind, then rebuilds the row index and the
+// column indexes the snapshot already has. Rows keep their order and, unless
+// tombstoned rows are purged, their IDs; auto-increment counters never move
+// backwards. Rows marked by SetTombstones are dropped and the tombstones
+// cleared, which shifts later row IDs down. The
+// payload is re-encoded with default writer options. Everything is built in
+// memory first; the files are then replaced by rename while the store lock
+// is held, like Reindex, so lookups through this store see the snapshot
+// either before or after the vacuum.
+func (s *SnapshotStore) Vacuum(schemaName string, sch *schema.Schema) (*SnapshotMeta, error) {
+	if sch == nil {
+		return nil, fmt.Errorf("storage: schema handle is nil")
+	}
+	if sch.Name != schemaName {
+		return nil, fmt.Errorf("storage: schema mismatch: %s vs %s", sch.Name, schemaName)
+	}
+	s.WaitForIndexes(schemaName)
+	s.mu.RLock()
+	generation := s.generations[schemaName]
+	s.mu.RUnlock()
+	old, err := s.LoadMeta(schemaName)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := s.LoadPayload(schemaName)
+	if err != nil {
+		return nil, err
+	}
+	tombstones, err := s.Tombstones(schemaName)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := repagePayload(sch, stored, tombstones)
+	if err != nil {
+		return nil, err
+	}
+	rowIndex, err := BuildRowIndex(payload)
+	if err != nil {
+		return nil, err
+	}
+	specs := make([]IndexSpec, 0, len(old.Indexes))
+	for _, desc := range old.Indexes {
+		specs = append(specs, IndexSpec{Field: desc.Field, Unique: desc.Unique, PageIndex: desc.PagePath != ""})
+	}
+	var columnIndexes map[string]*ColumnIndex
+	if len(specs) > 0 {
+		columnIndexes, err = buildColumnIndexes(sch, payload, rowIndex, specs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	autoCounters := computeAutoCounters(sch, columnIndexes, rowIndex)
+	previous, err := s.loadCounters(schemaName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	raiseCounters(autoCounters, previous)
+	footed, err := codec.AppendFooter(payload)
+	if err != nil {
+		return nil, err
+	}
+	if old.Encrypted {
+		// LoadPayload opened it, so the store has the cipher.
+		if footed, err = sealPayload(s.cipher, schemaName, footed); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generations[schemaName] != generation {
+		return nil, fmt.Errorf("storage: snapshot %s changed during vacuum", schemaName)
+	}
+	if current, err := s.loadTombstones(schemaName); err != nil {
+		return nil, err
+	} else if !slices.Equal(current, tombstones) {
+		return nil, fmt.Errorf("storage: tombstones of %s changed during vacuum", schemaName)
+	}
+	s.generations[schemaName]++
+	raiseCounters(autoCounters, s.autoCounters[schemaName])
+	schemaDir := filepath.Join(s.root, schemaName)
+	if err := atomicfile.Write(filepath.Join(schemaDir, "payload.scrt"), footed); err != nil {
+		return nil, err
+	}
+	s.invalidatePages(schemaName)
+	if err := writeRowIndexFile(filepath.Join(schemaDir, "row.idx"), rowIndex); err != nil {
+		return nil, err
+	}
+	idxMeta, err := writeColumnIndexes(schemaDir, columnIndexes)
+	if err != nil {
+		return nil, err
+	}
+	meta := &SnapshotMeta{
+		SchemaName:   schemaName,
+		Fingerprint:  sch.Fingerprint(),
+		UpdatedAt:    time.Now().UTC(),
+		RowCount:     rowIndex.RowCount(),
+		PayloadPath:  "payload.scrt",
+		RowIndex:     "row.idx",
+		Indexes:      idxMeta,
+		AutoCounters: autoCounters,
+		Encrypted:    old.Encrypted,
+	}
+	if err := writeMetaFile(filepath.Join(schemaDir, "meta.json"), meta); err != nil {
+		return nil, err
+	}
+	if err := s.saveCounters(schemaName, autoCounters); err != nil {
+		return nil, err
+	}
+	if err := s.saveTombstones(schemaName, nil); err != nil {
+		return nil, err
+	}
+	s.rowIndexes[schemaName] = rowIndex
+	if columnIndexes == nil {
+		columnIndexes = make(map[string]*ColumnIndex)
+	}
+	s.colIndexes[schemaName] = columnIndexes
+	s.autoCounters[schemaName] = copyCounterMap(autoCounters)
+	return meta, nil
+}
+
+// raiseCounters lifts each counter in dst to at least its value in src, so
+// values already handed out are never reissued.
+func raiseCounters(dst, src map[string]uint64) {
+	for field, next := range src {
+		if next > dst[field] {
+			dst[field] = next
+		}
+	}
+}
+
+// newPageWriter returns a writer for payloads the store keeps: every page
+// carries its own string dictionaries, even for encoding=global fields, so
+// any page can be decoded on its own.
+func newPageWriter(dst io.Writer, sch *schema.Schema) *codec.Writer {
+	return codec.NewWriterWithOptions(dst, sch, 0, codec.WriterOptions{LocalDictionaries: true})
+}
+
+// repagePayload decodes payload and writes its rows back in order, in pages
+// of the default size for sch, leaving out the rows whose IDs are in the
+// sorted drop list.
+func repagePayload(sch *schema.Schema, payload []byte, drop []uint64) ([]byte, error) {
+	reader := codec.NewReader(bytes.NewReader(payload), sch)
+	row := codec.NewRow(sch)
+	var buf bytes.Buffer
+	writer := newPageWriter(&buf, sch)
+	for rowID := uint64(0); ; rowID++ {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		// drop is sorted, so its head is the next row to skip.
+		if len(drop) > 0 && drop[0] == rowID {
+			drop = drop[1:]
+			continue
+		}
+		if err := writer.WriteRow(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// persistIndexesAsync records the snapshot with its indexes marked building
+// and hands the build to a goroutine. A later Persist of the same schema bumps
+// the generation, which makes the stale build discard its results.
+func (s *SnapshotStore) persistIndexesAsync(schemaName string, sch *schema.Schema, payload []byte, specs []IndexSpec, rowIndex *RowIndex, generation uint64, encrypted bool) (*SnapshotMeta, error) {
+	idxMeta := make([]IndexDescriptor, 0, len(specs))
+	for _, spec := range specs {
+		fieldIdx, ok := sch.FieldIndex(spec.Field)
+		if !ok {
+			return nil, fmt.Errorf("storage: schema %s lacks field %s", sch.Name, spec.Field)
+		}
+		desc := IndexDescriptor{
+			Field:  spec.Field,
+			Path:   indexFileName(spec.Field),
+			Unique: spec.Unique,
+			Kind:   fieldKindLabel(sch.Fields[fieldIdx].ValueKind()),
+			Status: IndexStatusBuilding,
+		}
+		if spec.PageIndex {
+			desc.PagePath = pageIndexFileName(spec.Field)
+		}
+		idxMeta = append(idxMeta, desc)
+	}
+	sort.Slice(idxMeta, func(i, j int) bool {
+		return idxMeta[i].Field < idxMeta[j].Field
+	})
+	meta := &SnapshotMeta{
+		SchemaName:  schemaName,
+		Fingerprint: sch.Fingerprint(),
+		UpdatedAt:   time.Now().UTC(),
+		RowCount:    rowIndex.RowCount(),
+		PayloadPath: "payload.scrt",
+		RowIndex:    "row.idx",
+		Indexes:     idxMeta,
+		Encrypted:   encrypted,
+	}
+	done := make(chan struct{})
+	s.mu.Lock()
+	delete(s.colIndexes, schemaName)
+	delete(s.autoCounters, schemaName)
+	s.rowIndexes[schemaName] = rowIndex
+	s.pending[schemaName] = done
+	s.mu.Unlock()
+	if err := writeMetaFile(filepath.Join(s.root, schemaName, "meta.json"), meta); err != nil {
+		s.finishIndexBuild(schemaName, done)
+		close(done)
+		return nil, err
+	}
+	result := *meta
+	result.Indexes = append([]IndexDescriptor(nil), idxMeta...)
+	go s.buildIndexesAsync(schemaName, sch, payload, specs, rowIndex, meta, generation, done)
+	return &result, nil
+}
+
+func (s *SnapshotStore) buildIndexesAsync(schemaName string, sch *schema.Schema, payload []byte, specs []IndexSpec, rowIndex *RowIndex, meta *SnapshotMeta, generation uint64, done chan struct{}) {
+	defer close(done)
+	if s.beforeIndexBuild != nil {
+		s.beforeIndexBuild(schemaName)
+	}
+	indexes, buildErr := buildColumnIndexes(sch, payload, rowIndex, specs)
+
+	// The files are written before taking the lock, so lookups are not held
+	// up by the disk; a build a later Persist has made stale skips them.
+	s.mu.RLock()
+	stale := s.generations[schemaName] != generation
+	s.mu.RUnlock()
+	if stale {
+		s.finishIndexBuild(schemaName, done)
+		return
+	}
+	schemaDir := filepath.Join(s.root, schemaName)
+	ready := make(map[string]*ColumnIndex, len(indexes))
+	for i := range meta.Indexes {
+		desc := &meta.Indexes[i]
+		desc.Status = ""
+		if buildErr != nil {
+			desc.Status, desc.Error = IndexStatusFailed, buildErr.Error()
+			continue
+		}
+		index := indexes[desc.Field]
+		if err := writeColumnIndexFile(filepath.Join(schemaDir, desc.Path), index); err != nil {
+			desc.Status, desc.Error = IndexStatusFailed, err.Error()
+			continue
+		}
+		if desc.PagePath != "" {
+			if err := writePageIndexFile(filepath.Join(schemaDir, desc.PagePath), index.Pages); err != nil {
+				desc.Status, desc.Error = IndexStatusFailed, err.Error()
+				continue
+			}
+		}
+		ready[desc.Field] = index
+	}
+	meta.AutoCounters = computeAutoCounters(sch, ready, rowIndex)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending[schemaName] == done {
+		delete(s.pending, schemaName)
+	}
+	if s.generations[schemaName] != generation {
+		return
+	}
+	s.colIndexes[schemaName] = ready
+	s.autoCounters[schemaName] = copyCounterMap(meta.AutoCounters)
+	_ = writeMetaFile(filepath.Join(schemaDir, "meta.json"), meta)
+	_ = s.saveCounters(schemaName, meta.AutoCounters)
+}
+
+func (s *SnapshotStore) finishIndexBuild(schemaName string, done chan struct{}) {
+	s.mu.Lock()
+	if s.pending[schemaName] == done {
+		delete(s.pending, schemaName)
+	}
+	s.mu.Unlock()
+}
+
+// WaitForIndexes blocks until any background index build for schemaName has
+// finished.
+func (s *SnapshotStore) WaitForIndexes(schemaName string) {
+	s.mu.RLock()
+	done := s.pending[schemaName]
+	s.mu.RUnlock()
+	if done != nil {
+		<-done
+	}
+}
+
 // LoadMeta reads the on-disk metadata for schemaName.
 func (s *SnapshotStore) LoadMeta(schemaName string) (*SnapshotMeta, error) {
 	metaPath := filepath.Join(s.root, schemaName, "meta.json")
@@ -204,8 +715,63 @@ func (s *SnapshotStore) ListMeta() ([]*SnapshotMeta, error) {
 	return metas, nil
 }
 
+// ListIndexes returns the column index descriptors recorded in the snapshot
+// metadata of schemaName.
+func (s *SnapshotStore) ListIndexes(schemaName string) ([]IndexDescriptor, error) {
+	meta, err := s.LoadMeta(schemaName)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Indexes, nil
+}
+
+// DumpIndex returns every key of the column index on field with its row ID.
+// Only the index file is read, never the payload. Keys use the same text as
+// DryRunIndex reports: decimal uints, canonical UUIDs, formatted date/time
+// values. A field without an index, or whose index file is missing, fails
+// with an error wrapping ErrIndexNotFound; one still building or whose build
+// failed fails with ErrIndexNotReady.
+func (s *SnapshotStore) DumpIndex(schemaName, field string) (map[string]uint64, error) {
+	idx, err := s.columnIndex(schemaName, field)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, metaErr := s.LoadMeta(schemaName); metaErr == nil {
+			return nil, fmt.Errorf("%w: %s.%s: %v", ErrIndexNotFound, schemaName, field, err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		return nil, fmt.Errorf("%w: %s.%s", ErrIndexNotFound, schemaName, field)
+	}
+	entries := make(map[string]uint64, idx.EntryCount())
+	for key, rowID := range idx.stringEntries {
+		entries[key] = rowID
+	}
+	for key, rowID := range idx.uintEntries {
+		entries[formatIndexKey(idx.Kind, key)] = rowID
+	}
+	return entries, nil
+}
+
+// Aggregate folds field across the stored payload of schemaName with op,
+// decoding only that column. It follows codec.Aggregate's rules.
+func (s *SnapshotStore) Aggregate(schemaName string, sch *schema.Schema, field string, op codec.AggOp) (float64, error) {
+	payload, err := s.LoadPayload(schemaName)
+	if err != nil {
+		return 0, err
+	}
+	return codec.Aggregate(bytes.NewReader(payload), sch, field, op)
+}
+
 // LookupRow decodes the row identified by rowID into dst.
 func (s *SnapshotStore) LookupRow(schemaName string, sch *schema.Schema, rowID uint64, dst codec.Row) error {
+	// The epoch is read before the row index, so a page decoded with an
+	// index that a later write replaced is never cached as current.
+	var epoch uint64
+	if s.pages != nil {
+		epoch = s.pages.epoch(schemaName)
+	}
 	rowIndex, err := s.rowIndex(schemaName)
 	if err != nil {
 		return err
@@ -214,17 +780,114 @@ func (s *SnapshotStore) LookupRow(schemaName string, sch *schema.Schema, rowID u
 	if !ok {
 		return fmt.Errorf("storage: row %d out of range", rowID)
 	}
-	payloadPath := filepath.Join(s.root, schemaName, "payload.scrt")
-	pageChunk, err := readPageChunk(payloadPath, locator.PageOffset)
+	if s.pages != nil {
+		return s.lookupCachedRow(schemaName, sch, rowIndex, rowID, epoch, dst)
+	}
+	src, err := s.openPayload(schemaName)
 	if err != nil {
 		return err
 	}
-	return decodeRowFromChunk(sch, pageChunk, int(locator.RowInPage), dst)
+	defer src.Close()
+	header, pageChunk, err := readPageChunk(src, locator.PageOffset)
+	if err != nil {
+		return err
+	}
+	return decodeRowFromChunk(sch, header, pageChunk, int(locator.RowInPage), dst)
+}
+
+// lookupCachedRow serves LookupRow through the page cache, decoding and
+// caching the whole page on a miss. epoch is the cache epoch read before
+// rowIndex was loaded. dst shares the cached strings, bytes, and list
+// elements, which callers must not modify.
+func (s *SnapshotStore) lookupCachedRow(schemaName string, sch *schema.Schema, rowIndex *RowIndex, rowID, epoch uint64, dst codec.Row) error {
+	locator := rowIndex.locations[rowID]
+	key := pageKey{schema: schemaName, offset: locator.PageOffset}
+	fingerprint := sch.Fingerprint()
+	rows, ok := s.pages.get(key, fingerprint)
+	if !ok {
+		src, err := s.openPayload(schemaName)
+		if err != nil {
+			return err
+		}
+		header, pageChunk, err := readPageChunk(src, locator.PageOffset)
+		src.Close()
+		if err != nil {
+			return err
+		}
+		reader := newPageReader(sch, header, pageChunk)
+		row := codec.NewRow(sch)
+		pageRows := rowIndex.pageRowCount(rowID)
+		rows = make([]codec.Row, 0, pageRows)
+		for len(rows) < pageRows {
+			ok, err := reader.ReadRow(row)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return io.ErrUnexpectedEOF
+			}
+			rows = append(rows, row.Clone())
+		}
+		s.pages.put(key, fingerprint, epoch, rows)
+	}
+	if int(locator.RowInPage) >= len(rows) {
+		return io.EOF
+	}
+	copy(dst.Values(), rows[locator.RowInPage].Values())
+	return nil
 }
 
 // LookupByUint resolves a numeric key via a column index and decodes the matching row.
 func (s *SnapshotStore) LookupByUint(schemaName string, sch *schema.Schema, field string, key uint64, dst codec.Row) (bool, error) {
+	return s.lookupByIndexKey(schemaName, sch, field, key, dst)
+}
+
+// LookupByInt resolves an int64 key, or a date, datetime, timestamp,
+// duration, or time key in its stored int64 form, via a column index.
+func (s *SnapshotStore) LookupByInt(schemaName string, sch *schema.Schema, field string, key int64, dst codec.Row) (bool, error) {
+	return s.lookupByIndexKey(schemaName, sch, field, uint64(key), dst)
+}
+
+// LookupByTime resolves a temporal key via a column index. Date fields match
+// t's UTC calendar day; the other temporal kinds, timestamptz included, match
+// the same instant regardless of zone. Time fields match t's wall clock.
+func (s *SnapshotStore) LookupByTime(schemaName string, sch *schema.Schema, field string, t time.Time, dst codec.Row) (bool, error) {
+	fieldIdx, ok := sch.FieldIndex(field)
+	if !ok {
+		return false, fmt.Errorf("storage: schema %s lacks field %s", sch.Name, field)
+	}
+	var key int64
+	switch sch.Fields[fieldIdx].ValueKind() {
+	case schema.KindDate:
+		key = temporal.EncodeDate(t)
+	case schema.KindDateTime, schema.KindTimestamp, schema.KindTimestampTZ:
+		key = temporal.EncodeInstant(t)
+	case schema.KindTime:
+		key = int64(temporal.TimeOfDay(t))
+	default:
+		return false, fmt.Errorf("storage: field %s is not a date, time, or timestamp", field)
+	}
+	return s.lookupByIndexKey(schemaName, sch, field, uint64(key), dst)
+}
+
+// lookupByIndexKey resolves a normalized uint64 key (see ColumnIndex) and
+// decodes the matching row.
+func (s *SnapshotStore) lookupByIndexKey(schemaName string, sch *schema.Schema, field string, key uint64, dst codec.Row) (bool, error) {
+	fieldIdx, ok := sch.FieldIndex(field)
+	if !ok {
+		return false, fmt.Errorf("storage: schema %s lacks field %s", sch.Name, field)
+	}
+	kind := sch.Fields[fieldIdx].ValueKind()
+	if !indexableKind(kind) || stringKeyed(kind) {
+		return false, fmt.Errorf("storage: field %s is not numerically keyed", field)
+	}
 	idx, err := s.columnIndex(schemaName, field)
+	if errors.Is(err, ErrIndexNotReady) {
+		return s.scanLookup(schemaName, sch, field, dst, func(val codec.Value) bool {
+			got, err := numericIndexKey(kind, val)
+			return err == nil && got == key
+		})
+	}
 	if err != nil {
 		return false, err
 	}
@@ -244,6 +907,18 @@ func (s *SnapshotStore) LookupByUint(schemaName string, sch *schema.Schema, fiel
 // LookupByString resolves a string key via a column index.
 func (s *SnapshotStore) LookupByString(schemaName string, sch *schema.Schema, field, key string, dst codec.Row) (bool, error) {
 	idx, err := s.columnIndex(schemaName, field)
+	if errors.Is(err, ErrIndexNotReady) {
+		isUUID := false
+		if fieldIdx, ok := sch.FieldIndex(field); ok {
+			isUUID = sch.Fields[fieldIdx].ValueKind() == schema.KindUUID
+		}
+		return s.scanLookup(schemaName, sch, field, dst, func(val codec.Value) bool {
+			if isUUID {
+				return uuid.FormatBytes(val.Bytes) == key
+			}
+			return val.Str == key
+		})
+	}
 	if err != nil {
 		return false, err
 	}
@@ -260,6 +935,122 @@ func (s *SnapshotStore) LookupByString(schemaName string, sch *schema.Schema, fi
 	return true, nil
 }
 
+// scanLookup decodes the payload until match accepts field's value, leaving
+// the matching row in dst. It serves lookups while an index is unavailable.
+func (s *SnapshotStore) scanLookup(schemaName string, sch *schema.Schema, field string, dst codec.Row, match func(codec.Value) bool) (bool, error) {
+	fieldIdx, ok := sch.FieldIndex(field)
+	if !ok {
+		return false, fmt.Errorf("storage: schema %s lacks field %s", sch.Name, field)
+	}
+	payload, err := s.LoadPayload(schemaName)
+	if err != nil {
+		return false, err
+	}
+	reader := codec.NewReader(bytes.NewReader(payload), sch)
+	for {
+		ok, err := reader.ReadRow(dst)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+		if val := dst.Values()[fieldIdx]; val.Set && match(val) {
+			return true, nil
+		}
+	}
+}
+
+// ScanStats reports how much of the payload a ScanRange touched.
+type ScanStats struct {
+	Pages       int // pages in the payload
+	PagesRead   int // pages decoded after zone map pruning
+	RowsMatched int
+}
+
+// ScanRange calls fn with the ID of every row whose field lies within the
+// inclusive range [lo, hi], leaving the row decoded in dst. lo and hi are
+// compared as the field's ColumnIndex keys, except that signed, temporal, and
+// float values keep their natural order. When field has a page index, pages
+// whose min and max fall outside the range are skipped; otherwise every page
+// is decoded. A non-nil error from fn stops the scan.
+func (s *SnapshotStore) ScanRange(schemaName string, sch *schema.Schema, field string, lo, hi codec.Value, dst codec.Row, fn func(rowID uint64) error) (ScanStats, error) {
+	var stats ScanStats
+	fieldIdx, ok := sch.FieldIndex(field)
+	if !ok {
+		return stats, fmt.Errorf("storage: schema %s lacks field %s", sch.Name, field)
+	}
+	kind := sch.Fields[fieldIdx].ValueKind()
+	if !pageIndexableKind(kind) {
+		return stats, fmt.Errorf("storage: field %s of kind %s cannot be range scanned", field, sch.Fields[fieldIdx].RawType)
+	}
+	loKey, err := numericIndexKey(kind, lo)
+	if err != nil {
+		return stats, err
+	}
+	hiKey, err := numericIndexKey(kind, hi)
+	if err != nil {
+		return stats, err
+	}
+	loKey, hiKey = orderedKey(kind, loKey), orderedKey(kind, hiKey)
+	var zones []PageZone
+	idx, err := s.columnIndex(schemaName, field)
+	if err != nil && !errors.Is(err, ErrIndexNotReady) {
+		return stats, err
+	}
+	if idx != nil && idx.Pages != nil {
+		zones = idx.Pages.Pages
+	} else {
+		rowIndex, err := s.rowIndex(schemaName)
+		if err != nil {
+			return stats, err
+		}
+		zones = rowIndex.pageZones()
+	}
+	stats.Pages = len(zones)
+	src, err := s.openPayload(schemaName)
+	if err != nil {
+		return stats, err
+	}
+	defer src.Close()
+	for _, zone := range zones {
+		if !zone.overlaps(loKey, hiKey) {
+			continue
+		}
+		header, chunk, err := readPageChunk(src, zone.Offset)
+		if err != nil {
+			return stats, err
+		}
+		stats.PagesRead++
+		reader := newPageReader(sch, header, chunk)
+		for i := uint64(0); i < zone.RowCount; i++ {
+			ok, err := reader.ReadRow(dst)
+			if err != nil {
+				return stats, err
+			}
+			if !ok {
+				return stats, io.ErrUnexpectedEOF
+			}
+			val := dst.Values()[fieldIdx]
+			if !val.Set {
+				continue
+			}
+			key, err := numericIndexKey(kind, val)
+			if err != nil {
+				return stats, err
+			}
+			if key = orderedKey(kind, key); key < loKey || key > hiKey {
+				continue
+			}
+			stats.RowsMatched++
+			if err := fn(zone.FirstRow + i); err != nil {
+				return stats, err
+			}
+		}
+	}
+	return stats, nil
+}
+
 func (s *SnapshotStore) rowIndex(schemaName string) (*RowIndex, error) {
 	s.mu.RLock()
 	idx, ok := s.rowIndexes[schemaName]
@@ -305,6 +1096,9 @@ func (s *SnapshotStore) columnIndex(schemaName, field string) (*ColumnIndex, err
 	if entry == nil {
 		return nil, nil
 	}
+	if entry.Status != "" {
+		return nil, ErrIndexNotReady
+	}
 	path := filepath.Join(s.root, schemaName, entry.Path)
 	file, err := os.Open(path)
 	if err != nil {
@@ -315,28 +1109,59 @@ func (s *SnapshotStore) columnIndex(schemaName, field string) (*ColumnIndex, err
 	if err != nil {
 		return nil, err
 	}
+	if entry.PagePath != "" {
+		pageFile, err := os.Open(filepath.Join(s.root, schemaName, entry.PagePath))
+		if err != nil {
+			return nil, err
+		}
+		defer pageFile.Close()
+		if idx.Pages, err = ReadPageIndex(bufio.NewReader(pageFile)); err != nil {
+			return nil, err
+		}
+	}
 	s.cacheColumnIndex(schemaName, entry.Field, idx)
 	return idx, nil
 }
 
-// LoadPayload reads the raw SCRT payload for schemaName from disk.
+// LoadPayload reads the SCRT payload for schemaName from disk. Persist stores
+// payloads with a footer; it is verified here and stripped before returning.
+// Snapshots written before footers load unchanged.
 func (s *SnapshotStore) LoadPayload(schemaName string) ([]byte, error) {
-	path := filepath.Join(s.root, schemaName, "payload.scrt")
-	return os.ReadFile(path)
+	data, err := s.readPayloadFile(schemaName)
+	if err != nil {
+		return nil, err
+	}
+	return codec.StripFooter(data)
 }
 
 // Delete removes the schema directory and cached indexes.
 func (s *SnapshotStore) Delete(schemaName string) error {
 	s.mu.Lock()
+	s.generations[schemaName]++
 	delete(s.rowIndexes, schemaName)
 	delete(s.colIndexes, schemaName)
 	delete(s.autoCounters, schemaName)
 	s.mu.Unlock()
-	return os.RemoveAll(filepath.Join(s.root, schemaName))
+	err := os.RemoveAll(filepath.Join(s.root, schemaName))
+	s.invalidatePages(schemaName)
+	return err
+}
+
+// invalidatePages forgets the cached pages and decrypted payload of
+// schemaName. Callers run it after the payload file changes, so a lookup
+// that read the old file before the change cannot store its pages
+// afterwards.
+func (s *SnapshotStore) invalidatePages(schemaName string) {
+	s.forgetPlaintext(schemaName)
+	if s.pages != nil {
+		s.pages.invalidate(schemaName)
+	}
 }
 
 // NextAutoValue returns the next sequential value for the given field.
 func (s *SnapshotStore) NextAutoValue(schemaName string, sch *schema.Schema, field string) (uint64, error) {
+	s.counterMu.Lock()
+	defer s.counterMu.Unlock()
 	counters, err := s.ensureAutoCounters(schemaName, sch)
 	if err != nil {
 		return 0, err
@@ -363,6 +1188,39 @@ func (s *SnapshotStore) NextAutoValue(schemaName string, sch *schema.Schema, fie
 	return value, nil
 }
 
+// SetAutoCounter makes value the next number NextAutoValue hands out for
+// field, e.g. before importing rows with pre-assigned IDs.
+func (s *SnapshotStore) SetAutoCounter(schemaName string, sch *schema.Schema, field string, value uint64) error {
+	idx, ok := sch.FieldIndex(field)
+	if !ok || !sch.Fields[idx].AutoIncrement {
+		return fmt.Errorf("%w: %s.%s", ErrNotAutoIncrement, schemaName, field)
+	}
+	s.counterMu.Lock()
+	defer s.counterMu.Unlock()
+	counters, err := s.ensureAutoCounters(schemaName, sch)
+	if err != nil {
+		return err
+	}
+	counters[field] = value
+	if err := s.saveCounters(schemaName, counters); err != nil {
+		return err
+	}
+	s.cacheAutoCounters(schemaName, counters)
+	return nil
+}
+
+// ResetAutoCounters discards the stored counters for schemaName so the next
+// allocation recomputes them from the current payload.
+func (s *SnapshotStore) ResetAutoCounters(schemaName string) error {
+	s.counterMu.Lock()
+	defer s.counterMu.Unlock()
+	if err := s.saveCounters(schemaName, nil); err != nil {
+		return err
+	}
+	s.cacheAutoCounters(schemaName, nil)
+	return nil
+}
+
 func (s *SnapshotStore) cacheRowIndex(schemaName string, idx *RowIndex) {
 	s.mu.Lock()
 	s.rowIndexes[schemaName] = idx
@@ -395,6 +1253,8 @@ func (s *SnapshotStore) cacheAutoCounters(schemaName string, counters map[string
 }
 
 func (s *SnapshotStore) ensureAutoCounters(schemaName string, sch *schema.Schema) (map[string]uint64, error) {
+	// Counters derive from the column indexes, so let a pending build land first.
+	s.WaitForIndexes(schemaName)
 	s.mu.RLock()
 	if counters, ok := s.autoCounters[schemaName]; ok {
 		clone := copyCounterMap(counters)
@@ -430,7 +1290,7 @@ func (s *SnapshotStore) rebuildAutoCounters(schemaName string, sch *schema.Schem
 	if err != nil {
 		return nil, err
 	}
-	indices, err := buildColumnIndexes(sch, payload, AutoIndexSpecs(sch))
+	indices, err := buildColumnIndexes(sch, payload, rowIndex, AutoIndexSpecs(sch))
 	if err != nil {
 		return nil, err
 	}
@@ -481,7 +1341,7 @@ func (s *SnapshotStore) saveCounters(schemaName string, counters map[string]uint
 	if err != nil {
 		return err
 	}
-	return atomicWrite(s.countersPath(schemaName), data)
+	return atomicfile.Write(s.countersPath(schemaName), data)
 }
 
 func (s *SnapshotStore) loadCounters(schemaName string) (map[string]uint64, error) {
@@ -508,16 +1368,66 @@ func copyCounterMap(src map[string]uint64) map[string]uint64 {
 	return clone
 }
 
-func decodeRowFromChunk(sch *schema.Schema, chunk []byte, rowInPage int, dst codec.Row) error {
+// sortPayload returns payload ordered by field. It decodes every row, keeps
+// the longest sorted prefix, stably sorts the rest, and merges the two with
+// prefix rows winning ties, which matches a stable sort of the whole payload.
+func sortPayload(sch *schema.Schema, payload []byte, field string) ([]byte, error) {
+	fieldIdx, kind, err := codec.SortField(sch, field)
+	if err != nil {
+		return nil, fmt.Errorf("storage: sort by: %w", err)
+	}
+	reader := codec.NewReader(bytes.NewReader(payload), sch)
+	row := codec.NewRow(sch)
+	var rows []codec.Row
+	for {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		rows = append(rows, row.Clone())
+	}
+	less := func(a, b codec.Row) bool {
+		return codec.CompareValues(kind, a.Values()[fieldIdx], b.Values()[fieldIdx]) < 0
+	}
+	split := 1
+	for split < len(rows) && !less(rows[split], rows[split-1]) {
+		split++
+	}
+	if split >= len(rows) {
+		return payload, nil
+	}
+	prefix, tail := rows[:split], append([]codec.Row(nil), rows[split:]...)
+	if err := codec.SortRows(tail, field); err != nil {
+		return nil, err
+	}
 	var buf bytes.Buffer
-	buf.Grow(4 + 1 + 8 + len(chunk))
-	buf.WriteString("SCRT")
-	buf.WriteByte(byte(2))
-	var fp [8]byte
-	binary.LittleEndian.PutUint64(fp[:], sch.Fingerprint())
-	buf.Write(fp[:])
-	buf.Write(chunk)
-	reader := codec.NewReader(bufio.NewReader(&buf), sch)
+	writer := newPageWriter(&buf, sch)
+	for len(prefix) > 0 || len(tail) > 0 {
+		next := &prefix
+		if len(prefix) == 0 || (len(tail) > 0 && less(tail[0], prefix[0])) {
+			next = &tail
+		}
+		if err := writer.WriteRow((*next)[0]); err != nil {
+			return nil, err
+		}
+		*next = (*next)[1:]
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const streamHeaderLen = 4 + 1 + 8 // magic + version/flags + fingerprint
+
+// decodeRowFromChunk decodes one row from a single page. header is the
+// payload's own stream header so feature flags such as page checksums apply
+// and a stale fingerprint is reported rather than masked.
+func decodeRowFromChunk(sch *schema.Schema, header, chunk []byte, rowInPage int, dst codec.Row) error {
+	reader := newPageReader(sch, header, chunk)
 	for i := 0; i <= rowInPage; i++ {
 		ok, err := reader.ReadRow(dst)
 		if err != nil {
@@ -530,20 +1440,33 @@ func decodeRowFromChunk(sch *schema.Schema, chunk []byte, rowInPage int, dst cod
 	return nil
 }
 
-func readPageChunk(path string, pageOffset uint64) ([]byte, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
+// newPageReader decodes the single page chunk as if it were a whole stream.
+func newPageReader(sch *schema.Schema, header, chunk []byte) *codec.Reader {
+	var buf bytes.Buffer
+	buf.Grow(len(header) + len(chunk))
+	buf.Write(header)
+	buf.Write(chunk)
+	return codec.NewReader(bufio.NewReader(&buf), sch)
+}
+
+// readPageChunk returns the stream header and the length-prefixed page
+// starting at pageOffset of the payload file read by src.
+func readPageChunk(src io.ReadSeeker, pageOffset uint64) ([]byte, []byte, error) {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
 	}
-	defer file.Close()
-	if _, err := file.Seek(int64(pageOffset), io.SeekStart); err != nil {
-		return nil, err
+	header := make([]byte, streamHeaderLen)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, nil, err
+	}
+	if _, err := src.Seek(int64(pageOffset), io.SeekStart); err != nil {
+		return nil, nil, err
 	}
 	varintBuf := make([]byte, binary.MaxVarintLen64)
 	var consumed int
 	for consumed < len(varintBuf) {
-		if _, err := file.Read(varintBuf[consumed : consumed+1]); err != nil {
-			return nil, err
+		if _, err := src.Read(varintBuf[consumed : consumed+1]); err != nil {
+			return nil, nil, err
 		}
 		if varintBuf[consumed]&0x80 == 0 {
 			consumed++
@@ -553,14 +1476,14 @@ func readPageChunk(path string, pageOffset uint64) ([]byte, error) {
 	}
 	length, n := binary.Uvarint(varintBuf[:consumed])
 	if n <= 0 {
-		return nil, fmt.Errorf("storage: malformed varint at offset %d", pageOffset)
+		return nil, nil, fmt.Errorf("storage: malformed varint at offset %d", pageOffset)
 	}
 	chunk := make([]byte, consumed+int(length))
 	copy(chunk[:consumed], varintBuf[:consumed])
-	if _, err := io.ReadFull(file, chunk[consumed:]); err != nil {
-		return nil, err
+	if _, err := io.ReadFull(src, chunk[consumed:]); err != nil {
+		return nil, nil, err
 	}
-	return chunk, nil
+	return header, chunk, nil
 }
 
 func writeRowIndexFile(path string, idx *RowIndex) error {
@@ -568,7 +1491,7 @@ func writeRowIndexFile(path string, idx *RowIndex) error {
 	if err := idx.WriteTo(&buf); err != nil {
 		return err
 	}
-	return atomicWrite(path, buf.Bytes())
+	return atomicfile.Write(path, buf.Bytes())
 }
 
 func writeColumnIndexFile(path string, idx *ColumnIndex) error {
@@ -576,37 +1499,62 @@ func writeColumnIndexFile(path string, idx *ColumnIndex) error {
 	if err := idx.Persist(&buf); err != nil {
 		return err
 	}
-	return atomicWrite(path, buf.Bytes())
+	return atomicfile.Write(path, buf.Bytes())
 }
 
-func writeMetaFile(path string, meta *SnapshotMeta) error {
-	data, err := json.MarshalIndent(meta, "", "  ")
-	if err != nil {
+func writePageIndexFile(path string, idx *PageIndex) error {
+	var buf bytes.Buffer
+	if _, err := idx.WriteTo(&buf); err != nil {
 		return err
 	}
-	return atomicWrite(path, data)
+	return atomicfile.Write(path, buf.Bytes())
 }
 
-func atomicWrite(path string, data []byte) error {
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return err
-	}
-	tmp, err := os.CreateTemp(dir, ".tmp-*")
-	if err != nil {
-		return err
+// writeColumnIndexes writes each index, and its page index when it has one,
+// under schemaDir and returns their descriptors sorted by field.
+func writeColumnIndexes(schemaDir string, indexes map[string]*ColumnIndex) ([]IndexDescriptor, error) {
+	idxMeta := make([]IndexDescriptor, 0, len(indexes))
+	for field, index := range indexes {
+		fileName := indexFileName(field)
+		if err := writeColumnIndexFile(filepath.Join(schemaDir, fileName), index); err != nil {
+			return nil, err
+		}
+		desc := IndexDescriptor{
+			Field:  field,
+			Path:   fileName,
+			Unique: index.Unique,
+			Kind:   fieldKindLabel(index.Kind),
+		}
+		if index.Pages != nil {
+			desc.PagePath = pageIndexFileName(field)
+			if err := writePageIndexFile(filepath.Join(schemaDir, desc.PagePath), index.Pages); err != nil {
+				return nil, err
+			}
+		}
+		idxMeta = append(idxMeta, desc)
 	}
-	name := tmp.Name()
-	if _, err := tmp.Write(data); err != nil {
-		tmp.Close()
-		os.Remove(name)
-		return err
+	if len(idxMeta) > 1 {
+		sort.Slice(idxMeta, func(i, j int) bool {
+			return idxMeta[i].Field < idxMeta[j].Field
+		})
 	}
-	if err := tmp.Close(); err != nil {
-		os.Remove(name)
+	return idxMeta, nil
+}
+
+func writeMetaFile(path string, meta *SnapshotMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
 		return err
 	}
-	return os.Rename(name, path)
+	return atomicfile.Write(path, data)
+}
+
+func indexFileName(field string) string {
+	return fmt.Sprintf("idx_%s.bin", sanitize(field))
+}
+
+func pageIndexFileName(field string) string {
+	return fmt.Sprintf("pages_%s.bin", sanitize(field))
 }
 
 func sanitize(field string) string {
@@ -642,6 +1590,10 @@ func fieldKindLabel(kind schema.FieldKind) string {
 		return "timestamptz"
 	case schema.KindDuration:
 		return "duration"
+	case schema.KindTime:
+		return "time"
+	case schema.KindUUID:
+		return "uuid"
 	default:
 		return fmt.Sprintf("kind_%d", int(kind))
 	}
@@ -649,20 +1601,9 @@ func fieldKindLabel(kind schema.FieldKind) string {
 
 // GenerateUUIDv7 emits a RFC 9562 compliant UUID version 7 string.
 func GenerateUUIDv7() (string, error) {
-	var uuid [16]byte
-	ts := time.Now().UnixMilli()
-	uuid[0] = byte(ts >> 40)
-	uuid[1] = byte(ts >> 32)
-	uuid[2] = byte(ts >> 24)
-	uuid[3] = byte(ts >> 16)
-	uuid[4] = byte(ts >> 8)
-	uuid[5] = byte(ts)
-	if _, err := rand.Read(uuid[6:]); err != nil {
+	id, err := uuid.NewV7()
+	if err != nil {
 		return "", err
 	}
-	uuid[6] &= 0x0F
-	uuid[6] |= 0x70 // version 7
-	uuid[8] &= 0x3F
-	uuid[8] |= 0x80 // variant RFC4122
-	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16]), nil
+	return id.String(), nil
 }
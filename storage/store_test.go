@@ -0,0 +1,1336 @@
+package storage_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/storage"
+)
+
+func TestLookupRowDetectsCorruptPage(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	rows := make([]map[string]any, 12)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i + 1), "Name": "user"}
+	}
+	payload, err := scrt.Marshal(sch, rows, scrt.WithRowsPerPage(4), scrt.WithPageChecksums())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := store.Persist("User", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	// Flip a byte inside the second page only.
+	index, err := storage.BuildRowIndex(payload)
+	if err != nil {
+		t.Fatalf("row index: %v", err)
+	}
+	second, _ := index.Lookup(4)
+	third, _ := index.Lookup(8)
+	corrupt := append([]byte(nil), payload...)
+	target := int(second.PageOffset+third.PageOffset) / 2
+	corrupt[target] ^= 0xFF
+	if err := os.WriteFile(filepath.Join(root, "User", "payload.scrt"), corrupt, 0o644); err != nil {
+		t.Fatalf("write corrupt payload: %v", err)
+	}
+
+	dst := codec.NewRow(sch)
+	for rowID := uint64(0); rowID < 12; rowID++ {
+		err := store.LookupRow("User", sch, rowID, dst)
+		inCorruptPage := rowID >= 4 && rowID < 8
+		if inCorruptPage {
+			if !errors.Is(err, codec.ErrPageChecksum) {
+				t.Fatalf("row %d: expected checksum error, got %v", rowID, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("row %d: %v", rowID, err)
+		}
+		if id, _ := dst.GetUint("ID"); id != rowID+1 {
+			t.Fatalf("row %d: expected ID %d, got %d", rowID, rowID+1, id)
+		}
+	}
+}
+
+func TestSetAutoCounter(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	backend, err := storage.NewSnapshotBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("backend: %v", err)
+	}
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Name": "a"}, {"ID": uint64(2), "Name": "b"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := backend.Persist("User", sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	if err := backend.SetAutoCounter("User", sch, "ID", 1000); err != nil {
+		t.Fatalf("SetAutoCounter: %v", err)
+	}
+	for _, want := range []uint64{1000, 1001} {
+		got, err := backend.NextAutoValue("User", sch, "ID")
+		if err != nil {
+			t.Fatalf("NextAutoValue: %v", err)
+		}
+		if got != want {
+			t.Fatalf("expected %d, got %d", want, got)
+		}
+	}
+
+	if err := backend.ResetAutoCounters("User"); err != nil {
+		t.Fatalf("ResetAutoCounters: %v", err)
+	}
+	if got, err := backend.NextAutoValue("User", sch, "ID"); err != nil || got != 3 {
+		t.Fatalf("after reset expected 3, got %d (%v)", got, err)
+	}
+
+	if err := backend.SetAutoCounter("User", sch, "Name", 5); !errors.Is(err, storage.ErrNotAutoIncrement) {
+		t.Fatalf("expected ErrNotAutoIncrement, got %v", err)
+	}
+}
+
+func TestLoadPayloadDetectsCorruption(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Name": "original"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := store.Persist("User", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	loaded, err := store.LoadPayload("User")
+	if err != nil {
+		t.Fatalf("LoadPayload: %v", err)
+	}
+	if !bytes.Equal(loaded, payload) {
+		t.Fatalf("LoadPayload returned different bytes than persisted")
+	}
+
+	path := filepath.Join(root, "User", "payload.scrt")
+	stored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read stored payload: %v", err)
+	}
+	stored[bytes.Index(stored, []byte("original"))] ^= 0x01
+	if err := os.WriteFile(path, stored, 0o644); err != nil {
+		t.Fatalf("write corrupt payload: %v", err)
+	}
+	if _, err := store.LoadPayload("User"); !errors.Is(err, codec.ErrFooterMismatch) {
+		t.Fatalf("expected ErrFooterMismatch, got %v", err)
+	}
+}
+
+func TestPersistAsyncIndexes(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Email string unique\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(10), "Email": "a@example.com"},
+		{"ID": uint64(20), "Email": "b@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	release := make(chan struct{})
+	store, err := storage.NewSnapshotStoreWithOptions(t.TempDir(), storage.WithBeforeIndexBuild(storage.StoreOptions{}, func(string) { <-release }))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	meta, err := store.Persist("User", sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch), AsyncIndexes: true})
+	if err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	for _, desc := range meta.Indexes {
+		if desc.Status != storage.IndexStatusBuilding {
+			t.Fatalf("index %s: expected building, got %q", desc.Field, desc.Status)
+		}
+	}
+	onDisk, err := store.LoadMeta("User")
+	if err != nil {
+		t.Fatalf("LoadMeta: %v", err)
+	}
+	if onDisk.Indexes[0].Status != storage.IndexStatusBuilding {
+		t.Fatalf("meta.json should mark indexes building, got %+v", onDisk.Indexes)
+	}
+	loaded, err := store.LoadPayload("User")
+	if err != nil || !bytes.Equal(loaded, payload) {
+		t.Fatalf("payload not readable while indexes build: %v", err)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		dst := codec.NewRow(sch)
+		found, err := store.LookupByUint("User", sch, "ID", 20, dst)
+		if err != nil || !found {
+			t.Fatalf("%s: LookupByUint: found=%v err=%v", stage, found, err)
+		}
+		if email, _ := dst.GetString("Email"); email != "b@example.com" {
+			t.Fatalf("%s: expected b@example.com, got %q", stage, email)
+		}
+		found, err = store.LookupByString("User", sch, "Email", "a@example.com", dst)
+		if err != nil || !found {
+			t.Fatalf("%s: LookupByString: found=%v err=%v", stage, found, err)
+		}
+		if id, _ := dst.GetUint("ID"); id != 10 {
+			t.Fatalf("%s: expected ID 10, got %d", stage, id)
+		}
+		if found, err := store.LookupByUint("User", sch, "ID", 99, dst); err != nil || found {
+			t.Fatalf("%s: missing key: found=%v err=%v", stage, found, err)
+		}
+	}
+	check("building")
+
+	close(release)
+	store.WaitForIndexes("User")
+	onDisk, err = store.LoadMeta("User")
+	if err != nil {
+		t.Fatalf("LoadMeta: %v", err)
+	}
+	for _, desc := range onDisk.Indexes {
+		if desc.Status != "" {
+			t.Fatalf("index %s: expected ready, got %q (%s)", desc.Field, desc.Status, desc.Error)
+		}
+	}
+	if next, err := store.NextAutoValue("User", sch, "ID"); err != nil || next != 21 {
+		t.Fatalf("expected next ID 21, got %d (%v)", next, err)
+	}
+	check("ready")
+}
+
+func TestDryRunIndexReportsAllDuplicates(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64\n@field Email string\n@field Team string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	rows := []map[string]any{
+		{"ID": uint64(1), "Email": "a@x", "Team": "red"},
+		{"ID": uint64(2), "Email": "b@x", "Team": "red"},
+		{"ID": uint64(1), "Email": "c@x", "Team": "blue"},
+		{"ID": uint64(3), "Email": "b@x", "Team": "blue"},
+		{"ID": uint64(2), "Email": "a@x", "Team": "red"},
+		{"ID": uint64(1), "Email": "d@x", "Team": "red"},
+	}
+	payload, err := scrt.Marshal(sch, rows, scrt.WithRowsPerPage(4))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	specs := []storage.IndexSpec{{Field: "ID", Unique: true}, {Field: "Email", Unique: true}, {Field: "Team"}}
+
+	report, err := storage.DryRunIndex(sch, payload, specs)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	want := map[string][]storage.DuplicateKey{
+		"ID":    {{Key: "1", Rows: []uint64{0, 2, 5}}, {Key: "2", Rows: []uint64{1, 4}}},
+		"Email": {{Key: "a@x", Rows: []uint64{0, 4}}, {Key: "b@x", Rows: []uint64{1, 3}}},
+	}
+	if !reflect.DeepEqual(report.Fields, want) {
+		t.Fatalf("unexpected report:\n got %+v\nwant %+v", report.Fields, want)
+	}
+
+	store, err := storage.NewSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := store.Persist("User", sch, payload, storage.PersistOptions{Indexes: specs}); err == nil {
+		t.Fatalf("expected Persist to reject duplicate keys")
+	}
+
+	clean, err := storage.DryRunIndex(sch, payload, []storage.IndexSpec{{Field: "Team"}})
+	if err != nil {
+		t.Fatalf("dry run non-unique: %v", err)
+	}
+	if !clean.Empty() {
+		t.Fatalf("expected empty report, got %+v", clean.Fields)
+	}
+}
+
+func TestTypedColumnIndexesRoundTrip(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Event\n@field ID uint64\n@field Code int64\n@field Day date\n@field Score float64\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Event")
+	day := func(d int) time.Time { return time.Date(2025, time.March, d, 0, 0, 0, 0, time.UTC) }
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1), "Code": int64(-404), "Day": day(1), "Score": 0.0},
+		{"ID": uint64(2), "Code": int64(200), "Day": day(2), "Score": math.Copysign(0, -1)},
+		{"ID": uint64(3), "Code": int64(500), "Day": day(3), "Score": 1.5},
+	}, scrt.WithRowsPerPage(2))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	specs := []storage.IndexSpec{{Field: "Code", Unique: true}, {Field: "Day", Unique: true}, {Field: "Score", Unique: true}}
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := store.Persist("Event", sch, payload, storage.PersistOptions{Indexes: specs}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	// A fresh store reads the indexes back from disk.
+	reopened, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	dst := codec.NewRow(sch)
+	if found, err := reopened.LookupByInt("Event", sch, "Code", -404, dst); err != nil || !found {
+		t.Fatalf("LookupByInt: found=%v err=%v", found, err)
+	}
+	if id, _ := dst.GetUint("ID"); id != 1 {
+		t.Fatalf("expected ID 1, got %d", id)
+	}
+	if found, err := reopened.LookupByTime("Event", sch, "Day", day(3).Add(15*time.Hour), dst); err != nil || !found {
+		t.Fatalf("LookupByTime: found=%v err=%v", found, err)
+	}
+	if id, _ := dst.GetUint("ID"); id != 3 {
+		t.Fatalf("expected ID 3, got %d", id)
+	}
+	if found, err := reopened.LookupByTime("Event", sch, "Day", day(9), dst); err != nil || found {
+		t.Fatalf("missing day: found=%v err=%v", found, err)
+	}
+	if _, err := reopened.LookupByTime("Event", sch, "Code", day(1), dst); err == nil {
+		t.Fatalf("expected LookupByTime to reject an int64 field")
+	}
+
+	file, err := os.Open(filepath.Join(root, "Event", "idx_day.bin"))
+	if err != nil {
+		t.Fatalf("open index: %v", err)
+	}
+	defer file.Close()
+	idx, err := storage.LoadColumnIndex(file)
+	if err != nil {
+		t.Fatalf("load index: %v", err)
+	}
+	if idx.Kind != schema.KindDate || idx.EntryCount() != 3 {
+		t.Fatalf("unexpected index kind %d with %d entries", idx.Kind, idx.EntryCount())
+	}
+	if _, ok := idx.MaxKey(); ok {
+		t.Fatalf("MaxKey should only report uint64 indexes")
+	}
+
+	// Float keys compare by bits, so 0 and -0 are distinct.
+	dup, err := storage.DryRunIndex(sch, payload, []storage.IndexSpec{{Field: "Score", Unique: true}})
+	if err != nil || !dup.Empty() {
+		t.Fatalf("expected no float duplicates, got %+v (%v)", dup, err)
+	}
+	repeated, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1), "Day": day(1)},
+		{"ID": uint64(2), "Day": day(1)},
+	})
+	if err != nil {
+		t.Fatalf("marshal repeated: %v", err)
+	}
+	report, err := storage.DryRunIndex(sch, repeated, []storage.IndexSpec{{Field: "Day", Unique: true}})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	want := []storage.DuplicateKey{{Key: "2025-03-01", Rows: []uint64{0, 1}}}
+	if !reflect.DeepEqual(report.Fields["Day"], want) {
+		t.Fatalf("unexpected date duplicates %+v", report.Fields)
+	}
+}
+
+func TestAggregateStoredPayload(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Hit\n@field ID uint64\n@field Bytes uint64\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Hit")
+	rows := make([]map[string]any, 1000)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i + 1), "Bytes": uint64(i + 1)}
+	}
+	payload, err := scrt.Marshal(sch, rows, scrt.WithRowsPerPage(100))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	store, err := storage.NewSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := store.Persist("Hit", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	if sum, err := store.Aggregate("Hit", sch, "Bytes", codec.AggSum); err != nil || sum != 500500 {
+		t.Fatalf("sum: expected 500500, got %v (%v)", sum, err)
+	}
+	if avg, err := store.Aggregate("Hit", sch, "Bytes", codec.AggAvg); err != nil || avg != 500.5 {
+		t.Fatalf("avg: expected 500.5, got %v (%v)", avg, err)
+	}
+	if _, err := store.Aggregate("Missing", sch, "Bytes", codec.AggSum); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for unknown schema, got %v", err)
+	}
+}
+
+func TestScanRangeSkipsPagesWithPageIndex(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Reading\n@field ID uint64\n@field Delta int64\n@field Label string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Reading")
+	rows := make([]map[string]any, 1000)
+	for i := range rows {
+		rows[i] = map[string]any{"ID": uint64(i + 1), "Delta": int64(i - 500), "Label": "r"}
+	}
+	payload, err := scrt.Marshal(sch, rows, scrt.WithRowsPerPage(100))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	meta, err := store.Persist("Reading", sch, payload, storage.PersistOptions{
+		Indexes: []storage.IndexSpec{{Field: "Delta", PageIndex: true}, {Field: "ID", Unique: true}},
+	})
+	if err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	if meta.Indexes[0].PagePath != "pages_delta.bin" || meta.Indexes[1].PagePath != "" {
+		t.Fatalf("unexpected page paths in %+v", meta.Indexes)
+	}
+
+	// Rows 240..380 hold deltas -260..-120, all within the third and fourth pages.
+	reopened, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	dst := codec.NewRow(sch)
+	var got []uint64
+	stats, err := reopened.ScanRange("Reading", sch, "Delta", codec.Value{Int: -260}, codec.Value{Int: -120}, dst, func(rowID uint64) error {
+		if id, _ := dst.GetUint("ID"); id != rowID+1 {
+			return fmt.Errorf("row %d decoded ID %d", rowID, id)
+		}
+		got = append(got, rowID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan range: %v", err)
+	}
+	if stats.Pages != 10 || stats.PagesRead != 2 || stats.RowsMatched != 141 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if len(got) != 141 || got[0] != 240 || got[len(got)-1] != 380 {
+		t.Fatalf("unexpected rows %d..%d (%d)", got[0], got[len(got)-1], len(got))
+	}
+
+	// ID has no page index, so every page is decoded.
+	stats, err = reopened.ScanRange("Reading", sch, "ID", codec.Value{Uint: 241}, codec.Value{Uint: 381}, dst, func(uint64) error { return nil })
+	if err != nil {
+		t.Fatalf("scan unindexed range: %v", err)
+	}
+	if stats.PagesRead != 10 || stats.RowsMatched != 141 {
+		t.Fatalf("unexpected unindexed stats %+v", stats)
+	}
+
+	if _, err := store.Persist("Reading", sch, payload, storage.PersistOptions{
+		Indexes: []storage.IndexSpec{{Field: "Label", PageIndex: true}},
+	}); err == nil {
+		t.Fatalf("expected a page index on a string field to be rejected")
+	}
+}
+
+func TestPersistEmptyPayload(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Log\n@field ID uint64\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Log")
+	payload, err := scrt.Marshal(sch, []map[string]any{})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	// Header-only payloads, without the terminator, index the same way.
+	for _, p := range [][]byte{payload, payload[:len(payload)-1]} {
+		index, err := storage.BuildRowIndex(p)
+		if err != nil || index.RowCount() != 0 {
+			t.Fatalf("expected an empty row index, got %d rows (%v)", index.RowCount(), err)
+		}
+	}
+	store, err := storage.NewSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	meta, err := store.Persist("Log", sch, payload, storage.PersistOptions{Indexes: []storage.IndexSpec{{Field: "ID", Unique: true}}})
+	if err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	if meta.RowCount != 0 {
+		t.Fatalf("expected 0 rows, got %d", meta.RowCount)
+	}
+	loaded, err := store.LoadPayload("Log")
+	if err != nil {
+		t.Fatalf("load payload: %v", err)
+	}
+	var out []map[string]any
+	if err := scrt.Unmarshal(loaded, sch, &out); err != nil || len(out) != 0 {
+		t.Fatalf("expected no rows, got %v (%v)", out, err)
+	}
+	if found, err := store.LookupByUint("Log", sch, "ID", 1, codec.NewRow(sch)); err != nil || found {
+		t.Fatalf("lookup in empty snapshot: found=%v err=%v", found, err)
+	}
+}
+
+func TestListAndDumpIndexes(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Email string unique\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(7), "Email": "ada@example.com", "Name": "Ada"},
+		{"ID": uint64(9), "Email": "lin@example.com", "Name": "Lin"},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := store.Persist("User", sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	// Dumping reads the index files only, so it works without the payload.
+	if err := os.Remove(filepath.Join(root, "User", "payload.scrt")); err != nil {
+		t.Fatalf("remove payload: %v", err)
+	}
+	reopened, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	indexes, err := reopened.ListIndexes("User")
+	if err != nil {
+		t.Fatalf("ListIndexes: %v", err)
+	}
+	var fields []string
+	for _, desc := range indexes {
+		fields = append(fields, desc.Field)
+	}
+	if !reflect.DeepEqual(fields, []string{"Email", "ID"}) {
+		t.Fatalf("unexpected indexes %v", fields)
+	}
+
+	ids, err := reopened.DumpIndex("User", "ID")
+	if err != nil {
+		t.Fatalf("DumpIndex ID: %v", err)
+	}
+	if want := map[string]uint64{"7": 0, "9": 1}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("ID entries = %v, want %v", ids, want)
+	}
+	emails, err := reopened.DumpIndex("User", "Email")
+	if err != nil {
+		t.Fatalf("DumpIndex Email: %v", err)
+	}
+	if want := map[string]uint64{"ada@example.com": 0, "lin@example.com": 1}; !reflect.DeepEqual(emails, want) {
+		t.Fatalf("Email entries = %v, want %v", emails, want)
+	}
+	if _, err := reopened.DumpIndex("User", "Name"); !errors.Is(err, storage.ErrIndexNotFound) {
+		t.Fatalf("expected ErrIndexNotFound for an unindexed field, got %v", err)
+	}
+
+	// A listed index whose file is gone is reported the same way.
+	if err := os.Remove(filepath.Join(root, "User", indexes[0].Path)); err != nil {
+		t.Fatalf("remove index file: %v", err)
+	}
+	reopened, err = storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if _, err := reopened.DumpIndex("User", indexes[0].Field); !errors.Is(err, storage.ErrIndexNotFound) {
+		t.Fatalf("expected ErrIndexNotFound for a missing index file, got %v", err)
+	}
+	if _, err := reopened.DumpIndex("Nobody", "ID"); !errors.Is(err, os.ErrNotExist) || errors.Is(err, storage.ErrIndexNotFound) {
+		t.Fatalf("expected ErrNotExist for an unknown schema, got %v", err)
+	}
+}
+
+func TestReindexRestoresDeletedIndex(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Email string unique\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1), "Email": "ada@example.com"},
+		{"ID": uint64(2), "Email": "lin@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	specs := storage.AutoIndexSpecs(sch)
+	if _, err := store.Persist("User", sch, payload, storage.PersistOptions{Indexes: specs}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	payloadPath := filepath.Join(root, "User", "payload.scrt")
+	before, err := os.ReadFile(payloadPath)
+	if err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	if err := os.Remove(filepath.Join(root, "User", "idx_email.bin")); err != nil {
+		t.Fatalf("remove index: %v", err)
+	}
+	if err := os.Remove(filepath.Join(root, "User", "counters.json")); err != nil {
+		t.Fatalf("remove counters: %v", err)
+	}
+
+	reopened, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	dst := codec.NewRow(sch)
+	if _, err := reopened.LookupByString("User", sch, "Email", "lin@example.com", dst); err == nil {
+		t.Fatalf("expected lookup to fail without its index file")
+	}
+	if err := reopened.Reindex("User", sch, specs); err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	after, err := os.ReadFile(payloadPath)
+	if err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("reindex rewrote the payload")
+	}
+	for _, s := range []*storage.SnapshotStore{reopened, mustReopen(t, root)} {
+		if found, err := s.LookupByString("User", sch, "Email", "lin@example.com", dst); err != nil || !found {
+			t.Fatalf("LookupByString after reindex: found=%v err=%v", found, err)
+		}
+		if id, _ := dst.GetUint("ID"); id != 2 {
+			t.Fatalf("expected ID 2, got %d", id)
+		}
+	}
+	if next, err := mustReopen(t, root).NextAutoValue("User", sch, "ID"); err != nil || next != 3 {
+		t.Fatalf("NextAutoValue after reindex: next=%d err=%v", next, err)
+	}
+}
+
+func TestReindexKeepsIssuedAutoValues(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Email string unique\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Email": "ada@example.com"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	specs := storage.AutoIndexSpecs(sch)
+	if _, err := store.Persist("User", sch, payload, storage.PersistOptions{Indexes: specs}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	for range 4 {
+		if _, err := store.NextAutoValue("User", sch, "ID"); err != nil {
+			t.Fatalf("next auto value: %v", err)
+		}
+	}
+	if err := store.Reindex("User", sch, specs); err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	if next, err := store.NextAutoValue("User", sch, "ID"); err != nil || next != 6 {
+		t.Fatalf("NextAutoValue after reindex: next=%d err=%v", next, err)
+	}
+	if next, err := mustReopen(t, root).NextAutoValue("User", sch, "ID"); err != nil || next != 7 {
+		t.Fatalf("NextAutoValue after reopening: next=%d err=%v", next, err)
+	}
+}
+
+func TestVacuumCoalescesAppendedPages(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Email string unique\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	// Each append adds a one-row page, as incremental uploads do.
+	var payload []byte
+	for i := 1; i <= 200; i++ {
+		payload, err = scrt.MarshalAppend(payload, sch, []map[string]any{{"ID": uint64(i), "Email": fmt.Sprintf("u%d@example.com", i)}})
+		if err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+	pages := func(payload []byte) int {
+		index, err := storage.BuildRowIndex(payload)
+		if err != nil {
+			t.Fatalf("row index: %v", err)
+		}
+		offsets := map[uint64]bool{}
+		for id := range index.RowCount() {
+			loc, _ := index.Lookup(id)
+			offsets[loc.PageOffset] = true
+		}
+		return len(offsets)
+	}
+	if got := pages(payload); got != 200 {
+		t.Fatalf("expected 200 appended pages, got %d", got)
+	}
+
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := store.Persist("User", sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	// Hand out IDs past the stored rows; vacuum must not reissue them.
+	for range 5 {
+		if _, err := store.NextAutoValue("User", sch, "ID"); err != nil {
+			t.Fatalf("next auto value: %v", err)
+		}
+	}
+
+	meta, err := store.Vacuum("User", sch)
+	if err != nil {
+		t.Fatalf("vacuum: %v", err)
+	}
+	if meta.RowCount != 200 || len(meta.Indexes) != 2 {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+	vacuumed, err := store.LoadPayload("User")
+	if err != nil {
+		t.Fatalf("load payload: %v", err)
+	}
+	if got := pages(vacuumed); got != 1 {
+		t.Fatalf("expected 1 page after vacuum, got %d", got)
+	}
+	var before, after []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &before); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := scrt.Unmarshal(vacuumed, sch, &after); err != nil {
+		t.Fatalf("unmarshal vacuumed: %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("vacuum changed the rows")
+	}
+	for _, s := range []*storage.SnapshotStore{store, mustReopen(t, root)} {
+		dst := codec.NewRow(sch)
+		if found, err := s.LookupByString("User", sch, "Email", "u150@example.com", dst); err != nil || !found {
+			t.Fatalf("LookupByString after vacuum: found=%v err=%v", found, err)
+		}
+		if id, _ := dst.GetUint("ID"); id != 150 {
+			t.Fatalf("expected ID 150, got %d", id)
+		}
+		if err := s.LookupRow("User", sch, 199, dst); err != nil {
+			t.Fatalf("LookupRow after vacuum: %v", err)
+		}
+		if id, _ := dst.GetUint("ID"); id != 200 {
+			t.Fatalf("expected row 199 to hold ID 200, got %d", id)
+		}
+	}
+	if next, err := mustReopen(t, root).NextAutoValue("User", sch, "ID"); err != nil || next != 206 {
+		t.Fatalf("NextAutoValue after vacuum: next=%d err=%v", next, err)
+	}
+	if _, err := store.Vacuum("Missing", sch); err == nil {
+		t.Fatalf("expected an error for a schema mismatch")
+	}
+}
+
+func TestVacuumPurgesTombstones(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if err := store.SetTombstones("User", []uint64{1}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist before the first persist, got %v", err)
+	}
+	persistNamedRows(t, store, sch, 10, "")
+	if err := store.SetTombstones("User", []uint64{7, 2, 7, 0}); err != nil {
+		t.Fatalf("set tombstones: %v", err)
+	}
+	if got, err := mustReopen(t, root).Tombstones("User"); err != nil || !reflect.DeepEqual(got, []uint64{0, 2, 7}) {
+		t.Fatalf("tombstones = %v, %v; want sorted and deduplicated", got, err)
+	}
+	if err := store.AddTombstone("User", 5); err != nil {
+		t.Fatalf("add tombstone: %v", err)
+	}
+	if err := store.AddTombstone("User", 2); err != nil {
+		t.Fatalf("add tombstone again: %v", err)
+	}
+	if err := store.RemoveTombstones("User", []uint64{5, 9}); err != nil {
+		t.Fatalf("remove tombstones: %v", err)
+	}
+	if got, err := store.Tombstones("User"); err != nil || !reflect.DeepEqual(got, []uint64{0, 2, 7}) {
+		t.Fatalf("tombstones = %v, %v; want [0 2 7]", got, err)
+	}
+
+	meta, err := store.Vacuum("User", sch)
+	if err != nil {
+		t.Fatalf("vacuum: %v", err)
+	}
+	if meta.RowCount != 7 {
+		t.Fatalf("expected 7 rows after vacuum, got %d", meta.RowCount)
+	}
+	if got, err := store.Tombstones("User"); err != nil || got != nil {
+		t.Fatalf("expected no tombstones after vacuum, got %v, %v", got, err)
+	}
+	dst := codec.NewRow(sch)
+	if err := store.LookupRow("User", sch, 0, dst); err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if id, _ := dst.GetUint("ID"); id != 2 {
+		t.Fatalf("expected row 0 to hold ID 2, got %d", id)
+	}
+	// IDs of purged rows are not handed out again.
+	if next, err := store.NextAutoValue("User", sch, "ID"); err != nil || next != 11 {
+		t.Fatalf("NextAutoValue after purge: next=%d err=%v", next, err)
+	}
+}
+
+func mustReopen(t *testing.T, root string) *storage.SnapshotStore {
+	t.Helper()
+	store, err := storage.NewSnapshotStore(root)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	return store
+}
+
+func TestPersistSortByMergesAppendedRows(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Event\n@field ID uint64\n@field At int64\n@field Blob bytes\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Event")
+	// Rows 1-3 are the sorted snapshot; rows 4-6 are an appended batch.
+	payload, err := scrt.Marshal(sch, []map[string]any{
+		{"ID": uint64(1), "At": int64(10)},
+		{"ID": uint64(2), "At": int64(20)},
+		{"ID": uint64(3), "At": int64(30)},
+		{"ID": uint64(4), "At": int64(25)},
+		{"ID": uint64(5), "At": int64(5)},
+		{"ID": uint64(6), "At": int64(20)},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	store, err := storage.NewSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := store.Persist("Event", sch, payload, storage.PersistOptions{SortBy: "At"}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	stored, err := store.LoadPayload("Event")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	var rows []struct {
+		ID uint64
+		At int64
+	}
+	if err := scrt.Unmarshal(stored, sch, &rows); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	var ids []uint64
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	// ID 2 was stored before ID 6, so it stays ahead of it on the tie at 20.
+	if want := []uint64{5, 1, 2, 6, 4, 3}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("stored order = %v, want %v", ids, want)
+	}
+
+	if _, err := store.Persist("Event", sch, payload, storage.PersistOptions{SortBy: "Blob"}); !errors.Is(err, codec.ErrUnsortableKind) {
+		t.Fatalf("expected ErrUnsortableKind for a bytes field, got %v", err)
+	}
+}
+
+func TestPersistRepagesGlobalStrings(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Msg\n@field ID uint64\n@field Lang string encoding=global\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Msg")
+	langs := []string{"en", "de", "fr"}
+	input := make([]map[string]any, 9)
+	for i := range input {
+		input[i] = map[string]any{"ID": uint64(i), "Lang": langs[i%len(langs)]}
+	}
+	// Later pages of the marshalled payload reference "en" without carrying it.
+	payload, err := scrt.Marshal(sch, input, scrt.WithRowsPerPage(2))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	store, err := storage.NewSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := store.Persist("Msg", sch, payload, storage.PersistOptions{}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	row := codec.NewRow(sch)
+	for id := uint64(len(input)); id > 0; id-- {
+		if err := store.LookupRow("Msg", sch, id-1, row); err != nil {
+			t.Fatalf("lookup row %d: %v", id-1, err)
+		}
+		if got, _ := row.GetString("Lang"); got != langs[(id-1)%3] {
+			t.Fatalf("row %d: lang %q, want %q", id-1, got, langs[(id-1)%3])
+		}
+	}
+}
+
+func persistNamedRows(t testing.TB, store *storage.SnapshotStore, sch *schema.Schema, rows int, suffix string) {
+	t.Helper()
+	input := make([]map[string]any, rows)
+	for i := range input {
+		input[i] = map[string]any{"ID": uint64(i + 1), "Name": fmt.Sprintf("user-%d%s", i+1, suffix)}
+	}
+	payload, err := scrt.Marshal(sch, input, scrt.WithRowsPerPage(4))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := store.Persist(sch.Name, sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch)}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+}
+
+func TestPageCacheServesAndInvalidates(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	store, err := storage.NewSnapshotStoreWithOptions(t.TempDir(), storage.StoreOptions{PageCacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	persistNamedRows(t, store, sch, 10, "")
+	dst := codec.NewRow(sch)
+	lookupName := func(id uint64) string {
+		t.Helper()
+		if found, err := store.LookupByUint("User", sch, "ID", id, dst); err != nil || !found {
+			t.Fatalf("LookupByUint(%d): found=%v err=%v", id, found, err)
+		}
+		name, _ := dst.GetString("Name")
+		return name
+	}
+	if got := lookupName(1); got != "user-1" {
+		t.Fatalf("row 1 = %q", got)
+	}
+	if got := lookupName(3); got != "user-3" {
+		t.Fatalf("row 3 = %q", got)
+	}
+	if pages, _ := storage.PageCacheUsage(store); pages != 1 {
+		t.Fatalf("rows 1 and 3 share a page; cached %d pages", pages)
+	}
+	if got := lookupName(9); got != "user-9" {
+		t.Fatalf("row 9 = %q", got)
+	}
+	if pages, _ := storage.PageCacheUsage(store); pages != 2 {
+		t.Fatalf("expected 2 cached pages, got %d", pages)
+	}
+
+	// Rewriting the payload keeps the page offsets but must drop the old rows.
+	persistNamedRows(t, store, sch, 10, "-v2")
+	if pages, _ := storage.PageCacheUsage(store); pages != 0 {
+		t.Fatalf("persist left %d cached pages", pages)
+	}
+	if got := lookupName(1); got != "user-1-v2" {
+		t.Fatalf("row 1 after rewrite = %q", got)
+	}
+	if err := store.Delete("User"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if pages, _ := storage.PageCacheUsage(store); pages != 0 {
+		t.Fatalf("delete left %d cached pages", pages)
+	}
+}
+
+func TestPageCacheEvictsToBound(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	probe, err := storage.NewSnapshotStoreWithOptions(t.TempDir(), storage.StoreOptions{PageCacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	persistNamedRows(t, probe, sch, 8, "")
+	dst := codec.NewRow(sch)
+	if _, err := probe.LookupByUint("User", sch, "ID", 1, dst); err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	_, pageBytes := storage.PageCacheUsage(probe)
+	if pageBytes == 0 {
+		t.Fatalf("expected a non-zero page footprint")
+	}
+
+	limit := pageBytes + pageBytes/2
+	store, err := storage.NewSnapshotStoreWithOptions(t.TempDir(), storage.StoreOptions{PageCacheBytes: limit})
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	persistNamedRows(t, store, sch, 8, "")
+	for _, id := range []uint64{1, 5, 2} {
+		if found, err := store.LookupByUint("User", sch, "ID", id, dst); err != nil || !found {
+			t.Fatalf("LookupByUint(%d): found=%v err=%v", id, found, err)
+		}
+		if pages, used := storage.PageCacheUsage(store); pages != 1 || used > limit {
+			t.Fatalf("after row %d: %d pages using %d of %d bytes", id, pages, used, limit)
+		}
+	}
+	if name, _ := dst.GetString("Name"); name != "user-2" {
+		t.Fatalf("row 2 = %q", name)
+	}
+}
+
+func BenchmarkLookupByUint(b *testing.B) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Name string\n"))
+	if err != nil {
+		b.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	for _, bc := range []struct {
+		name  string
+		cache int64
+	}{{"uncached", 0}, {"cached", 8 << 20}} {
+		b.Run(bc.name, func(b *testing.B) {
+			store, err := storage.NewSnapshotStoreWithOptions(b.TempDir(), storage.StoreOptions{PageCacheBytes: bc.cache})
+			if err != nil {
+				b.Fatalf("store: %v", err)
+			}
+			persistNamedRows(b, store, sch, 4096, "")
+			dst := codec.NewRow(sch)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := store.LookupByUint("User", sch, "ID", uint64(i%64)+1, dst); err != nil {
+					b.Fatalf("lookup: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPersistEncryptedRoundTrip(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64 auto_increment\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	aead, err := storage.NewCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	if _, err := storage.NewCipher(make([]byte, 16)); err == nil {
+		t.Fatalf("expected a 16-byte key to be rejected")
+	}
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStoreWithOptions(root, storage.StoreOptions{Cipher: aead})
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	input := make([]map[string]any, 10)
+	for i := range input {
+		input[i] = map[string]any{"ID": uint64(i + 1), "Name": fmt.Sprintf("secret-%d", i+1)}
+	}
+	payload, err := scrt.Marshal(sch, input, scrt.WithRowsPerPage(4))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	meta, err := store.Persist("User", sch, payload, storage.PersistOptions{Indexes: storage.AutoIndexSpecs(sch), Cipher: aead})
+	if err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	if !meta.Encrypted {
+		t.Fatalf("meta should record encryption")
+	}
+	payloadPath := filepath.Join(root, "User", "payload.scrt")
+	onDisk, err := os.ReadFile(payloadPath)
+	if err != nil {
+		t.Fatalf("read payload file: %v", err)
+	}
+	// The nonce follows the 4-byte magic.
+	nonce := onDisk[4 : 4+aead.NonceSize()]
+	if bytes.HasPrefix(onDisk, []byte("SCRT")) || bytes.Contains(onDisk, []byte("secret-")) {
+		t.Fatalf("payload file is not encrypted")
+	}
+
+	check := func(store *storage.SnapshotStore, want []byte) {
+		t.Helper()
+		loaded, err := store.LoadPayload("User")
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		if !bytes.Equal(loaded, want) {
+			t.Fatalf("decrypted payload differs from the persisted one")
+		}
+		row := codec.NewRow(sch)
+		if err := store.LookupRow("User", sch, 5, row); err != nil {
+			t.Fatalf("lookup row: %v", err)
+		}
+		if got := row.Values()[1].Str; got != "secret-6" {
+			t.Fatalf("row 5: expected secret-6, got %q", got)
+		}
+		if found, err := store.LookupByUint("User", sch, "ID", 9, row); err != nil || !found || row.Values()[1].Str != "secret-9" {
+			t.Fatalf("lookup by ID: found=%v err=%v name=%q", found, err, row.Values()[1].Str)
+		}
+	}
+	check(store, payload)
+	reopened, err := storage.NewSnapshotStoreWithOptions(root, storage.StoreOptions{Cipher: aead})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	check(reopened, payload)
+	reloaded, err := reopened.LoadMeta("User")
+	if err != nil {
+		t.Fatalf("load meta: %v", err)
+	}
+	if !reloaded.Encrypted {
+		t.Fatalf("meta.json lost the encryption record")
+	}
+
+	// Vacuum keeps the payload encrypted, under a new nonce.
+	repaged, err := scrt.Marshal(sch, input)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	vacuumed, err := reopened.Vacuum("User", sch)
+	if err != nil {
+		t.Fatalf("vacuum: %v", err)
+	}
+	rewritten, err := os.ReadFile(payloadPath)
+	if err != nil {
+		t.Fatalf("read payload file: %v", err)
+	}
+	if !vacuumed.Encrypted || bytes.Equal(rewritten[4:4+aead.NonceSize()], nonce) {
+		t.Fatalf("vacuum should re-encrypt under a fresh nonce")
+	}
+	check(reopened, repaged)
+
+	// Lookups keep the plaintext in memory, but not past a rewrite.
+	input[5]["Name"] = "secret-6b"
+	replaced, err := scrt.Marshal(sch, input)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := reopened.Persist("User", sch, replaced, storage.PersistOptions{Cipher: aead}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	row := codec.NewRow(sch)
+	if err := reopened.LookupRow("User", sch, 5, row); err != nil || row.Values()[1].Str != "secret-6b" {
+		t.Fatalf("lookup after rewrite: %q (%v)", row.Values()[1].Str, err)
+	}
+
+	if _, err := mustReopen(t, root).LoadPayload("User"); !errors.Is(err, storage.ErrCipherRequired) {
+		t.Fatalf("expected ErrCipherRequired without a cipher, got %v", err)
+	}
+}
+
+func TestPersistEncryptedDetectsTampering(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema User\n@field ID uint64\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("User")
+	aead, err := storage.NewCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	root := t.TempDir()
+	store, err := storage.NewSnapshotStoreWithOptions(root, storage.StoreOptions{Cipher: aead})
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	payload, err := scrt.Marshal(sch, []map[string]any{{"ID": uint64(1), "Name": "ada"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := store.Persist("User", sch, payload, storage.PersistOptions{Cipher: aead}); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	otherKey, err := storage.NewCipher(bytes.Repeat([]byte{8}, 32))
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	wrong, err := storage.NewSnapshotStoreWithOptions(root, storage.StoreOptions{Cipher: otherKey})
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if _, err := wrong.LoadPayload("User"); !errors.Is(err, storage.ErrPayloadAuthentication) {
+		t.Fatalf("wrong key: expected ErrPayloadAuthentication, got %v", err)
+	}
+
+	path := filepath.Join(root, "User", "payload.scrt")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read payload file: %v", err)
+	}
+	data[len(data)/2] ^= 0x01
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("tamper: %v", err)
+	}
+	if _, err := store.LoadPayload("User"); !errors.Is(err, storage.ErrPayloadAuthentication) {
+		t.Fatalf("tampered file: expected ErrPayloadAuthentication, got %v", err)
+	}
+	if err := store.LookupRow("User", sch, 0, codec.NewRow(sch)); !errors.Is(err, storage.ErrPayloadAuthentication) {
+		t.Fatalf("tampered lookup: expected ErrPayloadAuthentication, got %v", err)
+	}
+}
+
+func TestCompactSnapshotsMergesSortedInputs(t *testing.T) {
+	doc, err := schema.Parse(strings.NewReader("@schema Day\n@field ID uint64 unique\n@field Name string\n"))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, _ := doc.Schema("Day")
+	dir := t.TempDir()
+	writeInput := func(file, label string, ids ...uint64) string {
+		t.Helper()
+		input := make([]map[string]any, len(ids))
+		for i, id := range ids {
+			input[i] = map[string]any{"ID": id, "Name": fmt.Sprintf("%s%d", label, id)}
+		}
+		payload, err := scrt.Marshal(sch, input, scrt.WithRowsPerPage(2))
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		path := filepath.Join(dir, file)
+		if err := os.WriteFile(path, payload, 0o644); err != nil {
+			t.Fatalf("write input: %v", err)
+		}
+		return path
+	}
+	inputs := []string{
+		writeInput("mon.scrt", "a", 1, 3, 5, 7),
+		writeInput("tue.scrt", "b", 2, 3, 6),
+		writeInput("wed.scrt", "c", 3, 7, 8),
+	}
+	compacted := func(root string) []string {
+		t.Helper()
+		payload, err := mustReopen(t, root).LoadPayload("Day")
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		var rows []struct {
+			ID   uint64
+			Name string
+		}
+		if err := scrt.Unmarshal(payload, sch, &rows); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		names := make([]string, len(rows))
+		for i, row := range rows {
+			names[i] = row.Name
+		}
+		return names
+	}
+
+	root := t.TempDir()
+	if err := storage.CompactSnapshots(filepath.Join(root, "Day"), sch, "ID", inputs...); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if got, want := compacted(root), []string{"a1", "b2", "c3", "a5", "b6", "c7", "c8"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("KeepLast = %v, want %v", got, want)
+	}
+	// The rebuilt unique index serves lookups through a store.
+	store := mustReopen(t, root)
+	dst := codec.NewRow(sch)
+	if found, err := store.LookupByUint("Day", sch, "ID", 7, dst); err != nil || !found {
+		t.Fatalf("LookupByUint(7): found=%v err=%v", found, err)
+	}
+	if name, _ := dst.GetString("Name"); name != "c7" {
+		t.Fatalf("row 7 = %q, want c7", name)
+	}
+	if meta, err := store.LoadMeta("Day"); err != nil || meta.RowCount != 7 || len(meta.Indexes) != 1 {
+		t.Fatalf("meta = %+v, err %v", meta, err)
+	}
+
+	for _, tc := range []struct {
+		policy storage.DuplicatePolicy
+		want   []string
+	}{
+		{storage.KeepFirst, []string{"a1", "b2", "a3", "a5", "b6", "a7", "c8"}},
+		{storage.KeepAll, []string{"a1", "b2", "a3", "b3", "c3", "a5", "b6", "a7", "c7", "c8"}},
+	} {
+		root := t.TempDir()
+		// Repeated keys cannot back the unique index, so KeepAll builds none.
+		opts := storage.CompactOptions{Duplicates: tc.policy, Indexes: []storage.IndexSpec{}, RowsPerPage: 3}
+		if err := storage.CompactSnapshotsWithOptions(filepath.Join(root, "Day"), sch, "ID", opts, inputs...); err != nil {
+			t.Fatalf("compact policy %d: %v", tc.policy, err)
+		}
+		if got := compacted(root); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("policy %d = %v, want %v", tc.policy, got, tc.want)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "Day")
+	opts := storage.CompactOptions{Duplicates: storage.RejectDuplicates}
+	if err := storage.CompactSnapshotsWithOptions(out, sch, "ID", opts, inputs...); !errors.Is(err, storage.ErrDuplicateKey) {
+		t.Fatalf("expected ErrDuplicateKey, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "meta.json")); !os.IsNotExist(err) {
+		t.Fatalf("failed compaction wrote meta.json: %v", err)
+	}
+	unsorted := writeInput("thu.scrt", "d", 4, 2)
+	if err := storage.CompactSnapshots(out, sch, "ID", inputs[0], unsorted); err == nil || !strings.Contains(err.Error(), "thu.scrt is not sorted by ID at row 1") {
+		t.Fatalf("expected an unsorted input error, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/oarkflow/scrt/internal/atomicfile"
+)
+
+// Tombstones returns the sorted IDs of the rows of schemaName marked deleted
+// by SetTombstones, or nil when none are. Tombstoned rows stay in the
+// payload until Vacuum purges them; reads through the store still return
+// them, so callers filter.
+func (s *SnapshotStore) Tombstones(schemaName string) ([]uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loadTombstones(schemaName)
+}
+
+// SetTombstones replaces the tombstoned row IDs of schemaName. An empty set
+// removes the sidecar. The snapshot must exist. Row IDs refer to the
+// current payload, so a caller that rewrites it with rows removed or
+// reordered must remap or clear them.
+func (s *SnapshotStore) SetTombstones(schemaName string, rowIDs []uint64) error {
+	if _, err := s.LoadMeta(schemaName); err != nil {
+		return err
+	}
+	ids := slices.Clone(rowIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveTombstones(schemaName, ids)
+}
+
+// AddTombstone marks rowID of schemaName deleted, leaving it marked if it
+// already is. Unlike a Tombstones and SetTombstones pair it holds the lock
+// across the update, so concurrent calls do not drop each other's IDs.
+func (s *SnapshotStore) AddTombstone(schemaName string, rowID uint64) error {
+	if _, err := s.LoadMeta(schemaName); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.loadTombstones(schemaName)
+	if err != nil {
+		return err
+	}
+	pos, found := slices.BinarySearch(ids, rowID)
+	if found {
+		return nil
+	}
+	return s.saveTombstones(schemaName, slices.Insert(ids, pos, rowID))
+}
+
+// RemoveTombstones unmarks rowIDs of schemaName, as when a write replaces
+// a deleted row in place. IDs that are not marked are ignored.
+func (s *SnapshotStore) RemoveTombstones(schemaName string, rowIDs []uint64) error {
+	if len(rowIDs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.loadTombstones(schemaName)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	kept := slices.DeleteFunc(ids, func(id uint64) bool { return slices.Contains(rowIDs, id) })
+	return s.saveTombstones(schemaName, kept)
+}
+
+func (s *SnapshotStore) tombstonesPath(schemaName string) string {
+	return filepath.Join(s.root, schemaName, "tombstones.json")
+}
+
+// loadTombstones reads the sidecar. Callers hold s.mu.
+func (s *SnapshotStore) loadTombstones(schemaName string) ([]uint64, error) {
+	data, err := os.ReadFile(s.tombstonesPath(schemaName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// saveTombstones writes the sidecar, removing it for an empty set. Callers
+// hold s.mu.
+func (s *SnapshotStore) saveTombstones(schemaName string, ids []uint64) error {
+	if len(ids) == 0 {
+		if err := os.Remove(s.tombstonesPath(schemaName)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(s.tombstonesPath(schemaName), data)
+}
@@ -0,0 +1,92 @@
+package temporal
+
+import (
+	"slices"
+	"sync"
+)
+
+// layoutSet is a concurrency-safe candidate list: an optional preferred
+// layout, then the built-in layouts, then registered ones. The combined
+// slice is rebuilt on every change and never mutated, so parsers can use it
+// after releasing the lock.
+type layoutSet struct {
+	mu         sync.RWMutex
+	builtin    []string
+	registered []string
+	preferred  string
+	all        []string
+}
+
+func newLayoutSet(builtin []string) *layoutSet {
+	return &layoutSet{builtin: builtin, all: builtin}
+}
+
+func (ls *layoutSet) layouts() []string {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	return ls.all
+}
+
+func (ls *layoutSet) register(layout string) {
+	if layout == "" {
+		return
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if slices.Contains(ls.builtin, layout) || slices.Contains(ls.registered, layout) {
+		return
+	}
+	ls.registered = append(ls.registered, layout)
+	ls.rebuild()
+}
+
+func (ls *layoutSet) prefer(layout string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.preferred = layout
+	ls.rebuild()
+}
+
+func (ls *layoutSet) rebuild() {
+	all := make([]string, 0, 1+len(ls.builtin)+len(ls.registered))
+	if ls.preferred != "" {
+		all = append(all, ls.preferred)
+	}
+	all = append(all, ls.builtin...)
+	all = append(all, ls.registered...)
+	ls.all = all
+}
+
+var (
+	dateLayoutSet     = newLayoutSet(dateLayouts)
+	datetimeLayoutSet = newLayoutSet(datetimeLayouts)
+)
+
+// RegisterDateLayout adds a Go time layout to the ones ParseDate tries. The
+// registered layout is tried after every built-in one, so it cannot change
+// how an input the built-ins already accept is read. Registering a layout
+// twice, or registering a built-in layout, has no effect. It is safe to call
+// while other goroutines parse.
+func RegisterDateLayout(layout string) {
+	dateLayoutSet.register(layout)
+}
+
+// RegisterDateTimeLayout adds a layout to the ones ParseDateTime tries, and
+// to the zone-less fallbacks of ParseTimestamp, after the built-in ones.
+func RegisterDateTimeLayout(layout string) {
+	datetimeLayoutSet.register(layout)
+}
+
+// SetPreferredDateLayout makes ParseDate try layout before any other, for
+// inputs that are ambiguous under the built-ins (01/02/2006 versus
+// 02/01/2006). An empty layout restores the default order.
+func SetPreferredDateLayout(layout string) {
+	dateLayoutSet.prefer(layout)
+}
+
+// SetPreferredDateTimeLayout makes ParseDateTime and the zone-less
+// ParseTimestamp fallbacks try layout first. An empty layout restores the
+// default order.
+func SetPreferredDateTimeLayout(layout string) {
+	datetimeLayoutSet.prefer(layout)
+}
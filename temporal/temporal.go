@@ -10,6 +10,7 @@ import (
 )
 
 var (
+	// Built-in layouts; see RegisterDateLayout for adding more.
 	dateLayouts = []string{
 		"2006-01-02",
 		"02-01-2006",
@@ -60,16 +61,32 @@ var (
 		time.RFC1123Z,
 		time.RFC1123,
 	}
+
+	// Go layouts accept one- or two-digit hours and a fractional second
+	// after the seconds field. Inputs are upper-cased so "pm" matches PM.
+	timeOfDayLayouts = []string{
+		"15:04:05",
+		"15:04",
+		"3:04:05 PM",
+		"3:04 PM",
+		"3:04:05PM",
+		"3:04PM",
+	}
 )
 
 var dayPattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)d`)
 
-// ParseDuration parses human friendly durations, extending Go's syntax with day units.
+// ParseDuration parses human friendly durations, extending Go's syntax with
+// day units. Inputs starting with P (after an optional sign) are read as ISO
+// 8601 durations such as "PT1H30M" or "P1DT2.5S"; see parseISODuration.
 func ParseDuration(raw string) (time.Duration, error) {
 	trimmed := strings.TrimSpace(raw)
 	if trimmed == "" {
 		return 0, fmt.Errorf("temporal: empty duration literal")
 	}
+	if unsigned := strings.TrimLeft(trimmed, "+-"); unsigned != "" && (unsigned[0] == 'P' || unsigned[0] == 'p') {
+		return parseISODuration(trimmed)
+	}
 	normalized, err := normalizeDurationDays(trimmed)
 	if err != nil {
 		return 0, err
@@ -87,7 +104,7 @@ func ParseDate(raw string) (time.Time, error) {
 	if trimmed == "" {
 		return time.Time{}, fmt.Errorf("temporal: empty date literal")
 	}
-	if t, err := parseNoZoneLayouts(trimmed, dateLayouts); err == nil {
+	if t, err := parseNoZoneLayouts(trimmed, dateLayoutSet.layouts()); err == nil {
 		return DecodeDate(EncodeDate(t)), nil
 	}
 	return time.Time{}, fmt.Errorf("temporal: unable to parse date %q", raw)
@@ -99,14 +116,21 @@ func ParseDateTime(raw string) (time.Time, error) {
 	if trimmed == "" {
 		return time.Time{}, fmt.Errorf("temporal: empty datetime literal")
 	}
-	if t, err := parseNoZoneLayouts(trimmed, datetimeLayouts); err == nil {
+	if t, err := parseNoZoneLayouts(trimmed, datetimeLayoutSet.layouts()); err == nil {
 		return t.UTC(), nil
 	}
 	return time.Time{}, fmt.Errorf("temporal: unable to parse datetime %q", raw)
 }
 
-// ParseTimestamp parses timestamps, accepting timezone-aware strings or epoch numbers.
+// ParseTimestamp parses timestamps, accepting timezone-aware strings or epoch
+// numbers whose unit is inferred (see InferEpochUnit).
 func ParseTimestamp(raw string) (time.Time, error) {
+	return ParseTimestampUnit(raw, EpochAuto)
+}
+
+// ParseTimestampUnit is ParseTimestamp with integer epochs read in unit.
+// Decimal and exponent epochs ("1.5", "1e9") are always seconds.
+func ParseTimestampUnit(raw string, unit EpochUnit) (time.Time, error) {
 	trimmed := strings.TrimSpace(raw)
 	if trimmed == "" {
 		return time.Time{}, fmt.Errorf("temporal: empty timestamp literal")
@@ -114,11 +138,11 @@ func ParseTimestamp(raw string) (time.Time, error) {
 	if t, err := parseZoneLayouts(trimmed, timestampZoneLayouts); err == nil {
 		return t.UTC(), nil
 	}
-	if t, err := parseNoZoneLayouts(trimmed, datetimeLayouts); err == nil {
+	if t, err := parseNoZoneLayouts(trimmed, datetimeLayoutSet.layouts()); err == nil {
 		return t.UTC(), nil
 	}
-	if t, ok := parseEpochString(trimmed); ok {
-		return t, nil
+	if t, ok, err := parseEpochString(trimmed, unit); ok {
+		return t, err
 	}
 	return time.Time{}, fmt.Errorf("temporal: unable to parse timestamp %q", raw)
 }
@@ -132,12 +156,53 @@ func ParseTimestampTZ(raw string) (time.Time, error) {
 	if t, err := parseZoneLayouts(trimmed, timestampZoneLayouts); err == nil {
 		return t, nil
 	}
-	if t, ok := parseEpochString(trimmed); ok {
-		return t, nil
+	if t, ok, err := parseEpochString(trimmed, EpochAuto); ok {
+		return t, err
 	}
 	return time.Time{}, fmt.Errorf("temporal: unable to parse timestamptz %q", raw)
 }
 
+// ParseTimeOfDay parses a wall-clock time such as "15:04", "15:04:05.250", or
+// "3:04 PM" into the time elapsed since midnight.
+func ParseTimeOfDay(raw string) (time.Duration, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(raw))
+	if trimmed == "" {
+		return 0, fmt.Errorf("temporal: empty time literal")
+	}
+	if t, err := parseNoZoneLayouts(trimmed, timeOfDayLayouts); err == nil {
+		return TimeOfDay(t), nil
+	}
+	return 0, fmt.Errorf("temporal: unable to parse time %q", raw)
+}
+
+// TimeOfDay returns the wall clock of t, in its own location, as the time
+// elapsed since midnight.
+func TimeOfDay(t time.Time) time.Duration {
+	hour, minute, second := t.Clock()
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute +
+		time.Duration(second)*time.Second + time.Duration(t.Nanosecond())
+}
+
+// CheckTimeOfDay rejects values outside [0, 24h).
+func CheckTimeOfDay(d time.Duration) error {
+	if d < 0 || d >= 24*time.Hour {
+		return fmt.Errorf("temporal: time of day %s outside [0, 24h)", d)
+	}
+	return nil
+}
+
+// ClockTime places a time of day on January 1 of year 0 in UTC, the date
+// time.Parse gives layouts without one.
+func ClockTime(d time.Duration) time.Time {
+	return time.Date(0, time.January, 1, 0, 0, 0, 0, time.UTC).Add(d)
+}
+
+// FormatTimeOfDay renders a time of day as 15:04:05, adding fractional
+// seconds only when present. d must be within [0, 24h).
+func FormatTimeOfDay(d time.Duration) string {
+	return ClockTime(d).Format("15:04:05.999999999")
+}
+
 // EncodeInstant normalizes a timestamp to UTC nanoseconds.
 func EncodeInstant(t time.Time) int64 {
 	if t.IsZero() {
@@ -186,6 +251,8 @@ func FormatInstant(t time.Time) string {
 }
 
 // FormatTimestampTZ renders a timestamp-with-zone preserving its offset.
+// The zero time renders as an empty string, which DecodeTimestampTZ maps back
+// to the zero time.
 func FormatTimestampTZ(t time.Time) string {
 	if t.IsZero() {
 		return ""
@@ -193,6 +260,15 @@ func FormatTimestampTZ(t time.Time) string {
 	return t.Format(time.RFC3339Nano)
 }
 
+// DecodeTimestampTZ converts a stored timestamptz string back into a time.
+// An empty string decodes to the zero time.
+func DecodeTimestampTZ(stored string) (time.Time, error) {
+	if stored == "" {
+		return time.Time{}, nil
+	}
+	return ParseTimestampTZ(stored)
+}
+
 // CanonicalTimestampTZ normalizes arbitrary timestamp strings into RFC3339Nano.
 func CanonicalTimestampTZ(raw string) (string, error) {
 	t, err := ParseTimestampTZ(raw)
@@ -205,18 +281,118 @@ func CanonicalTimestampTZ(raw string) (string, error) {
 	return FormatTimestampTZ(t), nil
 }
 
-// InferEpochNanoseconds guesses the epoch precision for integer literals.
-func InferEpochNanoseconds(v int64) int64 {
-	abs := math.Abs(float64(v))
+// EpochUnit is the precision of an integer epoch.
+type EpochUnit uint8
+
+const (
+	// EpochAuto infers the unit from the magnitude (see InferEpochUnit).
+	EpochAuto EpochUnit = iota
+	EpochSeconds
+	EpochMillis
+	EpochMicros
+	EpochNanos
+)
+
+// ParseEpochUnit maps "s", "ms", "us", and "ns" to their EpochUnit.
+func ParseEpochUnit(raw string) (EpochUnit, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "s":
+		return EpochSeconds, nil
+	case "ms":
+		return EpochMillis, nil
+	case "us", "µs":
+		return EpochMicros, nil
+	case "ns":
+		return EpochNanos, nil
+	default:
+		return EpochAuto, fmt.Errorf("temporal: unknown epoch unit %q", raw)
+	}
+}
+
+// String returns the unit suffix accepted by ParseEpochUnit, or "auto".
+func (u EpochUnit) String() string {
+	switch u {
+	case EpochSeconds:
+		return "s"
+	case EpochMillis:
+		return "ms"
+	case EpochMicros:
+		return "us"
+	case EpochNanos:
+		return "ns"
+	default:
+		return "auto"
+	}
+}
+
+// InferEpochUnit guesses the precision of an integer epoch from its absolute
+// value: below 1e11 it is seconds, below 1e14 milliseconds, below 1e17
+// microseconds, and anything larger nanoseconds. Each bound belongs to the
+// next unit, so 1e11 is read as milliseconds (1973-03-03). Second epochs past
+// 9_223_372_036 (2262-04-11) cannot be stored as nanoseconds at all; declare
+// the unit, e.g. timestamp(s), to keep large values from being misread.
+func InferEpochUnit(v int64) EpochUnit {
+	// Compare as integers: float64 cannot tell 1e17-1 from 1e17.
+	abs := uint64(v)
+	if v < 0 {
+		abs = -abs
+	}
 	switch {
-	case abs < 1e11: // seconds precision
+	case abs < 1e11:
+		return EpochSeconds
+	case abs < 1e14:
+		return EpochMillis
+	case abs < 1e17:
+		return EpochMicros
+	default:
+		return EpochNanos
+	}
+}
+
+// Bounds of the instants EncodeInstant can represent.
+var (
+	minInstant = time.Unix(0, math.MinInt64).UTC()
+	maxInstant = time.Unix(0, math.MaxInt64).UTC()
+)
+
+// EpochTime converts an integer epoch in unit (EpochAuto infers it) to a UTC
+// time. It fails for instants outside the int64 nanosecond range instead of
+// wrapping.
+func EpochTime(v int64, unit EpochUnit) (time.Time, error) {
+	if unit == EpochAuto {
+		unit = InferEpochUnit(v)
+	}
+	var t time.Time
+	switch unit {
+	case EpochSeconds:
+		t = time.Unix(v, 0)
+	case EpochMillis:
+		t = time.UnixMilli(v)
+	case EpochMicros:
+		t = time.UnixMicro(v)
+	default:
+		t = time.Unix(0, v)
+	}
+	if t.Before(minInstant) || t.After(maxInstant) {
+		return time.Time{}, fmt.Errorf("temporal: epoch %d%s is outside the representable range %s to %s",
+			v, unit, minInstant.Format(time.RFC3339), maxInstant.Format(time.RFC3339))
+	}
+	return t.UTC(), nil
+}
+
+// InferEpochNanoseconds guesses the epoch precision for integer literals
+// with InferEpochUnit and returns nanoseconds. Instants outside the int64
+// nanosecond range wrap; use EpochTime to detect them.
+func InferEpochNanoseconds(v int64) int64 {
+	switch InferEpochUnit(v) {
+	case EpochSeconds:
 		return v * int64(time.Second)
-	case abs < 1e14: // milliseconds
+	case EpochMillis:
 		return v * int64(time.Millisecond)
-	case abs < 1e17: // microseconds
+	case EpochMicros:
 		return v * int64(time.Microsecond)
 	default:
-		return v // already in nanoseconds
+		return v
 	}
 }
 
@@ -250,29 +426,32 @@ func parseZoneLayouts(raw string, layouts []string) (time.Time, error) {
 	return time.Time{}, lastErr
 }
 
-func parseEpochString(raw string) (time.Time, bool) {
+// parseEpochString reads raw as an epoch. ok reports whether raw has epoch
+// syntax; err is set when it does but the instant is out of range.
+func parseEpochString(raw string, unit EpochUnit) (t time.Time, ok bool, err error) {
 	trimmed := strings.TrimSpace(raw)
 	if trimmed == "" {
-		return time.Time{}, false
+		return time.Time{}, false, nil
 	}
 	if strings.ContainsAny(trimmed, "eE") {
 		f, err := strconv.ParseFloat(trimmed, 64)
 		if err != nil {
-			return time.Time{}, false
+			return time.Time{}, false, nil
 		}
 		sec, frac := math.Modf(f)
-		return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), true
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), true, nil
 	}
 	if strings.Contains(trimmed, ".") {
 		parts := strings.SplitN(trimmed, ".", 2)
 		secPart := parts[0]
+		negative := strings.HasPrefix(secPart, "-")
 		fracDigits := digitPrefix(strings.TrimSpace(parts[1]))
 		if secPart == "" || secPart == "+" || secPart == "-" {
 			secPart = secPart + "0"
 		}
 		sec, err := strconv.ParseInt(secPart, 10, 64)
 		if err != nil {
-			return time.Time{}, false
+			return time.Time{}, false, nil
 		}
 		if fracDigits == "" {
 			fracDigits = "0"
@@ -285,21 +464,23 @@ func parseEpochString(raw string) (time.Time, bool) {
 		}
 		frac, err := strconv.ParseInt(fracDigits, 10, 64)
 		if err != nil {
-			return time.Time{}, false
+			return time.Time{}, false, nil
 		}
-		if sec < 0 {
+		// Check the sign on the literal itself: "-0.5" parses to sec == 0.
+		if negative {
 			frac = -frac
 		}
-		return time.Unix(sec, frac).UTC(), true
+		return time.Unix(sec, frac).UTC(), true, nil
 	}
 	if !isSignedDigits(trimmed) {
-		return time.Time{}, false
+		return time.Time{}, false, nil
 	}
 	v, err := strconv.ParseInt(trimmed, 10, 64)
 	if err != nil {
-		return time.Time{}, false
+		return time.Time{}, false, nil
 	}
-	return time.Unix(0, InferEpochNanoseconds(v)).UTC(), true
+	t, err = EpochTime(v, unit)
+	return t, true, err
 }
 
 func isSignedDigits(s string) bool {
@@ -331,6 +512,120 @@ func digitPrefix(s string) string {
 	return b.String()
 }
 
+// isoDurationUnits lists ISO 8601 designators in the order they must appear;
+// the second M is minutes. Years and months have no fixed length and are
+// rejected, so they carry no unit.
+var isoDurationUnits = []struct {
+	designator byte
+	timePart   bool
+	unit       time.Duration
+}{
+	{'Y', false, 0},
+	{'M', false, 0},
+	{'W', false, 7 * 24 * time.Hour},
+	{'D', false, 24 * time.Hour},
+	{'H', true, time.Hour},
+	{'M', true, time.Minute},
+	{'S', true, time.Second},
+}
+
+// parseISODuration reads [sign]PnWnDTnHnMnS. Any component may carry a
+// fraction with '.' or ','; digits beyond nanosecond precision are dropped.
+func parseISODuration(raw string) (time.Duration, error) {
+	s := strings.ToUpper(raw)
+	negative := false
+	if s[0] == '+' || s[0] == '-' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("temporal: parse duration %q: missing P designator", raw)
+	}
+	s = s[1:]
+	var (
+		total      time.Duration
+		next       int // index into isoDurationUnits of the earliest allowed designator
+		inTime     bool
+		components int
+		timeParts  int
+	)
+	for len(s) > 0 {
+		if s[0] == 'T' {
+			if inTime {
+				return 0, fmt.Errorf("temporal: parse duration %q: repeated T designator", raw)
+			}
+			inTime = true
+			s = s[1:]
+			continue
+		}
+		end := 0
+		for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || s[end] == ',') {
+			end++
+		}
+		if end == 0 || end == len(s) {
+			return 0, fmt.Errorf("temporal: parse duration %q: expected a number followed by a designator", raw)
+		}
+		number, designator := s[:end], s[end]
+		s = s[end+1:]
+		idx := -1
+		for i := next; i < len(isoDurationUnits); i++ {
+			if isoDurationUnits[i].designator == designator && isoDurationUnits[i].timePart == inTime {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return 0, fmt.Errorf("temporal: parse duration %q: unexpected %c component", raw, designator)
+		}
+		spec := isoDurationUnits[idx]
+		if spec.unit == 0 {
+			return 0, fmt.Errorf("temporal: parse duration %q: years and months have no fixed length", raw)
+		}
+		value, err := isoComponent(number, spec.unit)
+		if err != nil {
+			return 0, fmt.Errorf("temporal: parse duration %q: %w", raw, err)
+		}
+		if total > math.MaxInt64-value {
+			return 0, fmt.Errorf("temporal: parse duration %q: overflows", raw)
+		}
+		total += value
+		next = idx + 1
+		components++
+		if inTime {
+			timeParts++
+		}
+	}
+	if components == 0 || (inTime && timeParts == 0) {
+		return 0, fmt.Errorf("temporal: parse duration %q: no components", raw)
+	}
+	if negative {
+		total = -total
+	}
+	return total, nil
+}
+
+// isoComponent converts a decimal number of unit into a duration exactly.
+func isoComponent(number string, unit time.Duration) (time.Duration, error) {
+	whole, frac, hasFrac := strings.Cut(strings.ReplaceAll(number, ",", "."), ".")
+	if whole == "" || (hasFrac && (frac == "" || strings.Contains(frac, "."))) {
+		return 0, fmt.Errorf("malformed number %q", number)
+	}
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || n > int64(math.MaxInt64/unit) {
+		return 0, fmt.Errorf("%s overflows", number)
+	}
+	total := time.Duration(n) * unit
+	step := unit
+	for i := 0; i < len(frac) && step >= 10; i++ {
+		step /= 10
+		total += time.Duration(frac[i]-'0') * step
+	}
+	if total < 0 {
+		return 0, fmt.Errorf("%s overflows", number)
+	}
+	return total, nil
+}
+
 func normalizeDurationDays(raw string) (string, error) {
 	var firstErr error
 	normalized := dayPattern.ReplaceAllStringFunc(raw, func(match string) string {
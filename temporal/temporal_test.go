@@ -0,0 +1,259 @@
+package temporal_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/scrt/temporal"
+)
+
+func TestParseTimestampTZNegativeFractionalEpoch(t *testing.T) {
+	cases := map[string]time.Time{
+		"-0.5":          time.Unix(0, -500000000),
+		"-1.5":          time.Unix(-1, -500000000),
+		"-14182940":     time.Unix(-14182940, 0),
+		"-14182940.125": time.Unix(-14182940, -125000000),
+		"0.25":          time.Unix(0, 250000000),
+	}
+	for raw, want := range cases {
+		got, err := temporal.ParseTimestampTZ(raw)
+		if err != nil {
+			t.Fatalf("parse %q: %v", raw, err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("parse %q: got %s want %s", raw, got, want)
+		}
+	}
+}
+
+func TestTimestampTZZeroValue(t *testing.T) {
+	if got := temporal.FormatTimestampTZ(time.Time{}); got != "" {
+		t.Fatalf("expected empty format for zero time, got %q", got)
+	}
+	decoded, err := temporal.DecodeTimestampTZ("")
+	if err != nil {
+		t.Fatalf("decode empty: %v", err)
+	}
+	if !decoded.IsZero() {
+		t.Fatalf("expected zero time, got %s", decoded)
+	}
+	epoch := time.Unix(0, 0).UTC()
+	formatted := temporal.FormatTimestampTZ(epoch)
+	if formatted == "" {
+		t.Fatalf("unix epoch must not format as empty")
+	}
+	back, err := temporal.DecodeTimestampTZ(formatted)
+	if err != nil || !back.Equal(epoch) {
+		t.Fatalf("epoch roundtrip: got %s err %v", back, err)
+	}
+}
+
+func TestInferEpochUnitBoundaries(t *testing.T) {
+	cases := []struct {
+		v    int64
+		unit temporal.EpochUnit
+	}{
+		{0, temporal.EpochSeconds},
+		{1_700_000_000, temporal.EpochSeconds},
+		{99_999_999_999, temporal.EpochSeconds},
+		{-99_999_999_999, temporal.EpochSeconds},
+		{100_000_000_000, temporal.EpochMillis},
+		{-100_000_000_000, temporal.EpochMillis},
+		{1_700_000_000_000, temporal.EpochMillis},
+		{99_999_999_999_999, temporal.EpochMillis},
+		{100_000_000_000_000, temporal.EpochMicros},
+		{99_999_999_999_999_999, temporal.EpochMicros},
+		{100_000_000_000_000_000, temporal.EpochNanos},
+		{1_700_000_000_000_000_000, temporal.EpochNanos},
+	}
+	for _, tc := range cases {
+		if got := temporal.InferEpochUnit(tc.v); got != tc.unit {
+			t.Fatalf("InferEpochUnit(%d) = %s, want %s", tc.v, got, tc.unit)
+		}
+	}
+}
+
+func TestParseTimestampEpochUnits(t *testing.T) {
+	sec := time.Unix(1_700_000_000, 0)
+	auto := map[string]time.Time{
+		"1700000000":          sec,
+		"1700000000000":       sec,
+		"1700000000000000":    sec,
+		"1700000000000000000": sec,
+		"99999999999":         {}, // seconds past 2262: rejected, not wrapped
+		"100000000000":        time.UnixMilli(100_000_000_000),
+		"100000000000000":     time.UnixMicro(100_000_000_000_000),
+		"100000000000000000":  time.Unix(0, 100_000_000_000_000_000),
+	}
+	for raw, want := range auto {
+		got, err := temporal.ParseTimestamp(raw)
+		if want.IsZero() {
+			if err == nil {
+				t.Fatalf("parse %q: expected out-of-range error, got %s", raw, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("parse %q: got %s (%v) want %s", raw, got, err, want)
+		}
+	}
+
+	// 9_000_000_000 s (2255) is still seconds under inference but used to overflow.
+	if got, err := temporal.ParseTimestamp("9000000000"); err != nil || !got.Equal(time.Unix(9_000_000_000, 0)) {
+		t.Fatalf("far-future seconds: got %s (%v)", got, err)
+	}
+	if got, err := temporal.ParseTimestampUnit("100000000000", temporal.EpochSeconds); err == nil {
+		t.Fatalf("expected seconds beyond 2262 to fail, got %s", got)
+	}
+	if got, err := temporal.ParseTimestampUnit("1700000000", temporal.EpochMillis); err != nil || !got.Equal(time.UnixMilli(1_700_000_000)) {
+		t.Fatalf("explicit ms: got %s (%v)", got, err)
+	}
+	if got, err := temporal.ParseTimestampUnit("1.5", temporal.EpochMillis); err != nil || !got.Equal(time.Unix(1, 500_000_000)) {
+		t.Fatalf("decimal epochs stay seconds: got %s (%v)", got, err)
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	valid := map[string]time.Duration{
+		"15:04":        15*time.Hour + 4*time.Minute,
+		"09:30:15":     9*time.Hour + 30*time.Minute + 15*time.Second,
+		"9:30":         9*time.Hour + 30*time.Minute,
+		"23:59:59.25":  23*time.Hour + 59*time.Minute + 59*time.Second + 250*time.Millisecond,
+		"3:04 PM":      15*time.Hour + 4*time.Minute,
+		"12:00 am":     0,
+		"12:30pm":      12*time.Hour + 30*time.Minute,
+		" 7:05:09 AM ": 7*time.Hour + 5*time.Minute + 9*time.Second,
+	}
+	for raw, want := range valid {
+		got, err := temporal.ParseTimeOfDay(raw)
+		if err != nil || got != want {
+			t.Fatalf("parse %q: got %s (%v) want %s", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "24:00", "25:00:00", "13:00 PM", "10:60", "noon", "2025-01-02 10:00"} {
+		if got, err := temporal.ParseTimeOfDay(raw); err == nil {
+			t.Fatalf("parse %q: expected error, got %s", raw, got)
+		}
+	}
+	for _, d := range []time.Duration{-time.Nanosecond, 24 * time.Hour, 36 * time.Hour} {
+		if err := temporal.CheckTimeOfDay(d); err == nil {
+			t.Fatalf("expected %s to be rejected", d)
+		}
+	}
+	if err := temporal.CheckTimeOfDay(24*time.Hour - time.Nanosecond); err != nil {
+		t.Fatalf("last nanosecond of the day rejected: %v", err)
+	}
+
+	formatted := map[time.Duration]string{
+		0:                            "00:00:00",
+		15*time.Hour + 4*time.Minute: "15:04:00",
+		9*time.Hour + 30*time.Minute + 500*time.Millisecond: "09:30:00.5",
+	}
+	for d, want := range formatted {
+		if got := temporal.FormatTimeOfDay(d); got != want {
+			t.Fatalf("format %s: got %q want %q", d, got, want)
+		}
+		if back, err := temporal.ParseTimeOfDay(want); err != nil || back != d {
+			t.Fatalf("reparse %q: got %s (%v)", want, back, err)
+		}
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"P0D":            0,
+		"PT0S":           0,
+		"PT1H30M":        90 * time.Minute,
+		"P1DT2H30M":      26*time.Hour + 30*time.Minute,
+		"P2W":            14 * 24 * time.Hour,
+		"PT0.5S":         500 * time.Millisecond,
+		"PT1,25S":        1250 * time.Millisecond,
+		"PT0.000000001S": time.Nanosecond,
+		"PT1.5M":         90 * time.Second,
+		"P1.5D":          36 * time.Hour,
+		"-PT45S":         -45 * time.Second,
+		"pt10m":          10 * time.Minute,
+	}
+	for raw, want := range valid {
+		got, err := temporal.ParseDuration(raw)
+		if err != nil || got != want {
+			t.Fatalf("parse %q: got %s (%v) want %s", raw, got, err, want)
+		}
+	}
+	invalid := map[string]string{
+		"P1Y":        "no fixed length",
+		"P1M":        "no fixed length",
+		"P1Y2DT3H":   "no fixed length",
+		"P":          "no components",
+		"PT":         "no components",
+		"P1DT":       "no components",
+		"P1H":        "unexpected H",
+		"PT1D":       "unexpected D",
+		"PT1S2M":     "unexpected M",
+		"P1D1D":      "unexpected D",
+		"PT1.S":      "malformed",
+		"PT1.2.3S":   "malformed",
+		"PT5":        "expected a number",
+		"P99999999W": "overflows",
+	}
+	for raw, want := range invalid {
+		_, err := temporal.ParseDuration(raw)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("parse %q: got %v, want error containing %q", raw, err, want)
+		}
+	}
+	// The Go-style path is unchanged.
+	if got, err := temporal.ParseDuration("1d2h"); err != nil || got != 26*time.Hour {
+		t.Fatalf("go-style duration: got %s (%v)", got, err)
+	}
+}
+
+func TestRegisterLayouts(t *testing.T) {
+	if _, err := temporal.ParseDate("Mar-04-2025"); err == nil {
+		t.Fatalf("custom date layout accepted before registration")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := temporal.ParseDate("2025-03-04"); err != nil {
+					t.Errorf("parse during registration: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	temporal.RegisterDateLayout("Jan-02-2006")
+	temporal.RegisterDateLayout("Jan-02-2006")
+	temporal.RegisterDateTimeLayout("02.01.2006 15h04")
+	wg.Wait()
+
+	want := time.Date(2025, time.March, 4, 0, 0, 0, 0, time.UTC)
+	if got, err := temporal.ParseDate("Mar-04-2025"); err != nil || !got.Equal(want) {
+		t.Fatalf("registered date layout: got %s (%v)", got, err)
+	}
+	if got, err := temporal.ParseDateTime("04.03.2025 17h30"); err != nil || !got.Equal(want.Add(17*time.Hour+30*time.Minute)) {
+		t.Fatalf("registered datetime layout: got %s (%v)", got, err)
+	}
+	if got, err := temporal.ParseTimestamp("04.03.2025 17h30"); err != nil || !got.Equal(want.Add(17*time.Hour+30*time.Minute)) {
+		t.Fatalf("timestamp fallback: got %s (%v)", got, err)
+	}
+
+	// Built-ins read 03/04/2025 as day/month; a preferred layout wins.
+	if got, _ := temporal.ParseDate("03/04/2025"); got.Month() != time.April {
+		t.Fatalf("built-in order changed: got %s", got)
+	}
+	temporal.SetPreferredDateLayout("01/02/2006")
+	defer temporal.SetPreferredDateLayout("")
+	if got, _ := temporal.ParseDate("03/04/2025"); !got.Equal(want) {
+		t.Fatalf("preferred layout: got %s", got)
+	}
+	temporal.SetPreferredDateLayout("")
+	if got, _ := temporal.ParseDate("03/04/2025"); got.Month() != time.April {
+		t.Fatalf("clearing the preferred layout: got %s", got)
+	}
+}
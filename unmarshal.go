@@ -2,27 +2,30 @@ package scrt
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"math"
 	"reflect"
-	"sync"
 	"time"
 
 	"github.com/oarkflow/scrt/codec"
 	"github.com/oarkflow/scrt/schema"
 	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
 )
 
-var bytesPool = sync.Pool{
-	New: func() interface{} {
-		return make([]byte, 0, 1024)
-	},
-}
-
 // UnmarshalOptions controls decoding behavior.
 type UnmarshalOptions struct {
 	ZeroCopyBytes bool
+	Projection    []string
+	StrictTypes   bool
+	InternStrings bool
+	ExpectedRows  int
+	// WrittenWith is the older schema the payload was written with; see
+	// WithWrittenSchema.
+	WrittenWith *schema.Schema
 }
 
 // UnmarshalOption mutates UnmarshalOptions.
@@ -37,6 +40,62 @@ func WithZeroCopyBytes() UnmarshalOption {
 	}
 }
 
+// WithInternStrings makes equal string values share one allocation across the
+// decoded result instead of borrowing the page they came from, which shrinks
+// results dominated by low-cardinality columns. It costs a map lookup per
+// string value. See codec.Options.InternStrings.
+func WithInternStrings() UnmarshalOption {
+	return func(o *UnmarshalOptions) {
+		o.InternStrings = true
+	}
+}
+
+// WithProjection decodes only the named fields. Columns outside the
+// projection are skipped without decoding and left unset, so they are absent
+// from map targets and untouched in struct targets.
+func WithProjection(fields ...string) UnmarshalOption {
+	return func(o *UnmarshalOptions) {
+		o.Projection = fields
+	}
+}
+
+// WithStrictTypes makes struct decoding fail when a field's Go type cannot
+// hold its schema type exactly, instead of converting the value with Go
+// conversion rules (which may truncate numbers or turn integers into runes).
+// Numbers are checked by type, not by value: a uint64 field only binds to
+// a 64-bit unsigned integer, even when every stored value would fit.
+func WithStrictTypes() UnmarshalOption {
+	return func(o *UnmarshalOptions) {
+		o.StrictTypes = true
+	}
+}
+
+// WithExpectedRows sizes a slice target for n more rows before decoding so
+// it is allocated once. The hint is advisory: extra rows still grow the
+// slice and fewer rows leave it shorter. Without it, the row count in a
+// footer written by WithFooter is used when present.
+func WithExpectedRows(n int) UnmarshalOption {
+	return func(o *UnmarshalOptions) {
+		o.ExpectedRows = n
+	}
+}
+
+// WithWrittenSchema decodes a payload written with written, an earlier
+// version of the schema passed to Unmarshal, as if it had been written with
+// the current one. Fields are matched by name and must keep their type.
+// Fields the current schema added take their literal default in every row,
+// so struct and map targets see it as if it had been stored; a temporal
+// default decodes like any stored value of its type. Added fields without
+// a literal default stay unset: nil in maps and pointer fields, untouched
+// otherwise. Fields the current schema dropped are discarded. The payload
+// must have been written with written; one written with the current schema
+// needs no option.
+func WithWrittenSchema(written *schema.Schema) UnmarshalOption {
+	return func(o *UnmarshalOptions) {
+		o.WrittenWith = written
+	}
+}
+
 // Unmarshal decodes SCRT binary data into the provided output pointer.
 func Unmarshal(data []byte, s *schema.Schema, out any) error {
 	return UnmarshalWithOptions(data, s, out)
@@ -44,25 +103,56 @@ func Unmarshal(data []byte, s *schema.Schema, out any) error {
 
 // UnmarshalWithOptions decodes SCRT data with additional options.
 func UnmarshalWithOptions(data []byte, s *schema.Schema, out any, opts ...UnmarshalOption) error {
+	return UnmarshalContext(context.Background(), data, s, out, opts...)
+}
+
+// UnmarshalContext is UnmarshalWithOptions with cancellation. ctx is checked
+// before each page is decoded; rows decoded before cancellation stay in out.
+func UnmarshalContext(ctx context.Context, data []byte, s *schema.Schema, out any, opts ...UnmarshalOption) error {
 	if s == nil {
-		return fmt.Errorf("scrt: schema is required")
+		return ErrSchemaRequired
 	}
 	cfg := UnmarshalOptions{}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
-	reader := codec.NewReaderWithOptions(bytes.NewReader(data), s, codec.Options{ZeroCopyBytes: cfg.ZeroCopyBytes})
-	return decodeInto(reader, s, out)
+	reader := codec.NewReaderWithOptions(bytes.NewReader(data), s, codec.Options{ZeroCopyBytes: cfg.ZeroCopyBytes, Projection: cfg.Projection, InternStrings: cfg.InternStrings, WrittenWith: cfg.WrittenWith, KeepPages: true})
+	return decodeInto(ctx, reader, s, out, cfg.StrictTypes, expectedRows(data, cfg.ExpectedRows))
 }
 
-// UnmarshalFromFile decodes SCRT binary data stored on disk.
+// maxFooterRowHint caps the preallocation taken from an unverified footer.
+// Larger outputs still decode, growing past it as rows arrive.
+const maxFooterRowHint = 1 << 16
+
+// expectedRows picks the preallocation hint for decoding data: the caller's
+// hint, else the footer's row count. The footer is not verified yet, so its
+// count is capped at one row per input byte and at maxFooterRowHint, which
+// keeps a forged count from reserving more than a bounded slice.
+func expectedRows(data []byte, hint int) int {
+	if hint > 0 {
+		return hint
+	}
+	rows, ok := codec.FooterRowCount(data)
+	if !ok {
+		return 0
+	}
+	return int(min(rows, uint64(len(data)), maxFooterRowHint))
+}
+
+// UnmarshalColumns decodes only the named fields of data into out.
+func UnmarshalColumns(data []byte, s *schema.Schema, out any, fields ...string) error {
+	return UnmarshalWithOptions(data, s, out, WithProjection(fields...))
+}
+
+// UnmarshalFromFile decodes SCRT binary data stored on disk. A gzipped file
+// is decompressed first.
 func UnmarshalFromFile(path string, s *schema.Schema, out any) error {
 	return UnmarshalFromFileWithOptions(path, s, out)
 }
 
 // UnmarshalFromFileWithOptions decodes SCRT binary data stored on disk using options.
 func UnmarshalFromFileWithOptions(path string, s *schema.Schema, out any, opts ...UnmarshalOption) error {
-	data, err := os.ReadFile(path)
+	data, err := schema.ReadFile(path)
 	if err != nil {
 		return err
 	}
@@ -87,7 +177,16 @@ func UnmarshalFilesWithOptions(schemaPath, schemaName, dataPath string, out any,
 	return UnmarshalFromFileWithOptions(dataPath, sch, out, opts...)
 }
 
-func decodeInto(reader *codec.Reader, s *schema.Schema, out any) error {
+// RowToStruct copies an already decoded row into the struct pointed to by out.
+// Fields are bound exactly as Unmarshal binds them. The row may come from any
+// schema with the fingerprint of s, such as the same DSL parsed again.
+func RowToStruct(row codec.Row, s *schema.Schema, out any) error {
+	if s == nil {
+		return ErrSchemaRequired
+	}
+	if rs := row.Schema(); rs == nil || (rs != s && rs.Fingerprint() != s.Fingerprint()) {
+		return codec.ErrSchemaFingerprintMismatch
+	}
 	if out == nil {
 		return fmt.Errorf("scrt: output cannot be nil")
 	}
@@ -95,23 +194,59 @@ func decodeInto(reader *codec.Reader, s *schema.Schema, out any) error {
 	if rv.Kind() != reflect.Pointer || rv.IsNil() {
 		return fmt.Errorf("scrt: output must be a non-nil pointer")
 	}
+	target := indirect(rv)
+	if target.Kind() != reflect.Struct {
+		return fmt.Errorf("scrt: RowToStruct expects a struct pointer, got %s", rv.Type())
+	}
+	return assignRowToStruct(row, target, s, false)
+}
+
+func decodeInto(ctx context.Context, reader *codec.Reader, s *schema.Schema, out any, strict bool, expected int) error {
+	if out == nil {
+		return fmt.Errorf("scrt: output cannot be nil")
+	}
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("scrt: output must be a non-nil pointer")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	target := rv.Elem()
 	row := codec.AcquireRow(s)
 	defer codec.ReleaseRow(row)
 	switch target.Kind() {
 	case reflect.Slice:
-		return decodeIntoSlice(reader, s, target, *row)
+		return decodeIntoSlice(ctx, reader, s, target, *row, strict, expected)
 	case reflect.Struct, reflect.Map:
-		return decodeSingleValue(reader, s, target, *row)
+		return decodeSingleValue(reader, s, target, *row, strict)
 	default:
 		return fmt.Errorf("scrt: unsupported output kind %s", target.Kind())
 	}
 }
 
-func decodeIntoSlice(reader *codec.Reader, s *schema.Schema, slice reflect.Value, row codec.Row) error {
+func decodeIntoSlice(ctx context.Context, reader *codec.Reader, s *schema.Schema, slice reflect.Value, row codec.Row, strict bool, expected int) error {
 	elemType := slice.Type().Elem()
 	idx := slice.Len()
+	if expected > 0 && slice.Cap() < idx+expected {
+		slice = growSlice(slice, idx+expected)
+	}
+	var anyMaps *mapAnyDecoder
+	if elemType == mapAnyType {
+		anyMaps = newMapAnyDecoder(s)
+	}
+	// Elements past the length of a reused slice still hold what an earlier
+	// decode left there; they are zeroed before use so that absent fields
+	// stay zero (or nil) instead of inheriting stale values. growSlice
+	// copies only the length, so a reallocation leaves nothing stale.
+	stale := slice.Cap()
 	for {
+		if reader.RowsRemainingHint() == 0 {
+			// The next ReadRow loads a page.
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
 		row.Reset()
 		ok, err := reader.ReadRow(row)
 		if err != nil {
@@ -130,40 +265,57 @@ func decodeIntoSlice(reader *codec.Reader, s *schema.Schema, slice reflect.Value
 		}
 		if slice.Cap() < needed {
 			slice = growSlice(slice, needed)
+			stale = 0
 		}
 		if slice.Cap() <= idx {
 			slice = growSlice(slice, idx+1)
+			stale = 0
 		}
 		if slice.Len() < idx+1 {
 			slice.SetLen(idx + 1)
 		}
 		dest := slice.Index(idx)
-		if elemType.Kind() == reflect.Pointer {
+		if anyMaps != nil {
+			// A stale element's map may still be held by the caller, so it
+			// is replaced rather than cleared.
+			m := make(map[string]any, len(s.Fields))
+			dest.Set(reflect.ValueOf(m))
+			if err := anyMaps.assign(row, m); err != nil {
+				return err
+			}
+		} else if elemType.Kind() == reflect.Pointer {
 			val := reflect.New(elemType.Elem())
 			dest.Set(val)
-			if err := assignRowToValue(row, val.Elem(), s); err != nil {
+			if err := assignRowToValue(row, val.Elem(), s, strict); err != nil {
 				return err
 			}
 		} else {
-			if err := assignRowToValue(row, dest, s); err != nil {
+			if idx < stale {
+				dest.SetZero()
+			}
+			if err := assignRowToValue(row, dest, s, strict); err != nil {
 				return err
 			}
 		}
 		idx++
 	}
+	if idx == 0 && slice.IsNil() {
+		// An empty stream decodes to an empty slice rather than nil.
+		slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+	}
 	return nil
 }
 
-func decodeSingleValue(reader *codec.Reader, s *schema.Schema, dst reflect.Value, row codec.Row) error {
+func decodeSingleValue(reader *codec.Reader, s *schema.Schema, dst reflect.Value, row codec.Row, strict bool) error {
 	row.Reset()
 	ok, err := reader.ReadRow(row)
 	if err != nil {
 		return err
 	}
 	if !ok {
-		return io.EOF
+		return fmt.Errorf("scrt: payload holds no rows: %w", io.EOF)
 	}
-	if err := assignRowToValue(row, dst, s); err != nil {
+	if err := assignRowToValue(row, dst, s, strict); err != nil {
 		return err
 	}
 	row.Reset()
@@ -191,14 +343,14 @@ func growSlice(slice reflect.Value, needed int) reflect.Value {
 	return slice
 }
 
-func assignRowToValue(row codec.Row, dst reflect.Value, s *schema.Schema) error {
+func assignRowToValue(row codec.Row, dst reflect.Value, s *schema.Schema, strict bool) error {
 	dst = indirect(dst)
 	switch dst.Kind() {
 	case reflect.Struct:
-		return assignRowToStruct(row, dst, s)
+		return assignRowToStruct(row, dst, s, strict)
 	case reflect.Map:
 		if dst.IsNil() {
-			dst.Set(reflect.MakeMap(dst.Type()))
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(s.Fields)))
 		}
 		return assignRowToMap(row, dst, s)
 	default:
@@ -206,24 +358,65 @@ func assignRowToValue(row codec.Row, dst reflect.Value, s *schema.Schema) error
 	}
 }
 
-func assignRowToStruct(row codec.Row, dst reflect.Value, s *schema.Schema) error {
-	bindings := structBindingsForSchema(dst.Type(), s)
+func assignRowToStruct(row codec.Row, dst reflect.Value, s *schema.Schema, strict bool) error {
+	bindings, err := structBindingsForSchema(dst.Type(), s)
+	if err != nil {
+		return err
+	}
 	vals := row.Values()
 	for idx, binding := range bindings {
 		if len(binding.index) == 0 {
 			continue
 		}
-		fv := dst.FieldByIndex(binding.index)
-		if !fv.IsValid() || !fv.CanSet() {
+		if !vals[idx].Set {
 			continue
 		}
-		if !vals[idx].Set {
+		fv, ok := fieldByIndexAlloc(dst, binding.index)
+		if !ok || !fv.IsValid() || !fv.CanSet() {
+			continue
+		}
+		if s.Fields[idx].Codec != "" {
+			decoded, err := decodeWithCodec(s.Fields[idx], vals[idx])
+			if err == nil {
+				err = assignInterface(fv, decoded)
+			}
+			if err != nil {
+				return fmt.Errorf("scrt: field %s: %w", s.Fields[idx].Name, err)
+			}
 			continue
 		}
-		if err := assignRowValue(fv, s.Fields[idx].ValueKind(), vals[idx]); err != nil {
+		if err := assignRowValue(fv, s.Fields[idx].ValueKind(), vals[idx], strict); err != nil {
+			if errors.Is(err, errInexactType) {
+				return fmt.Errorf("scrt: field %s: schema type %s cannot be stored in %s", s.Fields[idx].Name, s.Fields[idx].RawType, fv.Type())
+			}
 			return fmt.Errorf("scrt: field %s: %w", s.Fields[idx].Name, err)
 		}
 	}
+	if len(s.Computed) > 0 {
+		return assignComputedToStruct(row, dst, s)
+	}
+	return nil
+}
+
+// assignComputedToStruct fills the struct fields bound to computed fields.
+// Fields whose expression has no value for the row are left alone.
+func assignComputedToStruct(row codec.Row, dst reflect.Value, s *schema.Schema) error {
+	for idx, binding := range computedBindingsForSchema(dst.Type(), s) {
+		if len(binding.index) == 0 {
+			continue
+		}
+		val, ok := EvalComputed(s, s.Computed[idx], row)
+		if !ok {
+			continue
+		}
+		fv, ok := fieldByIndexAlloc(dst, binding.index)
+		if !ok || !fv.IsValid() || !fv.CanSet() {
+			continue
+		}
+		if err := assignComputed(fv, val); err != nil {
+			return fmt.Errorf("scrt: computed field %s: %w", s.Computed[idx].Name, err)
+		}
+	}
 	return nil
 }
 
@@ -237,55 +430,145 @@ func assignRowToMap(row codec.Row, dst reflect.Value, s *schema.Schema) error {
 	if dst.Type().Elem().Kind() == reflect.Map && dst.Type().Elem().Key().Kind() == reflect.String {
 		return assignRowToNestedMap(row, dst, s)
 	}
+	var err error
 	switch m := dst.Interface().(type) {
 	case map[string]any:
 		return assignRowToMapAny(row, m, s)
 	case map[string]bool:
-		return assignRowToMapBool(row, m, s)
+		err = assignRowToMapBool(row, m, s)
 	case map[string]int:
-		return assignRowToMapInt(row, m, s)
+		err = assignRowToMapInt(row, m, s)
 	case map[string]int8:
-		return assignRowToMapInt8(row, m, s)
+		err = assignRowToMapInt8(row, m, s)
 	case map[string]int16:
-		return assignRowToMapInt16(row, m, s)
+		err = assignRowToMapInt16(row, m, s)
 	case map[string]int32:
-		return assignRowToMapInt32(row, m, s)
+		err = assignRowToMapInt32(row, m, s)
 	case map[string]int64:
-		return assignRowToMapInt64(row, m, s)
+		err = assignRowToMapInt64(row, m, s)
 	case map[string]uint:
-		return assignRowToMapUint(row, m, s)
+		err = assignRowToMapUint(row, m, s)
 	case map[string]uint8:
-		return assignRowToMapUint8(row, m, s)
+		err = assignRowToMapUint8(row, m, s)
 	case map[string]uint16:
-		return assignRowToMapUint16(row, m, s)
+		err = assignRowToMapUint16(row, m, s)
 	case map[string]uint32:
-		return assignRowToMapUint32(row, m, s)
+		err = assignRowToMapUint32(row, m, s)
 	case map[string]uint64:
-		return assignRowToMapUint64(row, m, s)
+		err = assignRowToMapUint64(row, m, s)
 	case map[string]float64:
-		return assignRowToMapFloat64(row, m, s)
+		err = assignRowToMapFloat64(row, m, s)
 	case map[string]float32:
-		return assignRowToMapFloat32(row, m, s)
+		err = assignRowToMapFloat32(row, m, s)
 	case map[string]string:
-		return assignRowToMapString(row, m, s)
+		err = assignRowToMapString(row, m, s)
 	case map[string][]byte:
-		return assignRowToMapBytes(row, m, s)
+		err = assignRowToMapBytes(row, m, s)
 	default:
-		return assignRowToMapReflect(row, dst, s)
+		err = assignRowToMapReflect(row, dst, s)
+	}
+	if err != nil {
+		return err
 	}
+	return assignComputedToMap(row, dst, s)
 }
 
 func assignRowToMapAny(row codec.Row, dst map[string]any, s *schema.Schema) error {
+	d := mapAnyDecoder{schema: s}
+	return d.assign(row, dst)
+}
+
+// assignComputedToMap stores the computed fields of s in dst, a map with
+// string keys, converting each result as assignComputed does for struct
+// fields. Fields a row leaves unset are skipped; a result the element type
+// cannot hold is an error, as it is for stored fields.
+func assignComputedToMap(row codec.Row, dst reflect.Value, s *schema.Schema) error {
+	if len(s.Computed) == 0 {
+		return nil
+	}
+	elemType := dst.Type().Elem()
+	for _, c := range s.Computed {
+		val, ok := EvalComputed(s, c, row)
+		if !ok {
+			continue
+		}
+		out := reflect.New(elemType).Elem()
+		if err := assignComputed(out, val); err != nil {
+			return fmt.Errorf("scrt: computed field %s: %w", c.Name, err)
+		}
+		dst.SetMapIndex(reflect.ValueOf(c.Name).Convert(dst.Type().Key()), out)
+	}
+	return nil
+}
+
+var mapAnyType = reflect.TypeOf(map[string]any(nil))
+
+// mapAnyDecoder fills map[string]any rows. The common kinds are assigned
+// directly rather than through valueFromRow, and when last is set the boxed
+// value of each field is kept so a column repeating its previous value
+// (dictionary strings, flags, foreign keys) shares one interface instead of
+// allocating a new one per row. Boxed values are immutable, so sharing them
+// across maps is safe.
+type mapAnyDecoder struct {
+	schema *schema.Schema
+	last   []any
+}
+
+func newMapAnyDecoder(s *schema.Schema) *mapAnyDecoder {
+	return &mapAnyDecoder{schema: s, last: make([]any, len(s.Fields))}
+}
+
+func (d *mapAnyDecoder) assign(row codec.Row, dst map[string]any) error {
 	vals := row.Values()
-	for idx, field := range s.Fields {
-		if !vals[idx].Set {
+	for idx, field := range d.schema.Fields {
+		v := &vals[idx]
+		if !v.Set {
 			continue
 		}
-		dst[field.Name] = valueFromRow(field.ValueKind(), vals[idx])
+		if field.Codec != "" {
+			val, err := decodeWithCodec(field, *v)
+			if err != nil {
+				return fmt.Errorf("scrt: field %s: %w", field.Name, err)
+			}
+			dst[field.Name] = val
+			continue
+		}
+		switch field.ValueKind() {
+		case schema.KindBool:
+			dst[field.Name] = v.Bool
+		case schema.KindInt64:
+			dst[field.Name] = boxReused(d, idx, v.Int)
+		case schema.KindUint64, schema.KindRef:
+			dst[field.Name] = boxReused(d, idx, v.Uint)
+		case schema.KindFloat64:
+			dst[field.Name] = boxReused(d, idx, v.Float)
+		case schema.KindString:
+			dst[field.Name] = boxReused(d, idx, v.Str)
+		default:
+			dst[field.Name] = valueFromRow(field.ValueKind(), *v)
+		}
+	}
+	for _, c := range d.schema.Computed {
+		if val, ok := EvalComputed(d.schema, c, row); ok {
+			dst[c.Name] = val
+		}
 	}
 	return nil
 }
 
+// boxReused returns v as an interface, reusing the one boxed for field idx
+// of the previous row when it holds the same value.
+func boxReused[T comparable](d *mapAnyDecoder, idx int, v T) any {
+	if d.last == nil {
+		return v
+	}
+	if prev, ok := d.last[idx].(T); ok && prev == v {
+		return d.last[idx]
+	}
+	d.last[idx] = v
+	return d.last[idx]
+}
+
 func assignRowToMapBool(row codec.Row, dst map[string]bool, s *schema.Schema) error {
 	vals := row.Values()
 	for idx, field := range s.Fields {
@@ -311,7 +594,10 @@ func assignRowToNestedMap(row codec.Row, dst reflect.Value, s *schema.Schema) er
 		if !vals[idx].Set {
 			continue
 		}
-		base := valueFromRow(field.ValueKind(), vals[idx])
+		base, err := fieldValueFromRow(field, vals[idx])
+		if err != nil {
+			return fmt.Errorf("scrt: field %s: %w", field.Name, err)
+		}
 		if base == nil {
 			continue
 		}
@@ -319,7 +605,27 @@ func assignRowToNestedMap(row codec.Row, dst reflect.Value, s *schema.Schema) er
 		if err != nil {
 			return fmt.Errorf("scrt: field %s: %w", field.Name, err)
 		}
-		fieldKey := reflect.ValueOf(field.Name)
+		fieldKey := reflect.ValueOf(field.Name).Convert(dst.Type().Key())
+		existing := dst.MapIndex(fieldKey)
+		var inner reflect.Value
+		if existing.IsValid() && existing.Type() == innerType {
+			inner = cloneStringMap(existing)
+		} else {
+			inner = reflect.MakeMapWithSize(innerType, 1)
+		}
+		inner.SetMapIndex(valueKey, converted)
+		dst.SetMapIndex(fieldKey, inner)
+	}
+	for _, c := range s.Computed {
+		val, ok := EvalComputed(s, c, row)
+		if !ok {
+			continue
+		}
+		converted := reflect.New(innerType.Elem()).Elem()
+		if err := assignComputed(converted, val); err != nil {
+			return fmt.Errorf("scrt: computed field %s: %w", c.Name, err)
+		}
+		fieldKey := reflect.ValueOf(c.Name).Convert(dst.Type().Key())
 		existing := dst.MapIndex(fieldKey)
 		var inner reflect.Value
 		if existing.IsValid() && existing.Type() == innerType {
@@ -452,6 +758,10 @@ func assignRowToMapString(row codec.Row, dst map[string]string, s *schema.Schema
 			formatted = vals[idx].Str
 		case schema.KindDuration:
 			formatted = time.Duration(vals[idx].Int).String()
+		case schema.KindTime:
+			formatted = temporal.FormatTimeOfDay(time.Duration(vals[idx].Int))
+		case schema.KindUUID:
+			formatted = uuid.FormatBytes(vals[idx].Bytes)
 		default:
 			return fmt.Errorf("scrt: field %s kind %d cannot assign to map[string]string", field.Name, kind)
 		}
@@ -478,7 +788,13 @@ func assignRowToMapReflect(row codec.Row, dst reflect.Value, s *schema.Schema) e
 	elemType := dst.Type().Elem()
 	vals := row.Values()
 	for idx, field := range s.Fields {
-		base := valueFromRow(field.ValueKind(), vals[idx])
+		if !vals[idx].Set {
+			continue
+		}
+		base, err := fieldValueFromRow(field, vals[idx])
+		if err != nil {
+			return fmt.Errorf("scrt: field %s: %w", field.Name, err)
+		}
 		if base == nil {
 			continue
 		}
@@ -486,12 +802,30 @@ func assignRowToMapReflect(row codec.Row, dst reflect.Value, s *schema.Schema) e
 		if err != nil {
 			return fmt.Errorf("scrt: field %s: %w", field.Name, err)
 		}
-		dst.SetMapIndex(reflect.ValueOf(field.Name), val)
+		dst.SetMapIndex(reflect.ValueOf(field.Name).Convert(dst.Type().Key()), val)
 	}
 	return nil
 }
 
-func assignRowValue(field reflect.Value, kind schema.FieldKind, val codec.Value) error {
+func assignRowValue(field reflect.Value, kind schema.FieldKind, val codec.Value, strict bool) error {
+	if field.Kind() == reflect.Pointer && field.IsNil() && field.CanSet() {
+		// The assign helpers below allocate through derefSettable as they
+		// probe each representation, so decode into a detached value and
+		// only publish the pointer once one of them took it.
+		elem := reflect.New(field.Type().Elem())
+		if err := assignRowValue(elem.Elem(), kind, val, strict); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	assignInterface := assignInterface
+	if strict {
+		assignInterface = assignInterfaceExact
+		if want, numeric := strictNumericKinds[kind]; numeric && !numericTypeHolds(field.Type(), want) {
+			return errInexactType
+		}
+	}
 	switch kind {
 	case schema.KindUint64, schema.KindRef:
 		if assignUintField(field, val.Uint) {
@@ -543,11 +877,7 @@ func assignRowValue(field reflect.Value, kind schema.FieldKind, val codec.Value)
 		}
 		return assignInterface(field, decoded)
 	case schema.KindTimestampTZ:
-		var parsed time.Time
-		var parseErr error
-		if val.Str != "" {
-			parsed, parseErr = temporal.ParseTimestampTZ(val.Str)
-		}
+		parsed, parseErr := temporal.DecodeTimestampTZ(val.Str)
 		if parseErr == nil && assignTimeField(field, parsed) {
 			return nil
 		}
@@ -567,11 +897,103 @@ func assignRowValue(field reflect.Value, kind schema.FieldKind, val codec.Value)
 			return nil
 		}
 		return assignInterface(field, dur)
+	case schema.KindTime:
+		tod := time.Duration(val.Int)
+		if assignDurationField(field, tod) {
+			return nil
+		}
+		if assignTimeField(field, temporal.ClockTime(tod)) {
+			return nil
+		}
+		formatted := temporal.FormatTimeOfDay(tod)
+		if assignStringField(field, formatted) {
+			return nil
+		}
+		return assignInterface(field, formatted)
+	case schema.KindUUID:
+		if assignUUIDField(field, val.Bytes) {
+			return nil
+		}
+		if assignBytesField(field, append([]byte(nil), val.Bytes...)) {
+			return nil
+		}
+		formatted := uuid.FormatBytes(val.Bytes)
+		if assignStringField(field, formatted) {
+			return nil
+		}
+		return assignInterface(field, formatted)
+	case schema.KindList:
+		if val.Uints != nil {
+			if assignListField(field, reflect.ValueOf(val.Uints)) {
+				return nil
+			}
+			return assignInterface(field, val.Uints)
+		}
+		if assignListField(field, reflect.ValueOf(val.Strs)) {
+			return nil
+		}
+		return assignInterface(field, val.Strs)
 	default:
 		return fmt.Errorf("unsupported schema kind %d", kind)
 	}
 }
 
+// strictNumericKinds maps the numeric schema kinds to the Go kind whose
+// values they hold, for the type checks of strict decoding.
+var strictNumericKinds = map[schema.FieldKind]reflect.Kind{
+	schema.KindUint64:   reflect.Uint64,
+	schema.KindRef:      reflect.Uint64,
+	schema.KindInt64:    reflect.Int64,
+	schema.KindDuration: reflect.Int64,
+	schema.KindFloat64:  reflect.Float64,
+}
+
+// numericTypeHolds reports whether typ, after dereferencing pointers, can
+// store every value of the Go kind want. It judges by type rather than by
+// value, so a uint32 never holds a uint64 even when the value would fit.
+// Non-numeric types report true and are left to the assign helpers.
+func numericTypeHolds(typ reflect.Type, want reflect.Kind) bool {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	class := func(k reflect.Kind) int {
+		switch k {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return 1
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return 2
+		case reflect.Float32, reflect.Float64:
+			return 3
+		}
+		return 0
+	}
+	have := class(typ.Kind())
+	return have == 0 || (have == class(want) && typ.Size() >= 8)
+}
+
+// assignListField stores a decoded list into a slice whose element kind
+// matches, converting named slice and element types.
+func assignListField(field reflect.Value, list reflect.Value) bool {
+	if field.Kind() == reflect.Interface {
+		return false
+	}
+	f, ok := derefSettable(field)
+	if !ok || f.Kind() != reflect.Slice || f.Type().Elem().Kind() != list.Type().Elem().Kind() {
+		return false
+	}
+	if f.Type() == list.Type() {
+		f.Set(list)
+		return true
+	}
+	out := reflect.MakeSlice(f.Type(), list.Len(), list.Len())
+	elem := f.Type().Elem()
+	for i := 0; i < list.Len(); i++ {
+		out.Index(i).Set(list.Index(i).Convert(elem))
+	}
+	f.Set(out)
+	return true
+}
+
 func assignUintField(field reflect.Value, value uint64) bool {
 	if field.Kind() == reflect.Interface {
 		return false
@@ -585,7 +1007,7 @@ func assignUintField(field reflect.Value, value uint64) bool {
 		f.SetUint(value)
 		return true
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		if f.OverflowUint(value) {
+		if value > math.MaxInt64 || f.OverflowInt(int64(value)) {
 			return false
 		}
 		f.SetInt(int64(value))
@@ -717,6 +1139,21 @@ func assignDurationField(field reflect.Value, value time.Duration) bool {
 	return false
 }
 
+func assignUUIDField(field reflect.Value, data []byte) bool {
+	if field.Kind() == reflect.Interface {
+		return false
+	}
+	f, ok := derefSettable(field)
+	if !ok {
+		return false
+	}
+	if f.Kind() == reflect.Array && f.Type().Elem().Kind() == reflect.Uint8 && f.Len() == len(data) {
+		reflect.Copy(f, reflect.ValueOf(data))
+		return true
+	}
+	return false
+}
+
 func derefSettable(v reflect.Value) (reflect.Value, bool) {
 	for v.Kind() == reflect.Pointer {
 		if v.IsNil() {
@@ -749,15 +1186,21 @@ func valueFromRow(kind schema.FieldKind, v codec.Value) interface{} {
 	case schema.KindDateTime, schema.KindTimestamp:
 		return temporal.DecodeInstant(v.Int)
 	case schema.KindTimestampTZ:
-		if v.Str == "" {
-			return time.Time{}
-		}
-		if parsed, err := temporal.ParseTimestampTZ(v.Str); err == nil {
+		if parsed, err := temporal.DecodeTimestampTZ(v.Str); err == nil {
 			return parsed
 		}
 		return v.Str
 	case schema.KindDuration:
 		return time.Duration(v.Int)
+	case schema.KindTime:
+		return temporal.FormatTimeOfDay(time.Duration(v.Int))
+	case schema.KindUUID:
+		return uuid.FormatBytes(v.Bytes)
+	case schema.KindList:
+		if v.Uints != nil {
+			return v.Uints
+		}
+		return v.Strs
 	default:
 		return nil
 	}
@@ -765,7 +1208,7 @@ func valueFromRow(kind schema.FieldKind, v codec.Value) interface{} {
 
 func intStoredKind(kind schema.FieldKind) bool {
 	switch kind {
-	case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration:
+	case schema.KindInt64, schema.KindDate, schema.KindDateTime, schema.KindTimestamp, schema.KindDuration, schema.KindTime:
 		return true
 	default:
 		return false
@@ -773,28 +1216,10 @@ func intStoredKind(kind schema.FieldKind) bool {
 }
 
 func bytesForAssignment(v codec.Value) []byte {
-	if v.Bytes == nil {
-		return nil
-	}
-	if v.Borrowed {
-		return v.Bytes
-	}
-
-	// For small byte slices, avoid allocation by returning the original
-	// This is safe when we know the data won't be modified
-	if len(v.Bytes) <= 64 {
-		return v.Bytes
-	}
-
-	// Use a pooled buffer for larger byte slices
-	buf := bytesPool.Get().([]byte)
-	if cap(buf) < len(v.Bytes) {
-		buf = make([]byte, len(v.Bytes))
-	} else {
-		buf = buf[:len(v.Bytes)]
-	}
-	copy(buf, v.Bytes)
-	return buf
+	// Borrowed bytes keep the lifetime WithZeroCopyBytes documents. Owned
+	// bytes are already a private copy the reader made for this row, so
+	// copying them again would only allocate.
+	return v.Bytes
 }
 
 func assignInterface(field reflect.Value, value interface{}) error {
@@ -825,6 +1250,35 @@ func assignInterface(field reflect.Value, value interface{}) error {
 	return fmt.Errorf("cannot assign %T to %s", value, field.Type())
 }
 
+// errInexactType reports that a value would only fit its destination through
+// a Go conversion; assignRowToStruct turns it into a field-level error.
+var errInexactType = errors.New("scrt: inexact type")
+
+// assignInterfaceExact is assignInterface without Go value conversions.
+func assignInterfaceExact(field reflect.Value, value interface{}) error {
+	if !field.CanSet() {
+		return fmt.Errorf("cannot set field %s", field.Type())
+	}
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	val := reflect.ValueOf(value)
+	if val.Type().AssignableTo(field.Type()) {
+		field.Set(val)
+		return nil
+	}
+	if field.Kind() == reflect.Pointer {
+		elem := reflect.New(field.Type().Elem())
+		if err := assignInterfaceExact(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	return errInexactType
+}
+
 func convertInterface(value interface{}, typ reflect.Type) (reflect.Value, error) {
 	if typ.Kind() == reflect.Interface && typ.NumMethod() == 0 {
 		return reflect.ValueOf(value), nil
@@ -0,0 +1,47 @@
+package scrt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// Upgrade rewrites a payload from an older stream format version into the
+// current one, with the page size Marshal uses by default. A payload that is
+// already current is returned unchanged, so stored flags such as page
+// checksums or a footer survive. Upgrade fails with an error wrapping
+// codec.ErrUnsupportedVersion for versions newer than this release knows.
+func Upgrade(old []byte, s *schema.Schema) ([]byte, error) {
+	if s == nil {
+		return nil, ErrSchemaRequired
+	}
+	v, err := codec.PayloadVersion(old)
+	if err != nil {
+		return nil, fmt.Errorf("scrt: upgrade: %w", err)
+	}
+	if v == codec.FormatVersion {
+		return old, nil
+	}
+	reader := codec.NewReader(bytes.NewReader(old), s)
+	var buf bytes.Buffer
+	writer := codec.NewWriter(&buf, s, 0)
+	row := codec.NewRow(s)
+	for {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("scrt: upgrade from version %d: %w", v, err)
+		}
+		if !ok {
+			break
+		}
+		if err := writer.WriteRow(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
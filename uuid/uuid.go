@@ -0,0 +1,92 @@
+package uuid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Size is the number of bytes in the binary form of a UUID.
+const Size = 16
+
+// UUID is the 16-byte binary representation stored by uuid fields.
+type UUID [Size]byte
+
+// Parse decodes the canonical hyphenated form (8-4-4-4-12) or the bare
+// 32-digit hex form into its binary representation.
+func Parse(raw string) (UUID, error) {
+	var out UUID
+	switch len(raw) {
+	case 36:
+		if raw[8] != '-' || raw[13] != '-' || raw[18] != '-' || raw[23] != '-' {
+			return out, fmt.Errorf("uuid: malformed %q", raw)
+		}
+		compact := raw[0:8] + raw[9:13] + raw[14:18] + raw[19:23] + raw[24:36]
+		if _, err := hex.Decode(out[:], []byte(compact)); err != nil {
+			return UUID{}, fmt.Errorf("uuid: malformed %q", raw)
+		}
+	case 32:
+		if _, err := hex.Decode(out[:], []byte(raw)); err != nil {
+			return UUID{}, fmt.Errorf("uuid: malformed %q", raw)
+		}
+	default:
+		return out, fmt.Errorf("uuid: malformed %q", raw)
+	}
+	return out, nil
+}
+
+// FromBytes copies a 16-byte slice into a UUID.
+func FromBytes(b []byte) (UUID, error) {
+	var out UUID
+	if len(b) != Size {
+		return out, fmt.Errorf("uuid: expected %d bytes, got %d", Size, len(b))
+	}
+	copy(out[:], b)
+	return out, nil
+}
+
+// String renders the canonical lowercase hyphenated form.
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// FormatBytes renders a 16-byte slice in canonical form. Slices of any other
+// length render as an empty string.
+func FormatBytes(b []byte) string {
+	u, err := FromBytes(b)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// NewV7 emits a RFC 9562 compliant UUID version 7.
+func NewV7() (UUID, error) {
+	var u UUID
+	ts := time.Now().UnixMilli()
+	u[0] = byte(ts >> 40)
+	u[1] = byte(ts >> 32)
+	u[2] = byte(ts >> 24)
+	u[3] = byte(ts >> 16)
+	u[4] = byte(ts >> 8)
+	u[5] = byte(ts)
+	if _, err := rand.Read(u[6:]); err != nil {
+		return UUID{}, err
+	}
+	u[6] &= 0x0F
+	u[6] |= 0x70 // version 7
+	u[8] &= 0x3F
+	u[8] |= 0x80 // variant RFC4122
+	return u, nil
+}
@@ -0,0 +1,123 @@
+package scrt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/scrt"
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/storage"
+	"github.com/oarkflow/scrt/uuid"
+)
+
+func parseSingleSchema(t *testing.T, src, name string) *schema.Schema {
+	t.Helper()
+	doc, err := schema.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	sch, ok := doc.Schema(name)
+	if !ok {
+		t.Fatalf("%s schema missing", name)
+	}
+	return sch
+}
+
+func TestUUIDFieldRoundTrip(t *testing.T) {
+	sch := parseSingleSchema(t, `@schema Device
+@field ID uuid
+@field Owner uuid
+@field Name string
+`, "Device")
+
+	generated, err := storage.GenerateUUIDv7()
+	if err != nil {
+		t.Fatalf("GenerateUUIDv7: %v", err)
+	}
+	owner, err := uuid.Parse("6F9619FF-8B86-D011-B42D-00C04FC964FF")
+	if err != nil {
+		t.Fatalf("parse owner: %v", err)
+	}
+
+	type device struct {
+		ID    string
+		Owner uuid.UUID
+		Name  string
+	}
+	input := []device{{ID: generated, Owner: owner, Name: "sensor"}}
+	payload, err := scrt.Marshal(sch, input)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var structs []device
+	if err := scrt.Unmarshal(payload, sch, &structs); err != nil {
+		t.Fatalf("Unmarshal structs: %v", err)
+	}
+	if len(structs) != 1 || structs[0].ID != generated || structs[0].Owner != owner {
+		t.Fatalf("unexpected struct roundtrip: %+v", structs)
+	}
+
+	var maps []map[string]any
+	if err := scrt.Unmarshal(payload, sch, &maps); err != nil {
+		t.Fatalf("Unmarshal maps: %v", err)
+	}
+	if got := maps[0]["Owner"]; got != "6f9619ff-8b86-d011-b42d-00c04fc964ff" {
+		t.Fatalf("expected canonical owner, got %v", got)
+	}
+	if got := maps[0]["ID"]; got != generated {
+		t.Fatalf("expected generated id %s, got %v", generated, got)
+	}
+}
+
+func TestUUIDFieldRejectsMalformed(t *testing.T) {
+	sch := parseSingleSchema(t, `@schema Device
+@field ID uuid
+`, "Device")
+
+	for _, raw := range []string{"not-a-uuid", "6f9619ff8b86d011b42d00c04fc964f", "6f9619ff-8b86-d011-b42d-00c04fc964fg"} {
+		if _, err := scrt.Marshal(sch, []map[string]any{{"ID": raw}}); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+	if _, err := scrt.Marshal(sch, []map[string]any{{"ID": []byte{1, 2, 3}}}); err == nil {
+		t.Fatalf("expected error for short byte slice")
+	}
+}
+
+func TestUUIDFingerprintDiffersFromString(t *testing.T) {
+	asUUID := parseSingleSchema(t, "@schema Device\n@field ID uuid\n", "Device")
+	asString := parseSingleSchema(t, "@schema Device\n@field ID string\n", "Device")
+	if asUUID.Fingerprint() == asString.Fingerprint() {
+		t.Fatalf("uuid and string fields share fingerprint %d", asUUID.Fingerprint())
+	}
+	if asUUID.Fields[0].Kind != schema.KindUUID {
+		t.Fatalf("expected KindUUID, got %d", asUUID.Fields[0].Kind)
+	}
+}
+
+func TestUUIDFieldSmallerThanString(t *testing.T) {
+	asUUID := parseSingleSchema(t, "@schema Device\n@field ID uuid\n", "Device")
+	asString := parseSingleSchema(t, "@schema Device\n@field ID string\n", "Device")
+
+	rows := make([]map[string]any, 0, 256)
+	for i := 0; i < 256; i++ {
+		id, err := storage.GenerateUUIDv7()
+		if err != nil {
+			t.Fatalf("GenerateUUIDv7: %v", err)
+		}
+		rows = append(rows, map[string]any{"ID": id})
+	}
+	uuidPayload, err := scrt.Marshal(asUUID, rows)
+	if err != nil {
+		t.Fatalf("Marshal uuid: %v", err)
+	}
+	stringPayload, err := scrt.Marshal(asString, rows)
+	if err != nil {
+		t.Fatalf("Marshal string: %v", err)
+	}
+	if len(uuidPayload) >= len(stringPayload) {
+		t.Fatalf("uuid payload %d bytes not smaller than string payload %d bytes", len(uuidPayload), len(stringPayload))
+	}
+	t.Logf("uuid payload %d bytes, string payload %d bytes", len(uuidPayload), len(stringPayload))
+}
@@ -0,0 +1,134 @@
+package scrt
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+	"github.com/oarkflow/scrt/temporal"
+	"github.com/oarkflow/scrt/uuid"
+)
+
+// MaxValidationViolations caps the violations a ValidationReport lists.
+// Later violations are only counted.
+const MaxValidationViolations = 100
+
+// Validation rules reported in Violation.Rule.
+const (
+	RuleRequired = "required"
+	RuleUnique   = "unique"
+	RuleEnum     = "enum"
+)
+
+// ValidationReport summarizes a payload checked against its schema's
+// constraints.
+type ValidationReport struct {
+	Rows uint64 `json:"rows"`
+	// NullCounts holds, per field, the rows that leave it unset after
+	// defaults are applied. Fields that are always set are omitted.
+	NullCounts      map[string]uint64 `json:"nullCounts"`
+	Violations      []Violation       `json:"violations"`
+	TotalViolations int               `json:"totalViolations"`
+}
+
+// Valid reports whether no row broke a constraint.
+func (r ValidationReport) Valid() bool {
+	return r.TotalViolations == 0
+}
+
+// Violation is one row that breaks a field constraint.
+type Violation struct {
+	Row     uint64 `json:"row"`
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidatePayload decodes data and checks every row against the schema's
+// required, unique, and enum= constraints without stopping at the first
+// failure. At most MaxValidationViolations violations are kept; unique
+// checks still remember one key per distinct value. A payload that cannot be
+// decoded returns the report so far together with the decode error.
+func ValidatePayload(data []byte, s *schema.Schema) (ValidationReport, error) {
+	report := ValidationReport{NullCounts: make(map[string]uint64), Violations: []Violation{}}
+	if s == nil {
+		return report, ErrSchemaRequired
+	}
+	seen := make(map[int]map[string]uint64)
+	for idx, field := range s.Fields {
+		if field.HasAttribute("unique") {
+			seen[idx] = make(map[string]uint64)
+		}
+	}
+	add := func(v Violation) {
+		report.TotalViolations++
+		if len(report.Violations) < MaxValidationViolations {
+			report.Violations = append(report.Violations, v)
+		}
+	}
+	reader := codec.NewReader(bytes.NewReader(data), s)
+	row := codec.NewRow(s)
+	for {
+		ok, err := reader.ReadRow(row)
+		if err != nil {
+			return report, err
+		}
+		if !ok {
+			return report, nil
+		}
+		rowID := report.Rows
+		report.Rows++
+		values := row.Values()
+		for idx, field := range s.Fields {
+			val := values[idx]
+			if !val.Set {
+				report.NullCounts[field.Name]++
+				if field.HasAttribute("required") {
+					add(Violation{Row: rowID, Field: field.Name, Rule: RuleRequired, Message: "missing required value"})
+				}
+				continue
+			}
+			if len(field.Enum) > 0 && !slices.Contains(field.Enum, val.Str) {
+				add(Violation{Row: rowID, Field: field.Name, Rule: RuleEnum, Message: fmt.Sprintf("%q is not one of %s", val.Str, strings.Join(field.Enum, ", "))})
+			}
+			keys, unique := seen[idx]
+			if !unique {
+				continue
+			}
+			key, err := uniqueKey(field.ValueKind(), val)
+			if err != nil {
+				return report, fmt.Errorf("scrt: row %d field %s: %w", rowID, field.Name, err)
+			}
+			if first, dup := keys[key]; dup {
+				add(Violation{Row: rowID, Field: field.Name, Rule: RuleUnique, Message: fmt.Sprintf("duplicate value %s, first seen in row %d", key, first)})
+				continue
+			}
+			keys[key] = rowID
+		}
+	}
+}
+
+// uniqueKey renders a value of a unique-capable kind as a map key. Timestamptz
+// values compare by instant, as storage indexes do.
+func uniqueKey(kind schema.FieldKind, val codec.Value) (string, error) {
+	switch kind {
+	case schema.KindUint64, schema.KindRef:
+		return strconv.FormatUint(val.Uint, 10), nil
+	case schema.KindString:
+		return strconv.Quote(val.Str), nil
+	case schema.KindUUID:
+		return uuid.FormatBytes(val.Bytes), nil
+	case schema.KindTimestampTZ:
+		t, err := temporal.DecodeTimestampTZ(val.Str)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(temporal.EncodeInstant(t), 10), nil
+	default:
+		return strconv.FormatInt(val.Int, 10), nil
+	}
+}
@@ -0,0 +1,53 @@
+package scrt
+
+import (
+	"fmt"
+
+	"github.com/oarkflow/scrt/codec"
+	"github.com/oarkflow/scrt/schema"
+)
+
+// RegisterCodec registers a value codec for bytes fields declared with a
+// codec=<name> attribute. Marshal passes such fields' Go values to enc and
+// stores the returned bytes; Unmarshal hands the stored bytes to dec, which
+// must not retain them. Register codecs before parsing schemas that name
+// them. It panics if name is empty or either function is nil.
+func RegisterCodec(name string, enc func(any) ([]byte, error), dec func([]byte) (any, error)) {
+	if err := schema.RegisterCodec(name, schema.ValueCodec{Encode: enc, Decode: dec}); err != nil {
+		panic("scrt: " + err.Error())
+	}
+}
+
+// encodeWithCodec runs src through the codec of field.
+func encodeWithCodec(field schema.Field, src any) ([]byte, error) {
+	c, ok := schema.LookupCodec(field.Codec)
+	if !ok {
+		return nil, fmt.Errorf("scrt: codec %s is not registered", field.Codec)
+	}
+	data, err := c.Encode(src)
+	if err != nil {
+		return nil, fmt.Errorf("scrt: codec %s: %w", field.Codec, err)
+	}
+	return data, nil
+}
+
+// decodeWithCodec turns the stored bytes of field back into its Go value.
+func decodeWithCodec(field schema.Field, v codec.Value) (any, error) {
+	c, ok := schema.LookupCodec(field.Codec)
+	if !ok {
+		return nil, fmt.Errorf("scrt: codec %s is not registered", field.Codec)
+	}
+	out, err := c.Decode(v.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("scrt: codec %s: %w", field.Codec, err)
+	}
+	return out, nil
+}
+
+// fieldValueFromRow is valueFromRow for field, decoding codec= fields.
+func fieldValueFromRow(field schema.Field, v codec.Value) (any, error) {
+	if field.Codec != "" {
+		return decodeWithCodec(field, v)
+	}
+	return valueFromRow(field.ValueKind(), v), nil
+}